@@ -0,0 +1,136 @@
+// 演示context的取消如何在树中传播:
+//
+//  1. 扇出: 一个根context下挂了多层worker, 取消根节点后整棵树都被取消.
+//     cancel返回时所有子孙节点都已经是取消状态, 各个worker只是在不同的时间注意到Done.
+//  2. 子树超时: 一个分支的deadline到期只取消这个分支, 兄弟分支不受影响;
+//     父节点的deadline更早时, 子节点的WithTimeout不会创建自己的timer.
+//  3. Value沿着父节点链查找, 子节点的同名key会遮住父节点的.
+//  4. 父节点是用户自己实现的Context时, propagateCancel只能起一个goroutine等待它.
+//
+// 运行: go run *.go
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type event struct {
+	name string
+	err  error
+	at   time.Duration
+}
+
+type recorder struct {
+	start  time.Time
+	mu     sync.Mutex
+	events []event
+	wg     sync.WaitGroup
+}
+
+// worker 在ctx的Done关闭时记录下自己观察到的错误, 并为每个子节点再起一个worker
+func (r *recorder) worker(ctx Context, name string, depth int) {
+	for i := 0; i < depth; i++ {
+		child, cancel := WithCancel(ctx)
+		defer cancel()
+		r.wg.Add(1)
+		go r.worker(child, fmt.Sprintf("%s.%d", name, i), depth-1)
+	}
+	<-ctx.Done()
+	r.mu.Lock()
+	r.events = append(r.events, event{name, ctx.Err(), time.Since(r.start)})
+	r.mu.Unlock()
+	r.wg.Done()
+}
+
+func (r *recorder) print() {
+	r.wg.Wait()
+	sort.Slice(r.events, func(i, j int) bool { return r.events[i].name < r.events[j].name })
+	for _, e := range r.events {
+		fmt.Printf("  %-8s %-26v after %v\n", e.name, e.err, e.at.Round(time.Millisecond))
+	}
+}
+
+func fanOut() {
+	fmt.Println("cancel the root of a 3-level tree:")
+	r := &recorder{start: time.Now()}
+	root, cancel := WithCancel(Background())
+	r.wg.Add(1)
+	go r.worker(root, "root", 2)
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	r.print()
+}
+
+func subtreeTimeout() {
+	fmt.Println("one branch times out, its sibling is canceled later by the root:")
+	r := &recorder{start: time.Now()}
+	root, cancel := WithCancel(Background())
+	fast, cancelFast := WithTimeout(root, 10*time.Millisecond)
+	defer cancelFast()
+	slow, cancelSlow := WithTimeout(root, time.Hour)
+	defer cancelSlow()
+	r.wg.Add(2)
+	go r.worker(fast, "fast", 1)
+	go r.worker(slow, "slow", 1)
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	r.print()
+
+	// 父节点的deadline更早, WithTimeout直接退化成WithCancel
+	inner, cancelInner := WithTimeout(fast, time.Hour)
+	defer cancelInner()
+	_, isTimer := inner.(*timerCtx)
+	fmt.Printf("  WithTimeout(1h) under a 10ms parent creates its own timer: %v\n", isTimer)
+}
+
+type key string
+
+func valueChain() {
+	ctx := WithValue(Background(), key("user"), "alice")
+	ctx = WithValue(ctx, key("request"), "r-1")
+	ctx, cancel := WithCancel(ctx)
+	defer cancel()
+	ctx = WithValue(ctx, key("user"), "bob")
+	fmt.Println("value lookup chain:")
+	fmt.Printf("  %v\n", ctx)
+	for _, k := range []key{"user", "request", "trace"} {
+		fmt.Printf("  Value(%q) = %v\n", k, ctx.Value(k))
+	}
+}
+
+// customCtx 是用户自己实现的Context, 有自己的Done channel
+type customCtx struct {
+	Context
+	done chan struct{}
+}
+
+func (c *customCtx) Done() <-chan struct{} { return c.done }
+
+func (c *customCtx) Err() error {
+	select {
+	case <-c.done:
+		return Canceled
+	default:
+		return nil
+	}
+}
+
+func customParent() {
+	parent := &customCtx{Context: Background(), done: make(chan struct{})}
+	before := goroutines
+	child, cancel := WithCancel(parent)
+	defer cancel()
+	close(parent.done)
+	<-child.Done()
+	fmt.Printf("custom parent: propagateCancel started %d goroutine(s), child err: %v\n", goroutines-before, child.Err())
+}
+
+func main() {
+	fanOut()
+	subtreeTimeout()
+	valueChain()
+	customParent()
+}
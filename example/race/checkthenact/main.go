@@ -0,0 +1,106 @@
+// 演示sync.Map上的check-then-act:
+//
+// 多个goroutine统计同一批key出现的次数. 错误的写法先Load, 没有再Store一个新的计数器:
+// 两个goroutine可能都Load不到, 各自Store一个计数器, 后Store的覆盖先Store的,
+// 加在被覆盖的计数器上的次数就丢了. 已经有计数器时, Load出来加一再Store回去也一样会丢.
+// Load和Store各自都是并发安全的, 没有data race, -race什么也报告不了, 只能从结果看出来.
+//
+// 正确的写法用LoadOrStore: 检查和插入是一个操作, 所有goroutine拿到的是同一个计数器,
+// 计数器本身用atomic增加.
+//
+// 运行: go run -race main.go
+// 修正后的版本: go run -race main.go -fixed
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	goroutines = 8
+	keys       = 100
+	rounds     = 100
+)
+
+// racy 返回每个key的计数器创建了多少次, 以及最后的总数
+func racy(m *sync.Map) (created int64) {
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				for k := 0; k < keys; k++ {
+					v, ok := m.Load(k)
+					if !ok {
+						// check和act之间, 别的goroutine可能已经Store了
+						atomic.AddInt64(&created, 1)
+						m.Store(k, 1)
+						continue
+					}
+					m.Store(k, v.(int)+1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return created
+}
+
+func fixed(m *sync.Map) (created int64) {
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				for k := 0; k < keys; k++ {
+					v, ok := m.Load(k)
+					if !ok {
+						// 快速路径没找到才分配, LoadOrStore决定用谁的
+						var loaded bool
+						v, loaded = m.LoadOrStore(k, new(int64))
+						if !loaded {
+							atomic.AddInt64(&created, 1)
+						}
+					}
+					atomic.AddInt64(v.(*int64), 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	return created
+}
+
+func total(m *sync.Map) int64 {
+	var n int64
+	m.Range(func(_, v interface{}) bool {
+		switch v := v.(type) {
+		case int:
+			n += int64(v)
+		case *int64:
+			n += atomic.LoadInt64(v)
+		}
+		return true
+	})
+	return n
+}
+
+func main() {
+	useFixed := flag.Bool("fixed", false, "run the corrected version")
+	flag.Parse()
+
+	var m sync.Map
+	var created int64
+	if *useFixed {
+		created = fixed(&m)
+	} else {
+		created = racy(&m)
+	}
+	fmt.Printf("counters created: %d, want %d\n", created, keys)
+	fmt.Printf("total count:      %d, want %d\n", total(&m), goroutines*rounds*keys)
+}
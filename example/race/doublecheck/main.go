@@ -0,0 +1,108 @@
+// 演示错误的double-checked locking:
+//
+// 第一次检查instance没有加锁, 是为了初始化之后不再加锁. 但这个读和加锁后的写之间
+// 没有happens-before关系: 编译器和CPU可以重排初始化中的写和instance的赋值,
+// 另一个goroutine看到instance不为nil, 读到的字段却可能还是零值. -race会报告这个读.
+//
+// 正确的写法是sync.Once: Do返回时f中的写入对调用者可见, 初始化完成后Do只是一次
+// 原子读(见doc/sync/once.md). 需要自己写快速路径时, 用atomic读写指针, 它和加锁后的
+// 写之间有happens-before关系.
+//
+// 运行: go run -race main.go
+// 修正后的版本: go run -race main.go -fixed
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+type config struct {
+	addr    string
+	retries int
+}
+
+func load() *config {
+	c := new(config)
+	c.addr = "localhost:8080"
+	c.retries = 3
+	return c
+}
+
+type racyLoader struct {
+	mu       sync.Mutex
+	instance *config
+}
+
+func (l *racyLoader) get() *config {
+	if l.instance == nil { // 没有同步的读
+		l.mu.Lock()
+		if l.instance == nil {
+			l.instance = load()
+		}
+		l.mu.Unlock()
+	}
+	return l.instance
+}
+
+type onceLoader struct {
+	once     sync.Once
+	instance *config
+}
+
+func (l *onceLoader) get() *config {
+	l.once.Do(func() { l.instance = load() })
+	return l.instance
+}
+
+// atomicLoader 是手写快速路径的正确版本
+type atomicLoader struct {
+	mu       sync.Mutex
+	instance unsafe.Pointer // *config
+}
+
+func (l *atomicLoader) get() *config {
+	if p := atomic.LoadPointer(&l.instance); p != nil {
+		return (*config)(p)
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.instance == nil {
+		atomic.StorePointer(&l.instance, unsafe.Pointer(load()))
+	}
+	return (*config)(l.instance)
+}
+
+func run(get func() *config) (broken int) {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c := get()
+			if c.addr == "" || c.retries == 0 {
+				mu.Lock()
+				broken++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return broken
+}
+
+func main() {
+	useFixed := flag.Bool("fixed", false, "run the corrected versions")
+	flag.Parse()
+
+	if !*useFixed {
+		fmt.Printf("racyLoader:   %d goroutines saw a partly initialized config\n", run(new(racyLoader).get))
+		return
+	}
+	fmt.Printf("onceLoader:   %d goroutines saw a partly initialized config\n", run(new(onceLoader).get))
+	fmt.Printf("atomicLoader: %d goroutines saw a partly initialized config\n", run(new(atomicLoader).get))
+}
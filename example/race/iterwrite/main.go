@@ -0,0 +1,127 @@
+// 演示遍历内置map的同时写入:
+//
+// 一个goroutine不断遍历连接表统计连接数, 另一个goroutine不断加入和删除连接.
+// 只有一个写入者, 错误只可能来自遍历和写入之间.
+// 内置map的迭代器假设遍历期间没有别的goroutine修改它(见doc/runtime/map.md),
+// runtime发现hashWriting标志时直接退出: "concurrent map iteration and map write",
+// 这个错误不能recover. 检测是尽力而为的, -race能更早更稳定地报告.
+//
+// 正确的写法之一是RWMutex: 遍历持有读锁, 写入持有写锁.
+// 另一种是sync.Map: Range不持有锁, 遍历开始时的key每个最多访问一次,
+// 并发的写入可能看到也可能看不到, 适合这种只需要大致数字的统计.
+//
+// 运行: go run -race main.go
+// 修正后的版本: go run -race main.go -fixed
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const duration = 200 * time.Millisecond
+
+// table 是连接表的三种实现共同的接口
+type table interface {
+	add(id int)
+	remove(id int)
+	count() int
+}
+
+type racyTable struct {
+	conns map[int]time.Time
+}
+
+func (t *racyTable) add(id int)    { t.conns[id] = time.Now() }
+func (t *racyTable) remove(id int) { delete(t.conns, id) }
+func (t *racyTable) count() int {
+	n := 0
+	for range t.conns {
+		n++
+	}
+	return n
+}
+
+type lockedTable struct {
+	mu    sync.RWMutex
+	conns map[int]time.Time
+}
+
+func (t *lockedTable) add(id int) {
+	t.mu.Lock()
+	t.conns[id] = time.Now()
+	t.mu.Unlock()
+}
+
+func (t *lockedTable) remove(id int) {
+	t.mu.Lock()
+	delete(t.conns, id)
+	t.mu.Unlock()
+}
+
+func (t *lockedTable) count() int {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	n := 0
+	for range t.conns {
+		n++
+	}
+	return n
+}
+
+type syncTable struct {
+	conns sync.Map
+}
+
+func (t *syncTable) add(id int)    { t.conns.Store(id, time.Now()) }
+func (t *syncTable) remove(id int) { t.conns.Delete(id) }
+func (t *syncTable) count() int {
+	n := 0
+	t.conns.Range(func(_, _ interface{}) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+func run(name string, t table) {
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			// 奇数id加入后马上删除, 最后剩下500个偶数id
+			id := i % 1000
+			t.add(id)
+			if id%2 == 1 {
+				t.remove(id)
+			}
+		}
+	}()
+	counts := 0
+	for start := time.Now(); time.Since(start) < duration; counts++ {
+		t.count()
+	}
+	close(stop)
+	<-done
+	fmt.Printf("%-12s %d counts while writing, %d connections at the end\n", name, counts, t.count())
+}
+
+func main() {
+	useFixed := flag.Bool("fixed", false, "run the corrected versions")
+	flag.Parse()
+
+	if !*useFixed {
+		run("racyTable", &racyTable{conns: make(map[int]time.Time)})
+		return
+	}
+	run("lockedTable", &lockedTable{conns: make(map[int]time.Time)})
+	run("syncTable", new(syncTable))
+}
@@ -0,0 +1,160 @@
+// 演示Value支持的copy-on-write模式:
+//
+//  1. 配置热更新: 写者构造一份新的配置再整体Store, 读者Load之后随便读, 不加锁.
+//     读者看到的要么是旧配置, 要么是新配置, 不会看到写了一半的配置.
+//  2. 读多写少的map: 写者在Mutex保护下复制整个map再Store, 读者无锁Load.
+//     sync.Map的read字段就是这样一个atomic.Value, 只是把 "复制整个map" 推迟到了dirty提升时.
+//  3. Value的两条限制: 不能Store(nil), 所有Store的类型必须一致.
+//
+// 运行: go run *.go
+package main
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// config 一旦通过Value发布就不再修改, 更新时替换整个config
+type config struct {
+	version  int
+	backends []string
+	weights  map[string]int // 每个backend的权重, 和backends必须一致
+}
+
+func newConfig(version int) *config {
+	c := &config{version: version, weights: make(map[string]int)}
+	for i := 0; i < 3+version%3; i++ {
+		b := fmt.Sprintf("10.0.%d.%d:80", version, i)
+		c.backends = append(c.backends, b)
+		c.weights[b] = version
+	}
+	return c
+}
+
+// hotReload 一个写者不断发布新配置, 多个读者同时读取并检查配置是否完整
+func hotReload() {
+	var current Value
+	current.Store(newConfig(0))
+
+	var stop uint32
+	var wg sync.WaitGroup
+	var reads, torn int64
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for atomic.LoadUint32(&stop) == 0 {
+				c := current.Load().(*config)
+				// 读者拿到的是一个不会再被修改的快照, 整个检查过程不需要加锁
+				if len(c.weights) != len(c.backends) {
+					atomic.AddInt64(&torn, 1)
+				}
+				for _, b := range c.backends {
+					if c.weights[b] != c.version {
+						atomic.AddInt64(&torn, 1)
+					}
+				}
+				atomic.AddInt64(&reads, 1)
+			}
+		}()
+	}
+	const versions = 1000
+	for v := 1; v <= versions; v++ {
+		// 在新的config上做完所有修改之后才发布
+		current.Store(newConfig(v))
+		time.Sleep(10 * time.Microsecond)
+	}
+	atomic.StoreUint32(&stop, 1)
+	wg.Wait()
+	fmt.Printf("hot reload: %d versions, %d reads, %d torn reads, final version %d\n",
+		versions, reads, torn, current.Load().(*config).version)
+}
+
+// cowMap 是读多写少的map: 读者无锁, 写者复制整个map.
+// 这里直接照搬了sync/atomic文档中ReadMostly的例子
+type cowMap struct {
+	mu sync.Mutex // used only by writers
+	m  Value      // map[string]int
+}
+
+func newCOWMap() *cowMap {
+	c := new(cowMap)
+	c.m.Store(make(map[string]int))
+	return c
+}
+
+func (c *cowMap) Load(key string) (int, bool) {
+	m := c.m.Load().(map[string]int)
+	v, ok := m[key]
+	return v, ok
+}
+
+func (c *cowMap) Store(key string, val int) {
+	c.mu.Lock() // synchronize with other potential writers
+	defer c.mu.Unlock()
+	m1 := c.m.Load().(map[string]int)
+	m2 := make(map[string]int, len(m1)+1) // create a new value
+	for k, v := range m1 {
+		m2[k] = v // copy all data from the current object to the new one
+	}
+	m2[key] = val // do the update that we need
+	c.m.Store(m2) // atomically replace the current object with the new one
+	// At this point all new readers start working with the new version.
+	// The old version will be garbage collected once the existing readers
+	// (if any) are done with it.
+}
+
+func readMostly() {
+	m := newCOWMap()
+	var wg sync.WaitGroup
+	for w := 0; w < 2; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				m.Store(fmt.Sprintf("w%d-%d", w, i), i)
+			}
+		}(w)
+	}
+	var hits int64
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10000; i++ {
+				if _, ok := m.Load(fmt.Sprintf("w0-%d", i%100)); ok {
+					atomic.AddInt64(&hits, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	fmt.Printf("copy-on-write map: %d keys, %d read hits while writing\n", len(m.m.Load().(map[string]int)), hits)
+}
+
+func mustPanic(name string, f func()) {
+	defer func() {
+		fmt.Printf("%s: %v\n", name, recover())
+	}()
+	f()
+}
+
+func main() {
+	hotReload()
+	readMostly()
+
+	var v Value
+	mustPanic("Store(nil)", func() { v.Store(nil) })
+	v.Store(newConfig(1))
+	mustPanic("Store of another type", func() { v.Store("not a *config") })
+	// 具体类型必须完全相同: 即使都实现了同一个接口也不行
+	var e Value
+	e.Store(error(fmt.Errorf("a")))
+	mustPanic("Store of another error type", func() { e.Store(error(errString("b"))) })
+}
+
+type errString string
+
+func (e errString) Error() string { return string(e) }
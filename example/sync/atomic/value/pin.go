@@ -0,0 +1,16 @@
+package main
+
+import _ "unsafe" // for go:linkname
+
+// Value的第一次Store要在一个很短的窗口内禁止抢占, 和sync/atomic一样直接链接runtime中的实现.
+// 包中的pin.s是一个空的汇编文件, 用来允许声明没有函数体的函数.
+
+// runtime_procPin 禁止抢占并返回当前P的id
+//
+//go:linkname runtime_procPin runtime.procPin
+func runtime_procPin() int
+
+// runtime_procUnpin 重新允许抢占
+//
+//go:linkname runtime_procUnpin runtime.procUnpin
+func runtime_procUnpin()
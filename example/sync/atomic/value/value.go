@@ -0,0 +1,104 @@
+package main
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// Value 是对 go/src/sync/atomic/value.go 的逐行重写.
+//
+// A Value provides an atomic load and store of a consistently typed value.
+// The zero value for a Value returns nil from Load.
+// Once Store has been called, a Value must not be copied.
+//
+// A Value must not be copied after first use.
+type Value struct {
+	v interface{}
+}
+
+// ifaceWords is interface{} internal representation.
+//
+// interface{}在内存中是两个字: 类型指针和数据指针.
+// 硬件只能原子地读写一个字, 所以Value把interface{}拆成两个字分别原子读写,
+// 再靠 "类型不变" 的约束保证读到的两个字是一致的
+type ifaceWords struct {
+	typ  unsafe.Pointer
+	data unsafe.Pointer
+}
+
+// firstStoreInProgress 的地址是第一次Store进行中时typ的哨兵值.
+// Go 1.14中哨兵值是unsafe.Pointer(^uintptr(0)), runtime能容忍这样的指针, 但go vet会报告
+// "possible misuse of unsafe.Pointer"; 之后的版本改成了取一个全局变量的地址, 这里也这样做
+var firstStoreInProgress byte
+
+// Load returns the value set by the most recent Store.
+// It returns nil if there has been no call to Store for this Value.
+func (v *Value) Load() (x interface{}) {
+	vp := (*ifaceWords)(unsafe.Pointer(v))
+	typ := atomic.LoadPointer(&vp.typ)
+	// typ为哨兵值说明第一次Store正在进行中, 当作还没有值
+	if typ == nil || typ == unsafe.Pointer(&firstStoreInProgress) {
+		// First store not yet completed.
+		return nil
+	}
+	// 第一次Store完成之后typ就不会再变, 所以先读typ再读data,
+	// 读到的data一定和typ匹配
+	data := atomic.LoadPointer(&vp.data)
+	xp := (*ifaceWords)(unsafe.Pointer(&x))
+	xp.typ = typ
+	xp.data = data
+	return
+}
+
+// Store sets the value of the Value to x.
+// All calls to Store for a given Value must use values of the same concrete type.
+// Store of an inconsistent type panics, as does Store(nil).
+func (v *Value) Store(x interface{}) {
+	if x == nil {
+		panic("sync/atomic: store of nil value into Value")
+	}
+	vp := (*ifaceWords)(unsafe.Pointer(v))
+	xp := (*ifaceWords)(unsafe.Pointer(&x))
+	for {
+		typ := atomic.LoadPointer(&vp.typ)
+		if typ == nil {
+			// Attempt to start first store.
+			// Disable preemption so that other goroutines can use
+			// active spin wait to wait for completion; and so that
+			// GC does not see the fake type accidentally.
+			//
+			// 第一次Store要写两个字, 没法一次完成.
+			// 先把typ用CAS从nil改成哨兵值, 抢到的goroutine负责写入,
+			// 其他Store看到哨兵值就自旋等待. 禁止抢占让这个窗口尽可能短:
+			// 自旋的goroutine不会等一个被调度走的写入者
+			runtime_procPin()
+			if !atomic.CompareAndSwapPointer(&vp.typ, nil, unsafe.Pointer(&firstStoreInProgress)) {
+				runtime_procUnpin()
+				continue
+			}
+			// Complete first store.
+			//
+			// 先写data再写typ: Load看到真正的typ时data一定已经写好
+			atomic.StorePointer(&vp.data, xp.data)
+			atomic.StorePointer(&vp.typ, xp.typ)
+			runtime_procUnpin()
+			return
+		}
+		if typ == unsafe.Pointer(&firstStoreInProgress) {
+			// First store in progress. Wait.
+			// Since we disable preemption around the first store,
+			// we can wait with active spinning.
+			continue
+		}
+		// First store completed. Check type and overwrite data.
+		//
+		// 类型固定之后每次Store只需要原子地写data一个字.
+		// 这就是Value要求所有Store类型一致的原因: 类型也能变的话,
+		// typ和data就必须一起原子地修改, 一个字的原子操作做不到
+		if typ != xp.typ {
+			panic("sync/atomic: store of inconsistently typed value into Value")
+		}
+		atomic.StorePointer(&vp.data, xp.data)
+		return
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Cond 是对 go/src/sync/cond.go 的逐行重写.
+//
+// Cond implements a condition variable, a rendezvous point
+// for goroutines waiting for or announcing the occurrence
+// of an event.
+//
+// Each Cond has an associated Locker L (often a *Mutex or *RWMutex),
+// which must be held when changing the condition and
+// when calling the Wait method.
+//
+// A Cond must not be copied after first use.
+type Cond struct {
+	noCopy noCopy
+
+	// L is held while observing or changing the condition
+	L sync.Locker
+
+	notify  notifyList
+	checker copyChecker
+}
+
+// NewCond returns a new Cond with Locker l.
+func NewCond(l sync.Locker) *Cond {
+	return &Cond{L: l}
+}
+
+// Wait atomically unlocks c.L and suspends execution
+// of the calling goroutine. After later resuming execution,
+// Wait locks c.L before returning. Unlike in other systems,
+// Wait cannot return unless awoken by Broadcast or Signal.
+//
+// Because c.L is not locked when Wait first resumes, the caller
+// typically cannot assume that the condition is true when
+// Wait returns. Instead, the caller should Wait in a loop:
+//
+//	c.L.Lock()
+//	for !condition() {
+//	    c.Wait()
+//	}
+//	... make use of condition ...
+//	c.L.Unlock()
+func (c *Cond) Wait() {
+	c.checker.check()
+	// 持有L时取票. "原子地解锁并挂起" 就是靠它实现的:
+	// 解锁之后, 挂起之前发生的Signal/Broadcast会推进notify, 这张票不会被漏掉
+	t := notifyListAdd(&c.notify)
+	c.L.Unlock()
+	notifyListWait(&c.notify, t)
+	c.L.Lock()
+}
+
+// Signal wakes one goroutine waiting on c, if there is any.
+//
+// It is allowed but not required for the caller to hold c.L
+// during the call.
+func (c *Cond) Signal() {
+	c.checker.check()
+	notifyListNotifyOne(&c.notify)
+}
+
+// Broadcast wakes all goroutines waiting on c.
+//
+// It is allowed but not required for the caller to hold c.L
+// during the call.
+func (c *Cond) Broadcast() {
+	c.checker.check()
+	notifyListNotifyAll(&c.notify)
+}
+
+// copyChecker holds back pointer to itself to detect object copying.
+//
+// copyChecker第一次使用时记下自己的地址, 之后地址变了就说明Cond被复制了.
+// 复制后的Cond和原来的共享不了等待队列, 所以运行时直接panic, 而不只是靠vet检查
+type copyChecker uintptr
+
+func (c *copyChecker) check() {
+	// 三个条件依次是: 已经记录的地址不是自己; 记录地址失败(之前已经记录过);
+	// 再读一次仍然不是自己(排除和并发的第一次记录竞争的情况)
+	if uintptr(*c) != uintptr(unsafe.Pointer(c)) &&
+		!atomic.CompareAndSwapUintptr((*uintptr)(c), 0, uintptr(unsafe.Pointer(c))) &&
+		uintptr(*c) != uintptr(unsafe.Pointer(c)) {
+		panic("sync.Cond is copied")
+	}
+}
+
+// noCopy may be embedded into structs which must not be copied
+// after the first use.
+//
+// See https://golang.org/issues/8005#issuecomment-190753527
+// for details.
+type noCopy struct{}
+
+// Lock is a no-op used by -copylocks checker from `go vet`.
+func (*noCopy) Lock()   {}
+func (*noCopy) Unlock() {}
@@ -0,0 +1,133 @@
+// 演示用Cond实现的有界队列, 并和带缓冲的channel对比:
+//
+//  1. 多个生产者和消费者通过两种队列传递同样的数据, 结果一致.
+//     channel本身就是一个有界阻塞队列(runtime中的hchan也是 "锁 + 环形缓冲区 + 两个等待队列"),
+//     简单的生产者消费者直接用channel就够了, 通常也更快.
+//  2. Cond适合等待条件不止 "有没有元素" 的场景. 例如TakeAll一次取走所有元素并用Broadcast唤醒所有生产者,
+//     Close之后Put返回false而不是panic.
+//
+// 运行: go run *.go
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	producers = 4
+	consumers = 4
+	items     = 200000 // 每个生产者生产的元素个数
+	capacity  = 64
+)
+
+type queue interface {
+	Put(v int) bool
+	Take() (int, bool)
+	Close()
+}
+
+// chanQueue 用带缓冲的channel实现同样的接口
+type chanQueue struct {
+	c chan int
+}
+
+func (q chanQueue) Put(v int) bool {
+	q.c <- v
+	return true
+}
+
+func (q chanQueue) Take() (int, bool) {
+	v, ok := <-q.c
+	return v, ok
+}
+
+func (q chanQueue) Close() {
+	close(q.c)
+}
+
+// run 让生产者和消费者通过q传递数据, 返回所有元素之和与耗时
+func run(q queue) (sum int, elapsed time.Duration) {
+	start := time.Now()
+	var pwg, cwg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		pwg.Add(1)
+		go func() {
+			defer pwg.Done()
+			for i := 1; i <= items; i++ {
+				q.Put(i)
+			}
+		}()
+	}
+	sums := make([]int, consumers)
+	for c := 0; c < consumers; c++ {
+		cwg.Add(1)
+		go func(c int) {
+			defer cwg.Done()
+			for {
+				v, ok := q.Take()
+				if !ok {
+					return
+				}
+				sums[c] += v
+			}
+		}(c)
+	}
+	pwg.Wait()
+	q.Close()
+	cwg.Wait()
+	for _, s := range sums {
+		sum += s
+	}
+	return sum, time.Since(start)
+}
+
+func main() {
+	want := producers * items * (items + 1) / 2
+	fmt.Printf("%d producers, %d consumers, capacity %d, want sum %d\n", producers, consumers, capacity, want)
+	sum, d := run(newBoundedQueue(capacity))
+	fmt.Printf("  Cond queue: sum %d in %v\n", sum, d)
+	sum, d = run(chanQueue{make(chan int, capacity)})
+	fmt.Printf("  channel:    sum %d in %v\n", sum, d)
+
+	// TakeAll: 队列满时生产者阻塞在notFull上, 一次TakeAll之后用Broadcast把它们都唤醒
+	q := newBoundedQueue(4)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			q.Put(i)
+		}(i)
+	}
+	var sizes []int
+	for n := 0; n < 8; {
+		// 等生产者把队列填满, 剩下的生产者阻塞在notFull上
+		time.Sleep(10 * time.Millisecond)
+		vs, _ := q.TakeAll()
+		sizes = append(sizes, len(vs))
+		n += len(vs)
+	}
+	wg.Wait()
+	fmt.Printf("TakeAll drained 8 items in batches of %v\n", sizes)
+
+	// Close: 阻塞在空队列上的消费者都会被Broadcast唤醒
+	q = newBoundedQueue(4)
+	done := make(chan bool)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, ok := q.Take()
+			done <- ok
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	q.Close()
+	woken := 0
+	for i := 0; i < 3; i++ {
+		if !<-done {
+			woken++
+		}
+	}
+	fmt.Printf("Close woke %d blocked consumers; Put after Close returns %v\n", woken, q.Put(1))
+}
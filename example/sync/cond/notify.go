@@ -0,0 +1,198 @@
+package main
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// 这里用普通的go代码模拟runtime/sema.go中的notifyList,
+// sync.Cond通过 runtime_notifyListAdd / runtime_notifyListWait /
+// runtime_notifyListNotifyOne / runtime_notifyListNotifyAll 使用它.
+//
+// notifyList是一个基于票号(ticket)的通知队列:
+// 等待者先取一张票, 之后再挂起, 通知方按票号顺序唤醒.
+// 取票和挂起之间可以释放Cond.L, 这之间发生的Signal不会丢失:
+// 通知方已经把 "下一张要通知的票号" 推过了这张票, 等待者挂起前会发现自己已经被通知过了.
+//
+// runtime中保护队列的是runtime自己的mutex, 挂起和唤醒用的是gopark/goready,
+// 这里分别用自旋锁和容量为1的channel代替(不能用sync.Mutex, 否则就成了用Mutex实现Cond).
+type notifyList struct {
+	// wait is the ticket number of the next waiter. It is atomically
+	// incremented outside the lock.
+	//
+	// wait是下一个等待者的票号, 在锁外原子递增
+	wait uint32
+
+	// notify is the ticket number of the next waiter to be notified. It can
+	// be read outside the lock, but is only written to with lock held.
+	//
+	// Both wait & notify can wrap around, and such cases will be correctly
+	// handled as long as their "unwrapped" difference is bounded by 2^31.
+	// For this not to be the case, we'd need to have 2^31+ goroutines
+	// blocked on the same condvar, which is currently not possible.
+	//
+	// notify是下一个要被通知的票号, 可以在锁外读, 但只在持有锁时写.
+	// 票号小于notify的等待者都已经被通知过了
+	notify uint32
+
+	// List of parked waiters.
+	lock int32 // 自旋锁
+	head *notifyWaiter
+	tail *notifyWaiter
+}
+
+// notifyWaiter 相当于runtime中挂在notifyList上的sudog
+type notifyWaiter struct {
+	ticket uint32
+	ready  chan struct{} // 被唤醒时写入, 相当于goready
+	next   *notifyWaiter
+}
+
+func (l *notifyList) lockList() {
+	for !atomic.CompareAndSwapInt32(&l.lock, 0, 1) {
+		runtime.Gosched()
+	}
+}
+
+func (l *notifyList) unlockList() {
+	atomic.StoreInt32(&l.lock, 0)
+}
+
+// less checks if a < b, considering a & b running counts that may overflow the
+// 32-bit range, and that their "unwrapped" difference is always less than 2^31.
+//
+// 票号会回绕, 所以不能直接比较大小, 而是看差值的符号
+func less(a, b uint32) bool {
+	return int32(a-b) < 0
+}
+
+// notifyListAdd adds the caller to a notify list such that it can receive
+// notifications. The caller must eventually call notifyListWait to wait for
+// such a notification, passing the returned ticket number.
+//
+// 取票: 只是一次原子加, 调用时还持有Cond.L
+func notifyListAdd(l *notifyList) uint32 {
+	// This may be called concurrently, for example, when called from
+	// sync.Cond.Wait while holding a RWMutex in read mode.
+	return atomic.AddUint32(&l.wait, 1) - 1
+}
+
+// notifyListWait waits for a notification. If one has been sent since
+// notifyListAdd was called, it returns immediately. Otherwise, it blocks.
+func notifyListWait(l *notifyList, t uint32) {
+	l.lockList()
+
+	// Return right away if this ticket has already been notified.
+	//
+	// 取票之后, 挂起之前已经有人通知过这张票了, 直接返回
+	if less(t, l.notify) {
+		l.unlockList()
+		return
+	}
+
+	// Enqueue itself.
+	w := &notifyWaiter{ticket: t, ready: make(chan struct{}, 1)}
+	if l.tail == nil {
+		l.head = w
+	} else {
+		l.tail.next = w
+	}
+	l.tail = w
+	l.unlockList()
+
+	// 相当于goparkunlock
+	<-w.ready
+}
+
+// notifyListNotifyAll notifies all entries in the list.
+func notifyListNotifyAll(l *notifyList) {
+	// Fast-path: if there are no new waiters since the last notification
+	// we don't need to acquire the lock.
+	//
+	// wait和notify相等说明每张票都已经通知过了
+	if atomic.LoadUint32(&l.wait) == atomic.LoadUint32(&l.notify) {
+		return
+	}
+
+	// Pull the list out into a local variable, waiters will be readied
+	// outside the lock.
+	l.lockList()
+	w := l.head
+	l.head = nil
+	l.tail = nil
+
+	// Update the next ticket to be notified. We can set it to the current
+	// value of wait because any previous waiters are already in the list
+	// or will notice that they have already been notified when trying to
+	// add themselves to the list.
+	//
+	// 还没来得及入队的等待者会在notifyListWait中发现自己的票号小于notify
+	atomic.StoreUint32(&l.notify, atomic.LoadUint32(&l.wait))
+	l.unlockList()
+
+	// Go through the local list and ready all waiters.
+	for w != nil {
+		next := w.next
+		w.next = nil
+		w.ready <- struct{}{}
+		w = next
+	}
+}
+
+// notifyListNotifyOne notifies one entry in the list.
+func notifyListNotifyOne(l *notifyList) {
+	// Fast-path: if there are no new waiters since the last notification
+	// we don't need to acquire the lock at all.
+	if atomic.LoadUint32(&l.wait) == atomic.LoadUint32(&l.notify) {
+		return
+	}
+
+	l.lockList()
+
+	// Re-check under the lock if we need to do anything.
+	t := l.notify
+	if t == atomic.LoadUint32(&l.wait) {
+		l.unlockList()
+		return
+	}
+
+	// Update the next notify ticket number.
+	//
+	// 先推进notify: 即使票号为t的等待者还没入队, 它入队前也会发现自己已经被通知了
+	atomic.StoreUint32(&l.notify, t+1)
+
+	// Try to find the g that needs to be notified.
+	// If it hasn't made it to the list yet we won't find it,
+	// but it won't park itself once it sees the new notify number.
+	//
+	// This scan looks linear but essentially always stops quickly.
+	// Because g's queue separately from taking numbers,
+	// there may be minor reorderings in the list, but we
+	// expect the g we're looking for to be near the front.
+	// The g has others in front of it on the list only to the
+	// extent that it lost the race, so the iteration will not
+	// be too long. This applies even when the g is missing:
+	// it hasn't yet gotten to sleep and has lost the race to
+	// the (few) other g's that we find on the list.
+	//
+	// 取票和入队不是原子的, 所以队列中的顺序和票号顺序可能略有出入,
+	// 这里按票号找, 而不是直接取队头
+	for p, w := (*notifyWaiter)(nil), l.head; w != nil; p, w = w, w.next {
+		if w.ticket == t {
+			n := w.next
+			if p != nil {
+				p.next = n
+			} else {
+				l.head = n
+			}
+			if n == nil {
+				l.tail = p
+			}
+			l.unlockList()
+			w.next = nil
+			w.ready <- struct{}{}
+			return
+		}
+	}
+	l.unlockList()
+}
@@ -0,0 +1,89 @@
+package main
+
+import "sync"
+
+// boundedQueue 是用Cond实现的有界阻塞队列, 队列满时Put阻塞, 队列空时Take阻塞.
+//
+// 同一个Mutex对应两个Cond: notEmpty给消费者等, notFull给生产者等.
+// 这样Put只唤醒消费者, Take只唤醒生产者, 不会唤醒一个醒来也干不了活的goroutine
+type boundedQueue struct {
+	mu       sync.Mutex
+	notEmpty *Cond
+	notFull  *Cond
+	buf      []int
+	head     int // 队头在buf中的下标
+	n        int // 队列中的元素个数
+	closed   bool
+}
+
+func newBoundedQueue(capacity int) *boundedQueue {
+	q := &boundedQueue{buf: make([]int, capacity)}
+	q.notEmpty = NewCond(&q.mu)
+	q.notFull = NewCond(&q.mu)
+	return q
+}
+
+// Put 把v放到队尾, 队列满时阻塞. 队列关闭后返回false
+func (q *boundedQueue) Put(v int) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	// Wait返回时条件不一定成立(可能被别的生产者抢先了), 必须在循环中检查
+	for q.n == len(q.buf) && !q.closed {
+		q.notFull.Wait()
+	}
+	if q.closed {
+		return false
+	}
+	q.buf[(q.head+q.n)%len(q.buf)] = v
+	q.n++
+	q.notEmpty.Signal()
+	return true
+}
+
+// Take 取出队头, 队列空时阻塞. 队列关闭并且取空后返回false
+func (q *boundedQueue) Take() (int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.n == 0 && !q.closed {
+		q.notEmpty.Wait()
+	}
+	if q.n == 0 {
+		return 0, false
+	}
+	v := q.buf[q.head]
+	q.head = (q.head + 1) % len(q.buf)
+	q.n--
+	q.notFull.Signal()
+	return v, true
+}
+
+// TakeAll 一次取出队列中的所有元素, 队列空时阻塞.
+// 用channel实现同样的语义需要先阻塞收一个, 再循环非阻塞地收, 而且拿不到一致的快照
+func (q *boundedQueue) TakeAll() ([]int, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.n == 0 && !q.closed {
+		q.notEmpty.Wait()
+	}
+	if q.n == 0 {
+		return nil, false
+	}
+	vs := make([]int, q.n)
+	for i := range vs {
+		vs[i] = q.buf[(q.head+i)%len(q.buf)]
+	}
+	q.head, q.n = 0, 0
+	// 一下子空出了很多位置, 所有生产者都可能可以继续, 所以用Broadcast
+	q.notFull.Broadcast()
+	return vs, true
+}
+
+// Close 关闭队列, 唤醒所有阻塞的生产者和消费者.
+// 和关闭channel不同, 重复Close和关闭后Put都不会panic
+func (q *boundedQueue) Close() {
+	q.mu.Lock()
+	q.closed = true
+	q.mu.Unlock()
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
@@ -0,0 +1,64 @@
+// 演示Mutex的饥饿模式和handoff:
+//
+// greedy goroutine在循环中不停地加锁解锁, 它解锁后马上又来抢锁,
+// 此时它正在CPU上运行, 总是比刚被唤醒的waiter抢得快, waiter一直拿不到锁.
+// waiter等待超过1ms后把Mutex切到饥饿模式, 之后greedy的Unlock
+// 会把锁直接交给waiter (handoff), greedy自己排到队尾.
+//
+// 运行: go run *.go
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+func main() {
+	runtime.GOMAXPROCS(2)
+	trace = func(format string, args ...interface{}) {
+		fmt.Printf("  [mutex] "+format+"\n", args...)
+	}
+
+	var mu Mutex
+	var greedyRounds int64
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			mu.Lock()
+			atomic.AddInt64(&greedyRounds, 1)
+			// 持有锁一小段时间, 让waiter有机会被唤醒
+			busy(50 * time.Microsecond)
+			mu.Unlock()
+		}
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	for i := 0; i < 3; i++ {
+		before := atomic.LoadInt64(&greedyRounds)
+		start := time.Now()
+		mu.Lock()
+		wait := time.Since(start)
+		rounds := atomic.LoadInt64(&greedyRounds) - before
+		mu.Unlock()
+		fmt.Printf("waiter acquired the lock after %v; greedy locked it %d times meanwhile\n",
+			wait.Round(time.Microsecond), rounds)
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(stop)
+	<-done
+}
+
+// busy 空转d时间, 不让出CPU
+func busy(d time.Duration) {
+	for start := time.Now(); time.Since(start) < d; {
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// Mutex 是对 go/src/sync/mutex.go 的逐行重写,
+// 只把runtime提供的函数换成了普通go代码 (见sema.go 和文件末尾),
+// 并在关键的状态转换处调用trace, 方便观察.
+type Mutex struct {
+	// state 是一个打包的状态字:
+	//
+	//   | 31 ... 3      | 2        | 1      | 0      |
+	//   | waiter count  | starving | woken  | locked |
+	//
+	// locked:   锁已被持有
+	// woken:    已经有一个被唤醒(或正在自旋)的goroutine在抢锁,
+	//           Unlock不需要再唤醒别人
+	// starving: 饥饿模式, 锁由Unlock直接交给队头的等待者
+	// waiter count: 在信号量上排队的goroutine数量
+	state int32
+
+	// sema 是等待者排队用的信号量
+	sema uint32
+}
+
+const (
+	mutexLocked = 1 << iota // mutex is locked
+	mutexWoken
+	mutexStarving
+	mutexWaiterShift = iota
+
+	// Mutex fairness.
+	//
+	// Mutex can be in 2 modes of operations: normal and starvation.
+	// In normal mode waiters are queued in FIFO order, but a woken up waiter
+	// does not own the mutex and competes with new arriving goroutines over
+	// the ownership. New arriving goroutines have an advantage -- they are
+	// already running on CPU and there can be lots of them, so a woken up
+	// waiter has good chances of losing. In such case it is queued at front
+	// of the wait queue. If a waiter fails to acquire the mutex for more than 1ms,
+	// it switches mutex to the starvation mode.
+	//
+	// In starvation mode ownership of the mutex is directly handed off from
+	// the unlocking goroutine to the waiter at the front of the queue.
+	// New arriving goroutines don't try to acquire the mutex even if it appears
+	// to be unlocked, and don't try to spin. Instead they queue themselves at
+	// the tail of the wait queue.
+	//
+	// If a waiter receives ownership of the mutex and sees that either
+	// (1) it is the last waiter in the queue, or (2) it waited for less than 1 ms,
+	// it switches mutex back to normal operation mode.
+	//
+	// Normal mode has considerably better performance as a goroutine can acquire
+	// a mutex several times in a row even if there are blocked waiters.
+	// Starvation mode is important to prevent pathological cases of tail latency.
+	starvationThresholdNs = 1e6
+)
+
+// trace 在状态转换时被调用, main中设置
+var trace = func(format string, args ...interface{}) {}
+
+// Lock locks m.
+// If the lock is already in use, the calling goroutine
+// blocks until the mutex is available.
+func (m *Mutex) Lock() {
+	// Fast path: grab unlocked mutex.
+	// 快速路径: state为0(没有锁, 没有等待者, 不在饥饿模式)时一次CAS拿到锁
+	if atomic.CompareAndSwapInt32(&m.state, 0, mutexLocked) {
+		return
+	}
+	// Slow path (outlined so that the fast path can be inlined)
+	m.lockSlow()
+}
+
+func (m *Mutex) lockSlow() {
+	var waitStartTime int64
+	starving := false // 当前goroutine是否已经等待超过1ms
+	awoke := false    // 当前goroutine是否是被唤醒的 (或者在自旋时设置了woken)
+	iter := 0         // 自旋次数
+	old := atomic.LoadInt32(&m.state)
+	for {
+		// Don't spin in starvation mode, ownership is handed off to waiters
+		// so we won't be able to acquire the mutex anyway.
+		// 锁被持有且不在饥饿模式时才自旋: 持有者很可能马上释放,
+		// 自旋等待比挂起再唤醒便宜得多
+		if old&(mutexLocked|mutexStarving) == mutexLocked && canSpin(iter) {
+			// Active spinning makes sense.
+			// Try to set mutexWoken flag to inform Unlock
+			// to not wake other blocked goroutines.
+			// 设置woken告诉Unlock: 已经有人在抢了, 不要再从队列里唤醒一个
+			if !awoke && old&mutexWoken == 0 && old>>mutexWaiterShift != 0 &&
+				atomic.CompareAndSwapInt32(&m.state, old, old|mutexWoken) {
+				awoke = true
+			}
+			doSpin()
+			iter++
+			old = atomic.LoadInt32(&m.state)
+			continue
+		}
+		new := old
+		// Don't try to acquire starving mutex, new arriving goroutines must queue.
+		// 饥饿模式下新来的goroutine不抢锁, 老老实实排队
+		if old&mutexStarving == 0 {
+			new |= mutexLocked
+		}
+		// 锁被持有或处于饥饿模式, 这次CAS成功后当前goroutine要排队, 等待者加一
+		if old&(mutexLocked|mutexStarving) != 0 {
+			new += 1 << mutexWaiterShift
+		}
+		// The current goroutine switches mutex to starvation mode.
+		// But if the mutex is currently unlocked, don't do the switch.
+		// Unlock expects that starving mutex has waiters, which will not
+		// be true in this case.
+		if starving && old&mutexLocked != 0 {
+			new |= mutexStarving
+		}
+		if awoke {
+			// The goroutine has been woken from sleep,
+			// so we need to reset the flag in either case.
+			if new&mutexWoken == 0 {
+				panic("sync: inconsistent mutex state")
+			}
+			new &^= mutexWoken
+		}
+		if atomic.CompareAndSwapInt32(&m.state, old, new) {
+			if old&(mutexLocked|mutexStarving) == 0 {
+				break // locked the mutex with CAS
+			}
+			if new&mutexStarving != 0 && old&mutexStarving == 0 {
+				trace("waiter waited %v, mutex enters starvation mode", since(waitStartTime))
+			}
+			// If we were already waiting before, queue at the front of the queue.
+			// 第二次及以后的等待排到队头, 保证等得最久的goroutine最先被唤醒
+			queueLifo := waitStartTime != 0
+			if waitStartTime == 0 {
+				waitStartTime = nanotime()
+			}
+			semacquireMutex(&m.sema, queueLifo)
+			starving = starving || nanotime()-waitStartTime > starvationThresholdNs
+			old = atomic.LoadInt32(&m.state)
+			if old&mutexStarving != 0 {
+				// If this goroutine was woken and mutex is in starvation mode,
+				// ownership was handed off to us but mutex is in somewhat
+				// inconsistent state: mutexLocked is not set and we are still
+				// accounted as waiter. Fix that.
+				// 饥饿模式下被唤醒 = 锁已经交给了自己, 但Unlock没有设置locked,
+				// 也没有减等待者, 这里一次原子加法同时完成这两件事
+				if old&(mutexLocked|mutexWoken) != 0 || old>>mutexWaiterShift == 0 {
+					panic("sync: inconsistent mutex state")
+				}
+				delta := int32(mutexLocked - 1<<mutexWaiterShift)
+				if !starving || old>>mutexWaiterShift == 1 {
+					// Exit starvation mode.
+					// Critical to do it here and consider wait time.
+					// Starvation mode is so inefficient, that two goroutines
+					// can go lock-step infinitely once they switch mutex
+					// to starvation mode.
+					delta -= mutexStarving
+					trace("handed-off waiter waited %v, mutex leaves starvation mode", since(waitStartTime))
+				} else {
+					trace("handed-off waiter waited %v", since(waitStartTime))
+				}
+				atomic.AddInt32(&m.state, delta)
+				break
+			}
+			// 正常模式下被唤醒, 要和新来的goroutine重新抢锁
+			awoke = true
+			iter = 0
+		} else {
+			old = atomic.LoadInt32(&m.state)
+		}
+	}
+}
+
+// Unlock unlocks m.
+// It is a run-time error if m is not locked on entry to Unlock.
+func (m *Mutex) Unlock() {
+	// Fast path: drop lock bit.
+	// 去掉locked后state为0, 说明没有等待者, 也没有其他标志, 直接返回
+	new := atomic.AddInt32(&m.state, -mutexLocked)
+	if new != 0 {
+		// Outlined slow path to allow inlining the fast path.
+		m.unlockSlow(new)
+	}
+}
+
+func (m *Mutex) unlockSlow(new int32) {
+	if (new+mutexLocked)&mutexLocked == 0 {
+		panic("sync: unlock of unlocked mutex")
+	}
+	if new&mutexStarving == 0 {
+		old := new
+		for {
+			// If there are no waiters or a goroutine has already
+			// been woken or grabbed the lock, no need to wake anyone.
+			// In starvation mode ownership is directly handed off from unlocking
+			// goroutine to the next waiter. We are not part of this chain,
+			// since we did not observe mutexStarving when we unlocked the mutex above.
+			// So get off the way.
+			if old>>mutexWaiterShift == 0 || old&(mutexLocked|mutexWoken|mutexStarving) != 0 {
+				return
+			}
+			// Grab the right to wake someone.
+			// 等待者减一并设置woken, 然后唤醒一个; 被唤醒的goroutine不直接拥有锁
+			new = (old - 1<<mutexWaiterShift) | mutexWoken
+			if atomic.CompareAndSwapInt32(&m.state, old, new) {
+				semrelease(&m.sema, false)
+				return
+			}
+			old = atomic.LoadInt32(&m.state)
+		}
+	} else {
+		// Starving mode: handoff mutex ownership to the next waiter, and yield
+		// our time slice so that the next waiter can start to run immediately.
+		// Note: mutexLocked is not set, the waiter will set it after wakeup.
+		// But mutex is still considered locked if mutexStarving is set,
+		// so new coming goroutines won't acquire it.
+		semrelease(&m.sema, true)
+	}
+}
+
+// 以下函数在sync包中由runtime提供
+
+// canSpin 对应 runtime.sync_runtime_canSpin:
+// 自旋次数少于4次, 多核, 并且至少还有一个其他的P在运行时才自旋.
+// runtime还要求当前P的本地运行队列为空, 这一点在runtime外无法判断
+func canSpin(i int) bool {
+	return i < 4 && runtime.NumCPU() > 1 && runtime.GOMAXPROCS(0) > 1
+}
+
+// doSpin 对应 runtime.sync_runtime_doSpin, 即 procyield(30):
+// 执行30次PAUSE指令, 这里用空转模拟
+func doSpin() {
+	for i := 0; i < 30; i++ {
+		spinSink++
+	}
+}
+
+var spinSink int
+
+func nanotime() int64 { return time.Now().UnixNano() }
+
+func since(start int64) time.Duration {
+	return time.Duration(nanotime() - start).Round(time.Microsecond)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// 这里用普通的go代码模拟runtime/sema.go中的信号量,
+// sync.Mutex通过 runtime_SemacquireMutex / runtime_Semrelease 使用它.
+//
+// runtime的实现把等待者(sudog)按信号量地址挂在一棵平衡树上, 树的根
+// 由251个semaRoot按地址hash分摊. 这里只保留一个root和一个按地址索引
+// 的等待队列, 保护队列的是一个自旋锁(runtime自己用的是futex实现的mutex,
+// 这里不能用sync.Mutex, 否则就成了用Mutex实现Mutex).
+
+type semaWaiter struct {
+	ready chan struct{} // 被唤醒时写入, 相当于goready
+	// ticket为1表示释放方直接把信号量交给了这个等待者(handoff),
+	// 醒来后不用再和别人抢
+	ticket uint32
+}
+
+type semaRoot struct {
+	lock   int32  // 自旋锁
+	nwait  uint32 // 等待者数量, 释放方无锁读取它来判断是否需要唤醒
+	queues map[*uint32][]*semaWaiter
+}
+
+var semtable = semaRoot{queues: make(map[*uint32][]*semaWaiter)}
+
+func (r *semaRoot) lockRoot() {
+	for !atomic.CompareAndSwapInt32(&r.lock, 0, 1) {
+		runtime.Gosched()
+	}
+}
+
+func (r *semaRoot) unlockRoot() {
+	atomic.StoreInt32(&r.lock, 0)
+}
+
+// cansemacquire 在*addr > 0时把它减一并返回true
+func cansemacquire(addr *uint32) bool {
+	for {
+		v := atomic.LoadUint32(addr)
+		if v == 0 {
+			return false
+		}
+		if atomic.CompareAndSwapUint32(addr, v, v-1) {
+			return true
+		}
+	}
+}
+
+// semacquireMutex 对应 runtime_SemacquireMutex(addr, lifo, skip).
+// lifo为true时排到队头: Mutex中已经等待过一次的goroutine再次等待时
+// 用这种方式插队, 避免它被新来的等待者排到后面
+func semacquireMutex(addr *uint32, lifo bool) {
+	// 快速路径: 信号量有余量, 直接拿走
+	if cansemacquire(addr) {
+		return
+	}
+	r := &semtable
+	w := &semaWaiter{ready: make(chan struct{}, 1)}
+	for {
+		r.lockRoot()
+		// 先登记nwait再检查一次, 释放方先加信号量再读nwait,
+		// 这样不会出现 "释放方看不到等待者, 等待者也看不到信号量" 的情况
+		atomic.AddUint32(&r.nwait, 1)
+		if cansemacquire(addr) {
+			atomic.AddUint32(&r.nwait, ^uint32(0))
+			r.unlockRoot()
+			return
+		}
+		q := r.queues[addr]
+		if lifo {
+			q = append([]*semaWaiter{w}, q...)
+		} else {
+			q = append(q, w)
+		}
+		r.queues[addr] = q
+		r.unlockRoot()
+
+		// 相当于goparkunlock, 挂起等待被唤醒
+		<-w.ready
+		if atomic.LoadUint32(&w.ticket) != 0 || cansemacquire(addr) {
+			return
+		}
+		// 被唤醒了但信号量被别人抢走了, 重新排队
+	}
+}
+
+// semrelease 对应 runtime_Semrelease(addr, handoff, skip).
+// handoff为true时直接把信号量交给被唤醒的等待者, 并让出当前P,
+// 让等待者尽快运行; Mutex的饥饿模式就是靠它实现的
+func semrelease(addr *uint32, handoff bool) {
+	r := &semtable
+	atomic.AddUint32(addr, 1)
+	// 没有等待者就不用加锁了
+	if atomic.LoadUint32(&r.nwait) == 0 {
+		return
+	}
+	r.lockRoot()
+	if atomic.LoadUint32(&r.nwait) == 0 {
+		r.unlockRoot()
+		return
+	}
+	var w *semaWaiter
+	if q := r.queues[addr]; len(q) > 0 {
+		w = q[0]
+		if len(q) == 1 {
+			delete(r.queues, addr)
+		} else {
+			r.queues[addr] = q[1:]
+		}
+		atomic.AddUint32(&r.nwait, ^uint32(0))
+	}
+	r.unlockRoot()
+	if w == nil {
+		return
+	}
+	if handoff && cansemacquire(addr) {
+		atomic.StoreUint32(&w.ticket, 1)
+	}
+	w.ready <- struct{}{} // 相当于readyWithTime
+	if handoff {
+		// 相当于goyield: 让出CPU, 让拿到信号量的等待者马上运行
+		runtime.Gosched()
+	}
+}
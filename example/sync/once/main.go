@@ -0,0 +1,66 @@
+// 演示Once的保证: Do返回时f已经执行完, 并且f中的写入对所有调用者可见.
+//
+// 两个goroutine同时用Once初始化一份配置, 初始化需要一段时间.
+// 只用CAS的casOnce中, 没抢到CAS的goroutine会立即返回, 读到没有初始化完的配置;
+// Once中它会在Mutex上等待, 返回时一定能看到完整的配置.
+//
+// 运行: go run *.go
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type config struct {
+	addr    string
+	timeout time.Duration
+}
+
+type doer interface {
+	Do(f func())
+}
+
+func run(once doer) []string {
+	var cfg *config
+	load := func() {
+		// 模拟一个耗时的初始化
+		time.Sleep(10 * time.Millisecond)
+		cfg = &config{addr: "localhost:8080", timeout: time.Second}
+	}
+
+	var mu sync.Mutex
+	var seen []string
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			once.Do(load)
+			// Do返回后读取cfg. 对于Once这是安全的; 对于casOnce,
+			// 这里和load中的写入之间没有happens-before关系, 是数据竞争
+			// (用 go run -race *.go 可以看到)
+			mu.Lock()
+			defer mu.Unlock()
+			if c := cfg; c == nil {
+				seen = append(seen, fmt.Sprintf("goroutine %d: config not initialized", i))
+			} else {
+				seen = append(seen, fmt.Sprintf("goroutine %d: addr=%s timeout=%v", i, c.addr, c.timeout))
+			}
+		}(i)
+	}
+	wg.Wait()
+	return seen
+}
+
+func main() {
+	fmt.Println("casOnce (CAS only):")
+	for _, s := range run(new(casOnce)) {
+		fmt.Println("  " + s)
+	}
+	fmt.Println("Once (atomic load + mutex):")
+	for _, s := range run(new(Once)) {
+		fmt.Println("  " + s)
+	}
+}
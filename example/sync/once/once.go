@@ -0,0 +1,84 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Once 是对 go/src/sync/once.go 的逐行重写.
+// 慢路径用到的Mutex直接使用sync.Mutex, 它的实现见 example/sync/mutex.
+type Once struct {
+	// done indicates whether the action has been performed.
+	// It is first in the struct because it is used in the hot path.
+	// The hot path is inlined at every call site.
+	// Placing done first allows more compact instructions on some architectures (amd64/x86),
+	// and fewer instructions (to calculate offset) on other architectures.
+	//
+	// done放在第一个字段: Do的快速路径会被内联到每个调用处,
+	// 偏移量为0时访问它的指令最短
+	done uint32
+	m    sync.Mutex
+}
+
+// Do calls the function f if and only if Do is being called for the
+// first time for this instance of Once. In other words, given
+//
+//	var once Once
+//
+// if once.Do(f) is called multiple times, only the first call will invoke f,
+// even if f has a different value in each invocation. A new instance of
+// Once is required for each function to execute.
+//
+// If f panics, Do considers it to have returned; future calls of Do return
+// without calling f.
+func (o *Once) Do(f func()) {
+	// Note: Here is an incorrect implementation of Do:
+	//
+	//	if atomic.CompareAndSwapUint32(&o.done, 0, 1) {
+	//		f()
+	//	}
+	//
+	// Do guarantees that when it returns, f has finished.
+	// This implementation would not implement that guarantee:
+	// given two simultaneous calls, the winner of the cas would
+	// call f, and the second would return immediately, without
+	// waiting for the first's call to f to complete.
+	// This is why the slow path falls back to a mutex, and why
+	// the atomic.StoreUint32 must be delayed until after f returns.
+	//
+	// 只用CAS的实现(见casOnce)不能保证 "Do返回时f已经执行完":
+	// CAS失败的调用者会立即返回, 而此时f可能还在执行, 它读到的是没有初始化完的数据.
+	// 所以慢路径要用Mutex让其他调用者等待f执行完, done也必须在f返回之后才设置.
+
+	// 快速路径: 只有一次原子读. done为1说明f已经执行完,
+	// 而且f中的写入对看到done为1的goroutine都是可见的
+	if atomic.LoadUint32(&o.done) == 0 {
+		// Outlined slow-path to allow inlining of the fast-path.
+		o.doSlow(f)
+	}
+}
+
+func (o *Once) doSlow(f func()) {
+	o.m.Lock()
+	defer o.m.Unlock()
+	// 持有锁后再检查一次: 等锁的过程中f可能已经被别人执行完了.
+	// 这里在锁内, done只会在锁内被写, 所以普通读取就够了
+	if o.done == 0 {
+		// defer保证f panic时done也会被设置, 之后的Do不会再调用f.
+		// 原子写和快速路径的原子读配对: 看到done为1的goroutine,
+		// 一定也能看到f中的所有写入
+		defer atomic.StoreUint32(&o.done, 1)
+		f()
+	}
+}
+
+// casOnce 是只用CAS实现的错误版本, 用来和Once对比
+type casOnce struct {
+	done uint32
+}
+
+func (o *casOnce) Do(f func()) {
+	if atomic.CompareAndSwapUint32(&o.done, 0, 1) {
+		f()
+	}
+}
@@ -0,0 +1,122 @@
+// 演示Pool的victim cache, 并用benchmark对比Pool和两种加锁的对象池:
+//
+//  1. Put之后经过一次GC, 对象还能从victim中取回; 经过两次GC才会被真正丢弃.
+//  2. 并行地Get/Put时, Pool的快速路径只访问当前P的private, 没有锁和CAS,
+//     吞吐随P的数量增长; 用Mutex保护的空闲链表和用channel实现的池,
+//     所有P都在争同一把锁, P越多越慢.
+//
+// 运行: go run *.go
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+type buffer struct {
+	b [256]byte
+}
+
+type pool interface {
+	Get() interface{}
+	Put(x interface{})
+}
+
+// mutexPool 是用Mutex保护的空闲链表
+type mutexPool struct {
+	mu   sync.Mutex
+	free []interface{}
+	New  func() interface{}
+}
+
+func (p *mutexPool) Get() interface{} {
+	p.mu.Lock()
+	if n := len(p.free); n > 0 {
+		x := p.free[n-1]
+		p.free = p.free[:n-1]
+		p.mu.Unlock()
+		return x
+	}
+	p.mu.Unlock()
+	return p.New()
+}
+
+func (p *mutexPool) Put(x interface{}) {
+	p.mu.Lock()
+	p.free = append(p.free, x)
+	p.mu.Unlock()
+}
+
+// chanPool 是用带缓冲channel实现的池, channel内部同样有一把锁
+type chanPool struct {
+	c   chan interface{}
+	New func() interface{}
+}
+
+func (p *chanPool) Get() interface{} {
+	select {
+	case x := <-p.c:
+		return x
+	default:
+		return p.New()
+	}
+}
+
+func (p *chanPool) Put(x interface{}) {
+	select {
+	case p.c <- x:
+	default:
+	}
+}
+
+func victim() {
+	var news int
+	p := &Pool{New: func() interface{} {
+		news++
+		return new(buffer)
+	}}
+	// 这一段没有其他goroutine使用p, 可以安全地调用gc
+	b := new(buffer)
+	p.Put(b)
+	gc()
+	fmt.Printf("after 1 GC:  Get returns the buffer put before GC: %v\n", p.Get() == b)
+	p.Put(b)
+	gc()
+	gc()
+	fmt.Printf("after 2 GCs: Get returns the buffer put before GC: %v (New called %d times)\n", p.Get() == b, news)
+}
+
+func bench(p pool) testing.BenchmarkResult {
+	return testing.Benchmark(func(b *testing.B) {
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				x := p.Get()
+				p.Put(x)
+			}
+		})
+	})
+}
+
+func main() {
+	victim()
+
+	newBuffer := func() interface{} { return new(buffer) }
+	fmt.Println("parallel Get+Put, ns/op:")
+	fmt.Printf("%-10s %10s %10s %10s\n", "GOMAXPROCS", "Pool", "mutexPool", "chanPool")
+	max := runtime.GOMAXPROCS(0)
+	for procs := 1; ; procs *= 2 {
+		if procs > max {
+			procs = max
+		}
+		runtime.GOMAXPROCS(procs)
+		fmt.Printf("%-10d %10d %10d %10d\n", procs,
+			bench(&Pool{New: newBuffer}).NsPerOp(),
+			bench(&mutexPool{New: newBuffer}).NsPerOp(),
+			bench(&chanPool{c: make(chan interface{}, 1024), New: newBuffer}).NsPerOp())
+		if procs == max {
+			break
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"runtime"
+	_ "unsafe" // for go:linkname
+)
+
+// Pool的快速路径依赖 "把goroutine绑定在当前P上": 绑定期间不会被抢占,
+// 也就不会有别的goroutine在同一个P上运行, 访问这个P的本地数据不需要加锁.
+// 这一点没法用普通的go代码模拟, 所以和sync一样直接链接runtime中的实现.
+// 包中的pin.s是一个空的汇编文件, 用来允许声明没有函数体的函数.
+
+// runtime_procPin 禁止抢占并返回当前P的id
+//
+//go:linkname runtime_procPin runtime.procPin
+func runtime_procPin() int
+
+// runtime_procUnpin 重新允许抢占
+//
+//go:linkname runtime_procUnpin runtime.procUnpin
+func runtime_procUnpin()
+
+// gc 模拟一次GC对Pool的影响.
+//
+// runtime在每次GC开始时, 在stop the world期间调用sync注册的poolCleanup,
+// 这时没有goroutine在运行, poolCleanup可以不加锁地修改所有Pool.
+// 这里没法stop the world, 调用者要保证调用gc时没有goroutine在使用Pool.
+// 调用runtime.GC只是为了让示例更接近真实情况: 清理之后对象才会被回收
+func gc() {
+	poolCleanup()
+	runtime.GC()
+}
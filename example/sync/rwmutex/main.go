@@ -0,0 +1,125 @@
+// 演示写者饥饿, 以及RWMutex如何避免它:
+//
+// 读者们轮流持有读锁, 任意时刻总有至少一个读者持有读锁.
+// 对于朴素的读者优先读写锁(naiveRWMutex), 只要还有读者, 写者就永远进不去;
+// RWMutex中写者到来后新的读者要排队, 写者只需等待已经持有读锁的读者离开.
+//
+// 运行: go run *.go
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+type rwLocker interface {
+	RLock()
+	RUnlock()
+	Lock()
+	Unlock()
+}
+
+// naiveRWMutex 是一个读者优先的读写锁: 第一个读者替所有读者拿走写锁,
+// 最后一个读者再释放它. 读者源源不断时写锁永远不会被释放
+type naiveRWMutex struct {
+	mu      sync.Mutex
+	readers int
+	w       chan struct{} // 容量为1, 作为可以被其他goroutine释放的写锁
+}
+
+func newNaiveRWMutex() *naiveRWMutex {
+	return &naiveRWMutex{w: make(chan struct{}, 1)}
+}
+
+func (rw *naiveRWMutex) RLock() {
+	rw.mu.Lock()
+	rw.readers++
+	if rw.readers == 1 {
+		rw.w <- struct{}{}
+	}
+	rw.mu.Unlock()
+}
+
+func (rw *naiveRWMutex) RUnlock() {
+	rw.mu.Lock()
+	rw.readers--
+	if rw.readers == 0 {
+		<-rw.w
+	}
+	rw.mu.Unlock()
+}
+
+func (rw *naiveRWMutex) Lock()   { rw.w <- struct{}{} }
+func (rw *naiveRWMutex) Unlock() { <-rw.w }
+
+// run 让readers个读者交替持有读锁, 然后让一个写者去抢写锁,
+// 返回写者等待的时间; 超过limit还没拿到锁返回false
+func run(rw rwLocker, readers int, hold, limit time.Duration) (time.Duration, bool) {
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < readers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// 错开每个读者的起始时间, 保证读锁的持有时间互相重叠
+			time.Sleep(time.Duration(i) * hold / time.Duration(readers))
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				rw.RLock()
+				time.Sleep(hold)
+				rw.RUnlock()
+			}
+		}(i)
+	}
+
+	time.Sleep(2 * hold)
+	acquired := make(chan time.Duration, 1)
+	go func() {
+		start := time.Now()
+		rw.Lock()
+		acquired <- time.Since(start)
+		rw.Unlock()
+	}()
+
+	var wait time.Duration
+	ok := true
+	select {
+	case wait = <-acquired:
+	case <-time.After(limit):
+		ok = false
+	}
+	close(stop)
+	wg.Wait()
+	if !ok {
+		// 读者都停下后写者才能拿到锁
+		<-acquired
+	}
+	return wait, ok
+}
+
+func main() {
+	const (
+		readers = 4
+		hold    = time.Millisecond
+		limit   = 200 * time.Millisecond
+	)
+	for _, c := range []struct {
+		name string
+		rw   rwLocker
+	}{
+		{"naive reader-preferring lock", newNaiveRWMutex()},
+		{"RWMutex", new(RWMutex)},
+	} {
+		wait, ok := run(c.rw, readers, hold, limit)
+		if ok {
+			fmt.Printf("%-30s writer acquired the lock after %v\n", c.name+":", wait.Round(10*time.Microsecond))
+		} else {
+			fmt.Printf("%-30s writer still waiting after %v: starved\n", c.name+":", limit)
+		}
+	}
+}
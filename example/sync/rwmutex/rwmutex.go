@@ -0,0 +1,109 @@
+package main
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// RWMutex 是对 go/src/sync/rwmutex.go 的逐行重写, 信号量换成了sema.go中的模拟实现.
+// 写者之间的互斥直接使用sync.Mutex, 它的实现见 example/sync/mutex.
+//
+// 整个设计的核心是readerCount: 只有它是读者的快速路径会访问的字段.
+// 写者到来时把readerCount减去rwmutexMaxReaders使其变为负数, 之后:
+//   - 新来的读者看到负数, 知道有写者在等待或持有锁, 去readerSem上排队
+//   - 已经持有读锁的读者(readerCount减之前的值r)要全部退出, 写者才能进入,
+//     写者把r加到readerWait上, 每个退出的读者把readerWait减一, 减到0的那个唤醒写者
+//
+// 这样写者一旦到来, 新的读者就不能再进入, 写者最多等待它到来时已经持有读锁
+// 的那些读者, 不会被源源不断的读者饿死.
+type RWMutex struct {
+	w           sync.Mutex // held if there are pending writers
+	writerSem   uint32     // semaphore for writers to wait for completing readers
+	readerSem   uint32     // semaphore for readers to wait for completing writers
+	readerCount int32      // number of pending readers
+	readerWait  int32      // number of departing readers
+}
+
+// 读者数量的上限, 也是写者用来把readerCount变成负数的偏移量
+const rwmutexMaxReaders = 1 << 30
+
+// RLock locks rw for reading.
+//
+// It should not be used for recursive read locking; a blocked Lock
+// call excludes new readers from acquiring the lock. See the
+// documentation on the RWMutex type.
+func (rw *RWMutex) RLock() {
+	// readerCount加一后仍为负数, 说明有写者, 排队等写者Unlock唤醒
+	if atomic.AddInt32(&rw.readerCount, 1) < 0 {
+		// A writer is pending, wait for it.
+		semacquire(&rw.readerSem)
+	}
+}
+
+// RUnlock undoes a single RLock call;
+// it does not affect other simultaneous readers.
+// It is a run-time error if rw is not locked for reading
+// on entry to RUnlock.
+func (rw *RWMutex) RUnlock() {
+	// 减一后为负数, 说明有写者在等待, 走慢路径看自己是不是最后一个离开的读者
+	if r := atomic.AddInt32(&rw.readerCount, -1); r < 0 {
+		// Outlined slow-path to allow the fast-path to be inlined
+		rw.rUnlockSlow(r)
+	}
+}
+
+func (rw *RWMutex) rUnlockSlow(r int32) {
+	// r+1 == 0: 没有读锁却RUnlock
+	// r+1 == -rwmutexMaxReaders: 写者持有锁时RUnlock
+	if r+1 == 0 || r+1 == -rwmutexMaxReaders {
+		panic("sync: RUnlock of unlocked RWMutex")
+	}
+	// A writer is pending.
+	// 最后一个离开的读者唤醒写者
+	if atomic.AddInt32(&rw.readerWait, -1) == 0 {
+		// The last reader unblocks the writer.
+		semrelease(&rw.writerSem)
+	}
+}
+
+// Lock locks rw for writing.
+// If the lock is already locked for reading or writing,
+// Lock blocks until the lock is available.
+func (rw *RWMutex) Lock() {
+	// First, resolve competition with other writers.
+	// 先和其他写者竞争
+	rw.w.Lock()
+	// Announce to readers there is a pending writer.
+	// 把readerCount变成负数, 通知之后的读者有写者在等待.
+	// 加回rwmutexMaxReaders得到的r就是当前持有读锁的读者数
+	r := atomic.AddInt32(&rw.readerCount, -rwmutexMaxReaders) + rwmutexMaxReaders
+	// Wait for active readers.
+	// 把r加到readerWait上. 如果在这之前这些读者已经全部RUnlock了,
+	// 它们的减一会让readerWait先变成-r, 加上r正好为0, 写者不需要等待
+	if r != 0 && atomic.AddInt32(&rw.readerWait, r) != 0 {
+		semacquire(&rw.writerSem)
+	}
+}
+
+// Unlock unlocks rw for writing. It is a run-time error if rw is
+// not locked for writing on entry to Unlock.
+//
+// As with Mutexes, a locked RWMutex is not associated with a particular
+// goroutine. One goroutine may RLock (Lock) a RWMutex and then
+// arrange for another goroutine to RUnlock (Unlock) it.
+func (rw *RWMutex) Unlock() {
+	// Announce to readers there is no active writer.
+	// 恢复readerCount, 得到的r是写者持有锁期间到来并排队的读者数
+	r := atomic.AddInt32(&rw.readerCount, rwmutexMaxReaders)
+	if r >= rwmutexMaxReaders {
+		panic("sync: Unlock of unlocked RWMutex")
+	}
+	// Unblock blocked readers, if any.
+	// 唤醒所有排队的读者. 这些读者已经计入readerCount, 醒来后直接持有读锁
+	for i := 0; i < int(r); i++ {
+		semrelease(&rw.readerSem)
+	}
+	// Allow other writers to proceed.
+	// 最后才释放w: 先放读者进来, 避免写者之间连续抢锁把读者饿死
+	rw.w.Unlock()
+}
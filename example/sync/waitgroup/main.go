@@ -0,0 +1,55 @@
+// 演示WaitGroup的两种误用:
+//
+//  1. 在新goroutine里调用Add: Wait可能在Add之前执行, 看到计数器为0直接返回
+//  2. 上一轮Wait还没返回就Add复用WaitGroup: 被唤醒的Wait发现状态字不为0, panic
+//
+// 运行: go run *.go
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync/atomic"
+)
+
+func main() {
+	addInsideGoroutine()
+	reuseBeforeWaitReturns()
+}
+
+func addInsideGoroutine() {
+	var wg WaitGroup
+	var finished int32
+	for i := 0; i < 10; i++ {
+		go func() {
+			wg.Add(1) // 错误: Add应该在go语句之前调用
+			defer wg.Done()
+			atomic.AddInt32(&finished, 1)
+		}()
+	}
+	wg.Wait()
+	fmt.Printf("Add inside the goroutine: Wait returned after %d of 10 goroutines finished\n",
+		atomic.LoadInt32(&finished))
+}
+
+func reuseBeforeWaitReturns() {
+	runtime.GOMAXPROCS(1)
+	var wg WaitGroup
+	wg.Add(1)
+	result := make(chan interface{})
+	go func() {
+		defer func() { result <- recover() }()
+		wg.Wait()
+	}()
+	// 让等待者先登记到状态字上并阻塞
+	runtime.Gosched()
+
+	// Done把计数器减到0, 清零状态字并唤醒等待者; 等待者就绪但还没有运行.
+	// 紧接着的Add开始了新的一轮, 此时上一轮的Wait还没有返回
+	wg.Done()
+	wg.Add(1)
+	if r := <-result; r != nil {
+		fmt.Println("Add before the previous Wait returned: Wait panicked:", r)
+	}
+	wg.Done()
+}
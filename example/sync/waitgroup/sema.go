@@ -0,0 +1,91 @@
+package main
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// 和 example/sync/mutex/sema.go 一样用普通go代码模拟runtime的信号量.
+// WaitGroup只用到FIFO排队, 不需要lifo和handoff, 所以这里去掉了这两个参数.
+
+type semaWaiter struct {
+	ready chan struct{}
+}
+
+type semaRoot struct {
+	lock   int32  // 自旋锁
+	nwait  uint32 // 等待者数量
+	queues map[*uint32][]*semaWaiter
+}
+
+var semtable = semaRoot{queues: make(map[*uint32][]*semaWaiter)}
+
+func (r *semaRoot) lockRoot() {
+	for !atomic.CompareAndSwapInt32(&r.lock, 0, 1) {
+		runtime.Gosched()
+	}
+}
+
+func (r *semaRoot) unlockRoot() {
+	atomic.StoreInt32(&r.lock, 0)
+}
+
+func cansemacquire(addr *uint32) bool {
+	for {
+		v := atomic.LoadUint32(addr)
+		if v == 0 {
+			return false
+		}
+		if atomic.CompareAndSwapUint32(addr, v, v-1) {
+			return true
+		}
+	}
+}
+
+// semacquire 对应 runtime_Semacquire(addr)
+func semacquire(addr *uint32) {
+	if cansemacquire(addr) {
+		return
+	}
+	r := &semtable
+	w := &semaWaiter{ready: make(chan struct{}, 1)}
+	for {
+		r.lockRoot()
+		atomic.AddUint32(&r.nwait, 1)
+		if cansemacquire(addr) {
+			atomic.AddUint32(&r.nwait, ^uint32(0))
+			r.unlockRoot()
+			return
+		}
+		r.queues[addr] = append(r.queues[addr], w)
+		r.unlockRoot()
+		<-w.ready
+		if cansemacquire(addr) {
+			return
+		}
+	}
+}
+
+// semrelease 对应 runtime_Semrelease(addr, false, skip)
+func semrelease(addr *uint32) {
+	r := &semtable
+	atomic.AddUint32(addr, 1)
+	if atomic.LoadUint32(&r.nwait) == 0 {
+		return
+	}
+	r.lockRoot()
+	var w *semaWaiter
+	if q := r.queues[addr]; len(q) > 0 {
+		w = q[0]
+		if len(q) == 1 {
+			delete(r.queues, addr)
+		} else {
+			r.queues[addr] = q[1:]
+		}
+		atomic.AddUint32(&r.nwait, ^uint32(0))
+	}
+	r.unlockRoot()
+	if w != nil {
+		w.ready <- struct{}{}
+	}
+}
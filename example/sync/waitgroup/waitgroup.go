@@ -0,0 +1,127 @@
+package main
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// WaitGroup 是对 go/src/sync/waitgroup.go 的逐行重写 (去掉了race detector相关的代码),
+// 信号量换成了sema.go中的模拟实现.
+//
+// 整个WaitGroup只有一个64位的状态字和一个32位的信号量:
+//   - 状态字高32位是计数器v: Add加, Done减
+//   - 状态字低32位是等待者数量w: 在计数器不为0时调用Wait的goroutine数
+//
+// 计数器和等待者数量放在同一个字里, 一次原子操作就能同时读到两者,
+// Add因此能判断 "计数器归零时有没有人在等", Wait也能在 "计数器不为0" 的前提下登记自己.
+type WaitGroup struct {
+	noCopy noCopy
+
+	// 64-bit value: high 32 bits are counter, low 32 bits are waiter count.
+	// 64-bit atomic operations require 64-bit alignment, but 32-bit
+	// compilers do not ensure it. So we allocate 12 bytes and then use
+	// the aligned 8 bytes in them as state, and the other 4 as storage
+	// for the sema.
+	//
+	// 32位平台上结构体只保证4字节对齐, 所以分配12字节:
+	// 如果state1的地址是8字节对齐的, 前8字节是状态字, 后4字节是信号量;
+	// 否则前4字节是信号量, 后8字节(此时一定8字节对齐)是状态字
+	state1 [3]uint32
+}
+
+// state returns pointers to the state and sema fields stored within wg.state1.
+func (wg *WaitGroup) state() (statep *uint64, semap *uint32) {
+	if uintptr(unsafe.Pointer(&wg.state1))%8 == 0 {
+		return (*uint64)(unsafe.Pointer(&wg.state1)), &wg.state1[2]
+	} else {
+		return (*uint64)(unsafe.Pointer(&wg.state1[1])), &wg.state1[0]
+	}
+}
+
+// Add adds delta, which may be negative, to the WaitGroup counter.
+// If the counter becomes zero, all goroutines blocked on Wait are released.
+// If the counter goes negative, Add panics.
+//
+// Note that calls with a positive delta that occur when the counter is zero
+// must happen before a Wait. Calls with a negative delta, or calls with a
+// positive delta that start when the counter is greater than zero, may happen
+// at any time.
+// Typically this means the calls to Add should execute before the statement
+// creating the goroutine or other event to be waited for.
+// If a WaitGroup is reused to wait for several independent sets of events,
+// new Add calls must happen after all previous Wait calls have returned.
+// See the WaitGroup example.
+func (wg *WaitGroup) Add(delta int) {
+	statep, semap := wg.state()
+	// delta加到高32位的计数器上
+	state := atomic.AddUint64(statep, uint64(delta)<<32)
+	v := int32(state >> 32)
+	w := uint32(state)
+	if v < 0 {
+		panic("sync: negative WaitGroup counter")
+	}
+	// 计数器从0变为delta, 而此时已经有等待者: 说明这次Add和Wait并发,
+	// 违反了 "计数器为0时的Add必须发生在Wait之前" 的规则
+	if w != 0 && delta > 0 && v == int32(delta) {
+		panic("sync: WaitGroup misuse: Add called concurrently with Wait")
+	}
+	// 计数器不为0, 或者没有等待者, 不需要唤醒任何人
+	if v > 0 || w == 0 {
+		return
+	}
+	// This goroutine has set counter to 0 when waiters > 0.
+	// Now there can't be concurrent mutations of state:
+	// - Adds must not happen concurrently with Wait,
+	// - Wait does not increment waiters if it sees counter == 0.
+	// Still do a cheap sanity check to detect WaitGroup misuse.
+	// 计数器归零且有等待者. 此时按规则不会再有并发的Add和Wait,
+	// 所以可以直接检查并重置状态字, 不需要CAS
+	if atomic.LoadUint64(statep) != state {
+		panic("sync: WaitGroup misuse: Add called concurrently with Wait")
+	}
+	// Reset waiters count to 0.
+	// 先把状态字清零再唤醒等待者, 等待者醒来后会检查状态字是否为0
+	atomic.StoreUint64(statep, 0)
+	for ; w != 0; w-- {
+		semrelease(semap)
+	}
+}
+
+// Done decrements the WaitGroup counter by one.
+func (wg *WaitGroup) Done() {
+	wg.Add(-1)
+}
+
+// Wait blocks until the WaitGroup counter is zero.
+func (wg *WaitGroup) Wait() {
+	statep, semap := wg.state()
+	for {
+		state := atomic.LoadUint64(statep)
+		v := int32(state >> 32)
+		if v == 0 {
+			// Counter is 0, no need to wait.
+			return
+		}
+		// Increment waiters count.
+		// 在计数器不为0的前提下把等待者加一; CAS失败说明状态变了, 重新看一次
+		if atomic.CompareAndSwapUint64(statep, state, state+1) {
+			semacquire(semap)
+			// 被唤醒时Add已经把状态字清零了. 不为0说明在唤醒和这里之间
+			// 有新的Add, 即上一轮Wait还没返回就复用了WaitGroup
+			if atomic.LoadUint64(statep) != 0 {
+				panic("sync: WaitGroup is reused before previous Wait has returned")
+			}
+			return
+		}
+	}
+}
+
+// noCopy may be embedded into structs which must not be copied
+// after the first use.
+//
+// go vet的copylocks检查会报告包含带Lock/Unlock方法的类型的值拷贝
+type noCopy struct{}
+
+// Lock is a no-op used by -copylocks checker from `go vet`.
+func (*noCopy) Lock()   {}
+func (*noCopy) Unlock() {}
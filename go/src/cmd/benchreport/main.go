@@ -0,0 +1,168 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Benchreport runs the workloads of elements/stress against every map and
+// cache of go-elements and prints a table comparing them.
+//
+// Usage:
+//	benchreport [flags]
+//
+// Each structure runs each workload once, for the same duration and with
+// the same goroutines, key space and seed. The table has one row per
+// workload and structure, with the throughput, the p99 latency over all
+// operations and the allocations per operation.
+//
+// The flags are:
+//	-format markdown|csv
+//		the format of the table (default markdown)
+//	-d duration
+//		how long each run lasts (default 1s)
+//	-g n
+//		the number of goroutines (default GOMAXPROCS)
+//	-keys n
+//		the size of the key space (default 4096)
+//	-targets list
+//		comma-separated structures to run (default all)
+//	-workloads list
+//		comma-separated workloads to run (default all)
+//
+// benchreport -list prints the structures and the workloads.
+package main
+
+import (
+	"elements/stress"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	format    = flag.String("format", "markdown", "table format: markdown or csv")
+	duration  = flag.Duration("d", time.Second, "duration of each run")
+	procs     = flag.Int("g", 0, "number of goroutines (0 means GOMAXPROCS)")
+	keys      = flag.Int("keys", 4096, "size of the key space")
+	targetArg = flag.String("targets", "", "comma-separated structures to run (default all)")
+	workArg   = flag.String("workloads", "", "comma-separated workloads to run (default all)")
+	listFlag  = flag.Bool("list", false, "list the structures and the workloads")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: benchreport [flags]\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("benchreport: ")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() != 0 {
+		usage()
+	}
+	if *listFlag {
+		list(os.Stdout)
+		return
+	}
+
+	ts, err := selectTargets(*targetArg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ws, err := selectWorkloads(*workArg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	write, err := writer(*format)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg := stress.Config{Keys: *keys, Goroutines: *procs, Duration: *duration, Prefill: true}
+	rows, err := run(cfg, ts, ws, os.Stderr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	write(os.Stdout, rows)
+}
+
+func list(w io.Writer) {
+	fmt.Fprintf(w, "structures:\n")
+	for _, t := range targets {
+		fmt.Fprintf(w, "  %-16s %s\n", t.name, t.doc)
+	}
+	fmt.Fprintf(w, "workloads:\n")
+	for _, wl := range workloads {
+		fmt.Fprintf(w, "  %-16s %d%% load, %d%% store, %d%% delete\n", wl.name, wl.reads, wl.writes, wl.deletes)
+	}
+}
+
+// selectTargets returns the targets named in the comma-separated arg,
+// or all of them if arg is empty.
+func selectTargets(arg string) ([]*target, error) {
+	if arg == "" {
+		ts := make([]*target, len(targets))
+		for i := range targets {
+			ts[i] = &targets[i]
+		}
+		return ts, nil
+	}
+	var ts []*target
+	for _, name := range strings.Split(arg, ",") {
+		t := lookupTarget(name)
+		if t == nil {
+			return nil, fmt.Errorf("unknown structure %q; see benchreport -list", name)
+		}
+		ts = append(ts, t)
+	}
+	return ts, nil
+}
+
+// selectWorkloads is selectTargets for workloads.
+func selectWorkloads(arg string) ([]*workload, error) {
+	if arg == "" {
+		ws := make([]*workload, len(workloads))
+		for i := range workloads {
+			ws[i] = &workloads[i]
+		}
+		return ws, nil
+	}
+	var ws []*workload
+	for _, name := range strings.Split(arg, ",") {
+		w := lookupWorkload(name)
+		if w == nil {
+			return nil, fmt.Errorf("unknown workload %q; see benchreport -list", name)
+		}
+		ws = append(ws, w)
+	}
+	return ws, nil
+}
+
+// run runs every workload against every target, printing progress to
+// progress, and returns a row for each run.
+func run(cfg stress.Config, ts []*target, ws []*workload, progress io.Writer) ([]row, error) {
+	var rows []row
+	for _, w := range ws {
+		for _, t := range ts {
+			c := cfg
+			c.Reads, c.Writes, c.Deletes = w.reads, w.writes, w.deletes
+			fmt.Fprintf(progress, "%s/%s\n", w.name, t.name)
+			// 每次都是新的结构: 上一个workload的Delete留下的空洞,
+			// 提升过的read表都不能带到下一次
+			m, done := t.new(c.Keys)
+			r, err := stress.Run(m, c)
+			if done != nil {
+				done()
+			}
+			if err != nil {
+				return nil, err
+			}
+			rows = append(rows, row{workload: w.name, target: t.name, r: r})
+		}
+	}
+	return rows, nil
+}
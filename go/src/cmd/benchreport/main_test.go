@@ -0,0 +1,84 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"elements/stress"
+	"encoding/csv"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunAll(t *testing.T) {
+	ts, _ := selectTargets("")
+	ws, _ := selectWorkloads("")
+	cfg := stress.Config{Keys: 64, Goroutines: 2, Duration: 5 * time.Millisecond, Prefill: true}
+	rows, err := run(cfg, ts, ws, ioutil.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != len(targets)*len(workloads) {
+		t.Fatalf("run returned %d rows, want %d", len(rows), len(targets)*len(workloads))
+	}
+	for _, r := range rows {
+		if r.r.Ops == 0 {
+			t.Errorf("%s/%s ran no operations", r.workload, r.target)
+		}
+		// Prefill: 读多的workload一开始就能命中, 适配器必须把key对上
+		if r.workload == "read-mostly" && r.r.Latency[stress.OpLoad].Hits == 0 {
+			t.Errorf("%s/%s: no Load hit a prefilled key", r.workload, r.target)
+		}
+	}
+
+	var md, cv bytes.Buffer
+	writeMarkdown(&md, rows)
+	if n := strings.Count(md.String(), "\n"); n != len(rows)+2 {
+		t.Errorf("markdown has %d lines, want %d:\n%s", n, len(rows)+2, md.String())
+	}
+	writeCSV(&cv, rows)
+	recs, err := csv.NewReader(&cv).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recs) != len(rows)+1 {
+		t.Errorf("csv has %d records, want %d", len(recs), len(rows)+1)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	ts, err := selectTargets("ShardedMap,Map")
+	if err != nil || len(ts) != 2 || ts[0].name != "ShardedMap" || ts[1].name != "Map" {
+		t.Errorf("selectTargets(ShardedMap,Map) = %v, %v", ts, err)
+	}
+	if _, err := selectTargets("Map,nosuch"); err == nil {
+		t.Error("selectTargets accepted an unknown structure")
+	}
+	if _, err := selectWorkloads("nosuch"); err == nil {
+		t.Error("selectWorkloads accepted an unknown workload")
+	}
+	if _, err := writer("html"); err == nil {
+		t.Error("writer accepted an unknown format")
+	}
+}
+
+func TestMarkdownRelative(t *testing.T) {
+	rows := []row{
+		{"read-mostly", "A", &stress.Report{Throughput: 200}},
+		{"read-mostly", "B", &stress.Report{Throughput: 100}},
+		{"balanced", "A", &stress.Report{Throughput: 50}},
+		{"balanced", "B", &stress.Report{Throughput: 100}},
+	}
+	var buf bytes.Buffer
+	writeMarkdown(&buf, rows)
+	lines := strings.Split(buf.String(), "\n")
+	for i, want := range []string{"| 1.00x |", "| 0.50x |", "| 1.00x |", "| 2.00x |"} {
+		if !strings.Contains(lines[i+2], want) {
+			t.Errorf("row %d = %q, want it to contain %q", i, lines[i+2], want)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"elements/stress"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// A workload is a mix of operations.
+type workload struct {
+	name                   string
+	reads, writes, deletes int
+}
+
+var workloads = []workload{
+	{"read-mostly", 90, 9, 1},
+	{"balanced", 50, 45, 5},
+	{"write-heavy", 10, 80, 10},
+}
+
+func lookupWorkload(name string) *workload {
+	for i := range workloads {
+		if workloads[i].name == name {
+			return &workloads[i]
+		}
+	}
+	return nil
+}
+
+// A row is the result of one workload against one structure.
+type row struct {
+	workload string
+	target   string
+	r        *stress.Report
+}
+
+func writer(format string) (func(io.Writer, []row), error) {
+	switch format {
+	case "markdown", "md":
+		return writeMarkdown, nil
+	case "csv":
+		return writeCSV, nil
+	}
+	return nil, fmt.Errorf("unknown format %q", format)
+}
+
+// writeMarkdown writes rows as a markdown table. Within a workload, the
+// throughput of each structure is also given relative to the first one.
+func writeMarkdown(w io.Writer, rows []row) {
+	fmt.Fprintf(w, "| workload | structure | ops/s | relative | p99 | allocs/op |\n")
+	fmt.Fprintf(w, "| --- | --- | ---: | ---: | ---: | ---: |\n")
+	var base float64
+	for i, r := range rows {
+		if i == 0 || rows[i-1].workload != r.workload {
+			base = r.r.Throughput
+		}
+		rel := "-"
+		if base > 0 {
+			rel = fmt.Sprintf("%.2fx", r.r.Throughput/base)
+		}
+		fmt.Fprintf(w, "| %s | %s | %.0f | %s | %v | %.2f |\n",
+			r.workload, r.target, r.r.Throughput, rel, r.r.All.P99, r.r.AllocsPerOp)
+	}
+}
+
+// writeCSV writes rows as CSV with a header line. Latencies are in
+// nanoseconds, so that the file can be loaded as numbers.
+func writeCSV(w io.Writer, rows []row) {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"workload", "structure", "ops_per_sec", "p50_ns", "p99_ns", "allocs_per_op", "bytes_per_op"})
+	for _, r := range rows {
+		cw.Write([]string{
+			r.workload,
+			r.target,
+			strconv.FormatFloat(r.r.Throughput, 'f', 0, 64),
+			strconv.FormatInt(int64(r.r.All.P50/time.Nanosecond), 10),
+			strconv.FormatInt(int64(r.r.All.P99/time.Nanosecond), 10),
+			strconv.FormatFloat(r.r.AllocsPerOp, 'f', 2, 64),
+			strconv.FormatFloat(r.r.BytesPerOp, 'f', 1, 64),
+		})
+	}
+	cw.Flush()
+}
@@ -0,0 +1,126 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"elements/cache"
+	"elements/hamt"
+	"elements/stress"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A target is a structure benchreport can stress.
+type target struct {
+	name string
+	doc  string
+
+	// new returns an empty instance for a key space of size keys, and a
+	// function to release it, or nil if there is nothing to release.
+	new func(keys int) (stress.Target, func())
+}
+
+var targets = []target{
+	{"Map", "sync.Map", func(int) (stress.Target, func()) {
+		return new(sync.Map), nil
+	}},
+	{"Map/open", "sync.Map with OpenAddressingBackend", func(int) (stress.Target, func()) {
+		return sync.NewMap(sync.WithBackend(sync.OpenAddressingBackend)), nil
+	}},
+	{"Map/swiss", "sync.Map with SwissTableBackend", func(int) (stress.Target, func()) {
+		return sync.NewMap(sync.WithBackend(sync.SwissTableBackend)), nil
+	}},
+	{"HybridMap", "sync.HybridMap", func(int) (stress.Target, func()) {
+		return new(sync.HybridMap), nil
+	}},
+	{"ShardedMap", "sync.ShardedMap", func(int) (stress.Target, func()) {
+		return new(sync.ShardedMap), nil
+	}},
+	{"hamt", "hamt.Current, copy-on-write", func(int) (stress.Target, func()) {
+		return new(hamtTarget), nil
+	}},
+	{"Cache", "cache.Cache without TTL, Store is Set", func(keys int) (stress.Target, func()) {
+		c := cache.New(cache.Config{Load: func(string) (interface{}, error) { return nil, nil }})
+		return &cacheTarget{c: c, names: names(keys)}, nil
+	}},
+	{"SessionMap", "cache.SessionMap with a 1m IdleTimeout", func(keys int) (stress.Target, func()) {
+		s := cache.NewSessionMap(cache.SessionConfig{IdleTimeout: time.Minute})
+		return &sessionTarget{s: s, names: names(keys)}, s.Close
+	}},
+}
+
+func lookupTarget(name string) *target {
+	for i := range targets {
+		if targets[i].name == name {
+			return &targets[i]
+		}
+	}
+	return nil
+}
+
+// names returns the string keys of the structures keyed by string:
+// names[i] stands for stress's key i. They are made before the run, so
+// that converting the key allocates nothing and the allocations reported
+// are the structure's.
+func names(keys int) []string {
+	s := make([]string, keys)
+	for i := range s {
+		s[i] = strconv.Itoa(i)
+	}
+	return s
+}
+
+type hamtTarget struct {
+	c hamt.Current
+}
+
+func (t *hamtTarget) Load(key interface{}) (interface{}, bool) {
+	return t.c.Load().Load(key)
+}
+
+func (t *hamtTarget) Store(key, value interface{}) {
+	t.c.Update(func(m *hamt.Map) *hamt.Map { return m.Store(key, value) })
+}
+
+func (t *hamtTarget) Delete(key interface{}) {
+	t.c.Update(func(m *hamt.Map) *hamt.Map { return m.Delete(key) })
+}
+
+// cacheTarget.Load uses Peek: the workload's misses are misses, not
+// loads.
+type cacheTarget struct {
+	c     *cache.Cache
+	names []string
+}
+
+func (t *cacheTarget) Load(key interface{}) (interface{}, bool) {
+	return t.c.Peek(t.names[key.(int)])
+}
+
+func (t *cacheTarget) Store(key, value interface{}) {
+	t.c.Set(t.names[key.(int)], value)
+}
+
+func (t *cacheTarget) Delete(key interface{}) {
+	t.c.Delete(t.names[key.(int)])
+}
+
+type sessionTarget struct {
+	s     *cache.SessionMap
+	names []string
+}
+
+func (t *sessionTarget) Load(key interface{}) (interface{}, bool) {
+	return t.s.Load(t.names[key.(int)])
+}
+
+func (t *sessionTarget) Store(key, value interface{}) {
+	t.s.Store(t.names[key.(int)], value)
+}
+
+func (t *sessionTarget) Delete(key interface{}) {
+	t.s.Delete(t.names[key.(int)])
+}
@@ -0,0 +1,70 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// A config holds the flags shared by all examples.
+type config struct {
+	goroutines int  // -g
+	ops        int  // -n
+	procs      int  // -p
+	verbose    bool // -v
+	w          io.Writer
+}
+
+func (c *config) check() error {
+	switch {
+	case c.goroutines < 1:
+		return errors.New("-g must be at least 1")
+	case c.ops < 1:
+		return errors.New("-n must be at least 1")
+	case c.procs < 1:
+		return errors.New("-p must be at least 1")
+	}
+	return nil
+}
+
+func (c *config) printf(format string, args ...interface{}) {
+	fmt.Fprintf(c.w, format, args...)
+}
+
+// tracef is printf that only prints with -v.
+func (c *config) tracef(format string, args ...interface{}) {
+	if c.verbose {
+		fmt.Fprintf(c.w, "  "+format, args...)
+	}
+}
+
+// An example is one program of the lab.
+type example struct {
+	name string
+	doc  string
+	run  func(c *config) error
+}
+
+// examples is what list prints and run all runs, in that order.
+var examples = []example{
+	{"map", "sync.Map: the transitions of example/sync/map_exmaple.go with -v, and every backend under -g goroutines", runMap},
+	{"hmap", "the runtime map model: buckets and incremental growth while -n keys are inserted", runHmap},
+	{"mutex", "sync.Mutex: -g goroutines contend for one lock; the contention profile shows who waited", runMutex},
+	{"pool", "sync.Pool: the victim cache across GCs, and New calls under -g goroutines", runPool},
+	{"sched", "the GMP scheduler model: -g goroutines that compute and make system calls on -p Ps", runSched},
+	{"scenarios", "the GMP scheduler model: the built-in scenarios, one behavior of the scheduler each", runScenarios},
+	{"netpoll", "the netpoll model: -g goroutines park on pipes and the poller readies them", runNetpoll},
+}
+
+func lookup(name string) *example {
+	for i := range examples {
+		if examples[i].name == name {
+			return &examples[i]
+		}
+	}
+	return nil
+}
@@ -0,0 +1,36 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import "elements/mapmodel"
+
+// runHmap inserts -n keys into the runtime map model and prints each
+// growth: when it starts, and how many writes it took to evacuate the
+// old buckets. With -v every write during a growth is printed.
+func runHmap(c *config) error {
+	m := mapmodel.New(0, nil)
+	prev := m.Stats()
+	started := 0
+	for i := 0; i < c.ops; i++ {
+		m.Store(i, i)
+		st := m.Stats()
+		if st.B != prev.B {
+			started = i
+			c.printf("count %-6d B %d -> %d\n", st.Count, prev.B, st.B)
+		}
+		if st.Growing {
+			c.tracef("%+v\n", st)
+		}
+		// 旧桶只有一两个时, 增长在触发它的那次写入中就完成了
+		if (prev.Growing || st.B != prev.B) && !st.Growing {
+			c.printf("count %-6d evacuated %d old buckets in %d writes\n",
+				st.Count, 1<<uint(st.B-1), i-started+1)
+		}
+		prev = st
+	}
+	st := m.Stats()
+	c.printf("%d keys in %d buckets, %d overflow buckets\n", st.Count, 1<<uint(st.B), st.Overflow)
+	return nil
+}
@@ -0,0 +1,137 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Elements lists and runs the example programs of go-elements.
+//
+// Usage:
+//	elements [flags] list
+//	elements [flags] run name... | all
+//	elements step
+//
+// List prints the examples with a line about what each one shows.
+// Run runs the named examples in order. Each example drives one of the
+// packages under elements/ or the sync package of this tree, so the
+// programs in the example directory can be rerun with other parameters
+// without editing them.
+//
+// Step runs example/sync/map_exmaple.go, and one more Store, recording
+// the full state of the sync.Map after every transition and every call,
+// and steps back and forth through those snapshots with commands read
+// from the standard input: n and p move to the next and previous one,
+// and e key jumps to the snapshot where the entry of key was expunged.
+//
+// The flags are:
+//	-g n
+//		the number of goroutines (default 4)
+//	-n n
+//		the number of operations of each goroutine (default 1000)
+//	-p n
+//		the number of Ps of the scheduler model (default 4)
+//	-v
+//		trace the state of the data structure while the example runs
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+)
+
+var (
+	goroutines = flag.Int("g", 4, "number of goroutines")
+	ops        = flag.Int("n", 1000, "number of operations of each goroutine")
+	procs      = flag.Int("p", 4, "number of Ps of the scheduler model")
+	verbose    = flag.Bool("v", false, "trace the state of the data structure")
+)
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "usage: elements [flags] list\n")
+	fmt.Fprintf(os.Stderr, "       elements [flags] run name... | all\n")
+	fmt.Fprintf(os.Stderr, "       elements step\n")
+	flag.PrintDefaults()
+	os.Exit(2)
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("elements: ")
+	flag.Usage = usage
+	flag.Parse()
+	if flag.NArg() == 0 {
+		usage()
+	}
+
+	cfg := &config{
+		goroutines: *goroutines,
+		ops:        *ops,
+		procs:      *procs,
+		verbose:    *verbose,
+		w:          os.Stdout,
+	}
+	if err := cfg.check(); err != nil {
+		log.Fatal(err)
+	}
+
+	switch flag.Arg(0) {
+	case "list":
+		list(os.Stdout)
+	case "run":
+		if flag.NArg() == 1 {
+			usage()
+		}
+		if err := run(cfg, flag.Args()[1:]); err != nil {
+			log.Fatal(err)
+		}
+	case "step":
+		if err := step(cfg, os.Stdin); err != nil {
+			log.Fatal(err)
+		}
+	default:
+		usage()
+	}
+}
+
+// list prints the examples in the order run all runs them.
+func list(w io.Writer) {
+	width := 0
+	for _, ex := range examples {
+		if len(ex.name) > width {
+			width = len(ex.name)
+		}
+	}
+	for _, ex := range examples {
+		fmt.Fprintf(w, "%-*s  %s\n", width, ex.name, ex.doc)
+	}
+}
+
+// run runs the named examples, stopping at the first one that fails.
+// Names are checked before anything runs.
+func run(cfg *config, names []string) error {
+	var todo []*example
+	for _, name := range names {
+		if name == "all" {
+			for i := range examples {
+				todo = append(todo, &examples[i])
+			}
+			continue
+		}
+		ex := lookup(name)
+		if ex == nil {
+			return fmt.Errorf("unknown example %q; run 'elements list' to list them", name)
+		}
+		todo = append(todo, ex)
+	}
+	for i, ex := range todo {
+		if i > 0 {
+			fmt.Fprintln(cfg.w)
+		}
+		fmt.Fprintf(cfg.w, "== %s\n", ex.name)
+		if err := ex.run(cfg); err != nil {
+			return fmt.Errorf("%s: %v", ex.name, err)
+		}
+	}
+	return nil
+}
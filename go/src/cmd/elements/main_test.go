@@ -0,0 +1,76 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestList(t *testing.T) {
+	var buf bytes.Buffer
+	list(&buf)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(examples) {
+		t.Fatalf("list printed %d lines, want %d:\n%s", len(lines), len(examples), buf.String())
+	}
+	for i, ex := range examples {
+		if !strings.HasPrefix(lines[i], ex.name+" ") {
+			t.Errorf("line %d = %q, want it to start with %q", i, lines[i], ex.name)
+		}
+	}
+}
+
+func TestRunAll(t *testing.T) {
+	for _, verbose := range []bool{false, true} {
+		var buf bytes.Buffer
+		cfg := &config{goroutines: 3, ops: 50, procs: 2, verbose: verbose, w: &buf}
+		if err := run(cfg, []string{"all"}); err != nil {
+			t.Fatalf("verbose=%v: %v\n%s", verbose, err, buf.String())
+		}
+		for _, ex := range examples {
+			if !strings.Contains(buf.String(), "== "+ex.name+"\n") {
+				t.Errorf("verbose=%v: no output from %s", verbose, ex.name)
+			}
+		}
+	}
+}
+
+func TestRunUnknown(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := &config{goroutines: 1, ops: 1, procs: 1, w: &buf}
+	if err := run(cfg, []string{"map", "nosuch"}); err == nil {
+		t.Fatal("run of an unknown example succeeded")
+	}
+	if buf.Len() != 0 {
+		t.Errorf("examples ran before the unknown name was reported:\n%s", buf.String())
+	}
+}
+
+// TestStep jumps to the snapshot where k1 is expunged, and checks that
+// stepping back and forth around it goes through the snapshots in order.
+func TestStep(t *testing.T) {
+	var buf bytes.Buffer
+	cfg := &config{w: &buf}
+	if err := step(cfg, strings.NewReader("e k1\np\n\ng 0\np\nx\nq\nn\n")); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.String()
+	for _, want := range []string{
+		"Store k5: dirty-created key=k5\n    read:  k1(expunged) k2(expunged) k3(expunged) k4(expunged)\n    dirty: -\n",
+		"after Load k1\n    read:  k1(deleted) k2(deleted) k3(deleted) k4(deleted)\n    dirty: nil\n",
+		"[0/",
+		"no such snapshot\n",
+		`unknown command "x"`,
+	} {
+		if !strings.Contains(out, want) {
+			t.Errorf("output lacks %q:\n%s", want, out)
+		}
+	}
+	if strings.Count(out, "] ") != 5 {
+		t.Errorf("printed %d snapshots, want 5 (the first, e, p, the empty line and g 0):\n%s", strings.Count(out, "] "), out)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"elements/mapsim"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// mapWalkthrough is example/sync/map_exmaple.go, one Map call at a time.
+var mapWalkthrough = []struct {
+	what string
+	f    func(m *sync.Map)
+}{
+	{"Store k1", func(m *sync.Map) { m.Store("k1", "v1") }},
+	{"Load k1", func(m *sync.Map) { m.Load("k1") }},
+	{"Store k2", func(m *sync.Map) { m.Store("k2", "v2") }},
+	{"Load k2", func(m *sync.Map) { m.Load("k2") }},
+	{"Delete k1", func(m *sync.Map) { m.Delete("k1") }},
+	{"Store k3", func(m *sync.Map) { m.Store("k3", "v") }},
+	{"Load k3", func(m *sync.Map) { m.Load("k3") }},
+	{"Store k4", func(m *sync.Map) { m.Store("k4", "v") }},
+	{"Load k4", func(m *sync.Map) { m.Load("k4") }},
+	{"Load k4", func(m *sync.Map) { m.Load("k4") }},
+}
+
+// runMap replays example/sync/map_exmaple.go under mapsim, printing the
+// Map's transitions with -v, then runs -g goroutines of mixed loads and
+// stores against every backend.
+func runMap(c *config) error {
+	sim := mapsim.New(mapsim.Config{})
+	c.printf("walkthrough of example/sync/map_exmaple.go:\n")
+	for _, op := range mapWalkthrough {
+		c.tracef("%s\n", op.what)
+		for _, b := range sim.Run(op.f) {
+			c.tracef("    %v\n", b)
+		}
+	}
+	st := sim.Map().Stats()
+	c.printf("%d promotions after %d misses, policy %s\n", st.Promotions, st.Misses, st.Policy)
+
+	c.printf("\n%d goroutines x %d ops, 1 store in 10:\n", c.goroutines, c.ops)
+	c.printf("%-16s %10s %10s %8s %8s\n", "backend", "ns/op", "promotions", "misses", "writes")
+	for _, b := range []sync.MapBackend{sync.BuiltinBackend, sync.OpenAddressingBackend, sync.SwissTableBackend} {
+		m := sync.NewMap(sync.WithBackend(b))
+		elapsed := mixed(c, m)
+		st := m.Stats()
+		c.printf("%-16s %10.1f %10d %8d %8d\n", b, float64(elapsed.Nanoseconds())/float64(c.goroutines*c.ops),
+			st.Promotions, st.Misses, st.Writes)
+	}
+	return nil
+}
+
+// mixed runs c.goroutines goroutines of c.ops operations on m. Keys are
+// drawn from [0, c.ops), so early stores are new keys and later ones
+// mostly overwrite.
+func mixed(c *config, m *sync.Map) time.Duration {
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < c.goroutines; i++ {
+		wg.Add(1)
+		go func(seed int64) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(seed))
+			for j := 0; j < c.ops; j++ {
+				k := r.Intn(c.ops)
+				if r.Intn(10) == 0 {
+					m.Store(k, j)
+				} else {
+					m.Load(k)
+				}
+			}
+		}(int64(i))
+	}
+	wg.Wait()
+	return time.Since(start)
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"runtime"
+	"sync"
+	"time"
+)
+
+// runMutex has -g goroutines each lock one ProfiledMutex -n times,
+// holding it for a few microseconds and now and then yielding with it
+// held, and prints how many acquisitions had to wait and the longest
+// wait of each goroutine. Waits stop at about 1ms: a waiter that has
+// waited that long switches the Mutex to starvation mode and is handed
+// the lock, see example/sync/mutex.
+func runMutex(c *config) error {
+	profile := &sync.ContentionProfile{Rate: 1}
+	mu := &sync.ProfiledMutex{Name: "lab", Profile: profile}
+	maxWait := make([]time.Duration, c.goroutines)
+
+	var wg sync.WaitGroup
+	start := time.Now()
+	for i := 0; i < c.goroutines; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < c.ops; j++ {
+				t0 := time.Now()
+				mu.Lock()
+				if d := time.Since(t0); d > maxWait[id] {
+					maxWait[id] = d
+				}
+				busy(2 * time.Microsecond)
+				// 持有锁时偶尔让出P, 只有一个P时其他goroutine也能碰到被持有的锁
+				if j%10 == 9 {
+					runtime.Gosched()
+				}
+				mu.Unlock()
+			}
+		}(i)
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+
+	for id, d := range maxWait {
+		c.printf("G%-3d longest wait %v\n", id, d.Round(time.Microsecond))
+	}
+	for _, s := range profile.Report() {
+		c.printf("%d of %d acquisitions waited, %v in total, in %v\n",
+			s.Contended, s.Acquisitions, time.Duration(s.Wait).Round(time.Microsecond), elapsed.Round(time.Microsecond))
+		for i, n := range s.Buckets {
+			if n != 0 {
+				c.tracef("wait [%v, %v) %d\n", time.Duration(1<<uint(i)), time.Duration(2<<uint(i)), n)
+			}
+		}
+	}
+	return nil
+}
+
+// busy spins for d without giving up the CPU.
+func busy(d time.Duration) {
+	for start := time.Now(); time.Since(start) < d; {
+	}
+}
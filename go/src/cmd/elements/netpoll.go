@@ -0,0 +1,66 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"elements/netpoll"
+	"strconv"
+)
+
+// runNetpoll starts -g readers, each on its own pipe, and a writer that
+// writes to the pipes in reverse order, yielding after each write. Every
+// reader parks in the poller first; with -v the trace shows the order
+// in which netpoll readies them.
+func runNetpoll(c *config) error {
+	counts := make(map[netpoll.EventKind]int)
+	l, err := netpoll.NewLoop(netpoll.Config{Trace: func(e netpoll.Event) {
+		counts[e.Kind]++
+		c.tracef("%v\n", e)
+	}})
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	var rs, ws []*netpoll.Desc
+	defer func() {
+		for _, d := range append(rs, ws...) {
+			d.Close()
+		}
+	}()
+	for i := 0; i < c.goroutines; i++ {
+		r, w, err := l.Pipe()
+		if err != nil {
+			return err
+		}
+		rs = append(rs, r)
+		ws = append(ws, w)
+	}
+
+	for i, r := range rs {
+		i, r := i, r
+		l.Go(func() {
+			buf := make([]byte, 16)
+			n, err := r.Read(buf)
+			if err != nil {
+				l.Log("reader " + strconv.Itoa(i) + ": " + err.Error())
+				return
+			}
+			l.Log("reader " + strconv.Itoa(i) + " read " + string(buf[:n]))
+		})
+	}
+	l.Go(func() {
+		for i := len(ws) - 1; i >= 0; i-- {
+			ws[i].Write([]byte("msg" + strconv.Itoa(i)))
+			l.Gosched()
+		}
+	})
+	if err := l.Run(); err != nil {
+		return err
+	}
+	c.printf("%d readers: %d parks, %d polls, %d readies\n",
+		len(rs), counts[netpoll.EvPark], counts[netpoll.EvPoll], counts[netpoll.EvReady])
+	return nil
+}
@@ -0,0 +1,58 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+type buffer struct {
+	b [256]byte
+}
+
+// runPool shows, as example/sync/pool does, that a pooled object
+// survives one GC in the victim cache and is dropped by the second, then
+// counts the New calls of -g goroutines that each Get and Put -n times.
+func runPool(c *config) error {
+	var news int64
+	p := &sync.Pool{New: func() interface{} {
+		atomic.AddInt64(&news, 1)
+		return new(buffer)
+	}}
+
+	b := new(buffer)
+	for gcs := 0; gcs <= 2; gcs++ {
+		p.Put(b)
+		for i := 0; i < gcs; i++ {
+			runtime.GC()
+			c.tracef("GC %d\n", i+1)
+		}
+		c.printf("after %d GCs: Get returns the buffer put before them: %v\n", gcs, p.Get() == b)
+	}
+
+	atomic.StoreInt64(&news, 0)
+	var wg sync.WaitGroup
+	for i := 0; i < c.goroutines; i++ {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			for j := 0; j < c.ops; j++ {
+				x := p.Get()
+				// 让出P之后可能换到另一个P上运行, 取的是另一个P的private
+				if j%100 == 99 {
+					runtime.Gosched()
+				}
+				p.Put(x)
+			}
+		}(i)
+	}
+	wg.Wait()
+	n := atomic.LoadInt64(&news)
+	c.printf("%d goroutines x %d Gets: New called %d times, GOMAXPROCS %d\n",
+		c.goroutines, c.ops, n, runtime.GOMAXPROCS(0))
+	return nil
+}
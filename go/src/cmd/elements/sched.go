@@ -0,0 +1,57 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"elements/gmp"
+	"fmt"
+)
+
+// runSched simulates a main goroutine that starts -g goroutines on -p
+// Ps with preemption on. Every fourth goroutine makes a system call in
+// the middle of its work, so sysmon has Ps to hand off as well as Gs to
+// preempt.
+func runSched(c *config) error {
+	var main []gmp.Op
+	for i := 0; i < c.goroutines; i++ {
+		if i%4 == 3 {
+			main = append(main, gmp.Go(gmp.Run(10), gmp.Syscall(20), gmp.Run(10)))
+		} else {
+			main = append(main, gmp.Go(gmp.Run(30)))
+		}
+	}
+	r := gmp.Simulate(gmp.Config{Procs: c.procs, Preempt: true}, main)
+	c.printf("%d goroutines on %d Ps\n", c.goroutines, c.procs)
+	return report(c, r)
+}
+
+// runScenarios runs each of gmp.Scenarios.
+func runScenarios(c *config) error {
+	for i, sc := range gmp.Scenarios() {
+		if i > 0 {
+			c.printf("\n")
+		}
+		c.printf("%s: %s\n", sc.Name, sc.Doc)
+		if err := report(c, sc.Run()); err != nil {
+			return fmt.Errorf("%s: %v", sc.Name, err)
+		}
+	}
+	return nil
+}
+
+// report prints the timeline of r and a summary, and with -v every
+// scheduler event.
+func report(c *config, r *gmp.Result) error {
+	if !r.Finished {
+		return fmt.Errorf("not finished after %d ticks", r.Ticks)
+	}
+	for _, e := range r.Events {
+		c.tracef("%v\n", e)
+	}
+	c.printf("%s", r.Timeline(0))
+	c.printf("%d ticks, %d threads, %.0f%% busy, %d steals, %d preemptions, %d handoffs\n",
+		r.Ticks, r.Threads, 100*r.Busy(), r.Count(gmp.EvSteal), r.Count(gmp.EvPreempt), r.Count(gmp.EvHandoff))
+	return nil
+}
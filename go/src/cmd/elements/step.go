@@ -0,0 +1,139 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"elements/mapsim"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const stepHelp = `commands:
+  n, or an empty line   next snapshot
+  p                     previous snapshot
+  g i                   go to snapshot i
+  e key                 next snapshot where key is expunged
+  d key                 next snapshot where key is deleted
+  q                     quit
+`
+
+// stepScript is all of example/sync/map_exmaple.go, whose first half is
+// mapWalkthrough, and then one more Store: the file deletes every key but
+// never stores again, so without it no deleted entry would be expunged.
+var stepScript = append(mapWalkthrough[:len(mapWalkthrough):len(mapWalkthrough)], []struct {
+	what string
+	f    func(m *sync.Map)
+}{
+	{"Load k4", func(m *sync.Map) { m.Load("k4") }},
+	{"Delete k1", func(m *sync.Map) { m.Delete("k1") }},
+	{"Delete k2", func(m *sync.Map) { m.Delete("k2") }},
+	{"Delete k3", func(m *sync.Map) { m.Delete("k3") }},
+	{"Delete k4", func(m *sync.Map) { m.Delete("k4") }},
+	{"Load k1", func(m *sync.Map) { m.Load("k1") }},
+	{"Store k5", func(m *sync.Map) { m.Store("k5", "v") }},
+}...)
+
+// step records stepScript, then lets the user move back and forth
+// through the state of the Map after each transition and each Map call,
+// with the commands of stepHelp read from in. The Map promotes by the
+// rule of the standard library, which the comments of map_exmaple.go
+// follow.
+func step(c *config, in io.Reader) error {
+	sim := mapsim.New(mapsim.Config{
+		Record:  true,
+		Options: []sync.MapOption{sync.WithPromotionPolicy(sync.SizePromotion{})},
+	})
+	for _, op := range stepScript {
+		sim.Run(op.f)
+	}
+	// 操作是依次运行的, 断点处的快照属于它之后第一个结束的操作
+	h := sim.History()
+	ops := make([]string, len(h))
+	what := ""
+	for i := len(h) - 1; i >= 0; i-- {
+		if h[i].Op >= 0 {
+			what = stepScript[h[i].Op].what
+		}
+		ops[i] = what
+	}
+
+	tl := sim.Timeline()
+	c.printf("%d snapshots of example/sync/map_exmaple.go and a last Store k5\n%s", tl.Len(), stepHelp)
+	printSnapshot(c, tl, ops)
+
+	sc := bufio.NewScanner(in)
+	for sc.Scan() {
+		cmd, arg := sc.Text(), ""
+		if i := strings.IndexByte(cmd, ' '); i >= 0 {
+			cmd, arg = cmd[:i], strings.TrimSpace(cmd[i+1:])
+		}
+		ok := true
+		switch cmd {
+		case "", "n":
+			ok = tl.Forward()
+		case "p":
+			ok = tl.Back()
+		case "g":
+			i, err := strconv.Atoi(arg)
+			ok = err == nil && tl.Seek(i)
+		case "e":
+			ok = tl.SeekState(arg, sync.MapEntryExpunged)
+		case "d":
+			ok = tl.SeekState(arg, sync.MapEntryDeleted)
+		case "q":
+			return nil
+		default:
+			c.printf("unknown command %q\n%s", cmd, stepHelp)
+			continue
+		}
+		if !ok {
+			c.printf("no such snapshot\n")
+			continue
+		}
+		printSnapshot(c, tl, ops)
+	}
+	return sc.Err()
+}
+
+// printSnapshot prints the current snapshot of tl, named after the Map
+// call it belongs to, ops[tl.Pos()].
+func printSnapshot(c *config, tl *mapsim.Timeline, ops []string) {
+	s := tl.At()
+	what := "after " + ops[tl.Pos()]
+	if e := s.Event; e != nil {
+		what = fmt.Sprintf("%s: %v key=%v", ops[tl.Pos()], e.Transition, e.Key)
+	}
+	c.printf("[%d/%d] %s\n", tl.Pos(), tl.Len()-1, what)
+	c.printf("    read:  %s\n", formatEntries(s.State.Read))
+	dirty := "nil"
+	if s.State.Dirty != nil {
+		dirty = formatEntries(s.State.Dirty)
+	}
+	c.printf("    dirty: %s\n", dirty)
+	c.printf("    amended=%v misses=%d\n", s.State.Amended, s.State.Misses)
+}
+
+// formatEntries formats entries sorted by key, with the values of the
+// live ones and the state of the others.
+func formatEntries(es []sync.MapEntry) string {
+	if len(es) == 0 {
+		return "-"
+	}
+	s := make([]string, len(es))
+	for i, e := range es {
+		if e.State == sync.MapEntryLive {
+			s[i] = fmt.Sprintf("%v=%v", e.Key, e.Value)
+		} else {
+			s[i] = fmt.Sprintf("%v(%v)", e.Key, e.State)
+		}
+	}
+	sort.Strings(s)
+	return strings.Join(s, " ")
+}
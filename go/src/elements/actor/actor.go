@@ -0,0 +1,238 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package actor provides actors: state owned by a handler that processes
+// the messages sent to it one at a time, so that the state needs no lock.
+//
+//	counter := actor.Spawn(actor.Config{New: func() actor.Handler {
+//		n := 0
+//		return func(msg interface{}) (interface{}, error) {
+//			n += msg.(int)
+//			return n, nil
+//		}
+//	}})
+//	counter.Tell(1)
+//	v, err := counter.Ask(2).Get(ctx) // 3
+//
+// An idle actor holds no goroutine: sending to an empty mailbox starts
+// one, which processes the messages until the mailbox is empty again.
+package actor
+
+import (
+	"elements/future"
+	"errors"
+	"runtime"
+	"sync/atomic"
+)
+
+// A Handler processes one message, and returns the reply to an Ask of
+// it. The reply of a Tell is dropped.
+type Handler func(msg interface{}) (reply interface{}, err error)
+
+// A Directive is what a Supervise function decides for an actor whose
+// Handler panicked.
+type Directive int
+
+const (
+	// Resume keeps the Handler, and its state, and goes on with the next
+	// message.
+	Resume Directive = iota
+
+	// Restart replaces the Handler with a new one from Config.New, and
+	// goes on with the next message.
+	Restart
+
+	// Stop stops the actor, as Ref.Stop does, dropping the messages
+	// after the one that panicked.
+	Stop
+)
+
+// ErrStopped is returned by Tell, and by the Futures of Ask, for an actor
+// that has stopped.
+var ErrStopped = errors.New("actor: stopped")
+
+// A PanicError is the error of an Ask whose message made the Handler
+// panic.
+type PanicError struct {
+	Value interface{} // the value passed to panic
+}
+
+func (e *PanicError) Error() string {
+	if err, ok := e.Value.(error); ok {
+		return "actor: handler panicked: " + err.Error()
+	}
+	if s, ok := e.Value.(string); ok {
+		return "actor: handler panicked: " + s
+	}
+	return "actor: handler panicked"
+}
+
+// Config configures an actor.
+type Config struct {
+	// New returns the Handler of the actor, with fresh state. It is called
+	// once by Spawn, and again whenever Supervise decides to Restart. It
+	// must not be nil.
+	New func() Handler
+
+	// Supervise, if not nil, decides what happens when the Handler panics
+	// with the value p while processing msg. Nil means Restart.
+	Supervise func(p interface{}, msg interface{}) Directive
+
+	// OnStop, if not nil, is called once the actor has stopped and
+	// processed its last message.
+	OnStop func()
+}
+
+// A Ref is the address of an actor. It is safe for concurrent use.
+type Ref struct {
+	// n counts the messages in the mailbox, and the one being processed.
+	// The Tell that makes it 1 starts the goroutine of the actor, which
+	// runs until it brings n back to 0. First so it is 64-bit aligned;
+	// accessed atomically.
+	n       int64
+	stopped uint32 // set by Stop; accessed atomically
+	mb      mailbox
+
+	cfg     Config
+	handler Handler       // used only by the goroutine of the actor
+	done    chan struct{} // closed once the actor has stopped
+}
+
+// An envelope is a message in a mailbox.
+type envelope struct {
+	msg   interface{}
+	reply *future.Promise // nil for a Tell
+	stop  bool            // the message of Stop
+}
+
+// Spawn starts an actor configured by cfg and returns its Ref.
+func Spawn(cfg Config) *Ref {
+	if cfg.New == nil {
+		panic("actor: Spawn with nil New")
+	}
+	r := &Ref{cfg: cfg, handler: cfg.New(), done: make(chan struct{})}
+	r.mb.init()
+	return r
+}
+
+// Tell sends msg to the actor without waiting for it to be processed. It
+// returns ErrStopped if the actor has stopped.
+func (r *Ref) Tell(msg interface{}) error {
+	return r.send(envelope{msg: msg})
+}
+
+// Ask sends msg to the actor and returns a Future of the reply. The
+// Future fails with ErrStopped if the actor stops before processing msg,
+// and with a *PanicError if the Handler panics.
+func (r *Ref) Ask(msg interface{}) *future.Future {
+	p := future.NewPromise()
+	if err := r.send(envelope{msg: msg, reply: p}); err != nil {
+		p.Reject(err)
+	}
+	return p.Future()
+}
+
+// Stop stops the actor once it has processed the messages sent before.
+// Messages sent afterwards are rejected with ErrStopped. Stop does not
+// wait: Done is closed when the actor has stopped.
+func (r *Ref) Stop() {
+	if atomic.CompareAndSwapUint32(&r.stopped, 0, 1) {
+		r.enqueue(envelope{stop: true})
+	}
+}
+
+// Done returns a channel that is closed once the actor has stopped.
+func (r *Ref) Done() <-chan struct{} { return r.done }
+
+func (r *Ref) send(e envelope) error {
+	if atomic.LoadUint32(&r.stopped) != 0 {
+		return ErrStopped
+	}
+	// Stop可能在检查之后发生. 排在停止消息后面的消息由run拒绝, 不会丢失回复
+	r.enqueue(e)
+	return nil
+}
+
+func (r *Ref) enqueue(e envelope) {
+	r.mb.push(e)
+	if atomic.AddInt64(&r.n, 1) == 1 {
+		go r.run()
+	}
+}
+
+// run processes messages until the mailbox is empty. At most one run of
+// an actor is running at a time: the one started by the Tell that found
+// the mailbox empty.
+func (r *Ref) run() {
+	for {
+		e, ok := r.mb.pop()
+		if !ok {
+			// n说明有消息, 但生产者交换了head还没有链接next, 等它完成
+			runtime.Gosched()
+			continue
+		}
+		r.process(e)
+		if atomic.AddInt64(&r.n, -1) == 0 {
+			return
+		}
+	}
+}
+
+// process handles one message.
+func (r *Ref) process(e envelope) {
+	select {
+	case <-r.done:
+		// 已经停止: 之后的消息只拒绝
+		if e.reply != nil {
+			e.reply.Reject(ErrStopped)
+		}
+		return
+	default:
+	}
+	if e.stop {
+		close(r.done)
+		if r.cfg.OnStop != nil {
+			r.cfg.OnStop()
+		}
+		return
+	}
+	v, err, p, panicked := r.call(e.msg)
+	if e.reply != nil {
+		if panicked {
+			err = &PanicError{Value: p}
+		}
+		e.reply.Complete(v, err)
+	}
+	if !panicked {
+		return
+	}
+	d := Restart
+	if r.cfg.Supervise != nil {
+		d = r.cfg.Supervise(p, e.msg)
+	}
+	switch d {
+	case Restart:
+		r.handler = r.cfg.New()
+	case Stop:
+		// 停止消息排在已有的消息后面, 这里直接停止, 之后的消息都被拒绝
+		atomic.StoreUint32(&r.stopped, 1)
+		close(r.done)
+		if r.cfg.OnStop != nil {
+			r.cfg.OnStop()
+		}
+	}
+}
+
+// call runs the Handler on msg, recovering a panic.
+func (r *Ref) call(msg interface{}) (v interface{}, err error, p interface{}, panicked bool) {
+	defer func() {
+		if panicked {
+			p = recover()
+		}
+	}()
+	panicked = true
+	v, err = r.handler(msg)
+	panicked = false
+	return
+}
@@ -0,0 +1,174 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package actor_test
+
+import (
+	"context"
+	"elements/actor"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// counter returns a Config of an actor that adds the int messages it is
+// sent and replies with the sum, and panics on the message "panic".
+func counter() actor.Config {
+	return actor.Config{New: func() actor.Handler {
+		n := 0
+		return func(msg interface{}) (interface{}, error) {
+			if msg == "panic" {
+				panic("boom")
+			}
+			n += msg.(int)
+			return n, nil
+		}
+	}}
+}
+
+func ask(t *testing.T, r *actor.Ref, msg interface{}) (interface{}, error) {
+	t.Helper()
+	return r.Ask(msg).Get(context.Background())
+}
+
+// TestSequential sends from many goroutines at once: the Handler, which
+// has no lock, sees every message exactly once.
+func TestSequential(t *testing.T) {
+	const senders, each = 8, 1000
+	r := actor.Spawn(counter())
+	var wg sync.WaitGroup
+	for i := 0; i < senders; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < each; j++ {
+				if err := r.Tell(1); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if v, err := ask(t, r, 0); v != senders*each || err != nil {
+		t.Fatalf("Ask = %v, %v; want %d, nil", v, err, senders*each)
+	}
+}
+
+func TestOrder(t *testing.T) {
+	var got []interface{}
+	r := actor.Spawn(actor.Config{New: func() actor.Handler {
+		return func(msg interface{}) (interface{}, error) {
+			got = append(got, msg)
+			return nil, nil
+		}
+	}})
+	for i := 0; i < 100; i++ {
+		r.Tell(i)
+	}
+	r.Stop()
+	<-r.Done()
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("message %d is %v", i, v)
+		}
+	}
+	if len(got) != 100 {
+		t.Fatalf("got %d messages; want 100", len(got))
+	}
+}
+
+func TestAskError(t *testing.T) {
+	errBad := errors.New("bad")
+	r := actor.Spawn(actor.Config{New: func() actor.Handler {
+		return func(msg interface{}) (interface{}, error) { return nil, errBad }
+	}})
+	if _, err := ask(t, r, 1); err != errBad {
+		t.Fatalf("Ask = %v; want %v", err, errBad)
+	}
+}
+
+func TestStop(t *testing.T) {
+	stopped := make(chan struct{})
+	cfg := counter()
+	cfg.OnStop = func() { close(stopped) }
+	r := actor.Spawn(cfg)
+	before := r.Ask(1)
+	r.Stop()
+	r.Stop()
+	if v, err := before.Get(context.Background()); v != 1 || err != nil {
+		t.Fatalf("Ask before Stop = %v, %v; want 1, nil", v, err)
+	}
+	<-r.Done()
+	<-stopped
+	if err := r.Tell(1); err != actor.ErrStopped {
+		t.Fatalf("Tell after Stop = %v; want %v", err, actor.ErrStopped)
+	}
+	if _, err := ask(t, r, 1); err != actor.ErrStopped {
+		t.Fatalf("Ask after Stop = %v; want %v", err, actor.ErrStopped)
+	}
+}
+
+func TestSupervise(t *testing.T) {
+	for _, tt := range []struct {
+		d    actor.Directive
+		want interface{} // the reply to 1 after the panic, or nil for ErrStopped
+	}{
+		{actor.Resume, 3},
+		{actor.Restart, 1},
+		{actor.Stop, nil},
+	} {
+		var seen []interface{}
+		cfg := counter()
+		cfg.Supervise = func(p, msg interface{}) actor.Directive {
+			seen = append(seen, p, msg)
+			return tt.d
+		}
+		r := actor.Spawn(cfg)
+		r.Tell(2)
+		_, err := ask(t, r, "panic")
+		if pe, ok := err.(*actor.PanicError); !ok || pe.Value != "boom" {
+			t.Fatalf("%v: Ask of a panic = %v; want a *PanicError of boom", tt.d, err)
+		}
+		v, err := ask(t, r, 1)
+		if tt.want == nil {
+			if err != actor.ErrStopped {
+				t.Fatalf("%v: Ask after the panic = %v, %v; want %v", tt.d, v, err, actor.ErrStopped)
+			}
+			<-r.Done()
+		} else if v != tt.want || err != nil {
+			t.Fatalf("%v: Ask after the panic = %v, %v; want %v, nil", tt.d, v, err, tt.want)
+		}
+		if len(seen) != 2 || seen[0] != "boom" || seen[1] != "panic" {
+			t.Fatalf("%v: Supervise saw %v", tt.d, seen)
+		}
+	}
+}
+
+func TestDefaultRestart(t *testing.T) {
+	r := actor.Spawn(counter())
+	r.Tell(5)
+	r.Tell("panic")
+	if v, err := ask(t, r, 1); v != 1 || err != nil {
+		t.Fatalf("Ask after the panic = %v, %v; want 1, nil", v, err)
+	}
+}
+
+func BenchmarkTell(b *testing.B) {
+	r := actor.Spawn(counter())
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			r.Tell(1)
+		}
+	})
+	r.Ask(0).Get(context.Background())
+}
+
+func BenchmarkAsk(b *testing.B) {
+	r := actor.Spawn(counter())
+	ctx := context.Background()
+	for i := 0; i < b.N; i++ {
+		r.Ask(1).Get(ctx)
+	}
+}
@@ -0,0 +1,35 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package actor_test
+
+import (
+	"context"
+	"elements/actor"
+	"fmt"
+)
+
+func Example() {
+	account := actor.Spawn(actor.Config{New: func() actor.Handler {
+		balance := 0
+		return func(msg interface{}) (interface{}, error) {
+			if amount, ok := msg.(int); ok {
+				if balance+amount < 0 {
+					return balance, fmt.Errorf("insufficient funds for %d", amount)
+				}
+				balance += amount
+			}
+			return balance, nil
+		}
+	}})
+	account.Tell(100)
+	account.Tell(-30)
+	_, err := account.Ask(-100).Get(context.Background())
+	fmt.Println(err)
+	balance, _ := account.Ask("balance").Get(context.Background())
+	fmt.Println(balance)
+	// Output:
+	// insufficient funds for -100
+	// 70
+}
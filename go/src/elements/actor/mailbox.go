@@ -0,0 +1,52 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package actor
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A mailbox is an unbounded multi-producer single-consumer queue, after
+// Dmitry Vyukov's intrusive MPSC queue: push is one atomic swap and never
+// waits, and pop, called only by the goroutine of the actor, takes no
+// atomic read-modify-write at all.
+type mailbox struct {
+	head unsafe.Pointer // *node, the last node pushed; accessed atomically
+	tail *node          // the node before the next to pop; used by the consumer only
+	stub node
+}
+
+type node struct {
+	next unsafe.Pointer // *node; accessed atomically
+	e    envelope
+}
+
+func (m *mailbox) init() {
+	m.head = unsafe.Pointer(&m.stub)
+	m.tail = &m.stub
+}
+
+// push adds e to the mailbox. It is safe for concurrent use.
+func (m *mailbox) push(e envelope) {
+	n := &node{e: e}
+	prev := (*node)(atomic.SwapPointer(&m.head, unsafe.Pointer(n)))
+	// 交换和链接之间, 队列从tail到prev是断开的: pop此时看不到n及之后的节点
+	atomic.StorePointer(&prev.next, unsafe.Pointer(n))
+}
+
+// pop removes the oldest envelope. ok is false if the mailbox is empty, or
+// if the producer of the oldest envelope has not finished pushing it.
+func (m *mailbox) pop() (e envelope, ok bool) {
+	next := (*node)(atomic.LoadPointer(&m.tail.next))
+	if next == nil {
+		return envelope{}, false
+	}
+	// next成为新的tail, 它的内容已经取走, 清掉以免留住消息
+	e = next.e
+	next.e = envelope{}
+	m.tail = next
+	return e, true
+}
@@ -0,0 +1,37 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package atomicx provides typed wrappers around sync/atomic.
+//
+// Each type holds one value that is only ever accessed atomically, so a
+// plain read or write cannot slip in by mistake, and the zero value is
+// ready to use.
+//
+// Memory model. Go 1.14's memory model does not mention sync/atomic, but
+// the implementation, the race detector and the later specification
+// agree: atomic operations behave as if executed in a single total order
+// that every goroutine observes (they are sequentially consistent), and
+// if an atomic load observes the value written by an atomic store, the
+// store happens before the load. Everything a goroutine did before the
+// store is therefore visible to the goroutine after the load, exactly as
+// if a channel send and receive had taken place.
+//
+// Nothing more is promised. In particular an atomic variable orders
+// nothing for goroutines that do not read it, and reading a value
+// non-atomically that another goroutine stores atomically is a data race.
+package atomicx
+
+// noCopy may be embedded into structs which must not be copied
+// after the first use.
+//
+// See https://golang.org/issues/8005#issuecomment-190753527
+// for details.
+//
+// 复制一个原子变量得到的是某一时刻的值, 复制本身不是原子的, 之后两份也不再
+// 有任何关系. go vet的copylocks检查看到Lock方法就会报告复制
+type noCopy struct{}
+
+// Lock is a no-op used by -copylocks checker from `go vet`.
+func (*noCopy) Lock()   {}
+func (*noCopy) Unlock() {}
@@ -0,0 +1,64 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package atomicx_test
+
+import (
+	"elements/atomicx"
+	"fmt"
+	"sync"
+	"unsafe"
+)
+
+// A server's settings are rebuilt on every reload and published through a
+// Pointer; request handlers read them without locking.
+func ExamplePointer() {
+	type settings struct {
+		maxConns int
+		banner   string
+	}
+	var current atomicx.Pointer
+	current.Store(unsafe.Pointer(&settings{maxConns: 10, banner: "v1"}))
+
+	reload := func(maxConns int, banner string) {
+		// 新的对象在Store之前构造完, Store之后不再修改
+		s := &settings{maxConns: maxConns, banner: banner}
+		current.Store(unsafe.Pointer(s))
+	}
+	handle := func() string {
+		s := (*settings)(current.Load())
+		return fmt.Sprintf("%s max=%d", s.banner, s.maxConns)
+	}
+
+	fmt.Println(handle())
+	reload(20, "v2")
+	fmt.Println(handle())
+	// Output:
+	// v1 max=10
+	// v2 max=20
+}
+
+func ExampleInt64_CompareAndSwap() {
+	// 记录并发观察到的最大值: 读出当前值, 只在更大时CAS, 失败说明别人改过, 重试
+	var max atomicx.Int64
+	observe := func(v int64) {
+		for {
+			old := max.Load()
+			if v <= old || max.CompareAndSwap(old, v) {
+				return
+			}
+		}
+	}
+	var wg sync.WaitGroup
+	for _, v := range []int64{3, 41, 7, 12, 5} {
+		wg.Add(1)
+		go func(v int64) {
+			defer wg.Done()
+			observe(v)
+		}(v)
+	}
+	wg.Wait()
+	fmt.Println(max.Load())
+	// Output: 41
+}
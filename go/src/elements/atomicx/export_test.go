@@ -0,0 +1,13 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package atomicx
+
+// DisableCAS128 makes Uint128 use the sequence lock until restore is
+// called. Values must not be shared across the switch.
+func DisableCAS128() (restore func()) {
+	old := useCAS128
+	useCAS128 = false
+	return func() { useCAS128 = old }
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package atomicx
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// A Float64 is an atomic float64. The zero value is zero.
+//
+// A Float64 must not be copied after first use, and has the same
+// alignment requirement as Int64.
+//
+// sync/atomic没有浮点数的操作. 值按math.Float64bits存成uint64, Load和Store
+// 只是转换, Add是在位模式上的CAS循环
+type Float64 struct {
+	v uint64
+	_ noCopy
+}
+
+// Load atomically loads and returns the value stored in x.
+func (x *Float64) Load() float64 { return math.Float64frombits(atomic.LoadUint64(&x.v)) }
+
+// Store atomically stores val into x.
+func (x *Float64) Store(val float64) { atomic.StoreUint64(&x.v, math.Float64bits(val)) }
+
+// Add atomically adds delta to x and returns the new value.
+//
+// Add retries until no other goroutine modified x between its load and
+// its compare-and-swap, so under heavy contention it is much slower than
+// the Add of the integer types, and it is not wait-free.
+func (x *Float64) Add(delta float64) (new float64) {
+	for {
+		old := atomic.LoadUint64(&x.v)
+		new = math.Float64frombits(old) + delta
+		if atomic.CompareAndSwapUint64(&x.v, old, math.Float64bits(new)) {
+			return new
+		}
+	}
+}
+
+// Swap atomically stores new into x and returns the previous value.
+func (x *Float64) Swap(new float64) (old float64) {
+	return math.Float64frombits(atomic.SwapUint64(&x.v, math.Float64bits(new)))
+}
+
+// CompareAndSwap executes the compare-and-swap operation for x.
+//
+// It compares bit patterns, not values as == does: 0 and -0 are different,
+// and a NaN matches a NaN with the same bits.
+func (x *Float64) CompareAndSwap(old, new float64) (swapped bool) {
+	return atomic.CompareAndSwapUint64(&x.v, math.Float64bits(old), math.Float64bits(new))
+}
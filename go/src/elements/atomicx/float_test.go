@@ -0,0 +1,61 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package atomicx_test
+
+import (
+	"elements/atomicx"
+	"math"
+	"sync"
+	"testing"
+	"testing/quick"
+)
+
+func TestFloat64(t *testing.T) {
+	f := func(a, b, c float64) bool {
+		var x atomicx.Float64
+		x.Store(a)
+		if x.Add(b) != a+b || x.Load() != a+b {
+			return false
+		}
+		if x.Swap(c) != a+b || x.Load() != c {
+			return false
+		}
+		return x.CompareAndSwap(c, a) && !x.CompareAndSwap(c+1, b) && x.Load() == a
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFloat64Bits(t *testing.T) {
+	var x atomicx.Float64
+	if x.CompareAndSwap(math.Copysign(0, -1), 1) {
+		t.Error("CompareAndSwap(-0) matched +0")
+	}
+	nan := math.NaN()
+	x.Store(nan)
+	if !x.CompareAndSwap(nan, 1) || x.Load() != 1 {
+		t.Error("CompareAndSwap(NaN) did not match the same NaN")
+	}
+}
+
+func TestFloat64AddNeverLoses(t *testing.T) {
+	const goroutines, adds = 8, 10000
+	var x atomicx.Float64
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < adds; i++ {
+				x.Add(0.5) // 0.5的和在这个范围内是精确的
+			}
+		}()
+	}
+	wg.Wait()
+	if x.Load() != goroutines*adds/2 {
+		t.Errorf("sum = %v, want %v", x.Load(), goroutines*adds/2)
+	}
+}
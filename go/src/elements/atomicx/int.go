@@ -0,0 +1,112 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package atomicx
+
+import "sync/atomic"
+
+// An Int32 is an atomic int32. The zero value is zero.
+//
+// An Int32 must not be copied after first use.
+type Int32 struct {
+	_ noCopy
+	v int32
+}
+
+// Load atomically loads and returns the value stored in x.
+//
+// If Load observes the value of a Store, Add, Swap or successful
+// CompareAndSwap, that operation happens before the Load returns.
+func (x *Int32) Load() int32 { return atomic.LoadInt32(&x.v) }
+
+// Store atomically stores val into x.
+//
+// Writes made before Store are visible to any goroutine whose Load
+// observes val (or a later value).
+func (x *Int32) Store(val int32) { atomic.StoreInt32(&x.v, val) }
+
+// Add atomically adds delta to x and returns the new value.
+//
+// Add both loads and stores: it synchronizes with the operation whose
+// value it replaced and with the Load that later observes its result.
+// Concurrent Adds never lose an increment.
+func (x *Int32) Add(delta int32) (new int32) { return atomic.AddInt32(&x.v, delta) }
+
+// Swap atomically stores new into x and returns the previous value.
+func (x *Int32) Swap(new int32) (old int32) { return atomic.SwapInt32(&x.v, new) }
+
+// CompareAndSwap executes the compare-and-swap operation for x.
+//
+// A failed CompareAndSwap makes no write, but it is still an atomic load:
+// it observes some value in the total order of operations on x.
+func (x *Int32) CompareAndSwap(old, new int32) (swapped bool) {
+	return atomic.CompareAndSwapInt32(&x.v, old, new)
+}
+
+// An Int64 is an atomic int64. The zero value is zero.
+//
+// An Int64 must not be copied after first use. On 386 and 32-bit ARM
+// it must be 64-bit aligned: put it first in any struct that contains it,
+// or allocate it by itself (see the bugs section of sync/atomic).
+//
+// 32位平台上64位的原子操作要求地址8字节对齐, 而编译器只保证4字节.
+// 分配的内存块的第一个字是对齐的, 所以放在结构体的最前面
+type Int64 struct {
+	v int64
+	_ noCopy
+}
+
+// Load atomically loads and returns the value stored in x.
+//
+// If Load observes the value of a Store, Add, Swap or successful
+// CompareAndSwap, that operation happens before the Load returns.
+// A plain read of a 64-bit value can be torn on 32-bit platforms, mixing
+// halves of two stores; Load never is.
+func (x *Int64) Load() int64 { return atomic.LoadInt64(&x.v) }
+
+// Store atomically stores val into x.
+//
+// Writes made before Store are visible to any goroutine whose Load
+// observes val (or a later value).
+func (x *Int64) Store(val int64) { atomic.StoreInt64(&x.v, val) }
+
+// Add atomically adds delta to x and returns the new value.
+//
+// Concurrent Adds never lose an increment.
+func (x *Int64) Add(delta int64) (new int64) { return atomic.AddInt64(&x.v, delta) }
+
+// Swap atomically stores new into x and returns the previous value.
+func (x *Int64) Swap(new int64) (old int64) { return atomic.SwapInt64(&x.v, new) }
+
+// CompareAndSwap executes the compare-and-swap operation for x.
+func (x *Int64) CompareAndSwap(old, new int64) (swapped bool) {
+	return atomic.CompareAndSwapInt64(&x.v, old, new)
+}
+
+// A Uint64 is an atomic uint64. The zero value is zero.
+//
+// A Uint64 must not be copied after first use, and has the same alignment
+// requirement as Int64.
+type Uint64 struct {
+	v uint64
+	_ noCopy
+}
+
+// Load atomically loads and returns the value stored in x.
+func (x *Uint64) Load() uint64 { return atomic.LoadUint64(&x.v) }
+
+// Store atomically stores val into x.
+func (x *Uint64) Store(val uint64) { atomic.StoreUint64(&x.v, val) }
+
+// Add atomically adds delta to x and returns the new value.
+// To subtract d, add ^uint64(d-1).
+func (x *Uint64) Add(delta uint64) (new uint64) { return atomic.AddUint64(&x.v, delta) }
+
+// Swap atomically stores new into x and returns the previous value.
+func (x *Uint64) Swap(new uint64) (old uint64) { return atomic.SwapUint64(&x.v, new) }
+
+// CompareAndSwap executes the compare-and-swap operation for x.
+func (x *Uint64) CompareAndSwap(old, new uint64) (swapped bool) {
+	return atomic.CompareAndSwapUint64(&x.v, old, new)
+}
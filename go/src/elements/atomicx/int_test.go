@@ -0,0 +1,109 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package atomicx_test
+
+import (
+	"elements/atomicx"
+	"sync"
+	"testing"
+	"testing/quick"
+)
+
+func TestInt32(t *testing.T) {
+	// 单个goroutine中, 每个方法的结果和普通的整数运算相同
+	f := func(a, b, c int32) bool {
+		var x atomicx.Int32
+		x.Store(a)
+		if x.Add(b) != a+b || x.Load() != a+b {
+			return false
+		}
+		if x.Swap(c) != a+b || x.Load() != c {
+			return false
+		}
+		return x.CompareAndSwap(c, a) && !x.CompareAndSwap(c+1, b) && x.Load() == a
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInt64(t *testing.T) {
+	f := func(a, b, c int64) bool {
+		var x atomicx.Int64
+		x.Store(a)
+		if x.Add(b) != a+b || x.Load() != a+b {
+			return false
+		}
+		if x.Swap(c) != a+b || x.Load() != c {
+			return false
+		}
+		return x.CompareAndSwap(c, a) && !x.CompareAndSwap(c+1, b) && x.Load() == a
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestUint64(t *testing.T) {
+	f := func(a, b, c uint64) bool {
+		var x atomicx.Uint64
+		x.Store(a)
+		if x.Add(b) != a+b || x.Load() != a+b {
+			return false
+		}
+		if x.Add(^uint64(b-1)) != a { // 减去b
+			return false
+		}
+		if x.Swap(c) != a || x.Load() != c {
+			return false
+		}
+		return x.CompareAndSwap(c, a) && !x.CompareAndSwap(c+1, b) && x.Load() == a
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestAddNeverLoses(t *testing.T) {
+	const goroutines, adds = 8, 10000
+	var i32 atomicx.Int32
+	var i64 atomicx.Int64
+	var u64 atomicx.Uint64
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < adds; i++ {
+				i32.Add(1)
+				i64.Add(2)
+				u64.Add(3)
+			}
+		}()
+	}
+	wg.Wait()
+	if i32.Load() != goroutines*adds || i64.Load() != 2*goroutines*adds || u64.Load() != 3*goroutines*adds {
+		t.Errorf("lost updates: %d %d %d", i32.Load(), i64.Load(), u64.Load())
+	}
+}
+
+func TestCompareAndSwapElectsOne(t *testing.T) {
+	var x atomicx.Int32
+	var winners atomicx.Int32
+	var wg sync.WaitGroup
+	for g := 1; g <= 16; g++ {
+		wg.Add(1)
+		go func(g int32) {
+			defer wg.Done()
+			if x.CompareAndSwap(0, g) {
+				winners.Add(1)
+			}
+		}(int32(g))
+	}
+	wg.Wait()
+	if winners.Load() != 1 || x.Load() == 0 {
+		t.Errorf("%d winners, x = %d", winners.Load(), x.Load())
+	}
+}
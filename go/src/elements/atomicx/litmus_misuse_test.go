@@ -0,0 +1,114 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build litmus
+
+package atomicx_test
+
+import (
+	"elements/atomicx"
+	"runtime"
+	"sync/atomic"
+	"testing"
+)
+
+// The tests in this file misuse atomics on purpose. Run them with
+//
+//	go test -race -tags litmus -run Misuse
+//
+// and the race detector reports each one. Without -race they usually
+// pass, which is the point: the outcomes they allow are rare, and a test
+// that passes proves nothing about them.
+
+// TestMisusePlainFlag is MP with a plain flag. Nothing orders the write of
+// data before the write of flag, for the compiler or the CPU.
+func TestMisusePlainFlag(t *testing.T) {
+	for i := 0; i < rounds; i++ {
+		var data, flag int
+		r := -1
+		race(func() {
+			data = 42
+			flag = 1
+		}, func() {
+			if flag == 1 {
+				r = data
+			}
+		})
+		if r != -1 && r != 42 {
+			t.Fatalf("round %d: saw the flag but data = %d", i, r)
+		}
+	}
+}
+
+// TestMisuseMixedAccess stores the flag atomically but loads it with a
+// plain read. Atomicity needs both sides: the plain read may be torn,
+// cached in a register or reordered, and it synchronizes with nothing.
+func TestMisuseMixedAccess(t *testing.T) {
+	for i := 0; i < rounds; i++ {
+		var data int
+		var flag int32
+		r := -1
+		race(func() {
+			data = 42
+			atomic.StoreInt32(&flag, 1)
+		}, func() {
+			if flag == 1 {
+				r = data
+			}
+		})
+		if r != -1 && r != 42 {
+			t.Fatalf("round %d: saw the flag but data = %d", i, r)
+		}
+	}
+}
+
+// TestMisuseWriteAfterPublish publishes an object through an atomic
+// pointer and then keeps writing to it. The Store orders only the
+// writes made before it.
+func TestMisuseWriteAfterPublish(t *testing.T) {
+	type msg struct{ a int }
+	for i := 0; i < rounds; i++ {
+		var p atomicx.Int32
+		m := &msg{}
+		race(func() {
+			p.Store(1)
+			m.a = 1 // after the Store: not published
+		}, func() {
+			if p.Load() == 1 {
+				_ = m.a
+			}
+		})
+	}
+}
+
+// TestMisuseIndependentCounters uses two atomic counters as if they were
+// one value. Each is atomic, but a reader can see one updated and not the
+// other. There is no data race here, so the race detector is silent; the
+// test fails by itself.
+func TestMisuseIndependentCounters(t *testing.T) {
+	var hits, total atomicx.Int64
+	done := make(chan bool)
+	go func() {
+		for i := 0; i < rounds; i++ {
+			total.Add(1)
+			hits.Add(1)
+		}
+		close(done)
+	}()
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		// 写者先加total再加hits, 先读total再读hits, 中间只要写者前进了,
+		// 就会看到hits > total. Gosched把这个间隔放大
+		n := total.Load()
+		runtime.Gosched()
+		h := hits.Load()
+		if h > n {
+			t.Fatalf("hits %d > total %d: the two loads are not one snapshot", h, n)
+		}
+	}
+}
@@ -0,0 +1,145 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package atomicx_test
+
+import (
+	"elements/atomicx"
+	"runtime"
+	"sync"
+	"testing"
+	"unsafe"
+)
+
+// Litmus tests: two or more goroutines make a few accesses, and the test
+// checks that an outcome forbidden by sequential consistency never occurs.
+// Each runs many rounds, because a forbidden outcome, if the hardware or
+// compiler allowed it, would show up only occasionally.
+//
+// litmus_misuse_test.go (build tag litmus) has the same tests with the
+// atomics replaced by plain accesses; run them with -race -tags litmus to
+// see the race detector report them.
+
+const rounds = 20000
+
+// race runs f and g concurrently, starting them as close together as it can.
+func race(f, g func()) {
+	var ready, wg sync.WaitGroup
+	var start atomicx.Int32
+	ready.Add(2)
+	wg.Add(2)
+	for _, fn := range []func(){f, g} {
+		fn := fn
+		go func() {
+			defer wg.Done()
+			ready.Done()
+			for start.Load() == 0 {
+				runtime.Gosched()
+			}
+			fn()
+		}()
+	}
+	ready.Wait()
+	start.Store(1)
+	wg.Wait()
+}
+
+// TestMessagePassing is the MP litmus test:
+//
+//	data = 42          | if flag.Load() == 1 {
+//	flag.Store(1)      |     r = data
+//	                   | }
+//
+// If the reader sees the flag it must see the data: the Store happens
+// before the Load that observes it, and data is written before the Store.
+func TestMessagePassing(t *testing.T) {
+	for i := 0; i < rounds; i++ {
+		var data int
+		var flag atomicx.Int32
+		r := -1
+		race(func() {
+			data = 42
+			flag.Store(1)
+		}, func() {
+			if flag.Load() == 1 {
+				r = data
+			}
+		})
+		if r != -1 && r != 42 {
+			t.Fatalf("round %d: saw the flag but data = %d", i, r)
+		}
+	}
+}
+
+// TestStoreBuffering is the SB (Dekker) litmus test:
+//
+//	x.Store(1)         | y.Store(1)
+//	r1 = y.Load()      | r2 = x.Load()
+//
+// r1 == r2 == 0 is forbidden: in a single total order one of the Stores
+// comes first, and the other goroutine's Load comes after it. x86 allows
+// this outcome for plain MOVs (each CPU's store sits in its store buffer
+// while its load goes ahead), so atomic stores there use XCHG, which
+// drains the buffer.
+func TestStoreBuffering(t *testing.T) {
+	for i := 0; i < rounds; i++ {
+		var x, y atomicx.Int32
+		var r1, r2 int32
+		race(func() {
+			x.Store(1)
+			r1 = y.Load()
+		}, func() {
+			y.Store(1)
+			r2 = x.Load()
+		})
+		if r1 == 0 && r2 == 0 {
+			t.Fatalf("round %d: r1 == r2 == 0", i)
+		}
+	}
+}
+
+// TestLoadBuffering is the LB litmus test:
+//
+//	r1 = x.Load()      | r2 = y.Load()
+//	y.Store(1)         | x.Store(1)
+//
+// r1 == r2 == 1 is forbidden: each Load would have to observe a Store
+// that comes after it in its own goroutine.
+func TestLoadBuffering(t *testing.T) {
+	for i := 0; i < rounds; i++ {
+		var x, y atomicx.Int32
+		var r1, r2 int32
+		race(func() {
+			r1 = x.Load()
+			y.Store(1)
+		}, func() {
+			r2 = y.Load()
+			x.Store(1)
+		})
+		if r1 == 1 && r2 == 1 {
+			t.Fatalf("round %d: r1 == r2 == 1", i)
+		}
+	}
+}
+
+// TestPublishPointer checks the pointer form of MP: fields written before
+// the pointer is stored are visible through the loaded pointer.
+func TestPublishPointer(t *testing.T) {
+	type msg struct{ a, b int }
+	for i := 0; i < rounds; i++ {
+		var p atomicx.Pointer
+		var got msg
+		race(func() {
+			m := &msg{a: 1, b: 2}
+			p.Store(unsafe.Pointer(m))
+		}, func() {
+			if m := (*msg)(p.Load()); m != nil {
+				got = *m
+			}
+		})
+		if got != (msg{}) && got != (msg{1, 2}) {
+			t.Fatalf("round %d: saw %+v", i, got)
+		}
+	}
+}
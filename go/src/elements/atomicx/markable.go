@@ -0,0 +1,146 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package atomicx
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A MarkablePointer is a pointer and a boolean mark that are loaded and
+// compared-and-swapped together. The zero value is nil and unmarked.
+//
+// Lock-free linked lists use the mark to delete a node in two steps
+// (Harris): first mark the node's next pointer, so that no insertion can
+// link after it any more, then unlink it. A plain CAS on the pointer
+// cannot tell a marked next pointer from an unmarked one.
+//
+// A MarkablePointer must not be copied after first use.
+//
+// 指针和标记放在一个不可变的pair中, 每次修改分配一个新的pair, CAS的是pair的
+// 指针, 和java.util.concurrent.atomic.AtomicMarkableReference相同. 把标记藏在
+// 指针的低位更省内存, 但GC会把藏了标记的uintptr当成整数, 不能这样做
+type MarkablePointer struct {
+	_ noCopy
+	p unsafe.Pointer // *markedPair
+}
+
+type markedPair struct {
+	p    unsafe.Pointer
+	mark bool
+}
+
+var unmarkedNil = &markedPair{}
+
+func (x *MarkablePointer) pair() *markedPair {
+	if p := (*markedPair)(atomic.LoadPointer(&x.p)); p != nil {
+		return p
+	}
+	return unmarkedNil
+}
+
+// Load atomically loads the pointer and the mark.
+func (x *MarkablePointer) Load() (p unsafe.Pointer, mark bool) {
+	pr := x.pair()
+	return pr.p, pr.mark
+}
+
+// Store atomically stores p and mark.
+func (x *MarkablePointer) Store(p unsafe.Pointer, mark bool) {
+	atomic.StorePointer(&x.p, unsafe.Pointer(&markedPair{p, mark}))
+}
+
+// CompareAndSwap stores newP and newMark if the pointer is oldP and the
+// mark is oldMark, and reports whether it did.
+func (x *MarkablePointer) CompareAndSwap(oldP unsafe.Pointer, oldMark bool, newP unsafe.Pointer, newMark bool) (swapped bool) {
+	cur := x.pair()
+	if cur.p != oldP || cur.mark != oldMark {
+		return false
+	}
+	if newP == oldP && newMark == oldMark {
+		// 不用分配新的pair
+		return true
+	}
+	// pair从不被重用, cur的地址不变说明其间没有被修改过
+	old := unsafe.Pointer(cur)
+	if cur == unmarkedNil {
+		old = nil
+	}
+	return atomic.CompareAndSwapPointer(&x.p, old, unsafe.Pointer(&markedPair{newP, newMark}))
+}
+
+// AttemptMark sets the mark to newMark if the pointer is p, and reports
+// whether it did. Unlike CompareAndSwap it succeeds whatever the previous
+// mark was.
+func (x *MarkablePointer) AttemptMark(p unsafe.Pointer, newMark bool) bool {
+	for {
+		cur := x.pair()
+		if cur.p != p {
+			return false
+		}
+		if x.CompareAndSwap(p, cur.mark, p, newMark) {
+			return true
+		}
+	}
+}
+
+// A StampedPointer is a pointer and a stamp that are loaded and
+// compared-and-swapped together. The zero value is nil with stamp 0.
+//
+// The stamp defeats the ABA problem: if a pointer is changed from A to B
+// and back to A, a CAS that only compares pointers succeeds although the
+// structure changed underneath. Bumping the stamp on every change makes
+// such a CAS fail. Garbage collection already prevents ABA for objects
+// that the caller still holds, but not for nodes that are recycled, for
+// example through a free list or a sync.Pool.
+//
+// A StampedPointer must not be copied after first use.
+type StampedPointer struct {
+	_ noCopy
+	p unsafe.Pointer // *stampedPair
+}
+
+type stampedPair struct {
+	p     unsafe.Pointer
+	stamp uint64
+}
+
+var zeroStamped = &stampedPair{}
+
+func (x *StampedPointer) pair() *stampedPair {
+	if p := (*stampedPair)(atomic.LoadPointer(&x.p)); p != nil {
+		return p
+	}
+	return zeroStamped
+}
+
+// Load atomically loads the pointer and the stamp.
+func (x *StampedPointer) Load() (p unsafe.Pointer, stamp uint64) {
+	pr := x.pair()
+	return pr.p, pr.stamp
+}
+
+// Store atomically stores p and stamp.
+func (x *StampedPointer) Store(p unsafe.Pointer, stamp uint64) {
+	atomic.StorePointer(&x.p, unsafe.Pointer(&stampedPair{p, stamp}))
+}
+
+// CompareAndSwap stores newP and newStamp if the pointer is oldP and the
+// stamp is oldStamp, and reports whether it did. The usual newStamp is
+// oldStamp+1.
+func (x *StampedPointer) CompareAndSwap(oldP unsafe.Pointer, oldStamp uint64, newP unsafe.Pointer, newStamp uint64) (swapped bool) {
+	cur := x.pair()
+	if cur.p != oldP || cur.stamp != oldStamp {
+		return false
+	}
+	if newP == oldP && newStamp == oldStamp {
+		return true
+	}
+	old := unsafe.Pointer(cur)
+	if cur == zeroStamped {
+		old = nil
+	}
+	return atomic.CompareAndSwapPointer(&x.p, old, unsafe.Pointer(&stampedPair{newP, newStamp}))
+}
@@ -0,0 +1,105 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package atomicx_test
+
+import (
+	"elements/atomicx"
+	"sync"
+	"testing"
+	"unsafe"
+)
+
+func TestMarkablePointer(t *testing.T) {
+	var x atomicx.MarkablePointer
+	if p, m := x.Load(); p != nil || m {
+		t.Fatalf("zero value = %p, %v", p, m)
+	}
+	a, b := unsafe.Pointer(new(int)), unsafe.Pointer(new(int))
+	if !x.CompareAndSwap(nil, false, a, false) {
+		t.Fatal("CompareAndSwap from the zero value failed")
+	}
+	if x.CompareAndSwap(a, true, b, false) {
+		t.Fatal("CompareAndSwap succeeded with the wrong mark")
+	}
+	if !x.AttemptMark(a, true) || x.AttemptMark(b, false) {
+		t.Fatal("AttemptMark")
+	}
+	if p, m := x.Load(); p != a || !m {
+		t.Fatalf("Load = %p, %v, want %p, true", p, m, a)
+	}
+	// 标记之后只比较指针的CAS也会失败, 这就是Harris链表需要的
+	if x.CompareAndSwap(a, false, b, false) {
+		t.Fatal("CompareAndSwap ignored the mark")
+	}
+	x.Store(b, false)
+	if p, m := x.Load(); p != b || m {
+		t.Fatalf("Load after Store = %p, %v", p, m)
+	}
+}
+
+// 多个goroutine同时标记同一个节点, 只有一个看到未标记的状态并成功
+func TestMarkablePointerOneMarks(t *testing.T) {
+	var x atomicx.MarkablePointer
+	a := unsafe.Pointer(new(int))
+	x.Store(a, false)
+	var winners atomicx.Int32
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if x.CompareAndSwap(a, false, a, true) {
+				winners.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if winners.Load() != 1 {
+		t.Errorf("%d goroutines marked the pointer", winners.Load())
+	}
+}
+
+func TestStampedPointerABA(t *testing.T) {
+	var x atomicx.StampedPointer
+	a, b := unsafe.Pointer(new(int)), unsafe.Pointer(new(int))
+	x.Store(a, 0)
+	p, stamp := x.Load()
+
+	// 另一个goroutine把a换成b又换回a
+	if !x.CompareAndSwap(a, 0, b, 1) || !x.CompareAndSwap(b, 1, a, 2) {
+		t.Fatal("CompareAndSwap")
+	}
+	// 指针相同, 但stamp告诉我们它变过
+	if x.CompareAndSwap(p, stamp, b, stamp+1) {
+		t.Fatal("CompareAndSwap succeeded after A-B-A")
+	}
+	if p, stamp := x.Load(); p != a || stamp != 2 {
+		t.Fatalf("Load = %p, %d", p, stamp)
+	}
+}
+
+func TestStampedPointerCounts(t *testing.T) {
+	const goroutines, n = 8, 1000
+	var x atomicx.StampedPointer
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				for {
+					p, s := x.Load()
+					if x.CompareAndSwap(p, s, p, s+1) {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if _, s := x.Load(); s != goroutines*n {
+		t.Errorf("stamp = %d, want %d", s, goroutines*n)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package atomicx
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A Pointer is an atomic pointer. The zero value is nil.
+//
+// A Pointer must not be copied after first use.
+//
+// 典型的用法是发布一个构造好的对象: 写者在Store之前初始化好对象的所有字段,
+// 读者Load到指针之后就能看到这些字段, 对象本身之后只读. 这就是copy-on-write,
+// atomic.Value也是这样用的, 但Pointer不需要interface{}的类型断言和分配
+type Pointer struct {
+	_ noCopy
+	v unsafe.Pointer
+}
+
+// Load atomically loads and returns the pointer stored in x.
+//
+// If Load observes the pointer stored by Store, everything the storing
+// goroutine wrote before Store, including the fields of the object
+// pointed to, is visible after Load. Writes to the object made after the
+// Store are not ordered by x, and are races unless they are synchronized
+// some other way.
+func (x *Pointer) Load() unsafe.Pointer { return atomic.LoadPointer(&x.v) }
+
+// Store atomically stores val into x.
+func (x *Pointer) Store(val unsafe.Pointer) { atomic.StorePointer(&x.v, val) }
+
+// Swap atomically stores new into x and returns the previous pointer.
+func (x *Pointer) Swap(new unsafe.Pointer) (old unsafe.Pointer) {
+	return atomic.SwapPointer(&x.v, new)
+}
+
+// CompareAndSwap executes the compare-and-swap operation for x.
+//
+// It compares addresses only. If the old object may have been freed and
+// its memory reused for a new one at the same address, the CAS succeeds
+// on a different object (the ABA problem); in Go the garbage collector
+// prevents this as long as the caller still holds old.
+func (x *Pointer) CompareAndSwap(old, new unsafe.Pointer) (swapped bool) {
+	return atomic.CompareAndSwapPointer(&x.v, old, new)
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package atomicx_test
+
+import (
+	"elements/atomicx"
+	"sync"
+	"testing"
+	"unsafe"
+)
+
+type config struct {
+	version int
+	hosts   []string
+}
+
+func TestPointer(t *testing.T) {
+	var p atomicx.Pointer
+	if p.Load() != nil {
+		t.Fatal("zero Pointer is not nil")
+	}
+	a, b := &config{version: 1}, &config{version: 2}
+	p.Store(unsafe.Pointer(a))
+	if p.CompareAndSwap(unsafe.Pointer(b), nil) {
+		t.Fatal("CompareAndSwap succeeded with the wrong old pointer")
+	}
+	if old := p.Swap(unsafe.Pointer(b)); old != unsafe.Pointer(a) {
+		t.Fatalf("Swap returned %p, want %p", old, a)
+	}
+	if !p.CompareAndSwap(unsafe.Pointer(b), unsafe.Pointer(a)) || (*config)(p.Load()) != a {
+		t.Fatal("CompareAndSwap failed")
+	}
+}
+
+// TestPointerPublish publishes a fully built config through a Pointer. The
+// readers never see a partly initialized one, and the race detector sees
+// no race on its fields.
+func TestPointerPublish(t *testing.T) {
+	var p atomicx.Pointer
+	p.Store(unsafe.Pointer(&config{version: 0, hosts: []string{"a"}}))
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for v := 1; v <= 100; v++ {
+			c := &config{version: v}
+			for i := 0; i < v; i++ {
+				c.hosts = append(c.hosts, "h")
+			}
+			p.Store(unsafe.Pointer(c))
+		}
+	}()
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			last := 0
+			for last < 100 {
+				c := (*config)(p.Load())
+				if c.version < last {
+					t.Errorf("version went back from %d to %d", last, c.version)
+					return
+				}
+				if c.version > 0 && len(c.hosts) != c.version {
+					t.Errorf("version %d has %d hosts", c.version, len(c.hosts))
+					return
+				}
+				last = c.version
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package atomicx
+
+import (
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// A Duration is an atomic time.Duration. The zero value is zero.
+//
+// A Duration must not be copied after first use, and has the same
+// alignment requirement as Int64.
+type Duration struct {
+	v int64
+	_ noCopy
+}
+
+// Load atomically loads and returns the value stored in x.
+func (x *Duration) Load() time.Duration { return time.Duration(atomic.LoadInt64(&x.v)) }
+
+// Store atomically stores val into x.
+func (x *Duration) Store(val time.Duration) { atomic.StoreInt64(&x.v, int64(val)) }
+
+// Add atomically adds delta to x and returns the new value.
+func (x *Duration) Add(delta time.Duration) (new time.Duration) {
+	return time.Duration(atomic.AddInt64(&x.v, int64(delta)))
+}
+
+// Swap atomically stores new into x and returns the previous value.
+func (x *Duration) Swap(new time.Duration) (old time.Duration) {
+	return time.Duration(atomic.SwapInt64(&x.v, int64(new)))
+}
+
+// CompareAndSwap executes the compare-and-swap operation for x.
+func (x *Duration) CompareAndSwap(old, new time.Duration) (swapped bool) {
+	return atomic.CompareAndSwapInt64(&x.v, int64(old), int64(new))
+}
+
+// A Time is an atomic time.Time. The zero value is the zero Time.
+//
+// A Time must not be copied after first use.
+//
+// time.Time有三个字(wall, ext, loc), 不能一次原子地写入. 每次Store分配一个
+// 新的副本, 原子地替换指向它的指针, 和Pointer发布对象的方式相同
+type Time struct {
+	_ noCopy
+	p unsafe.Pointer // *time.Time
+}
+
+func (x *Time) load() (unsafe.Pointer, time.Time) {
+	p := atomic.LoadPointer(&x.p)
+	if p == nil {
+		return nil, time.Time{}
+	}
+	return p, *(*time.Time)(p)
+}
+
+// Load atomically loads and returns the value stored in x, including its
+// location and monotonic clock reading.
+func (x *Time) Load() time.Time {
+	_, t := x.load()
+	return t
+}
+
+// Store atomically stores val into x.
+func (x *Time) Store(val time.Time) { atomic.StorePointer(&x.p, unsafe.Pointer(&val)) }
+
+// Swap atomically stores new into x and returns the previous value.
+func (x *Time) Swap(new time.Time) (old time.Time) {
+	p := atomic.SwapPointer(&x.p, unsafe.Pointer(&new))
+	if p == nil {
+		return time.Time{}
+	}
+	return *(*time.Time)(p)
+}
+
+// CompareAndSwap stores new into x if the value in x is the same instant
+// as old, as reported by Equal, and reports whether it did.
+func (x *Time) CompareAndSwap(old, new time.Time) (swapped bool) {
+	for {
+		p, cur := x.load()
+		if !cur.Equal(old) {
+			return false
+		}
+		// 指针变了但新的值仍然等于old时重试
+		if atomic.CompareAndSwapPointer(&x.p, p, unsafe.Pointer(&new)) {
+			return true
+		}
+	}
+}
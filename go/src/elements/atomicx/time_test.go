@@ -0,0 +1,76 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package atomicx_test
+
+import (
+	"elements/atomicx"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDuration(t *testing.T) {
+	var x atomicx.Duration
+	x.Store(time.Second)
+	if x.Add(-time.Millisecond) != 999*time.Millisecond {
+		t.Errorf("Add = %v", x.Load())
+	}
+	if x.Swap(time.Minute) != 999*time.Millisecond || x.Load() != time.Minute {
+		t.Errorf("Swap left %v", x.Load())
+	}
+	if x.CompareAndSwap(time.Second, 0) || !x.CompareAndSwap(time.Minute, 0) || x.Load() != 0 {
+		t.Errorf("CompareAndSwap left %v", x.Load())
+	}
+}
+
+func TestTime(t *testing.T) {
+	var x atomicx.Time
+	if !x.Load().IsZero() {
+		t.Fatal("zero Time is not the zero time")
+	}
+	now := time.Now()
+	if !x.CompareAndSwap(time.Time{}, now) || x.Load() != now {
+		t.Fatal("CompareAndSwap from the zero time failed")
+	}
+	// 同一时刻的另一种表示(不同的时区, 没有单调时钟)也算相等
+	utc := now.UTC().Round(0)
+	later := now.Add(time.Hour)
+	if !x.CompareAndSwap(utc, later) || !x.Load().Equal(later) {
+		t.Fatal("CompareAndSwap with an equal instant failed")
+	}
+	if x.CompareAndSwap(now, now) {
+		t.Fatal("CompareAndSwap succeeded with the wrong old time")
+	}
+	if old := x.Swap(now); !old.Equal(later) || x.Load() != now {
+		t.Fatalf("Swap returned %v", old)
+	}
+	var y atomicx.Time
+	if old := y.Swap(now); !old.IsZero() {
+		t.Fatalf("Swap on the zero Time returned %v", old)
+	}
+}
+
+// 并发的Store和Load看到的总是某一次Store的完整的值, 不会是两次的混合
+func TestTimeTorn(t *testing.T) {
+	var x atomicx.Time
+	a := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	b := time.Date(2021, 6, 1, 12, 0, 0, 0, time.FixedZone("x", 3600))
+	x.Store(a)
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 10000; i++ {
+			x.Store(b)
+			x.Store(a)
+		}
+	}()
+	for i := 0; i < 10000; i++ {
+		if v := x.Load(); v != a && v != b {
+			t.Fatalf("Load returned %v", v)
+		}
+	}
+	wg.Wait()
+}
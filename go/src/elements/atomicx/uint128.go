@@ -0,0 +1,113 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package atomicx
+
+import (
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+// A Uint128 is an atomic pair of uint64 words, loaded, stored and
+// compared-and-swapped as one. The zero value is zero.
+//
+// Algorithms that need to CAS two words at once, such as a queue slot
+// holding a sequence number next to its value, or a pointer next to a
+// counter, can use a Uint128 where the hardware has a double-word CAS
+// (CMPXCHG16B on amd64) and still run elsewhere: on other platforms, or
+// on the rare amd64 processors without CMPXCHG16B, a Uint128 is guarded
+// by a sequence lock. LockFree reports which one is in use.
+//
+// A Uint128 must not be copied after first use, and has the same
+// alignment requirement as Int64.
+//
+// CMPXCHG16B要求地址16字节对齐, 而Go只保证8字节. v多留一个字, 从中选出对齐的
+// 两个字使用. seq只在没有CMPXCHG16B时使用
+type Uint128 struct {
+	v   [3]uint64
+	seq uint32
+	_   noCopy
+}
+
+// LockFree reports whether Uint128 uses a hardware double-word CAS. When
+// it does not, Uint128 operations serialize on a per-value sequence lock,
+// and a goroutine preempted while holding it blocks the others.
+func LockFree() bool { return useCAS128 }
+
+// words returns the two words holding the value, lo first. In the
+// lock-free case they are 16-byte aligned.
+func (x *Uint128) words() *[2]uint64 {
+	if useCAS128 {
+		return aligned128(&x.v)
+	}
+	return (*[2]uint64)(unsafe.Pointer(&x.v[0]))
+}
+
+// Load atomically loads and returns the value stored in x.
+func (x *Uint128) Load() (hi, lo uint64) {
+	w := x.words()
+	if useCAS128 {
+		return load128(w)
+	}
+	// 读者不加锁: seq为偶数并且读前读后没有变, 说明读的时候没有写者
+	for {
+		s := atomic.LoadUint32(&x.seq)
+		if s&1 == 0 {
+			lo = atomic.LoadUint64(&w[0])
+			hi = atomic.LoadUint64(&w[1])
+			if atomic.LoadUint32(&x.seq) == s {
+				return hi, lo
+			}
+		}
+		runtime.Gosched()
+	}
+}
+
+// Store atomically stores hi and lo into x.
+func (x *Uint128) Store(hi, lo uint64) {
+	w := x.words()
+	if useCAS128 {
+		// 没有16字节的原子写, 用CAS循环
+		for {
+			oldHi, oldLo := load128(w)
+			if cas128(w, oldHi, oldLo, hi, lo) {
+				return
+			}
+		}
+	}
+	s := x.lock()
+	atomic.StoreUint64(&w[0], lo)
+	atomic.StoreUint64(&w[1], hi)
+	atomic.StoreUint32(&x.seq, s+2)
+}
+
+// CompareAndSwap executes the compare-and-swap operation for x: if both
+// words equal oldHi and oldLo, it stores newHi and newLo.
+func (x *Uint128) CompareAndSwap(oldHi, oldLo, newHi, newLo uint64) (swapped bool) {
+	w := x.words()
+	if useCAS128 {
+		return cas128(w, oldHi, oldLo, newHi, newLo)
+	}
+	s := x.lock()
+	if w[0] == oldLo && w[1] == oldHi {
+		atomic.StoreUint64(&w[0], newLo)
+		atomic.StoreUint64(&w[1], newHi)
+		swapped = true
+	}
+	atomic.StoreUint32(&x.seq, s+2)
+	return swapped
+}
+
+// lock makes seq odd, excluding other writers and making readers retry,
+// and returns the even value it had.
+func (x *Uint128) lock() uint32 {
+	for {
+		s := atomic.LoadUint32(&x.seq)
+		if s&1 == 0 && atomic.CompareAndSwapUint32(&x.seq, s, s+1) {
+			return s
+		}
+		runtime.Gosched()
+	}
+}
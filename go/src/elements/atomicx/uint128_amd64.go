@@ -0,0 +1,23 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package atomicx
+
+import "unsafe"
+
+// CPUID.01H:ECX.CMPXCHG16B[bit 13]
+var useCAS128 = cpuid1ecx()&(1<<13) != 0
+
+func cpuid1ecx() uint32
+
+func cas128(addr *[2]uint64, oldHi, oldLo, newHi, newLo uint64) (swapped bool)
+
+func load128(addr *[2]uint64) (hi, lo uint64)
+
+func aligned128(v *[3]uint64) *[2]uint64 {
+	if uintptr(unsafe.Pointer(v))&15 == 0 {
+		return (*[2]uint64)(unsafe.Pointer(&v[0]))
+	}
+	return (*[2]uint64)(unsafe.Pointer(&v[1]))
+}
@@ -0,0 +1,45 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+#include "textflag.h"
+
+// func cpuid1ecx() uint32
+TEXT ·cpuid1ecx(SB),NOSPLIT,$0-4
+	MOVL	$1, AX
+	XORL	CX, CX
+	CPUID
+	MOVL	CX, ret+0(FP)
+	RET
+
+// func cas128(addr *[2]uint64, oldHi, oldLo, newHi, newLo uint64) (swapped bool)
+//
+// CMPXCHG16B compares DX:AX with the 16 bytes at addr; if equal it stores
+// CX:BX there and sets ZF, otherwise it loads them into DX:AX.
+TEXT ·cas128(SB),NOSPLIT,$0-41
+	MOVQ	addr+0(FP), DI
+	MOVQ	oldHi+8(FP), DX
+	MOVQ	oldLo+16(FP), AX
+	MOVQ	newHi+24(FP), CX
+	MOVQ	newLo+32(FP), BX
+	LOCK
+	CMPXCHG16B	(DI)
+	SETEQ	swapped+40(FP)
+	RET
+
+// func load128(addr *[2]uint64) (hi, lo uint64)
+//
+// There is no 16-byte atomic load. A CMPXCHG16B of zero with zero either
+// fails and loads the value, or finds zero and stores zero back; either
+// way DX:AX ends up holding the value.
+TEXT ·load128(SB),NOSPLIT,$0-24
+	MOVQ	addr+0(FP), DI
+	XORQ	AX, AX
+	XORQ	DX, DX
+	XORQ	BX, BX
+	XORQ	CX, CX
+	LOCK
+	CMPXCHG16B	(DI)
+	MOVQ	DX, hi+8(FP)
+	MOVQ	AX, lo+16(FP)
+	RET
@@ -0,0 +1,21 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !amd64
+
+package atomicx
+
+var useCAS128 = false
+
+func cas128(addr *[2]uint64, oldHi, oldLo, newHi, newLo uint64) bool {
+	panic("unreachable")
+}
+
+func load128(addr *[2]uint64) (hi, lo uint64) {
+	panic("unreachable")
+}
+
+func aligned128(v *[3]uint64) *[2]uint64 {
+	panic("unreachable")
+}
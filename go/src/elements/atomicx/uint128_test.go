@@ -0,0 +1,118 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package atomicx_test
+
+import (
+	"elements/atomicx"
+	"runtime"
+	"sync"
+	"testing"
+	"testing/quick"
+)
+
+// 每个测试在硬件CAS和序列锁下各运行一次
+func both(t *testing.T, f func(t *testing.T)) {
+	if atomicx.LockFree() {
+		t.Run("cas128", f)
+	} else if runtime.GOARCH == "amd64" {
+		t.Log("CMPXCHG16B not available")
+	}
+	restore := atomicx.DisableCAS128()
+	defer restore()
+	t.Run("seqlock", f)
+}
+
+func TestUint128(t *testing.T) {
+	both(t, func(t *testing.T) {
+		f := func(a, b, c, d uint64) bool {
+			// 分配在不同的偏移上, 对齐的两个字有时是v[0:2], 有时是v[1:3]
+			xs := make([]struct {
+				x atomicx.Uint128
+				_ uint64
+			}, 2)
+			for i := range xs {
+				x := &xs[i].x
+				if hi, lo := x.Load(); hi != 0 || lo != 0 {
+					return false
+				}
+				x.Store(a, b)
+				if hi, lo := x.Load(); hi != a || lo != b {
+					return false
+				}
+				if x.CompareAndSwap(a, b+1, c, d) || x.CompareAndSwap(a+1, b, c, d) {
+					return false
+				}
+				if !x.CompareAndSwap(a, b, c, d) {
+					return false
+				}
+				if hi, lo := x.Load(); hi != c || lo != d {
+					return false
+				}
+			}
+			return true
+		}
+		if err := quick.Check(f, nil); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+// 两个字总是一起变化: 写者保持hi == ^lo, 读者不应该看到别的组合
+func TestUint128Torn(t *testing.T) {
+	both(t, func(t *testing.T) {
+		var x atomicx.Uint128
+		x.Store(^uint64(0), 0)
+		var wg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 10000; i++ {
+					hi, lo := x.Load()
+					if hi != ^lo {
+						t.Errorf("torn read: %#x %#x", hi, lo)
+						return
+					}
+					x.CompareAndSwap(hi, lo, ^(lo + 1), lo+1)
+				}
+			}()
+		}
+		wg.Wait()
+		if hi, lo := x.Load(); hi != ^lo || lo == 0 {
+			t.Errorf("final value %#x %#x", hi, lo)
+		}
+	})
+}
+
+func TestUint128Counts(t *testing.T) {
+	both(t, func(t *testing.T) {
+		const goroutines, n = 4, 2000
+		var x atomicx.Uint128
+		var wg sync.WaitGroup
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < n; i++ {
+					for {
+						// 低位溢出时进位到高位
+						hi, lo := x.Load()
+						nhi, nlo := hi, lo+1<<62
+						if nlo < lo {
+							nhi++
+						}
+						if x.CompareAndSwap(hi, lo, nhi, nlo) {
+							break
+						}
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		if hi, lo := x.Load(); hi != goroutines*n/4 || lo != 0 {
+			t.Errorf("x = %d:%d, want %d:0", hi, lo, goroutines*n/4)
+		}
+	})
+}
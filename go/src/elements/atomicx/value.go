@@ -0,0 +1,113 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package atomicx
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A String is an atomic string. The zero value is "".
+//
+// A String must not be copied after first use.
+//
+// string是指针和长度两个字, 和Time一样存一个指向副本的指针. atomic.Value也能
+// 存string, 但Go 1.14的Value没有Swap和CompareAndSwap
+type String struct {
+	_ noCopy
+	p unsafe.Pointer // *string
+}
+
+func (x *String) load() (unsafe.Pointer, string) {
+	p := atomic.LoadPointer(&x.p)
+	if p == nil {
+		return nil, ""
+	}
+	return p, *(*string)(p)
+}
+
+// Load atomically loads and returns the value stored in x.
+func (x *String) Load() string {
+	_, s := x.load()
+	return s
+}
+
+// Store atomically stores val into x.
+func (x *String) Store(val string) { atomic.StorePointer(&x.p, unsafe.Pointer(&val)) }
+
+// Swap atomically stores new into x and returns the previous value.
+func (x *String) Swap(new string) (old string) {
+	p := atomic.SwapPointer(&x.p, unsafe.Pointer(&new))
+	if p == nil {
+		return ""
+	}
+	return *(*string)(p)
+}
+
+// CompareAndSwap stores new into x if the value in x equals old, and
+// reports whether it did.
+func (x *String) CompareAndSwap(old, new string) (swapped bool) {
+	for {
+		p, cur := x.load()
+		if cur != old {
+			return false
+		}
+		if atomic.CompareAndSwapPointer(&x.p, p, unsafe.Pointer(&new)) {
+			return true
+		}
+	}
+}
+
+// An Error is an atomic error. The zero value holds nil.
+//
+// An Error must not be copied after first use.
+//
+// 典型的用法是记录一组goroutine中的第一个错误: CompareAndSwap(nil, err)
+type Error struct {
+	_ noCopy
+	p unsafe.Pointer // *error
+}
+
+func (x *Error) load() (unsafe.Pointer, error) {
+	p := atomic.LoadPointer(&x.p)
+	if p == nil {
+		return nil, nil
+	}
+	return p, *(*error)(p)
+}
+
+// Load atomically loads and returns the error stored in x.
+func (x *Error) Load() error {
+	_, err := x.load()
+	return err
+}
+
+// Store atomically stores val into x. Unlike atomic.Value, a nil error
+// can be stored.
+func (x *Error) Store(val error) { atomic.StorePointer(&x.p, unsafe.Pointer(&val)) }
+
+// Swap atomically stores new into x and returns the previous error.
+func (x *Error) Swap(new error) (old error) {
+	p := atomic.SwapPointer(&x.p, unsafe.Pointer(&new))
+	if p == nil {
+		return nil
+	}
+	return *(*error)(p)
+}
+
+// CompareAndSwap stores new into x if the error in x equals old, as
+// reported by ==, and reports whether it did. Like ==, it panics if both
+// errors have the same uncomparable dynamic type.
+func (x *Error) CompareAndSwap(old, new error) (swapped bool) {
+	for {
+		p, cur := x.load()
+		if cur != old {
+			return false
+		}
+		if atomic.CompareAndSwapPointer(&x.p, p, unsafe.Pointer(&new)) {
+			return true
+		}
+	}
+}
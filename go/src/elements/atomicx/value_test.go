@@ -0,0 +1,118 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package atomicx_test
+
+import (
+	"elements/atomicx"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"testing/quick"
+)
+
+func TestBool(t *testing.T) {
+	var x atomicx.Bool
+	if x.Load() {
+		t.Fatal("zero Bool is true")
+	}
+	x.Store(true)
+	if !x.Load() || !x.Swap(false) || x.Load() {
+		t.Fatal("Store and Swap")
+	}
+	if x.CompareAndSwap(true, false) || !x.CompareAndSwap(false, true) || !x.Load() {
+		t.Fatal("CompareAndSwap")
+	}
+}
+
+func TestBoolElectsOne(t *testing.T) {
+	var closed atomicx.Bool
+	var winners atomicx.Int32
+	var wg sync.WaitGroup
+	for g := 0; g < 16; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if closed.CompareAndSwap(false, true) {
+				winners.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	if winners.Load() != 1 {
+		t.Errorf("%d winners", winners.Load())
+	}
+}
+
+func TestString(t *testing.T) {
+	f := func(a, b, c string) bool {
+		var x atomicx.String
+		if x.Load() != "" || !x.CompareAndSwap("", a) {
+			return false
+		}
+		if x.Swap(b) != a || x.Load() != b {
+			return false
+		}
+		// 比较的是内容, 不是Store时的那个副本
+		return x.CompareAndSwap(string([]byte(b)), c) && !x.CompareAndSwap(c+"x", a) && x.Load() == c
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+type listError []string
+
+func (e listError) Error() string { return "list" }
+
+func TestError(t *testing.T) {
+	var x atomicx.Error
+	if x.Load() != nil {
+		t.Fatal("zero Error is not nil")
+	}
+	if !x.CompareAndSwap(nil, io.EOF) || x.CompareAndSwap(nil, io.ErrUnexpectedEOF) {
+		t.Fatal("first CompareAndSwap(nil, err) should win, the second lose")
+	}
+	if old := x.Swap(nil); old != io.EOF || x.Load() != nil {
+		t.Fatalf("Swap returned %v", old)
+	}
+	x.Store(errors.New("a"))
+	x.Store(nil)
+	if x.Load() != nil {
+		t.Fatal("Store(nil)")
+	}
+
+	x.Store(listError{"a"})
+	defer func() {
+		if recover() == nil {
+			t.Error("CompareAndSwap of uncomparable errors did not panic")
+		}
+	}()
+	x.CompareAndSwap(listError{"a"}, nil)
+}
+
+func TestErrorFirst(t *testing.T) {
+	var first atomicx.Error
+	errs := make([]error, 16)
+	var wg sync.WaitGroup
+	for i := range errs {
+		errs[i] = errors.New("e")
+		wg.Add(1)
+		go func(err error) {
+			defer wg.Done()
+			first.CompareAndSwap(nil, err)
+		}(errs[i])
+	}
+	wg.Wait()
+	n := 0
+	for _, err := range errs {
+		if err == first.Load() {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("first error matches %d errors", n)
+	}
+}
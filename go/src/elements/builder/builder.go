@@ -0,0 +1,135 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package builder provides strings.Builder with annotations, and builders
+// that are safe for concurrent use.
+//
+// Builder is strings.Builder. SafeBuilder guards a Builder with a mutex.
+// ShardedBuilder spreads writes over several SafeBuilders so that many
+// goroutines can append records, such as log lines, without contending on
+// one lock; the order of records from different goroutines is not kept.
+package builder
+
+import (
+	"unicode/utf8"
+	"unsafe"
+)
+
+// A Builder is used to efficiently build a string using Write methods.
+// It minimizes memory copying. The zero value is ready to use.
+// Do not copy a non-zero Builder.
+//
+// 和bytes.Buffer相比, Builder只能追加, 不能读也不能修改已经写入的内容,
+// 这正是String()可以不复制就把[]byte当作string返回的前提
+type Builder struct {
+	addr *Builder // of receiver, to detect copies by value
+	buf  []byte
+}
+
+// copyCheck panics if b is a copy of a Builder that has been written to.
+//
+// 复制Builder会得到共享同一个底层数组的两个buf. 两者都能继续append,
+// 写入的字节会互相覆盖, 而已经返回的String()本来应该是不可变的.
+// 所以第一次写入时记下自己的地址, 之后每次写入都检查地址是否变了
+func (b *Builder) copyCheck() {
+	if b.addr == nil {
+		// strings.Builder在这里用runtime的noescape把b藏起来, 不让逃逸
+		// 分析看到b被存进了b自己 (issue 23382, 7921), 代价是go vet的
+		// unsafeptr报告. 这里直接赋值: 写入过的Builder总是在堆上
+		b.addr = b
+	} else if b.addr != b {
+		panic("builder: illegal use of non-zero Builder copied by value")
+	}
+}
+
+// String returns the accumulated string.
+//
+// 不复制: string和[]byte的前两个字(数据指针和长度)布局相同, 直接把&b.buf
+// 当作*string读取. 之后的写入只会追加到len之后, 或者分配新的数组,
+// 已经返回的字符串看到的字节永远不会改变
+func (b *Builder) String() string {
+	return *(*string)(unsafe.Pointer(&b.buf))
+}
+
+// Len returns the number of accumulated bytes; b.Len() == len(b.String()).
+func (b *Builder) Len() int { return len(b.buf) }
+
+// Cap returns the capacity of the builder's underlying byte slice. It is the
+// total space allocated for the string being built and includes any bytes
+// already written.
+func (b *Builder) Cap() int { return cap(b.buf) }
+
+// Reset resets the Builder to be empty.
+//
+// 不能复用原来的数组: 之前返回的String()还在引用它. 所以和bytes.Buffer.Reset
+// 不同, 这里丢弃数组, 同时清空addr, 重置后的Builder可以被复制
+func (b *Builder) Reset() {
+	b.addr = nil
+	b.buf = nil
+}
+
+// grow copies the buffer to a new, larger buffer so that there are at least n
+// bytes of capacity beyond len(b.buf).
+func (b *Builder) grow(n int) {
+	buf := make([]byte, len(b.buf), 2*cap(b.buf)+n)
+	copy(buf, b.buf)
+	b.buf = buf
+}
+
+// Grow grows b's capacity, if necessary, to guarantee space for
+// another n bytes. After Grow(n), at least n bytes can be written to b
+// without another allocation. If n is negative, Grow panics.
+func (b *Builder) Grow(n int) {
+	b.copyCheck()
+	if n < 0 {
+		panic("builder.Builder.Grow: negative count")
+	}
+	if cap(b.buf)-len(b.buf) < n {
+		b.grow(n)
+	}
+}
+
+// Write appends the contents of p to b's buffer.
+// Write always returns len(p), nil.
+func (b *Builder) Write(p []byte) (int, error) {
+	b.copyCheck()
+	b.buf = append(b.buf, p...)
+	return len(p), nil
+}
+
+// WriteByte appends the byte c to b's buffer.
+// The returned error is always nil.
+func (b *Builder) WriteByte(c byte) error {
+	b.copyCheck()
+	b.buf = append(b.buf, c)
+	return nil
+}
+
+// WriteRune appends the UTF-8 encoding of Unicode code point r to b's buffer.
+// It returns the length of r and a nil error.
+func (b *Builder) WriteRune(r rune) (int, error) {
+	b.copyCheck()
+	// strings.Builder在这里写的是r < utf8.RuneSelf, 负数的r会被截断成一个
+	// 字节写入. 和bytes.Buffer一样比较uint32(r), 负数按无效码点写入U+FFFD
+	if uint32(r) < utf8.RuneSelf {
+		b.buf = append(b.buf, byte(r))
+		return 1, nil
+	}
+	// 直接编码到buf的空闲部分, 不经过临时数组
+	l := len(b.buf)
+	if cap(b.buf)-l < utf8.UTFMax {
+		b.grow(utf8.UTFMax)
+	}
+	n := utf8.EncodeRune(b.buf[l:l+utf8.UTFMax], r)
+	b.buf = b.buf[:l+n]
+	return n, nil
+}
+
+// WriteString appends the contents of s to b's buffer.
+// It returns the length of s and a nil error.
+func (b *Builder) WriteString(s string) (int, error) {
+	b.copyCheck()
+	b.buf = append(b.buf, s...)
+	return len(s), nil
+}
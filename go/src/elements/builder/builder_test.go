@@ -0,0 +1,92 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package builder_test
+
+import (
+	"bytes"
+	"elements/builder"
+	"testing"
+	"testing/quick"
+)
+
+func TestBuilderMatchesBuffer(t *testing.T) {
+	f := func(parts []string, runes []rune) bool {
+		var b builder.Builder
+		var want bytes.Buffer
+		for i, p := range parts {
+			b.WriteString(p)
+			want.WriteString(p)
+			if i < len(runes) {
+				b.WriteRune(runes[i])
+				want.WriteRune(runes[i])
+			}
+			b.WriteByte('|')
+			want.WriteByte('|')
+		}
+		return b.String() == want.String() && b.Len() == want.Len()
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBuilderStringIsStable(t *testing.T) {
+	var b builder.Builder
+	b.WriteString("alpha")
+	s := b.String()
+	for i := 0; i < 100; i++ {
+		b.WriteString("beta")
+	}
+	if s != "alpha" {
+		t.Errorf("earlier String changed to %q", s)
+	}
+	b.Reset()
+	b.WriteString("gamma")
+	if s != "alpha" {
+		t.Errorf("String changed after Reset to %q", s)
+	}
+}
+
+func TestBuilderGrow(t *testing.T) {
+	var b builder.Builder
+	b.Grow(100)
+	if b.Cap() < 100 {
+		t.Fatalf("Cap = %d after Grow(100)", b.Cap())
+	}
+	allocs := testing.AllocsPerRun(10, func() {
+		b.Reset()
+		b.Grow(100)
+		for i := 0; i < 10; i++ {
+			b.WriteString("0123456789")
+		}
+		_ = b.String()
+	})
+	if allocs != 1 {
+		t.Errorf("%v allocs filling a grown Builder, want 1", allocs)
+	}
+}
+
+func TestBuilderCopyPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("writing to a copied Builder did not panic")
+		}
+	}()
+	var a builder.Builder
+	a.WriteByte('x')
+	b := a
+	b.WriteByte('y')
+}
+
+func TestBuilderZeroCopyAllowed(t *testing.T) {
+	var a builder.Builder
+	b := a // copying before the first write is fine
+	b.WriteString("ok")
+	a.Reset()
+	a.WriteString("also ok")
+	c := a
+	c.Reset() // Reset clears the copy check
+	c.WriteString("fine")
+}
@@ -0,0 +1,37 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package builder_test
+
+import (
+	"elements/builder"
+	"fmt"
+	"sync"
+)
+
+func ExampleBuilder() {
+	var b builder.Builder
+	for i := 3; i > 0; i-- {
+		fmt.Fprintf(&b, "%d...", i)
+	}
+	b.WriteString("ignition")
+	fmt.Println(b.String())
+	// Output: 3...2...1...ignition
+}
+
+func ExampleShardedBuilder() {
+	b := builder.NewSharded(4)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			fmt.Fprintf(b, "worker %d done\n", i)
+		}(i)
+	}
+	wg.Wait()
+	// 各个worker的记录是完整的, 但顺序不确定
+	fmt.Println(b.Len())
+	// Output: 56
+}
@@ -0,0 +1,86 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package builder
+
+import "sync"
+
+// A SafeBuilder is a Builder that is safe for concurrent use.
+// Each call appends its argument as a unit: the bytes of concurrent
+// writes never interleave. The zero value is ready to use.
+// A SafeBuilder must not be copied after first use.
+//
+// String不需要复制: Builder只追加, 已经返回的字符串引用的字节之后不会再被写入
+type SafeBuilder struct {
+	mu sync.Mutex
+	b  Builder
+}
+
+// String returns the accumulated string.
+func (s *SafeBuilder) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.String()
+}
+
+// Len returns the number of accumulated bytes.
+func (s *SafeBuilder) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Len()
+}
+
+// Reset resets the builder to be empty.
+func (s *SafeBuilder) Reset() {
+	s.mu.Lock()
+	s.b.Reset()
+	s.mu.Unlock()
+}
+
+// Take returns the accumulated string and resets the builder, atomically.
+func (s *SafeBuilder) Take() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	str := s.b.String()
+	s.b.Reset()
+	return str
+}
+
+// Grow grows the builder's capacity, if necessary, to guarantee space for
+// another n bytes.
+func (s *SafeBuilder) Grow(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.b.Grow(n)
+}
+
+// Write appends the contents of p. It always returns len(p), nil.
+func (s *SafeBuilder) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.Write(p)
+}
+
+// WriteByte appends the byte c. The returned error is always nil.
+func (s *SafeBuilder) WriteByte(c byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.WriteByte(c)
+}
+
+// WriteRune appends the UTF-8 encoding of r.
+// It returns the length of r and a nil error.
+func (s *SafeBuilder) WriteRune(r rune) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.WriteRune(r)
+}
+
+// WriteString appends the contents of str.
+// It returns the length of str and a nil error.
+func (s *SafeBuilder) WriteString(str string) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.b.WriteString(str)
+}
@@ -0,0 +1,161 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package builder_test
+
+import (
+	"elements/builder"
+	"fmt"
+	"io"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	writers = 8
+	records = 500
+)
+
+// writeRecords has writers goroutines append records lines each to w.
+func writeRecords(w io.StringWriter) {
+	var wg sync.WaitGroup
+	for g := 0; g < writers; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < records; i++ {
+				w.WriteString(fmt.Sprintf("g%d-%04d\n", g, i))
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+// checkRecords checks that s holds every record exactly once, unbroken.
+func checkRecords(t *testing.T, s string) {
+	t.Helper()
+	lines := strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+	if len(lines) != writers*records {
+		t.Fatalf("got %d records, want %d", len(lines), writers*records)
+	}
+	sort.Strings(lines)
+	i := 0
+	for g := 0; g < writers; g++ {
+		for n := 0; n < records; n++ {
+			if want := fmt.Sprintf("g%d-%04d", g, n); lines[i] != want {
+				t.Fatalf("record %d = %q, want %q", i, lines[i], want)
+			}
+			i++
+		}
+	}
+}
+
+func TestSafeBuilder(t *testing.T) {
+	var b builder.SafeBuilder
+	writeRecords(&b)
+	checkRecords(t, b.String())
+	if b.Len() != len(b.String()) {
+		t.Errorf("Len = %d, len(String) = %d", b.Len(), len(b.String()))
+	}
+}
+
+func TestSafeBuilderTake(t *testing.T) {
+	var b builder.SafeBuilder
+	var got strings.Builder
+	done := make(chan bool)
+	go func() {
+		writeRecords(&b)
+		close(done)
+	}()
+	for {
+		select {
+		case <-done:
+			got.WriteString(b.Take())
+			checkRecords(t, got.String())
+			return
+		default:
+			got.WriteString(b.Take())
+			runtime.Gosched()
+		}
+	}
+}
+
+func TestShardedBuilder(t *testing.T) {
+	b := builder.NewSharded(4)
+	writeRecords(b)
+	checkRecords(t, b.String())
+	if b.Len() != writers*records*len("g0-0000\n") {
+		t.Errorf("Len = %d", b.Len())
+	}
+	checkRecords(t, b.Take())
+	if b.Len() != 0 || b.String() != "" {
+		t.Errorf("not empty after Take: %q", b.String())
+	}
+}
+
+func TestShardedWriterKeepsOrder(t *testing.T) {
+	b := builder.NewSharded(4)
+	var wg sync.WaitGroup
+	for g := 0; g < writers; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			w := b.Writer()
+			for i := 0; i < records; i++ {
+				fmt.Fprintf(w, "g%d-%04d\n", g, i)
+			}
+		}(g)
+	}
+	wg.Wait()
+	s := b.String()
+	checkRecords(t, s)
+	// 同一个Writer的记录在同一个分片中, 保持写入的顺序
+	last := make(map[string]string)
+	for _, line := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+		g := line[:strings.IndexByte(line, '-')]
+		if line < last[g] {
+			t.Fatalf("%q after %q", line, last[g])
+		}
+		last[g] = line
+	}
+}
+
+func BenchmarkParallelWrite(b *testing.B) {
+	const line = "2020/05/01 12:00:00 request served in 1.2ms\n"
+	run := func(b *testing.B, w io.StringWriter, reset func()) {
+		b.RunParallel(func(pb *testing.PB) {
+			n := 0
+			for pb.Next() {
+				w.WriteString(line)
+				if n++; n%(1<<14) == 0 {
+					reset()
+				}
+			}
+		})
+	}
+	b.Run("safe", func(b *testing.B) {
+		var sb builder.SafeBuilder
+		run(b, &sb, sb.Reset)
+	})
+	b.Run("sharded", func(b *testing.B) {
+		sb := builder.NewSharded(runtime.GOMAXPROCS(0))
+		run(b, sb, func() { sb.Take() })
+	})
+	b.Run("writer", func(b *testing.B) {
+		sb := builder.NewSharded(runtime.GOMAXPROCS(0))
+		b.RunParallel(func(pb *testing.PB) {
+			w := sb.Writer()
+			n := 0
+			for pb.Next() {
+				w.WriteString(line)
+				if n++; n%(1<<14) == 0 {
+					w.Reset()
+				}
+			}
+		})
+	})
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package builder
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+const cacheLinePad = 64
+
+// A ShardedBuilder collects records from many goroutines into several
+// SafeBuilders, so that concurrent writers rarely contend on a lock.
+// Each write is kept whole, but writes made to different shards are not
+// ordered with respect to each other: String and Take return the shards
+// one after another. Use it where order across goroutines does not
+// matter, as when assembling log lines that carry their own timestamps.
+//
+// A goroutine that writes many records should take a Writer, which keeps
+// all of its records in one shard and in order.
+type ShardedBuilder struct {
+	shards []builderShard
+	next   uint32 // round-robin shard choice, accessed atomically
+}
+
+type builderShard struct {
+	SafeBuilder
+
+	// Prevents false sharing between neighbouring shards.
+	pad [cacheLinePad - unsafe.Sizeof(SafeBuilder{})%cacheLinePad]byte
+}
+
+// NewSharded returns a ShardedBuilder with n shards, at least one.
+// A good n is GOMAXPROCS.
+func NewSharded(n int) *ShardedBuilder {
+	if n < 1 {
+		n = 1
+	}
+	return &ShardedBuilder{shards: make([]builderShard, n)}
+}
+
+// shard picks a shard for one write.
+//
+// 拿不到当前P的id, 就轮流选: 一次原子加法比争抢同一把锁便宜得多
+func (sb *ShardedBuilder) shard() *SafeBuilder {
+	n := atomic.AddUint32(&sb.next, 1)
+	return &sb.shards[n%uint32(len(sb.shards))].SafeBuilder
+}
+
+// Write appends p as one record. It always returns len(p), nil.
+func (sb *ShardedBuilder) Write(p []byte) (int, error) {
+	return sb.shard().Write(p)
+}
+
+// WriteString appends str as one record.
+// It returns the length of str and a nil error.
+func (sb *ShardedBuilder) WriteString(str string) (int, error) {
+	return sb.shard().WriteString(str)
+}
+
+// Writer returns a writer whose records all go to one shard, in order.
+func (sb *ShardedBuilder) Writer() *SafeBuilder {
+	return sb.shard()
+}
+
+// Len returns the number of accumulated bytes in all shards.
+func (sb *ShardedBuilder) Len() int {
+	n := 0
+	for i := range sb.shards {
+		n += sb.shards[i].Len()
+	}
+	return n
+}
+
+// String returns the contents of all shards, one after another.
+// It is not a snapshot: records written while String runs may or may
+// not be included.
+func (sb *ShardedBuilder) String() string {
+	return sb.collect(false)
+}
+
+// Take returns the contents of all shards and empties them. Each record
+// is returned by exactly one Take.
+func (sb *ShardedBuilder) Take() string {
+	return sb.collect(true)
+}
+
+func (sb *ShardedBuilder) collect(take bool) string {
+	parts := make([]string, len(sb.shards))
+	n := 0
+	for i := range sb.shards {
+		if take {
+			parts[i] = sb.shards[i].Take()
+		} else {
+			parts[i] = sb.shards[i].String()
+		}
+		n += len(parts[i])
+	}
+	var b Builder
+	b.Grow(n)
+	for _, p := range parts {
+		b.WriteString(p)
+	}
+	return b.String()
+}
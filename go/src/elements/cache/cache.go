@@ -0,0 +1,382 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package cache provides a read-through cache on top of sync.Map.
+//
+// A Cache calls its Loader for keys it does not hold, and concurrent
+// misses for the same key share one load: by default through a
+// singleflight.Group.
+package cache
+
+import (
+	"context"
+	"elements/clock"
+	"elements/diag"
+	"elements/intern"
+	"elements/retry"
+	"elements/singleflight"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A Loader loads the value for key when it is not in the cache.
+// Errors are returned to the callers waiting for the load and are not
+// cached.
+type Loader func(key string) (interface{}, error)
+
+// A Flight suppresses duplicate loads: concurrent calls to Do with the
+// same key run fn once and share its results. *singleflight.Group
+// implements Flight.
+type Flight interface {
+	Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool)
+	Forget(key string)
+}
+
+// Config configures a Cache.
+type Config struct {
+	// Load loads missing values. It must not be nil.
+	Load Loader
+
+	// TTL is how long a loaded or set value stays in the cache.
+	// Zero means values never expire. Expired values are removed at most
+	// once per TTL, by the Set or the load that comes next, whether or
+	// not their keys are read again.
+	TTL time.Duration
+
+	// Flight deduplicates concurrent loads of the same key.
+	// If nil, the Cache uses its own singleflight.Group.
+	Flight Flight
+
+	// StaleWhileRevalidate is how long after expiring a value may still
+	// be returned by Get, while it is reloaded in the background. Zero
+	// means expired values are never returned. It has no effect without
+	// a TTL. A value is removed from the cache only once this window has
+	// passed too.
+	StaleWhileRevalidate time.Duration
+
+	// MaxRefreshes limits how many background reloads run at once. When
+	// the limit is reached, Gets of stale values return them without
+	// starting a reload; a later Get will. Zero means no limit.
+	MaxRefreshes int
+
+	// Intern, if not nil, interns the keys the Cache stores, so that a
+	// key held by many caches, or set over and over from freshly decoded
+	// strings, is kept once.
+	Intern *intern.Interner
+
+	// Retry, if not nil, retries the loads that fail under its Policy.
+	// With a Breaker in the Policy, loads fail fast with retry.ErrOpen
+	// while the Breaker is open, instead of piling up on a Loader that
+	// is down. Stats count a retried load as one load.
+	Retry *retry.Policy
+
+	// Clock, if not nil, is the clock the TTLs are measured on, and the
+	// scans of a Refresher run on. Otherwise it is clock.Real.
+	Clock clock.Clock
+}
+
+// A Cache is a read-through cache. It is safe for concurrent use.
+//
+// 读不加锁, 全部由sync.Map完成. mu只保护"一次load的结果能不能写入":
+// load进行期间key被Set或者Delete的话, load拿到的是旧值, 不能覆盖新的状态.
+// gen是整个Cache共用的, 别的key被修改也会让这次load的结果不被缓存,
+// 代价只是之后多一次load, 换来不需要按key记录版本
+type Cache struct {
+	load   Loader
+	ttl    time.Duration
+	clock  clock.Clock
+	flight Flight
+	intern *intern.Interner
+
+	stale      time.Duration
+	refreshSem chan struct{} // nil means no limit
+	refreshing sync.Map      // string -> struct{}, keys with a background reload
+
+	m sync.Map // string -> *entry
+
+	mu  sync.Mutex
+	gen uint64 // incremented by each Set and Delete; written with mu held, read atomically
+
+	sweepAt int64 // UnixNano of the next sweep; accessed atomically
+
+	hits, misses, loads, shared uint64 // accessed atomically
+	staleHits, refreshes        uint64 // accessed atomically
+
+	reg *diag.Registration // set by NewNamed
+}
+
+type entry struct {
+	v       interface{}
+	expires int64  // UnixNano; 0 means never
+	used    uint32 // set by the first Get that returns v, for a Refresher; accessed atomically
+}
+
+// Stats holds counters describing a Cache's activity.
+type Stats struct {
+	Hits   uint64 // Get calls answered from the cache
+	Misses uint64 // Get calls that had to wait for a load
+	Loads  uint64 // calls to the Loader
+	Shared uint64 // misses that were answered by another caller's load
+
+	Stale     uint64 // Get calls answered with an expired value
+	Refreshes uint64 // background reloads of expired values started
+}
+
+// New returns a Cache configured by cfg.
+func New(cfg Config) *Cache {
+	if cfg.Load == nil {
+		panic("cache: New with nil Load")
+	}
+	c := &Cache{load: cfg.Load, ttl: cfg.TTL, clock: clock.Or(cfg.Clock), flight: cfg.Flight, intern: cfg.Intern}
+	if cfg.Retry != nil {
+		c.load = retryLoader(cfg.Load, *cfg.Retry)
+	}
+	if c.flight == nil {
+		c.flight = new(singleflight.Group)
+	}
+	if cfg.TTL > 0 {
+		c.stale = cfg.StaleWhileRevalidate
+		c.sweepAt = c.clock.Now().Add(cfg.TTL).UnixNano()
+	}
+	if cfg.MaxRefreshes > 0 {
+		c.refreshSem = make(chan struct{}, cfg.MaxRefreshes)
+	}
+	return c
+}
+
+// NewNamed returns a Cache configured by cfg, as New does, and registers
+// it in package diag as a "cache.Cache" named name, with its Stats. Call
+// Close once the Cache is no longer used.
+func NewNamed(name string, cfg Config) *Cache {
+	c := New(cfg)
+	c.reg = diag.Register("cache.Cache", name, func() interface{} { return c.Stats() })
+	return c
+}
+
+// Close removes a Cache made by NewNamed from package diag, which
+// otherwise holds on to it. The Cache owns no goroutine: it remains
+// usable, and Close of a Cache made by New does nothing.
+func (c *Cache) Close() {
+	c.reg.Unregister()
+}
+
+// retryLoader returns a Loader that calls load under p. A Loader has no
+// context: the retries stop at p.MaxAttempts, or at the Budget or the
+// Breaker of p.
+func retryLoader(load Loader, p retry.Policy) Loader {
+	return func(key string) (interface{}, error) {
+		var v interface{}
+		err := retry.Do(context.Background(), p, func(context.Context) (err error) {
+			v, err = load(key)
+			return err
+		})
+		return v, err
+	}
+}
+
+func (c *Cache) lookup(key string) (*entry, bool) {
+	v, ok := c.m.Load(key)
+	if !ok {
+		return nil, false
+	}
+	e := v.(*entry)
+	if e.expires != 0 && c.clock.Now().UnixNano() >= e.expires {
+		return nil, false
+	}
+	return e, true
+}
+
+func (c *Cache) newEntry(v interface{}) *entry {
+	e := &entry{v: v}
+	if c.ttl > 0 {
+		e.expires = c.clock.Now().Add(c.ttl).UnixNano()
+	}
+	return e
+}
+
+// Get returns the value for key, loading it if the cache does not hold
+// it or it has expired.
+//
+// With StaleWhileRevalidate set, a value that expired less than that
+// long ago is returned at once, and reloaded in the background.
+func (c *Cache) Get(key string) (interface{}, error) {
+	if e, ok := c.lookup(key); ok {
+		atomic.AddUint64(&c.hits, 1)
+		// 已经置位就不再写, 热点key的Get只读这个entry
+		if atomic.LoadUint32(&e.used) == 0 {
+			atomic.StoreUint32(&e.used, 1)
+		}
+		return e.v, nil
+	}
+	if e, ok := c.lookupStale(key); ok {
+		atomic.AddUint64(&c.staleHits, 1)
+		c.refresh(key)
+		return e.v, nil
+	}
+	atomic.AddUint64(&c.misses, 1)
+
+	v, err, shared := c.flight.Do(key, func() (interface{}, error) {
+		return c.loadAndStore(key)
+	})
+	if shared {
+		atomic.AddUint64(&c.shared, 1)
+	}
+	return v, err
+}
+
+// loadAndStore loads key and caches the value, unless a Set or Delete
+// happens meanwhile. It runs inside the Flight.
+func (c *Cache) loadAndStore(key string) (interface{}, error) {
+	// 再查一次: 上一次load可能在我们的lookup之后, Do之前刚刚完成.
+	// 它的Do已经结束, 我们开始的是新的一次
+	if e, ok := c.lookup(key); ok {
+		return e.v, nil
+	}
+	gen := atomic.LoadUint64(&c.gen)
+	atomic.AddUint64(&c.loads, 1)
+	v, err := c.load(key)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if atomic.LoadUint64(&c.gen) == gen {
+		c.m.Store(c.internKey(key), c.newEntry(v))
+	}
+	c.mu.Unlock()
+	c.sweep()
+	return v, nil
+}
+
+// dead reports whether e can no longer be returned at now, not even as a
+// stale value.
+func (c *Cache) dead(e *entry, now int64) bool {
+	return e.expires != 0 && now >= e.expires+int64(c.stale)
+}
+
+// sweep removes the dead entries, if a TTL has passed since the last
+// sweep. It is called after each store, so that the entries of keys that
+// are not read again do not stay in the cache for good.
+func (c *Cache) sweep() {
+	if c.ttl <= 0 {
+		return
+	}
+	now := c.clock.Now().UnixNano()
+	at := atomic.LoadInt64(&c.sweepAt)
+	// 每个TTL只有一个调用者扫描, 其他的直接返回
+	if now < at || !atomic.CompareAndSwapInt64(&c.sweepAt, at, now+int64(c.ttl)) {
+		return
+	}
+	c.m.Range(func(k, v interface{}) bool {
+		if e := v.(*entry); c.dead(e, now) {
+			c.mu.Lock()
+			// Set或者load可能刚刚换上了新的entry, 只删除扫描看到的这个
+			if v, ok := c.m.Load(k); ok && v == e {
+				c.m.Delete(k)
+			}
+			c.mu.Unlock()
+		}
+		return true
+	})
+}
+
+// lookupStale returns key's entry if it has expired, but less than
+// StaleWhileRevalidate ago.
+func (c *Cache) lookupStale(key string) (*entry, bool) {
+	if c.stale <= 0 {
+		return nil, false
+	}
+	v, ok := c.m.Load(key)
+	if !ok {
+		return nil, false
+	}
+	e := v.(*entry)
+	if e.expires == 0 || c.dead(e, c.clock.Now().UnixNano()) {
+		return nil, false
+	}
+	return e, true
+}
+
+// refresh starts a background reload of key, unless one is running or
+// MaxRefreshes are.
+func (c *Cache) refresh(key string) {
+	// 一个过期的热key每秒被Get几千次, 每次都启动一个goroutine去Do的话,
+	// Do会合并它们, 但goroutine和MaxRefreshes的名额都浪费了
+	if _, running := c.refreshing.LoadOrStore(key, struct{}{}); running {
+		return
+	}
+	if c.refreshSem != nil {
+		select {
+		case c.refreshSem <- struct{}{}:
+		default:
+			c.refreshing.Delete(key)
+			return
+		}
+	}
+	atomic.AddUint64(&c.refreshes, 1)
+	go func() {
+		defer func() {
+			if c.refreshSem != nil {
+				<-c.refreshSem
+			}
+			c.refreshing.Delete(key)
+		}()
+		// 失败的话旧值留在缓存中, 直到过了StaleWhileRevalidate; 之后的Get会再试
+		c.flight.Do(key, func() (interface{}, error) {
+			return c.loadAndStore(key)
+		})
+	}()
+}
+
+// internKey returns the key to store for key.
+func (c *Cache) internKey(key string) string {
+	if c.intern == nil {
+		return key
+	}
+	return c.intern.Intern(key)
+}
+
+// Peek returns the value for key if the cache holds it, without loading.
+func (c *Cache) Peek(key string) (interface{}, bool) {
+	e, ok := c.lookup(key)
+	if !ok {
+		return nil, false
+	}
+	return e.v, true
+}
+
+// Set stores v for key, replacing any cached value. A load of key that
+// is in flight when Set is called does not overwrite v.
+func (c *Cache) Set(key string, v interface{}) {
+	c.mu.Lock()
+	atomic.AddUint64(&c.gen, 1)
+	c.m.Store(c.internKey(key), c.newEntry(v))
+	c.mu.Unlock()
+	c.sweep()
+	// 之后的Get如果没命中(比如v过期了), 不能再加入Set之前开始的那次load
+	c.flight.Forget(key)
+}
+
+// Delete removes key from the cache. A load of key that is in flight
+// when Delete is called does not store its result.
+func (c *Cache) Delete(key string) {
+	c.mu.Lock()
+	atomic.AddUint64(&c.gen, 1)
+	c.m.Delete(key)
+	c.mu.Unlock()
+	c.flight.Forget(key)
+}
+
+// Stats returns the cache's counters.
+func (c *Cache) Stats() Stats {
+	return Stats{
+		Hits:   atomic.LoadUint64(&c.hits),
+		Misses: atomic.LoadUint64(&c.misses),
+		Loads:  atomic.LoadUint64(&c.loads),
+		Shared: atomic.LoadUint64(&c.shared),
+
+		Stale:     atomic.LoadUint64(&c.staleHits),
+		Refreshes: atomic.LoadUint64(&c.refreshes),
+	}
+}
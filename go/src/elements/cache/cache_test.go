@@ -0,0 +1,492 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache_test
+
+import (
+	"elements/cache"
+	"elements/clock"
+	"elements/diag"
+	"elements/intern"
+	"elements/retry"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestReadThrough(t *testing.T) {
+	var loads int32
+	c := cache.New(cache.Config{Load: func(key string) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		return "v:" + key, nil
+	}})
+	for i := 0; i < 3; i++ {
+		v, err := c.Get("a")
+		if err != nil || v != "v:a" {
+			t.Fatalf("Get = %v, %v", v, err)
+		}
+	}
+	if loads != 1 {
+		t.Errorf("%d loads, want 1", loads)
+	}
+	if st := c.Stats(); st.Hits != 2 || st.Misses != 1 || st.Loads != 1 {
+		t.Errorf("Stats = %+v", st)
+	}
+	if _, ok := c.Peek("b"); ok {
+		t.Error("Peek loaded a missing key")
+	}
+}
+
+func TestConcurrentMissesShareLoad(t *testing.T) {
+	release := make(chan struct{})
+	var loads int32
+	c := cache.New(cache.Config{Load: func(key string) (interface{}, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		return 42, nil
+	}})
+	const n = 50
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := c.Get("k"); err != nil || v != 42 {
+				t.Errorf("Get = %v, %v", v, err)
+			}
+		}()
+	}
+	// 等所有Get都进入Do再放行
+	for c.Stats().Misses != n {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if loads != 1 {
+		t.Errorf("%d loads for %d concurrent misses, want 1", loads, n)
+	}
+	if st := c.Stats(); st.Shared != n {
+		t.Errorf("Shared = %d, want %d", st.Shared, n)
+	}
+}
+
+func TestErrorsNotCached(t *testing.T) {
+	errDown := errors.New("backend down")
+	fail := true
+	c := cache.New(cache.Config{Load: func(key string) (interface{}, error) {
+		if fail {
+			return nil, errDown
+		}
+		return "ok", nil
+	}})
+	if _, err := c.Get("k"); err != errDown {
+		t.Fatalf("Get error = %v, want %v", err, errDown)
+	}
+	fail = false
+	if v, err := c.Get("k"); err != nil || v != "ok" {
+		t.Fatalf("Get = %v, %v after the backend recovered", v, err)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	var loads int32
+	c := cache.New(cache.Config{
+		TTL: 20 * time.Millisecond,
+		Load: func(key string) (interface{}, error) {
+			return atomic.AddInt32(&loads, 1), nil
+		},
+	})
+	c.Get("k")
+	if v, _ := c.Get("k"); v != int32(1) {
+		t.Fatalf("Get = %v before expiry, want 1", v)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := c.Peek("k"); ok {
+		t.Error("Peek returned an expired value")
+	}
+	if v, _ := c.Get("k"); v != int32(2) {
+		t.Fatalf("Get = %v after expiry, want 2", v)
+	}
+}
+
+// TestTTLSweep checks that expired values are removed even if their keys
+// are not read again.
+func TestTTLSweep(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	c := cache.New(cache.Config{
+		TTL:   time.Minute,
+		Clock: clk,
+		Load: func(key string) (interface{}, error) {
+			return key, nil
+		},
+	})
+	for _, k := range []string{"a", "b", "c"} {
+		c.Get(k)
+	}
+	clk.Advance(30 * time.Second)
+	c.Set("d", "d")
+	if n := cache.Len(c); n != 4 {
+		t.Fatalf("Len = %d before expiry, want 4", n)
+	}
+	// a, b, c过期了, d还没有
+	clk.Advance(45 * time.Second)
+	c.Set("e", "e")
+	if n := cache.Len(c); n != 2 {
+		t.Errorf("Len = %d after a sweep, want 2", n)
+	}
+	if _, ok := c.Peek("d"); !ok {
+		t.Error("the sweep removed a value that has not expired")
+	}
+}
+
+// TestDeleteDuringLoad checks that a load that started before Delete does
+// not put its stale result back into the cache.
+func TestDeleteDuringLoad(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var loads int32
+	c := cache.New(cache.Config{Load: func(key string) (interface{}, error) {
+		if atomic.AddInt32(&loads, 1) == 1 {
+			close(started)
+			<-release
+			return "stale", nil
+		}
+		return "fresh", nil
+	}})
+	done := make(chan interface{})
+	go func() {
+		v, _ := c.Get("k")
+		done <- v
+	}()
+	<-started
+	c.Delete("k")
+	// Delete调用了Forget, 这次Get不会等那次旧的load
+	if v, _ := c.Get("k"); v != "fresh" {
+		t.Errorf("Get after Delete = %v, want fresh", v)
+	}
+	close(release)
+	if v := <-done; v != "stale" {
+		t.Errorf("in-flight Get = %v, want stale", v)
+	}
+	if v, _ := c.Peek("k"); v != "fresh" {
+		t.Errorf("cached %v, want fresh", v)
+	}
+}
+
+func TestSetDuringLoad(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	c := cache.New(cache.Config{Load: func(key string) (interface{}, error) {
+		close(started)
+		<-release
+		return "loaded", nil
+	}})
+	done := make(chan struct{})
+	go func() {
+		c.Get("k")
+		close(done)
+	}()
+	<-started
+	c.Set("k", "set")
+	close(release)
+	<-done
+	if v, _ := c.Peek("k"); v != "set" {
+		t.Errorf("cached %v, want the value from Set", v)
+	}
+}
+
+type countingFlight struct {
+	calls int32
+	cache.Flight
+}
+
+func (f *countingFlight) Do(key string, fn func() (interface{}, error)) (interface{}, error, bool) {
+	atomic.AddInt32(&f.calls, 1)
+	return f.Flight.Do(key, fn)
+}
+
+func TestCustomFlight(t *testing.T) {
+	var inner noFlight
+	f := &countingFlight{Flight: inner}
+	c := cache.New(cache.Config{
+		Flight: f,
+		Load:   func(key string) (interface{}, error) { return key, nil },
+	})
+	c.Get("a")
+	c.Get("a")
+	c.Get("b")
+	if f.calls != 2 {
+		t.Errorf("Flight.Do called %d times, want 2", f.calls)
+	}
+}
+
+// noFlight runs every call, without deduplication.
+type noFlight struct{}
+
+func (noFlight) Do(key string, fn func() (interface{}, error)) (interface{}, error, bool) {
+	v, err := fn()
+	return v, err, false
+}
+
+func (noFlight) Forget(key string) {}
+
+func BenchmarkGetHit(b *testing.B) {
+	c := cache.New(cache.Config{Load: func(key string) (interface{}, error) { return key, nil }})
+	c.Get("k")
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			c.Get("k")
+		}
+	})
+}
+
+// 过期不久的值立即返回, 同时在后台重新加载; 重新加载完成后返回新值
+func TestStaleWhileRevalidate(t *testing.T) {
+	var loads int32
+	release := make(chan struct{}, 10)
+	c := cache.New(cache.Config{
+		TTL:                  20 * time.Millisecond,
+		StaleWhileRevalidate: time.Hour,
+		Load: func(key string) (interface{}, error) {
+			n := atomic.AddInt32(&loads, 1)
+			if n > 1 {
+				<-release
+			}
+			return n, nil
+		},
+	})
+	if v, _ := c.Get("a"); v != int32(1) {
+		t.Fatalf("Get = %v, want 1", v)
+	}
+	time.Sleep(30 * time.Millisecond)
+	// 后台的load被挡住, 这期间所有Get都立即拿到旧值, 只启动一次load
+	for i := 0; i < 10; i++ {
+		if v, err := c.Get("a"); v != int32(1) || err != nil {
+			t.Fatalf("stale Get = %v, %v; want 1", v, err)
+		}
+	}
+	release <- struct{}{}
+	waitFor(t, func() bool {
+		v, _ := c.Peek("a")
+		return v == int32(2)
+	})
+	if st := c.Stats(); st.Stale != 10 || st.Refreshes != 1 || st.Loads != 2 || st.Misses != 1 {
+		t.Errorf("Stats = %+v", st)
+	}
+}
+
+// 超过了StaleWhileRevalidate的值不再返回, Get等待新的load
+func TestStaleWindowEnds(t *testing.T) {
+	var loads int32
+	c := cache.New(cache.Config{
+		TTL:                  10 * time.Millisecond,
+		StaleWhileRevalidate: 10 * time.Millisecond,
+		Load: func(key string) (interface{}, error) {
+			return atomic.AddInt32(&loads, 1), nil
+		},
+	})
+	c.Get("a")
+	time.Sleep(30 * time.Millisecond)
+	if v, _ := c.Get("a"); v != int32(2) {
+		t.Errorf("Get after the stale window = %v, want a fresh 2", v)
+	}
+	if st := c.Stats(); st.Stale != 0 || st.Misses != 2 {
+		t.Errorf("Stats = %+v", st)
+	}
+}
+
+// 过期的值在StaleWhileRevalidate期间不被清除, 之后才被清除
+func TestStaleSweep(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	c := cache.New(cache.Config{
+		TTL:                  time.Minute,
+		StaleWhileRevalidate: time.Hour,
+		Clock:                clk,
+		Load: func(key string) (interface{}, error) {
+			return key, nil
+		},
+	})
+	c.Get("a")
+	clk.Advance(2 * time.Minute)
+	c.Set("b", "b")
+	if n := cache.Len(c); n != 2 {
+		t.Fatalf("Len = %d in the stale window, want 2", n)
+	}
+	clk.Advance(time.Hour)
+	c.Set("b", "b")
+	if n := cache.Len(c); n != 1 {
+		t.Errorf("Len = %d after the stale window, want 1", n)
+	}
+}
+
+// 后台load失败时旧值留在缓存中, 之后的Get再试
+func TestStaleRefreshError(t *testing.T) {
+	var loads int32
+	c := cache.New(cache.Config{
+		TTL:                  10 * time.Millisecond,
+		StaleWhileRevalidate: time.Hour,
+		Load: func(key string) (interface{}, error) {
+			if atomic.AddInt32(&loads, 1) == 2 {
+				return nil, errors.New("unavailable")
+			}
+			return atomic.LoadInt32(&loads), nil
+		},
+	})
+	c.Get("a")
+	time.Sleep(20 * time.Millisecond)
+	if v, err := c.Get("a"); v != int32(1) || err != nil {
+		t.Fatalf("stale Get = %v, %v", v, err)
+	}
+	waitFor(t, func() bool { return atomic.LoadInt32(&loads) == 2 && c.Stats().Refreshes == 1 })
+	waitFor(t, func() bool {
+		v, err := c.Get("a")
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v == int32(3)
+	})
+}
+
+// MaxRefreshes个后台load在进行时, 别的过期key只返回旧值, 不启动新的load
+func TestMaxRefreshes(t *testing.T) {
+	block := make(chan struct{})
+	var fresh int32 = 1
+	c := cache.New(cache.Config{
+		TTL:                  10 * time.Millisecond,
+		StaleWhileRevalidate: time.Hour,
+		MaxRefreshes:         1,
+		Load: func(key string) (interface{}, error) {
+			if atomic.LoadInt32(&fresh) == 0 {
+				<-block
+			}
+			return key, nil
+		},
+	})
+	c.Get("a")
+	c.Get("b")
+	atomic.StoreInt32(&fresh, 0)
+	time.Sleep(20 * time.Millisecond)
+	c.Get("a") // 占用唯一的名额
+	c.Get("b")
+	if st := c.Stats(); st.Refreshes != 1 || st.Stale != 2 {
+		t.Errorf("Stats = %+v, want one refresh of two stale Gets", st)
+	}
+	close(block)
+	waitFor(t, func() bool {
+		v, _ := c.Peek("a")
+		return v == "a"
+	})
+	// 名额释放后, b的下一次Get启动它的load
+	waitFor(t, func() bool {
+		c.Get("b")
+		return c.Stats().Refreshes == 2
+	})
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+	}
+}
+
+func TestInternKeys(t *testing.T) {
+	var in intern.Interner
+	c := cache.New(cache.Config{
+		Load:   func(key string) (interface{}, error) { return key, nil },
+		Intern: &in,
+	})
+	s := cache.NewSessionMap(cache.SessionConfig{IdleTimeout: time.Minute, Intern: &in})
+	defer s.Close()
+	for i := 0; i < 10; i++ {
+		key := string([]byte("user:1")) // 每次都是新的字符串
+		c.Set(key, i)
+		s.Store(key, i)
+	}
+	c.Get("user:2") // 加载的key也保存一份
+	if st := in.Stats(); st.Len != 2 || st.Misses != 2 || st.Hits != 19 {
+		t.Errorf("Interner Stats = %+v, want 2 keys kept, 19 hits", st)
+	}
+	if v, _ := c.Get("user:1"); v != 9 {
+		t.Errorf("Get(user:1) = %v, want 9", v)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	var calls int32
+	c := cache.New(cache.Config{
+		Load: func(key string) (interface{}, error) {
+			if atomic.AddInt32(&calls, 1) < 3 {
+				return nil, errors.New("flaky")
+			}
+			return "v", nil
+		},
+		Retry: &retry.Policy{Initial: time.Millisecond},
+	})
+	if v, err := c.Get("k"); v != "v" || err != nil {
+		t.Fatalf("Get = %v, %v; want v, nil", v, err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 3 {
+		t.Fatalf("%d calls of the Loader; want 3", n)
+	}
+	if s := c.Stats(); s.Loads != 1 {
+		t.Fatalf("Stats.Loads = %d; want 1", s.Loads)
+	}
+}
+
+func TestRetryBreaker(t *testing.T) {
+	errDown := errors.New("down")
+	var calls int32
+	c := cache.New(cache.Config{
+		Load: func(key string) (interface{}, error) {
+			atomic.AddInt32(&calls, 1)
+			return nil, errDown
+		},
+		Retry: &retry.Policy{
+			MaxAttempts: 1,
+			Breaker:     retry.NewBreaker(retry.BreakerConfig{Failures: 2, Cooldown: time.Hour}),
+		},
+	})
+	for i := 0; i < 2; i++ {
+		if _, err := c.Get("k"); err != errDown {
+			t.Fatalf("Get = %v; want %v", err, errDown)
+		}
+	}
+	if _, err := c.Get("k"); err != retry.ErrOpen {
+		t.Fatalf("Get with the Breaker open = %v; want %v", err, retry.ErrOpen)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Fatalf("%d calls of the Loader; want 2", n)
+	}
+}
+
+func TestNamedClose(t *testing.T) {
+	listed := func() bool {
+		for _, in := range diag.Instances() {
+			if in.Kind == "cache.Cache" && in.Name == "test/closed" {
+				return true
+			}
+		}
+		return false
+	}
+	c := cache.NewNamed("test/closed", cache.Config{Load: func(key string) (interface{}, error) {
+		return key, nil
+	}})
+	if !listed() {
+		t.Fatal("NewNamed did not register the cache")
+	}
+	c.Close()
+	if listed() {
+		t.Error("the cache is still listed after Close")
+	}
+	if v, err := c.Get("k"); err != nil || v != "k" {
+		t.Errorf("Get after Close = %v, %v", v, err)
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache_test
+
+import (
+	"elements/cache"
+	"fmt"
+	"sync"
+	"time"
+)
+
+func Example() {
+	var mu sync.Mutex
+	queries := 0
+	users := cache.New(cache.Config{
+		TTL: time.Minute,
+		Load: func(id string) (interface{}, error) {
+			mu.Lock()
+			queries++
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond) // a slow database query
+			return "user " + id, nil
+		},
+	})
+
+	// 100个请求同时查询同一个用户, 数据库只被查询一次
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			users.Get("42")
+		}()
+	}
+	wg.Wait()
+	v, _ := users.Get("42")
+	fmt.Println(v, queries)
+	// Output: user 42 1
+}
+
+func ExampleExpiringSet() {
+	// 重试的请求在10分钟内带着同一个ID再来, 只处理一次
+	seen := cache.NewExpiringSet(time.Second)
+	for _, id := range []string{"req-1", "req-2", "req-1"} {
+		if !seen.AddIfAbsent(id, 10*time.Minute) {
+			fmt.Println(id, "duplicate")
+			continue
+		}
+		fmt.Println(id, "handled")
+	}
+	// Output:
+	// req-1 handled
+	// req-2 handled
+	// req-1 duplicate
+}
+
+func ExampleSessionMap() {
+	closed := make(chan string)
+	conns := cache.NewSessionMap(cache.SessionConfig{
+		IdleTimeout: 50 * time.Millisecond,
+		OnIdleExpire: func(id string, v interface{}) {
+			closed <- id
+		},
+	})
+	defer conns.Close()
+	conns.Store("conn-1", "10.0.0.1:5000")
+	conns.Store("conn-2", "10.0.0.2:5000")
+
+	// conn-1一直有流量, conn-2没有
+	for i := 0; i < 5; i++ {
+		conns.Load("conn-1")
+		time.Sleep(20 * time.Millisecond)
+	}
+	fmt.Println("idle:", <-closed)
+	fmt.Println("live:", conns.Len())
+	// Output:
+	// idle: conn-2
+	// live: 1
+}
@@ -0,0 +1,165 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"elements/heap"
+	"sync"
+	"time"
+)
+
+// expiringShards is the number of independently locked parts of an
+// ExpiringSet.
+const expiringShards = 16
+
+// An ExpiringSet remembers keys for a limited time. It answers "have I
+// seen this ID in the last N minutes", the question behind deduplicating
+// retried requests and redelivered messages. It is safe for concurrent
+// use.
+//
+// Expired keys are removed in bulk: each key is filed in a bucket
+// covering Granularity of expiry times, and a bucket whose time has
+// passed is dropped with all its keys, by whichever call comes next.
+// Each key is filed and removed once, so the cleanup costs O(1) per
+// added key however bursty the load, with no timer or goroutine per key.
+// A key is absent from the moment it expires, even before its bucket is
+// dropped; Granularity only bounds how long its memory is held after
+// that.
+type ExpiringSet struct {
+	gran   int64
+	shards [expiringShards]expiringShard
+}
+
+type expiringShard struct {
+	mu      sync.Mutex
+	keys    map[string]int64 // key -> expiry, UnixNano
+	buckets map[int64]*expiryBucket
+	order   bucketHeap // buckets by index, earliest first
+}
+
+type expiryBucket struct {
+	index int64 // the bucket covers expiries in ((index-1)*gran, index*gran]
+	keys  []expiringKey
+}
+
+type expiringKey struct {
+	key     string
+	expires int64
+}
+
+type bucketHeap []*expiryBucket
+
+func (h bucketHeap) Len() int            { return len(h) }
+func (h bucketHeap) Less(i, j int) bool  { return h[i].index < h[j].index }
+func (h bucketHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *bucketHeap) Push(x interface{}) { *h = append(*h, x.(*expiryBucket)) }
+
+func (h *bucketHeap) Pop() interface{} {
+	old := *h
+	b := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return b
+}
+
+// NewExpiringSet returns an empty ExpiringSet whose expiry buckets span
+// granularity. Zero means one second.
+func NewExpiringSet(granularity time.Duration) *ExpiringSet {
+	if granularity <= 0 {
+		granularity = time.Second
+	}
+	s := &ExpiringSet{gran: int64(granularity)}
+	for i := range s.shards {
+		s.shards[i].keys = make(map[string]int64)
+		s.shards[i].buckets = make(map[int64]*expiryBucket)
+	}
+	return s
+}
+
+func (s *ExpiringSet) shard(key string) *expiringShard {
+	// FNV-1a
+	h := uint32(2166136261)
+	for i := 0; i < len(key); i++ {
+		h ^= uint32(key[i])
+		h *= 16777619
+	}
+	return &s.shards[h%expiringShards]
+}
+
+// AddIfAbsent adds key for ttl and reports true, unless key is already
+// present, in which case it leaves key's expiry unchanged and reports
+// false.
+func (s *ExpiringSet) AddIfAbsent(key string, ttl time.Duration) bool {
+	now := time.Now().UnixNano()
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	sh.sweep(now, s.gran)
+	if exp, ok := sh.keys[key]; ok && now < exp {
+		return false
+	}
+	exp := now + int64(ttl)
+	sh.keys[key] = exp
+	// 向上取整: 桶的时间过了, 其中所有key都已经过期
+	index := (exp + s.gran - 1) / s.gran
+	b := sh.buckets[index]
+	if b == nil {
+		b = &expiryBucket{index: index}
+		sh.buckets[index] = b
+		heap.Push(&sh.order, b)
+	}
+	b.keys = append(b.keys, expiringKey{key, exp})
+	return true
+}
+
+// Contains reports whether key is present.
+func (s *ExpiringSet) Contains(key string) bool {
+	now := time.Now().UnixNano()
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	sh.sweep(now, s.gran)
+	exp, ok := sh.keys[key]
+	return ok && now < exp
+}
+
+// Remove removes key, so that the next AddIfAbsent adds it again.
+func (s *ExpiringSet) Remove(key string) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	// 桶中的记录留着, 删除时发现expiry对不上就跳过
+	delete(sh.keys, key)
+	sh.mu.Unlock()
+}
+
+// Len returns the number of keys held. It drops the buckets whose time
+// has passed first, but may still count keys that expired within the
+// last Granularity.
+func (s *ExpiringSet) Len() int {
+	now := time.Now().UnixNano()
+	n := 0
+	for i := range s.shards {
+		sh := &s.shards[i]
+		sh.mu.Lock()
+		sh.sweep(now, s.gran)
+		n += len(sh.keys)
+		sh.mu.Unlock()
+	}
+	return n
+}
+
+// sweep drops the buckets whose time has passed.
+func (sh *expiringShard) sweep(now, gran int64) {
+	for len(sh.order) > 0 && sh.order[0].index*gran <= now {
+		b := heap.Pop(&sh.order).(*expiryBucket)
+		delete(sh.buckets, b.index)
+		for _, k := range b.keys {
+			// 重新加入或者Remove过的key, 记录的是另一个expiry, 不属于这个桶
+			if exp, ok := sh.keys[k.key]; ok && exp == k.expires {
+				delete(sh.keys, k.key)
+			}
+		}
+	}
+}
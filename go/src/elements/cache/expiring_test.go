@@ -0,0 +1,95 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache_test
+
+import (
+	"elements/cache"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestExpiringSet(t *testing.T) {
+	s := cache.NewExpiringSet(10 * time.Millisecond)
+	if !s.AddIfAbsent("a", time.Hour) || s.AddIfAbsent("a", time.Hour) {
+		t.Fatal("AddIfAbsent should add once")
+	}
+	if !s.Contains("a") || s.Contains("b") {
+		t.Fatal("Contains")
+	}
+	s.Remove("a")
+	if s.Contains("a") || !s.AddIfAbsent("a", time.Hour) {
+		t.Fatal("Remove")
+	}
+}
+
+func TestExpiringSetExpires(t *testing.T) {
+	// 粒度比TTL大得多: 桶还没到期, key已经不在了
+	s := cache.NewExpiringSet(time.Hour)
+	s.AddIfAbsent("a", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	if s.Contains("a") {
+		t.Fatal("key present after its ttl")
+	}
+	if !s.AddIfAbsent("a", time.Hour) {
+		t.Fatal("expired key not added again")
+	}
+	// 旧的记录和新的在同一个桶中, 新的expiry不受旧记录影响
+	if !s.Contains("a") {
+		t.Fatal("re-added key missing")
+	}
+}
+
+// 旧的桶到期时, 重新加入的key不会被它在旧桶中的记录删掉
+func TestExpiringSetReAdd(t *testing.T) {
+	s := cache.NewExpiringSet(10 * time.Millisecond)
+	s.AddIfAbsent("a", 10*time.Millisecond)
+	time.Sleep(15 * time.Millisecond)
+	if !s.AddIfAbsent("a", time.Hour) {
+		t.Fatal("expired key not added again")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if !s.Contains("a") || s.Len() != 1 {
+		t.Fatal("re-added key dropped with its old bucket")
+	}
+}
+
+// 突发之后所有的key都过期: 它们的内存被释放, 不需要每个key一个定时器
+func TestExpiringSetBurst(t *testing.T) {
+	s := cache.NewExpiringSet(10 * time.Millisecond)
+	for i := 0; i < 10000; i++ {
+		s.AddIfAbsent(fmt.Sprint(i), time.Second)
+	}
+	if n := s.Len(); n != 10000 {
+		t.Fatalf("Len = %d, want 10000", n)
+	}
+	time.Sleep(time.Second + 20*time.Millisecond)
+	if n := s.Len(); n != 0 {
+		t.Fatalf("Len = %d after every key expired, want 0", n)
+	}
+}
+
+func TestExpiringSetConcurrent(t *testing.T) {
+	s := cache.NewExpiringSet(0)
+	var added int32
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				if s.AddIfAbsent(fmt.Sprint(i), time.Minute) {
+					atomic.AddInt32(&added, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if added != 1000 {
+		t.Errorf("%d keys added, want each of 1000 once", added)
+	}
+}
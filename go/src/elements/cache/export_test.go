@@ -0,0 +1,15 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+// Len returns the number of entries c holds, expired or not.
+func Len(c *Cache) int {
+	n := 0
+	c.m.Range(func(_, _ interface{}) bool {
+		n++
+		return true
+	})
+	return n
+}
@@ -0,0 +1,311 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"context"
+	"elements/clock"
+	"elements/errs"
+	"elements/expiry"
+	"elements/lifecycle"
+	"errors"
+	"sync"
+	"time"
+)
+
+// The errors of LeaseMap come wrapped in an *errs.KeyError with the key;
+// test for them with errors.Is.
+var (
+	// ErrLeaseHeld is returned by LeaseMap.Store when another owner holds
+	// the lease.
+	ErrLeaseHeld = errors.New("cache: lease held by another owner")
+
+	// ErrNoLease is returned by LeaseMap.Renew and Revoke when the lease
+	// they name has expired, been revoked or been granted again. It is an
+	// errs.ErrNotFound.
+	ErrNoLease = errs.New("cache: no such lease", errs.ErrNotFound)
+
+	// ErrClosed is returned by LeaseMap.Store and Renew after Close. It is
+	// an errs.ErrClosed.
+	ErrClosed = errs.New("cache: lease map closed", errs.ErrClosed)
+)
+
+// LeaseConfig configures a LeaseMap.
+type LeaseConfig struct {
+	// Tick is the resolution of the expiry timers: OnExpire is called up
+	// to a Tick after a lease expires. Zero means 10 milliseconds. A lease
+	// is no longer held from the moment it expires, whatever the Tick.
+	Tick time.Duration
+
+	// Runner, if not nil, runs the expiry timers, and Tick and Clock are
+	// ignored. Otherwise the map starts a Runner of its own.
+	Runner *expiry.Runner
+
+	// Clock, if not nil, is the clock of the Runner the map starts. The
+	// map tells the time by the clock of its Runner.
+	Clock clock.Clock
+
+	// OnExpire, if not nil, is called in its own goroutine with each lease
+	// that expires without being renewed or revoked.
+	OnExpire func(l Lease)
+
+	// OnRenew and OnRevoke, if not nil, are called by Renew and Revoke
+	// with the lease renewed or revoked, after the change and with no lock
+	// held.
+	OnRenew  func(l Lease)
+	OnRevoke func(l Lease)
+}
+
+// A Lease is the exclusive, time-limited ownership of a key.
+type Lease struct {
+	Key     string
+	Owner   string
+	Value   interface{}
+	Expires time.Time
+
+	// Token is the fencing token of the lease. Every lease a LeaseMap
+	// grants has a larger token than any lease granted before, so a
+	// resource guarded by the leases can reject a request whose token is
+	// smaller than the largest it has seen: the request was sent by an
+	// owner whose lease has expired, and who may not know it yet.
+	Token uint64
+}
+
+// A LeaseMap grants leases on keys: an owner that stores a key holds it
+// until the lease expires or is revoked, and nobody else can store it
+// meanwhile. It coordinates the goroutines, or the nodes behind them,
+// that must not work on the same resource at once. It is safe for
+// concurrent use.
+//
+// Like a SessionMap, it keeps the leases in a sync.Map, so that Load and
+// Valid do not lock, and expires them on an expiry.Runner.
+type LeaseMap struct {
+	onExpire, onRenew, onRevoke func(l Lease)
+	runner                      *expiry.Runner
+	own                         bool        // runner was started by the map, and is stopped by Close
+	clock                       clock.Clock // the clock of runner
+
+	m sync.Map // string -> *lease
+
+	mu     sync.Mutex // serializes changes to m
+	token  uint64     // the last token granted; guarded by mu
+	n      int        // guarded by mu
+	closed bool
+}
+
+type lease struct {
+	Lease
+	expires int64         // Lease.Expires in UnixNano
+	timer   *expiry.Timer // guarded by LeaseMap.mu
+}
+
+func (e *lease) live(now int64) bool { return now < e.expires }
+
+// NewLeaseMap returns an empty LeaseMap configured by cfg, registered in
+// lifecycle.Default to be stopped before its Runner. Call Close to stop
+// its timers, and the goroutine of its Runner if it started one.
+func NewLeaseMap(cfg LeaseConfig) *LeaseMap {
+	m := &LeaseMap{
+		onExpire: cfg.OnExpire,
+		onRenew:  cfg.OnRenew,
+		onRevoke: cfg.OnRevoke,
+		runner:   cfg.Runner,
+	}
+	if m.runner == nil {
+		m.runner, m.own = expiry.Start(expiry.Config{Tick: cfg.Tick, Clock: cfg.Clock}), true
+	}
+	m.clock = m.runner.Clock()
+	lifecycle.Register(m, "cache.LeaseMap", func(context.Context) error {
+		m.Close()
+		return nil
+	}, m.runner)
+	return m
+}
+
+// Store grants owner a lease on key for ttl, holding v. If owner already
+// holds the lease, Store replaces its value and sets it to expire ttl from
+// now, keeping its token. If another owner holds it, Store returns that
+// lease and ErrLeaseHeld. Store panics if ttl is not positive, and returns
+// ErrClosed after Close.
+func (m *LeaseMap) Store(key, owner string, v interface{}, ttl time.Duration) (Lease, error) {
+	if ttl <= 0 {
+		panic("cache: LeaseMap.Store with non-positive TTL")
+	}
+	now := m.clock.Now()
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return Lease{}, leaseError("store", key, ErrClosed)
+	}
+	var expired *lease
+	token := uint64(0)
+	if old, ok := m.loadLocked(key); ok {
+		switch {
+		case !old.live(now.UnixNano()):
+			// 已经过期, 定时器还没来得及处理
+			expired = old
+		case old.Owner != owner:
+			m.mu.Unlock()
+			return old.Lease, leaseError("store", key, ErrLeaseHeld)
+		default:
+			token = old.Token
+		}
+		old.timer.Stop()
+	}
+	if token == 0 {
+		m.token++
+		token = m.token
+	}
+	e := m.newLocked(Lease{Key: key, Owner: owner, Value: v, Token: token}, now, ttl)
+	m.mu.Unlock()
+	if expired != nil && m.onExpire != nil {
+		m.onExpire(expired.Lease)
+	}
+	return e.Lease, nil
+}
+
+// Renew sets the lease on key with the given token to expire ttl from
+// now. It returns ErrNoLease if that lease is no longer held, and
+// ErrClosed after Close.
+func (m *LeaseMap) Renew(key string, token uint64, ttl time.Duration) (Lease, error) {
+	if ttl <= 0 {
+		panic("cache: LeaseMap.Renew with non-positive TTL")
+	}
+	now := m.clock.Now()
+	m.mu.Lock()
+	if m.closed {
+		m.mu.Unlock()
+		return Lease{}, leaseError("renew", key, ErrClosed)
+	}
+	old, ok := m.loadLocked(key)
+	if !ok || old.Token != token || !old.live(now.UnixNano()) {
+		m.mu.Unlock()
+		return Lease{}, leaseError("renew", key, ErrNoLease)
+	}
+	old.timer.Stop()
+	e := m.newLocked(old.Lease, now, ttl)
+	m.mu.Unlock()
+	if m.onRenew != nil {
+		m.onRenew(e.Lease)
+	}
+	return e.Lease, nil
+}
+
+// Revoke ends the lease on key with the given token before it expires.
+// It returns ErrNoLease if that lease is no longer held.
+func (m *LeaseMap) Revoke(key string, token uint64) error {
+	m.mu.Lock()
+	e, ok := m.loadLocked(key)
+	if !ok || e.Token != token || !e.live(m.clock.Now().UnixNano()) {
+		m.mu.Unlock()
+		return leaseError("revoke", key, ErrNoLease)
+	}
+	e.timer.Stop()
+	m.m.Delete(key)
+	m.n--
+	m.mu.Unlock()
+	if m.onRevoke != nil {
+		m.onRevoke(e.Lease)
+	}
+	return nil
+}
+
+// Load returns the lease held on key, if any. Load does not lock the map.
+func (m *LeaseMap) Load(key string) (Lease, bool) {
+	v, ok := m.m.Load(key)
+	if !ok {
+		return Lease{}, false
+	}
+	e := v.(*lease)
+	if !e.live(m.clock.Now().UnixNano()) {
+		return Lease{}, false
+	}
+	return e.Lease, true
+}
+
+// Valid reports whether the lease on key with the given token is still
+// held. Valid does not lock the map.
+func (m *LeaseMap) Valid(key string, token uint64) bool {
+	l, ok := m.Load(key)
+	return ok && l.Token == token
+}
+
+// Len returns the number of leases, including expired ones that have not
+// been removed yet.
+func (m *LeaseMap) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.n
+}
+
+// Close stops the expiry timers, and the Runner if the map started it.
+// Leases no longer expire by themselves, though Load still reports them
+// expired, and OnExpire is not called again.
+func (m *LeaseMap) Close() {
+	m.mu.Lock()
+	if !m.closed {
+		m.closed = true
+		lifecycle.Unregister(m)
+		if m.own {
+			m.runner.Stop()
+		} else {
+			m.m.Range(func(_, v interface{}) bool {
+				v.(*lease).timer.Stop()
+				return true
+			})
+		}
+	}
+	m.mu.Unlock()
+}
+
+// loadLocked returns key's lease, expired or not. m.mu must be held.
+func (m *LeaseMap) loadLocked(key string) (*lease, bool) {
+	v, ok := m.m.Load(key)
+	if !ok {
+		return nil, false
+	}
+	return v.(*lease), true
+}
+
+// newLocked stores a lease l expiring ttl after now, replacing any lease
+// of l.Key, and starts its timer. m.mu must be held.
+func (m *LeaseMap) newLocked(l Lease, now time.Time, ttl time.Duration) *lease {
+	l.Expires = now.Add(ttl)
+	e := &lease{Lease: l, expires: l.Expires.UnixNano()}
+	if _, ok := m.m.Load(l.Key); !ok {
+		m.n++
+	}
+	// 续约也换一个新的lease: Load无锁地读到的lease不会被修改
+	m.m.Store(l.Key, e)
+	e.timer = m.runner.AfterFunc(ttl, func() { m.expire(e) })
+	return e
+}
+
+// expire runs when e's timer fires.
+func (m *LeaseMap) expire(e *lease) {
+	m.mu.Lock()
+	cur, ok := m.loadLocked(e.Key)
+	if m.closed || !ok || cur != e {
+		// 已经被续约, 撤销或者重新授予
+		m.mu.Unlock()
+		return
+	}
+	if rest := e.expires - m.clock.Now().UnixNano(); rest > 0 {
+		// Runner按单调时钟计时, expires是墙上时间, 两者可能差一点
+		e.timer = m.runner.AfterFunc(time.Duration(rest), func() { m.expire(e) })
+		m.mu.Unlock()
+		return
+	}
+	m.m.Delete(e.Key)
+	m.n--
+	m.mu.Unlock()
+	if m.onExpire != nil {
+		m.onExpire(e.Lease)
+	}
+}
+
+func leaseError(op, key string, err error) error {
+	return &errs.KeyError{Op: op, Key: key, Err: err}
+}
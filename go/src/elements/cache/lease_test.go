@@ -0,0 +1,215 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache_test
+
+import (
+	"elements/cache"
+	"elements/errs"
+	"elements/expiry"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestLeaseExclusive(t *testing.T) {
+	m := cache.NewLeaseMap(cache.LeaseConfig{})
+	defer m.Close()
+	a, err := m.Store("job", "a", 1, time.Minute)
+	if err != nil || a.Owner != "a" || a.Token == 0 {
+		t.Fatalf("Store = %+v, %v", a, err)
+	}
+	held, err := m.Store("job", "b", 2, time.Minute)
+	if !errors.Is(err, cache.ErrLeaseHeld) || held.Owner != "a" || held.Value != 1 {
+		t.Errorf("Store by another owner = %+v, %v", held, err)
+	}
+	// 持有者再次Store: 更新值, 令牌不变
+	again, err := m.Store("job", "a", 3, time.Minute)
+	if err != nil || again.Token != a.Token || again.Value != 3 {
+		t.Errorf("Store by the owner = %+v, %v", again, err)
+	}
+	if l, ok := m.Load("job"); !ok || l.Value != 3 || !m.Valid("job", a.Token) {
+		t.Errorf("Load = %+v, %v", l, ok)
+	}
+
+	if err := m.Revoke("job", a.Token+1); !errors.Is(err, cache.ErrNoLease) {
+		t.Errorf("Revoke with a wrong token: %v", err)
+	}
+	if err := m.Revoke("job", a.Token); err != nil {
+		t.Fatal(err)
+	}
+	if m.Valid("job", a.Token) || m.Len() != 0 {
+		t.Error("lease still held after Revoke")
+	}
+	// 新的租约的令牌更大
+	b, err := m.Store("job", "b", 4, time.Minute)
+	if err != nil || b.Token <= a.Token {
+		t.Errorf("Store after Revoke = %+v, %v; want a token above %d", b, err, a.Token)
+	}
+}
+
+func TestLeaseExpires(t *testing.T) {
+	expired := make(chan cache.Lease, 1)
+	m := cache.NewLeaseMap(cache.LeaseConfig{
+		Tick:     time.Millisecond,
+		OnExpire: func(l cache.Lease) { expired <- l },
+	})
+	defer m.Close()
+	a, _ := m.Store("job", "a", nil, 20*time.Millisecond)
+	select {
+	case l := <-expired:
+		if l.Token != a.Token || l.Owner != "a" {
+			t.Errorf("OnExpire(%+v), want %+v", l, a)
+		}
+		if time.Now().Before(a.Expires) {
+			t.Errorf("OnExpire before the lease expired")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("lease did not expire")
+	}
+	if _, err := m.Renew("job", a.Token, time.Minute); !errors.Is(err, cache.ErrNoLease) {
+		t.Errorf("Renew of an expired lease: %v", err)
+	}
+	if m.Len() != 0 {
+		t.Errorf("Len = %d after expiry", m.Len())
+	}
+}
+
+// 续约推迟过期, 过期之前不调用OnExpire
+func TestLeaseRenew(t *testing.T) {
+	var mu sync.Mutex
+	var renewed []uint64
+	expired := make(chan cache.Lease, 1)
+	m := cache.NewLeaseMap(cache.LeaseConfig{
+		Tick:     time.Millisecond,
+		OnExpire: func(l cache.Lease) { expired <- l },
+		OnRenew: func(l cache.Lease) {
+			mu.Lock()
+			renewed = append(renewed, l.Token)
+			mu.Unlock()
+		},
+	})
+	defer m.Close()
+	a, _ := m.Store("job", "a", nil, 30*time.Millisecond)
+	for i := 0; i < 5; i++ {
+		time.Sleep(10 * time.Millisecond)
+		l, err := m.Renew("job", a.Token, 30*time.Millisecond)
+		if err != nil {
+			t.Fatalf("Renew %d: %v", i, err)
+		}
+		if !l.Expires.After(a.Expires) {
+			t.Errorf("Renew did not move the expiry")
+		}
+	}
+	select {
+	case l := <-expired:
+		t.Fatalf("renewed lease expired: %+v", l)
+	default:
+	}
+	mu.Lock()
+	if len(renewed) != 5 || renewed[0] != a.Token {
+		t.Errorf("OnRenew tokens %v", renewed)
+	}
+	mu.Unlock()
+	<-expired
+}
+
+// 过期的租约在定时器之前就不再被持有, 别的owner可以立即Store
+func TestLeaseExpiredBeforeTimer(t *testing.T) {
+	expired := make(chan cache.Lease, 1)
+	m := cache.NewLeaseMap(cache.LeaseConfig{
+		Tick:     time.Hour,
+		OnExpire: func(l cache.Lease) { expired <- l },
+	})
+	defer m.Close()
+	a, _ := m.Store("job", "a", nil, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if m.Valid("job", a.Token) {
+		t.Error("expired lease still valid")
+	}
+	b, err := m.Store("job", "b", nil, time.Minute)
+	if err != nil || b.Token <= a.Token {
+		t.Fatalf("Store after expiry = %+v, %v", b, err)
+	}
+	if l := <-expired; l.Token != a.Token {
+		t.Errorf("OnExpire(%+v), want the old lease", l)
+	}
+}
+
+// 并发地争抢同一个key, 同一时刻最多一个owner持有它
+func TestLeaseConcurrent(t *testing.T) {
+	m := cache.NewLeaseMap(cache.LeaseConfig{Tick: time.Millisecond})
+	defer m.Close()
+	var mu sync.Mutex
+	holder := ""
+	last := uint64(0)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(owner string) {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				l, err := m.Store("res", owner, nil, time.Minute)
+				if err != nil {
+					continue
+				}
+				mu.Lock()
+				if holder != "" {
+					t.Errorf("%s and %s hold the lease", holder, owner)
+				}
+				if l.Token <= last {
+					t.Errorf("token %d after %d", l.Token, last)
+				}
+				holder, last = owner, l.Token
+				mu.Unlock()
+
+				mu.Lock()
+				holder = ""
+				mu.Unlock()
+				m.Revoke("res", l.Token)
+			}
+		}(string(rune('a' + g)))
+	}
+	wg.Wait()
+}
+
+func TestLeaseSharedRunner(t *testing.T) {
+	r := expiry.Start(expiry.Config{Tick: time.Millisecond})
+	defer r.Stop()
+	expired := make(chan cache.Lease, 1)
+	m := cache.NewLeaseMap(cache.LeaseConfig{Runner: r, OnExpire: func(l cache.Lease) { expired <- l }})
+	l, err := m.Store("k", "a", nil, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e := <-expired; e.Token != l.Token {
+		t.Errorf("OnExpire(%+v); want %+v", e, l)
+	}
+	m.Store("k", "a", nil, time.Hour)
+	m.Close()
+	if n := r.Len(); n != 0 {
+		t.Errorf("Runner.Len = %d after Close; want 0", n)
+	}
+}
+
+func TestLeaseErrors(t *testing.T) {
+	m := cache.NewLeaseMap(cache.LeaseConfig{})
+	a, _ := m.Store("job", "a", 1, time.Minute)
+	err := m.Revoke("job", a.Token+1)
+	var ke *errs.KeyError
+	if !errors.As(err, &ke) || ke.Op != "revoke" || ke.Key != "job" {
+		t.Fatalf("Revoke with a wrong token = %v, want a KeyError for job", err)
+	}
+	if !errors.Is(err, errs.ErrNotFound) {
+		t.Errorf("%v is not an errs.ErrNotFound", err)
+	}
+	m.Close()
+	if _, err := m.Store("job", "a", 1, time.Minute); !errors.Is(err, cache.ErrClosed) || !errors.Is(err, errs.ErrClosed) {
+		t.Errorf("Store after Close = %v, want ErrClosed", err)
+	}
+	if _, err := m.Renew("job", a.Token, time.Minute); !errors.Is(err, cache.ErrClosed) {
+		t.Errorf("Renew after Close = %v, want ErrClosed", err)
+	}
+}
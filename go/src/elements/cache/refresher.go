@@ -0,0 +1,246 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"context"
+	"elements/lifecycle"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RefresherConfig configures a Refresher.
+type RefresherConfig struct {
+	// Ahead is how long before it expires a value is reloaded. It must be
+	// positive, and Ahead+Jitter must be less than the TTL of the Cache.
+	Ahead time.Duration
+
+	// Jitter spreads the reloads of values that expire together: each
+	// value is reloaded up to Jitter earlier than Ahead, by an amount that
+	// depends on its key and expiry.
+	Jitter time.Duration
+
+	// Concurrency is how many reloads run at once. Zero means 1.
+	Concurrency int
+
+	// Interval is how often the Cache is scanned for values to reload.
+	// Zero means Ahead/4, but at least a millisecond.
+	Interval time.Duration
+
+	// RefreshUnused makes the Refresher reload every value nearing
+	// expiry. By default it only reloads values that Get has returned
+	// since they were loaded, and lets the others expire.
+	RefreshUnused bool
+}
+
+// A Refresher reloads the values of a Cache shortly before they expire,
+// so that Gets of popular keys keep hitting instead of all waiting for a
+// load when the TTL runs out.
+//
+// It scans the Cache every Interval for values expiring within Ahead
+// (plus their jitter) and reloads them through the Cache's Loader and
+// Flight, at most Concurrency at a time: keys loaded together at startup
+// are reloaded over Jitter, at a rate the backend chooses by its latency,
+// rather than all at the same instant. A reload that fails leaves the old
+// value until it expires, and the next scan tries again.
+type Refresher struct {
+	c      *Cache
+	ahead  int64
+	jitter int64
+	unused bool
+
+	sem  chan struct{}
+	stop chan struct{}
+	wg   sync.WaitGroup // the scan goroutine and the running reloads
+	once sync.Once
+
+	scans, reloads, failures uint64 // accessed atomically
+}
+
+// RefresherStats holds counters describing a Refresher's activity.
+type RefresherStats struct {
+	Scans    uint64 // scans of the Cache
+	Reloads  uint64 // reloads started
+	Failures uint64 // reloads whose Loader returned an error
+}
+
+// NewRefresher starts a Refresher for c configured by cfg, registered in
+// lifecycle.Default. Call Close to stop it. It panics if c has no TTL or cfg.Ahead is out of range.
+func NewRefresher(c *Cache, cfg RefresherConfig) *Refresher {
+	if c.ttl <= 0 {
+		panic("cache: NewRefresher for a Cache without TTL")
+	}
+	if cfg.Ahead <= 0 {
+		panic("cache: NewRefresher with non-positive Ahead")
+	}
+	if cfg.Jitter < 0 || cfg.Ahead+cfg.Jitter >= c.ttl {
+		// 否则值一加载就到了重新加载的时间, Refresher会一直加载它
+		panic("cache: NewRefresher with Ahead+Jitter not less than TTL")
+	}
+	n := cfg.Concurrency
+	if n <= 0 {
+		n = 1
+	}
+	interval := cfg.Interval
+	if interval <= 0 {
+		interval = cfg.Ahead / 4
+		if interval < time.Millisecond {
+			interval = time.Millisecond
+		}
+	}
+	r := &Refresher{
+		c:      c,
+		ahead:  int64(cfg.Ahead),
+		jitter: int64(cfg.Jitter),
+		unused: cfg.RefreshUnused,
+		sem:    make(chan struct{}, n),
+		stop:   make(chan struct{}),
+	}
+	r.wg.Add(1)
+	go r.run(interval)
+	lifecycle.Register(r, "cache.Refresher", func(context.Context) error {
+		r.Close()
+		return nil
+	})
+	return r
+}
+
+// Close stops the Refresher and waits for its running reloads to finish.
+func (r *Refresher) Close() {
+	r.once.Do(func() {
+		close(r.stop)
+		lifecycle.Unregister(r)
+	})
+	r.wg.Wait()
+}
+
+// Stats returns the Refresher's counters.
+func (r *Refresher) Stats() RefresherStats {
+	return RefresherStats{
+		Scans:    atomic.LoadUint64(&r.scans),
+		Reloads:  atomic.LoadUint64(&r.reloads),
+		Failures: atomic.LoadUint64(&r.failures),
+	}
+}
+
+func (r *Refresher) run(interval time.Duration) {
+	defer r.wg.Done()
+	t := r.c.clock.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-t.C():
+		}
+		if !r.scan() {
+			return
+		}
+	}
+}
+
+// scan starts a reload of each value due for one. It reports false if
+// the Refresher was closed meanwhile.
+func (r *Refresher) scan() bool {
+	atomic.AddUint64(&r.scans, 1)
+	open := true
+	r.c.m.Range(func(k, v interface{}) bool {
+		key, e := k.(string), v.(*entry)
+		if !r.due(key, e) {
+			return true
+		}
+		if _, running := r.c.refreshing.LoadOrStore(key, struct{}{}); running {
+			return true
+		}
+		// 名额用完时在这里等, 而不是跳过: 扫描的速度就是后端加载的速度
+		select {
+		case r.sem <- struct{}{}:
+		case <-r.stop:
+			r.c.refreshing.Delete(key)
+			open = false
+			return false
+		}
+		atomic.AddUint64(&r.reloads, 1)
+		r.wg.Add(1)
+		go r.reload(key, e)
+		return true
+	})
+	return open
+}
+
+// due reports whether e, the entry of key, should be reloaded now.
+func (r *Refresher) due(key string, e *entry) bool {
+	if e.expires == 0 || !r.unused && atomic.LoadUint32(&e.used) == 0 {
+		return false
+	}
+	at := e.expires - r.ahead
+	if r.jitter > 0 {
+		// 同一个值每次扫描得到相同的提前量, 重新加载之后expires变了, 提前量也跟着变
+		at -= int64(mix(hashKey(key)^uint64(e.expires)) % uint64(r.jitter))
+	}
+	now := r.c.clock.Now().UnixNano()
+	// 已经过期的值交给Get: 它们没有被Get过, 或者已经没有提前加载的意义
+	return now >= at && now < e.expires
+}
+
+func (r *Refresher) reload(key string, old *entry) {
+	defer func() {
+		<-r.sem
+		r.c.refreshing.Delete(key)
+		r.wg.Done()
+	}()
+	_, err, _ := r.c.flight.Do(key, func() (interface{}, error) {
+		return r.c.reloadAndStore(key, old)
+	})
+	if err != nil {
+		atomic.AddUint64(&r.failures, 1)
+	}
+}
+
+// reloadAndStore loads key to replace old, its entry that is about to
+// expire, unless a Set, a Delete or another load replaces it meanwhile.
+// It runs inside the Flight.
+func (c *Cache) reloadAndStore(key string, old *entry) (interface{}, error) {
+	// old还没有过期, loadAndStore的lookup会直接返回它. key的值已经换成了
+	// 别的(或者被删除了)的话, 就和Get没命中时一样
+	if v, ok := c.m.Load(key); !ok || v.(*entry) != old {
+		return c.loadAndStore(key)
+	}
+	gen := atomic.LoadUint64(&c.gen)
+	atomic.AddUint64(&c.loads, 1)
+	v, err := c.load(key)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if atomic.LoadUint64(&c.gen) == gen {
+		// 新值的used从0开始: 这个TTL中还有Get, 到期前才再次提前加载
+		c.m.Store(c.internKey(key), c.newEntry(v))
+	}
+	c.mu.Unlock()
+	c.sweep()
+	return v, nil
+}
+
+// hashKey is FNV-1a.
+func hashKey(s string) uint64 {
+	h := uint64(14695981039346656037)
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= 1099511628211
+	}
+	return h
+}
+
+// mix is the finalizer of splitmix64: the expiries of values loaded
+// together differ only in their low bits.
+func mix(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	return x ^ x>>31
+}
@@ -0,0 +1,203 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache_test
+
+import (
+	"elements/cache"
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// 被Get的key在过期前重新加载, Get一直命中
+func TestRefresherReloadsAhead(t *testing.T) {
+	var loads int32
+	c := cache.New(cache.Config{
+		TTL: 100 * time.Millisecond,
+		Load: func(key string) (interface{}, error) {
+			return atomic.AddInt32(&loads, 1), nil
+		},
+	})
+	r := cache.NewRefresher(c, cache.RefresherConfig{
+		Ahead:    60 * time.Millisecond,
+		Interval: 5 * time.Millisecond,
+	})
+	defer r.Close()
+
+	for end := time.Now().Add(400 * time.Millisecond); time.Now().Before(end); time.Sleep(5 * time.Millisecond) {
+		if _, err := c.Get("a"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if st := c.Stats(); st.Misses != 1 {
+		t.Errorf("Stats = %+v, want only the first Get to miss", st)
+	}
+	if n := atomic.LoadInt32(&loads); n < 3 {
+		t.Errorf("%d loads in four TTLs, want the value reloaded ahead", n)
+	}
+	if st := r.Stats(); st.Reloads == 0 || st.Failures != 0 || st.Scans == 0 {
+		t.Errorf("Refresher Stats = %+v", st)
+	}
+}
+
+// 加载之后没有被Get过的值不提前加载, 到期就过期
+func TestRefresherSkipsUnused(t *testing.T) {
+	var loads int32
+	c := cache.New(cache.Config{
+		TTL: 50 * time.Millisecond,
+		Load: func(key string) (interface{}, error) {
+			return atomic.AddInt32(&loads, 1), nil
+		},
+	})
+	r := cache.NewRefresher(c, cache.RefresherConfig{
+		Ahead:    30 * time.Millisecond,
+		Interval: 2 * time.Millisecond,
+	})
+	c.Get("cold")
+	time.Sleep(100 * time.Millisecond)
+	r.Close()
+	if n := atomic.LoadInt32(&loads); n != 1 {
+		t.Errorf("%d loads, want the unused value left to expire", n)
+	}
+	if _, ok := c.Peek("cold"); ok {
+		t.Error("unused value did not expire")
+	}
+
+	atomic.StoreInt32(&loads, 0)
+	r = cache.NewRefresher(c, cache.RefresherConfig{
+		Ahead:         30 * time.Millisecond,
+		Interval:      2 * time.Millisecond,
+		RefreshUnused: true,
+	})
+	defer r.Close()
+	c.Get("cold")
+	waitFor(t, func() bool { return atomic.LoadInt32(&loads) >= 2 })
+}
+
+// 同时到期的key最多Concurrency个一起加载
+func TestRefresherConcurrency(t *testing.T) {
+	const keys, concurrency = 20, 3
+	var running, peak, loads int32
+	fresh := int32(1)
+	c := cache.New(cache.Config{
+		TTL: time.Second,
+		Load: func(key string) (interface{}, error) {
+			atomic.AddInt32(&loads, 1)
+			if atomic.LoadInt32(&fresh) == 1 {
+				return key, nil
+			}
+			n := atomic.AddInt32(&running, 1)
+			for {
+				p := atomic.LoadInt32(&peak)
+				if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			atomic.AddInt32(&running, -1)
+			return key, nil
+		},
+	})
+	for i := 0; i < keys; i++ {
+		c.Get(strconv.Itoa(i))
+		c.Get(strconv.Itoa(i))
+	}
+	atomic.StoreInt32(&fresh, 0)
+	r := cache.NewRefresher(c, cache.RefresherConfig{
+		Ahead:       900 * time.Millisecond,
+		Jitter:      50 * time.Millisecond,
+		Concurrency: concurrency,
+		Interval:    time.Millisecond,
+	})
+	defer r.Close()
+	waitFor(t, func() bool { return r.Stats().Reloads == keys && atomic.LoadInt32(&running) == 0 })
+	if p := atomic.LoadInt32(&peak); p > concurrency {
+		t.Errorf("%d reloads at once, want at most %d", p, concurrency)
+	}
+	if n := atomic.LoadInt32(&loads); n != 2*keys {
+		t.Errorf("%d loads, want each key reloaded once", n)
+	}
+}
+
+// 提前加载失败时旧值留到过期, 之后的扫描再试
+func TestRefresherFailure(t *testing.T) {
+	var loads int32
+	c := cache.New(cache.Config{
+		TTL: 200 * time.Millisecond,
+		Load: func(key string) (interface{}, error) {
+			if atomic.AddInt32(&loads, 1) == 2 {
+				return nil, errors.New("unavailable")
+			}
+			return atomic.LoadInt32(&loads), nil
+		},
+	})
+	c.Get("a")
+	c.Get("a")
+	r := cache.NewRefresher(c, cache.RefresherConfig{
+		Ahead:    150 * time.Millisecond,
+		Interval: time.Millisecond,
+	})
+	defer r.Close()
+	waitFor(t, func() bool {
+		v, _ := c.Peek("a")
+		return v == int32(3)
+	})
+	if st := r.Stats(); st.Failures != 1 || st.Reloads != 2 {
+		t.Errorf("Refresher Stats = %+v, want a failed reload retried", st)
+	}
+	if st := c.Stats(); st.Misses != 1 {
+		t.Errorf("Stats = %+v", st)
+	}
+}
+
+// Close等待进行中的加载, 之后不再加载
+func TestRefresherClose(t *testing.T) {
+	var loads int32
+	c := cache.New(cache.Config{
+		TTL: 20 * time.Millisecond,
+		Load: func(key string) (interface{}, error) {
+			time.Sleep(time.Millisecond)
+			return atomic.AddInt32(&loads, 1), nil
+		},
+	})
+	r := cache.NewRefresher(c, cache.RefresherConfig{
+		Ahead:         15 * time.Millisecond,
+		Interval:      time.Millisecond,
+		RefreshUnused: true,
+	})
+	c.Get("a")
+	waitFor(t, func() bool { return r.Stats().Reloads > 0 })
+	r.Close()
+	r.Close()
+	n := atomic.LoadInt32(&loads)
+	time.Sleep(50 * time.Millisecond)
+	if m := atomic.LoadInt32(&loads); m != n {
+		t.Errorf("%d loads after Close", m-n)
+	}
+}
+
+func TestNewRefresherPanics(t *testing.T) {
+	load := func(key string) (interface{}, error) { return key, nil }
+	for _, tt := range []struct {
+		ttl time.Duration
+		cfg cache.RefresherConfig
+	}{
+		{0, cache.RefresherConfig{Ahead: time.Second}},
+		{time.Minute, cache.RefresherConfig{}},
+		{time.Minute, cache.RefresherConfig{Ahead: time.Minute}},
+		{time.Minute, cache.RefresherConfig{Ahead: 50 * time.Second, Jitter: 10 * time.Second}},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewRefresher with TTL %v and %+v did not panic", tt.ttl, tt.cfg)
+				}
+			}()
+			cache.NewRefresher(cache.New(cache.Config{Load: load, TTL: tt.ttl}), tt.cfg).Close()
+		}()
+	}
+}
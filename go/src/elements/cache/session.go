@@ -0,0 +1,252 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache
+
+import (
+	"context"
+	"elements/clock"
+	"elements/expiry"
+	"elements/intern"
+	"elements/lifecycle"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// SessionConfig configures a SessionMap.
+type SessionConfig struct {
+	// IdleTimeout is how long a session may go without a Load or Touch
+	// before it expires. It must be positive.
+	IdleTimeout time.Duration
+
+	// Tick is the resolution of the expiry timers: sessions expire up to
+	// a Tick late. Zero means IdleTimeout/8, but at least a millisecond.
+	Tick time.Duration
+
+	// Runner, if not nil, runs the expiry timers, and Tick and Clock are
+	// ignored. Otherwise the map starts a Runner of its own.
+	Runner *expiry.Runner
+
+	// Clock, if not nil, is the clock of the Runner the map starts. The
+	// map tells the time by the clock of its Runner.
+	Clock clock.Clock
+
+	// OnIdleExpire, if not nil, is called in its own goroutine with each
+	// session that expires. It is not called for sessions that are
+	// deleted, replaced by Store, or still live when the map is closed.
+	OnIdleExpire func(key string, v interface{})
+
+	// Intern, if not nil, interns the keys of the sessions stored.
+	Intern *intern.Interner
+}
+
+// A SessionMap holds sessions that expire when they go unused for
+// IdleTimeout. It is safe for concurrent use.
+//
+// Expiry runs on an expiry.Runner, one timer per session. Load does not
+// move the timer, which would lock the Runner on every read: it records the
+// time of the access in the session, and when the timer fires for a
+// session that has been used since, the timer is set again for the rest
+// of its idle time.
+type SessionMap struct {
+	idle   time.Duration
+	expire func(key string, v interface{})
+	runner *expiry.Runner
+	own    bool        // runner was started by the map, and is stopped by Close
+	clock  clock.Clock // the clock of runner
+	intern *intern.Interner
+
+	m sync.Map // string -> *session
+
+	mu     sync.Mutex // serializes changes to m
+	n      int64      // number of sessions; written with mu held, read atomically
+	closed bool
+}
+
+type session struct {
+	v     interface{}
+	timer *expiry.Timer // guarded by SessionMap.mu
+
+	// last is the UnixNano of the last access, or -1 once the session has
+	// expired or been removed. A Load refreshes it with a CAS, and expiry
+	// ends it with a CAS from the value it checked, so a session returned
+	// by Load was refreshed before expiry looked at it.
+	last int64
+}
+
+// NewSessionMap returns an empty SessionMap configured by cfg, registered
+// in lifecycle.Default to be stopped before its Runner. Call Close to stop
+// its timers, and the goroutine of its Runner if it started one.
+func NewSessionMap(cfg SessionConfig) *SessionMap {
+	if cfg.IdleTimeout <= 0 {
+		panic("cache: NewSessionMap with non-positive IdleTimeout")
+	}
+	s := &SessionMap{
+		idle:   cfg.IdleTimeout,
+		expire: cfg.OnIdleExpire,
+		runner: cfg.Runner,
+		intern: cfg.Intern,
+	}
+	if s.runner == nil {
+		tick := cfg.Tick
+		if tick <= 0 {
+			tick = cfg.IdleTimeout / 8
+			if tick < time.Millisecond {
+				tick = time.Millisecond
+			}
+		}
+		s.runner, s.own = expiry.Start(expiry.Config{Tick: tick, Clock: cfg.Clock}), true
+	}
+	s.clock = s.runner.Clock()
+	lifecycle.Register(s, "cache.SessionMap", func(context.Context) error {
+		s.Close()
+		return nil
+	}, s.runner)
+	return s
+}
+
+// Store starts a session for key with the value v, replacing any session
+// key has. Store after Close does nothing.
+func (s *SessionMap) Store(key string, v interface{}) {
+	if s.intern != nil {
+		// 定时器的闭包也引用key, 两处用同一个副本
+		key = s.intern.Intern(key)
+	}
+	e := &session{v: v, last: s.clock.Now().UnixNano()}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return
+	}
+	if old, ok := s.m.Load(key); ok {
+		s.endLocked(old.(*session))
+	} else {
+		atomic.AddInt64(&s.n, 1)
+	}
+	s.m.Store(key, e)
+	e.timer = s.runner.AfterFunc(s.idle, func() { s.check(key, e) })
+}
+
+// Load returns the session value for key, and restarts its idle timeout.
+// Load does not lock the map.
+func (s *SessionMap) Load(key string) (interface{}, bool) {
+	v, ok := s.m.Load(key)
+	if !ok {
+		return nil, false
+	}
+	e := v.(*session)
+	if !e.touch(s.clock.Now().UnixNano()) {
+		return nil, false
+	}
+	return e.v, true
+}
+
+// Touch restarts the idle timeout of key's session, and reports whether
+// there is one.
+func (s *SessionMap) Touch(key string) bool {
+	_, ok := s.Load(key)
+	return ok
+}
+
+// Delete ends key's session without calling OnIdleExpire.
+func (s *SessionMap) Delete(key string) {
+	s.mu.Lock()
+	if v, ok := s.m.Load(key); ok {
+		s.endLocked(v.(*session))
+		s.m.Delete(key)
+		atomic.AddInt64(&s.n, -1)
+	}
+	s.mu.Unlock()
+}
+
+// Len returns the number of sessions.
+func (s *SessionMap) Len() int {
+	return int(atomic.LoadInt64(&s.n))
+}
+
+// Range calls f for each session, without refreshing it, as sync.Map.Range
+// does.
+func (s *SessionMap) Range(f func(key string, v interface{}) bool) {
+	s.m.Range(func(k, v interface{}) bool {
+		e := v.(*session)
+		if atomic.LoadInt64(&e.last) < 0 {
+			return true
+		}
+		return f(k.(string), e.v)
+	})
+}
+
+// Close stops the expiry timers, and the Runner if the map started it.
+// Sessions no longer expire, and OnIdleExpire is not called again.
+func (s *SessionMap) Close() {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		lifecycle.Unregister(s)
+		if s.own {
+			s.runner.Stop()
+		} else {
+			// 共用的Runner继续运行, 只停止这个map的定时器
+			s.m.Range(func(_, v interface{}) bool {
+				v.(*session).timer.Stop()
+				return true
+			})
+		}
+	}
+	s.mu.Unlock()
+}
+
+// touch records an access to e at now, and reports whether e is still
+// live.
+func (e *session) touch(now int64) bool {
+	for {
+		last := atomic.LoadInt64(&e.last)
+		if last < 0 {
+			return false
+		}
+		// 别的Load已经记下了更晚的时间, 不用再写
+		if now <= last || atomic.CompareAndSwapInt64(&e.last, last, now) {
+			return true
+		}
+	}
+}
+
+// endLocked ends e without expiring it. s.mu must be held.
+func (s *SessionMap) endLocked(e *session) {
+	atomic.StoreInt64(&e.last, -1)
+	e.timer.Stop()
+}
+
+// check runs when e's timer fires: it expires e if it has been idle for
+// IdleTimeout, and otherwise sets the timer for the rest of it.
+func (s *SessionMap) check(key string, e *session) {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return
+	}
+	last := atomic.LoadInt64(&e.last)
+	if last < 0 {
+		s.mu.Unlock()
+		return
+	}
+	if rest := s.idle - time.Duration(s.clock.Now().UnixNano()-last); rest > 0 {
+		e.timer = s.runner.AfterFunc(rest, func() { s.check(key, e) })
+		s.mu.Unlock()
+		return
+	}
+	// 检查之后有Load刷新了last的话CAS失败, 再检查一次
+	if !atomic.CompareAndSwapInt64(&e.last, last, -1) {
+		s.mu.Unlock()
+		s.check(key, e)
+		return
+	}
+	s.m.Delete(key)
+	atomic.AddInt64(&s.n, -1)
+	s.mu.Unlock()
+	if s.expire != nil {
+		s.expire(key, e.v)
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package cache_test
+
+import (
+	"elements/cache"
+	"elements/clock"
+	"elements/expiry"
+	"sync"
+	"testing"
+	"time"
+)
+
+type expired struct {
+	key string
+	v   interface{}
+}
+
+func newSessions(idle time.Duration) (*cache.SessionMap, chan expired) {
+	ch := make(chan expired, 100)
+	s := cache.NewSessionMap(cache.SessionConfig{
+		IdleTimeout: idle,
+		Tick:        idle / 10,
+		OnIdleExpire: func(key string, v interface{}) {
+			ch <- expired{key, v}
+		},
+	})
+	return s, ch
+}
+
+func TestSessionExpires(t *testing.T) {
+	s, ch := newSessions(50 * time.Millisecond)
+	defer s.Close()
+	start := time.Now()
+	s.Store("a", 1)
+	if v, ok := s.Load("a"); !ok || v != 1 || s.Len() != 1 {
+		t.Fatalf("Load = %v, %v; Len = %d", v, ok, s.Len())
+	}
+	e := <-ch
+	if d := time.Since(start); d < 50*time.Millisecond {
+		t.Errorf("expired after %v, before the idle timeout", d)
+	}
+	if e != (expired{"a", 1}) {
+		t.Errorf("OnIdleExpire(%v)", e)
+	}
+	if _, ok := s.Load("a"); ok || s.Len() != 0 {
+		t.Errorf("session still there after expiring; Len = %d", s.Len())
+	}
+}
+
+// 一直被访问的session不会过期, 停止访问之后过期
+func TestSessionLoadRefreshes(t *testing.T) {
+	const idle = 50 * time.Millisecond
+	s, ch := newSessions(idle)
+	defer s.Close()
+	s.Store("a", 1)
+	var last time.Time
+	for deadline := time.Now().Add(4 * idle); time.Now().Before(deadline); time.Sleep(idle / 5) {
+		last = time.Now()
+		if !s.Touch("a") {
+			t.Fatal("session expired while in use")
+		}
+	}
+	select {
+	case e := <-ch:
+		t.Fatalf("OnIdleExpire(%v) while in use", e)
+	default:
+	}
+	<-ch
+	if d := time.Since(last); d < idle {
+		t.Errorf("expired %v after the last access, want at least %v", d, idle)
+	}
+}
+
+func TestSessionDeleteAndReplace(t *testing.T) {
+	s, ch := newSessions(30 * time.Millisecond)
+	defer s.Close()
+	s.Store("deleted", 1)
+	s.Store("replaced", 1)
+	s.Delete("deleted")
+	s.Store("replaced", 2)
+	if s.Len() != 1 {
+		t.Errorf("Len = %d, want 1", s.Len())
+	}
+	// 只有替换后的session过期, 删除的和被替换的都不回调
+	if e := <-ch; e != (expired{"replaced", 2}) {
+		t.Errorf("OnIdleExpire(%v), want replaced 2", e)
+	}
+	select {
+	case e := <-ch:
+		t.Errorf("OnIdleExpire(%v)", e)
+	case <-time.After(60 * time.Millisecond):
+	}
+}
+
+func TestSessionClose(t *testing.T) {
+	s, ch := newSessions(20 * time.Millisecond)
+	s.Store("a", 1)
+	s.Close()
+	s.Store("b", 2)
+	select {
+	case e := <-ch:
+		t.Errorf("OnIdleExpire(%v) after Close", e)
+	case <-time.After(60 * time.Millisecond):
+	}
+	if v, ok := s.Load("a"); !ok || v != 1 {
+		t.Errorf("Load(a) after Close = %v, %v", v, ok)
+	}
+	if _, ok := s.Load("b"); ok {
+		t.Error("Store after Close stored")
+	}
+}
+
+// 过期和并发的Load竞争: 每个session要么过期一次, 要么一直能读到.
+// 时间由假时钟推进, 每一步只前进IdleTimeout的十分之一, 一直被访问的
+// session怎样调度都不会过期
+func TestSessionConcurrent(t *testing.T) {
+	const idle = 10 * time.Second
+	c := clock.NewFake(time.Unix(0, 0))
+	var mu sync.Mutex
+	expiredN := 0
+	s := cache.NewSessionMap(cache.SessionConfig{
+		IdleTimeout: idle,
+		Tick:        idle / 10,
+		Clock:       c,
+		OnIdleExpire: func(string, interface{}) {
+			mu.Lock()
+			expiredN++
+			mu.Unlock()
+		},
+	})
+	defer s.Close()
+	keys := []string{"a", "b", "c", "d"}
+	for _, k := range keys {
+		s.Store(k, k)
+	}
+	c.BlockUntil(1)
+	for step := 0; step < 30; step++ {
+		// 定时器的回调在各自的goroutine中检查session, 和这里的Touch并发
+		c.Advance(idle / 10)
+		var wg sync.WaitGroup
+		for _, k := range keys[:2] {
+			wg.Add(1)
+			go func(k string) {
+				defer wg.Done()
+				for i := 0; i < 10; i++ {
+					if !s.Touch(k) {
+						t.Errorf("%s expired while in use", k)
+						return
+					}
+				}
+			}(k)
+		}
+		wg.Wait()
+		// 等Runner按前进后的时间重新设好定时器; a和b一直有定时器在等
+		c.BlockUntil(1)
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		mu.Lock()
+		n := expiredN
+		mu.Unlock()
+		if n >= 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	n := 0
+	s.Range(func(key string, v interface{}) bool {
+		n++
+		return true
+	})
+	mu.Lock()
+	defer mu.Unlock()
+	if n != 2 || expiredN != 2 || s.Len() != 2 {
+		t.Errorf("%d live, %d expired, Len %d; want 2, 2, 2", n, expiredN, s.Len())
+	}
+}
+
+// 几个map共用一个Runner, Close只停止自己的定时器
+func TestSessionSharedRunner(t *testing.T) {
+	r := expiry.Start(expiry.Config{Tick: time.Millisecond})
+	defer r.Stop()
+	ch := make(chan string, 10)
+	newMap := func() *cache.SessionMap {
+		return cache.NewSessionMap(cache.SessionConfig{
+			IdleTimeout:  20 * time.Millisecond,
+			Runner:       r,
+			OnIdleExpire: func(key string, v interface{}) { ch <- key },
+		})
+	}
+	a, b := newMap(), newMap()
+	a.Store("a", 1)
+	b.Store("b", 1)
+	b.Close()
+	if n := r.Len(); n != 1 {
+		t.Errorf("Runner.Len = %d after closing one map; want 1", n)
+	}
+	if key := <-ch; key != "a" {
+		t.Errorf("OnIdleExpire(%q); want a", key)
+	}
+	a.Close()
+	select {
+	case key := <-ch:
+		t.Errorf("OnIdleExpire(%q) after Close", key)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestSessionFakeClock(t *testing.T) {
+	c := clock.NewFake(time.Unix(0, 0))
+	ch := make(chan expired, 1)
+	s := cache.NewSessionMap(cache.SessionConfig{
+		IdleTimeout: time.Minute,
+		Tick:        time.Second,
+		Clock:       c,
+		OnIdleExpire: func(key string, v interface{}) {
+			ch <- expired{key, v}
+		},
+	})
+	defer s.Close()
+	s.Store("a", 1)
+	c.BlockUntil(1)
+	c.Advance(40 * time.Second)
+	if _, ok := s.Load("a"); !ok {
+		t.Fatal("session expired before its idle timeout")
+	}
+	// 定时器按Store的时间触发, 发现被访问过, 再等剩下的40秒
+	c.Advance(30 * time.Second)
+	c.BlockUntil(1)
+	select {
+	case e := <-ch:
+		t.Fatalf("OnIdleExpire(%v) 30s after a Load", e)
+	default:
+	}
+	c.Advance(40 * time.Second)
+	if e := <-ch; e != (expired{"a", 1}) {
+		t.Errorf("OnIdleExpire(%v)", e)
+	}
+}
@@ -0,0 +1,474 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package chanmodel is a userspace model of the runtime's channel
+// implementation (runtime/chan.go).
+//
+// A Chan follows hchan field for field: a ring buffer, a send index and a
+// receive index into it, and two FIFO queues of goroutines blocked sending
+// (sendq) and receiving (recvq), all protected by one lock. Blocked
+// goroutines are parked on semaphores instead of being descheduled, but
+// every case of send, receive and close is handled the way the runtime
+// handles it, including direct hand-off between a sender and a waiting
+// receiver.
+//
+// A nil *Chan behaves like a nil channel: sends and receives block forever
+// and Close panics.
+package chanmodel
+
+import (
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// maxAlloc bounds the buffer size, like the check in makechan.
+const maxAlloc = 1 << 30
+
+// A Chan is a channel of interface{} values.
+type Chan struct {
+	qcount   uint          // total data in the queue
+	dataqsiz uint          // size of the circular queue
+	buf      []interface{} // array of dataqsiz elements
+	closed   uint32
+	sendx    uint  // send index
+	recvx    uint  // receive index
+	recvq    waitq // list of recv waiters
+	sendq    waitq // list of send waiters
+
+	// lock protects all fields in Chan, as well as several
+	// fields in sudogs blocked on this channel.
+	//
+	// runtime中这是runtime自己的mutex. 模型中用sync.Mutex代替,
+	// 它在竞争激烈时同样会让goroutine休眠
+	lock sync.Mutex
+}
+
+// New returns a channel with a buffer of the given size, like
+// make(chan interface{}, size).
+func New(size int) *Chan {
+	if size < 0 || size > maxAlloc {
+		panic(plainError("makechan: size out of range"))
+	}
+	// runtime的makechan按元素是否包含指针分三种情况分配内存:
+	// 缓冲区为空或者元素大小为0时只分配hchan; 元素不含指针时hchan和缓冲区一次分配;
+	// 否则分开分配, 让GC扫描缓冲区. 模型中缓冲区是一个普通的slice
+	c := &Chan{dataqsiz: uint(size)}
+	if size > 0 {
+		c.buf = make([]interface{}, size)
+	}
+	return c
+}
+
+// Len returns the number of elements queued in the channel buffer, like
+// len(c).
+func (c *Chan) Len() int {
+	if c == nil {
+		return 0
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return int(c.qcount)
+}
+
+// Cap returns the size of the channel buffer, like cap(c).
+func (c *Chan) Cap() int {
+	if c == nil {
+		return 0
+	}
+	return int(c.dataqsiz)
+}
+
+// Waiting reports how many goroutines are blocked sending to and
+// receiving from the channel. Real channels do not expose this; it lets
+// tests and examples observe the state of sendq and recvq.
+func (c *Chan) Waiting() (senders, receivers int) {
+	if c == nil {
+		return 0, 0
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.sendq.len(), c.recvq.len()
+}
+
+// full reports whether a send on c would block (that is, the channel is full).
+// It uses a single word-sized read of mutable state, so although
+// the answer is instantaneously true, the correct answer may have changed
+// by the time the calling function receives the return value.
+func full(c *Chan) bool {
+	// c.dataqsiz is immutable (never written after the channel is created)
+	// so it is safe to read at any time during channel operation.
+	//
+	// runtime假设字长的读取是relaxed-atomic的, 直接读字段;
+	// 模型中的读取换成了原子操作, 否则竞态检测器会报告它们
+	if c.dataqsiz == 0 {
+		// Assumes that a pointer read is relaxed-atomic.
+		return c.recvq.loadFirst() == nil
+	}
+	// Assumes that a uint read is relaxed-atomic.
+	return c.loadQcount() == c.dataqsiz
+}
+
+// empty reports whether a read from c would block (that is, the channel is
+// empty).  It uses a single atomic read of mutable state.
+func empty(c *Chan) bool {
+	// c.dataqsiz is immutable.
+	if c.dataqsiz == 0 {
+		return c.sendq.loadFirst() == nil
+	}
+	return c.loadQcount() == 0
+}
+
+// loadQcount and setQcount access c.qcount atomically. It is only written
+// with c.lock held, but full and empty read it without the lock.
+func (c *Chan) loadQcount() uint {
+	return uint(atomic.LoadUintptr((*uintptr)(unsafe.Pointer(&c.qcount))))
+}
+
+func (c *Chan) setQcount(n uint) {
+	atomic.StoreUintptr((*uintptr)(unsafe.Pointer(&c.qcount)), uintptr(n))
+}
+
+// Send sends v on the channel, blocking until it is received or buffered,
+// like c <- v.
+func (c *Chan) Send(v interface{}) {
+	c.chansend(v, true)
+}
+
+// TrySend sends v on the channel if that can be done without blocking and
+// reports whether it did, like a select with a send case and a default.
+func (c *Chan) TrySend(v interface{}) bool {
+	return c.chansend(v, false)
+}
+
+// Recv receives a value from the channel, blocking until one is available,
+// like v, ok := <-c. The ok result is false if the value is a zero value
+// received because the channel is closed and empty.
+func (c *Chan) Recv() (v interface{}, ok bool) {
+	_, ok = c.chanrecv(&v, true)
+	return v, ok
+}
+
+// TryRecv receives a value from the channel if that can be done without
+// blocking, like a select with a receive case and a default. The selected
+// result reports whether a receive happened; ok is as for Recv.
+func (c *Chan) TryRecv() (v interface{}, ok, selected bool) {
+	selected, ok = c.chanrecv(&v, false)
+	return v, ok, selected
+}
+
+/*
+ * generic single channel send/recv
+ * If block is not nil,
+ * then the protocol will not
+ * sleep but return if it could
+ * not complete.
+ *
+ * sleep can wake up with g.param == nil
+ * when a channel involved in the sleep has
+ * been closed.  it is easiest to loop and re-run
+ * the operation; we'll see that it's now closed.
+ */
+func (c *Chan) chansend(v interface{}, block bool) bool {
+	if c == nil {
+		if !block {
+			return false
+		}
+		// 向nil channel发送永远阻塞
+		gopark(getg(), nil)
+		panic("unreachable")
+	}
+
+	// Fast path: check for failed non-blocking operation without acquiring the lock.
+	//
+	// After observing that the channel is not closed, we observe that the channel is
+	// not ready for sending. Each of these observations is a single word-sized read
+	// (first c.closed and second full()).
+	// Because a closed channel cannot transition from 'ready for sending' to
+	// 'not ready for sending', even if the channel is closed between the two observations,
+	// they imply a moment between the two when the channel was both not yet closed
+	// and not ready for sending. We behave as if we observed the channel at that moment,
+	// and report that the send cannot proceed.
+	//
+	// It is okay if the reads are reordered here: if we observe that the channel is not
+	// ready for sending and then observe that it's not closed, that implies that the
+	// channel wasn't closed during the first observation. However, nothing here
+	// guarantees forward progress. We rely on the side effects of lock release in
+	// chanrecv() and closechan() to update this thread's view of c.closed and full().
+	//
+	// 非阻塞发送的快速路径: 不加锁就能判断 "一定发不出去".
+	// 这是select加default的常见用法, 不用在channel上抢锁.
+	if !block && atomic.LoadUint32(&c.closed) == 0 && full(c) {
+		return false
+	}
+
+	c.lock.Lock()
+
+	if c.closed != 0 {
+		c.lock.Unlock()
+		panic(plainError("send on closed channel"))
+	}
+
+	// 情况1: 有等待的接收者. 不管有没有缓冲区, 直接把数据交给它,
+	// 数据不经过缓冲区. 有接收者在等说明缓冲区一定是空的
+	if sg := c.recvq.dequeue(); sg != nil {
+		// Found a waiting receiver. We pass the value we want to send
+		// directly to the receiver, bypassing the channel buffer (if any).
+		c.send(sg, v, func() { c.lock.Unlock() })
+		return true
+	}
+
+	// 情况2: 缓冲区还有空位, 放到sendx的位置
+	if c.qcount < c.dataqsiz {
+		// Space is available in the channel buffer. Enqueue the element to send.
+		c.buf[c.sendx] = v
+		c.sendx++
+		if c.sendx == c.dataqsiz {
+			c.sendx = 0
+		}
+		c.setQcount(c.qcount + 1)
+		c.lock.Unlock()
+		return true
+	}
+
+	if !block {
+		c.lock.Unlock()
+		return false
+	}
+
+	// 情况3: 只能阻塞. 把自己和要发送的数据挂到sendq上, 等接收者来取
+	// Block on the channel. Some receiver will complete our operation for us.
+	gp := getg()
+	mysg := &sudog{g: gp, elem: &v, c: c}
+	c.sendq.enqueue(mysg)
+	gopark(gp, func() { c.lock.Unlock() })
+
+	// someone woke us up.
+	//
+	// 被唤醒有两种可能: 接收者取走了数据(param指向mysg), 或者channel被关闭(param为nil).
+	// 后一种情况发送失败, 和真正的channel一样panic
+	if gp.param == nil {
+		if atomic.LoadUint32(&c.closed) == 0 {
+			panic("chansend: spurious wakeup")
+		}
+		panic(plainError("send on closed channel"))
+	}
+	gp.param = nil
+	mysg.c = nil
+	return true
+}
+
+// send processes a send operation on an empty channel c.
+// The value v sent by the sender is copied to the receiver sg.
+// The receiver is then woken up to go on its merry way.
+// Channel c must be empty and locked.  send unlocks c with unlockf.
+func (c *Chan) send(sg *sudog, v interface{}, unlockf func()) {
+	if sg.elem != nil {
+		// 直接写到接收者的变量里. runtime中这是一次跨goroutine栈的内存拷贝
+		// (sendDirect), 也是runtime中唯一一处写别的goroutine的栈的地方
+		*sg.elem = v
+		sg.elem = nil
+	}
+	gp := sg.g
+	unlockf()
+	gp.param = unsafe.Pointer(sg)
+	goready(gp)
+}
+
+// Close closes the channel, like close(c).
+func (c *Chan) Close() {
+	if c == nil {
+		panic(plainError("close of nil channel"))
+	}
+
+	c.lock.Lock()
+	if c.closed != 0 {
+		c.lock.Unlock()
+		panic(plainError("close of closed channel"))
+	}
+
+	atomic.StoreUint32(&c.closed, 1)
+
+	// 把所有等待者先从队列中取出来, 释放锁之后再逐个唤醒.
+	// runtime中持有channel的锁时不能ready别的goroutine
+	var glist []*g
+
+	// release all readers
+	//
+	// 接收者收到零值, ok为false
+	for {
+		sg := c.recvq.dequeue()
+		if sg == nil {
+			break
+		}
+		if sg.elem != nil {
+			*sg.elem = nil
+			sg.elem = nil
+		}
+		gp := sg.g
+		gp.param = nil
+		glist = append(glist, gp)
+	}
+
+	// release all writers (they will panic)
+	for {
+		sg := c.sendq.dequeue()
+		if sg == nil {
+			break
+		}
+		sg.elem = nil
+		gp := sg.g
+		gp.param = nil
+		glist = append(glist, gp)
+	}
+	c.lock.Unlock()
+
+	// Ready all Gs now that we've dropped the channel lock.
+	for _, gp := range glist {
+		goready(gp)
+	}
+}
+
+// chanrecv receives on channel c and writes the received data to ep.
+// ep may be nil, in which case received data is ignored.
+// If block == false and no elements are available, returns (false, false).
+// Otherwise, if c is closed, zeros *ep and returns (true, false).
+// Otherwise, fills in *ep with an element and returns (true, true).
+func (c *Chan) chanrecv(ep *interface{}, block bool) (selected, received bool) {
+	if c == nil {
+		if !block {
+			return
+		}
+		// 从nil channel接收永远阻塞
+		gopark(getg(), nil)
+		panic("unreachable")
+	}
+
+	// Fast path: check for failed non-blocking operation without acquiring the lock.
+	//
+	// After observing that the channel is not ready for receiving, we observe that the
+	// channel is not closed. Each of these observations is a single word-sized read
+	// (first c.sendq.first or c.qcount, and second c.closed).
+	// Because a channel cannot be reopened, the later observation of the channel
+	// being not closed implies that it was also not closed at the moment of the
+	// first observation. We behave as if we observed the channel at that moment
+	// and report that the receive cannot proceed.
+	//
+	// The order of operations is important here: reversing the operations can lead to
+	// incorrect behavior when racing with a close.
+	//
+	// 和发送不同, 这里必须先看 "不能接收" 再看 "没有关闭":
+	// 一个关闭了的channel总是可以接收(收到零值), 反过来读可能在
+	// 两次读之间发生 "关闭", 误报不能接收
+	if !block && empty(c) && atomic.LoadUint32(&c.closed) == 0 {
+		return
+	}
+
+	c.lock.Lock()
+
+	// 已经关闭并且缓冲区中没有数据: 收到零值. 关闭之后缓冲区中剩下的数据仍然可以收到
+	if c.closed != 0 && c.qcount == 0 {
+		c.lock.Unlock()
+		if ep != nil {
+			*ep = nil
+		}
+		return true, false
+	}
+
+	// 情况1: 有等待的发送者. 没有缓冲区时直接从发送者那里拿数据;
+	// 有缓冲区时发送者在等说明缓冲区是满的, 从队头取一个, 再把发送者的数据放到队尾
+	if sg := c.sendq.dequeue(); sg != nil {
+		// Found a waiting sender. If buffer is size 0, receive value
+		// directly from sender. Otherwise, receive from head of queue
+		// and add sender's value to the tail of the queue (both map to
+		// the same buffer slot because the queue is full).
+		c.recv(sg, ep, func() { c.lock.Unlock() })
+		return true, true
+	}
+
+	// 情况2: 缓冲区中有数据, 从recvx的位置取
+	if c.qcount > 0 {
+		// Receive directly from queue
+		qp := &c.buf[c.recvx]
+		if ep != nil {
+			*ep = *qp
+		}
+		// 清空槽位, 不让缓冲区继续引用已经取走的值
+		*qp = nil
+		c.recvx++
+		if c.recvx == c.dataqsiz {
+			c.recvx = 0
+		}
+		c.setQcount(c.qcount - 1)
+		c.lock.Unlock()
+		return true, true
+	}
+
+	if !block {
+		c.lock.Unlock()
+		return false, false
+	}
+
+	// 情况3: 只能阻塞. 挂到recvq上, 等发送者把数据直接写到ep
+	// no sender available: block on this channel.
+	gp := getg()
+	mysg := &sudog{g: gp, elem: ep, c: c}
+	c.recvq.enqueue(mysg)
+	gopark(gp, func() { c.lock.Unlock() })
+
+	// someone woke us up
+	//
+	// param为nil说明是被close唤醒的, close已经把*ep置为零值
+	closed := gp.param == nil
+	gp.param = nil
+	mysg.c = nil
+	return true, !closed
+}
+
+// recv processes a receive operation on a full channel c.
+// There are 2 parts:
+//  1. The value sent by the sender sg is put into the channel
+//     and the sender is woken up to go on its merry way.
+//  2. The value received by the receiver (the current G) is
+//     written to ep.
+//
+// For synchronous channels, both values are the same.
+// For asynchronous channels, the receiver gets its data from
+// the channel buffer and the sender's data is put in the
+// channel buffer.
+// Channel c must be full and locked. recv unlocks c with unlockf.
+func (c *Chan) recv(sg *sudog, ep *interface{}, unlockf func()) {
+	if c.dataqsiz == 0 {
+		if ep != nil {
+			// copy data from sender
+			*ep = *sg.elem
+		}
+	} else {
+		// Queue is full. Take the item at the
+		// head of the queue. Make the sender enqueue
+		// its item at the tail of the queue. Since the
+		// queue is full, those are both the same slot.
+		//
+		// 缓冲区是满的, sendx和recvx指向同一个位置:
+		// 取走这个位置的数据, 再把发送者的数据写进去, 两个下标一起前进一格.
+		// 这样接收者拿到的仍然是最早的数据, FIFO的顺序不变
+		qp := &c.buf[c.recvx]
+		// copy data from queue to receiver
+		if ep != nil {
+			*ep = *qp
+		}
+		// copy data from sender to queue
+		*qp = *sg.elem
+		c.recvx++
+		if c.recvx == c.dataqsiz {
+			c.recvx = 0
+		}
+		c.sendx = c.recvx // c.sendx = (c.sendx+1) % c.dataqsiz
+	}
+	sg.elem = nil
+	gp := sg.g
+	unlockf()
+	gp.param = unsafe.Pointer(sg)
+	goready(gp)
+}
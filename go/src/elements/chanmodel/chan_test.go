@@ -0,0 +1,321 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chanmodel_test
+
+import (
+	"elements/chanmodel"
+	"math/rand"
+	"reflect"
+	"runtime"
+	"sync"
+	"testing"
+	"testing/quick"
+	"time"
+)
+
+type chanOp string
+
+const (
+	opTrySend = chanOp("TrySend")
+	opTryRecv = chanOp("TryRecv")
+	opClose   = chanOp("Close")
+	opLen     = chanOp("Len")
+)
+
+var chanOps = [...]chanOp{opTrySend, opTryRecv, opTryRecv, opTrySend, opLen, opClose}
+
+// chanCall is a quick.Generator for calls on a channel.
+type chanCall struct {
+	op chanOp
+	v  int
+}
+
+type chanResult struct {
+	v        interface{}
+	ok       bool
+	n        int
+	panicked interface{}
+}
+
+func (chanCall) Generate(r *rand.Rand, size int) reflect.Value {
+	c := chanCall{op: chanOps[r.Intn(len(chanOps))], v: r.Intn(100)}
+	// Close ends most interesting sequences, so make it rare.
+	if c.op == opClose && r.Intn(4) != 0 {
+		c.op = opTrySend
+	}
+	return reflect.ValueOf(c)
+}
+
+// chanTrace is a capacity and a sequence of calls, so that quick covers
+// unbuffered and buffered channels alike.
+type chanTrace struct {
+	size  int
+	calls []chanCall
+}
+
+func (chanTrace) Generate(r *rand.Rand, size int) reflect.Value {
+	t := chanTrace{size: r.Intn(4), calls: make([]chanCall, r.Intn(size+1))}
+	for i := range t.calls {
+		t.calls[i] = chanCall{}.Generate(r, size).Interface().(chanCall)
+	}
+	return reflect.ValueOf(t)
+}
+
+func errString(r interface{}) interface{} {
+	if err, ok := r.(error); ok {
+		return err.Error()
+	}
+	return r
+}
+
+func applyModel(t chanTrace) []chanResult {
+	c := chanmodel.New(t.size)
+	var results []chanResult
+	for _, call := range t.calls {
+		var res chanResult
+		func() {
+			defer func() { res.panicked = errString(recover()) }()
+			switch call.op {
+			case opTrySend:
+				res.ok = c.TrySend(call.v)
+			case opTryRecv:
+				var selected bool
+				res.v, res.ok, selected = c.TryRecv()
+				res.n = boolInt(selected)
+			case opClose:
+				c.Close()
+			case opLen:
+				res.n = c.Len()
+			}
+		}()
+		results = append(results, res)
+	}
+	return results
+}
+
+func applyBuiltin(t chanTrace) []chanResult {
+	c := make(chan interface{}, t.size)
+	var results []chanResult
+	for _, call := range t.calls {
+		var res chanResult
+		func() {
+			defer func() { res.panicked = errString(recover()) }()
+			switch call.op {
+			case opTrySend:
+				select {
+				case c <- call.v:
+					res.ok = true
+				default:
+				}
+			case opTryRecv:
+				select {
+				case res.v, res.ok = <-c:
+					res.n = 1
+				default:
+				}
+			case opClose:
+				close(c)
+			case opLen:
+				res.n = len(c)
+			}
+		}()
+		results = append(results, res)
+	}
+	return results
+}
+
+func boolInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestChanMatchesBuiltin(t *testing.T) {
+	if err := quick.CheckEqual(applyModel, applyBuiltin, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+// waitFor waits until c has the given number of blocked senders and
+// receivers.
+func waitFor(t *testing.T, c *chanmodel.Chan, senders, receivers int) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		s, r := c.Waiting()
+		if s == senders && r == receivers {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Waiting() = %d, %d; want %d, %d", s, r, senders, receivers)
+		}
+		runtime.Gosched()
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestChanUnbufferedHandoff(t *testing.T) {
+	c := chanmodel.New(0)
+	sent := make(chan struct{})
+	go func() {
+		c.Send("x")
+		close(sent)
+	}()
+	waitFor(t, c, 1, 0)
+	select {
+	case <-sent:
+		t.Fatal("Send on an unbuffered channel returned before a receive")
+	default:
+	}
+	if v, ok := c.Recv(); v != "x" || !ok {
+		t.Fatalf("Recv() = %v, %v; want x, true", v, ok)
+	}
+	<-sent
+
+	// A waiting receiver is handed the value directly.
+	got := make(chan interface{})
+	go func() {
+		v, _ := c.Recv()
+		got <- v
+	}()
+	waitFor(t, c, 0, 1)
+	if !c.TrySend("y") {
+		t.Fatal("TrySend with a waiting receiver failed")
+	}
+	if v := <-got; v != "y" {
+		t.Fatalf("receiver got %v; want y", v)
+	}
+}
+
+// TestChanBufferedFIFO checks that values from senders blocked on a full
+// buffer are received after the buffered ones, in order.
+func TestChanBufferedFIFO(t *testing.T) {
+	const size = 3
+	c := chanmodel.New(size)
+	for i := 0; i < size; i++ {
+		c.Send(i)
+	}
+	for i := size; i < 2*size; i++ {
+		go c.Send(i)
+		waitFor(t, c, i-size+1, 0)
+	}
+	for i := 0; i < 2*size; i++ {
+		if v, ok := c.Recv(); v != i || !ok {
+			t.Fatalf("Recv() = %v, %v; want %d, true", v, ok, i)
+		}
+	}
+	waitFor(t, c, 0, 0)
+	if n := c.Len(); n != 0 {
+		t.Fatalf("Len() = %d after draining; want 0", n)
+	}
+}
+
+func TestChanCloseWakesWaiters(t *testing.T) {
+	c := chanmodel.New(0)
+	const receivers = 3
+	var wg sync.WaitGroup
+	for i := 0; i < receivers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, ok := c.Recv(); v != nil || ok {
+				t.Errorf("Recv() after Close = %v, %v; want nil, false", v, ok)
+			}
+		}()
+	}
+	waitFor(t, c, 0, receivers)
+	c.Close()
+	wg.Wait()
+
+	c = chanmodel.New(0)
+	panicked := make(chan interface{})
+	go func() {
+		defer func() { panicked <- errString(recover()) }()
+		c.Send(1)
+	}()
+	waitFor(t, c, 1, 0)
+	c.Close()
+	if r := <-panicked; r != "send on closed channel" {
+		t.Fatalf("blocked Send after Close panicked with %v; want send on closed channel", r)
+	}
+}
+
+func TestChanCloseKeepsBuffered(t *testing.T) {
+	c := chanmodel.New(2)
+	c.Send(1)
+	c.Send(2)
+	c.Close()
+	for _, want := range []interface{}{1, 2, nil} {
+		v, ok := c.Recv()
+		if v != want || ok != (want != nil) {
+			t.Fatalf("Recv() = %v, %v; want %v, %v", v, ok, want, want != nil)
+		}
+	}
+}
+
+func TestChanNil(t *testing.T) {
+	var c *chanmodel.Chan
+	if c.TrySend(1) {
+		t.Error("TrySend on a nil channel succeeded")
+	}
+	if _, _, selected := c.TryRecv(); selected {
+		t.Error("TryRecv on a nil channel succeeded")
+	}
+	if n := c.Len(); n != 0 {
+		t.Errorf("Len() = %d; want 0", n)
+	}
+	defer func() {
+		if r := errString(recover()); r != "close of nil channel" {
+			t.Errorf("Close panicked with %v; want close of nil channel", r)
+		}
+	}()
+	c.Close()
+}
+
+func TestChanConcurrent(t *testing.T) {
+	for _, size := range []int{0, 1, 16} {
+		const (
+			producers = 4
+			consumers = 4
+			n         = 2000
+		)
+		c := chanmodel.New(size)
+		var pwg, cwg sync.WaitGroup
+		for p := 0; p < producers; p++ {
+			pwg.Add(1)
+			go func() {
+				defer pwg.Done()
+				for i := 1; i <= n; i++ {
+					c.Send(i)
+				}
+			}()
+		}
+		sums := make([]int, consumers)
+		for i := range sums {
+			cwg.Add(1)
+			go func(i int) {
+				defer cwg.Done()
+				for {
+					v, ok := c.Recv()
+					if !ok {
+						return
+					}
+					sums[i] += v.(int)
+				}
+			}(i)
+		}
+		pwg.Wait()
+		c.Close()
+		cwg.Wait()
+		sum := 0
+		for _, s := range sums {
+			sum += s
+		}
+		if want := producers * n * (n + 1) / 2; sum != want {
+			t.Errorf("size %d: received sum %d; want %d", size, sum, want)
+		}
+	}
+}
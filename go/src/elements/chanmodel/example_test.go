@@ -0,0 +1,55 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chanmodel_test
+
+import (
+	"elements/chanmodel"
+	"fmt"
+)
+
+// This example shows that select picks uniformly among ready cases.
+// A fixed polling order would always pick the first ready case and starve
+// the others; selectgo shuffles the polling order on every call instead.
+func ExampleSelect_fairness() {
+	fast, slow := chanmodel.New(1), chanmodel.New(1)
+	fast.Send("fast")
+	slow.Send("slow")
+	cases := []chanmodel.SelectCase{
+		{Dir: chanmodel.SelectRecv, Chan: fast},
+		{Dir: chanmodel.SelectRecv, Chan: slow},
+	}
+	const n = 10000
+	var counts [2]int
+	for i := 0; i < n; i++ {
+		chosen, v, _ := chanmodel.Select(cases)
+		counts[chosen]++
+		// Refill the channel, so that both cases stay ready.
+		cases[chosen].Chan.Send(v)
+	}
+	for i, name := range []string{"fast", "slow"} {
+		share := counts[i] * 100 / n
+		fmt.Printf("%s chosen between 45%% and 55%% of the time: %v\n", name, share >= 45 && share < 55)
+	}
+	// Output:
+	// fast chosen between 45% and 55% of the time: true
+	// slow chosen between 45% and 55% of the time: true
+}
+
+// This example shows a non-blocking send, the select form the compiler
+// turns into a single TrySend.
+func ExampleSelect_default() {
+	c := chanmodel.New(1)
+	for i := 0; i < 3; i++ {
+		chosen, _, _ := chanmodel.Select([]chanmodel.SelectCase{
+			{Dir: chanmodel.SelectSend, Chan: c, Send: i},
+			{Dir: chanmodel.SelectDefault},
+		})
+		fmt.Println(i, map[int]string{0: "sent", 1: "dropped"}[chosen])
+	}
+	// Output:
+	// 0 sent
+	// 1 dropped
+	// 2 dropped
+}
@@ -0,0 +1,206 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chanmodel
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// This file models the parts of the runtime a channel depends on:
+// goroutines (g), their wait records (sudog) and parking.
+//
+// 这里的g并不是真正的goroutine, 只是一次阻塞操作期间代表调用者的记录.
+// runtime用gopark挂起goroutine, 用goready唤醒它; 这里用一个容量为1的
+// channel作为信号量来模拟, 挂起就是在它上面接收, 唤醒就是向它发送.
+
+// A g stands for the goroutine performing a blocking operation.
+type g struct {
+	// param is set by the goroutine that wakes this one up. For channel
+	// operations it points at the sudog that completed; nil means the
+	// channel was closed. This mirrors g.param in the runtime.
+	param unsafe.Pointer
+
+	// selectDone is set by the first channel that wins a blocked select,
+	// so that the other channels the select is waiting on do not wake it a
+	// second time. Accessed atomically.
+	selectDone uint32
+
+	// waiting is the list of sudogs a blocked select is queued with, in
+	// lock order, linked through sudog.waitlink.
+	waiting *sudog
+
+	sema chan struct{} // park/ready semaphore
+}
+
+// getg returns a g for the calling goroutine.
+//
+// runtime中getg返回当前goroutine的g, 它在goroutine的整个生命周期中不变;
+// 模型中没有goroutine的身份, 每次阻塞操作新建一个g, 只在这次操作期间使用
+func getg() *g {
+	return &g{sema: make(chan struct{}, 1)}
+}
+
+// gopark parks the calling goroutine until goready(gp) is called.
+// unlockf is called after the goroutine is committed to parking, in the
+// runtime from the scheduler's stack; here simply before blocking.
+//
+// runtime的gopark先切换到g0栈, 把goroutine状态改为_Gwaiting之后才调用unlockf
+// 释放channel的锁. 这样释放锁之后别人立即调用goready也不会丢失唤醒;
+// 模型中sema有一个缓冲位, 先goready后gopark同样不会丢失
+func gopark(gp *g, unlockf func()) {
+	if unlockf != nil {
+		unlockf()
+	}
+	<-gp.sema
+}
+
+// goready makes gp runnable again.
+func goready(gp *g) {
+	gp.sema <- struct{}{}
+}
+
+// A sudog represents a g in a wait list, such as a channel's sendq or
+// recvq. A g can be on many wait lists at once (a select), so there are
+// many sudogs for one g.
+//
+// sudog中保存了发送或接收的数据的位置, 另一方直接从这里读写数据,
+// 不需要经过channel的缓冲区
+type sudog struct {
+	g *g
+
+	next *sudog
+	prev *sudog
+	elem *interface{} // data element
+
+	// isSelect indicates g is participating in a select, so g.selectDone
+	// must be CAS'd to win the wake-up race.
+	isSelect bool
+
+	c *Chan // channel
+
+	waitlink *sudog // g.waiting list
+}
+
+// A waitq is a FIFO list of sudogs.
+type waitq struct {
+	first *sudog
+	last  *sudog
+}
+
+// loadFirst and setFirst access q.first atomically. It is only written
+// with the channel lock held, but the non-blocking fast paths read it
+// without the lock.
+func (q *waitq) loadFirst() *sudog {
+	return (*sudog)(atomic.LoadPointer((*unsafe.Pointer)(unsafe.Pointer(&q.first))))
+}
+
+func (q *waitq) setFirst(sgp *sudog) {
+	atomic.StorePointer((*unsafe.Pointer)(unsafe.Pointer(&q.first)), unsafe.Pointer(sgp))
+}
+
+func (q *waitq) enqueue(sgp *sudog) {
+	sgp.next = nil
+	x := q.last
+	if x == nil {
+		sgp.prev = nil
+		q.setFirst(sgp)
+		q.last = sgp
+		return
+	}
+	sgp.prev = x
+	x.next = sgp
+	q.last = sgp
+}
+
+func (q *waitq) dequeue() *sudog {
+	for {
+		sgp := q.first
+		if sgp == nil {
+			return nil
+		}
+		y := sgp.next
+		if y == nil {
+			q.setFirst(nil)
+			q.last = nil
+		} else {
+			y.prev = nil
+			q.setFirst(y)
+			sgp.next = nil // mark as removed (see dequeueSudog)
+		}
+
+		// if a goroutine was put on this queue because of a
+		// select, there is a small window between the goroutine
+		// being woken up by a different case and it grabbing the
+		// channel locks. Once it has the lock
+		// it removes itself from the queue, so we won't see it after that.
+		// We use a flag in the G struct to tell us when someone
+		// else has won the race to signal this goroutine but the goroutine
+		// hasn't removed itself from the queue yet.
+		//
+		// select同时挂在多个channel的等待队列上. 被其中一个channel唤醒之后,
+		// 它要重新获取所有channel的锁才能把自己从其他队列中摘掉, 在这之前
+		// 其他channel仍然可能从队列中取到它. CAS selectDone失败说明它已经被
+		// 别的channel抢先唤醒了, 跳过它
+		if sgp.isSelect && !atomic.CompareAndSwapUint32(&sgp.g.selectDone, 0, 1) {
+			continue
+		}
+
+		return sgp
+	}
+}
+
+// dequeueSudoG removes sgp from q, if it is still there. A select uses it
+// to take itself off the queues of the cases that did not fire.
+func (q *waitq) dequeueSudoG(sgp *sudog) {
+	x := sgp.prev
+	y := sgp.next
+	if x != nil {
+		if y != nil {
+			// middle of queue
+			x.next = y
+			y.prev = x
+			sgp.next = nil
+			sgp.prev = nil
+			return
+		}
+		// end of queue
+		x.next = nil
+		q.last = x
+		sgp.prev = nil
+		return
+	}
+	if y != nil {
+		// start of queue
+		y.prev = nil
+		q.setFirst(y)
+		sgp.next = nil
+		return
+	}
+
+	// x==y==nil. Either sgp is the only element in the queue,
+	// or it has already been removed. Use q.first to disambiguate.
+	if q.first == sgp {
+		q.setFirst(nil)
+		q.last = nil
+	}
+}
+
+func (q *waitq) len() int {
+	n := 0
+	for s := q.first; s != nil; s = s.next {
+		n++
+	}
+	return n
+}
+
+// A plainError is a runtime error that, like those raised by real
+// channels, does not have the "runtime error: " prefix.
+type plainError string
+
+func (e plainError) Error() string { return string(e) }
+
+// RuntimeError marks plainError as a runtime.Error.
+func (e plainError) RuntimeError() {}
@@ -0,0 +1,466 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chanmodel
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// This file models runtime/select.go.
+
+// A SelectDir describes the communication direction of a select case.
+type SelectDir int
+
+const (
+	_             SelectDir = iota
+	SelectSend              // case Chan <- Send
+	SelectRecv              // case <-Chan:
+	SelectDefault           // default
+)
+
+// A SelectCase describes a single case in a select operation, like
+// reflect.SelectCase. A nil Chan makes the case never ready.
+type SelectCase struct {
+	Dir  SelectDir   // direction of case
+	Chan *Chan       // channel to use (for send or receive)
+	Send interface{} // value to send (for send)
+}
+
+// scase is the runtime's view of a select case.
+type scase struct {
+	c    *Chan
+	dir  SelectDir
+	elem *interface{} // data element
+}
+
+// Select executes a select operation described by the list of cases,
+// like the Go select statement or reflect.Select. It blocks until at
+// least one of the cases can proceed, makes a uniform pseudo-random
+// choice, and then executes that case. It returns the index of the
+// chosen case and, if that case was a receive operation, the value
+// received and a boolean indicating whether the value corresponds to a
+// send on the channel (as opposed to a zero value received because the
+// channel is closed).
+func Select(cases []SelectCase) (chosen int, recv interface{}, recvOK bool) {
+	scases := make([]scase, len(cases))
+	var sendvals []interface{}
+	dfl := -1
+	for i, c := range cases {
+		switch c.Dir {
+		case SelectDefault:
+			if dfl >= 0 {
+				panic("chanmodel.Select: multiple default cases")
+			}
+			dfl = i
+			scases[i] = scase{dir: SelectDefault}
+		case SelectSend:
+			if sendvals == nil {
+				sendvals = make([]interface{}, len(cases))
+			}
+			sendvals[i] = c.Send
+			scases[i] = scase{c: c.Chan, dir: SelectSend, elem: &sendvals[i]}
+		case SelectRecv:
+			scases[i] = scase{c: c.Chan, dir: SelectRecv, elem: &recv}
+		default:
+			panic("chanmodel.Select: invalid Dir")
+		}
+	}
+	chosen, recvOK = selectgo(scases)
+	return chosen, recv, recvOK
+}
+
+func sellock(scases []scase, lockorder []uint16) {
+	var c *Chan
+	for _, o := range lockorder {
+		c0 := scases[o].c
+		// 按地址排序之后, 同一个channel的case是相邻的, 只锁一次
+		if c0 != nil && c0 != c {
+			c = c0
+			c.lock.Lock()
+		}
+	}
+}
+
+func selunlock(scases []scase, lockorder []uint16) {
+	// We must be very careful here to not touch sel after we have unlocked
+	// the last lock, because sel can be freed right after the last unlock.
+	// Consider the following situation.
+	// First M calls runtime·park() in runtime·selectgo() passing the sel.
+	// Once runtime·park() has unlocked the last lock, another M makes
+	// the G that calls select runnable again and schedules it for execution.
+	// When the G runs on another M, it locks all the locks and frees sel.
+	// Now if the first M touches sel, it will access freed memory.
+	for i := len(scases) - 1; i >= 0; i-- {
+		c := scases[lockorder[i]].c
+		if c == nil {
+			break
+		}
+		if i > 0 && c == scases[lockorder[i-1]].c {
+			continue // will unlock it on the next iteration
+		}
+		c.lock.Unlock()
+	}
+}
+
+// selparkcommit unlocks the channels of a parked select, in lock order.
+func selparkcommit(gp *g) {
+	var lastc *Chan
+	for sg := gp.waiting; sg != nil; sg = sg.waitlink {
+		// As soon as we unlock the channel, fields in
+		// any sudog with that channel may change,
+		// including c and waitlink. Since multiple
+		// sudogs may have the same channel, we unlock
+		// only after we've passed the last instance
+		// of a channel.
+		if sg.c != lastc && lastc != nil {
+			lastc.lock.Unlock()
+		}
+		lastc = sg.c
+	}
+	if lastc != nil {
+		lastc.lock.Unlock()
+	}
+}
+
+// sortkey orders channels for locking.
+func (c *Chan) sortkey() uintptr {
+	return uintptr(unsafe.Pointer(c))
+}
+
+// selectSeed feeds fastrandn with a different seed for every select.
+var selectSeed uint64
+
+// fastrand returns pseudo-random numbers for one select.
+//
+// runtime的fastrand是每个M上的xorshift状态, 不需要同步.
+// 模型中没有M, 每次select从一个全局计数器取一个种子, 之后在本地生成随机数
+type fastrand struct {
+	x uint64
+}
+
+func newFastrand() fastrand {
+	// splitmix64 of a Weyl sequence, so seeds of consecutive selects are
+	// unrelated.
+	z := atomic.AddUint64(&selectSeed, 0x9e3779b97f4a7c15)
+	z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+	z = (z ^ z>>27) * 0x94d049bb133111eb
+	z ^= z >> 31
+	if z == 0 {
+		z = 1
+	}
+	return fastrand{z}
+}
+
+// fastrandn returns a pseudo-random number in [0, n).
+func (r *fastrand) fastrandn(n uint32) uint32 {
+	r.x ^= r.x << 13
+	r.x ^= r.x >> 7
+	r.x ^= r.x << 17
+	// This is similar to fastrand() % n, but faster.
+	// See https://lemire.me/blog/2016/06/27/a-fast-alternative-to-the-modulo-reduction/
+	return uint32(uint64(uint32(r.x>>32)) * uint64(n) >> 32)
+}
+
+// selectgo implements the select statement.
+//
+// scases is the list of cases. The default case, if any, has dir
+// SelectDefault.
+//
+// selectgo returns the index of the chosen scase, which matches the
+// ordinal position of its respective select{recv,send,default} call.
+// Also, if the chosen scase was a receive operation, it reports whether
+// a value was received.
+func selectgo(scases []scase) (int, bool) {
+	ncases := len(scases)
+	if ncases > 1<<16 {
+		panic("chanmodel.Select: too many cases")
+	}
+	// runtime中pollorder和lockorder在调用者的栈上, 和scases一起由编译器分配
+	pollorder := make([]uint16, ncases)
+	lockorder := make([]uint16, ncases)
+
+	// generate permuted order
+	//
+	// 随机打乱轮询的顺序: 多个case同时就绪时每个被选中的概率相同,
+	// 排在前面的case不会让后面的case饿死
+	r := newFastrand()
+	for i := 1; i < ncases; i++ {
+		j := r.fastrandn(uint32(i + 1))
+		pollorder[i] = pollorder[j]
+		pollorder[j] = uint16(i)
+	}
+
+	// sort the cases by Hchan address to get the locking order.
+	// simple heap sort, to guarantee n log n time and constant stack footprint.
+	//
+	// 所有select都按channel的地址从小到大加锁. 两个select分别等待(a, b)和(b, a)时,
+	// 它们都先锁地址小的那个, 不会出现各持有一把锁等待对方的死锁
+	for i := 0; i < ncases; i++ {
+		j := i
+		// Start with the pollorder to permute cases on the same channel.
+		c := scases[pollorder[i]].c
+		for j > 0 && scases[lockorder[(j-1)/2]].c.sortkey() < c.sortkey() {
+			k := (j - 1) / 2
+			lockorder[j] = lockorder[k]
+			j = k
+		}
+		lockorder[j] = pollorder[i]
+	}
+	for i := ncases - 1; i >= 0; i-- {
+		o := lockorder[i]
+		c := scases[o].c
+		lockorder[i] = lockorder[0]
+		j := 0
+		for {
+			k := j*2 + 1
+			if k >= i {
+				break
+			}
+			if k+1 < i && scases[lockorder[k]].c.sortkey() < scases[lockorder[k+1]].c.sortkey() {
+				k++
+			}
+			if c.sortkey() < scases[lockorder[k]].c.sortkey() {
+				lockorder[j] = lockorder[k]
+				j = k
+				continue
+			}
+			break
+		}
+		lockorder[j] = o
+	}
+
+	// lock all the channels involved in the select
+	sellock(scases, lockorder)
+
+	var (
+		gp     *g
+		sg     *sudog
+		c      *Chan
+		k      *scase
+		sglist *sudog
+		sgnext *sudog
+		nextp  **sudog
+	)
+
+loop:
+	// pass 1 - look for something already waiting
+	//
+	// 第一轮: 持有所有channel的锁, 按pollorder找一个现在就能完成的case
+	dfli := -1
+	var casi int
+	var cas *scase
+	for i := 0; i < ncases; i++ {
+		casi = int(pollorder[i])
+		cas = &scases[casi]
+		c = cas.c
+
+		switch cas.dir {
+		case SelectDefault:
+			dfli = casi
+			continue
+
+		case SelectRecv:
+			if c == nil {
+				// nil channel上的case永远不会就绪
+				continue
+			}
+			sg = c.sendq.dequeue()
+			if sg != nil {
+				goto recv
+			}
+			if c.qcount > 0 {
+				goto bufrecv
+			}
+			if c.closed != 0 {
+				goto rclose
+			}
+
+		case SelectSend:
+			if c == nil {
+				continue
+			}
+			if c.closed != 0 {
+				goto sclose
+			}
+			sg = c.recvq.dequeue()
+			if sg != nil {
+				goto send
+			}
+			if c.qcount < c.dataqsiz {
+				goto bufsend
+			}
+		}
+	}
+
+	// 没有能完成的case, 有default就选default, 不阻塞
+	if dfli >= 0 {
+		selunlock(scases, lockorder)
+		casi = dfli
+		cas = &scases[casi]
+		goto retc
+	}
+
+	// pass 2 - enqueue on all chans
+	//
+	// 第二轮: 在每个case的channel上都挂一个sudog, 然后挂起.
+	// 任何一个channel上的操作都可能唤醒这个select
+	gp = getg()
+	if gp.waiting != nil {
+		panic("gp.waiting != nil")
+	}
+	nextp = &gp.waiting
+	for _, casei := range lockorder {
+		casi = int(casei)
+		cas = &scases[casi]
+		if cas.c == nil {
+			continue
+		}
+		c = cas.c
+		sg := &sudog{g: gp, isSelect: true, elem: cas.elem, c: c}
+		// Construct waiting list in lock order.
+		*nextp = sg
+		nextp = &sg.waitlink
+
+		switch cas.dir {
+		case SelectRecv:
+			c.recvq.enqueue(sg)
+
+		case SelectSend:
+			c.sendq.enqueue(sg)
+		}
+	}
+
+	// wait for someone to wake us up
+	gp.param = nil
+	gopark(gp, func() { selparkcommit(gp) })
+
+	sellock(scases, lockorder)
+
+	gp.selectDone = 0
+	sg = (*sudog)(gp.param)
+	gp.param = nil
+
+	// pass 3 - dequeue from unsuccessful chans
+	// otherwise they stack up on quiet channels
+	// record the successful case, if any.
+	// We singly-linked up the SudoGs in lock order.
+	//
+	// 第三轮: 唤醒者已经把成功的sudog从它的队列中取走了(gp.param指向它),
+	// 其余的sudog还挂在各自的队列上, 重新加锁后逐个摘掉
+	casi = -1
+	cas = nil
+	sglist = gp.waiting
+	// Clear all elem before unlinking from gp.waiting.
+	for sg1 := gp.waiting; sg1 != nil; sg1 = sg1.waitlink {
+		sg1.isSelect = false
+		sg1.elem = nil
+		sg1.c = nil
+	}
+	gp.waiting = nil
+
+	for _, casei := range lockorder {
+		k = &scases[casei]
+		if k.c == nil {
+			continue
+		}
+		if sg == sglist {
+			// sg has already been dequeued by the G that woke us up.
+			casi = int(casei)
+			cas = k
+		} else {
+			c = k.c
+			if k.dir == SelectSend {
+				c.sendq.dequeueSudoG(sglist)
+			} else {
+				c.recvq.dequeueSudoG(sglist)
+			}
+		}
+		sgnext = sglist.waitlink
+		sglist.waitlink = nil
+		sglist = sgnext
+	}
+
+	if cas == nil {
+		// We can wake up with gp.param == nil (so cas == nil)
+		// when a channel involved in the select has been closed.
+		// It is easiest to loop and re-run the operation;
+		// we'll see that it's now closed.
+		// Maybe some day we can signal the close explicitly,
+		// but we'd have to distinguish close-on-reader from close-on-writer.
+		// It's easiest not to duplicate the code and just recheck above.
+		// We know that something closed, and things never un-close,
+		// so we won't block again.
+		//
+		// 被close唤醒时param为nil, 此时仍然持有所有的锁, 回到第一轮重新检查,
+		// 一定能找到那个已经关闭的channel
+		goto loop
+	}
+
+	c = cas.c
+
+	if cas.dir == SelectRecv {
+		selunlock(scases, lockorder)
+		return casi, true
+	}
+
+	selunlock(scases, lockorder)
+	goto retc
+
+bufrecv:
+	// can receive from buffer
+	{
+		recvOK := true
+		qp := &c.buf[c.recvx]
+		if cas.elem != nil {
+			*cas.elem = *qp
+		}
+		*qp = nil
+		c.recvx++
+		if c.recvx == c.dataqsiz {
+			c.recvx = 0
+		}
+		c.setQcount(c.qcount - 1)
+		selunlock(scases, lockorder)
+		return casi, recvOK
+	}
+
+bufsend:
+	// can send to buffer
+	c.buf[c.sendx] = *cas.elem
+	c.sendx++
+	if c.sendx == c.dataqsiz {
+		c.sendx = 0
+	}
+	c.setQcount(c.qcount + 1)
+	selunlock(scases, lockorder)
+	goto retc
+
+recv:
+	// can receive from sleeping sender (sg)
+	c.recv(sg, cas.elem, func() { selunlock(scases, lockorder) })
+	return casi, true
+
+rclose:
+	// read at end of closed channel
+	selunlock(scases, lockorder)
+	if cas.elem != nil {
+		*cas.elem = nil
+	}
+	return casi, false
+
+send:
+	// can send to a sleeping receiver (sg)
+	c.send(sg, *cas.elem, func() { selunlock(scases, lockorder) })
+	goto retc
+
+retc:
+	return casi, false
+
+sclose:
+	// send on closed channel
+	selunlock(scases, lockorder)
+	panic(plainError("send on closed channel"))
+}
@@ -0,0 +1,195 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chanmodel_test
+
+import (
+	"elements/chanmodel"
+	"sync"
+	"testing"
+)
+
+func recvCase(c *chanmodel.Chan) chanmodel.SelectCase {
+	return chanmodel.SelectCase{Dir: chanmodel.SelectRecv, Chan: c}
+}
+
+func sendCase(c *chanmodel.Chan, v interface{}) chanmodel.SelectCase {
+	return chanmodel.SelectCase{Dir: chanmodel.SelectSend, Chan: c, Send: v}
+}
+
+var defaultCase = chanmodel.SelectCase{Dir: chanmodel.SelectDefault}
+
+func TestSelectPoll(t *testing.T) {
+	a, b := chanmodel.New(1), chanmodel.New(1)
+	cases := []chanmodel.SelectCase{recvCase(a), recvCase(b), defaultCase}
+	if chosen, _, _ := chanmodel.Select(cases); chosen != 2 {
+		t.Fatalf("Select with nothing ready chose %d; want default", chosen)
+	}
+	b.Send("b")
+	if chosen, v, ok := chanmodel.Select(cases); chosen != 1 || v != "b" || !ok {
+		t.Fatalf("Select() = %d, %v, %v; want 1, b, true", chosen, v, ok)
+	}
+	a.Send("a")
+	if chosen, _, _ := chanmodel.Select([]chanmodel.SelectCase{sendCase(a, "x"), defaultCase}); chosen != 1 {
+		t.Fatalf("Select sending to a full channel chose %d; want default", chosen)
+	}
+	if chosen, _, _ := chanmodel.Select([]chanmodel.SelectCase{sendCase(b, "y"), defaultCase}); chosen != 0 {
+		t.Fatalf("Select sending to a channel with room chose %d; want 0", chosen)
+	}
+	if v, _ := b.Recv(); v != "y" {
+		t.Fatalf("b received %v; want y", v)
+	}
+	// A nil channel is never ready.
+	if chosen, _, _ := chanmodel.Select([]chanmodel.SelectCase{recvCase(nil), sendCase(nil, 1), defaultCase}); chosen != 2 {
+		t.Fatalf("Select on nil channels chose %d; want default", chosen)
+	}
+}
+
+func TestSelectBlocks(t *testing.T) {
+	a, b := chanmodel.New(0), chanmodel.New(0)
+	type result struct {
+		chosen int
+		v      interface{}
+		ok     bool
+	}
+	done := make(chan result)
+	go func() {
+		chosen, v, ok := chanmodel.Select([]chanmodel.SelectCase{recvCase(a), recvCase(b)})
+		done <- result{chosen, v, ok}
+	}()
+	waitFor(t, a, 0, 1)
+	waitFor(t, b, 0, 1)
+	b.Send("b")
+	if r := <-done; r.chosen != 1 || r.v != "b" || !r.ok {
+		t.Fatalf("Select() = %v; want {1 b true}", r)
+	}
+	// The select must have taken itself off a's queue.
+	waitFor(t, a, 0, 0)
+	if a.TrySend("a") {
+		t.Fatal("TrySend found a receiver left behind by a finished select")
+	}
+
+	go func() {
+		chosen, v, ok := chanmodel.Select([]chanmodel.SelectCase{recvCase(a), sendCase(b, "to b")})
+		done <- result{chosen, v, ok}
+	}()
+	waitFor(t, b, 1, 0)
+	if v, _ := b.Recv(); v != "to b" {
+		t.Fatalf("b received %v; want to b", v)
+	}
+	if r := <-done; r.chosen != 1 {
+		t.Fatalf("Select() = %v; want the send case", r)
+	}
+	waitFor(t, a, 0, 0)
+}
+
+func TestSelectClose(t *testing.T) {
+	a, b := chanmodel.New(0), chanmodel.New(0)
+	done := make(chan [2]interface{})
+	go func() {
+		chosen, v, ok := chanmodel.Select([]chanmodel.SelectCase{recvCase(a), recvCase(b)})
+		done <- [2]interface{}{chosen, ok}
+		if v != nil {
+			t.Errorf("received %v from a closed channel; want nil", v)
+		}
+	}()
+	waitFor(t, b, 0, 1)
+	b.Close()
+	if r := <-done; r != [2]interface{}{1, false} {
+		t.Fatalf("Select() after Close = %v; want [1 false]", r)
+	}
+	waitFor(t, a, 0, 0)
+
+	defer func() {
+		if r := errString(recover()); r != "send on closed channel" {
+			t.Fatalf("Select sending on a closed channel panicked with %v", r)
+		}
+	}()
+	chanmodel.Select([]chanmodel.SelectCase{sendCase(b, 1), defaultCase})
+}
+
+// TestSelectSameChannel checks that a select with both a send and a
+// receive case on one channel does not communicate with itself.
+func TestSelectSameChannel(t *testing.T) {
+	c := chanmodel.New(0)
+	done := make(chan int)
+	go func() {
+		chosen, _, _ := chanmodel.Select([]chanmodel.SelectCase{sendCase(c, 1), recvCase(c)})
+		done <- chosen
+	}()
+	waitFor(t, c, 1, 1)
+	if v, _ := c.Recv(); v != 1 {
+		t.Fatalf("Recv() = %v; want 1", v)
+	}
+	if chosen := <-done; chosen != 0 {
+		t.Fatalf("Select chose %d; want the send case", chosen)
+	}
+	waitFor(t, c, 0, 0)
+}
+
+// TestSelectFairness checks that when several cases are ready, each is
+// chosen about equally often.
+func TestSelectFairness(t *testing.T) {
+	const n = 10000
+	cs := []*chanmodel.Chan{chanmodel.New(1), chanmodel.New(1), chanmodel.New(1)}
+	cases := make([]chanmodel.SelectCase, len(cs))
+	for i, c := range cs {
+		c.Send(i)
+		cases[i] = recvCase(c)
+	}
+	counts := make([]int, len(cs))
+	for i := 0; i < n; i++ {
+		chosen, _, _ := chanmodel.Select(cases)
+		counts[chosen]++
+		cs[chosen].Send(chosen)
+	}
+	for i, got := range counts {
+		if want := n / len(cs); got < want*8/10 || got > want*12/10 {
+			t.Errorf("case %d chosen %d times out of %d; want about %d", i, got, n, want)
+		}
+	}
+}
+
+// TestSelectLockOrder runs selects that list the same channels in opposite
+// orders. Without a global lock order they would deadlock.
+func TestSelectLockOrder(t *testing.T) {
+	const (
+		workers = 8
+		n       = 500
+	)
+	a, b := chanmodel.New(0), chanmodel.New(0)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	sent, received := 0, 0
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			x, y := a, b
+			if w%2 == 1 {
+				x, y = b, a
+			}
+			for i := 0; i < n; i++ {
+				var cases []chanmodel.SelectCase
+				if w < workers/2 {
+					cases = []chanmodel.SelectCase{sendCase(x, 1), sendCase(y, 1)}
+				} else {
+					cases = []chanmodel.SelectCase{recvCase(x), recvCase(y)}
+				}
+				_, v, ok := chanmodel.Select(cases)
+				mu.Lock()
+				if ok {
+					received += v.(int)
+				} else {
+					sent++
+				}
+				mu.Unlock()
+			}
+		}(w)
+	}
+	wg.Wait()
+	if want := workers / 2 * n; sent != want || received != want {
+		t.Fatalf("sent %d, received %d; want %d each", sent, received, want)
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chanx
+
+import "time"
+
+// BatchConfig configures a Batcher.
+type BatchConfig struct {
+	// Size is the largest batch. A batch is delivered as soon as it has
+	// Size values. Size must be positive.
+	Size int
+
+	// MaxDelay bounds how long the first value of a batch waits for the
+	// batch to fill: a partial batch is delivered MaxDelay after its first
+	// value arrived. Zero means batches are only delivered full, or when
+	// In is closed.
+	MaxDelay time.Duration
+}
+
+// A Batcher groups the values sent on In into slices of up to Size
+// values for Out, the usual pattern in front of a database or a remote
+// API that is much cheaper per value when called with many at once.
+//
+// Each batch is a new slice that the receiver owns. No empty batch is
+// ever delivered. Closing In delivers the pending partial batch, then
+// closes Out.
+//
+// While a batch waits for a receiver on Out, the Batcher reads no more
+// values, so a slow receiver pushes back on the senders instead of
+// letting the batches pile up.
+type Batcher struct {
+	// In is the sending side. Close it when done.
+	In chan<- interface{}
+
+	// Out receives the batches.
+	Out <-chan []interface{}
+
+	in  chan interface{}
+	out chan []interface{}
+	cfg BatchConfig
+}
+
+// NewBatcher returns a Batcher configured by cfg.
+func NewBatcher(cfg BatchConfig) *Batcher {
+	if cfg.Size < 1 {
+		panic("chanx: non-positive batch Size")
+	}
+	b := &Batcher{
+		in:  make(chan interface{}),
+		out: make(chan []interface{}),
+		cfg: cfg,
+	}
+	b.In, b.Out = b.in, b.out
+	go b.run()
+	return b
+}
+
+func (b *Batcher) run() {
+	defer close(b.out)
+	var (
+		batch []interface{}
+		timer *time.Timer
+		// 没有未满的批时是nil, select中这个case不会被选中. 不用一直走的Ticker:
+		// 它会在批刚开始时就触发, 第一个值等待的时间不到MaxDelay
+		expired <-chan time.Time
+	)
+	deliver := func() {
+		b.out <- batch
+		batch = nil
+	}
+	flush := func() {
+		if expired != nil {
+			// Stop返回false说明定时器已经触发, 值还在C中, 必须取走, 否则下一批
+			// Reset之后会立刻读到这个过时的值
+			if !timer.Stop() {
+				<-timer.C
+			}
+			expired = nil
+		}
+		deliver()
+	}
+	for {
+		select {
+		case v, ok := <-b.in:
+			if !ok {
+				if len(batch) > 0 {
+					flush()
+				}
+				return
+			}
+			if batch == nil {
+				batch = make([]interface{}, 0, b.cfg.Size)
+				if b.cfg.MaxDelay > 0 {
+					if timer == nil {
+						timer = time.NewTimer(b.cfg.MaxDelay)
+					} else {
+						timer.Reset(b.cfg.MaxDelay)
+					}
+					expired = timer.C
+				}
+			}
+			batch = append(batch, v)
+			if len(batch) == b.cfg.Size {
+				flush()
+			}
+		case <-expired:
+			expired = nil
+			deliver()
+		}
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chanx_test
+
+import (
+	"elements/chanx"
+	"testing"
+	"time"
+)
+
+func TestBatchSize(t *testing.T) {
+	b := chanx.NewBatcher(chanx.BatchConfig{Size: 3})
+	go func() {
+		for i := 0; i < 8; i++ {
+			b.In <- i
+		}
+		close(b.In)
+	}()
+	var sizes []int
+	next := 0
+	for batch := range b.Out {
+		sizes = append(sizes, len(batch))
+		for _, v := range batch {
+			if v != next {
+				t.Fatalf("got %v, want %d", v, next)
+			}
+			next++
+		}
+	}
+	// 关闭时交出最后一个不满的批
+	if !equal(sizes, []int{3, 3, 2}) {
+		t.Errorf("batch sizes %v, want [3 3 2]", sizes)
+	}
+}
+
+func TestBatchDelay(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	b := chanx.NewBatcher(chanx.BatchConfig{Size: 100, MaxDelay: delay})
+	for round := 0; round < 3; round++ {
+		start := time.Now()
+		b.In <- 1
+		b.In <- 2
+		batch := <-b.Out
+		if len(batch) != 2 {
+			t.Fatalf("round %d: batch %v", round, batch)
+		}
+		// 定时器从这一批的第一个值开始计时, 上一批残留的触发不能让它提前
+		if d := time.Since(start); d < delay {
+			t.Errorf("round %d: batch delivered after %v, before MaxDelay", round, d)
+		}
+	}
+	close(b.In)
+	if batch, ok := <-b.Out; ok {
+		t.Errorf("got batch %v after close, want none", batch)
+	}
+}
+
+// 满了交出去的批停掉定时器: 下一批不会被上一批的定时器提前交出
+func TestBatchFullStopsTimer(t *testing.T) {
+	const delay = 30 * time.Millisecond
+	b := chanx.NewBatcher(chanx.BatchConfig{Size: 2, MaxDelay: delay})
+	b.In <- 1
+	b.In <- 2
+	<-b.Out
+	time.Sleep(delay) // 第一批的定时器如果没停, 这时已经触发
+	start := time.Now()
+	b.In <- 3
+	<-b.Out
+	if d := time.Since(start); d < delay {
+		t.Errorf("partial batch delivered after %v, before MaxDelay", d)
+	}
+	close(b.In)
+}
+
+// 批没有被取走时不再读输入, 压力传回发送者
+func TestBatchBackpressure(t *testing.T) {
+	b := chanx.NewBatcher(chanx.BatchConfig{Size: 1})
+	b.In <- 1
+	select {
+	case b.In <- 2:
+		t.Error("send accepted while the previous batch is not received")
+	case <-time.After(20 * time.Millisecond):
+	}
+	<-b.Out
+	close(b.In)
+}
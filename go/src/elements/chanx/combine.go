@@ -0,0 +1,178 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chanx
+
+import (
+	"context"
+	"sync"
+)
+
+// The combinators below each start goroutines that forward values
+// between channels. They all follow the same rules:
+//
+//   - An output channel is closed when its inputs are exhausted or ctx is
+//     done, whichever comes first, so that ranging over it terminates.
+//   - When ctx is done the goroutines return even if nobody is receiving;
+//     a value they were holding is dropped. Cancelling ctx is the way to
+//     stop them early, and never cancelling it while also abandoning the
+//     outputs leaks them.
+//   - Input channels are never closed: they belong to the sender.
+
+// OrDone returns a channel that receives the values of ch until ch is
+// closed or ctx is done.
+//
+// It replaces the select that every loop over a channel otherwise needs
+// in order to be cancellable:
+//
+//	for v := range chanx.OrDone(ctx, ch) {
+//		...
+//	}
+func OrDone(ctx context.Context, ch <-chan interface{}) <-chan interface{} {
+	out := make(chan interface{})
+	go func() {
+		defer close(out)
+		for {
+			select {
+			case v, ok := <-ch:
+				if !ok {
+					return
+				}
+				// 拿到值之后发送也要能被取消, 否则接收者走了就停在这里
+				select {
+				case out <- v:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// Merge returns a channel that receives the values of all of chs. It is
+// closed when every one of chs is closed, or when ctx is done. The values
+// of each input keep their order; values of different inputs interleave.
+func Merge(ctx context.Context, chs ...<-chan interface{}) <-chan interface{} {
+	out := make(chan interface{})
+	var wg sync.WaitGroup
+	wg.Add(len(chs))
+	for _, ch := range chs {
+		go func(ch <-chan interface{}) {
+			defer wg.Done()
+			for v := range OrDone(ctx, ch) {
+				select {
+				case out <- v:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}(ch)
+	}
+	// 所有转发的goroutine都结束之后才能关闭out, 否则它们会向关闭的channel发送
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+// A SplitPolicy decides which output of Split receives a value.
+type SplitPolicy int
+
+const (
+	// RoundRobin sends the values to the outputs in turn, waiting for
+	// the next one in line even if another one is ready.
+	RoundRobin SplitPolicy = iota
+
+	// FirstReady sends each value to whichever output receives first, so
+	// a slow consumer gets fewer values.
+	FirstReady
+)
+
+// Split distributes the values of ch over n channels, each value to one
+// of them, according to policy. The outputs are closed when ch is closed
+// or ctx is done.
+//
+// With RoundRobin a consumer that stops receiving stalls all the outputs.
+// With FirstReady it only keeps the one value its output is offering.
+func Split(ctx context.Context, ch <-chan interface{}, n int, policy SplitPolicy) []<-chan interface{} {
+	if n < 1 {
+		panic("chanx: Split into fewer than one channel")
+	}
+	outs := make([]chan interface{}, n)
+	ro := make([]<-chan interface{}, n)
+	for i := range outs {
+		outs[i] = make(chan interface{})
+		ro[i] = outs[i]
+	}
+	switch policy {
+	case RoundRobin:
+		go func() {
+			defer func() {
+				for _, out := range outs {
+					close(out)
+				}
+			}()
+			i := 0
+			for v := range OrDone(ctx, ch) {
+				select {
+				case outs[i] <- v:
+				case <-ctx.Done():
+					return
+				}
+				i = (i + 1) % n
+			}
+		}()
+	case FirstReady:
+		// 每个输出一个goroutine, 从ch取一个值, 等自己的消费者收走再取下一个.
+		// 哪个消费者先接收, 它的goroutine就先回来取值. 每个goroutine在ch关闭
+		// 后关闭自己的输出, 一个停住的消费者不会让别的输出一直不关闭
+		src := OrDone(ctx, ch)
+		for _, out := range outs {
+			go func(out chan interface{}) {
+				defer close(out)
+				for v := range src {
+					select {
+					case out <- v:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}(out)
+		}
+	default:
+		panic("chanx: unknown SplitPolicy")
+	}
+	return ro
+}
+
+// Tee returns two channels that both receive every value of ch. A value
+// is delivered to both before the next one is read, so the slower
+// consumer paces the faster. Both are closed when ch is closed or ctx is
+// done.
+func Tee(ctx context.Context, ch <-chan interface{}) (<-chan interface{}, <-chan interface{}) {
+	out1, out2 := make(chan interface{}), make(chan interface{})
+	go func() {
+		defer close(out1)
+		defer close(out2)
+		for v := range OrDone(ctx, ch) {
+			// 两个都发送完才读下一个. 发出去的那个case换成nil channel, 不会再被选中
+			o1, o2 := out1, out2
+			for i := 0; i < 2; i++ {
+				select {
+				case o1 <- v:
+					o1 = nil
+				case o2 <- v:
+					o2 = nil
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return out1, out2
+}
@@ -0,0 +1,180 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chanx_test
+
+import (
+	"context"
+	"elements/chanx"
+	"runtime"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+func gen(vs ...int) <-chan interface{} {
+	ch := make(chan interface{})
+	go func() {
+		defer close(ch)
+		for _, v := range vs {
+			ch <- v
+		}
+	}()
+	return ch
+}
+
+// genCtx is gen for the cancellation tests: its sender, too, has to stop
+// when nobody reads any more.
+func genCtx(ctx context.Context, vs ...int) <-chan interface{} {
+	ch := make(chan interface{})
+	go func() {
+		defer close(ch)
+		for _, v := range vs {
+			select {
+			case ch <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return ch
+}
+
+func ints(vs []interface{}) []int {
+	out := make([]int, len(vs))
+	for i, v := range vs {
+		out[i] = v.(int)
+	}
+	return out
+}
+
+func equal(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// 检查测试结束后没有留下转发的goroutine
+func checkNoLeak(t *testing.T, before int) {
+	t.Helper()
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); {
+		if runtime.NumGoroutine() <= before {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Errorf("%d goroutines left running", runtime.NumGoroutine()-before)
+}
+
+func TestOrDone(t *testing.T) {
+	before := runtime.NumGoroutine()
+	got := ints(drain(chanx.OrDone(context.Background(), gen(1, 2, 3))))
+	if !equal(got, []int{1, 2, 3}) {
+		t.Errorf("got %v", got)
+	}
+
+	// 输入永远不关闭, 取消之后输出也关闭
+	ctx, cancel := context.WithCancel(context.Background())
+	never := make(chan interface{})
+	out := chanx.OrDone(ctx, never)
+	cancel()
+	if _, ok := <-out; ok {
+		t.Error("received from a cancelled OrDone")
+	}
+	checkNoLeak(t, before)
+}
+
+func TestMerge(t *testing.T) {
+	before := runtime.NumGoroutine()
+	got := ints(drain(chanx.Merge(context.Background(), gen(1, 2, 3), gen(4, 5), gen())))
+	sort.Ints(got)
+	if !equal(got, []int{1, 2, 3, 4, 5}) {
+		t.Errorf("got %v", got)
+	}
+	if _, ok := <-chanx.Merge(context.Background()); ok {
+		t.Error("Merge of nothing is not closed")
+	}
+	checkNoLeak(t, before)
+}
+
+// 消费者读了一个值就走了, 取消之后转发的goroutine都要退出
+func TestMergeCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	out := chanx.Merge(ctx, genCtx(ctx, 1, 2, 3), genCtx(ctx, 4, 5, 6))
+	<-out
+	cancel()
+	drain(out)
+	checkNoLeak(t, before)
+}
+
+func TestSplitRoundRobin(t *testing.T) {
+	outs := chanx.Split(context.Background(), gen(0, 1, 2, 3, 4, 5, 6), 3, chanx.RoundRobin)
+	got := make([][]int, len(outs))
+	var wg sync.WaitGroup
+	for i, out := range outs {
+		wg.Add(1)
+		go func(i int, out <-chan interface{}) {
+			defer wg.Done()
+			got[i] = ints(drain(out))
+		}(i, out)
+	}
+	wg.Wait()
+	want := [][]int{{0, 3, 6}, {1, 4}, {2, 5}}
+	for i := range want {
+		if !equal(got[i], want[i]) {
+			t.Errorf("output %d got %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+// 只有一个消费者在读, FirstReady把所有的值都给它(另一个输出最多拿走一个)
+func TestSplitFirstReady(t *testing.T) {
+	before := runtime.NumGoroutine()
+	vs := make([]int, 100)
+	for i := range vs {
+		vs[i] = i
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	outs := chanx.Split(ctx, gen(vs...), 2, chanx.FirstReady)
+	n := len(drain(outs[0]))
+	if n < len(vs)-1 {
+		t.Errorf("the only reader got %d of %d values", n, len(vs))
+	}
+	// outs[1]的goroutine还拿着一个值等它的消费者: 取消后它也退出
+	cancel()
+	drain(outs[1])
+	checkNoLeak(t, before)
+}
+
+func TestTee(t *testing.T) {
+	a, b := chanx.Tee(context.Background(), gen(1, 2, 3))
+	var ga, gb []int
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() { defer wg.Done(); ga = ints(drain(a)) }()
+	go func() { defer wg.Done(); gb = ints(drain(b)) }()
+	wg.Wait()
+	if !equal(ga, []int{1, 2, 3}) || !equal(gb, []int{1, 2, 3}) {
+		t.Errorf("got %v and %v", ga, gb)
+	}
+}
+
+func TestTeeCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	a, b := chanx.Tee(ctx, genCtx(ctx, 1, 2, 3))
+	<-a // b没有人读, Tee停在第一个值上
+	cancel()
+	drain(a)
+	drain(b)
+	checkNoLeak(t, before)
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chanx
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrClosed is returned by RecvCtx and the Select functions when the
+// channel they received from is closed.
+var ErrClosed = errors.New("chanx: channel closed")
+
+// SendCtx sends v on ch, or returns ctx.Err() if ctx is done first.
+//
+// If ctx is already done SendCtx does not send, even if ch is ready: a
+// plain select would pick one of the two at random.
+func SendCtx(ctx context.Context, ch chan<- interface{}, v interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case ch <- v:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RecvCtx receives a value from ch. It returns ErrClosed if ch is
+// closed, and ctx.Err() if ctx is done first. Like SendCtx, it does not
+// receive if ctx is already done.
+func RecvCtx(ctx context.Context, ch <-chan interface{}) (interface{}, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	select {
+	case v, ok := <-ch:
+		if !ok {
+			return nil, ErrClosed
+		}
+		return v, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Select2 receives from whichever of ch0 and ch1 is ready first, and
+// returns the index of that channel and the value. If the channel is
+// closed, err is ErrClosed and i still says which one; a nil channel is
+// never ready, so passing nil for a closed channel removes it from the
+// choice. If ctx is done first, i is -1 and err is ctx.Err().
+func Select2(ctx context.Context, ch0, ch1 <-chan interface{}) (i int, v interface{}, err error) {
+	if err := ctx.Err(); err != nil {
+		return -1, nil, err
+	}
+	var ok bool
+	select {
+	case v, ok = <-ch0:
+		i = 0
+	case v, ok = <-ch1:
+		i = 1
+	case <-ctx.Done():
+		return -1, nil, ctx.Err()
+	}
+	if !ok {
+		return i, nil, ErrClosed
+	}
+	return i, v, nil
+}
+
+// Select3 is Select2 for three channels.
+func Select3(ctx context.Context, ch0, ch1, ch2 <-chan interface{}) (i int, v interface{}, err error) {
+	if err := ctx.Err(); err != nil {
+		return -1, nil, err
+	}
+	var ok bool
+	select {
+	case v, ok = <-ch0:
+		i = 0
+	case v, ok = <-ch1:
+		i = 1
+	case v, ok = <-ch2:
+		i = 2
+	case <-ctx.Done():
+		return -1, nil, ctx.Err()
+	}
+	if !ok {
+		return i, nil, ErrClosed
+	}
+	return i, v, nil
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chanx_test
+
+import (
+	"context"
+	"elements/chanx"
+	"testing"
+	"time"
+)
+
+func TestSendRecvCtx(t *testing.T) {
+	ctx := context.Background()
+	ch := make(chan interface{}, 1)
+	if err := chanx.SendCtx(ctx, ch, 1); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := chanx.RecvCtx(ctx, ch); v != 1 || err != nil {
+		t.Fatalf("RecvCtx = %v, %v", v, err)
+	}
+	close(ch)
+	if _, err := chanx.RecvCtx(ctx, ch); err != chanx.ErrClosed {
+		t.Fatalf("RecvCtx on a closed channel: %v", err)
+	}
+}
+
+func TestSendRecvCtxTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ch := make(chan interface{})
+	if err := chanx.SendCtx(ctx, ch, 1); err != context.DeadlineExceeded {
+		t.Errorf("SendCtx without a receiver: %v", err)
+	}
+	if _, err := chanx.RecvCtx(ctx, ch); err != context.DeadlineExceeded {
+		t.Errorf("RecvCtx without a sender: %v", err)
+	}
+}
+
+// ctx已经结束时, 即使channel就绪也不发送和接收
+func TestCtxDoneFirst(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	ch := make(chan interface{}, 1)
+	for i := 0; i < 100; i++ {
+		if err := chanx.SendCtx(ctx, ch, 1); err != context.Canceled || len(ch) != 0 {
+			t.Fatalf("SendCtx after cancel: %v, len %d", err, len(ch))
+		}
+	}
+	ch <- 1
+	for i := 0; i < 100; i++ {
+		if _, err := chanx.RecvCtx(ctx, ch); err != context.Canceled || len(ch) != 1 {
+			t.Fatalf("RecvCtx after cancel: %v, len %d", err, len(ch))
+		}
+	}
+	if i, _, err := chanx.Select2(ctx, ch, ch); i != -1 || err != context.Canceled {
+		t.Fatalf("Select2 after cancel: %d, %v", i, err)
+	}
+}
+
+func TestSelect(t *testing.T) {
+	ctx := context.Background()
+	a, b, c := make(chan interface{}, 1), make(chan interface{}, 1), make(chan interface{}, 1)
+	b <- "b"
+	if i, v, err := chanx.Select2(ctx, a, b); i != 1 || v != "b" || err != nil {
+		t.Errorf("Select2 = %d, %v, %v", i, v, err)
+	}
+	close(c)
+	if i, _, err := chanx.Select3(ctx, a, b, c); i != 2 || err != chanx.ErrClosed {
+		t.Errorf("Select3 on a closed channel = %d, %v", i, err)
+	}
+	// 关闭的channel换成nil, 不再参与选择
+	a <- "a"
+	if i, v, err := chanx.Select3(ctx, a, b, nil); i != 0 || v != "a" || err != nil {
+		t.Errorf("Select3 = %d, %v, %v", i, v, err)
+	}
+	ctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if i, _, err := chanx.Select3(ctx, a, b, nil); i != -1 || err != context.DeadlineExceeded {
+		t.Errorf("Select3 on idle channels = %d, %v", i, err)
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chanx_test
+
+import (
+	"context"
+	"elements/chanx"
+	"fmt"
+	"sync"
+)
+
+func ExampleUnbounded() {
+	u := chanx.NewUnbounded(2)
+	// 没有接收者, 发送也不会阻塞
+	for _, ev := range []string{"open", "write", "write", "close"} {
+		u.In <- ev
+	}
+	close(u.In)
+	for ev := range u.Out {
+		fmt.Println(ev)
+	}
+	// Output:
+	// open
+	// write
+	// write
+	// close
+}
+
+func ExamplePriorityChan() {
+	p := chanx.NewPriorityChan(chanx.PriorityConfig{})
+	for i := 1; i <= 3; i++ {
+		p.Send(fmt.Sprintf("data %d", i), 0)
+	}
+	// 排在三条数据后面发送, 但先被接收
+	p.Send("heartbeat", 1)
+	p.Close()
+	for msg := range p.Out {
+		fmt.Println(msg)
+	}
+	// Output:
+	// heartbeat
+	// data 1
+	// data 2
+	// data 3
+}
+
+func ExampleTee() {
+	src := make(chan interface{})
+	go func() {
+		defer close(src)
+		for _, line := range []string{"GET /", "GET /favicon.ico"} {
+			src <- line
+		}
+	}()
+	// 一份写日志, 一份统计
+	log, count := chanx.Tee(context.Background(), src)
+	done := make(chan int)
+	go func() {
+		n := 0
+		for range count {
+			n++
+		}
+		done <- n
+	}()
+	for line := range log {
+		fmt.Println(line)
+	}
+	fmt.Println(<-done, "requests")
+	// Output:
+	// GET /
+	// GET /favicon.ico
+	// 2 requests
+}
+
+func ExampleRingChan() {
+	samples := chanx.NewRingChan(2)
+	// 热路径上的发送从不阻塞, 消费者跟不上时丢最老的
+	for _, ms := range []int{12, 15, 11, 40} {
+		samples.Send(ms)
+	}
+	samples.Close()
+	for ms := range samples.Out {
+		fmt.Println(ms)
+	}
+	fmt.Println("dropped", samples.Dropped())
+	// Output:
+	// 11
+	// 40
+	// dropped 2
+}
+
+func ExampleCollectMap() {
+	ctx := context.Background()
+	results := make(chan chanx.Result)
+	var wg sync.WaitGroup
+	for _, n := range []int{4, -1, 9} {
+		wg.Add(1)
+		go func(n int) {
+			defer wg.Done()
+			r := chanx.Result{Key: n, Value: n * n}
+			if n < 0 {
+				r = chanx.Result{Key: n, Err: fmt.Errorf("negative: %d", n)}
+			}
+			chanx.SendResult(ctx, results, r)
+		}(n)
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	m, _ := chanx.CollectMap(ctx, results)
+	fmt.Println(m[4].Value, m[9].Value, m[-1].Err)
+	// Output: 16 81 negative: -1
+}
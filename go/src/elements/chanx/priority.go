@@ -0,0 +1,136 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chanx
+
+import (
+	"elements/heap"
+	"sync/atomic"
+	"time"
+)
+
+// PriorityConfig configures a PriorityChan.
+type PriorityConfig struct {
+	// AgeStep makes waiting values gain one priority level per AgeStep,
+	// so that a steady stream of high-priority values cannot starve the
+	// low-priority ones forever: a value of priority 0 that has waited
+	// 3*AgeStep goes before a value of priority 2 sent just now. Zero
+	// means strict priority.
+	AgeStep time.Duration
+}
+
+// A PriorityChan is an unbounded channel whose receivers get the
+// highest-priority value buffered at the time, rather than the oldest.
+// Values of equal priority are received in the order they were sent.
+//
+// Typical use is a control plane sharing a connection with bulk traffic:
+// a cancellation or heartbeat sent behind thousands of queued data
+// messages should still go out next.
+type PriorityChan struct {
+	// Out is the receiving side. It is closed after Close, once every
+	// value has been received.
+	Out <-chan interface{}
+
+	in      chan *prioritized
+	out     chan interface{}
+	h       prioritizedHeap
+	ageStep int64
+	seq     uint64
+	len     int64
+}
+
+type prioritized struct {
+	v   interface{}
+	key int64 // 越大越先出
+	seq uint64
+}
+
+type prioritizedHeap []*prioritized
+
+func (h prioritizedHeap) Len() int { return len(h) }
+
+func (h prioritizedHeap) Less(i, j int) bool {
+	if h[i].key != h[j].key {
+		return h[i].key > h[j].key
+	}
+	return h[i].seq < h[j].seq
+}
+
+func (h prioritizedHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *prioritizedHeap) Push(x interface{}) { *h = append(*h, x.(*prioritized)) }
+
+func (h *prioritizedHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return x
+}
+
+// NewPriorityChan returns a PriorityChan configured by cfg.
+func NewPriorityChan(cfg PriorityConfig) *PriorityChan {
+	p := &PriorityChan{
+		in:      make(chan *prioritized),
+		out:     make(chan interface{}),
+		ageStep: int64(cfg.AgeStep),
+	}
+	p.Out = p.out
+	go p.run()
+	return p
+}
+
+// Send sends v with the given priority; higher priorities are received
+// first. Send does not wait for a receiver. Sending after Close panics.
+func (p *PriorityChan) Send(v interface{}, priority int) {
+	x := &prioritized{v: v, key: int64(priority)}
+	if p.ageStep > 0 {
+		// 等待了t的值的有效优先级是priority + t/AgeStep, 即
+		// priority + now/AgeStep - sent/AgeStep. now/AgeStep对所有值都一样,
+		// 不影响顺序, 所以按priority*AgeStep - sent排序, 排序键不随时间变化,
+		// 堆不需要调整
+		x.key = int64(priority)*p.ageStep - time.Now().UnixNano()
+	}
+	atomic.AddInt64(&p.len, 1)
+	p.in <- x
+}
+
+// Close marks the end of the values. Out is closed once they have all
+// been received.
+func (p *PriorityChan) Close() { close(p.in) }
+
+// Len returns the number of values sent and not yet received.
+func (p *PriorityChan) Len() int { return int(atomic.LoadInt64(&p.len)) }
+
+func (p *PriorityChan) run() {
+	defer close(p.out)
+	in := p.in
+	for in != nil || len(p.h) > 0 {
+		if len(p.h) == 0 {
+			x, ok := <-in
+			if !ok {
+				return
+			}
+			p.push(x)
+			continue
+		}
+		// 每次都把当前的堆顶放进select: 新到的值可能比它优先
+		select {
+		case x, ok := <-in:
+			if !ok {
+				in = nil
+				continue
+			}
+			p.push(x)
+		case p.out <- p.h[0].v:
+			heap.Pop(&p.h)
+			atomic.AddInt64(&p.len, -1)
+		}
+	}
+}
+
+func (p *PriorityChan) push(x *prioritized) {
+	x.seq = p.seq
+	p.seq++
+	heap.Push(&p.h, x)
+}
@@ -0,0 +1,77 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chanx_test
+
+import (
+	"elements/chanx"
+	"testing"
+	"time"
+)
+
+func drain(c <-chan interface{}) []interface{} {
+	var vs []interface{}
+	for v := range c {
+		vs = append(vs, v)
+	}
+	return vs
+}
+
+func TestPriorityOrder(t *testing.T) {
+	p := chanx.NewPriorityChan(chanx.PriorityConfig{})
+	sends := []struct {
+		v    string
+		prio int
+	}{{"a", 0}, {"b", 1}, {"c", 0}, {"d", 5}, {"e", 1}, {"f", -1}}
+	for _, s := range sends {
+		p.Send(s.v, s.prio)
+	}
+	if p.Len() != len(sends) {
+		t.Errorf("Len = %d, want %d", p.Len(), len(sends))
+	}
+	p.Close()
+	got := drain(p.Out)
+	want := []interface{}{"d", "b", "e", "a", "c", "f"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+	if p.Len() != 0 {
+		t.Errorf("Len = %d after draining", p.Len())
+	}
+}
+
+// 接收者一直在等时, 高优先级的值插到已经排队的低优先级值的前面
+func TestPriorityPreempts(t *testing.T) {
+	p := chanx.NewPriorityChan(chanx.PriorityConfig{})
+	for i := 0; i < 100; i++ {
+		p.Send(i, 0)
+	}
+	<-p.Out
+	p.Send("cancel", 10)
+	if v := <-p.Out; v != "cancel" {
+		t.Errorf("received %v, want cancel", v)
+	}
+	p.Close()
+	if n := len(drain(p.Out)); n != 99 {
+		t.Errorf("%d values left, want 99", n)
+	}
+}
+
+func TestPriorityAging(t *testing.T) {
+	p := chanx.NewPriorityChan(chanx.PriorityConfig{AgeStep: 10 * time.Millisecond})
+	p.Send("old", 0)
+	time.Sleep(50 * time.Millisecond)
+	p.Send("newer", 3) // old已经等了5个AgeStep
+	p.Send("urgent", 100)
+	p.Close()
+	got := drain(p.Out)
+	if len(got) != 3 || got[0] != "urgent" || got[1] != "old" || got[2] != "newer" {
+		t.Errorf("got %v, want [urgent old newer]", got)
+	}
+}
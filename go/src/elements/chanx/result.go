@@ -0,0 +1,111 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chanx
+
+import "context"
+
+// A Result is a value or an error: the element type of a channel on which
+// workers report the outcome of their work.
+//
+//	results := make(chan chanx.Result)
+//	go func() {
+//		v, err := fetch(url)
+//		chanx.SendResult(ctx, results, chanx.Result{Key: url, Value: v, Err: err})
+//	}()
+type Result struct {
+	Key   interface{} // what the Result is for, used by CollectMap; may be nil
+	Value interface{}
+	Err   error
+}
+
+// Get returns the value and the error of r.
+func (r Result) Get() (interface{}, error) { return r.Value, r.Err }
+
+// SendResult sends r on ch, as SendCtx does.
+func SendResult(ctx context.Context, ch chan<- Result, r Result) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	select {
+	case ch <- r:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// RecvResult receives a Result from ch, as RecvCtx does. The error is
+// that of the receive, not the Err of the Result.
+func RecvResult(ctx context.Context, ch <-chan Result) (Result, error) {
+	if err := ctx.Err(); err != nil {
+		return Result{}, err
+	}
+	select {
+	case r, ok := <-ch:
+		if !ok {
+			return Result{}, ErrClosed
+		}
+		return r, nil
+	case <-ctx.Done():
+		return Result{}, ctx.Err()
+	}
+}
+
+// Collect receives Results from ch until it is closed. If ctx is done
+// first, it returns the Results received so far and ctx.Err().
+func Collect(ctx context.Context, ch <-chan Result) ([]Result, error) {
+	var rs []Result
+	for {
+		r, err := RecvResult(ctx, ch)
+		if err == ErrClosed {
+			return rs, nil
+		}
+		if err != nil {
+			return rs, err
+		}
+		rs = append(rs, r)
+	}
+}
+
+// CollectMap is like Collect, but returns the Results by Key. Of two
+// Results with the same Key, the later one is kept.
+func CollectMap(ctx context.Context, ch <-chan Result) (map[interface{}]Result, error) {
+	m := make(map[interface{}]Result)
+	for {
+		r, err := RecvResult(ctx, ch)
+		if err == ErrClosed {
+			return m, nil
+		}
+		if err != nil {
+			return m, err
+		}
+		m[r.Key] = r
+	}
+}
+
+// Values returns the values of rs, in order, or the first Err among them.
+func Values(rs []Result) ([]interface{}, error) {
+	vs := make([]interface{}, len(rs))
+	for i, r := range rs {
+		if r.Err != nil {
+			return nil, r.Err
+		}
+		vs[i] = r.Value
+	}
+	return vs, nil
+}
+
+// Partition splits rs into the Results without an Err and those with one,
+// each in the order of rs.
+func Partition(rs []Result) (ok, failed []Result) {
+	for _, r := range rs {
+		if r.Err != nil {
+			failed = append(failed, r)
+		} else {
+			ok = append(ok, r)
+		}
+	}
+	return ok, failed
+}
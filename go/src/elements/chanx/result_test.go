@@ -0,0 +1,64 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chanx_test
+
+import (
+	"context"
+	"elements/chanx"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var errBoom = errors.New("boom")
+
+// produce sends rs on a new channel, and closes it.
+func produce(rs ...chanx.Result) <-chan chanx.Result {
+	ch := make(chan chanx.Result)
+	go func() {
+		defer close(ch)
+		for _, r := range rs {
+			chanx.SendResult(context.Background(), ch, r)
+		}
+	}()
+	return ch
+}
+
+func TestCollect(t *testing.T) {
+	want := []chanx.Result{{Key: "a", Value: 1}, {Key: "b", Err: errBoom}, {Key: "a", Value: 3}}
+	rs, err := chanx.Collect(context.Background(), produce(want...))
+	if !reflect.DeepEqual(rs, want) || err != nil {
+		t.Fatalf("Collect = %v, %v; want %v, nil", rs, err, want)
+	}
+	m, err := chanx.CollectMap(context.Background(), produce(want...))
+	if len(m) != 2 || m["a"].Value != 3 || m["b"].Err != errBoom || err != nil {
+		t.Fatalf("CollectMap = %v, %v", m, err)
+	}
+	ok, failed := chanx.Partition(rs)
+	if len(ok) != 2 || ok[1].Value != 3 || len(failed) != 1 || failed[0].Key != "b" {
+		t.Fatalf("Partition = %v, %v", ok, failed)
+	}
+	if _, err := chanx.Values(rs); err != errBoom {
+		t.Fatalf("Values = %v; want %v", err, errBoom)
+	}
+	if vs, err := chanx.Values(ok); !reflect.DeepEqual(vs, []interface{}{1, 3}) || err != nil {
+		t.Fatalf("Values = %v, %v; want [1 3], nil", vs, err)
+	}
+}
+
+func TestCollectTimeout(t *testing.T) {
+	ch := make(chan chanx.Result, 1)
+	ch <- chanx.Result{Value: 1}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	rs, err := chanx.Collect(ctx, ch)
+	if len(rs) != 1 || err != context.DeadlineExceeded {
+		t.Fatalf("Collect = %v, %v; want one Result and %v", rs, err, context.DeadlineExceeded)
+	}
+	if err := chanx.SendResult(ctx, make(chan chanx.Result), chanx.Result{}); err != context.DeadlineExceeded {
+		t.Fatalf("SendResult = %v; want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chanx
+
+import "sync/atomic"
+
+// A RingChan is a channel with a fixed capacity whose sends never block:
+// when the buffer is full, Send drops the oldest value to make room.
+//
+// It is meant for telemetry on a hot path: metrics, traces and log
+// samples that are worth sending if the consumer keeps up, and not worth
+// slowing the producer down for if it does not. Dropped counts what was
+// lost.
+type RingChan struct {
+	// Out is the receiving side. It is closed by Close.
+	Out <-chan interface{}
+
+	c       chan interface{}
+	dropped uint64
+}
+
+// NewRingChan returns a RingChan that buffers up to size values.
+func NewRingChan(size int) *RingChan {
+	if size < 1 {
+		panic("chanx: non-positive RingChan size")
+	}
+	r := &RingChan{c: make(chan interface{}, size)}
+	r.Out = r.c
+	return r
+}
+
+// Send sends v, dropping the oldest buffered value if the buffer is full,
+// and reports whether it dropped one. Sending after Close panics.
+func (r *RingChan) Send(v interface{}) (dropped bool) {
+	for {
+		select {
+		case r.c <- v:
+			return dropped
+		default:
+		}
+		// 满了: 自己取走最老的值. 取的时候接收者可能已经取走了一个, 这时
+		// 缓冲区有空位, 不用丢弃, 回去重新发送
+		select {
+		case <-r.c:
+			atomic.AddUint64(&r.dropped, 1)
+			dropped = true
+		default:
+		}
+	}
+}
+
+// Close closes Out once the buffered values have been received.
+func (r *RingChan) Close() { close(r.c) }
+
+// Len returns the number of buffered values.
+func (r *RingChan) Len() int { return len(r.c) }
+
+// Dropped returns the number of values dropped by Send so far.
+func (r *RingChan) Dropped() uint64 { return atomic.LoadUint64(&r.dropped) }
@@ -0,0 +1,61 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chanx_test
+
+import (
+	"elements/chanx"
+	"sync"
+	"testing"
+)
+
+func TestRingChanDropsOldest(t *testing.T) {
+	r := chanx.NewRingChan(3)
+	for i := 0; i < 5; i++ {
+		if dropped := r.Send(i); dropped != (i >= 3) {
+			t.Errorf("Send(%d) dropped = %v", i, dropped)
+		}
+	}
+	if r.Len() != 3 || r.Dropped() != 2 {
+		t.Errorf("Len = %d, Dropped = %d, want 3, 2", r.Len(), r.Dropped())
+	}
+	r.Close()
+	got := ints(drain(r.Out))
+	if !equal(got, []int{2, 3, 4}) {
+		t.Errorf("got %v, want the newest [2 3 4]", got)
+	}
+}
+
+// 并发的发送者和慢的接收者: 收到的加上丢掉的正好是发送的, 每个发送者的值保持顺序
+func TestRingChanConcurrent(t *testing.T) {
+	const senders, n = 4, 5000
+	r := chanx.NewRingChan(16)
+	var wg sync.WaitGroup
+	for s := 0; s < senders; s++ {
+		wg.Add(1)
+		go func(s int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				r.Send([2]int{s, i})
+			}
+		}(s)
+	}
+	go func() {
+		wg.Wait()
+		r.Close()
+	}()
+	last := []int{-1, -1, -1, -1}
+	received := 0
+	for v := range r.Out {
+		si := v.([2]int)
+		if si[1] <= last[si[0]] {
+			t.Fatalf("sender %d: %d after %d", si[0], si[1], last[si[0]])
+		}
+		last[si[0]] = si[1]
+		received++
+	}
+	if uint64(received)+r.Dropped() != senders*n {
+		t.Errorf("received %d + dropped %d != sent %d", received, r.Dropped(), senders*n)
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package chanx provides channel types and combinators that the built-in
+// chan does not: a channel without a fixed buffer size, and the patterns
+// that are otherwise rewritten in every program.
+//
+// The values are interface{}: chanx is written for Go 1.14, which has no
+// type parameters.
+package chanx
+
+import "sync/atomic"
+
+// An Unbounded is a channel whose buffer grows as needed, so that sends
+// on In never block for long, however slow the receiver on Out is.
+//
+// A goroutine moves the values from In into a ring buffer and from the
+// ring buffer to Out, in order. Closing In closes Out once every value
+// sent before the close has been received.
+//
+// Use an Unbounded where a producer must not wait for a consumer and the
+// amount of data is bounded some other way: it trades blocking for
+// memory, and a consumer that never catches up makes the buffer grow
+// without limit.
+type Unbounded struct {
+	// In is the sending side. Close it when done; Out is closed after the
+	// buffer drains.
+	In chan<- interface{}
+
+	// Out is the receiving side.
+	Out <-chan interface{}
+
+	in  chan interface{}
+	out chan interface{}
+	r   ring
+
+	len, cap int64 // 供Len和Cap原子地读
+}
+
+// NewUnbounded returns an Unbounded whose buffer starts with room for
+// initCap values. The buffer grows by doubling and shrinks back towards
+// initCap after a burst has drained.
+func NewUnbounded(initCap int) *Unbounded {
+	if initCap < 1 {
+		initCap = 1
+	}
+	u := &Unbounded{
+		in:  make(chan interface{}),
+		out: make(chan interface{}),
+		r:   ring{min: initCap, buf: make([]interface{}, initCap)},
+		cap: int64(initCap),
+	}
+	u.In, u.Out = u.in, u.out
+	go u.run()
+	return u
+}
+
+// Len returns the number of values sent on In and not yet received from
+// Out. A send that has just returned may not be counted yet: the value is
+// handed over before it is added to the buffer.
+func (u *Unbounded) Len() int { return int(atomic.LoadInt64(&u.len)) }
+
+// Cap returns the current size of the buffer.
+func (u *Unbounded) Cap() int { return int(atomic.LoadInt64(&u.cap)) }
+
+func (u *Unbounded) run() {
+	defer close(u.out)
+	for {
+		if u.r.n == 0 {
+			// 缓冲区为空时只等In, 不能在select中向Out发送
+			v, ok := <-u.in
+			if !ok {
+				return
+			}
+			u.push(v)
+			continue
+		}
+		select {
+		case v, ok := <-u.in:
+			if !ok {
+				// In关闭之前发送的值仍然要交给接收者
+				for u.r.n > 0 {
+					u.out <- u.r.peek()
+					u.pop()
+				}
+				return
+			}
+			u.push(v)
+		case u.out <- u.r.peek():
+			u.pop()
+		}
+	}
+}
+
+func (u *Unbounded) push(v interface{}) {
+	u.r.push(v)
+	atomic.AddInt64(&u.len, 1)
+	atomic.StoreInt64(&u.cap, int64(len(u.r.buf)))
+}
+
+func (u *Unbounded) pop() {
+	u.r.pop()
+	atomic.AddInt64(&u.len, -1)
+	atomic.StoreInt64(&u.cap, int64(len(u.r.buf)))
+}
+
+// ring is a FIFO queue in a circular buffer that doubles when full and
+// halves when a quarter full, never below min.
+type ring struct {
+	buf  []interface{}
+	head int // index of the oldest value
+	n    int // number of values
+	min  int
+}
+
+func (r *ring) peek() interface{} { return r.buf[r.head] }
+
+func (r *ring) push(v interface{}) {
+	if r.n == len(r.buf) {
+		r.resize(2 * len(r.buf))
+	}
+	r.buf[(r.head+r.n)%len(r.buf)] = v
+	r.n++
+}
+
+func (r *ring) pop() interface{} {
+	v := r.buf[r.head]
+	r.buf[r.head] = nil // 让GC回收已经取走的值
+	r.head = (r.head + 1) % len(r.buf)
+	r.n--
+	// 突发过后缩回去, 否则一次突发占用的内存永远不会释放. 在1/4而不是1/2时缩小,
+	// 在边界上交替push和pop不会每次都复制
+	if len(r.buf) > r.min && r.n <= len(r.buf)/4 {
+		size := len(r.buf) / 2
+		if size < r.min {
+			size = r.min
+		}
+		r.resize(size)
+	}
+	return v
+}
+
+func (r *ring) resize(size int) {
+	buf := make([]interface{}, size)
+	for i := 0; i < r.n; i++ {
+		buf[i] = r.buf[(r.head+i)%len(r.buf)]
+	}
+	r.buf, r.head = buf, 0
+}
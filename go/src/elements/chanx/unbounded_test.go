@@ -0,0 +1,91 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chanx_test
+
+import (
+	"elements/chanx"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 接收者还没开始, 发送者也不会阻塞
+func TestUnboundedNeverBlocks(t *testing.T) {
+	u := chanx.NewUnbounded(4)
+	const n = 10000
+	for i := 0; i < n; i++ {
+		u.In <- i
+	}
+	// 最后一次发送返回时, 值可能还没放进缓冲区
+	for deadline := time.Now().Add(time.Second); u.Len() != n && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if u.Len() != n {
+		t.Errorf("Len = %d, want %d", u.Len(), n)
+	}
+	if u.Cap() < n {
+		t.Errorf("Cap = %d, want at least %d", u.Cap(), n)
+	}
+	close(u.In)
+	i := 0
+	for v := range u.Out {
+		if v != i {
+			t.Fatalf("received %v, want %d", v, i)
+		}
+		i++
+	}
+	if i != n {
+		t.Errorf("received %d values, want %d", i, n)
+	}
+	if u.Len() != 0 || u.Cap() != 4 {
+		t.Errorf("after draining Len = %d, Cap = %d, want 0, 4", u.Len(), u.Cap())
+	}
+}
+
+func TestUnboundedCloseEmpty(t *testing.T) {
+	u := chanx.NewUnbounded(0)
+	close(u.In)
+	select {
+	case _, ok := <-u.Out:
+		if ok {
+			t.Error("received a value from an empty Unbounded")
+		}
+	case <-time.After(time.Second):
+		t.Error("Out not closed")
+	}
+}
+
+func TestUnboundedConcurrent(t *testing.T) {
+	const producers, n = 4, 1000
+	u := chanx.NewUnbounded(1)
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				u.In <- [2]int{p, i}
+			}
+		}(p)
+	}
+	go func() {
+		wg.Wait()
+		close(u.In)
+	}()
+	// 每个生产者自己的值保持顺序
+	next := make([]int, producers)
+	for v := range u.Out {
+		pi := v.([2]int)
+		if pi[1] != next[pi[0]] {
+			t.Fatalf("producer %d: received %d, want %d", pi[0], pi[1], next[pi[0]])
+		}
+		next[pi[0]]++
+	}
+	for p, got := range next {
+		if got != n {
+			t.Errorf("producer %d: received %d values, want %d", p, got, n)
+		}
+	}
+}
@@ -0,0 +1,178 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package chaos injects random delays and goroutine yields around the
+// operations of a concurrent map, to widen the race windows a test is
+// trying to hit.
+//
+// A race between two operations only shows up when one of them is
+// preempted in just the wrong place, which on an unloaded machine almost
+// never happens. Wrap inserts a yield or a short sleep before and after
+// each operation; Install does the same at the internal race windows of
+// every sync.Map, in programs built with
+//
+//	go test -tags mapchaos
+//
+// The decisions come from a seeded generator: a test that fails with a
+// given Seed tends to fail again with it, although the interleaving of
+// goroutines is still up to the scheduler.
+package chaos
+
+import (
+	"math/rand"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config describes how often an Injector interferes.
+type Config struct {
+	// Seed seeds the decisions.
+	Seed int64
+
+	// Yield is the probability of calling runtime.Gosched at a point.
+	Yield float64
+
+	// Delay is the probability of sleeping at a point, for a duration
+	// chosen uniformly from (0, MaxDelay]. Delay is tried before Yield,
+	// and a point does at most one of them.
+	Delay float64
+
+	// MaxDelay bounds the sleeps. Zero means 100µs.
+	MaxDelay time.Duration
+}
+
+// Stats counts what an Injector did.
+type Stats struct {
+	Points int64 // points passed
+	Yields int64 // points that yielded
+	Delays int64 // points that slept
+}
+
+// An Injector decides, at each point it is called on, whether to yield,
+// to sleep or to do nothing. It is safe for concurrent use.
+type Injector struct {
+	yield, delay float64
+	maxDelay     int64
+
+	mu  sync.Mutex
+	rng *rand.Rand
+
+	points, yields, delays int64
+}
+
+// New returns an Injector for cfg.
+func New(cfg Config) *Injector {
+	in := &Injector{
+		yield:    cfg.Yield,
+		delay:    cfg.Delay,
+		maxDelay: int64(cfg.MaxDelay),
+		rng:      rand.New(rand.NewSource(cfg.Seed)),
+	}
+	if in.maxDelay <= 0 {
+		in.maxDelay = int64(100 * time.Microsecond)
+	}
+	return in
+}
+
+// Point is one place where the injector may interfere.
+func (in *Injector) Point() {
+	// 在锁里做决定, 锁外执行: 同一个Seed下, 决定的顺序只取决于调用Point的顺序
+	in.mu.Lock()
+	r := in.rng.Float64()
+	var d time.Duration
+	if r < in.delay {
+		d = time.Duration(in.rng.Int63n(in.maxDelay) + 1)
+	}
+	in.mu.Unlock()
+
+	atomic.AddInt64(&in.points, 1)
+	switch {
+	case d > 0:
+		atomic.AddInt64(&in.delays, 1)
+		time.Sleep(d)
+	case r < in.delay+in.yield:
+		atomic.AddInt64(&in.yields, 1)
+		runtime.Gosched()
+	}
+}
+
+// Stats returns the counts so far.
+func (in *Injector) Stats() Stats {
+	return Stats{
+		Points: atomic.LoadInt64(&in.points),
+		Yields: atomic.LoadInt64(&in.yields),
+		Delays: atomic.LoadInt64(&in.delays),
+	}
+}
+
+// Install makes every sync.Map call in.Point at its internal race
+// windows, until the returned function is called; see sync.SetMapChaos
+// for the list. Only one Injector can be installed at a time.
+//
+// The internal points exist only in programs built with the tag
+// mapchaos. Otherwise Install has no effect and Stats stays at zero.
+func (in *Injector) Install() (uninstall func()) {
+	sync.SetMapChaos(func(string) { in.Point() })
+	return func() { sync.SetMapChaos(nil) }
+}
+
+// A Map is a concurrent map that can be wrapped: sync.Map, sync.HybridMap
+// and sync.ShardedMap all have these methods.
+type Map interface {
+	Load(key interface{}) (value interface{}, ok bool)
+	Store(key, value interface{})
+	LoadOrStore(key, value interface{}) (actual interface{}, loaded bool)
+	Delete(key interface{})
+	Range(f func(key, value interface{}) bool)
+}
+
+// Wrap returns a Map that calls in.Point before and after each operation
+// on m. Range also calls it between the keys it visits.
+func (in *Injector) Wrap(m Map) Map {
+	return &wrapped{m: m, in: in}
+}
+
+type wrapped struct {
+	m  Map
+	in *Injector
+}
+
+func (w *wrapped) Load(key interface{}) (value interface{}, ok bool) {
+	w.in.Point()
+	value, ok = w.m.Load(key)
+	w.in.Point()
+	return value, ok
+}
+
+func (w *wrapped) Store(key, value interface{}) {
+	w.in.Point()
+	w.m.Store(key, value)
+	w.in.Point()
+}
+
+func (w *wrapped) LoadOrStore(key, value interface{}) (actual interface{}, loaded bool) {
+	w.in.Point()
+	actual, loaded = w.m.LoadOrStore(key, value)
+	w.in.Point()
+	return actual, loaded
+}
+
+func (w *wrapped) Delete(key interface{}) {
+	w.in.Point()
+	w.m.Delete(key)
+	w.in.Point()
+}
+
+func (w *wrapped) Range(f func(key, value interface{}) bool) {
+	w.in.Point()
+	w.m.Range(func(key, value interface{}) bool {
+		if !f(key, value) {
+			return false
+		}
+		w.in.Point()
+		return true
+	})
+}
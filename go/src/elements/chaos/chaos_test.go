@@ -0,0 +1,95 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chaos_test
+
+import (
+	"elements/chaos"
+	"sync"
+	"testing"
+	"time"
+)
+
+func points(seed int64) chaos.Stats {
+	in := chaos.New(chaos.Config{Seed: seed, Yield: 0.3, Delay: 0.1, MaxDelay: time.Microsecond})
+	for i := 0; i < 1000; i++ {
+		in.Point()
+	}
+	return in.Stats()
+}
+
+func TestSeed(t *testing.T) {
+	a, b := points(1), points(1)
+	if a != b {
+		t.Errorf("same seed: %+v != %+v", a, b)
+	}
+	if a.Points != 1000 || a.Yields == 0 || a.Delays == 0 {
+		t.Errorf("stats = %+v", a)
+	}
+	if c := points(2); c == a {
+		t.Errorf("seeds 1 and 2 both gave %+v", a)
+	}
+}
+
+func TestNone(t *testing.T) {
+	in := chaos.New(chaos.Config{})
+	for i := 0; i < 100; i++ {
+		in.Point()
+	}
+	if s := in.Stats(); s != (chaos.Stats{Points: 100}) {
+		t.Errorf("stats = %+v, want only points", s)
+	}
+}
+
+func TestWrap(t *testing.T) {
+	in := chaos.New(chaos.Config{Seed: 1, Yield: 0.5})
+	m := in.Wrap(new(sync.Map))
+	m.Store("a", 1)
+	if v, ok := m.Load("a"); !ok || v != 1 {
+		t.Errorf("Load(a) = %v, %v", v, ok)
+	}
+	if v, loaded := m.LoadOrStore("b", 2); loaded || v != 2 {
+		t.Errorf("LoadOrStore(b) = %v, %v", v, loaded)
+	}
+	n := 0
+	m.Range(func(k, v interface{}) bool {
+		n++
+		return true
+	})
+	if n != 2 {
+		t.Errorf("Range visited %d keys, want 2", n)
+	}
+	m.Delete("a")
+	if _, ok := m.Load("a"); ok {
+		t.Errorf("a still present after Delete")
+	}
+	// 5个操作各2个点, Range开始1个, 每个key之后1个
+	if s := in.Stats(); s.Points != 13 {
+		t.Errorf("points = %d, want 13", s.Points)
+	}
+}
+
+// 检查后再写的计数器: 没有注入时两个goroutine很少恰好交错, 每个操作前后都让出之后几乎必然丢失更新
+func TestCheckThenAct(t *testing.T) {
+	const n = 1000
+	in := chaos.New(chaos.Config{Seed: 1, Yield: 1})
+	m := in.Wrap(new(sync.Map))
+	m.Store("n", 0)
+	var wg sync.WaitGroup
+	for g := 0; g < 2; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				v, _ := m.Load("n")
+				m.Store("n", v.(int)+1)
+			}
+		}()
+	}
+	wg.Wait()
+	v, _ := m.Load("n")
+	if v.(int) == 2*n {
+		t.Errorf("no update lost in %d increments", 2*n)
+	}
+}
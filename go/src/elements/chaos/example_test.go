@@ -0,0 +1,41 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package chaos_test
+
+import (
+	"elements/chaos"
+	"fmt"
+	"sync"
+	"time"
+)
+
+func ExampleInjector_Wrap() {
+	in := chaos.New(chaos.Config{
+		Seed:     42,
+		Yield:    0.5,
+		Delay:    0.1,
+		MaxDelay: 10 * time.Microsecond,
+	})
+	m := in.Wrap(new(sync.Map))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			m.LoadOrStore("leader", i)
+		}(i)
+	}
+	wg.Wait()
+
+	// 不论怎样交错, 只有一个goroutine成为leader
+	n := 0
+	m.Range(func(k, v interface{}) bool {
+		n++
+		return true
+	})
+	fmt.Println(n, in.Stats().Points >= 8)
+	// Output: 1 true
+}
@@ -0,0 +1,30 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build mapchaos
+
+package chaos_test
+
+import (
+	"elements/chaos"
+	"sync"
+	"testing"
+)
+
+func TestInstall(t *testing.T) {
+	in := chaos.New(chaos.Config{Seed: 1, Yield: 1})
+	uninstall := in.Install()
+	var m sync.Map
+	m.Store("a", 1) // 第一次Store走慢路径: "store"和"locked"
+	m.Load("b")     // read.amended, 加锁重新检查: "load"和"locked"
+	uninstall()
+	before := in.Stats()
+	if before.Points != 4 || before.Yields != 4 {
+		t.Errorf("stats = %+v, want 4 points", before)
+	}
+	m.Store("c", 3)
+	if s := in.Stats(); s != before {
+		t.Errorf("stats changed after uninstall: %+v", s)
+	}
+}
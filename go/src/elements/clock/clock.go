@@ -0,0 +1,97 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package clock abstracts the time source of the time-based structures of
+// go-elements, so that their tests can control time instead of sleeping.
+//
+// The TTL maps of the cache package, heap.DelayQueue, the limiters of the
+// semaphore package, expiry.Runner, scheduler.Scheduler and
+// coalesce.WriteCoalescer read the time and wait on timers through a
+// Clock. They take one in their Config, or
+// from a constructor of their own, and use Real when it is nil. A test
+// hands them a Fake, and moves its time forward with Advance:
+//
+//	c := clock.NewFake(time.Unix(0, 0))
+//	sessions := cache.NewSessionMap(cache.SessionConfig{IdleTimeout: time.Minute, Clock: c})
+//	sessions.Store("alice", v)
+//	c.Advance(2 * time.Minute)
+//	// the session of alice has expired
+package clock
+
+import "time"
+
+// A Clock tells the time and makes timers and tickers.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTimer returns a Timer that sends the time on its channel after
+	// at least the duration d, as time.NewTimer does.
+	NewTimer(d time.Duration) Timer
+
+	// NewTicker returns a Ticker that sends the time on its channel once
+	// every period d, as time.NewTicker does. It panics if d is not
+	// positive.
+	NewTicker(d time.Duration) Ticker
+}
+
+// A Timer is a single event of a Clock, as a time.Timer is.
+type Timer interface {
+	// C returns the channel on which the time is delivered.
+	C() <-chan time.Time
+
+	// Stop prevents the Timer from firing. It returns false if the timer
+	// has already fired or been stopped.
+	Stop() bool
+
+	// Reset changes the timer to fire after d. It returns true if the
+	// timer had been active. Like time.Timer.Reset, it must be called
+	// on a stopped or fired timer whose channel has been drained.
+	Reset(d time.Duration) bool
+}
+
+// A Ticker delivers ticks of a Clock at intervals, as a time.Ticker does.
+type Ticker interface {
+	// C returns the channel on which the ticks are delivered.
+	C() <-chan time.Time
+
+	// Stop turns off the ticker. No more ticks are sent afterwards.
+	Stop()
+}
+
+// Real is the Clock of the time package.
+var Real Clock = realClock{}
+
+// Or returns c, or Real if c is nil.
+func Or(c Clock) Clock {
+	if c == nil {
+		return Real
+	}
+	return c
+}
+
+// Since returns the time elapsed on c since t.
+func Since(c Clock, t time.Time) time.Duration { return c.Now().Sub(t) }
+
+// Until returns the duration on c until t.
+func Until(c Clock, t time.Time) time.Duration { return t.Sub(c.Now()) }
+
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+func (realClock) NewTicker(d time.Duration) Ticker { return realTicker{time.NewTicker(d)} }
+
+type realTimer struct{ t *time.Timer }
+
+func (t realTimer) C() <-chan time.Time        { return t.t.C }
+func (t realTimer) Stop() bool                 { return t.t.Stop() }
+func (t realTimer) Reset(d time.Duration) bool { return t.t.Reset(d) }
+
+type realTicker struct{ t *time.Ticker }
+
+func (t realTicker) C() <-chan time.Time { return t.t.C }
+func (t realTicker) Stop()               { t.t.Stop() }
@@ -0,0 +1,124 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package clock_test
+
+import (
+	"elements/clock"
+	"testing"
+	"time"
+)
+
+var epoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// fired reports whether c has a value, and which.
+func fired(c <-chan time.Time) (time.Time, bool) {
+	select {
+	case t := <-c:
+		return t, true
+	default:
+		return time.Time{}, false
+	}
+}
+
+func TestFakeTimer(t *testing.T) {
+	c := clock.NewFake(epoch)
+	tm := c.NewTimer(time.Minute)
+	c.Advance(59 * time.Second)
+	if _, ok := fired(tm.C()); ok {
+		t.Fatal("timer fired before its time")
+	}
+	c.Advance(time.Second)
+	if at, ok := fired(tm.C()); !ok || !at.Equal(epoch.Add(time.Minute)) {
+		t.Fatalf("timer fired %v, %v; want at %v", at, ok, epoch.Add(time.Minute))
+	}
+	if tm.Stop() {
+		t.Error("Stop of a fired timer returned true")
+	}
+
+	if tm.Reset(time.Second) {
+		t.Error("Reset of a fired timer returned true")
+	}
+	if !tm.Stop() {
+		t.Error("Stop of an active timer returned false")
+	}
+	c.Advance(time.Hour)
+	if _, ok := fired(tm.C()); ok {
+		t.Error("stopped timer fired")
+	}
+	if got, want := c.Now(), epoch.Add(time.Hour+time.Minute); !got.Equal(want) {
+		t.Errorf("Now = %v, want %v", got, want)
+	}
+
+	if _, ok := fired(c.NewTimer(0).C()); !ok {
+		t.Error("timer of zero duration did not fire at once")
+	}
+}
+
+func TestFakeTicker(t *testing.T) {
+	c := clock.NewFake(epoch)
+	tk := c.NewTicker(time.Second)
+	for i := 1; i <= 3; i++ {
+		c.Advance(time.Second)
+		if at, ok := fired(tk.C()); !ok || !at.Equal(epoch.Add(time.Duration(i)*time.Second)) {
+			t.Fatalf("tick %d: %v, %v", i, at, ok)
+		}
+	}
+	// 一次Advance最多一个tick, 中间的被丢掉
+	c.Advance(10 * time.Second)
+	if _, ok := fired(tk.C()); !ok {
+		t.Fatal("no tick after Advance of 10 periods")
+	}
+	if _, ok := fired(tk.C()); ok {
+		t.Fatal("more than one tick from one Advance")
+	}
+	tk.Stop()
+	c.Advance(time.Minute)
+	if _, ok := fired(tk.C()); ok {
+		t.Error("stopped ticker ticked")
+	}
+	if c.Waiters() != 0 {
+		t.Errorf("Waiters = %d after Stop", c.Waiters())
+	}
+}
+
+// TestFakeOrder checks that Advance fires the timers in the order of
+// their times, with Now at the time of each.
+func TestFakeOrder(t *testing.T) {
+	c := clock.NewFake(epoch)
+	late, early := c.NewTimer(2*time.Second), c.NewTimer(time.Second)
+	c.Advance(time.Minute)
+	a, _ := fired(early.C())
+	b, _ := fired(late.C())
+	if !a.Before(b) {
+		t.Errorf("timers fired at %v and %v", a, b)
+	}
+}
+
+func TestFakeBlockUntil(t *testing.T) {
+	c := clock.NewFake(epoch)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		<-c.NewTimer(time.Hour).C()
+	}()
+	// 不等goroutine建好定时器, Advance可能在它之前, 定时器就永远不会触发
+	c.BlockUntil(1)
+	c.Advance(time.Hour)
+	<-done
+}
+
+func TestSince(t *testing.T) {
+	c := clock.NewFake(epoch)
+	c.Advance(time.Minute)
+	if d := clock.Since(c, epoch); d != time.Minute {
+		t.Errorf("Since = %v, want 1m", d)
+	}
+	if d := clock.Until(c, epoch.Add(time.Hour)); d != 59*time.Minute {
+		t.Errorf("Until = %v, want 59m", d)
+	}
+	if clock.Or(nil) != clock.Real || clock.Or(c) != c {
+		t.Error("Or does not default to Real")
+	}
+}
@@ -0,0 +1,185 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// A Fake is a Clock whose time only moves when Advance is called. Its
+// timers and tickers fire from Advance, in the order of their times, so a
+// test can go through hours of timeouts without waiting for any of them.
+// It is safe for concurrent use.
+//
+// The code under test usually makes its timers in goroutines of its own:
+// BlockUntil waits until they have, so that the Advance after it fires
+// them rather than passing them by.
+type Fake struct {
+	mu      sync.Mutex
+	cond    sync.Cond // signaled when a timer or ticker is added
+	now     time.Time
+	waiters []*fakeTimer // the active timers and tickers
+}
+
+// A fakeTimer is a Timer or, with a period, a Ticker of a Fake.
+type fakeTimer struct {
+	f      *Fake
+	c      chan time.Time
+	at     time.Time     // when it fires next; guarded by f.mu
+	period time.Duration // of a ticker; zero for a timer
+	active bool          // it is in f.waiters; guarded by f.mu
+}
+
+// NewFake returns a Fake whose time is now.
+func NewFake(now time.Time) *Fake {
+	f := &Fake{now: now}
+	f.cond.L = &f.mu
+	return f
+}
+
+// Now returns the time of f.
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// NewTimer returns a Timer that fires once f has advanced by d. A timer
+// of zero or negative d fires at once.
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{f: f, c: make(chan time.Time, 1)}
+	t.Reset(d)
+	return t
+}
+
+// NewTicker returns a Ticker that fires each time f has advanced by
+// another d. It panics if d is not positive.
+func (f *Fake) NewTicker(d time.Duration) Ticker {
+	if d <= 0 {
+		panic("clock: non-positive interval for NewTicker")
+	}
+	t := &fakeTimer{f: f, c: make(chan time.Time, 1), period: d}
+	f.mu.Lock()
+	t.at = f.now.Add(d)
+	f.addLocked(t)
+	f.mu.Unlock()
+	return fakeTicker{t}
+}
+
+// Advance moves the time of f forward by d, firing the timers and tickers
+// due by then, each at its time. Like a time.Ticker whose receiver is
+// slow, a ticker sends at most one tick per Advance, and skips the
+// others.
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	end := f.now.Add(d)
+	for {
+		t := f.nextLocked(end)
+		if t == nil {
+			break
+		}
+		if t.at.After(f.now) {
+			f.now = t.at
+		}
+		select {
+		case t.c <- t.at:
+		default:
+		}
+		if t.period > 0 {
+			// 跳过Advance中剩下的tick, 下一个tick在end之后
+			t.at = t.at.Add((end.Sub(t.at)/t.period + 1) * t.period)
+		} else {
+			f.removeLocked(t)
+		}
+	}
+	f.now = end
+}
+
+// BlockUntil waits until at least n timers and tickers of f are active.
+func (f *Fake) BlockUntil(n int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for len(f.waiters) < n {
+		f.cond.Wait()
+	}
+}
+
+// Waiters returns the number of active timers and tickers of f.
+func (f *Fake) Waiters() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.waiters)
+}
+
+// nextLocked returns the active timer or ticker that fires first, if it
+// fires by end. f.mu must be held.
+func (f *Fake) nextLocked(end time.Time) *fakeTimer {
+	var next *fakeTimer
+	// 测试中的定时器不多, 线性查找就够了, 同一时间的按加入的顺序
+	for _, t := range f.waiters {
+		if !t.at.After(end) && (next == nil || t.at.Before(next.at)) {
+			next = t
+		}
+	}
+	return next
+}
+
+func (f *Fake) addLocked(t *fakeTimer) {
+	t.active = true
+	f.waiters = append(f.waiters, t)
+	f.cond.Broadcast()
+}
+
+func (f *Fake) removeLocked(t *fakeTimer) {
+	t.active = false
+	for i, w := range f.waiters {
+		if w == t {
+			copy(f.waiters[i:], f.waiters[i+1:])
+			f.waiters[len(f.waiters)-1] = nil
+			f.waiters = f.waiters[:len(f.waiters)-1]
+			return
+		}
+	}
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Stop() bool {
+	t.f.mu.Lock()
+	defer t.f.mu.Unlock()
+	if !t.active {
+		return false
+	}
+	t.f.removeLocked(t)
+	return true
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	f := t.f
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	active := t.active
+	if active {
+		f.removeLocked(t)
+	}
+	if d <= 0 {
+		select {
+		case t.c <- f.now:
+		default:
+		}
+		return active
+	}
+	t.at = f.now.Add(d)
+	f.addLocked(t)
+	return active
+}
+
+// A fakeTicker is a ticker of a Fake, whose Stop has no result.
+type fakeTicker struct{ t *fakeTimer }
+
+func (t fakeTicker) C() <-chan time.Time { return t.t.c }
+func (t fakeTicker) Stop()               { t.t.Stop() }
@@ -0,0 +1,306 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package coalesce buffers the writes to a sync.Map and applies them in
+// batches.
+//
+// During an ingest burst, every Store of a new key to a sync.Map locks its
+// mutex, and the goroutines storing park behind each other on it. A
+// WriteCoalescer takes the writes instead, and one goroutine of its own
+// applies them to the Map, so the goroutines writing never wait for its
+// mutex, and overwrites of a key that come faster than the flushes cost a
+// single Store:
+//
+//	c := coalesce.New(m, coalesce.Config{MaxDelay: 5 * time.Millisecond})
+//	defer c.Close()
+//	...
+//	c.Store(id, rec)
+//
+// A write is in the Map at most MaxDelay after it was made, plus the time
+// a flush takes: until then, Load of the WriteCoalescer sees it, and the
+// Map does not.
+package coalesce
+
+import (
+	"context"
+	"elements/clock"
+	"elements/lifecycle"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config configures a WriteCoalescer.
+type Config struct {
+	// BatchSize is the number of keys a shard buffers before it wakes the
+	// flusher. A shard holds at most twice as many, and writes to it wait
+	// beyond that. Zero means 256.
+	BatchSize int
+
+	// MaxDelay is the longest a write waits to be flushed to the Map.
+	// Zero means 10 milliseconds.
+	MaxDelay time.Duration
+
+	// Clock, if not nil, is the clock MaxDelay is measured on. Otherwise
+	// it is clock.Real.
+	Clock clock.Clock
+}
+
+// A WriteCoalescer buffers Stores and Deletes to a Map. It is safe for
+// concurrent use.
+//
+// The writes are buffered in shards by the hash of their keys, each shard
+// keeping the last write of each of its keys. A shard that reaches
+// BatchSize keys wakes the flusher, which also runs every MaxDelay, and
+// takes the writes of the shards one at a time, applying them in the order
+// they were made for each key.
+type WriteCoalescer struct {
+	m      *sync.Map
+	hasher *sync.MaphashHasher
+	shards []shard
+	batch  int
+
+	// flushMu serializes the flushes: a write taken by one flush must be
+	// applied before a later write of its key taken by the next.
+	flushMu sync.Mutex
+
+	closed    int32 // accessed atomically
+	applied   int64 // accessed atomically
+	coalesced int64 // accessed atomically
+
+	wake      chan struct{} // a shard reached BatchSize
+	stop      chan struct{} // closed by Close
+	done      chan struct{} // closed once the flusher has returned
+	closeOnce sync.Once
+}
+
+// A shard holds the writes of the keys of one hash range. A value of
+// deletion is a Delete.
+type shard struct {
+	mu   sync.Mutex
+	cond sync.Cond // signaled when the flusher takes full
+
+	buf      map[interface{}]interface{} // the latest writes
+	full     map[interface{}]interface{} // a buffer of BatchSize keys waiting for the flusher
+	flushing map[interface{}]interface{} // the writes the flusher is applying
+}
+
+type deletion struct{}
+
+// Stats describes the activity of a WriteCoalescer.
+type Stats struct {
+	Buffered  int   // writes not yet applied to the Map
+	Applied   int64 // writes applied to the Map
+	Coalesced int64 // writes replaced by a later write of their key before being applied
+}
+
+// New returns a WriteCoalescer in front of m with its flusher running,
+// registered in lifecycle.Default. Call Close to stop it.
+func New(m *sync.Map, cfg Config) *WriteCoalescer {
+	batch := cfg.BatchSize
+	if batch <= 0 {
+		batch = 256
+	}
+	delay := cfg.MaxDelay
+	if delay <= 0 {
+		delay = 10 * time.Millisecond
+	}
+	// 分片数是2的幂, 比P多几倍, 同时写的goroutine很少落在同一个分片上
+	n := 1
+	for n < 4*runtime.GOMAXPROCS(0) {
+		n <<= 1
+	}
+	c := &WriteCoalescer{
+		m:      m,
+		hasher: sync.NewMaphashHasher(),
+		shards: make([]shard, n),
+		batch:  batch,
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	for i := range c.shards {
+		c.shards[i].cond.L = &c.shards[i].mu
+	}
+	go c.run(clock.Or(cfg.Clock), delay)
+	lifecycle.Register(c, "coalesce.WriteCoalescer", func(context.Context) error {
+		c.Close()
+		return nil
+	})
+	return c
+}
+
+// Store sets the value for a key, as m.Store does, within MaxDelay.
+func (c *WriteCoalescer) Store(key, value interface{}) {
+	c.write(key, value)
+}
+
+// Delete deletes the value for a key, as m.Delete does, within MaxDelay.
+func (c *WriteCoalescer) Delete(key interface{}) {
+	c.write(key, deletion{})
+}
+
+// Load returns the value for a key, as m.Load does, counting the writes
+// not yet applied to m.
+func (c *WriteCoalescer) Load(key interface{}) (value interface{}, ok bool) {
+	s := c.shard(key)
+	s.mu.Lock()
+	v, found := s.buf[key]
+	if !found {
+		v, found = s.full[key]
+	}
+	if !found {
+		v, found = s.flushing[key]
+	}
+	s.mu.Unlock()
+	if !found {
+		// 不在任何缓冲中的写已经应用到m了
+		return c.m.Load(key)
+	}
+	if _, ok := v.(deletion); ok {
+		return nil, false
+	}
+	return v, true
+}
+
+func (c *WriteCoalescer) write(key, value interface{}) {
+	s := c.shard(key)
+	s.mu.Lock()
+	for len(s.buf) >= c.batch {
+		// 两个缓冲都满了, 等flusher取走
+		s.cond.Wait()
+	}
+	if atomic.LoadInt32(&c.closed) != 0 {
+		s.mu.Unlock()
+		c.apply(s, key, value)
+		return
+	}
+	if s.buf == nil {
+		s.buf = make(map[interface{}]interface{})
+	}
+	if _, ok := s.buf[key]; ok {
+		atomic.AddInt64(&c.coalesced, 1)
+	}
+	s.buf[key] = value
+	if len(s.buf) >= c.batch {
+		if s.full == nil {
+			s.full, s.buf = s.buf, nil
+		}
+		select {
+		case c.wake <- struct{}{}:
+		default:
+		}
+	}
+	s.mu.Unlock()
+}
+
+// apply writes key, of the shard s, to the Map directly, after the flush
+// in progress, if any.
+func (c *WriteCoalescer) apply(s *shard, key, value interface{}) {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+	// Close把closed置位之后才Flush: 在这之间, 关闭之前缓冲的同一个key的写
+	// 还没有应用, 它比这次的写早, 不能让Close的Flush在这次之后再应用它.
+	// 持有flushMu时没有进行中的Flush, flushing是空的
+	s.mu.Lock()
+	for _, w := range []map[interface{}]interface{}{s.buf, s.full} {
+		if _, ok := w[key]; ok {
+			delete(w, key)
+			atomic.AddInt64(&c.coalesced, 1)
+		}
+	}
+	s.mu.Unlock()
+	if _, ok := value.(deletion); ok {
+		c.m.Delete(key)
+	} else {
+		c.m.Store(key, value)
+	}
+}
+
+func (c *WriteCoalescer) shard(key interface{}) *shard {
+	return &c.shards[c.hasher.Hash(key)&uint64(len(c.shards)-1)]
+}
+
+// Flush applies the writes made so far to the Map, and returns once they
+// are visible there.
+func (c *WriteCoalescer) Flush() {
+	c.flushMu.Lock()
+	defer c.flushMu.Unlock()
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		w := s.full
+		if w == nil {
+			w = s.buf
+		} else {
+			for k, v := range s.buf {
+				if _, ok := w[k]; ok {
+					atomic.AddInt64(&c.coalesced, 1)
+				}
+				w[k] = v
+			}
+		}
+		s.buf, s.full, s.flushing = nil, nil, w
+		s.cond.Broadcast()
+		s.mu.Unlock()
+		if len(w) == 0 {
+			continue
+		}
+		for k, v := range w {
+			if _, ok := v.(deletion); ok {
+				c.m.Delete(k)
+			} else {
+				c.m.Store(k, v)
+			}
+		}
+		atomic.AddInt64(&c.applied, int64(len(w)))
+		s.mu.Lock()
+		s.flushing = nil
+		s.mu.Unlock()
+	}
+}
+
+func (c *WriteCoalescer) run(clk clock.Clock, delay time.Duration) {
+	defer close(c.done)
+	t := clk.NewTicker(delay)
+	defer t.Stop()
+	for {
+		select {
+		case <-c.wake:
+		case <-t.C():
+		case <-c.stop:
+			return
+		}
+		c.Flush()
+	}
+}
+
+// Stats returns the current activity of c.
+func (c *WriteCoalescer) Stats() Stats {
+	st := Stats{
+		Applied:   atomic.LoadInt64(&c.applied),
+		Coalesced: atomic.LoadInt64(&c.coalesced),
+	}
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		st.Buffered += len(s.buf) + len(s.full) + len(s.flushing)
+		s.mu.Unlock()
+	}
+	return st
+}
+
+// Close stops the flusher of c and applies the writes it has buffered.
+// The writes made through c afterwards go to the Map at once.
+func (c *WriteCoalescer) Close() {
+	c.closeOnce.Do(func() {
+		atomic.StoreInt32(&c.closed, 1)
+		close(c.stop)
+		<-c.done
+		lifecycle.Unregister(c)
+	})
+	// 关闭之前缓冲的写, 在Close返回之前都已经应用了
+	c.Flush()
+}
@@ -0,0 +1,194 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package coalesce_test
+
+import (
+	"elements/clock"
+	"elements/coalesce"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newCoalescer returns a WriteCoalescer in front of a new Map, closed at
+// the end of the test.
+func newCoalescer(t testing.TB, cfg coalesce.Config) (*coalesce.WriteCoalescer, *sync.Map) {
+	m := new(sync.Map)
+	c := coalesce.New(m, cfg)
+	t.Cleanup(c.Close)
+	return c, m
+}
+
+// waitFor waits for the Map to hold value for key.
+func waitFor(t *testing.T, m *sync.Map, key, value interface{}) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		if v, _ := m.Load(key); v == value {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%v not flushed to the Map", key)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestMaxDelay(t *testing.T) {
+	clk := clock.NewFake(time.Unix(0, 0))
+	c, m := newCoalescer(t, coalesce.Config{MaxDelay: time.Second, Clock: clk})
+	c.Store("a", 1)
+	if v, ok := c.Load("a"); !ok || v != 1 {
+		t.Fatalf("Load of a buffered write = %v, %v", v, ok)
+	}
+	if _, ok := m.Load("a"); ok {
+		t.Fatal("write in the Map before MaxDelay")
+	}
+	// 等flusher建好ticker再前进
+	clk.BlockUntil(1)
+	clk.Advance(time.Second)
+	waitFor(t, m, "a", 1)
+}
+
+func TestBatchSize(t *testing.T) {
+	c, m := newCoalescer(t, coalesce.Config{BatchSize: 4, MaxDelay: time.Hour})
+	const n = 1000
+	for i := 0; i < n; i++ {
+		c.Store(i, i)
+	}
+	// 写满BatchSize的分片不等MaxDelay就被应用
+	deadline := time.Now().Add(10 * time.Second)
+	for c.Stats().Applied == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no batch flushed before MaxDelay")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	c.Flush()
+	for i := 0; i < n; i++ {
+		if v, ok := m.Load(i); !ok || v != i {
+			t.Fatalf("Load(%d) = %v, %v after Flush", i, v, ok)
+		}
+	}
+	if st := c.Stats(); st.Buffered != 0 || st.Applied != n {
+		t.Errorf("Stats = %+v after Flush", st)
+	}
+}
+
+func TestCoalesce(t *testing.T) {
+	c, m := newCoalescer(t, coalesce.Config{MaxDelay: time.Hour})
+	m.Store("gone", 0)
+	c.Store("k", 1)
+	c.Delete("k")
+	c.Store("k", 2)
+	c.Delete("gone")
+	if _, ok := c.Load("gone"); ok {
+		t.Error("Load found a key deleted through the WriteCoalescer")
+	}
+	c.Flush()
+	if v, ok := m.Load("k"); !ok || v != 2 {
+		t.Errorf("k = %v, %v; want the last write", v, ok)
+	}
+	if _, ok := m.Load("gone"); ok {
+		t.Error("Delete not applied")
+	}
+	if st := c.Stats(); st.Applied != 2 || st.Coalesced != 2 {
+		t.Errorf("Stats = %+v, want 2 applied and 2 coalesced", st)
+	}
+}
+
+func TestClose(t *testing.T) {
+	m := new(sync.Map)
+	c := coalesce.New(m, coalesce.Config{MaxDelay: time.Hour})
+	c.Store("a", 1)
+	c.Close()
+	if v, _ := m.Load("a"); v != 1 {
+		t.Error("buffered write not applied by Close")
+	}
+	c.Store("b", 2)
+	if v, _ := m.Load("b"); v != 2 {
+		t.Error("write after Close not applied at once")
+	}
+}
+
+// TestCloseOrder checks that a write made while Close runs is not undone
+// by an earlier write of its key that Close flushes.
+func TestCloseOrder(t *testing.T) {
+	for i := 0; i < 1000; i++ {
+		m := new(sync.Map)
+		c := coalesce.New(m, coalesce.Config{MaxDelay: time.Hour})
+		c.Store("k", 1)
+		closed := make(chan struct{})
+		go func() {
+			c.Close()
+			close(closed)
+		}()
+		runtime.Gosched()
+		c.Store("k", 2)
+		<-closed
+		if v, _ := m.Load("k"); v != 2 {
+			t.Fatalf("k = %v after Close, want the last write 2", v)
+		}
+	}
+}
+
+// TestOrder checks that the writes of each key are applied in the order
+// they were made, whichever flush takes them.
+func TestOrder(t *testing.T) {
+	c, m := newCoalescer(t, coalesce.Config{BatchSize: 2, MaxDelay: time.Millisecond})
+	procs := runtime.GOMAXPROCS(0) + 2
+	const iters = 2000
+	var wg sync.WaitGroup
+	for g := 0; g < procs; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			key := strconv.Itoa(g)
+			for i := 1; i <= iters; i++ {
+				c.Store(key, i)
+				// 写到别的key, 让分片写满
+				c.Store(key+"/"+strconv.Itoa(i%8), i)
+				if v, _ := c.Load(key); v != i {
+					t.Errorf("Load(%s) = %v after storing %d", key, v, i)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	c.Flush()
+	for g := 0; g < procs; g++ {
+		if v, _ := m.Load(strconv.Itoa(g)); v != iters {
+			t.Errorf("key %d = %v, want the last write %d", g, v, iters)
+		}
+	}
+}
+
+func BenchmarkStore(b *testing.B) {
+	b.Run("Map", func(b *testing.B) {
+		m := new(sync.Map)
+		var next int64
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				i := atomic.AddInt64(&next, 1)
+				m.Store(i, i)
+			}
+		})
+	})
+	b.Run("WriteCoalescer", func(b *testing.B) {
+		c, _ := newCoalescer(b, coalesce.Config{})
+		var next int64
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				i := atomic.AddInt64(&next, 1)
+				c.Store(i, i)
+			}
+		})
+		c.Flush()
+	})
+}
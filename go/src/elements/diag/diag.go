@@ -0,0 +1,111 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package diag lists the named instances of a process, with their
+// statistics, for debugging tools.
+//
+// The constructors that take a name register what they make here:
+// sync.NewNamedMap, cache.NewNamed and semaphore.NewNamedPool. A tool
+// then finds every instance of a big service without being handed each
+// one:
+//
+//	for _, in := range diag.Instances() {
+//		fmt.Printf("%s %s %+v\n", in.Kind, in.Name, in.Stats)
+//	}
+//
+// The list holds on to the instances. Cache.Close removes a Cache from
+// it, and sync.UnregisterNamedMap a Map; a semaphore.Pool stays listed for
+// as long as the process runs.
+//
+// Package diaghttp serves the same list over HTTP.
+package diag
+
+import (
+	"sort"
+	"sync"
+)
+
+// MapKind is the Kind of the Maps made by sync.NewNamedMap. Package sync
+// cannot register them, so Instances also lists sync.RangeNamedMaps.
+const MapKind = "sync.Map"
+
+// An Instance is a named instance and its statistics.
+type Instance struct {
+	Kind  string      // the type of the instance, such as "cache.Cache"
+	Name  string      // unique among the instances of the Kind
+	Stats interface{} // the result of the instance's Stats method
+}
+
+type key struct {
+	kind, name string
+}
+
+var registry struct {
+	mu    sync.Mutex
+	stats map[key]*Registration
+}
+
+// A Registration is an instance listed by Register.
+type Registration struct {
+	key
+	stats func() interface{}
+}
+
+// Register lists an instance of the given kind under name, whose
+// statistics stats returns, for Instances to call. It replaces any
+// instance of the same kind and name. The list holds on to stats, and so
+// to the instance, until the returned Registration is unregistered.
+func Register(kind, name string, stats func() interface{}) *Registration {
+	r := &Registration{key: key{kind, name}, stats: stats}
+	registry.mu.Lock()
+	if registry.stats == nil {
+		registry.stats = make(map[key]*Registration)
+	}
+	registry.stats[r.key] = r
+	registry.mu.Unlock()
+	return r
+}
+
+// Unregister removes the instance of r from the list, so that the list no
+// longer holds on to it. It does nothing if a later Register has replaced
+// the instance, if it has already been removed, or if r is nil.
+func (r *Registration) Unregister() {
+	if r == nil {
+		return
+	}
+	registry.mu.Lock()
+	// 同名的新实例替换了r的话, 不能把新实例删掉
+	if registry.stats[r.key] == r {
+		delete(registry.stats, r.key)
+	}
+	registry.mu.Unlock()
+}
+
+// Instances returns the statistics of every registered instance, and of
+// every Map made by sync.NewNamedMap, sorted by Kind and then Name.
+func Instances() []Instance {
+	registry.mu.Lock()
+	rs := make([]*Registration, 0, len(registry.stats))
+	for _, r := range registry.stats {
+		rs = append(rs, r)
+	}
+	registry.mu.Unlock()
+
+	// Stats在锁外调用: 它可能要等实例自己的锁
+	ins := make([]Instance, 0, len(rs))
+	for _, r := range rs {
+		ins = append(ins, Instance{Kind: r.kind, Name: r.name, Stats: r.stats()})
+	}
+	sync.RangeNamedMaps(func(name string, m *sync.Map) bool {
+		ins = append(ins, Instance{Kind: MapKind, Name: name, Stats: m.Stats()})
+		return true
+	})
+	sort.Slice(ins, func(i, j int) bool {
+		if ins[i].Kind != ins[j].Kind {
+			return ins[i].Kind < ins[j].Kind
+		}
+		return ins[i].Name < ins[j].Name
+	})
+	return ins
+}
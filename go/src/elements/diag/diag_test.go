@@ -0,0 +1,69 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package diag_test
+
+import (
+	"elements/diag"
+	"sync"
+	"testing"
+)
+
+func find(kind, name string) (diag.Instance, bool) {
+	for _, in := range diag.Instances() {
+		if in.Kind == kind && in.Name == name {
+			return in, true
+		}
+	}
+	return diag.Instance{}, false
+}
+
+func TestInstances(t *testing.T) {
+	n := 0
+	diag.Register("test.Counter", "b", func() interface{} { n++; return n })
+	diag.Register("test.Counter", "a", func() interface{} { return -1 })
+	m := sync.NewNamedMap("diag/sessions")
+	m.Store("k", "v")
+	m.Load("missing")
+
+	ins := diag.Instances()
+	for i := 1; i < len(ins); i++ {
+		p, in := ins[i-1], ins[i]
+		if p.Kind > in.Kind || p.Kind == in.Kind && p.Name >= in.Name {
+			t.Fatalf("Instances not sorted: %+v before %+v", p, in)
+		}
+	}
+	if in, ok := find("test.Counter", "b"); !ok || in.Stats != 2 {
+		t.Errorf("b = %+v, %v; want its Stats called once more", in, ok)
+	}
+	in, ok := find(diag.MapKind, "diag/sessions")
+	if !ok {
+		t.Fatal("the named Map is not listed")
+	}
+	if s, ok := in.Stats.(sync.MapStats); !ok || s.Misses != 1 {
+		t.Errorf("Stats of the named Map = %+v", in.Stats)
+	}
+
+	diag.Register("test.Counter", "a", func() interface{} { return "replaced" })
+	if in, _ := find("test.Counter", "a"); in.Stats != "replaced" {
+		t.Errorf("a = %+v after it was registered again", in)
+	}
+}
+
+func TestUnregister(t *testing.T) {
+	r := diag.Register("test.Counter", "gone", func() interface{} { return 1 })
+	r2 := diag.Register("test.Counter", "gone", func() interface{} { return 2 })
+	// 被替换的实例注销时, 不删除替换它的实例
+	r.Unregister()
+	if in, ok := find("test.Counter", "gone"); !ok || in.Stats != 2 {
+		t.Fatalf("gone = %+v, %v after unregistering the instance it replaced", in, ok)
+	}
+	r2.Unregister()
+	if in, ok := find("test.Counter", "gone"); ok {
+		t.Errorf("%+v still listed after Unregister", in)
+	}
+	r2.Unregister()
+	var none *diag.Registration
+	none.Unregister()
+}
@@ -0,0 +1,49 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package diaghttp serves the instances listed by package diag as JSON.
+//
+//	http.Handle("/debug/elements", diaghttp.Handler())
+//
+// GET /debug/elements returns every instance; the kind and name query
+// parameters keep only those of that Kind or Name:
+//
+//	/debug/elements?kind=cache.Cache
+//	/debug/elements?kind=sync.Map&name=sessions
+package diaghttp
+
+import (
+	"elements/diag"
+	"encoding/json"
+	"net/http"
+)
+
+// Handler returns a handler that serves diag.Instances as a JSON array.
+func Handler() http.Handler {
+	return http.HandlerFunc(serve)
+}
+
+func serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	kind, name := q.Get("kind"), q.Get("name")
+	ins := []diag.Instance{}
+	for _, in := range diag.Instances() {
+		if (kind == "" || in.Kind == kind) && (name == "" || in.Name == name) {
+			ins = append(ins, in)
+		}
+	}
+	b, err := json.MarshalIndent(ins, "", "\t")
+	if err != nil {
+		// 注册的Stats不能编码成JSON
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(append(b, '\n'))
+}
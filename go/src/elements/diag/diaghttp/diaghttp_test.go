@@ -0,0 +1,69 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package diaghttp_test
+
+import (
+	"elements/cache"
+	"elements/diag/diaghttp"
+	"elements/semaphore"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type instance struct {
+	Kind  string
+	Name  string
+	Stats map[string]interface{}
+}
+
+func get(t *testing.T, url string) []instance {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	diaghttp.Handler().ServeHTTP(rec, httptest.NewRequest("GET", url, nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET %s: %d %s", url, rec.Code, rec.Body)
+	}
+	var ins []instance
+	if err := json.Unmarshal(rec.Body.Bytes(), &ins); err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	return ins
+}
+
+func TestHandler(t *testing.T) {
+	c := cache.NewNamed("users", cache.Config{Load: func(key string) (interface{}, error) { return key, nil }})
+	c.Get("u1")
+	c.Get("u1")
+	semaphore.NewNamedPool("db", 4, nil)
+	sync.NewNamedMap("sessions").Store("s", 1)
+
+	ins := get(t, "/debug/elements")
+	if len(ins) != 3 {
+		t.Fatalf("GET /debug/elements: %+v, want 3 instances", ins)
+	}
+	// 按Kind排序
+	if ins[0].Kind != "cache.Cache" || ins[1].Kind != "semaphore.Pool" || ins[2].Kind != "sync.Map" {
+		t.Errorf("instances %+v", ins)
+	}
+	if ins[0].Stats["Hits"] != 1.0 || ins[1].Stats["Size"] != 4.0 {
+		t.Errorf("stats %+v, %+v", ins[0].Stats, ins[1].Stats)
+	}
+
+	if ins := get(t, "/debug/elements?kind=sync.Map&name=sessions"); len(ins) != 1 || ins[0].Name != "sessions" {
+		t.Errorf("kind=sync.Map&name=sessions: %+v", ins)
+	}
+	if ins := get(t, "/debug/elements?name=none"); len(ins) != 0 {
+		t.Errorf("name=none: %+v", ins)
+	}
+
+	rec := httptest.NewRecorder()
+	diaghttp.Handler().ServeHTTP(rec, httptest.NewRequest("POST", "/debug/elements", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: %d", rec.Code)
+	}
+}
@@ -0,0 +1,121 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package dlock defines locks that expire, with fencing tokens, behind an
+// interface that a process can implement in memory and a cluster in Redis
+// or etcd.
+//
+// Code that takes a DLock for a key works the same whichever backend it
+// is given:
+//
+//	l, err := locks.Acquire(ctx, "invoice/42", 10*time.Second)
+//	if err != nil {
+//		return err
+//	}
+//	defer locks.Release(ctx, l)
+//	store.Write(invoice, l.Token) // the store rejects tokens older than the newest it has seen
+//
+// NewLocal returns a DLock for the goroutines of one process. NewRedis and
+// NewEtcd adapt a client of the caller's choosing, through the small
+// interfaces RedisScripter and EtcdClient: this package does not import
+// any client library.
+package dlock
+
+import (
+	"context"
+	"crypto/rand"
+	"elements/errs"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// A DLock grants exclusive locks on keys that expire after a TTL unless
+// renewed, so that a holder that crashes or hangs does not keep its lock.
+type DLock interface {
+	// Acquire blocks until it holds the lock on key for ttl, or ctx is
+	// done, in which case it returns ctx.Err().
+	Acquire(ctx context.Context, key string, ttl time.Duration) (Lock, error)
+
+	// Renew extends a held lock to expire ttl from now. It returns
+	// ErrNotHeld if the lock has expired or been released.
+	Renew(ctx context.Context, l Lock, ttl time.Duration) (Lock, error)
+
+	// Release gives up a held lock. It returns ErrNotHeld if the lock has
+	// expired or been released already.
+	Release(ctx context.Context, l Lock) error
+}
+
+// ErrNotHeld is returned by Renew and Release for a lock that is no
+// longer held.
+var ErrNotHeld = errors.New("dlock: lock not held")
+
+// ErrClosed is returned by the Acquire of a Local that has been closed.
+// It is an errs.ErrClosed.
+var ErrClosed = errs.New("dlock: closed", errs.ErrClosed)
+
+// A Lock is a lock held on a key.
+type Lock struct {
+	Key string
+
+	// Token is the fencing token of the lock: every lock on a key has a
+	// larger token than the locks on it before, so a resource can reject
+	// the writes of a holder whose lock has expired.
+	Token uint64
+
+	// Expires is when the lock expires unless renewed, by the clock of
+	// the process that acquired it.
+	Expires time.Time
+
+	owner string        // identifies this holder to the backend
+	lease int64         // the etcd lease of the lock
+	ttl   time.Duration // the TTL of the etcd lease
+}
+
+// Config configures the DLocks of the Redis and etcd backends.
+type Config struct {
+	// RetryInterval is how long Acquire waits between attempts while the
+	// lock is held by another. Zero means 50 milliseconds.
+	RetryInterval time.Duration
+}
+
+func (c Config) retryInterval() time.Duration {
+	if c.RetryInterval <= 0 {
+		return 50 * time.Millisecond
+	}
+	return c.RetryInterval
+}
+
+// poll calls try until it acquires the lock, fails, or ctx is done,
+// waiting interval between the attempts.
+func poll(ctx context.Context, interval time.Duration, try func() (Lock, bool, error)) (Lock, error) {
+	var t *time.Timer
+	for {
+		l, ok, err := try()
+		if err != nil || ok {
+			return l, err
+		}
+		if t == nil {
+			t = time.NewTimer(interval)
+			defer t.Stop()
+		} else {
+			t.Reset(interval)
+		}
+		select {
+		case <-ctx.Done():
+			return Lock{}, ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// newOwner returns a value that identifies one Acquire among all the
+// processes sharing a backend.
+func newOwner() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("dlock: " + err.Error())
+	}
+	return hex.EncodeToString(b[:])
+}
@@ -0,0 +1,304 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dlock_test
+
+import (
+	"context"
+	"elements/dlock"
+	"elements/errs"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// 三种后端跑同一组测试: 依赖DLock接口的代码不关心后端是哪一个
+var backends = []struct {
+	name string
+	new  func() dlock.DLock
+}{
+	{"local", func() dlock.DLock { return dlock.NewLocal() }},
+	{"redis", func() dlock.DLock {
+		return dlock.NewRedis(newFakeRedis(), dlock.Config{RetryInterval: time.Millisecond})
+	}},
+	{"etcd", func() dlock.DLock {
+		return dlock.NewEtcd(newFakeEtcd(), dlock.Config{RetryInterval: time.Millisecond})
+	}},
+}
+
+func forEachBackend(t *testing.T, f func(t *testing.T, d dlock.DLock)) {
+	for _, b := range backends {
+		t.Run(b.name, func(t *testing.T) {
+			d := b.new()
+			if l, ok := d.(*dlock.Local); ok {
+				defer l.Close()
+			}
+			f(t, d)
+		})
+	}
+}
+
+func TestAcquireRelease(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, d dlock.DLock) {
+		ctx := context.Background()
+		a, err := d.Acquire(ctx, "k", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		short, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+		defer cancel()
+		if _, err := d.Acquire(short, "k", time.Minute); err != context.DeadlineExceeded {
+			t.Fatalf("second Acquire: %v, want DeadlineExceeded", err)
+		}
+		if _, err := d.Acquire(ctx, "other", time.Minute); err != nil {
+			t.Errorf("Acquire of another key: %v", err)
+		}
+
+		got := make(chan dlock.Lock)
+		go func() {
+			b, err := d.Acquire(ctx, "k", time.Minute)
+			if err != nil {
+				t.Error(err)
+			}
+			got <- b
+		}()
+		time.Sleep(5 * time.Millisecond)
+		if err := d.Release(ctx, a); err != nil {
+			t.Fatal(err)
+		}
+		b := <-got
+		if b.Token <= a.Token {
+			t.Errorf("token %d after %d", b.Token, a.Token)
+		}
+		if err := d.Release(ctx, a); err != dlock.ErrNotHeld {
+			t.Errorf("second Release: %v, want ErrNotHeld", err)
+		}
+	})
+}
+
+func TestExpiry(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, d dlock.DLock) {
+		ctx := context.Background()
+		a, err := d.Acquire(ctx, "k", 30*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// 持有者不续约也不释放, 锁到期之后别人拿到它
+		b, err := d.Acquire(ctx, "k", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if time.Now().Before(a.Expires) || b.Token <= a.Token {
+			t.Errorf("Acquire at %v of a lock expiring at %v, token %d after %d", time.Now(), a.Expires, b.Token, a.Token)
+		}
+		if _, err := d.Renew(ctx, a, time.Minute); err != dlock.ErrNotHeld {
+			t.Errorf("Renew of an expired lock: %v", err)
+		}
+		if err := d.Release(ctx, a); err != dlock.ErrNotHeld {
+			t.Errorf("Release of an expired lock: %v", err)
+		}
+		if err := d.Release(ctx, b); err != nil {
+			t.Errorf("Release of the new lock: %v", err)
+		}
+	})
+}
+
+func TestRenew(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, d dlock.DLock) {
+		ctx := context.Background()
+		a, err := d.Acquire(ctx, "k", 40*time.Millisecond)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 4; i++ {
+			time.Sleep(15 * time.Millisecond)
+			if a, err = d.Renew(ctx, a, 40*time.Millisecond); err != nil {
+				t.Fatalf("Renew %d: %v", i, err)
+			}
+		}
+		short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		if _, err := d.Acquire(short, "k", time.Minute); err != context.DeadlineExceeded {
+			t.Errorf("Acquire of a renewed lock: %v", err)
+		}
+	})
+}
+
+func TestLocalClose(t *testing.T) {
+	d := dlock.NewLocal()
+	d.Close()
+	_, err := d.Acquire(context.Background(), "k", time.Minute)
+	if err != dlock.ErrClosed || !errors.Is(err, errs.ErrClosed) {
+		t.Errorf("Acquire after Close: %v, want dlock.ErrClosed", err)
+	}
+}
+
+// 同一时刻只有一个持有者, 令牌递增
+func TestMutualExclusion(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, d dlock.DLock) {
+		ctx := context.Background()
+		var mu sync.Mutex
+		holders, last := 0, uint64(0)
+		var wg sync.WaitGroup
+		for g := 0; g < 4; g++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for i := 0; i < 20; i++ {
+					l, err := d.Acquire(ctx, "k", time.Minute)
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					mu.Lock()
+					holders++
+					if holders > 1 || l.Token <= last {
+						t.Errorf("%d holders, token %d after %d", holders, l.Token, last)
+					}
+					last = l.Token
+					mu.Unlock()
+					time.Sleep(100 * time.Microsecond)
+					mu.Lock()
+					holders--
+					mu.Unlock()
+					if err := d.Release(ctx, l); err != nil {
+						t.Error(err)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+	})
+}
+
+// fakeRedis runs the scripts of the Redis backend on a map.
+type fakeRedis struct {
+	mu     sync.Mutex
+	keys   map[string]fakeRedisKey
+	fences map[string]int64
+}
+
+type fakeRedisKey struct {
+	value   string
+	expires time.Time
+}
+
+func newFakeRedis() *fakeRedis {
+	return &fakeRedis{keys: make(map[string]fakeRedisKey), fences: make(map[string]int64)}
+}
+
+func (r *fakeRedis) Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	k, ok := r.keys[keys[0]]
+	if ok && !time.Now().Before(k.expires) {
+		delete(r.keys, keys[0])
+		ok = false
+	}
+	owner := args[0].(string)
+	switch script {
+	case dlock.RedisAcquire:
+		if ok {
+			return int64(0), nil
+		}
+		r.keys[keys[0]] = fakeRedisKey{owner, time.Now().Add(time.Duration(args[1].(int64)) * time.Millisecond)}
+		r.fences[keys[1]]++
+		return r.fences[keys[1]], nil
+	case dlock.RedisRenew:
+		if !ok || k.value != owner {
+			return int64(0), nil
+		}
+		r.keys[keys[0]] = fakeRedisKey{owner, time.Now().Add(time.Duration(args[1].(int64)) * time.Millisecond)}
+		return int64(1), nil
+	case dlock.RedisRelease:
+		if !ok || k.value != owner {
+			return int64(0), nil
+		}
+		delete(r.keys, keys[0])
+		return int64(1), nil
+	}
+	panic("unknown script " + strconv.Quote(script))
+}
+
+// fakeEtcd keeps leases and keys with revisions, as an etcd server does.
+type fakeEtcd struct {
+	mu       sync.Mutex
+	rev      int64
+	nextID   int64
+	leases   map[int64]*fakeLease
+	keyLease map[string]int64
+}
+
+type fakeLease struct {
+	ttl     time.Duration
+	expires time.Time
+	keys    []string
+}
+
+func newFakeEtcd() *fakeEtcd {
+	return &fakeEtcd{leases: make(map[int64]*fakeLease), keyLease: make(map[string]int64)}
+}
+
+// expireLocked drops the leases that have expired and their keys.
+func (e *fakeEtcd) expireLocked() {
+	for id, l := range e.leases {
+		if !time.Now().Before(l.expires) {
+			e.revokeLocked(id)
+		}
+	}
+}
+
+func (e *fakeEtcd) revokeLocked(id int64) {
+	for _, k := range e.leases[id].keys {
+		delete(e.keyLease, k)
+		e.rev++
+	}
+	delete(e.leases, id)
+}
+
+func (e *fakeEtcd) Grant(ctx context.Context, ttl time.Duration) (int64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.nextID++
+	e.leases[e.nextID] = &fakeLease{ttl: ttl, expires: time.Now().Add(ttl)}
+	return e.nextID, nil
+}
+
+func (e *fakeEtcd) CreateIfAbsent(ctx context.Context, key, value string, lease int64) (bool, int64, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.expireLocked()
+	e.rev++
+	if _, ok := e.keyLease[key]; ok {
+		return false, e.rev, nil
+	}
+	e.keyLease[key] = lease
+	e.leases[lease].keys = append(e.leases[lease].keys, key)
+	return true, e.rev, nil
+}
+
+func (e *fakeEtcd) KeepAliveOnce(ctx context.Context, lease int64) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.expireLocked()
+	l, ok := e.leases[lease]
+	if !ok {
+		return false, nil
+	}
+	l.expires = time.Now().Add(l.ttl)
+	return true, nil
+}
+
+func (e *fakeEtcd) Revoke(ctx context.Context, lease int64) (bool, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.expireLocked()
+	if _, ok := e.leases[lease]; !ok {
+		return false, nil
+	}
+	e.revokeLocked(lease)
+	return true, nil
+}
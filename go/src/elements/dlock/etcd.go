@@ -0,0 +1,90 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dlock
+
+import (
+	"context"
+	"time"
+)
+
+// An EtcdClient is the part of an etcd v3 client a DLock needs. Each
+// method is one call of clientv3.
+type EtcdClient interface {
+	// Grant creates a lease of the given TTL, as Lease.Grant.
+	Grant(ctx context.Context, ttl time.Duration) (lease int64, err error)
+
+	// CreateIfAbsent puts key, attached to lease, unless it exists: a Txn
+	// comparing the CreateRevision of key to 0. It returns whether key
+	// was created, and the revision of the Txn.
+	CreateIfAbsent(ctx context.Context, key, value string, lease int64) (created bool, revision int64, err error)
+
+	// KeepAliveOnce restarts the TTL of lease, as Lease.KeepAliveOnce. It
+	// returns false if the lease has expired or been revoked.
+	KeepAliveOnce(ctx context.Context, lease int64) (found bool, err error)
+
+	// Revoke ends lease and deletes the keys attached to it, as
+	// Lease.Revoke. It returns false if the lease has expired or been
+	// revoked already.
+	Revoke(ctx context.Context, lease int64) (found bool, err error)
+}
+
+// An etcdLock is a DLock on an etcd cluster.
+type etcdLock struct {
+	c        EtcdClient
+	interval time.Duration
+}
+
+// NewEtcd returns a DLock on the etcd cluster c talks to. The lock on key
+// is the etcd key of that name, attached to a lease of the lock's TTL,
+// and its fencing token is the revision that created it: revisions only
+// grow in an etcd cluster, without the counter the Redis backend needs.
+//
+// An etcd lease keeps the TTL it was granted with, so Renew restarts the
+// TTL of the Acquire, whatever ttl it is given.
+func NewEtcd(c EtcdClient, cfg Config) DLock {
+	return &etcdLock{c: c, interval: cfg.retryInterval()}
+}
+
+func (e *etcdLock) Acquire(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	owner := newOwner()
+	return poll(ctx, e.interval, func() (Lock, bool, error) {
+		start := time.Now()
+		lease, err := e.c.Grant(ctx, ttl)
+		if err != nil {
+			return Lock{}, false, err
+		}
+		created, rev, err := e.c.CreateIfAbsent(ctx, key, owner, lease)
+		if err != nil || !created {
+			// 没有拿到锁, 租约没有用了. 撤销失败也不要紧, 它会自己过期
+			e.c.Revoke(ctx, lease)
+			return Lock{}, false, err
+		}
+		return Lock{Key: key, Token: uint64(rev), Expires: start.Add(ttl), owner: owner, lease: lease, ttl: ttl}, true, nil
+	})
+}
+
+func (e *etcdLock) Renew(ctx context.Context, l Lock, ttl time.Duration) (Lock, error) {
+	start := time.Now()
+	found, err := e.c.KeepAliveOnce(ctx, l.lease)
+	if err != nil {
+		return Lock{}, err
+	}
+	if !found {
+		return Lock{}, ErrNotHeld
+	}
+	l.Expires = start.Add(l.ttl)
+	return l, nil
+}
+
+func (e *etcdLock) Release(ctx context.Context, l Lock) error {
+	found, err := e.c.Revoke(ctx, l.lease)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrNotHeld
+	}
+	return nil
+}
@@ -0,0 +1,48 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dlock_test
+
+import (
+	"context"
+	"elements/dlock"
+	"fmt"
+	"time"
+)
+
+// 写入时带上令牌, 存储拒绝比见过的最大令牌更小的写
+type fencedStore struct {
+	newest uint64
+	value  string
+}
+
+func (s *fencedStore) Write(v string, token uint64) error {
+	if token < s.newest {
+		return fmt.Errorf("token %d is older than %d", token, s.newest)
+	}
+	s.newest, s.value = token, v
+	return nil
+}
+
+func Example() {
+	var locks dlock.DLock = dlock.NewLocal()
+	ctx := context.Background()
+	var store fencedStore
+
+	// a拿到锁, 然后停顿了太久, 锁过期了
+	a, _ := locks.Acquire(ctx, "invoice/42", 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+
+	b, _ := locks.Acquire(ctx, "invoice/42", time.Minute)
+	fmt.Println(store.Write("from b", b.Token))
+	// a醒来之后继续写, 它的令牌已经过时了
+	fmt.Println(store.Write("from a", a.Token))
+	fmt.Println(locks.Release(ctx, a))
+	fmt.Println(store.value)
+	// Output:
+	// <nil>
+	// token 1 is older than 2
+	// dlock: lock not held
+	// from b
+}
@@ -0,0 +1,12 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dlock
+
+// The scripts of the Redis backend, for a fake server to recognize.
+const (
+	RedisAcquire = redisAcquire
+	RedisRenew   = redisRenew
+	RedisRelease = redisRelease
+)
@@ -0,0 +1,96 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dlock
+
+import (
+	"context"
+	"elements/cache"
+	"errors"
+	"sync"
+	"time"
+)
+
+// A Local is a DLock for the goroutines of one process, on a
+// cache.LeaseMap. Call Close to release its goroutine.
+type Local struct {
+	leases *cache.LeaseMap
+
+	mu      sync.Mutex
+	changed chan struct{} // closed and replaced whenever a lock is freed
+}
+
+// NewLocal returns an in-process DLock.
+func NewLocal() *Local {
+	l := &Local{changed: make(chan struct{})}
+	l.leases = cache.NewLeaseMap(cache.LeaseConfig{
+		OnExpire: func(cache.Lease) { l.broadcast() },
+		OnRevoke: func(cache.Lease) { l.broadcast() },
+	})
+	return l
+}
+
+// broadcast wakes the Acquires waiting for a lock.
+func (l *Local) broadcast() {
+	l.mu.Lock()
+	close(l.changed)
+	l.changed = make(chan struct{})
+	l.mu.Unlock()
+}
+
+// Acquire implements DLock. It waits for the lock to be released or to
+// expire, rather than polling.
+func (l *Local) Acquire(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	owner := newOwner()
+	for {
+		// 先取channel再尝试: 尝试失败之后的释放一定会关闭这个channel
+		l.mu.Lock()
+		changed := l.changed
+		l.mu.Unlock()
+		lease, err := l.leases.Store(key, owner, nil, ttl)
+		if err == nil {
+			return Lock{Key: key, Token: lease.Token, Expires: lease.Expires, owner: owner}, nil
+		}
+		switch {
+		case errors.Is(err, cache.ErrClosed):
+			return Lock{}, ErrClosed
+		case !errors.Is(err, cache.ErrLeaseHeld):
+			return Lock{}, err
+		}
+		// 持有者可能既不释放也不续约, 最晚在它的租约到期时再试
+		t := time.NewTimer(time.Until(lease.Expires))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return Lock{}, ctx.Err()
+		case <-changed:
+		case <-t.C:
+		}
+		t.Stop()
+	}
+}
+
+// Renew implements DLock.
+func (l *Local) Renew(ctx context.Context, lk Lock, ttl time.Duration) (Lock, error) {
+	lease, err := l.leases.Renew(lk.Key, lk.Token, ttl)
+	if err != nil {
+		return Lock{}, ErrNotHeld
+	}
+	lk.Expires = lease.Expires
+	return lk, nil
+}
+
+// Release implements DLock.
+func (l *Local) Release(ctx context.Context, lk Lock) error {
+	if l.leases.Revoke(lk.Key, lk.Token) != nil {
+		return ErrNotHeld
+	}
+	return nil
+}
+
+// Close releases the goroutine of the Local. Acquire fails with
+// ErrClosed afterwards.
+func (l *Local) Close() {
+	l.leases.Close()
+}
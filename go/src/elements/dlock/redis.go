@@ -0,0 +1,121 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package dlock
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// A RedisScripter runs Lua scripts on a Redis server, as the EVAL
+// command does. Integer replies are returned as int64, and a nil reply as
+// nil, which is what the common clients do: wrapping one takes a line.
+type RedisScripter interface {
+	Eval(ctx context.Context, script string, keys []string, args ...interface{}) (interface{}, error)
+}
+
+// The scripts run atomically on the server. The lock is the key itself,
+// holding the owner of the lock; the fencing tokens of the key are a
+// counter next to it, which never expires.
+const (
+	// KEYS[1]: the lock, KEYS[2]: the counter; ARGV[1]: the owner,
+	// ARGV[2]: the TTL in milliseconds. Returns the token, or 0.
+	redisAcquire = `if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return redis.call('INCR', KEYS[2])
+end
+return 0`
+
+	// KEYS[1]: the lock; ARGV[1]: the owner, ARGV[2]: the TTL in
+	// milliseconds. Returns 1 if the owner held the lock.
+	redisRenew = `if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0`
+
+	// KEYS[1]: the lock; ARGV[1]: the owner. Returns 1 if the owner held
+	// the lock.
+	redisRelease = `if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0`
+)
+
+// A redisLock is a DLock on a Redis server.
+type redisLock struct {
+	c        RedisScripter
+	interval time.Duration
+}
+
+// NewRedis returns a DLock on the Redis server c talks to. The lock on
+// key is the Redis key of that name, and its fencing tokens are counted in
+// key+":fence".
+//
+// It is the single-instance lock of the Redis documentation, not Redlock:
+// if the server fails over to a replica that had not received a lock, the
+// lock can be granted twice, and the fencing tokens are what keeps the
+// second holder from overwriting the first.
+func NewRedis(c RedisScripter, cfg Config) DLock {
+	return &redisLock{c: c, interval: cfg.retryInterval()}
+}
+
+func (r *redisLock) Acquire(ctx context.Context, key string, ttl time.Duration) (Lock, error) {
+	owner := newOwner()
+	return poll(ctx, r.interval, func() (Lock, bool, error) {
+		start := time.Now()
+		v, err := r.c.Eval(ctx, redisAcquire, []string{key, key + ":fence"}, owner, ttl.Milliseconds())
+		if err != nil {
+			return Lock{}, false, err
+		}
+		token, err := redisInt(v)
+		if err != nil || token == 0 {
+			return Lock{}, false, err
+		}
+		// 从发出请求算起: 服务器上的TTL不会早于这个时间到期
+		return Lock{Key: key, Token: uint64(token), Expires: start.Add(ttl), owner: owner}, true, nil
+	})
+}
+
+func (r *redisLock) Renew(ctx context.Context, l Lock, ttl time.Duration) (Lock, error) {
+	start := time.Now()
+	v, err := r.c.Eval(ctx, redisRenew, []string{l.Key}, l.owner, ttl.Milliseconds())
+	if err != nil {
+		return Lock{}, err
+	}
+	if n, err := redisInt(v); err != nil || n != 1 {
+		if err == nil {
+			err = ErrNotHeld
+		}
+		return Lock{}, err
+	}
+	l.Expires = start.Add(ttl)
+	return l, nil
+}
+
+func (r *redisLock) Release(ctx context.Context, l Lock) error {
+	v, err := r.c.Eval(ctx, redisRelease, []string{l.Key}, l.owner)
+	if err != nil {
+		return err
+	}
+	if n, err := redisInt(v); err != nil || n != 1 {
+		if err == nil {
+			err = ErrNotHeld
+		}
+		return err
+	}
+	return nil
+}
+
+var errRedisReply = errors.New("dlock: unexpected reply from Redis")
+
+func redisInt(v interface{}) (int64, error) {
+	switch v := v.(type) {
+	case int64:
+		return v, nil
+	case nil:
+		return 0, nil
+	}
+	return 0, errRedisReply
+}
@@ -0,0 +1,152 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package errgroup provides synchronization, error propagation, and Context
+// cancelation for groups of goroutines working on subtasks of a common task.
+//
+// It is golang.org/x/sync/errgroup, with annotations.
+package errgroup
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+type token struct{}
+
+// A Group is a collection of goroutines working on subtasks that are part of
+// the same overall task.
+//
+// A zero Group is valid, has no limit on the number of active goroutines,
+// and does not cancel on error.
+//
+// Group = WaitGroup + 只记录第一个错误 + 出错时取消context + 可选的并发上限.
+// 这几样单独用标准库都能写, 但每次都要重新处理"多个goroutine同时出错"
+// 和"出错之后别的goroutine怎么知道该停下"
+type Group struct {
+	// 出错时调用, 取消WithContext返回的ctx. 零值Group中是nil
+	cancel func()
+
+	wg sync.WaitGroup
+
+	// 并发上限的信号量: 容量是上限, 每个运行中的goroutine占一个位置.
+	// nil表示没有上限
+	sem chan token
+
+	// 只有第一个错误会被记录. 用Once而不是加锁比较err == nil:
+	// 第一个出错的goroutine同时负责cancel, 两件事必须作为一个整体只做一次
+	errOnce sync.Once
+	err     error
+}
+
+func (g *Group) done() {
+	if g.sem != nil {
+		<-g.sem
+	}
+	g.wg.Done()
+}
+
+// WithContext returns a new Group and an associated Context derived from ctx.
+//
+// The derived Context is canceled the first time a function passed to Go
+// returns a non-nil error or the first time Wait returns, whichever occurs
+// first.
+func WithContext(ctx context.Context) (*Group, context.Context) {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Group{cancel: cancel}, ctx
+}
+
+// Wait blocks until all function calls from the Go method have returned, then
+// returns the first non-nil error (if any) from them.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	// 所有goroutine都结束了, ctx不再有用. 不cancel的话, 它和它的父context
+	// 之间的关联要等父context结束才会释放
+	if g.cancel != nil {
+		g.cancel()
+	}
+	// wg.Wait建立了happens-before: 所有goroutine中对g.err的写入都在这之前
+	return g.err
+}
+
+// Go calls the given function in a new goroutine.
+// It blocks until the new goroutine can be added without the number of
+// active goroutines in the group exceeding the configured limit.
+//
+// The first call to return a non-nil error cancels the group's context, if the
+// group was created by calling WithContext. The error will be returned by Wait.
+func (g *Group) Go(f func() error) {
+	// 在调用者的goroutine中等待信号量, 而不是启动goroutine之后再等:
+	// 上限限制的是goroutine的数量, 不只是同时运行的f的数量
+	if g.sem != nil {
+		g.sem <- token{}
+	}
+
+	// Add必须在go语句之前, 否则Wait可能在新goroutine执行Add之前就返回了
+	g.wg.Add(1)
+	go func() {
+		defer g.done()
+
+		if err := f(); err != nil {
+			g.errOnce.Do(func() {
+				g.err = err
+				if g.cancel != nil {
+					g.cancel()
+				}
+			})
+		}
+	}()
+}
+
+// TryGo calls the given function in a new goroutine only if the number of
+// active goroutines in the group is currently below the configured limit.
+//
+// The return value reports whether the goroutine was started.
+func (g *Group) TryGo(f func() error) bool {
+	if g.sem != nil {
+		select {
+		case g.sem <- token{}:
+			// Note: this allows barging iff channels in general allow barging.
+		default:
+			return false
+		}
+	}
+
+	g.wg.Add(1)
+	go func() {
+		defer g.done()
+
+		if err := f(); err != nil {
+			g.errOnce.Do(func() {
+				g.err = err
+				if g.cancel != nil {
+					g.cancel()
+				}
+			})
+		}
+	}()
+	return true
+}
+
+// SetLimit limits the number of active goroutines in this group to at most n.
+// A negative value indicates no limit.
+//
+// Any subsequent call to the Go method will block until it can add an active
+// goroutine without exceeding the configured limit.
+//
+// The limit must not be modified while any goroutines in the group are active.
+//
+// 换一个channel就是换一个信号量. 有goroutine在运行时换掉它, 运行中的
+// goroutine会从新的channel中取出不属于自己的位置, 所以直接panic
+func (g *Group) SetLimit(n int) {
+	if n < 0 {
+		g.sem = nil
+		return
+	}
+	if len(g.sem) != 0 {
+		panic(fmt.Errorf("errgroup: modify limit while %v goroutines in the group are still active", len(g.sem)))
+	}
+	g.sem = make(chan token, n)
+}
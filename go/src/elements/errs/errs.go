@@ -0,0 +1,81 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package errs defines the kinds of failure shared by the packages of
+// go-elements, so that a caller can tell why an operation failed with
+// errors.Is, whichever package it came from:
+//
+//	v, err := pool.TryGet(ctx)
+//	if errors.Is(err, errs.ErrCapacity) {
+//		// every resource is in use: shed the request
+//	}
+//
+// Each package keeps sentinels of its own, such as heap.ErrClosed, whose
+// messages name the package, made with New so that they are also the
+// shared kind. Errors about a key are a *KeyError, which adds the
+// operation and the key to the sentinel it wraps.
+package errs
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrClosed means the queue, pool or map was closed or stopped.
+	ErrClosed = errors.New("closed")
+
+	// ErrTimeout means the operation gave up at a deadline. Its Timeout
+	// method reports true, as those of the net package's timeouts do.
+	ErrTimeout error = timeoutError{}
+
+	// ErrCapacity means the operation needs more than there is room for:
+	// every resource is in use, or the request is larger than the limit.
+	ErrCapacity = errors.New("capacity exceeded")
+
+	// ErrNotFound means the key, or the lease or other state it names,
+	// is not there.
+	ErrNotFound = errors.New("not found")
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string { return "timeout" }
+func (timeoutError) Timeout() bool { return true }
+
+// New returns an error with the given text that errors.Is also reports
+// to be kind, one of the kinds of this package. It is meant for the
+// sentinels of other packages:
+//
+//	var ErrClosed = errs.New("heap: queue closed", errs.ErrClosed)
+func New(text string, kind error) error {
+	return &kindError{text, kind}
+}
+
+type kindError struct {
+	text string
+	kind error
+}
+
+func (e *kindError) Error() string { return e.text }
+func (e *kindError) Unwrap() error { return e.kind }
+
+// A KeyError records an error and the operation and key that caused it.
+type KeyError struct {
+	Op  string // the operation, such as "renew"
+	Key interface{}
+	Err error
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("%s %v: %v", e.Op, e.Key, e.Err)
+}
+
+func (e *KeyError) Unwrap() error { return e.Err }
+
+// Timeout reports whether the error is a timeout.
+func (e *KeyError) Timeout() bool {
+	t, ok := e.Err.(interface{ Timeout() bool })
+	return ok && t.Timeout()
+}
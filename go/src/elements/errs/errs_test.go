@@ -0,0 +1,59 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package errs_test
+
+import (
+	"elements/errs"
+	"errors"
+	"testing"
+)
+
+func TestNew(t *testing.T) {
+	err := errs.New("heap: queue closed", errs.ErrClosed)
+	if err.Error() != "heap: queue closed" {
+		t.Errorf("Error() = %q", err.Error())
+	}
+	if !errors.Is(err, errs.ErrClosed) || errors.Is(err, errs.ErrNotFound) {
+		t.Errorf("%v has the wrong kind", err)
+	}
+	if errors.Is(err, errs.New("heap: queue closed", errs.ErrClosed)) {
+		t.Error("two sentinels with the same text are the same error")
+	}
+}
+
+func TestKeyError(t *testing.T) {
+	notFound := errs.New("cache: no such lease", errs.ErrNotFound)
+	var err error = &errs.KeyError{Op: "renew", Key: "job", Err: notFound}
+	if got, want := err.Error(), "renew job: cache: no such lease"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if !errors.Is(err, notFound) || !errors.Is(err, errs.ErrNotFound) {
+		t.Errorf("%v does not wrap its error", err)
+	}
+	var ke *errs.KeyError
+	if !errors.As(err, &ke) || ke.Key != "job" {
+		t.Errorf("errors.As(%v) = %+v", err, ke)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	type timeout interface{ Timeout() bool }
+	for _, err := range []error{
+		errs.ErrTimeout,
+		errs.New("semaphore: wait timeout", errs.ErrTimeout),
+		&errs.KeyError{Op: "wait", Key: 1, Err: errs.ErrTimeout},
+	} {
+		var te timeout
+		if !errors.As(err, &te) || !te.Timeout() {
+			t.Errorf("%v is not a timeout", err)
+		}
+		if !errors.Is(err, errs.ErrTimeout) {
+			t.Errorf("%v is not an ErrTimeout", err)
+		}
+	}
+	if (&errs.KeyError{Op: "wait", Key: 1, Err: errs.ErrCapacity}).Timeout() {
+		t.Error("a KeyError of ErrCapacity is a timeout")
+	}
+}
@@ -0,0 +1,25 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package expiry_test
+
+import (
+	"elements/expiry"
+	"fmt"
+	"time"
+)
+
+func ExampleRunner() {
+	r := expiry.Start(expiry.Config{})
+	defer r.Stop()
+
+	done := make(chan string)
+	r.AfterFunc(20*time.Millisecond, func() { done <- "second" })
+	r.AfterFunc(10*time.Millisecond, func() { done <- "first" })
+	fmt.Println(<-done)
+	fmt.Println(<-done)
+	// Output:
+	// first
+	// second
+}
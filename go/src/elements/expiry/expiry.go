@@ -0,0 +1,249 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package expiry runs the expiry timers of many structures on one
+// goroutine.
+//
+// Each structure that expires its entries by itself would otherwise keep
+// its own goroutine and timers: a SessionMap, a LeaseMap, a cache of its
+// own. A process starts one Runner instead, and hands it to all of them:
+//
+//	var expiries = expiry.Start(expiry.Config{})
+//
+//	sessions := cache.NewSessionMap(cache.SessionConfig{IdleTimeout: time.Minute, Runner: expiries})
+//	leases := cache.NewLeaseMap(cache.LeaseConfig{Runner: expiries})
+//
+// Two expiring structures do not run on a Runner. A cache.ExpiringSet
+// has no timer or goroutine to share: it drops its expired keys on the
+// calls that follow. A heap.DelayQueue has no goroutine of its own
+// either: a call to Take sets a timer for the head of the queue and
+// waits on it, and a Runner below package expiry would be an import
+// cycle, since the Runner orders its buckets with package heap.
+package expiry
+
+import (
+	"context"
+	"elements/clock"
+	"elements/heap"
+	"elements/lifecycle"
+	"sync"
+	"time"
+)
+
+// Config configures a Runner.
+type Config struct {
+	// Tick is the resolution of the Runner: timers are due on the next
+	// whole Tick after their duration, and all the timers due on the
+	// same Tick fire together. Zero means 10 milliseconds.
+	Tick time.Duration
+
+	// Clock, if not nil, is the clock the timers run on. Otherwise they
+	// run on clock.Real.
+	Clock clock.Clock
+}
+
+// A Runner fires timers, each in its own goroutine. It is safe for
+// concurrent use.
+//
+// The timers are filed in buckets, one per Tick, which a heap orders by
+// time, as an ExpiringSet files its keys: adding or stopping a timer is
+// O(1) once its bucket exists, and the heap operations are per bucket.
+// The goroutine of the Runner sleeps until the earliest bucket is due,
+// rather than waking up every Tick as a timing wheel does.
+type Runner struct {
+	tick  int64
+	clock clock.Clock
+	start time.Time // the times of the buckets are since start, on the monotonic clock
+
+	mu      sync.Mutex
+	buckets map[int64]*bucket
+	order   bucketHeap // buckets by index, earliest first
+	n       int        // pending timers
+	stopped bool
+
+	wake chan struct{} // a bucket earlier than the earliest was added
+	done chan struct{} // closed by Stop
+}
+
+// A Timer is a timer scheduled on a Runner.
+type Timer struct {
+	r *Runner
+	f func()
+	b *bucket // the bucket of a pending timer, nil otherwise; guarded by r.mu
+	i int     // t == b.timers[i]
+}
+
+type bucket struct {
+	index  int64 // the bucket is due at index*tick
+	timers []*Timer
+}
+
+type bucketHeap []*bucket
+
+func (h bucketHeap) Len() int            { return len(h) }
+func (h bucketHeap) Less(i, j int) bool  { return h[i].index < h[j].index }
+func (h bucketHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *bucketHeap) Push(x interface{}) { *h = append(*h, x.(*bucket)) }
+
+func (h *bucketHeap) Pop() interface{} {
+	old := *h
+	b := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return b
+}
+
+// Start returns a Runner with its goroutine running, registered in
+// lifecycle.Default. Call Stop to release it.
+func Start(cfg Config) *Runner {
+	tick := cfg.Tick
+	if tick <= 0 {
+		tick = 10 * time.Millisecond
+	}
+	c := clock.Or(cfg.Clock)
+	r := &Runner{
+		tick:    int64(tick),
+		clock:   c,
+		start:   c.Now(),
+		buckets: make(map[int64]*bucket),
+		wake:    make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+	go r.run()
+	lifecycle.Register(r, "expiry.Runner", func(context.Context) error {
+		r.Stop()
+		return nil
+	})
+	return r
+}
+
+// AfterFunc waits for at least the duration d, rounded up to the next
+// whole Tick, and then calls f in its own goroutine. A timer added after
+// Stop never fires.
+func (r *Runner) AfterFunc(d time.Duration, f func()) *Timer {
+	t := &Timer{r: r, f: f}
+	// 向上取整: 桶到期时, 其中所有的定时器都已经等够了d
+	index := (int64(clock.Since(r.clock, r.start)+d) + r.tick - 1) / r.tick
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped {
+		return t
+	}
+	b := r.buckets[index]
+	if b == nil {
+		b = &bucket{index: index}
+		r.buckets[index] = b
+		heap.Push(&r.order, b)
+		if r.order[0] == b {
+			// 比goroutine正在等的桶更早, 叫醒它重新计算
+			select {
+			case r.wake <- struct{}{}:
+			default:
+			}
+		}
+	}
+	t.b, t.i = b, len(b.timers)
+	b.timers = append(b.timers, t)
+	r.n++
+	return t
+}
+
+// Clock returns the clock the timers of r run on.
+func (r *Runner) Clock() clock.Clock { return r.clock }
+
+// Len returns the number of timers that have not fired or been stopped.
+func (r *Runner) Len() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.n
+}
+
+// Stop stops r. Timers that have not fired never fire.
+func (r *Runner) Stop() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.stopped {
+		return
+	}
+	r.stopped = true
+	lifecycle.Unregister(r)
+	for _, b := range r.order {
+		for _, t := range b.timers {
+			t.b = nil
+		}
+	}
+	r.buckets, r.order, r.n = nil, nil, 0
+	close(r.done)
+}
+
+// Stop prevents the timer from firing. It returns true if the call stops
+// the timer, false if the timer has already fired or been stopped.
+func (t *Timer) Stop() bool {
+	r := t.r
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	b := t.b
+	if b == nil {
+		return false
+	}
+	// 和桶中最后一个定时器交换位置再删除, 桶空了也留在堆中, 到期时丢弃
+	last := b.timers[len(b.timers)-1]
+	b.timers[t.i], last.i = last, t.i
+	b.timers[len(b.timers)-1] = nil
+	b.timers = b.timers[:len(b.timers)-1]
+	t.b = nil
+	r.n--
+	return true
+}
+
+func (r *Runner) run() {
+	timer := r.clock.NewTimer(time.Hour)
+	timer.Stop()
+	defer timer.Stop()
+	for {
+		due, wait := r.advance()
+		for _, f := range due {
+			go f()
+		}
+		var c <-chan time.Time
+		if wait >= 0 {
+			if !timer.Stop() {
+				select {
+				case <-timer.C():
+				default:
+				}
+			}
+			timer.Reset(wait)
+			c = timer.C()
+		}
+		select {
+		case <-c:
+		case <-r.wake:
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// advance removes the buckets that are due and returns the functions of
+// their timers, and how long until the next bucket is due, or -1 if there
+// is none.
+func (r *Runner) advance() (due []func(), wait time.Duration) {
+	now := int64(clock.Since(r.clock, r.start))
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for len(r.order) > 0 && r.order[0].index*r.tick <= now {
+		b := heap.Pop(&r.order).(*bucket)
+		delete(r.buckets, b.index)
+		for _, t := range b.timers {
+			t.b = nil
+			due = append(due, t.f)
+		}
+		r.n -= len(b.timers)
+	}
+	if len(r.order) == 0 {
+		return due, -1
+	}
+	return due, time.Duration(r.order[0].index*r.tick - now)
+}
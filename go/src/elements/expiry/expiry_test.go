@@ -0,0 +1,114 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package expiry_test
+
+import (
+	"elements/expiry"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAfterFunc(t *testing.T) {
+	r := expiry.Start(expiry.Config{Tick: time.Millisecond})
+	defer r.Stop()
+	var (
+		mu    sync.Mutex
+		fired []int
+		wg    sync.WaitGroup
+	)
+	start := time.Now()
+	for _, ms := range []int{30, 10, 20} {
+		ms := ms
+		wg.Add(1)
+		r.AfterFunc(time.Duration(ms)*time.Millisecond, func() {
+			defer wg.Done()
+			if d := time.Since(start); d < time.Duration(ms)*time.Millisecond {
+				t.Errorf("timer of %dms fired after %v", ms, d)
+			}
+			mu.Lock()
+			fired = append(fired, ms)
+			mu.Unlock()
+		})
+	}
+	if n := r.Len(); n != 3 {
+		t.Errorf("Len = %d; want 3", n)
+	}
+	wg.Wait()
+	if len(fired) != 3 || fired[0] != 10 || fired[1] != 20 || fired[2] != 30 {
+		t.Errorf("fired %v; want [10 20 30]", fired)
+	}
+	if n := r.Len(); n != 0 {
+		t.Errorf("Len = %d after firing; want 0", n)
+	}
+}
+
+// 后加入的更早的定时器要叫醒正在等待更晚的桶的goroutine
+func TestAfterFuncEarlier(t *testing.T) {
+	r := expiry.Start(expiry.Config{Tick: time.Millisecond})
+	defer r.Stop()
+	r.AfterFunc(time.Hour, func() { t.Error("timer of an hour fired") })
+	time.Sleep(10 * time.Millisecond)
+	done := make(chan struct{})
+	start := time.Now()
+	r.AfterFunc(10*time.Millisecond, func() { close(done) })
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("timer did not fire")
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("timer of 10ms fired after %v", d)
+	}
+}
+
+func TestStop(t *testing.T) {
+	r := expiry.Start(expiry.Config{Tick: time.Millisecond})
+	defer r.Stop()
+	var timers []*expiry.Timer
+	fired := make(chan int, 10)
+	for i := 0; i < 10; i++ {
+		i := i
+		// 同一个桶中的定时器, 停止其中一部分
+		timers = append(timers, r.AfterFunc(20*time.Millisecond, func() { fired <- i }))
+	}
+	for i := 0; i < 10; i += 2 {
+		if !timers[i].Stop() {
+			t.Errorf("Stop of timer %d = false", i)
+		}
+		if timers[i].Stop() {
+			t.Errorf("second Stop of timer %d = true", i)
+		}
+	}
+	if n := r.Len(); n != 5 {
+		t.Errorf("Len = %d; want 5", n)
+	}
+	seen := make(map[int]bool)
+	for len(seen) < 5 {
+		i := <-fired
+		if i%2 == 0 || seen[i] {
+			t.Fatalf("timer %d fired", i)
+		}
+		seen[i] = true
+	}
+	if timers[1].Stop() {
+		t.Error("Stop of a fired timer = true")
+	}
+}
+
+func TestRunnerStop(t *testing.T) {
+	r := expiry.Start(expiry.Config{Tick: time.Millisecond})
+	tm := r.AfterFunc(10*time.Millisecond, func() { t.Error("timer fired after Stop") })
+	r.Stop()
+	r.Stop()
+	if tm.Stop() {
+		t.Error("Timer.Stop after Runner.Stop = true")
+	}
+	r.AfterFunc(0, func() { t.Error("timer added after Stop fired") })
+	if n := r.Len(); n != 0 {
+		t.Errorf("Len = %d after Stop; want 0", n)
+	}
+	time.Sleep(30 * time.Millisecond)
+}
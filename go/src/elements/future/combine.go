@@ -0,0 +1,176 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package future
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Errors is the error of an Any whose Futures all failed: their errors,
+// in the order of the Futures.
+type Errors []error
+
+func (e Errors) Error() string {
+	if len(e) == 0 {
+		return "future: Any of no futures"
+	}
+	s := "future: all failed: " + e[0].Error()
+	for _, err := range e[1:] {
+		s += "; " + err.Error()
+	}
+	return s
+}
+
+// All returns a Future of the results of fs, a []interface{} in the order
+// of fs. It fails with the first error of fs, or with ctx.Err() if ctx is
+// done first, and then cancels the rest of fs. Canceling it cancels fs.
+func All(ctx context.Context, fs ...*Future) *Future {
+	out := newFuture(func() { cancelAll(fs) })
+	vs := make([]interface{}, len(fs))
+	if len(fs) == 0 {
+		out.complete(vs, nil)
+		return out
+	}
+	left := int32(len(fs))
+	for i, f := range fs {
+		go func(i int, f *Future) {
+			if !wait(f, out) {
+				return
+			}
+			if f.err != nil {
+				out.finish(nil, f.err)
+				return
+			}
+			vs[i] = f.v
+			// AddInt32之前写入的vs对最后一个减到0的goroutine可见
+			if atomic.AddInt32(&left, -1) == 0 {
+				out.finish(vs, nil)
+			}
+		}(i, f)
+	}
+	watch(ctx, out)
+	return out
+}
+
+// Any returns a Future of the first result of fs without an error, and
+// then cancels the rest of fs. If all of fs fail it fails with their
+// Errors, and if ctx is done first with ctx.Err(). Canceling it cancels
+// fs.
+func Any(ctx context.Context, fs ...*Future) *Future {
+	out := newFuture(func() { cancelAll(fs) })
+	errs := make(Errors, len(fs))
+	if len(fs) == 0 {
+		out.complete(nil, errs)
+		return out
+	}
+	left := int32(len(fs))
+	for i, f := range fs {
+		go func(i int, f *Future) {
+			if !wait(f, out) {
+				return
+			}
+			if f.err == nil {
+				out.finish(f.v, nil)
+				return
+			}
+			errs[i] = f.err
+			if atomic.AddInt32(&left, -1) == 0 {
+				out.finish(nil, errs)
+			}
+		}(i, f)
+	}
+	watch(ctx, out)
+	return out
+}
+
+// Race returns a Future of the result of the first of fs to complete,
+// error or not, and then cancels the rest of fs. It fails with ctx.Err()
+// if ctx is done first. Canceling it cancels fs. The Race of no Futures
+// completes only when ctx is done or it is canceled.
+func Race(ctx context.Context, fs ...*Future) *Future {
+	out := newFuture(func() { cancelAll(fs) })
+	for _, f := range fs {
+		go func(f *Future) {
+			if wait(f, out) {
+				out.finish(f.v, f.err)
+			}
+		}(f)
+	}
+	watch(ctx, out)
+	return out
+}
+
+// Then returns a Future of fn applied to the value of f, once f is
+// completed without an error. If f fails, the returned Future fails with
+// the same error, without calling fn. Canceling it cancels f.
+func (f *Future) Then(fn func(v interface{}) (interface{}, error)) *Future {
+	out := newFuture(func() { f.Cancel() })
+	go func() {
+		if !wait(f, out) {
+			return
+		}
+		if f.err != nil {
+			out.finish(nil, f.err)
+			return
+		}
+		out.finish(fn(f.v))
+	}()
+	return out
+}
+
+// Catch returns a Future of fn applied to the error of f, once f fails. If
+// f succeeds, the returned Future has the same value, without calling fn.
+// Canceling it cancels f.
+func (f *Future) Catch(fn func(err error) (interface{}, error)) *Future {
+	out := newFuture(func() { f.Cancel() })
+	go func() {
+		if !wait(f, out) {
+			return
+		}
+		if f.err == nil {
+			out.finish(f.v, nil)
+			return
+		}
+		out.finish(fn(f.err))
+	}()
+	return out
+}
+
+// wait waits for f to complete, and reports whether out is still pending
+// by then: there is no point in looking at f for an out that is done.
+func wait(f, out *Future) bool {
+	select {
+	case <-f.done:
+	case <-out.done:
+		return false
+	}
+	select {
+	case <-out.done:
+		return false
+	default:
+		return true
+	}
+}
+
+// watch finishes out with ctx.Err() when ctx is done first.
+func watch(ctx context.Context, out *Future) {
+	if ctx.Done() == nil {
+		return
+	}
+	go func() {
+		select {
+		case <-ctx.Done():
+			out.finish(nil, ctx.Err())
+		case <-out.done:
+		}
+	}()
+}
+
+func cancelAll(fs []*Future) {
+	for _, f := range fs {
+		f.Cancel()
+	}
+}
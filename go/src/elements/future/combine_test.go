@@ -0,0 +1,173 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package future_test
+
+import (
+	"context"
+	"elements/future"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var errBoom = errors.New("boom")
+
+func promises(n int) ([]*future.Promise, []*future.Future) {
+	ps := make([]*future.Promise, n)
+	fs := make([]*future.Future, n)
+	for i := range ps {
+		ps[i] = future.NewPromise()
+		fs[i] = ps[i].Future()
+	}
+	return ps, fs
+}
+
+func get(t *testing.T, f *future.Future) (interface{}, error) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	v, err := f.Get(ctx)
+	if err == context.DeadlineExceeded {
+		t.Fatal("Future never completed")
+	}
+	return v, err
+}
+
+// canceled checks that every one of fs is completed with ErrCanceled.
+func canceled(t *testing.T, fs ...*future.Future) {
+	t.Helper()
+	for i, f := range fs {
+		if _, err := get(t, f); err != future.ErrCanceled {
+			t.Fatalf("future %d: err = %v; want %v", i, err, future.ErrCanceled)
+		}
+	}
+}
+
+func TestCancel(t *testing.T) {
+	p := future.NewPromise()
+	f := p.Future()
+	if !f.Cancel() || f.Cancel() {
+		t.Fatal("Cancel = false, or twice true")
+	}
+	if p.Resolve(1) {
+		t.Fatal("Resolve after Cancel = true")
+	}
+	canceled(t, f)
+	if future.Resolved(1).Cancel() {
+		t.Fatal("Cancel of a completed Future = true")
+	}
+}
+
+func TestAll(t *testing.T) {
+	ps, fs := promises(3)
+	all := future.All(context.Background(), fs...)
+	ps[2].Resolve("c")
+	ps[0].Resolve("a")
+	ps[1].Resolve("b")
+	v, err := get(t, all)
+	if want := []interface{}{"a", "b", "c"}; !reflect.DeepEqual(v, want) || err != nil {
+		t.Fatalf("All = %v, %v; want %v, nil", v, err, want)
+	}
+	if v, err := get(t, future.All(context.Background())); len(v.([]interface{})) != 0 || err != nil {
+		t.Fatalf("All() = %v, %v; want [], nil", v, err)
+	}
+}
+
+func TestAllFails(t *testing.T) {
+	ps, fs := promises(3)
+	all := future.All(context.Background(), fs...)
+	ps[1].Reject(errBoom)
+	if _, err := get(t, all); err != errBoom {
+		t.Fatalf("All = %v; want %v", err, errBoom)
+	}
+	canceled(t, fs[0], fs[2])
+}
+
+func TestAllContext(t *testing.T) {
+	_, fs := promises(2)
+	ctx, cancel := context.WithCancel(context.Background())
+	all := future.All(ctx, fs...)
+	cancel()
+	if _, err := get(t, all); err != context.Canceled {
+		t.Fatalf("All = %v; want %v", err, context.Canceled)
+	}
+	canceled(t, fs...)
+}
+
+func TestAny(t *testing.T) {
+	ps, fs := promises(3)
+	first := future.Any(context.Background(), fs...)
+	ps[0].Reject(errBoom)
+	ps[2].Resolve("c")
+	if v, err := get(t, first); v != "c" || err != nil {
+		t.Fatalf("Any = %v, %v; want c, nil", v, err)
+	}
+	canceled(t, fs[1])
+
+	ps, fs = promises(2)
+	first = future.Any(context.Background(), fs...)
+	errOther := errors.New("other")
+	ps[1].Reject(errOther)
+	ps[0].Reject(errBoom)
+	_, err := get(t, first)
+	if errs, ok := err.(future.Errors); !ok || len(errs) != 2 || errs[0] != errBoom || errs[1] != errOther {
+		t.Fatalf("Any = %v; want Errors{%v, %v}", err, errBoom, errOther)
+	}
+}
+
+func TestRace(t *testing.T) {
+	ps, fs := promises(3)
+	race := future.Race(context.Background(), fs...)
+	ps[1].Reject(errBoom)
+	if _, err := get(t, race); err != errBoom {
+		t.Fatalf("Race = %v; want %v", err, errBoom)
+	}
+	canceled(t, fs[0], fs[2])
+}
+
+func TestThen(t *testing.T) {
+	p := future.NewPromise()
+	double := func(v interface{}) (interface{}, error) { return v.(int) * 2, nil }
+	f := p.Future().Then(double).Then(double)
+	p.Resolve(1)
+	if v, err := get(t, f); v != 4 || err != nil {
+		t.Fatalf("Then = %v, %v; want 4, nil", v, err)
+	}
+
+	called := false
+	f = future.Rejected(errBoom).Then(func(v interface{}) (interface{}, error) {
+		called = true
+		return nil, nil
+	})
+	if _, err := get(t, f); err != errBoom || called {
+		t.Fatalf("Then of a failure = %v, called %v; want %v, not called", err, called, errBoom)
+	}
+}
+
+func TestCatch(t *testing.T) {
+	recovered := func(err error) (interface{}, error) { return "fallback", nil }
+	if v, err := get(t, future.Rejected(errBoom).Catch(recovered)); v != "fallback" || err != nil {
+		t.Fatalf("Catch = %v, %v; want fallback, nil", v, err)
+	}
+	if v, err := get(t, future.Resolved("ok").Catch(recovered)); v != "ok" || err != nil {
+		t.Fatalf("Catch of a success = %v, %v; want ok, nil", v, err)
+	}
+}
+
+// TestCancelPropagates cancels the end of a chain: every Future it was
+// derived from is canceled, up to the Promises.
+func TestCancelPropagates(t *testing.T) {
+	ps, fs := promises(2)
+	id := func(v interface{}) (interface{}, error) { return v, nil }
+	end := future.All(context.Background(), fs[0].Then(id), fs[1]).Catch(func(err error) (interface{}, error) {
+		return nil, err
+	})
+	end.Cancel()
+	canceled(t, fs...)
+	if ps[0].Resolve(1) {
+		t.Fatal("Resolve after the chain was canceled = true")
+	}
+}
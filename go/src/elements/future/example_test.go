@@ -0,0 +1,35 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package future_test
+
+import (
+	"context"
+	"elements/future"
+	"fmt"
+)
+
+func Example() {
+	p := future.NewPromise()
+	go func() {
+		p.Resolve(6 * 7)
+	}()
+	v, err := p.Future().Get(context.Background())
+	fmt.Println(v, err)
+	// Output: 42 <nil>
+}
+
+func ExampleAll() {
+	fetch := func(name string) *future.Future {
+		p := future.NewPromise()
+		go p.Resolve("profile of " + name)
+		return p.Future()
+	}
+	all := future.All(context.Background(), fetch("ann"), fetch("bob"))
+	greeting := all.Then(func(v interface{}) (interface{}, error) {
+		return fmt.Sprint(len(v.([]interface{})), " profiles: ", v), nil
+	})
+	fmt.Println(greeting.Get(context.Background()))
+	// Output: 2 profiles: [profile of ann profile of bob] <nil>
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package future provides a value that becomes available later: a Future
+// is read by any number of goroutines, and completed once, through its
+// Promise, by the goroutine that computes it.
+//
+//	p := future.NewPromise()
+//	go func() { p.Complete(fetch()) }()
+//	v, err := p.Future().Get(ctx)
+//
+// It is what a channel of capacity one does for a single receiver, for
+// every receiver: a completed Future keeps its result, and Get returns it
+// to each caller.
+//
+// A Future can be canceled, which completes it with ErrCanceled. The
+// computation behind it notices by watching Done of its Future, and the
+// Futures derived from others by All, Any, Race, Then and Catch cancel
+// the Futures they were derived from.
+package future
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// ErrCanceled is the error of a canceled Future.
+var ErrCanceled = errors.New("future: canceled")
+
+// A Future is the result of a computation that may not have finished. It
+// is safe for concurrent use.
+type Future struct {
+	state uint32        // futurePending, futureCompleting, futureDone; accessed atomically
+	done  chan struct{} // closed once the result is set
+	v     interface{}
+	err   error
+
+	// onCancel, if not nil, is called by the call of cancel that
+	// completes the Future: it cancels the Futures this one was derived
+	// from.
+	onCancel func()
+}
+
+const (
+	futurePending uint32 = iota
+	futureCompleting
+	futureDone
+)
+
+// A Promise completes its Future. It is safe for concurrent use: the
+// first call that completes the Future sets its result, and the others
+// do nothing.
+type Promise struct {
+	f *Future
+}
+
+// NewPromise returns a Promise of a pending Future.
+func NewPromise() *Promise {
+	return &Promise{f: newFuture(nil)}
+}
+
+func newFuture(onCancel func()) *Future {
+	return &Future{done: make(chan struct{}), onCancel: onCancel}
+}
+
+// Future returns the Future that p completes.
+func (p *Promise) Future() *Future { return p.f }
+
+// Complete sets the result of the Future, unless it has one, and reports
+// whether it did.
+func (p *Promise) Complete(v interface{}, err error) bool {
+	return p.f.complete(v, err)
+}
+
+func (f *Future) complete(v interface{}, err error) bool {
+	if !atomic.CompareAndSwapUint32(&f.state, futurePending, futureCompleting) {
+		return false
+	}
+	// 只有赢得CAS的goroutine写结果, 读者在done关闭之后才读
+	f.v, f.err = v, err
+	atomic.StoreUint32(&f.state, futureDone)
+	close(f.done)
+	return true
+}
+
+// Resolve completes the Future with v and no error.
+func (p *Promise) Resolve(v interface{}) bool { return p.Complete(v, nil) }
+
+// Reject completes the Future with err.
+func (p *Promise) Reject(err error) bool { return p.Complete(nil, err) }
+
+// Resolved returns a Future completed with v.
+func Resolved(v interface{}) *Future {
+	p := NewPromise()
+	p.Resolve(v)
+	return p.f
+}
+
+// Rejected returns a Future completed with err.
+func Rejected(err error) *Future {
+	p := NewPromise()
+	p.Reject(err)
+	return p.f
+}
+
+// Done returns a channel that is closed when the Future is completed.
+func (f *Future) Done() <-chan struct{} { return f.done }
+
+// Get waits for the Future to complete and returns its result, or returns
+// ctx.Err() if ctx is done first. Giving up on a Future does not cancel
+// the computation behind it: Cancel does.
+func (f *Future) Get(ctx context.Context) (interface{}, error) {
+	select {
+	case <-f.done:
+		return f.v, f.err
+	default:
+	}
+	select {
+	case <-f.done:
+		return f.v, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Cancel completes the Future with ErrCanceled, unless it is completed
+// already, and reports whether it did. Canceling a Future derived from
+// others cancels them too.
+func (f *Future) Cancel() bool { return f.finish(nil, ErrCanceled) }
+
+// finish completes a derived Future, and cancels the Futures it was
+// derived from: they are completed already, unless it finished first
+// because one of them failed, ctx was done, or it was canceled.
+func (f *Future) finish(v interface{}, err error) bool {
+	if !f.complete(v, err) {
+		return false
+	}
+	if f.onCancel != nil {
+		f.onCancel()
+	}
+	return true
+}
+
+// Result returns the result of the Future without waiting. ok is false if
+// the Future is not completed yet.
+func (f *Future) Result() (v interface{}, err error, ok bool) {
+	if atomic.LoadUint32(&f.state) != futureDone {
+		return nil, nil, false
+	}
+	return f.v, f.err, true
+}
@@ -0,0 +1,95 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package future_test
+
+import (
+	"context"
+	"elements/future"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestComplete(t *testing.T) {
+	p := future.NewPromise()
+	f := p.Future()
+	if _, _, ok := f.Result(); ok {
+		t.Fatal("Result of a pending Future is ok")
+	}
+	select {
+	case <-f.Done():
+		t.Fatal("Done closed before Complete")
+	default:
+	}
+	if !p.Resolve(1) {
+		t.Fatal("first Resolve = false")
+	}
+	if p.Resolve(2) || p.Reject(errors.New("late")) {
+		t.Fatal("second completion = true")
+	}
+	v, err := f.Get(context.Background())
+	if v != 1 || err != nil {
+		t.Fatalf("Get = %v, %v; want 1, nil", v, err)
+	}
+	if v, err, ok := f.Result(); v != 1 || err != nil || !ok {
+		t.Fatalf("Result = %v, %v, %v; want 1, nil, true", v, err, ok)
+	}
+}
+
+func TestRejected(t *testing.T) {
+	errBoom := errors.New("boom")
+	if _, err := future.Rejected(errBoom).Get(context.Background()); err != errBoom {
+		t.Fatalf("Get = %v; want %v", err, errBoom)
+	}
+	if v, _ := future.Resolved("x").Get(context.Background()); v != "x" {
+		t.Fatalf("Get = %v; want x", v)
+	}
+}
+
+func TestGetContext(t *testing.T) {
+	f := future.NewPromise().Future()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	if _, err := f.Get(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Get = %v; want %v", err, context.DeadlineExceeded)
+	}
+}
+
+// TestConcurrent completes one Future from many goroutines while others
+// wait on it: exactly one completion wins, and every reader sees it.
+func TestConcurrent(t *testing.T) {
+	const n = 8
+	p := future.NewPromise()
+	var wg sync.WaitGroup
+	wins := make(chan int, n)
+	got := make(chan interface{}, n)
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			if p.Resolve(i) {
+				wins <- i
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			v, _ := p.Future().Get(context.Background())
+			got <- v
+		}()
+	}
+	wg.Wait()
+	close(wins)
+	close(got)
+	if len(wins) != 1 {
+		t.Fatalf("%d completions won; want 1", len(wins))
+	}
+	w := <-wins
+	for v := range got {
+		if v != w {
+			t.Fatalf("reader got %v; want %v", v, w)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gmp_test
+
+import (
+	"elements/gmp"
+	"fmt"
+)
+
+// The main goroutine starts three goroutines on a single P. The last one
+// is in runnext and runs first.
+func ExampleSimulate() {
+	r := gmp.Simulate(gmp.Config{Procs: 1}, []gmp.Op{
+		gmp.Go(gmp.Run(2)),
+		gmp.Go(gmp.Run(2)),
+		gmp.Go(gmp.Run(2)),
+	})
+	fmt.Print(r.Timeline(0))
+	for _, e := range r.Events {
+		if e.Kind == gmp.EvSchedule {
+			fmt.Println(e)
+		}
+	}
+	// Output:
+	// tick 0
+	// P0   111442233
+	//     0 schedule    G1 M0 P0 (runnext)
+	//     3 schedule    G4 M0 P0 (runnext)
+	//     5 schedule    G2 M0 P0 (local queue)
+	//     7 schedule    G3 M0 P0 (local queue)
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package gmp is a simplified, deterministic model of the Go scheduler
+// (runtime/proc.go), for teaching.
+//
+// The model has the runtime's three kinds of object: goroutines (G),
+// machine threads (M) and processors (P). A G can only run on an M that
+// holds a P, and there are exactly Config.Procs Ps. Each P has a local run
+// queue of 256 Gs plus a runnext slot, and there is one global run queue.
+// An M that runs out of work looks, in order, at the global queue every 61st
+// schedule, its P's runnext and local queue, the global queue, and finally
+// steals half of another P's local queue. A sysmon pass each tick preempts
+// Gs that have run too long and retakes Ps from Ms blocked in system calls.
+//
+// Instead of running real code, each G executes a program of Ops, and time
+// advances in discrete ticks: in each tick every M holding a P runs its G for
+// one tick. The same Config and program always produce the same Result, so
+// that scenarios can be replayed and inspected event by event.
+package gmp
+
+// An OpKind is the kind of an Op.
+type OpKind int
+
+const (
+	// OpRun computes for N ticks without blocking.
+	OpRun OpKind = iota
+	// OpSyscall blocks in a system call for N ticks. The G keeps its M,
+	// and the M keeps its P until sysmon retakes it.
+	OpSyscall
+	// OpGo starts a new goroutine running Body, like a go statement.
+	OpGo
+	// OpYield calls runtime.Gosched: the G goes to the global run queue.
+	OpYield
+)
+
+// An Op is one step of a goroutine's program.
+type Op struct {
+	Kind OpKind
+	N    int  // ticks, for OpRun and OpSyscall
+	Body []Op // program of the new goroutine, for OpGo
+}
+
+// Run returns an Op that computes for n ticks.
+func Run(n int) Op { return Op{Kind: OpRun, N: n} }
+
+// Syscall returns an Op that blocks in a system call for n ticks.
+func Syscall(n int) Op { return Op{Kind: OpSyscall, N: n} }
+
+// Go returns an Op that starts a goroutine running body.
+func Go(body ...Op) Op { return Op{Kind: OpGo, Body: body} }
+
+// Yield returns an Op that calls runtime.Gosched.
+func Yield() Op { return Op{Kind: OpYield} }
+
+// Repeat returns body repeated n times.
+func Repeat(n int, body ...Op) []Op {
+	ops := make([]Op, 0, n*len(body))
+	for i := 0; i < n; i++ {
+		ops = append(ops, body...)
+	}
+	return ops
+}
+
+// Config configures a simulation.
+type Config struct {
+	// Procs is the number of Ps, like GOMAXPROCS. Zero means 1.
+	Procs int
+
+	// Preempt enables sysmon preemption of Gs that run longer than
+	// TimeSlice ticks, like the asynchronous preemption of Go 1.14.
+	// Without it a G only gives up its P when it blocks, yields or exits.
+	Preempt bool
+
+	// TimeSlice is how many ticks a G may run before sysmon preempts it,
+	// the model's forcePreemptNS (10ms in the runtime). Zero means 10.
+	TimeSlice int
+
+	// Seed seeds the random choices of the scheduler, such as the order
+	// in which Ps are tried when stealing.
+	Seed uint64
+
+	// MaxTicks bounds the simulation. Zero means 100000.
+	MaxTicks int
+}
+
+func (c *Config) procs() int {
+	if c.Procs <= 0 {
+		return 1
+	}
+	return c.Procs
+}
+
+func (c *Config) timeSlice() int {
+	if c.TimeSlice <= 0 {
+		return 10
+	}
+	return c.TimeSlice
+}
+
+func (c *Config) maxTicks() int {
+	if c.MaxTicks <= 0 {
+		return 100000
+	}
+	return c.MaxTicks
+}
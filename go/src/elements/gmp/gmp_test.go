@@ -0,0 +1,186 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gmp_test
+
+import (
+	"elements/gmp"
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+func scenario(t *testing.T, name string) *gmp.Result {
+	t.Helper()
+	sc, ok := gmp.Lookup(name)
+	if !ok {
+		t.Fatalf("no scenario %q", name)
+	}
+	r := sc.Run()
+	if !r.Finished {
+		t.Fatalf("%s: not finished after %d ticks", name, r.Ticks)
+	}
+	return r
+}
+
+func TestDeterministic(t *testing.T) {
+	for _, sc := range gmp.Scenarios() {
+		r1, r2 := sc.Run(), sc.Run()
+		if !reflect.DeepEqual(r1, r2) {
+			t.Errorf("%s: two runs differ", sc.Name)
+		}
+	}
+}
+
+func TestSteal(t *testing.T) {
+	r := scenario(t, "steal")
+	if r.Count(gmp.EvSteal) == 0 {
+		t.Fatal("no steals")
+	}
+	// 16个20 tick的任务在4个P上理想情况下需要80 tick
+	if r.Ticks > 100 {
+		t.Errorf("took %d ticks, want at most 100", r.Ticks)
+	}
+	if busy := r.Busy(); busy < 0.8 {
+		t.Errorf("Ps busy %.2f of the time, want at least 0.8", busy)
+	}
+}
+
+func TestRunnext(t *testing.T) {
+	r := scenario(t, "runnext")
+	// G4是最后创建的, 在runnext中; G2和G3按FIFO顺序在本地队列中
+	g2, g3, g4 := r.Goroutine(2), r.Goroutine(3), r.Goroutine(4)
+	if !(g4.FirstRun < g2.FirstRun && g2.FirstRun < g3.FirstRun) {
+		t.Errorf("first runs G2=%d G3=%d G4=%d, want G4 < G2 < G3",
+			g2.FirstRun, g3.FirstRun, g4.FirstRun)
+	}
+}
+
+func TestPreempt(t *testing.T) {
+	with, without := scenario(t, "preempt"), scenario(t, "no-preempt")
+	if with.Count(gmp.EvPreempt) == 0 {
+		t.Error("preempt: no preemptions")
+	}
+	if n := without.Count(gmp.EvPreempt); n != 0 {
+		t.Errorf("no-preempt: %d preemptions", n)
+	}
+	// G3是hog创建的短任务
+	if l := with.Goroutine(3).Latency(); l > 30 {
+		t.Errorf("preempt: short task waited %d ticks", l)
+	}
+	if l := without.Goroutine(3).Latency(); l < 100 {
+		t.Errorf("no-preempt: short task waited %d ticks, want at least 100", l)
+	}
+}
+
+func TestSyscallHandoff(t *testing.T) {
+	r := scenario(t, "syscall")
+	if n := r.Count(gmp.EvHandoff); n != 1 {
+		t.Errorf("%d handoffs, want 1", n)
+	}
+	if r.Threads <= r.Procs {
+		t.Errorf("%d threads for %d Ps, want more", r.Threads, r.Procs)
+	}
+	// G2在系统调用中阻塞了30 tick, 其余的G不应该等它
+	sys := r.Goroutine(2)
+	for id := 3; id <= 6; id++ {
+		if st := r.Goroutine(id); st.Finished >= sys.Finished {
+			t.Errorf("G%d finished at %d, after the syscall G at %d", id, st.Finished, sys.Finished)
+		}
+	}
+}
+
+func TestGlobalQueueFairness(t *testing.T) {
+	r := scenario(t, "global-queue")
+	if r.Count(gmp.EvYield) != 1 {
+		t.Fatalf("%d yields, want 1", r.Count(gmp.EvYield))
+	}
+	// 不检查全局队列的话, G2要等本地队列的100个G都运行完
+	if g2, mainDone := r.Goroutine(2), r.Goroutine(1).Finished; g2.Finished >= mainDone+100 {
+		t.Errorf("G2 finished at %d, want before %d", g2.Finished, mainDone+100)
+	}
+}
+
+func TestRunqOverflow(t *testing.T) {
+	r := gmp.Simulate(gmp.Config{Procs: 1}, gmp.Repeat(300, gmp.Go(gmp.Run(1))))
+	if !r.Finished {
+		t.Fatal("not finished")
+	}
+	if r.Count(gmp.EvOverflow) == 0 {
+		t.Error("local run queue of 256 never overflowed")
+	}
+	if len(r.Goroutines) != 301 {
+		t.Errorf("%d goroutines, want 301", len(r.Goroutines))
+	}
+}
+
+func TestMaxTicks(t *testing.T) {
+	r := gmp.Simulate(gmp.Config{MaxTicks: 50}, []gmp.Op{gmp.Run(1000)})
+	if r.Finished || r.Ticks != 50 {
+		t.Errorf("Finished=%v Ticks=%d, want false 50", r.Finished, r.Ticks)
+	}
+}
+
+// randomProg returns a random program and the number of ticks its
+// goroutines spend running and in system calls.
+func randomProg(rnd *rand.Rand, depth int) (prog []gmp.Op, run, sys int) {
+	for i := rnd.Intn(6) + 1; i > 0; i-- {
+		switch k := rnd.Intn(10); {
+		case k < 4:
+			n := rnd.Intn(20) + 1
+			prog = append(prog, gmp.Run(n))
+			run += n
+		case k < 6:
+			n := rnd.Intn(15) + 1
+			prog = append(prog, gmp.Syscall(n))
+			run++
+			sys += n
+		case k < 7:
+			prog = append(prog, gmp.Yield())
+			run++
+		default:
+			if depth > 3 {
+				continue
+			}
+			body, r, s := randomProg(rnd, depth+1)
+			prog = append(prog, gmp.Go(body...))
+			run += r + 1
+			sys += s
+		}
+	}
+	return prog, run, sys
+}
+
+func TestRandomPrograms(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		prog, run, sys := randomProg(rnd, 0)
+		cfg := gmp.Config{
+			Procs:   rnd.Intn(8) + 1,
+			Preempt: rnd.Intn(2) == 0,
+			Seed:    rnd.Uint64(),
+		}
+		r := gmp.Simulate(cfg, prog)
+		if !r.Finished {
+			t.Fatalf("%+v: not finished after %d ticks", cfg, r.Ticks)
+		}
+		gotRun, gotSys := 0, 0
+		for _, st := range r.Goroutines {
+			if st.Finished < st.FirstRun || st.FirstRun < st.Created {
+				t.Fatalf("%+v: G%d created %d, first ran %d, finished %d",
+					cfg, st.ID, st.Created, st.FirstRun, st.Finished)
+			}
+			gotRun += st.Ran
+			gotSys += st.Syscall
+		}
+		if gotRun != run || gotSys != sys {
+			t.Fatalf("%+v: ran %d ticks and %d in syscalls, want %d and %d",
+				cfg, gotRun, gotSys, run, sys)
+		}
+		// 同一时刻运行的G不超过P的数量, 所以总时间不少于工作量除以P的数量
+		if r.Ticks*r.Procs < run {
+			t.Fatalf("%+v: %d ticks on %d Ps for %d ticks of work", cfg, r.Ticks, r.Procs, run)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gmp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// An EventKind is the kind of an Event.
+type EventKind int
+
+const (
+	EvGo          EventKind = iota // a goroutine was created
+	EvSchedule                     // an M picked a G to run; Note says where from
+	EvSteal                        // an M stole Gs from another P and picked one
+	EvPreempt                      // sysmon preempted the G
+	EvYield                        // the G called Gosched
+	EvSyscall                      // the G entered a system call
+	EvExitSyscall                  // the G returned from a system call
+	EvHandoff                      // sysmon retook the P from an M in a system call
+	EvOverflow                     // a full local run queue spilled into the global queue
+	EvStartM                       // an M was woken or created to run a P
+	EvStopM                        // an M found no work and went idle
+	EvExit                         // the G finished
+)
+
+var eventNames = [...]string{
+	EvGo:          "go",
+	EvSchedule:    "schedule",
+	EvSteal:       "steal",
+	EvPreempt:     "preempt",
+	EvYield:       "yield",
+	EvSyscall:     "syscall",
+	EvExitSyscall: "exitsyscall",
+	EvHandoff:     "handoff",
+	EvOverflow:    "overflow",
+	EvStartM:      "startm",
+	EvStopM:       "stopm",
+	EvExit:        "exit",
+}
+
+func (k EventKind) String() string {
+	if k >= 0 && int(k) < len(eventNames) {
+		return eventNames[k]
+	}
+	return fmt.Sprintf("EventKind(%d)", int(k))
+}
+
+// An Event is something the scheduler did. G, M and P are -1 when they do
+// not apply.
+type Event struct {
+	Tick    int
+	Kind    EventKind
+	G, M, P int
+	Note    string
+}
+
+func (e Event) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%5d %-11s", e.Tick, e.Kind)
+	if e.G >= 0 {
+		fmt.Fprintf(&b, " G%d", e.G)
+	}
+	if e.M >= 0 {
+		fmt.Fprintf(&b, " M%d", e.M)
+	}
+	if e.P >= 0 {
+		fmt.Fprintf(&b, " P%d", e.P)
+	}
+	if e.Note != "" {
+		fmt.Fprintf(&b, " (%s)", e.Note)
+	}
+	return b.String()
+}
+
+// GoroutineStats describes the life of one goroutine. Ticks are -1 for
+// things that did not happen.
+type GoroutineStats struct {
+	ID       int
+	Parent   int // 0 for the main goroutine
+	Created  int // tick of the go statement
+	FirstRun int // tick it first ran
+	Finished int // tick it finished
+	Ran      int // ticks spent running
+	Syscall  int // ticks spent in system calls
+}
+
+// Latency returns how many ticks the goroutine waited before it first ran.
+func (st GoroutineStats) Latency() int {
+	if st.FirstRun < 0 {
+		return -1
+	}
+	return st.FirstRun - st.Created
+}
+
+// A Result is the outcome of a simulation.
+type Result struct {
+	Procs      int
+	Ticks      int  // ticks simulated
+	Finished   bool // whether every goroutine finished within MaxTicks
+	Threads    int  // Ms created, which may exceed Procs because of system calls
+	Events     []Event
+	Goroutines []GoroutineStats // indexed by ID-1
+
+	timeline [][]int // goid run by each P in each tick; 0 idle, -1 in syscall
+}
+
+func (r *Result) goroutine(id int) *GoroutineStats {
+	return &r.Goroutines[id-1]
+}
+
+// Goroutine returns the stats of the goroutine with the given ID.
+// The main goroutine has ID 1.
+func (r *Result) Goroutine(id int) GoroutineStats {
+	return r.Goroutines[id-1]
+}
+
+// Count returns the number of events of the given kind.
+func (r *Result) Count(kind EventKind) int {
+	n := 0
+	for _, e := range r.Events {
+		if e.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+// Busy returns the fraction of P-ticks spent running goroutines.
+func (r *Result) Busy() float64 {
+	if r.Ticks == 0 {
+		return 0
+	}
+	n := 0
+	for _, t := range r.timeline {
+		for _, id := range t {
+			if id > 0 {
+				n++
+			}
+		}
+	}
+	return float64(n) / float64(r.Ticks*r.Procs)
+}
+
+// Timeline draws what each P ran in each tick, one lane per P and one
+// column per tick, wrapped at width columns (0 means 80). Goroutines are
+// drawn as 1-9, a-z, A-Z and then '#'; '.' is an idle P and '~' a P whose
+// M is blocked in a system call.
+func (r *Result) Timeline(width int) string {
+	if width <= 0 {
+		width = 80
+	}
+	var b strings.Builder
+	for start := 0; start < len(r.timeline); start += width {
+		end := start + width
+		if end > len(r.timeline) {
+			end = len(r.timeline)
+		}
+		if start > 0 {
+			b.WriteByte('\n')
+		}
+		fmt.Fprintf(&b, "tick %d\n", start)
+		for id := 0; id < r.Procs; id++ {
+			fmt.Fprintf(&b, "P%-3d ", id)
+			for _, t := range r.timeline[start:end] {
+				b.WriteByte(glyph(t[id]))
+			}
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+const glyphs = "123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+func glyph(id int) byte {
+	switch {
+	case id < 0:
+		return '~'
+	case id == 0:
+		return '.'
+	case id <= len(glyphs):
+		return glyphs[id-1]
+	}
+	return '#'
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gmp
+
+// A Scenario is a program chosen to show one behavior of the scheduler.
+type Scenario struct {
+	Name   string
+	Doc    string
+	Config Config
+	Main   []Op
+}
+
+// Run simulates the scenario.
+func (sc Scenario) Run() *Result {
+	return Simulate(sc.Config, sc.Main)
+}
+
+// Scenarios returns the built-in scenarios.
+func Scenarios() []Scenario {
+	// hog先创建一个短任务, 然后长时间计算. 短任务在hog的runnext中,
+	// 只有hog让出P它才能运行
+	hog := []Op{Go(Run(5)), Run(100)}
+
+	return []Scenario{
+		{
+			Name: "steal",
+			Doc: "The main goroutine starts 16 workers on P0. Idle Ps are woken " +
+				"and steal half of P0's run queue, so the work spreads over all 4 Ps.",
+			Config: Config{Procs: 4},
+			Main:   Repeat(16, Go(Run(20))),
+		},
+		{
+			Name: "runnext",
+			Doc: "On one P, the main goroutine starts G2, G3 and G4 and exits. " +
+				"The last one started is in runnext and runs first; the others follow in FIFO order.",
+			Config: Config{Procs: 1},
+			Main:   []Op{Go(Run(3)), Go(Run(3)), Go(Run(3))},
+		},
+		{
+			Name: "preempt",
+			Doc: "On one P, a goroutine starts a short task and then computes for 100 ticks. " +
+				"sysmon preempts it after a time slice, so the short task runs early.",
+			Config: Config{Procs: 1, Preempt: true},
+			Main:   []Op{Go(hog...)},
+		},
+		{
+			Name: "no-preempt",
+			Doc: "The preempt scenario without preemption, as before Go 1.14: " +
+				"the short task waits until the long computation is done.",
+			Config: Config{Procs: 1},
+			Main:   []Op{Go(hog...)},
+		},
+		{
+			Name: "syscall",
+			Doc: "On two Ps, a goroutine blocks in a 30-tick system call while others wait. " +
+				"sysmon retakes its P and hands it to a new M, so the program uses 3 threads.",
+			Config: Config{Procs: 2},
+			Main: append([]Op{Go(Syscall(30), Run(5))},
+				Repeat(4, Go(Run(10)))...),
+		},
+		{
+			Name: "global-queue",
+			Doc: "On one P, G2 yields into the global queue while 100 goroutines wait in the local queue. " +
+				"Checking the global queue every 61st schedule lets G2 resume before they all finish.",
+			Config: Config{Procs: 1},
+			Main: append([]Op{Go(Yield(), Run(1))},
+				Repeat(100, Go(Run(1)))...),
+		},
+	}
+}
+
+// Lookup returns the built-in scenario with the given name.
+func Lookup(name string) (Scenario, bool) {
+	for _, sc := range Scenarios() {
+		if sc.Name == name {
+			return sc, true
+		}
+	}
+	return Scenario{}, false
+}
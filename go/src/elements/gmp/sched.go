@@ -0,0 +1,816 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package gmp
+
+import "strconv"
+
+// Goroutine states. The model has no _Gwaiting: a G only blocks in
+// system calls.
+type gStatus uint8
+
+const (
+	_Grunnable gStatus = iota + 1 // on a run queue, not executing
+	_Grunning                     // executing on an M that holds a P
+	_Gsyscall                     // in a system call, holding an M but maybe not a P
+	_Gdead                        // finished
+)
+
+// A g is a goroutine.
+type g struct {
+	goid    int
+	status  gStatus
+	prog    []Op
+	pc      int  // index of the current Op in prog
+	left    int  // ticks left in the current OpRun or OpSyscall, 0 if not started
+	m       *m   // current m, while running or in a system call
+	preempt bool // preemption requested by sysmon
+}
+
+// P states.
+type pStatus uint8
+
+const (
+	_Pidle    pStatus = iota // on the idle list, no M
+	_Prunning                // owned by an M that runs user code or the scheduler
+	_Psyscall                // its M is in a system call; sysmon may retake it
+)
+
+// A p is a processor: the resources needed to run Go code. An M must hold
+// a P to run a G.
+type p struct {
+	id     int
+	status pStatus
+	m      *m // back-link to associated m (nil if idle)
+
+	schedtick   uint32     // incremented on every scheduler call
+	syscalltick uint32     // incremented on every system call
+	sysmontick  sysmontick // last tick observed by sysmon
+
+	// Queue of runnable goroutines. Accessed without lock.
+	//
+	// runtime中本地队列是无锁的环形缓冲区: 只有所属的P在队尾写入,
+	// 所属的P和偷取者用CAS从队头取. 模型是单线程的, 不需要原子操作
+	runqhead uint32
+	runqtail uint32
+	runq     [256]*g
+
+	// runnext, if non-nil, is a runnable G that was ready'd by
+	// the current G and should be run next instead of what's in
+	// runq if there's time remaining in the running G's time
+	// slice. It will inherit the time left in the current time
+	// slice. If a set of goroutines is locked in a
+	// communicate-and-wait pattern, this schedules that set as a
+	// unit and eliminates the (potentially large) scheduling
+	// latency that otherwise arises from adding the ready'd
+	// goroutines to the end of the run queue.
+	runnext *g
+}
+
+type sysmontick struct {
+	schedtick   uint32
+	schedwhen   int
+	syscalltick uint32
+	syscallwhen int
+}
+
+// An m is a machine: an OS thread.
+type m struct {
+	id       int
+	p        *p // attached p for executing go code (nil if not executing go code)
+	oldp     *p // the p that was attached before executing a syscall
+	curg     *g // current running goroutine
+	spinning bool
+}
+
+// forcePreemptNS in the runtime is 10ms; the model measures it in ticks,
+// see Config.TimeSlice. sysmon retakes a P from a system call that has not
+// returned after syscallRetake ticks even if there is no other work, like
+// the 10ms bound in retake.
+const syscallRetake = 10
+
+// sched holds the global scheduler state, the runtime's schedt plus allp
+// and allm.
+type sched struct {
+	cfg  Config
+	now  int // current tick
+	allp []*p
+	allm []*m
+
+	midle []*m // idle m's waiting for work
+	pidle []*p // idle p's
+
+	runq []*g // global runnable queue
+
+	nmspinning int // number of spinning M's
+
+	allg []*g
+	live int // goroutines not yet finished
+
+	rng uint64
+
+	res *Result
+	ran []int // goid that ran on each P in the current tick
+}
+
+func newSched(cfg Config) *sched {
+	s := &sched{cfg: cfg, rng: cfg.Seed*2862933555777941757 + 3037000493}
+	n := cfg.procs()
+	s.res = &Result{Procs: n}
+	for i := 0; i < n; i++ {
+		s.allp = append(s.allp, &p{id: i})
+	}
+	s.ran = make([]int, n)
+	return s
+}
+
+// fastrand returns a pseudo-random number, deterministic for a Seed.
+func (s *sched) fastrand() uint32 {
+	s.rng ^= s.rng << 13
+	s.rng ^= s.rng >> 7
+	s.rng ^= s.rng << 17
+	return uint32(s.rng >> 32)
+}
+
+func (s *sched) event(kind EventKind, gp *g, mp *m, pp *p, note string) {
+	e := Event{Tick: s.now, Kind: kind, G: -1, M: -1, P: -1, Note: note}
+	if gp != nil {
+		e.G = gp.goid
+	}
+	if mp != nil {
+		e.M = mp.id
+	}
+	if pp != nil {
+		e.P = pp.id
+	}
+	s.res.Events = append(s.res.Events, e)
+}
+
+// Simulate runs main as the main goroutine under cfg until every
+// goroutine has finished or cfg.MaxTicks ticks have passed.
+func Simulate(cfg Config, main []Op) *Result {
+	s := newSched(cfg)
+
+	// m0 starts out holding P0; the other Ps are idle. The main goroutine
+	// is queued in P0's runnext, like newproc does for runtime.main.
+	m0 := s.newm()
+	s.acquirep(m0, s.allp[0])
+	for _, pp := range s.allp[1:] {
+		s.pidleput(pp)
+	}
+	s.newproc(s.allp[0], main, nil)
+
+	for max := cfg.maxTicks(); s.live > 0 && s.now < max; s.now++ {
+		s.retake()
+		for i := range s.ran {
+			s.ran[i] = 0
+		}
+		// Ms started during this tick first run in the next one.
+		for _, mp := range s.allm[:len(s.allm)] {
+			s.runm(mp)
+		}
+		for _, pp := range s.allp {
+			if pp.status == _Psyscall {
+				s.ran[pp.id] = -1
+			}
+		}
+		s.res.timeline = append(s.res.timeline, append([]int(nil), s.ran...))
+	}
+	s.res.Ticks = s.now
+	s.res.Finished = s.live == 0
+	s.res.Threads = len(s.allm)
+	return s.res
+}
+
+// runm runs mp for one tick.
+func (s *sched) runm(mp *m) {
+	if gp := mp.curg; gp != nil && gp.status == _Gsyscall {
+		// 系统调用期间M是阻塞的, 不管它还有没有P
+		s.res.goroutine(gp.goid).Syscall++
+		if gp.left--; gp.left <= 0 {
+			s.exitsyscall(mp)
+		}
+		return
+	}
+	if mp.p == nil {
+		return // idle
+	}
+	for {
+		if mp.curg == nil {
+			gp, inheritTime := s.schedule(mp)
+			if gp == nil {
+				s.stopm(mp)
+				return
+			}
+			s.execute(mp, gp, inheritTime)
+		}
+		gp := mp.curg
+		if gp.pc >= len(gp.prog) {
+			s.goexit(mp)
+			continue
+		}
+		if gp.preempt {
+			// 模型中抢占只在tick的边界生效, 相当于异步抢占信号
+			// 总是落在G执行的两条指令之间
+			gp.preempt = false
+			s.event(EvPreempt, gp, mp, mp.p, "")
+			s.goschedImpl(mp)
+			continue
+		}
+		s.step(mp)
+		return
+	}
+}
+
+// step runs the current G of mp for one tick.
+func (s *sched) step(mp *m) {
+	gp, pp := mp.curg, mp.p
+	s.ran[pp.id] = gp.goid
+	s.res.goroutine(gp.goid).Ran++
+	op := gp.prog[gp.pc]
+	switch op.Kind {
+	case OpRun:
+		if gp.left == 0 {
+			gp.left = op.N
+		}
+		if gp.left--; gp.left <= 0 {
+			gp.left = 0
+			gp.pc++
+		}
+	case OpGo:
+		gp.pc++
+		s.newproc(pp, op.Body, gp)
+	case OpYield:
+		gp.pc++
+		s.event(EvYield, gp, mp, pp, "")
+		s.goschedImpl(mp)
+		return
+	case OpSyscall:
+		s.entersyscall(mp, op.N)
+		return
+	}
+	if gp.pc >= len(gp.prog) {
+		s.goexit(mp)
+	}
+}
+
+func (s *sched) newm() *m {
+	mp := &m{id: len(s.allm)}
+	s.allm = append(s.allm, mp)
+	return mp
+}
+
+func (s *sched) newg(prog []Op, parent *g) *g {
+	gp := &g{goid: len(s.allg) + 1, status: _Grunnable, prog: prog}
+	s.allg = append(s.allg, gp)
+	s.live++
+	st := GoroutineStats{ID: gp.goid, Created: s.now, FirstRun: -1, Finished: -1}
+	if parent != nil {
+		st.Parent = parent.goid
+	}
+	s.res.Goroutines = append(s.res.Goroutines, st)
+	return gp
+}
+
+// newproc creates a G running prog and puts it in pp's runnext.
+func (s *sched) newproc(pp *p, prog []Op, parent *g) {
+	newg := s.newg(prog, parent)
+	var mp *m
+	if parent != nil {
+		mp = parent.m
+	}
+	s.event(EvGo, newg, mp, pp, parentNote(parent))
+	// 新的G放在runnext: 它很可能和创建它的G在通信, 让它紧接着运行
+	s.runqput(pp, newg, true)
+	if parent != nil {
+		// mainStarted
+		s.wakep()
+	}
+}
+
+func parentNote(parent *g) string {
+	if parent == nil {
+		return "main goroutine"
+	}
+	return "by G" + strconv.Itoa(parent.goid)
+}
+
+// execute schedules gp to run on mp.
+// If inheritTime is true, gp inherits the remaining time in the
+// current time slice. Otherwise, it starts a new time slice.
+func (s *sched) execute(mp *m, gp *g, inheritTime bool) {
+	pp := mp.p
+	mp.curg = gp
+	gp.m = mp
+	gp.status = _Grunning
+	gp.preempt = false
+	if !inheritTime {
+		// schedtick决定sysmon何时抢占: 继承时间片的G(来自runnext)不增加它,
+		// 所以一组互相唤醒的G整体共享一个时间片, 不会因为互相切换而逃过抢占
+		pp.schedtick++
+	}
+	st := s.res.goroutine(gp.goid)
+	if st.FirstRun < 0 {
+		st.FirstRun = s.now
+	}
+}
+
+// goexit finishes the current G of mp.
+func (s *sched) goexit(mp *m) {
+	gp := mp.curg
+	gp.status = _Gdead
+	gp.m = nil
+	mp.curg = nil
+	s.live--
+	s.res.goroutine(gp.goid).Finished = s.now
+	s.event(EvExit, gp, mp, mp.p, "")
+}
+
+// goschedImpl puts the current G of mp on the global run queue, as
+// runtime.Gosched and preemption do.
+func (s *sched) goschedImpl(mp *m) {
+	gp := mp.curg
+	gp.status = _Grunnable
+	gp.m = nil
+	mp.curg = nil
+	s.globrunqput(gp)
+}
+
+// One round of scheduler: find a runnable goroutine and return it.
+// Never returns nil unless there is no work anywhere, in which case
+// the caller stops the M.
+func (s *sched) schedule(mp *m) (gp *g, inheritTime bool) {
+	pp := mp.p
+	// Check the global runnable queue once in a while to ensure fairness.
+	// Otherwise two goroutines can completely occupy the local runqueue
+	// by constantly respawning each other.
+	//
+	// 每调度61次检查一次全局队列. 61是一个不太大的质数, 避免和程序中的周期性规律重合
+	if pp.schedtick%61 == 0 && len(s.runq) > 0 {
+		gp = s.globrunqget(pp, 1)
+		if gp != nil {
+			s.event(EvSchedule, gp, mp, pp, "global queue (schedtick%61)")
+			return gp, false
+		}
+	}
+	if gp, inheritTime = runqget(pp); gp != nil {
+		s.event(EvSchedule, gp, mp, pp, sourceNote(inheritTime))
+		return gp, inheritTime
+	}
+	gp, inheritTime = s.findrunnable(mp)
+	// This thread is going to run a goroutine and is not spinning anymore,
+	// so if it was marked as spinning we need to reset it now and potentially
+	// start a new spinning M.
+	if gp != nil && mp.spinning {
+		s.resetspinning(mp)
+	}
+	return gp, inheritTime
+}
+
+func sourceNote(inheritTime bool) string {
+	if inheritTime {
+		return "runnext"
+	}
+	return "local queue"
+}
+
+// Finds a runnable goroutine to execute.
+// Tries to steal from other P's and get g from global queue.
+func (s *sched) findrunnable(mp *m) (gp *g, inheritTime bool) {
+	pp := mp.p
+
+	// local runq
+	if gp, inheritTime := runqget(pp); gp != nil {
+		s.event(EvSchedule, gp, mp, pp, sourceNote(inheritTime))
+		return gp, inheritTime
+	}
+
+	// global runq
+	if len(s.runq) > 0 {
+		if gp := s.globrunqget(pp, 0); gp != nil {
+			s.event(EvSchedule, gp, mp, pp, "global queue")
+			return gp, false
+		}
+	}
+
+	// Steal work from other P's.
+	//
+	// If number of spinning M's >= number of busy P's, block.
+	// This is necessary to prevent excessive CPU consumption
+	// when GOMAXPROCS>>1 but the program parallelism is low.
+	//
+	// 自旋(正在找活干)的M不超过忙碌的P的一半, 否则大量空闲的M会把CPU耗在互相偷取上
+	procs := len(s.allp)
+	if !mp.spinning && 2*s.nmspinning >= procs-len(s.pidle) {
+		return nil, false
+	}
+	if !mp.spinning {
+		mp.spinning = true
+		s.nmspinning++
+	}
+	for i := 0; i < 4; i++ {
+		// 从一个随机的P开始, 按一个和P的数量互质的步长遍历, 每个P恰好访问一次,
+		// 而且不同的M从不同的位置开始, 不会一起挤在同一个受害者上
+		start := int(s.fastrand()) % procs
+		inc := stealInc(procs, s.fastrand())
+		for j, pos := 0, start; j < procs; j, pos = j+1, (pos+inc)%procs {
+			p2 := s.allp[pos]
+			if pp == p2 {
+				continue
+			}
+			// Steal runnext only on the last attempt: the P that owns
+			// it is probably about to schedule it.
+			stealRunNextG := i > 2
+			if gp, n := s.runqsteal(pp, p2, stealRunNextG); gp != nil {
+				s.event(EvSteal, gp, mp, pp, "stole "+strconv.Itoa(n)+" from P"+strconv.Itoa(p2.id))
+				return gp, false
+			}
+		}
+	}
+	return nil, false
+}
+
+// stealInc returns a step coprime with n, like randomOrder in the runtime.
+func stealInc(n int, r uint32) int {
+	var coprimes []int
+	for i := 1; i <= n; i++ {
+		if gcd(i, n) == 1 {
+			coprimes = append(coprimes, i)
+		}
+	}
+	return coprimes[int(r)%len(coprimes)]
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+func (s *sched) resetspinning(mp *m) {
+	mp.spinning = false
+	s.nmspinning--
+	// M wakeup policy is deliberately somewhat conservative, so check if we
+	// need to wakeup another P here. See "Worker thread parking/unparking"
+	// comment at the top of runtime/proc.go for details.
+	//
+	// 找到活的自旋M不再自旋, 可能还有别的活, 再唤醒一个M接替它自旋
+	s.wakep()
+}
+
+// Tries to add one more P to execute G's.
+// Called when a G is made runnable (newproc, ready).
+func (s *sched) wakep() {
+	// be conservative about spinning threads
+	if len(s.pidle) == 0 || s.nmspinning != 0 {
+		return
+	}
+	s.startm(nil, true)
+}
+
+// Schedules some M to run the p (creates an M if necessary).
+// If p==nil, tries to get an idle P, if no idle P's does nothing.
+func (s *sched) startm(pp *p, spinning bool) {
+	if pp == nil {
+		if pp = s.pidleget(); pp == nil {
+			return
+		}
+	}
+	var mp *m
+	if n := len(s.midle); n > 0 {
+		mp = s.midle[n-1]
+		s.midle = s.midle[:n-1]
+	} else {
+		mp = s.newm()
+	}
+	s.acquirep(mp, pp)
+	if spinning {
+		mp.spinning = true
+		s.nmspinning++
+	}
+	note := ""
+	if spinning {
+		note = "spinning"
+	}
+	s.event(EvStartM, nil, mp, pp, note)
+}
+
+// stopm releases the P of mp and puts mp on the idle list.
+func (s *sched) stopm(mp *m) {
+	pp := mp.p
+	if mp.spinning {
+		mp.spinning = false
+		s.nmspinning--
+	}
+	s.releasep(mp)
+	s.pidleput(pp)
+	s.midle = append(s.midle, mp)
+	s.event(EvStopM, nil, mp, pp, "")
+}
+
+func (s *sched) acquirep(mp *m, pp *p) {
+	mp.p = pp
+	pp.m = mp
+	pp.status = _Prunning
+}
+
+func (s *sched) releasep(mp *m) {
+	pp := mp.p
+	pp.m = nil
+	pp.status = _Pidle
+	mp.p = nil
+}
+
+func (s *sched) pidleput(pp *p) {
+	pp.status = _Pidle
+	s.pidle = append(s.pidle, pp)
+}
+
+func (s *sched) pidleget() *p {
+	n := len(s.pidle)
+	if n == 0 {
+		return nil
+	}
+	pp := s.pidle[n-1]
+	s.pidle = s.pidle[:n-1]
+	return pp
+}
+
+// pidleremove takes pp off the idle list, if it is there.
+func (s *sched) pidleremove(pp *p) bool {
+	for i, p2 := range s.pidle {
+		if p2 == pp {
+			s.pidle = append(s.pidle[:i], s.pidle[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// entersyscall puts the current G of mp in a system call for n ticks.
+// The M keeps its P, which moves to _Psyscall so that sysmon can retake it.
+func (s *sched) entersyscall(mp *m, n int) {
+	gp, pp := mp.curg, mp.p
+	gp.status = _Gsyscall
+	gp.left = n
+	if gp.left <= 0 {
+		gp.left = 1
+	}
+	pp.status = _Psyscall
+	pp.syscalltick++
+	mp.oldp = pp
+	s.event(EvSyscall, gp, mp, pp, "")
+}
+
+// exitsyscall returns the current G of mp from its system call.
+func (s *sched) exitsyscall(mp *m) {
+	gp := mp.curg
+	gp.pc++
+	gp.left = 0
+
+	// Fast path: the P was not retaken.
+	//
+	// 系统调用很短, sysmon还没来得及拿走P: 直接继续运行, 代价只是两次原子操作
+	if pp := mp.p; pp != nil && pp.status == _Psyscall {
+		pp.status = _Prunning
+		pp.syscalltick++
+		gp.status = _Grunning
+		mp.oldp = nil
+		s.event(EvExitSyscall, gp, mp, pp, "kept P")
+		return
+	}
+
+	// exitsyscallfast: try to re-acquire the last P, or any idle P.
+	//
+	// P已经被sysmon拿走交给了别的M. 先看原来的P是否空闲, 再看有没有别的空闲P
+	oldp := mp.oldp
+	mp.oldp = nil
+	var pp *p
+	if oldp != nil && oldp.status == _Pidle && s.pidleremove(oldp) {
+		pp = oldp
+	} else {
+		pp = s.pidleget()
+	}
+	if pp != nil {
+		s.acquirep(mp, pp)
+		gp.status = _Grunning
+		s.event(EvExitSyscall, gp, mp, pp, "acquired idle P")
+		return
+	}
+
+	// exitsyscall0: no P available, put gp on the global queue and stop mp.
+	//
+	// 没有空闲的P: G进入全局队列, M休眠
+	gp.status = _Grunnable
+	gp.m = nil
+	mp.curg = nil
+	s.globrunqput(gp)
+	s.midle = append(s.midle, mp)
+	s.event(EvExitSyscall, gp, mp, nil, "no P, G to global queue")
+}
+
+// retake is the part of sysmon that preempts long-running Gs and retakes
+// Ps blocked in system calls. The runtime's sysmon runs every 20us to
+// 10ms; the model runs it at the start of every tick.
+func (s *sched) retake() {
+	now := s.now
+	timeSlice := s.cfg.timeSlice()
+	for _, pp := range s.allp {
+		pd := &pp.sysmontick
+		st := pp.status
+		sysretake := false
+		if st == _Prunning || st == _Psyscall {
+			// Preempt G if it's running for too long.
+			//
+			// sysmon只看schedtick有没有变化: 两次观察之间schedtick没变,
+			// 说明P一直在运行同一个G(或者同一组继承时间片的G)
+			t := pp.schedtick
+			if pd.schedtick != t {
+				pd.schedtick = t
+				pd.schedwhen = now
+			} else if pd.schedwhen+timeSlice <= now {
+				s.preemptone(pp)
+				// In case of syscall, preemptone() doesn't
+				// work, because there is no M wired to P.
+				sysretake = true
+			}
+		}
+		if st == _Psyscall {
+			// Retake P from syscall if it's there for more than 1 sysmon tick (at least 20us).
+			t := pp.syscalltick
+			if !sysretake && pd.syscalltick != t {
+				pd.syscalltick = t
+				pd.syscallwhen = now
+				continue
+			}
+			// On the one hand we don't want to retake Ps if there is no other work to do,
+			// but on the other hand we want to retake them eventually
+			// because they can prevent the sysmon thread from deep sleep.
+			//
+			// 没有别的活(本地队列为空, 并且已经有自旋的M或者空闲的P)时不急着拿走P,
+			// 除非系统调用已经持续了很久
+			if runqempty(pp) && s.nmspinning+len(s.pidle) > 0 && pd.syscallwhen+syscallRetake > now {
+				continue
+			}
+			mp := pp.m
+			pp.status = _Pidle
+			pp.syscalltick++
+			mp.p = nil
+			pp.m = nil
+			s.event(EvHandoff, mp.curg, mp, pp, "")
+			s.handoffp(pp)
+		}
+	}
+}
+
+// preemptone asks the G running on pp to stop.
+func (s *sched) preemptone(pp *p) {
+	if !s.cfg.Preempt {
+		return
+	}
+	mp := pp.m
+	if mp == nil || mp.curg == nil || mp.curg.status != _Grunning {
+		return
+	}
+	mp.curg.preempt = true
+}
+
+// Hands off P from syscall or locked M.
+func (s *sched) handoffp(pp *p) {
+	// if it has local work, start it straight away
+	//
+	// 有活就找一个M(没有空闲的M就新建一个)来运行这个P. 这就是阻塞的系统调用
+	// 会让程序的线程数超过GOMAXPROCS的原因
+	if !runqempty(pp) || len(s.runq) > 0 {
+		s.startm(pp, false)
+		return
+	}
+	// no local work, check that there are no spinning/idle M's,
+	// otherwise our help is not required
+	if s.nmspinning+len(s.pidle) == 0 {
+		s.startm(pp, true)
+		return
+	}
+	s.pidleput(pp)
+}
+
+// Put gp on the global runnable queue.
+func (s *sched) globrunqput(gp *g) {
+	s.runq = append(s.runq, gp)
+}
+
+// Try get a batch of G's from the global runnable queue.
+func (s *sched) globrunqget(pp *p, max int) *g {
+	if len(s.runq) == 0 {
+		return nil
+	}
+
+	// 按P的数量平分全局队列, 一次多拿一些放到本地队列, 减少访问全局队列的次数
+	// (runtime中全局队列要加sched.lock)
+	n := len(s.runq)/len(s.allp) + 1
+	if n > len(s.runq) {
+		n = len(s.runq)
+	}
+	if max > 0 && n > max {
+		n = max
+	}
+	if n > len(pp.runq)/2 {
+		n = len(pp.runq) / 2
+	}
+
+	gp := s.runq[0]
+	for _, g1 := range s.runq[1:n] {
+		s.runqput(pp, g1, false)
+	}
+	s.runq = s.runq[n:]
+	return gp
+}
+
+// runqempty reports whether pp has no Gs on its local run queue.
+func runqempty(pp *p) bool {
+	return pp.runqhead == pp.runqtail && pp.runnext == nil
+}
+
+// runqput tries to put g on the local runnable queue.
+// If next is false, runqput adds g to the tail of the runnable queue.
+// If next is true, runqput puts g in the pp.runnext slot.
+// If the run queue is full, runnext puts g on the global queue.
+func (s *sched) runqput(pp *p, gp *g, next bool) {
+	if next {
+		// 被挤出runnext的G排到本地队列的队尾
+		old := pp.runnext
+		pp.runnext = gp
+		if old == nil {
+			return
+		}
+		// Kick the old runnext out to the regular run queue.
+		gp = old
+	}
+
+	if pp.runqtail-pp.runqhead < uint32(len(pp.runq)) {
+		pp.runq[pp.runqtail%uint32(len(pp.runq))] = gp
+		pp.runqtail++
+		return
+	}
+
+	// Put g and a batch of work from local runnable queue on global queue.
+	//
+	// 本地队列满了: 把前一半和gp一起移到全局队列, 让别的P可以拿到
+	n := pp.runqtail - pp.runqhead
+	n = n / 2
+	for i := uint32(0); i < n; i++ {
+		s.runq = append(s.runq, pp.runq[(pp.runqhead+i)%uint32(len(pp.runq))])
+	}
+	pp.runqhead += n
+	s.runq = append(s.runq, gp)
+	s.event(EvOverflow, nil, pp.m, pp, strconv.Itoa(int(n)+1)+" to global queue")
+}
+
+// Get g from local runnable queue.
+// If inheritTime is true, gp should inherit the remaining time in the
+// current time slice. Otherwise, it should start a new time slice.
+func runqget(pp *p) (gp *g, inheritTime bool) {
+	// If there's a runnext, it's the next G to run.
+	if next := pp.runnext; next != nil {
+		pp.runnext = nil
+		return next, true
+	}
+	if pp.runqhead == pp.runqtail {
+		return nil, false
+	}
+	gp = pp.runq[pp.runqhead%uint32(len(pp.runq))]
+	pp.runqhead++
+	return gp, false
+}
+
+// Steal half of elements from local runnable queue of p2
+// and put onto local runnable queue of p.
+// Returns one of the stolen elements (or nil if failed) and how many
+// goroutines were stolen.
+func (s *sched) runqsteal(pp, p2 *p, stealRunNextG bool) (*g, int) {
+	n := p2.runqtail - p2.runqhead
+	n = n - n/2
+	if n == 0 {
+		if stealRunNextG {
+			// Try to steal from p2.runnext.
+			if next := p2.runnext; next != nil {
+				p2.runnext = nil
+				return next, 1
+			}
+		}
+		return nil, 0
+	}
+	// 偷一半(向上取整): 偷得太少很快又要再偷, 偷得太多受害者马上也要去偷
+	for i := uint32(0); i < n; i++ {
+		gp := p2.runq[(p2.runqhead+i)%uint32(len(p2.runq))]
+		pp.runq[(pp.runqtail+i)%uint32(len(pp.runq))] = gp
+	}
+	p2.runqhead += n
+	// 偷来的最后一个直接运行, 其余的放进自己的本地队列
+	n--
+	gp := pp.runq[(pp.runqtail+n)%uint32(len(pp.runq))]
+	pp.runqtail += n
+	return gp, int(n) + 1
+}
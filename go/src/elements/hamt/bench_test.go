@@ -0,0 +1,67 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hamt_test
+
+import (
+	"elements/hamt"
+	"sync"
+	"testing"
+)
+
+const benchKeys = 1 << 12
+
+func BenchmarkLoad(b *testing.B) {
+	b.Run("hamt", func(b *testing.B) {
+		var c hamt.Current
+		m := c.Load()
+		for k := 0; k < benchKeys; k++ {
+			m = m.Store(k, k)
+		}
+		c.Store(m)
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			c.Load().Load(i & (benchKeys - 1))
+		}
+	})
+	b.Run("sync.Map", func(b *testing.B) {
+		var m sync.Map
+		for k := 0; k < benchKeys; k++ {
+			m.Store(k, k)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			m.Load(i & (benchKeys - 1))
+		}
+	})
+}
+
+// BenchmarkStore replaces existing keys, so every op copies a path.
+func BenchmarkStore(b *testing.B) {
+	b.Run("hamt", func(b *testing.B) {
+		var c hamt.Current
+		m := c.Load()
+		for k := 0; k < benchKeys; k++ {
+			m = m.Store(k, k)
+		}
+		c.Store(m)
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			k := i & (benchKeys - 1)
+			c.Update(func(m *hamt.Map) *hamt.Map { return m.Store(k, i) })
+		}
+	})
+	b.Run("sync.Map", func(b *testing.B) {
+		var m sync.Map
+		for k := 0; k < benchKeys; k++ {
+			m.Store(k, k)
+		}
+		b.ReportAllocs()
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			m.Store(i&(benchKeys-1), i)
+		}
+	})
+}
@@ -0,0 +1,32 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hamt_test
+
+import (
+	"elements/hamt"
+	"fmt"
+)
+
+func Example() {
+	v1 := hamt.New(nil).Store("a", 1).Store("b", 2)
+	v2 := v1.Store("a", 10).Delete("b")
+
+	// v1没有被修改, 它和v2共享没有变化的部分
+	a1, _ := v1.Load("a")
+	a2, _ := v2.Load("a")
+	fmt.Println(a1, v1.Len(), a2, v2.Len())
+	// Output: 1 2 10 1
+}
+
+func ExampleCurrent() {
+	var users hamt.Current
+	users.Update(func(m *hamt.Map) *hamt.Map { return m.Store("alice", "admin") })
+
+	snap := users.Load() // 之后的修改不影响这个版本
+	users.Update(func(m *hamt.Map) *hamt.Map { return m.Store("bob", "viewer") })
+
+	fmt.Println(snap.Len(), users.Load().Len())
+	// Output: 1 2
+}
@@ -0,0 +1,24 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hamt
+
+// Nodes returns the number of nodes in m's trie, not counting leaves and
+// collisions.
+func Nodes(m *Map) int {
+	if m == nil || m.root == nil {
+		return 0
+	}
+	return m.root.count()
+}
+
+func (n *node) count() int {
+	c := 1
+	for _, kid := range n.kids {
+		if k, ok := kid.(*node); ok {
+			c += k.count()
+		}
+	}
+	return c
+}
@@ -0,0 +1,384 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package hamt implements a persistent map as a hash array mapped trie
+// (Bagwell, 2000).
+//
+// A Map never changes: Store and Delete return a new Map, which shares
+// all of the old one except the path from the root to the changed key,
+// O(log32 n) nodes. Any number of goroutines can read any version without
+// locking, and keeping an old version around as a snapshot costs only the
+// nodes that have changed since.
+package hamt
+
+import (
+	"math/bits"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+const (
+	bitsPerLevel = 5
+	fanout       = 1 << bitsPerLevel
+	levelMask    = fanout - 1
+)
+
+// A Map is an immutable map from keys to values. The nil *Map is an empty
+// map hashing keys with a random sync.MaphashHasher.
+type Map struct {
+	root   *node
+	len    int
+	hasher sync.Hasher
+}
+
+// A node holds up to 32 children, one for each 5-bit chunk of the hash at
+// its depth. Only the children present are stored: bitmap has a bit set
+// for each, and a child's index in kids is the number of bits set below
+// its own.
+//
+// 32个孩子的数组大多是空的, 位图加上紧凑的切片让每个节点只占实际孩子的空间
+type node struct {
+	bitmap uint32
+	kids   []interface{} // *leaf, *node or *collision
+}
+
+type leaf struct {
+	hash       uint64
+	key, value interface{}
+}
+
+// A collision holds the keys whose hashes are equal in all 64 bits.
+type collision struct {
+	hash   uint64
+	leaves []*leaf
+}
+
+var defaultHasher sync.Hasher = sync.NewMaphashHasher()
+
+// New returns an empty Map hashing keys with h, or with a random
+// sync.MaphashHasher if h is nil. The maps derived from it by Store and
+// Delete use the same Hasher.
+func New(h sync.Hasher) *Map {
+	if h == nil {
+		h = defaultHasher
+	}
+	return &Map{hasher: h}
+}
+
+func (m *Map) hash(key interface{}) uint64 {
+	if m == nil || m.hasher == nil {
+		return defaultHasher.Hash(key)
+	}
+	return m.hasher.Hash(key)
+}
+
+// Len returns the number of keys in m.
+func (m *Map) Len() int {
+	if m == nil {
+		return 0
+	}
+	return m.len
+}
+
+// Load returns the value stored in m for key.
+func (m *Map) Load(key interface{}) (value interface{}, ok bool) {
+	if m == nil || m.root == nil {
+		return nil, false
+	}
+	hash := m.hash(key)
+	n := m.root
+	for shift := uint(0); ; shift += bitsPerLevel {
+		bit := uint32(1) << (hash >> shift & levelMask)
+		if n.bitmap&bit == 0 {
+			return nil, false
+		}
+		switch k := n.kids[n.index(bit)].(type) {
+		case *leaf:
+			if k.key == key {
+				return k.value, true
+			}
+			return nil, false
+		case *collision:
+			if k.hash == hash {
+				for _, l := range k.leaves {
+					if l.key == key {
+						return l.value, true
+					}
+				}
+			}
+			return nil, false
+		case *node:
+			n = k
+		}
+	}
+}
+
+// Store returns a Map with value stored for key, and the rest as in m.
+func (m *Map) Store(key, value interface{}) *Map {
+	hash := m.hash(key)
+	l := &leaf{hash: hash, key: key, value: value}
+	root := m.rootOrEmpty()
+	newRoot, added := root.with(0, l)
+	n := m.derive(newRoot)
+	if added {
+		n.len++
+	}
+	return n
+}
+
+// Delete returns a Map without key, and the rest as in m. If m has no key,
+// Delete returns m itself.
+func (m *Map) Delete(key interface{}) *Map {
+	if m == nil || m.root == nil {
+		return m
+	}
+	kid, removed := m.root.without(0, m.hash(key), key)
+	if !removed {
+		return m
+	}
+	var root *node
+	switch k := kid.(type) {
+	case *node:
+		root = k
+	case *leaf:
+		// 根只剩下一个叶子或者冲突节点, 它们不能单独做根, 放回一个节点中
+		root = single(0, k.hash, k)
+	case *collision:
+		root = single(0, k.hash, k)
+	}
+	n := m.derive(root)
+	n.len--
+	return n
+}
+
+// Range calls f for each key and value in m, in an order fixed by the
+// hashes, until f returns false.
+func (m *Map) Range(f func(key, value interface{}) bool) {
+	if m == nil || m.root == nil {
+		return
+	}
+	m.root.rangeKids(f)
+}
+
+func (m *Map) rootOrEmpty() *node {
+	if m == nil || m.root == nil {
+		return &node{}
+	}
+	return m.root
+}
+
+func (m *Map) derive(root *node) *Map {
+	n := &Map{root: root}
+	if m != nil {
+		n.len, n.hasher = m.len, m.hasher
+	}
+	return n
+}
+
+func (n *node) index(bit uint32) int {
+	return bits.OnesCount32(n.bitmap & (bit - 1))
+}
+
+// with returns a copy of n with l stored, and whether l's key is new.
+func (n *node) with(shift uint, l *leaf) (*node, bool) {
+	bit := uint32(1) << (l.hash >> shift & levelMask)
+	i := n.index(bit)
+	if n.bitmap&bit == 0 {
+		kids := make([]interface{}, len(n.kids)+1)
+		copy(kids, n.kids[:i])
+		kids[i] = l
+		copy(kids[i+1:], n.kids[i:])
+		return &node{bitmap: n.bitmap | bit, kids: kids}, true
+	}
+	var kid interface{}
+	added := true
+	switch k := n.kids[i].(type) {
+	case *leaf:
+		switch {
+		case k.key == l.key:
+			kid, added = l, false
+		case k.hash == l.hash:
+			kid = &collision{hash: l.hash, leaves: []*leaf{k, l}}
+		default:
+			kid = merge(shift+bitsPerLevel, k.hash, k, l)
+		}
+	case *collision:
+		if k.hash != l.hash {
+			kid = merge(shift+bitsPerLevel, k.hash, k, l)
+			break
+		}
+		leaves := make([]*leaf, len(k.leaves), len(k.leaves)+1)
+		copy(leaves, k.leaves)
+		for j, old := range leaves {
+			if old.key == l.key {
+				leaves[j], added = l, false
+				break
+			}
+		}
+		if added {
+			leaves = append(leaves, l)
+		}
+		kid = &collision{hash: k.hash, leaves: leaves}
+	case *node:
+		kid, added = k.with(shift+bitsPerLevel, l)
+	}
+	return n.replaced(i, kid), added
+}
+
+// merge returns a node at shift holding old, whose hash is oldHash, and
+// l, whose hash differs from it.
+func merge(shift uint, oldHash uint64, old interface{}, l *leaf) *node {
+	a, b := oldHash>>shift&levelMask, l.hash>>shift&levelMask
+	if a == b {
+		// 这一层的5位还相同, 再往下一层. 哈希不同, 最多到第13层总会分开
+		return &node{bitmap: 1 << a, kids: []interface{}{merge(shift+bitsPerLevel, oldHash, old, l)}}
+	}
+	n := &node{bitmap: 1<<a | 1<<b}
+	if a < b {
+		n.kids = []interface{}{old, l}
+	} else {
+		n.kids = []interface{}{l, old}
+	}
+	return n
+}
+
+// single returns a node at shift holding only kid, whose hash is hash.
+func single(shift uint, hash uint64, kid interface{}) *node {
+	return &node{bitmap: 1 << (hash >> shift & levelMask), kids: []interface{}{kid}}
+}
+
+// without returns what should replace n in its parent once key is
+// removed: a node, a single leaf or collision to be pulled up into the
+// parent, or nil if nothing is left. It reports whether key was present.
+func (n *node) without(shift uint, hash uint64, key interface{}) (interface{}, bool) {
+	bit := uint32(1) << (hash >> shift & levelMask)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+	i := n.index(bit)
+	var kid interface{}
+	switch k := n.kids[i].(type) {
+	case *leaf:
+		if k.key != key {
+			return n, false
+		}
+	case *collision:
+		if k.hash != hash {
+			return n, false
+		}
+		j := -1
+		for x, l := range k.leaves {
+			if l.key == key {
+				j = x
+				break
+			}
+		}
+		if j < 0 {
+			return n, false
+		}
+		if len(k.leaves) == 2 {
+			kid = k.leaves[1-j]
+		} else {
+			leaves := make([]*leaf, 0, len(k.leaves)-1)
+			leaves = append(leaves, k.leaves[:j]...)
+			leaves = append(leaves, k.leaves[j+1:]...)
+			kid = &collision{hash: k.hash, leaves: leaves}
+		}
+	case *node:
+		r, removed := k.without(shift+bitsPerLevel, hash, key)
+		if !removed {
+			return n, false
+		}
+		kid = r
+	}
+
+	var nn *node
+	if kid == nil {
+		if len(n.kids) == 1 {
+			return nil, true
+		}
+		kids := make([]interface{}, len(n.kids)-1)
+		copy(kids, n.kids[:i])
+		copy(kids[i:], n.kids[i+1:])
+		nn = &node{bitmap: n.bitmap &^ bit, kids: kids}
+	} else {
+		nn = n.replaced(i, kid)
+	}
+	// 只剩一个叶子的节点没有存在的必要, 把叶子交给上一层, 保持树尽量浅.
+	// 这样Delete之后的树和只Store剩下的key得到的树形状相同
+	if len(nn.kids) == 1 {
+		if _, ok := nn.kids[0].(*node); !ok {
+			return nn.kids[0], true
+		}
+	}
+	return nn, true
+}
+
+// replaced returns a copy of n with kids[i] replaced by kid.
+func (n *node) replaced(i int, kid interface{}) *node {
+	kids := make([]interface{}, len(n.kids))
+	copy(kids, n.kids)
+	kids[i] = kid
+	return &node{bitmap: n.bitmap, kids: kids}
+}
+
+func (n *node) rangeKids(f func(key, value interface{}) bool) bool {
+	for _, kid := range n.kids {
+		switch k := kid.(type) {
+		case *leaf:
+			if !f(k.key, k.value) {
+				return false
+			}
+		case *collision:
+			for _, l := range k.leaves {
+				if !f(l.key, l.value) {
+					return false
+				}
+			}
+		case *node:
+			if !k.rangeKids(f) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Current holds the current version of a Map, for goroutines that share
+// one evolving map. Readers Load it and use that version for as long as
+// they like; writers derive a new version and publish it.
+//
+// The zero value holds an empty Map.
+type Current struct {
+	p unsafe.Pointer // *Map
+}
+
+// Load returns the current version.
+func (c *Current) Load() *Map {
+	return (*Map)(atomic.LoadPointer(&c.p))
+}
+
+// Store makes m the current version.
+func (c *Current) Store(m *Map) {
+	atomic.StorePointer(&c.p, unsafe.Pointer(m))
+}
+
+// CompareAndSwap makes new the current version if old is.
+func (c *Current) CompareAndSwap(old, new *Map) bool {
+	return atomic.CompareAndSwapPointer(&c.p, unsafe.Pointer(old), unsafe.Pointer(new))
+}
+
+// Update publishes f(current) as the current version, calling f again
+// if another writer published a version meanwhile, and returns the
+// version published. f must not have side effects.
+func (c *Current) Update(f func(m *Map) *Map) *Map {
+	for {
+		old := c.Load()
+		new := f(old)
+		if c.CompareAndSwap(old, new) {
+			return new
+		}
+	}
+}
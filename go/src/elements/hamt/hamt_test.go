@@ -0,0 +1,195 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package hamt_test
+
+import (
+	"elements/hamt"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// hashFunc lets tests choose hashes, to build collisions and deep paths.
+type hashFunc func(key interface{}) uint64
+
+func (f hashFunc) Hash(key interface{}) uint64 { return f(key) }
+
+var hashers = map[string]sync.Hasher{
+	"maphash": nil,
+	// 只有16个不同的哈希, 几乎所有的key都在冲突节点中
+	"collide": hashFunc(func(k interface{}) uint64 { return uint64(k.(int) % 16) }),
+	// 低60位相同, 只有最后一层能分开, 路径一直走到最深
+	"deep": hashFunc(func(k interface{}) uint64 { return uint64(k.(int)%16) << 60 }),
+}
+
+// 和内置的map对照: 随机的Store和Delete之后, 每个版本都和当时的内置map相同
+func TestMapAgainstBuiltin(t *testing.T) {
+	for name, h := range hashers {
+		t.Run(name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(1))
+			m := hamt.New(h)
+			want := make(map[int]int)
+			type version struct {
+				m    *hamt.Map
+				want map[int]int
+			}
+			var versions []version
+			for i := 0; i < 3000; i++ {
+				k := r.Intn(200)
+				if r.Intn(3) == 0 {
+					m = m.Delete(k)
+					delete(want, k)
+				} else {
+					m = m.Store(k, i)
+					want[k] = i
+				}
+				if i%300 == 0 {
+					cp := make(map[int]int, len(want))
+					for k, v := range want {
+						cp[k] = v
+					}
+					versions = append(versions, version{m, cp})
+				}
+			}
+			versions = append(versions, version{m, want})
+			// 旧的版本不受之后修改的影响
+			for _, v := range versions {
+				check(t, v.m, v.want)
+			}
+		})
+	}
+}
+
+func check(t *testing.T, m *hamt.Map, want map[int]int) {
+	t.Helper()
+	if m.Len() != len(want) {
+		t.Errorf("Len = %d, want %d", m.Len(), len(want))
+	}
+	for k := 0; k < 200; k++ {
+		v, ok := m.Load(k)
+		w, wok := want[k]
+		if ok != wok || ok && v != w {
+			t.Fatalf("Load(%d) = %v, %v; want %v, %v", k, v, ok, w, wok)
+		}
+	}
+	seen := 0
+	m.Range(func(k, v interface{}) bool {
+		seen++
+		if want[k.(int)] != v {
+			t.Errorf("Range: %v = %v, want %v", k, v, want[k.(int)])
+		}
+		return true
+	})
+	if seen != len(want) {
+		t.Errorf("Range saw %d keys, want %d", seen, len(want))
+	}
+}
+
+func TestNilMap(t *testing.T) {
+	var m *hamt.Map
+	if _, ok := m.Load(1); ok || m.Len() != 0 || m.Delete(1) != nil {
+		t.Error("nil Map is not empty")
+	}
+	m.Range(func(k, v interface{}) bool {
+		t.Error("Range on nil Map called f")
+		return true
+	})
+	m2 := m.Store(1, "a")
+	if v, _ := m2.Load(1); v != "a" || m2.Len() != 1 {
+		t.Errorf("Store on nil Map: Load = %v, Len = %d", v, m2.Len())
+	}
+}
+
+func TestDeleteAbsentReturnsSame(t *testing.T) {
+	m := hamt.New(nil).Store(1, 1)
+	if m.Delete(2) != m {
+		t.Error("Delete of an absent key made a new Map")
+	}
+	if m.Delete(1).Len() != 0 {
+		t.Error("Delete of the last key left keys")
+	}
+}
+
+// Delete之后的树和只Store剩下的key得到的树一样大: 删除会收起只剩一个叶子的节点
+func TestDeleteCompacts(t *testing.T) {
+	for name, h := range hashers {
+		m := hamt.New(h)
+		for k := 0; k < 1000; k++ {
+			m = m.Store(k, k)
+		}
+		fresh := hamt.New(h)
+		for k := 0; k < 1000; k++ {
+			if k%10 == 0 {
+				fresh = fresh.Store(k, k)
+			} else {
+				m = m.Delete(k)
+			}
+		}
+		if got, want := hamt.Nodes(m), hamt.Nodes(fresh); got != want {
+			t.Errorf("%s: %d nodes after deleting, %d when built directly", name, got, want)
+		}
+	}
+}
+
+func TestRangeStops(t *testing.T) {
+	m := hamt.New(nil)
+	for k := 0; k < 100; k++ {
+		m = m.Store(k, k)
+	}
+	n := 0
+	m.Range(func(k, v interface{}) bool {
+		n++
+		return n < 10
+	})
+	if n != 10 {
+		t.Errorf("Range called f %d times after it returned false at 10", n)
+	}
+}
+
+// 并发的Update都生效, 读者读到的每个版本都是某一次Update之后的完整状态
+func TestCurrent(t *testing.T) {
+	var c hamt.Current
+	const writers, n = 4, 200
+	var wg sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				k := w*n + i
+				c.Update(func(m *hamt.Map) *hamt.Map {
+					return m.Store(k, k).Store(-1, k)
+				})
+			}
+		}(w)
+	}
+	done := make(chan struct{})
+	var rg sync.WaitGroup
+	rg.Add(1)
+	go func() {
+		defer rg.Done()
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			m := c.Load()
+			// -1中是最后一次Update写入的key, 它一定在这个版本中
+			if last, ok := m.Load(-1); ok {
+				if _, ok := m.Load(last); !ok {
+					t.Errorf("version has -1 = %v but not %v", last, last)
+					return
+				}
+			}
+		}
+	}()
+	wg.Wait()
+	close(done)
+	rg.Wait()
+	if got := c.Load().Len(); got != writers*n+1 {
+		t.Errorf("Len = %d, want %d", got, writers*n+1)
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heap
+
+import (
+	"context"
+	"elements/clock"
+	"time"
+)
+
+// A DelayQueue holds elements until their deadlines. Take returns the
+// element with the earliest deadline once that deadline has passed;
+// elements with the same deadline are returned in the order they were put.
+// A DelayQueue is safe for concurrent use.
+type DelayQueue struct {
+	q     *Queue
+	clock clock.Clock
+	seq   uint64 // guarded by q.mu
+}
+
+type delayed struct {
+	v   interface{}
+	at  time.Time
+	seq uint64
+}
+
+// NewDelayQueue returns an empty DelayQueue.
+func NewDelayQueue() *DelayQueue {
+	return NewDelayQueueClock(clock.Real)
+}
+
+// NewDelayQueueClock returns an empty DelayQueue that tells the time by c,
+// or clock.Real if c is nil.
+func NewDelayQueueClock(c clock.Clock) *DelayQueue {
+	return &DelayQueue{clock: clock.Or(c), q: NewQueue(func(a, b interface{}) bool {
+		x, y := a.(*delayed), b.(*delayed)
+		if !x.at.Equal(y.at) {
+			return x.at.Before(y.at)
+		}
+		// 堆不是稳定的, 相同的时间按放入的顺序排
+		return x.seq < y.seq
+	})}
+}
+
+// Put adds v to the queue, to be taken after delay.
+func (d *DelayQueue) Put(v interface{}, delay time.Duration) {
+	d.PutAt(v, d.clock.Now().Add(delay))
+}
+
+// PutAt adds v to the queue, to be taken at or after at.
+// It panics if the queue is closed.
+func (d *DelayQueue) PutAt(v interface{}, at time.Time) {
+	q := d.q
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		panic("heap: put on closed DelayQueue")
+	}
+	d.seq++
+	Push(&q.h, &delayed{v: v, at: at, seq: d.seq})
+	// 新元素可能比堆顶更早, 等待中的Take要重新计算等待时间
+	q.broadcast()
+}
+
+// Take removes and returns the element with the earliest deadline, waiting
+// until that deadline has passed. It returns ctx.Err() if ctx is done
+// first, and ErrClosed once the queue is closed and empty.
+func (d *DelayQueue) Take(ctx context.Context) (interface{}, error) {
+	q := d.q
+	var timer clock.Timer
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+	q.mu.Lock()
+	for {
+		var wait <-chan time.Time
+		if len(q.h.s) == 0 {
+			if q.closed {
+				q.mu.Unlock()
+				return nil, ErrClosed
+			}
+		} else {
+			head := q.h.s[0].(*delayed)
+			delay := clock.Until(d.clock, head.at)
+			if delay <= 0 {
+				Pop(&q.h)
+				q.mu.Unlock()
+				return head.v, nil
+			}
+			// 睡到堆顶的时间, 中途有新元素放入就醒来重新看堆顶.
+			// 关闭的队列中剩下的元素仍然要等到时间才能取出
+			if timer == nil {
+				timer = d.clock.NewTimer(delay)
+			} else {
+				if !timer.Stop() {
+					select {
+					case <-timer.C():
+					default:
+					}
+				}
+				timer.Reset(delay)
+			}
+			wait = timer.C()
+		}
+		changed := q.changed
+		q.mu.Unlock()
+		select {
+		case <-wait:
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		q.mu.Lock()
+	}
+}
+
+// Len returns the number of elements in the queue, due or not.
+func (d *DelayQueue) Len() int {
+	return d.q.Len()
+}
+
+// Close closes the queue. Elements already in the queue can still be
+// taken when they are due; after that Take returns ErrClosed.
+func (d *DelayQueue) Close() {
+	d.q.Close()
+}
@@ -0,0 +1,103 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heap_test
+
+import (
+	"context"
+	"elements/clock"
+	"elements/heap"
+	"testing"
+	"time"
+)
+
+func TestDelayQueueOrder(t *testing.T) {
+	d := heap.NewDelayQueue()
+	now := time.Now()
+	d.PutAt("c", now.Add(30*time.Millisecond))
+	d.PutAt("a", now.Add(10*time.Millisecond))
+	d.PutAt("b1", now.Add(20*time.Millisecond))
+	d.PutAt("b2", now.Add(20*time.Millisecond))
+	ctx := context.Background()
+	for _, want := range []string{"a", "b1", "b2", "c"} {
+		v, err := d.Take(ctx)
+		if err != nil || v != want {
+			t.Fatalf("Take = %v, %v, want %s", v, err, want)
+		}
+	}
+	if d := time.Since(now); d < 30*time.Millisecond {
+		t.Errorf("took everything after %v, want at least 30ms", d)
+	}
+}
+
+func TestDelayQueueEarlierPut(t *testing.T) {
+	// Take在等待一个1小时后的元素时, 放入一个更早的元素要唤醒它
+	d := heap.NewDelayQueue()
+	d.Put("late", time.Hour)
+	got := make(chan interface{})
+	go func() {
+		v, _ := d.Take(context.Background())
+		got <- v
+	}()
+	time.Sleep(10 * time.Millisecond)
+	d.Put("early", 10*time.Millisecond)
+	select {
+	case v := <-got:
+		if v != "early" {
+			t.Errorf("Take = %v, want early", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Take did not wake up for an earlier element")
+	}
+	if n := d.Len(); n != 1 {
+		t.Errorf("Len = %d, want 1", n)
+	}
+}
+
+func TestDelayQueueContextAndClose(t *testing.T) {
+	d := heap.NewDelayQueue()
+	d.Put("x", time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := d.Take(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Take = %v, want DeadlineExceeded", err)
+	}
+
+	d = heap.NewDelayQueue()
+	errc := make(chan error)
+	go func() {
+		_, err := d.Take(context.Background())
+		errc <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	d.Close()
+	if err := <-errc; err != heap.ErrClosed {
+		t.Errorf("Take after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestDelayQueueFakeClock(t *testing.T) {
+	c := clock.NewFake(time.Unix(0, 0))
+	d := heap.NewDelayQueueClock(c)
+	d.Put("later", time.Hour)
+	d.Put("soon", time.Minute)
+	got := make(chan interface{})
+	go func() {
+		for i := 0; i < 2; i++ {
+			v, _ := d.Take(context.Background())
+			got <- v
+		}
+	}()
+	c.BlockUntil(1)
+	c.Advance(time.Minute)
+	if v := <-got; v != "soon" {
+		t.Fatalf("Take = %v, want soon", v)
+	}
+	// Take为新的堆顶重新设置了定时器, 等它设好再前进
+	c.BlockUntil(1)
+	c.Advance(59 * time.Minute)
+	if v := <-got; v != "later" {
+		t.Fatalf("Take = %v, want later", v)
+	}
+}
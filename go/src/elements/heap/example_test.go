@@ -0,0 +1,50 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heap_test
+
+import (
+	"context"
+	"elements/heap"
+	"fmt"
+	"time"
+)
+
+func ExampleQueue() {
+	type job struct {
+		name     string
+		priority int
+	}
+	q := heap.NewQueue(func(a, b interface{}) bool {
+		return a.(job).priority > b.(job).priority
+	})
+	q.Push(job{"index", 1})
+	q.Push(job{"backup", 0})
+	q.Push(job{"alert", 9})
+	q.Close()
+	for {
+		x, ok := q.Pop()
+		if !ok {
+			break
+		}
+		fmt.Println(x.(job).name)
+	}
+	// Output:
+	// alert
+	// index
+	// backup
+}
+
+func ExampleDelayQueue() {
+	d := heap.NewDelayQueue()
+	d.Put("retry 2", 20*time.Millisecond)
+	d.Put("retry 1", 10*time.Millisecond)
+	for i := 0; i < 2; i++ {
+		v, _ := d.Take(context.Background())
+		fmt.Println(v)
+	}
+	// Output:
+	// retry 1
+	// retry 2
+}
@@ -0,0 +1,136 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package heap provides heap operations for any type that implements
+// heap.Interface, like container/heap, and a Queue and DelayQueue built
+// on them that are safe for concurrent use.
+//
+// The functions Init, Push, Pop, Remove and Fix are those of container/heap.
+// A heap is a tree with the property that each node is the minimum-valued
+// node in its subtree. The minimum element in the tree is the root, at
+// index 0.
+//
+// Queue is a priority queue protected by a mutex whose Pop blocks until an
+// element is available. DelayQueue holds each element until its deadline,
+// like java.util.concurrent.DelayQueue.
+package heap
+
+import "sort"
+
+// The Interface type describes the requirements
+// for a type using the routines in this package.
+// Any type that implements it may be used as a
+// min-heap with the following invariants (established after
+// Init has been called or if the data is empty or sorted):
+//
+//	!h.Less(j, i) for 0 <= i < h.Len() and 2*i+1 <= j <= 2*i+2 and j < h.Len()
+//
+// Note that Push and Pop in this interface are for package heap's
+// implementation to call. To add and remove things from the heap,
+// use heap.Push and heap.Pop.
+//
+// 堆是一棵用切片表示的完全二叉树: 下标i的孩子是2*i+1和2*i+2, 父节点是(i-1)/2.
+// 不需要指针, 也不需要额外的内存. Interface只要求能比较和交换元素(sort.Interface),
+// 以及在切片末尾添加和删除, 调整顺序由本包完成
+type Interface interface {
+	sort.Interface
+	Push(x interface{}) // add x as element Len()
+	Pop() interface{}   // remove and return element Len() - 1.
+}
+
+// Init establishes the heap invariants required by the other routines in this package.
+// Init is idempotent with respect to the heap invariants
+// and may be called whenever the heap invariants may have been invalidated.
+// The complexity is O(n) where n = h.Len().
+func Init(h Interface) {
+	// heapify
+	//
+	// 从最后一个非叶子节点开始向前逐个下沉. 一半的节点是叶子, 不用动;
+	// 高度为k的节点最多下沉k层, 而这样的节点只有n/2^(k+1)个, 总和是O(n),
+	// 比逐个Push的O(n log n)快
+	n := h.Len()
+	for i := n/2 - 1; i >= 0; i-- {
+		down(h, i, n)
+	}
+}
+
+// Push pushes the element x onto the heap.
+// The complexity is O(log n) where n = h.Len().
+func Push(h Interface, x interface{}) {
+	// 加在末尾, 然后上浮到合适的位置
+	h.Push(x)
+	up(h, h.Len()-1)
+}
+
+// Pop removes and returns the minimum element (according to Less) from the heap.
+// The complexity is O(log n) where n = h.Len().
+// Pop is equivalent to Remove(h, 0).
+func Pop(h Interface) interface{} {
+	// 把根和最后一个元素交换, 在前n个元素中让新的根下沉, 最后取出末尾的最小值.
+	// 只在末尾删除, 切片不用移动元素
+	n := h.Len() - 1
+	h.Swap(0, n)
+	down(h, 0, n)
+	return h.Pop()
+}
+
+// Remove removes and returns the element at index i from the heap.
+// The complexity is O(log n) where n = h.Len().
+func Remove(h Interface, i int) interface{} {
+	n := h.Len() - 1
+	if n != i {
+		// 换到i的末尾元素可能比i的孩子大(要下沉), 也可能比i的父节点小(要上浮),
+		// 但不会两者都是. 先试下沉, 没有移动再试上浮
+		h.Swap(i, n)
+		if !down(h, i, n) {
+			up(h, i)
+		}
+	}
+	return h.Pop()
+}
+
+// Fix re-establishes the heap ordering after the element at index i has changed its value.
+// Changing the value of the element at index i and then calling Fix is equivalent to,
+// but less expensive than, calling Remove(h, i) followed by a Push of the new value.
+// The complexity is O(log n) where n = h.Len().
+func Fix(h Interface, i int) {
+	if !down(h, i, h.Len()) {
+		up(h, i)
+	}
+}
+
+func up(h Interface, j int) {
+	for {
+		i := (j - 1) / 2 // parent
+		// j为0时(0-1)/2也是0, 所以i == j表示已经到了根
+		if i == j || !h.Less(j, i) {
+			break
+		}
+		h.Swap(i, j)
+		j = i
+	}
+}
+
+// down moves the element at i0 down within the first n elements and
+// reports whether it moved.
+func down(h Interface, i0, n int) bool {
+	i := i0
+	for {
+		j1 := 2*i + 1
+		if j1 >= n || j1 < 0 { // j1 < 0 after int overflow
+			break
+		}
+		// 和较小的孩子交换, 交换后它成为另一个孩子的父节点, 仍然满足不变式
+		j := j1 // left child
+		if j2 := j1 + 1; j2 < n && h.Less(j2, j1) {
+			j = j2 // = 2*i + 2  // right child
+		}
+		if !h.Less(j, i) {
+			break
+		}
+		h.Swap(i, j)
+		i = j
+	}
+	return i > i0
+}
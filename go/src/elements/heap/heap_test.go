@@ -0,0 +1,109 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heap_test
+
+import (
+	"elements/heap"
+	"math/rand"
+	"sort"
+	"testing"
+	"testing/quick"
+)
+
+type myHeap []int
+
+func (h *myHeap) Less(i, j int) bool { return (*h)[i] < (*h)[j] }
+func (h *myHeap) Swap(i, j int)      { (*h)[i], (*h)[j] = (*h)[j], (*h)[i] }
+func (h *myHeap) Len() int           { return len(*h) }
+func (h *myHeap) Push(v interface{}) { *h = append(*h, v.(int)) }
+
+func (h *myHeap) Pop() (v interface{}) {
+	*h, v = (*h)[:h.Len()-1], (*h)[h.Len()-1]
+	return
+}
+
+func (h myHeap) verify(t *testing.T) {
+	t.Helper()
+	for i := 1; i < len(h); i++ {
+		if p := (i - 1) / 2; h[i] < h[p] {
+			t.Fatalf("heap invariant invalidated [%d] = %d > [%d] = %d", p, h[p], i, h[i])
+		}
+	}
+}
+
+// heapSort sorts xs by Init and repeated Pop.
+func heapSort(xs []int) []int {
+	h := myHeap(append([]int(nil), xs...))
+	heap.Init(&h)
+	out := []int{}
+	for h.Len() > 0 {
+		out = append(out, heap.Pop(&h).(int))
+	}
+	return out
+}
+
+func TestHeapSort(t *testing.T) {
+	sorted := func(xs []int) []int {
+		out := append([]int{}, xs...)
+		sort.Ints(out)
+		return out
+	}
+	if err := quick.CheckEqual(heapSort, sorted, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestPush(t *testing.T) {
+	h := new(myHeap)
+	for i := 20; i > 0; i-- {
+		heap.Push(h, i)
+		h.verify(t)
+	}
+	for i := 1; h.Len() > 0; i++ {
+		if x := heap.Pop(h).(int); x != i {
+			t.Fatalf("%d.th pop got %d; want %d", i, x, i)
+		}
+		h.verify(t)
+	}
+}
+
+func TestRemove(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	h := new(myHeap)
+	for i := 0; i < 100; i++ {
+		*h = append(*h, rnd.Intn(50))
+	}
+	heap.Init(h)
+	h.verify(t)
+	want := map[int]int{}
+	for _, v := range *h {
+		want[v]++
+	}
+	for h.Len() > 0 {
+		v := heap.Remove(h, rnd.Intn(h.Len())).(int)
+		h.verify(t)
+		want[v]--
+	}
+	for v, n := range want {
+		if n != 0 {
+			t.Errorf("value %d removed %d times too few", v, n)
+		}
+	}
+}
+
+func TestFix(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	h := new(myHeap)
+	for i := 0; i < 100; i++ {
+		heap.Push(h, rnd.Intn(1000))
+	}
+	for i := 0; i < 1000; i++ {
+		j := rnd.Intn(h.Len())
+		// 改大的要下沉, 改小的要上浮
+		(*h)[j] += rnd.Intn(200) - 100
+		heap.Fix(h, j)
+		h.verify(t)
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heap
+
+import (
+	"context"
+	"elements/errs"
+	"sync"
+)
+
+// ErrClosed is returned by PopContext and DelayQueue.Take once the queue
+// has been closed and drained, and by TryPush once it has been closed. It
+// is errs.ErrClosed to errors.Is.
+var ErrClosed = errs.New("heap: queue closed", errs.ErrClosed)
+
+// items is a heap of arbitrary values ordered by a less function.
+type items struct {
+	less func(a, b interface{}) bool
+	s    []interface{}
+}
+
+func (h *items) Len() int           { return len(h.s) }
+func (h *items) Less(i, j int) bool { return h.less(h.s[i], h.s[j]) }
+func (h *items) Swap(i, j int)      { h.s[i], h.s[j] = h.s[j], h.s[i] }
+func (h *items) Push(x interface{}) { h.s = append(h.s, x) }
+
+func (h *items) Pop() interface{} {
+	n := len(h.s) - 1
+	x := h.s[n]
+	h.s[n] = nil // 避免切片底层数组继续引用已经取出的元素
+	h.s = h.s[:n]
+	return x
+}
+
+// A Queue is a priority queue that is safe for concurrent use. Pop returns
+// the minimum element according to the less function given to NewQueue,
+// blocking while the queue is empty.
+//
+// Closing a Queue works like closing a channel: elements already in the
+// queue can still be popped, after which Pop reports that the queue is
+// closed instead of blocking.
+type Queue struct {
+	mu     sync.Mutex
+	h      items
+	closed bool
+
+	// changed is closed and replaced whenever an element is pushed or the
+	// queue is closed, waking every blocked Pop.
+	//
+	// 不用sync.Cond: Cond.Wait不能和context或定时器一起等待, 而PopContext和
+	// DelayQueue.Take都需要. 关闭channel同样能唤醒所有等待者
+	changed chan struct{}
+}
+
+// NewQueue returns an empty Queue ordered by less.
+func NewQueue(less func(a, b interface{}) bool) *Queue {
+	return &Queue{
+		h:       items{less: less},
+		changed: make(chan struct{}),
+	}
+}
+
+// broadcast wakes every waiter. q.mu must be held.
+func (q *Queue) broadcast() {
+	close(q.changed)
+	q.changed = make(chan struct{})
+}
+
+// Push adds x to the queue. It panics if the queue is closed.
+func (q *Queue) Push(x interface{}) {
+	if q.TryPush(x) != nil {
+		panic("heap: push on closed Queue")
+	}
+}
+
+// TryPush is like Push, but returns ErrClosed if the queue is closed,
+// for producers that may race with the Close.
+func (q *Queue) TryPush(x interface{}) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return ErrClosed
+	}
+	Push(&q.h, x)
+	q.broadcast()
+	return nil
+}
+
+// Pop removes and returns the minimum element, blocking until one is
+// available. The ok result is false if the queue is closed and empty.
+func (q *Queue) Pop() (x interface{}, ok bool) {
+	x, err := q.PopContext(context.Background())
+	return x, err == nil
+}
+
+// PopContext is like Pop but gives up when ctx is done, returning ctx.Err().
+// It returns ErrClosed if the queue is closed and empty.
+func (q *Queue) PopContext(ctx context.Context) (interface{}, error) {
+	q.mu.Lock()
+	for len(q.h.s) == 0 {
+		if q.closed {
+			q.mu.Unlock()
+			return nil, ErrClosed
+		}
+		// 被唤醒后重新检查: 可能有多个等待者, 元素已经被别人取走
+		changed := q.changed
+		q.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		q.mu.Lock()
+	}
+	x := Pop(&q.h)
+	q.mu.Unlock()
+	return x, nil
+}
+
+// TryPop removes and returns the minimum element if there is one.
+func (q *Queue) TryPop() (x interface{}, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.h.s) == 0 {
+		return nil, false
+	}
+	return Pop(&q.h), true
+}
+
+// Peek returns the minimum element without removing it.
+func (q *Queue) Peek() (x interface{}, ok bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.h.s) == 0 {
+		return nil, false
+	}
+	return q.h.s[0], true
+}
+
+// Len returns the number of elements in the queue.
+func (q *Queue) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.h.s)
+}
+
+// Close closes the queue, waking every blocked Pop. Closing a closed
+// queue has no effect.
+func (q *Queue) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if !q.closed {
+		q.closed = true
+		q.broadcast()
+	}
+}
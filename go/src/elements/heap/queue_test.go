@@ -0,0 +1,154 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package heap_test
+
+import (
+	"context"
+	"elements/errs"
+	"elements/heap"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func intLess(a, b interface{}) bool { return a.(int) < b.(int) }
+
+func TestQueueOrder(t *testing.T) {
+	q := heap.NewQueue(intLess)
+	for _, v := range []int{5, 3, 8, 1, 9, 2} {
+		q.Push(v)
+	}
+	if x, _ := q.Peek(); x != 1 {
+		t.Errorf("Peek = %v, want 1", x)
+	}
+	for _, want := range []int{1, 2, 3, 5, 8, 9} {
+		if x, ok := q.TryPop(); !ok || x != want {
+			t.Fatalf("TryPop = %v, %v, want %d, true", x, ok, want)
+		}
+	}
+	if _, ok := q.TryPop(); ok {
+		t.Error("TryPop on empty queue succeeded")
+	}
+}
+
+func TestQueuePopBlocks(t *testing.T) {
+	q := heap.NewQueue(intLess)
+	got := make(chan interface{})
+	go func() {
+		x, _ := q.Pop()
+		got <- x
+	}()
+	select {
+	case x := <-got:
+		t.Fatalf("Pop on empty queue returned %v", x)
+	case <-time.After(10 * time.Millisecond):
+	}
+	q.Push(7)
+	if x := <-got; x != 7 {
+		t.Errorf("Pop = %v, want 7", x)
+	}
+}
+
+func TestQueueClose(t *testing.T) {
+	q := heap.NewQueue(intLess)
+	q.Push(1)
+	var wg sync.WaitGroup
+	results := make(chan bool, 3)
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, ok := q.Pop()
+			results <- ok
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	q.Close()
+	wg.Wait()
+	close(results)
+	// 关闭前的元素仍然能取出, 之后Pop不再阻塞
+	n := 0
+	for ok := range results {
+		if ok {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("%d Pops succeeded, want 1", n)
+	}
+	if _, err := q.PopContext(context.Background()); err != heap.ErrClosed {
+		t.Errorf("PopContext after Close = %v, want ErrClosed", err)
+	}
+	defer func() {
+		if recover() == nil {
+			t.Error("Push on closed queue did not panic")
+		}
+	}()
+	q.Push(2)
+}
+
+func TestQueueTryPush(t *testing.T) {
+	q := heap.NewQueue(intLess)
+	if err := q.TryPush(1); err != nil {
+		t.Fatalf("TryPush = %v", err)
+	}
+	q.Close()
+	err := q.TryPush(2)
+	if err != heap.ErrClosed || !errors.Is(err, errs.ErrClosed) {
+		t.Errorf("TryPush after Close = %v, want ErrClosed", err)
+	}
+	if x, ok := q.Pop(); !ok || x != 1 || q.Len() != 0 {
+		t.Errorf("Pop = %v, %v with %d left; want only the element pushed before Close", x, ok, q.Len())
+	}
+}
+
+func TestQueuePopContext(t *testing.T) {
+	q := heap.NewQueue(intLess)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := q.PopContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("PopContext = %v, want DeadlineExceeded", err)
+	}
+}
+
+func TestQueueConcurrent(t *testing.T) {
+	const producers, perProducer, consumers = 4, 1000, 4
+	q := heap.NewQueue(intLess)
+	var seen sync.Map
+	var wg, cwg sync.WaitGroup
+	for c := 0; c < consumers; c++ {
+		cwg.Add(1)
+		go func() {
+			defer cwg.Done()
+			for {
+				x, ok := q.Pop()
+				if !ok {
+					return
+				}
+				if _, dup := seen.LoadOrStore(x, true); dup {
+					t.Errorf("%v popped twice", x)
+				}
+			}
+		}()
+	}
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				q.Push(p*perProducer + i)
+			}
+		}(p)
+	}
+	wg.Wait()
+	q.Close()
+	cwg.Wait()
+	n := 0
+	seen.Range(func(_, _ interface{}) bool { n++; return true })
+	if n != producers*perProducer {
+		t.Errorf("popped %d elements, want %d", n, producers*perProducer)
+	}
+}
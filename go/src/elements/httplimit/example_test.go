@@ -0,0 +1,33 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httplimit_test
+
+import (
+	"elements/httplimit"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+)
+
+func ExampleHandler() {
+	hello := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "hello")
+	})
+	h := httplimit.Handler(hello, httplimit.Config{
+		Key:   func(r *http.Request) string { return r.Header.Get("X-Tenant") },
+		Rate:  1,
+		Burst: 1,
+	})
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Tenant", "acme")
+		h.ServeHTTP(w, r)
+		fmt.Printf("%d %q\n", w.Code, w.Header().Get("Retry-After"))
+	}
+	// Output:
+	// 200 ""
+	// 429 "1"
+}
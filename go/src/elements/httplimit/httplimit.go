@@ -0,0 +1,168 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package httplimit provides an HTTP middleware that limits the requests
+// in flight, and their rate, per route or tenant, rejecting the excess
+// with 429 Too Many Requests and a Retry-After.
+//
+//	h := httplimit.Handler(mux, httplimit.Config{
+//		Key:         func(r *http.Request) string { return r.Header.Get("X-Tenant") },
+//		MaxInFlight: 64,
+//		Rate:        100,
+//	})
+//
+// The limits are a semaphore.Weighted and a semaphore.KeyedLimiter per
+// key: a tenant that floods the server gets its 429s, and the others do
+// not notice.
+package httplimit
+
+import (
+	"context"
+	"elements/semaphore"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// A Reason is why a request was rejected.
+type Reason int
+
+const (
+	InFlight Reason = iota // the key had MaxInFlight requests in flight
+	Rate                   // the key was over its Rate
+)
+
+func (r Reason) String() string {
+	if r == Rate {
+		return "rate"
+	}
+	return "in-flight"
+}
+
+// Config configures a Handler.
+type Config struct {
+	// Key returns the key that r is limited under: its route, its
+	// tenant, or both. Nil means the path of its URL. The keys of
+	// MaxInFlight are never forgotten, so they should be a bounded set.
+	Key func(r *http.Request) string
+
+	// MaxInFlight is the total weight of the requests in flight for a
+	// key. Zero means no limit.
+	MaxInFlight int64
+
+	// Weight returns the weight of r against MaxInFlight, so that an
+	// export counts for more than a lookup. Nil means 1.
+	Weight func(r *http.Request) int64
+
+	// Wait is how long a request may wait for room under MaxInFlight
+	// before it is rejected. Zero means it is rejected at once.
+	Wait time.Duration
+
+	// Rate is the number of requests per second allowed for a key, with
+	// bursts of Burst. Zero means no limit, and a zero Burst means Rate,
+	// or 1 if Rate is less.
+	Rate  float64
+	Burst int
+
+	// RetryAfter is the Retry-After of the requests rejected for
+	// MaxInFlight. Zero means one second. The requests rejected for Rate
+	// are told when their key has a token again.
+	RetryAfter time.Duration
+
+	// OnReject, if not nil, is called for each rejected request, before
+	// the response is written.
+	OnReject func(r *http.Request, key string, reason Reason)
+}
+
+type handler struct {
+	next http.Handler
+	cfg  Config
+
+	rate *semaphore.KeyedLimiter // nil without a Rate
+	sems sync.Map                // key -> *semaphore.Weighted
+}
+
+// Handler returns a Handler that runs next for the requests within the
+// limits of cfg, and answers the others with 429 Too Many Requests.
+func Handler(next http.Handler, cfg Config) http.Handler {
+	if cfg.Key == nil {
+		cfg.Key = func(r *http.Request) string { return r.URL.Path }
+	}
+	if cfg.RetryAfter <= 0 {
+		cfg.RetryAfter = time.Second
+	}
+	h := &handler{next: next, cfg: cfg}
+	if cfg.Rate > 0 {
+		burst := cfg.Burst
+		if burst <= 0 {
+			if burst = int(cfg.Rate); burst < 1 {
+				burst = 1
+			}
+		}
+		h.rate = semaphore.NewKeyedLimiter(cfg.Rate, burst)
+	}
+	return h
+}
+
+func (h *handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := h.cfg.Key(r)
+	// 先检查速率: 它不等待, 被拒绝的请求不用去占并发的名额
+	if h.rate != nil {
+		if ok, wait := h.rate.TakeN(key, time.Now(), 1); !ok {
+			h.reject(w, r, key, Rate, wait)
+			return
+		}
+	}
+	if h.cfg.MaxInFlight <= 0 {
+		h.next.ServeHTTP(w, r)
+		return
+	}
+	n := int64(1)
+	if h.cfg.Weight != nil {
+		n = h.cfg.Weight(r)
+	}
+	sem := h.semaphore(key)
+	if !h.acquire(r.Context(), sem, n) {
+		h.reject(w, r, key, InFlight, h.cfg.RetryAfter)
+		return
+	}
+	defer sem.Release(n)
+	h.next.ServeHTTP(w, r)
+}
+
+func (h *handler) semaphore(key string) *semaphore.Weighted {
+	if s, ok := h.sems.Load(key); ok {
+		return s.(*semaphore.Weighted)
+	}
+	s, _ := h.sems.LoadOrStore(key, semaphore.NewWeighted(h.cfg.MaxInFlight))
+	return s.(*semaphore.Weighted)
+}
+
+func (h *handler) acquire(ctx context.Context, sem *semaphore.Weighted, n int64) bool {
+	if sem.TryAcquire(n) {
+		return true
+	}
+	if h.cfg.Wait <= 0 {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(ctx, h.cfg.Wait)
+	defer cancel()
+	return sem.Acquire(ctx, n) == nil
+}
+
+func (h *handler) reject(w http.ResponseWriter, r *http.Request, key string, reason Reason, retryAfter time.Duration) {
+	if h.cfg.OnReject != nil {
+		h.cfg.OnReject(r, key, reason)
+	}
+	if retryAfter >= 0 {
+		// Retry-After以秒为单位, 向上取整, 至少1秒
+		secs := int64((retryAfter + time.Second - 1) / time.Second)
+		if secs < 1 {
+			secs = 1
+		}
+		w.Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+	}
+	http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+}
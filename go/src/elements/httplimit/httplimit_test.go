@@ -0,0 +1,128 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package httplimit_test
+
+import (
+	"elements/httplimit"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func serve(h http.Handler, path string) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w
+}
+
+// blocking returns a Handler that blocks until release is closed, and a
+// channel that receives each time it is entered.
+func blocking(release chan struct{}) (http.Handler, chan struct{}) {
+	entered := make(chan struct{}, 10)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		entered <- struct{}{}
+		<-release
+	}), entered
+}
+
+func TestInFlight(t *testing.T) {
+	release := make(chan struct{})
+	next, entered := blocking(release)
+	var rejected []string
+	h := httplimit.Handler(next, httplimit.Config{
+		MaxInFlight: 2,
+		OnReject:    func(r *http.Request, key string, reason httplimit.Reason) { rejected = append(rejected, key+" "+reason.String()) },
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			serve(h, "/a")
+		}()
+		<-entered
+	}
+	w := serve(h, "/a")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "1" {
+		t.Fatalf("third request: %d, Retry-After %q; want 429, 1", w.Code, w.Header().Get("Retry-After"))
+	}
+	if len(rejected) != 1 || rejected[0] != "/a in-flight" {
+		t.Fatalf("OnReject got %v", rejected)
+	}
+	// 另一个key有自己的名额
+	go serve(h, "/b")
+	<-entered
+	close(release)
+	wg.Wait()
+	if w := serve(h, "/a"); w.Code != http.StatusOK {
+		t.Fatalf("request after the others returned: %d", w.Code)
+	}
+}
+
+func TestWait(t *testing.T) {
+	release := make(chan struct{})
+	next, entered := blocking(release)
+	h := httplimit.Handler(next, httplimit.Config{MaxInFlight: 1, Wait: time.Minute})
+	go serve(h, "/")
+	<-entered
+	done := make(chan int)
+	go func() { done <- serve(h, "/").Code }()
+	<-time.After(10 * time.Millisecond)
+	close(release)
+	if code := <-done; code != http.StatusOK {
+		t.Fatalf("waiting request: %d; want 200", code)
+	}
+}
+
+func TestWeight(t *testing.T) {
+	release := make(chan struct{})
+	next, entered := blocking(release)
+	defer close(release)
+	h := httplimit.Handler(next, httplimit.Config{
+		MaxInFlight: 3,
+		Weight: func(r *http.Request) int64 {
+			if r.URL.Query().Get("export") != "" {
+				return 3
+			}
+			return 1
+		},
+		Key: func(r *http.Request) string { return "all" },
+	})
+	go serve(h, "/")
+	<-entered
+	if w := serve(h, "/?export=1"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("heavy request beside a light one: %d; want 429", w.Code)
+	}
+}
+
+func TestRate(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	h := httplimit.Handler(ok, httplimit.Config{
+		Key:   func(r *http.Request) string { return r.Header.Get("X-Tenant") },
+		Rate:  0.5,
+		Burst: 2,
+	})
+	req := func(tenant string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set("X-Tenant", tenant)
+		h.ServeHTTP(w, r)
+		return w
+	}
+	for i := 0; i < 2; i++ {
+		if w := req("acme"); w.Code != http.StatusOK {
+			t.Fatalf("request %d within the burst: %d", i, w.Code)
+		}
+	}
+	w := req("acme")
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") != "2" {
+		t.Fatalf("request over the rate: %d, Retry-After %q; want 429, 2", w.Code, w.Header().Get("Retry-After"))
+	}
+	if w := req("other"); w.Code != http.StatusOK {
+		t.Fatalf("another tenant: %d", w.Code)
+	}
+}
@@ -0,0 +1,31 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package initgraph_test
+
+import (
+	"context"
+	"elements/initgraph"
+	"errors"
+	"fmt"
+)
+
+func Example() {
+	var g initgraph.Graph
+	step := func(name string, err error) func(context.Context) error {
+		return func(context.Context) error {
+			fmt.Println("init", name)
+			return err
+		}
+	}
+	g.Add("config", nil, step("config", nil))
+	g.Add("db", []string{"config"}, step("db", errors.New("connection refused")))
+	g.Add("api", []string{"db"}, step("api", nil))
+
+	fmt.Println(g.Init(context.Background(), "api"))
+	// Output:
+	// init config
+	// init db
+	// initgraph: api: initgraph: db: connection refused
+}
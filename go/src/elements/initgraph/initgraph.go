@@ -0,0 +1,255 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package initgraph runs initialization functions that depend on each
+// other. Each function runs exactly once, after the functions it depends
+// on have succeeded, and functions that do not depend on each other run
+// concurrently.
+package initgraph
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// ErrDuplicate is returned by Add for a name that is already added.
+var ErrDuplicate = errors.New("initgraph: duplicate node")
+
+// A Graph is a set of named initialization functions and their
+// dependencies. It is safe for concurrent use. The zero value is an
+// empty Graph ready to use.
+type Graph struct {
+	mu    sync.Mutex
+	nodes map[string]*node
+}
+
+type node struct {
+	name string
+	deps []string
+	init func(ctx context.Context) error
+	once sync.OnceError
+}
+
+// A NodeError is the error of one node: the error its function returned,
+// or, if it did not run because a dependency failed, that dependency's
+// NodeError.
+type NodeError struct {
+	Node string
+	Err  error
+}
+
+func (e *NodeError) Error() string { return "initgraph: " + e.Node + ": " + e.Err.Error() }
+
+func (e *NodeError) Unwrap() error { return e.Err }
+
+// Errors is the error returned by Run when several nodes fail. It is
+// sorted by node name.
+type Errors []*NodeError
+
+func (e Errors) Error() string {
+	s := e[0].Error()
+	if len(e) > 1 {
+		s += " (and " + strconv.Itoa(len(e)-1) + " more)"
+	}
+	return s
+}
+
+// A CycleError reports nodes that depend on themselves. Path starts and
+// ends with the same node.
+type CycleError struct {
+	Path []string
+}
+
+func (e *CycleError) Error() string {
+	s := "initgraph: dependency cycle: "
+	for i, n := range e.Path {
+		if i > 0 {
+			s += " -> "
+		}
+		s += n
+	}
+	return s
+}
+
+// A MissingError reports a dependency that was never added.
+type MissingError struct {
+	Node, Dep string
+}
+
+func (e *MissingError) Error() string {
+	return "initgraph: " + e.Node + " depends on unknown " + e.Dep
+}
+
+// Add adds the node name, whose function init runs once all of deps have
+// run successfully. The dependencies need not be added yet, but must be
+// by the time the node runs.
+func (g *Graph) Add(name string, deps []string, init func(ctx context.Context) error) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.nodes == nil {
+		g.nodes = make(map[string]*node)
+	}
+	if _, ok := g.nodes[name]; ok {
+		return ErrDuplicate
+	}
+	g.nodes[name] = &node{name: name, deps: append([]string(nil), deps...), init: init}
+	return nil
+}
+
+// Init runs the node name and everything it depends on, and returns its
+// NodeError, or nil if it succeeded. Nodes that have already run are not
+// run again: their first outcome is reused.
+//
+// Before running anything, Init checks the node's dependencies and
+// returns a CycleError or MissingError for a graph that cannot be run.
+func (g *Graph) Init(ctx context.Context, name string) error {
+	nodes, err := g.plan([]string{name})
+	if err != nil {
+		return err
+	}
+	return g.run(ctx, nodes, nodes[name])
+}
+
+// Run runs every node, as Init does. It returns nil if all succeed, the
+// NodeError if one fails, and Errors if several do. Nodes skipped because
+// a dependency failed count as failed.
+func (g *Graph) Run(ctx context.Context) error {
+	g.mu.Lock()
+	names := make([]string, 0, len(g.nodes))
+	for name := range g.nodes {
+		names = append(names, name)
+	}
+	g.mu.Unlock()
+	sort.Strings(names)
+	nodes, err := g.plan(names)
+	if err != nil {
+		return err
+	}
+
+	errs := make([]*NodeError, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, n *node) {
+			defer wg.Done()
+			if err := g.run(ctx, nodes, n); err != nil {
+				ne, ok := err.(*NodeError)
+				if !ok {
+					// 之前的一次Init中n的函数panic了
+					ne = &NodeError{Node: n.name, Err: err}
+				}
+				errs[i] = ne
+			}
+		}(i, nodes[name])
+	}
+	wg.Wait()
+	var failed Errors
+	for _, e := range errs {
+		if e != nil {
+			failed = append(failed, e)
+		}
+	}
+	switch len(failed) {
+	case 0:
+		return nil
+	case 1:
+		return failed[0]
+	}
+	return failed
+}
+
+// Err returns the outcome of the node name: whether it has run, and its
+// NodeError if it failed.
+func (g *Graph) Err(name string) (done bool, err error) {
+	g.mu.Lock()
+	n := g.nodes[name]
+	g.mu.Unlock()
+	if n == nil {
+		return false, nil
+	}
+	return n.once.Done()
+}
+
+// plan returns the nodes reachable from roots, after checking that all
+// their dependencies exist and that they have no cycle.
+func (g *Graph) plan(roots []string) (map[string]*node, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	state := make(map[string]int)
+	nodes := make(map[string]*node)
+	var path []string
+	var visit func(name, from string) error
+	visit = func(name, from string) error {
+		switch state[name] {
+		case visited:
+			return nil
+		case visiting:
+			// 从path中name第一次出现的位置到当前就是环
+			for i, p := range path {
+				if p == name {
+					return &CycleError{Path: append(append([]string(nil), path[i:]...), name)}
+				}
+			}
+		}
+		n, ok := g.nodes[name]
+		if !ok {
+			if from == "" {
+				return &MissingError{Node: name, Dep: name}
+			}
+			return &MissingError{Node: from, Dep: name}
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, d := range n.deps {
+			if err := visit(d, name); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		nodes[name] = n
+		return nil
+	}
+	for _, r := range roots {
+		if err := visit(r, ""); err != nil {
+			return nil, err
+		}
+	}
+	return nodes, nil
+}
+
+// run runs n once its dependencies have succeeded, running them first
+// as needed, and returns its *NodeError or nil.
+func (g *Graph) run(ctx context.Context, nodes map[string]*node, n *node) error {
+	return n.once.Do(func() error {
+		// 依赖之间互不等待, 并发地运行. 已经运行过的依赖的Do立即返回,
+		// 正在别处运行的依赖的Do等它结束
+		errs := make([]error, len(n.deps))
+		var wg sync.WaitGroup
+		for i, d := range n.deps {
+			wg.Add(1)
+			go func(i int, d *node) {
+				defer wg.Done()
+				errs[i] = g.run(ctx, nodes, d)
+			}(i, nodes[d])
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				return &NodeError{Node: n.name, Err: err}
+			}
+		}
+		if err := n.init(ctx); err != nil {
+			return &NodeError{Node: n.name, Err: err}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,200 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package initgraph_test
+
+import (
+	"context"
+	"elements/initgraph"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type recorder struct {
+	mu    sync.Mutex
+	order []string
+	calls map[string]int
+}
+
+func (r *recorder) init(name string, err error) func(context.Context) error {
+	return func(context.Context) error {
+		r.mu.Lock()
+		r.order = append(r.order, name)
+		if r.calls == nil {
+			r.calls = make(map[string]int)
+		}
+		r.calls[name]++
+		r.mu.Unlock()
+		return err
+	}
+}
+
+func (r *recorder) index(name string) int {
+	for i, n := range r.order {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestRunOrder(t *testing.T) {
+	var g initgraph.Graph
+	var r recorder
+	g.Add("server", []string{"cache", "db"}, r.init("server", nil))
+	g.Add("cache", []string{"config"}, r.init("cache", nil))
+	g.Add("db", []string{"config"}, r.init("db", nil))
+	g.Add("config", nil, r.init("config", nil))
+	if err := g.Add("db", nil, nil); err != initgraph.ErrDuplicate {
+		t.Errorf("second Add(db) = %v", err)
+	}
+	if err := g.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for _, dep := range [][2]string{{"config", "cache"}, {"config", "db"}, {"cache", "server"}, {"db", "server"}} {
+		if r.index(dep[0]) > r.index(dep[1]) {
+			t.Errorf("%s ran after %s: %v", dep[0], dep[1], r.order)
+		}
+	}
+	// 再次运行什么也不做
+	if err := g.Run(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	for name, n := range r.calls {
+		if n != 1 {
+			t.Errorf("%s ran %d times", name, n)
+		}
+	}
+}
+
+// 互不依赖的节点并发地运行: a和b互相等待对方开始, 串行运行的话会超时
+func TestRunConcurrent(t *testing.T) {
+	var g initgraph.Graph
+	aStarted, bStarted := make(chan struct{}), make(chan struct{})
+	wait := func(mine, other chan struct{}) func(context.Context) error {
+		return func(context.Context) error {
+			close(mine)
+			select {
+			case <-other:
+				return nil
+			case <-time.After(5 * time.Second):
+				return errors.New("ran alone")
+			}
+		}
+	}
+	g.Add("a", nil, wait(aStarted, bStarted))
+	g.Add("b", nil, wait(bStarted, aStarted))
+	g.Add("c", []string{"a", "b"}, func(context.Context) error { return nil })
+	if err := g.Init(context.Background(), "c"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInitRunsOnlyDependencies(t *testing.T) {
+	var g initgraph.Graph
+	var r recorder
+	g.Add("a", nil, r.init("a", nil))
+	g.Add("b", []string{"a"}, r.init("b", nil))
+	g.Add("other", nil, r.init("other", nil))
+	if err := g.Init(context.Background(), "b"); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.order) != 2 || r.calls["other"] != 0 {
+		t.Errorf("ran %v", r.order)
+	}
+	if done, err := g.Err("b"); !done || err != nil {
+		t.Errorf("Err(b) = %v, %v", done, err)
+	}
+	if done, _ := g.Err("other"); done {
+		t.Error("Err(other) reports done")
+	}
+}
+
+func TestFailure(t *testing.T) {
+	var g initgraph.Graph
+	var r recorder
+	refused := errors.New("connection refused")
+	g.Add("db", nil, r.init("db", refused))
+	g.Add("cache", nil, r.init("cache", nil))
+	g.Add("orders", []string{"db", "cache"}, r.init("orders", nil))
+	g.Add("users", []string{"db"}, r.init("users", nil))
+	err := g.Run(context.Background())
+	errs, ok := err.(initgraph.Errors)
+	if !ok || len(errs) != 3 {
+		t.Fatalf("Run = %v, want Errors of db, orders and users", err)
+	}
+	for i, name := range []string{"db", "orders", "users"} {
+		if errs[i].Node != name || !errors.Is(errs[i], refused) {
+			t.Errorf("errs[%d] = %v", i, errs[i])
+		}
+	}
+	if r.calls["orders"] != 0 || r.calls["users"] != 0 || r.calls["cache"] != 1 {
+		t.Errorf("calls = %v; nodes depending on db must not run", r.calls)
+	}
+	want := "initgraph: orders: initgraph: db: connection refused"
+	if got := errs[1].Error(); got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	// 失败不重试
+	if err := g.Init(context.Background(), "db"); !errors.Is(err, refused) || r.calls["db"] != 1 {
+		t.Errorf("Init(db) again = %v after %d calls", err, r.calls["db"])
+	}
+}
+
+func TestCycle(t *testing.T) {
+	var g initgraph.Graph
+	var ran int32
+	f := func(context.Context) error { atomic.AddInt32(&ran, 1); return nil }
+	g.Add("a", []string{"b"}, f)
+	g.Add("b", []string{"c"}, f)
+	g.Add("c", []string{"a"}, f)
+	g.Add("d", nil, f)
+	err := g.Run(context.Background())
+	var ce *initgraph.CycleError
+	if !errors.As(err, &ce) || err.Error() != "initgraph: dependency cycle: a -> b -> c -> a" {
+		t.Errorf("Run = %v", err)
+	}
+	if ran != 0 {
+		t.Errorf("%d nodes ran in a graph with a cycle", ran)
+	}
+}
+
+func TestMissing(t *testing.T) {
+	var g initgraph.Graph
+	g.Add("a", []string{"nope"}, func(context.Context) error { return nil })
+	var me *initgraph.MissingError
+	if err := g.Init(context.Background(), "a"); !errors.As(err, &me) || me.Node != "a" || me.Dep != "nope" {
+		t.Errorf("Init(a) = %v", err)
+	}
+	if err := g.Init(context.Background(), "b"); !errors.As(err, &me) || me.Dep != "b" {
+		t.Errorf("Init(b) = %v", err)
+	}
+}
+
+// 多个goroutine同时Init有共同依赖的节点, 每个节点只运行一次
+func TestConcurrentInit(t *testing.T) {
+	var g initgraph.Graph
+	var r recorder
+	g.Add("base", nil, r.init("base", nil))
+	for _, n := range []string{"x", "y", "z"} {
+		g.Add(n, []string{"base"}, r.init(n, nil))
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			g.Init(context.Background(), []string{"x", "y", "z"}[i%3])
+		}(i)
+	}
+	wg.Wait()
+	for name, n := range r.calls {
+		if n != 1 {
+			t.Errorf("%s ran %d times", name, n)
+		}
+	}
+}
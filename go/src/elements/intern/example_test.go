@@ -0,0 +1,23 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package intern_test
+
+import (
+	"elements/intern"
+	"fmt"
+)
+
+func ExampleInterner() {
+	var in intern.Interner
+	// 同一个key从网络上收到1000次, 每次都是新的[]byte
+	for i := 0; i < 1000; i++ {
+		buf := []byte("tenant-7")
+		in.Intern(string(buf))
+	}
+	s := in.Stats()
+	fmt.Printf("kept %d string of %d bytes, %d bytes saved\n", s.Len, s.Bytes, s.Saved)
+	// Output:
+	// kept 1 string of 8 bytes, 7992 bytes saved
+}
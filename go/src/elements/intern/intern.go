@@ -0,0 +1,182 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package intern deduplicates strings.
+//
+// A map with millions of entries often has only thousands of distinct
+// keys, each decoded from the network into a new string. Interning the
+// keys before storing them keeps one copy of each:
+//
+//	var in intern.Interner
+//	m.Store(in.Intern(string(buf)), v)
+package intern
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// shards is the number of independently locked parts of an Interner.
+const shards = 32
+
+// An Interner maps strings to a canonical copy of each. It is safe for
+// concurrent use.
+//
+// The zero Interner has no capacity limit and is ready for use.
+// An Interner must not be copied after first use.
+type Interner struct {
+	n int64 // strings kept, or reserved by an Intern in progress; accessed atomically
+
+	// Capacity, if positive, is the most strings the Interner keeps. Once
+	// it holds that many, Intern returns new strings as they are. It must
+	// not be changed once the Interner is in use.
+	Capacity int
+
+	shards [shards]shard
+}
+
+// 每个分片的锁和计数器单独占据整数个cache line, 不同分片上的Intern互不干扰.
+// 大小是128的倍数, 也保证了每个分片开头的int64在32位平台上8字节对齐
+type shard struct {
+	shardFields
+	_ [128 - unsafe.Sizeof(shardFields{})%128]byte
+}
+
+type shardFields struct {
+	hits, misses, rejected int64 // accessed atomically
+	saved                  int64 // accessed atomically
+	bytes                  int64 // written with mu held, read atomically
+
+	mu sync.RWMutex
+	m  map[string]string
+}
+
+// Stats describes the activity of an Interner.
+type Stats struct {
+	Len      int   // strings kept
+	Bytes    int64 // total length of the strings kept
+	Hits     int64 // Intern calls that returned a string already kept
+	Misses   int64 // Intern calls that kept a new string
+	Rejected int64 // Intern calls that found the Interner at Capacity
+	Saved    int64 // total length of the strings Hits returned instead of their argument
+}
+
+// Intern returns the canonical copy of s: a string equal to s, the same
+// one for every call with an equal s while the Interner holds it.
+//
+// The copy kept is a copy of s, not s itself: s may be a substring of a
+// large buffer, which the Interner would otherwise keep alive.
+func (in *Interner) Intern(s string) string {
+	sh := &in.shards[hash(s)%shards]
+	sh.mu.RLock()
+	c, ok := sh.m[s]
+	sh.mu.RUnlock()
+	if ok {
+		atomic.AddInt64(&sh.hits, 1)
+		atomic.AddInt64(&sh.saved, int64(len(s)))
+		return c
+	}
+
+	// 先占一个名额再加锁: 并发地Intern不同的新字符串时,
+	// 总数也不会超过Capacity
+	if in.Capacity > 0 {
+		if atomic.AddInt64(&in.n, 1) > int64(in.Capacity) {
+			atomic.AddInt64(&in.n, -1)
+			// 已经满了, 但s可能在满之前就被保存了
+			sh.mu.RLock()
+			c, ok := sh.m[s]
+			sh.mu.RUnlock()
+			if ok {
+				atomic.AddInt64(&sh.hits, 1)
+				atomic.AddInt64(&sh.saved, int64(len(s)))
+				return c
+			}
+			atomic.AddInt64(&sh.rejected, 1)
+			return s
+		}
+	} else {
+		atomic.AddInt64(&in.n, 1)
+	}
+
+	sh.mu.Lock()
+	if c, ok := sh.m[s]; ok {
+		// 另一个goroutine刚刚保存了它
+		sh.mu.Unlock()
+		atomic.AddInt64(&in.n, -1)
+		atomic.AddInt64(&sh.hits, 1)
+		atomic.AddInt64(&sh.saved, int64(len(s)))
+		return c
+	}
+	if sh.m == nil {
+		sh.m = make(map[string]string)
+	}
+	c = clone(s)
+	sh.m[c] = c
+	atomic.AddInt64(&sh.misses, 1)
+	atomic.AddInt64(&sh.bytes, int64(len(c)))
+	sh.mu.Unlock()
+	return c
+}
+
+// Len returns the number of strings kept.
+func (in *Interner) Len() int {
+	n := 0
+	for i := range in.shards {
+		sh := &in.shards[i]
+		sh.mu.RLock()
+		n += len(sh.m)
+		sh.mu.RUnlock()
+	}
+	return n
+}
+
+// Stats returns the counters of the Interner.
+func (in *Interner) Stats() Stats {
+	var s Stats
+	for i := range in.shards {
+		sh := &in.shards[i]
+		sh.mu.RLock()
+		s.Len += len(sh.m)
+		sh.mu.RUnlock()
+		s.Bytes += atomic.LoadInt64(&sh.bytes)
+		s.Hits += atomic.LoadInt64(&sh.hits)
+		s.Misses += atomic.LoadInt64(&sh.misses)
+		s.Rejected += atomic.LoadInt64(&sh.rejected)
+		s.Saved += atomic.LoadInt64(&sh.saved)
+	}
+	return s
+}
+
+// Reset forgets every string kept, making room for new ones. Strings
+// returned so far stay valid; they are just no longer canonical.
+func (in *Interner) Reset() {
+	for i := range in.shards {
+		sh := &in.shards[i]
+		sh.mu.Lock()
+		atomic.AddInt64(&in.n, -int64(len(sh.m)))
+		atomic.StoreInt64(&sh.bytes, 0)
+		sh.m = nil
+		sh.mu.Unlock()
+	}
+}
+
+// hash is FNV-1a. It only spreads strings over the shards: the maps of the
+// shards hash again.
+func hash(s string) uint32 {
+	h := uint32(2166136261)
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= 16777619
+	}
+	return h
+}
+
+func clone(s string) string {
+	var b strings.Builder
+	b.Grow(len(s))
+	b.WriteString(s)
+	return b.String()
+}
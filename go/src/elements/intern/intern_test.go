@@ -0,0 +1,126 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package intern_test
+
+import (
+	"elements/intern"
+	"strconv"
+	"sync"
+	"testing"
+	"unsafe"
+)
+
+// data returns the address of the bytes of s.
+func data(s string) uintptr {
+	return *(*uintptr)(unsafe.Pointer(&s))
+}
+
+func TestIntern(t *testing.T) {
+	var in intern.Interner
+	buf := []byte("user:42 and more")
+	a := in.Intern(string(buf[:7]))
+	b := in.Intern(string(buf[:7]))
+	if a != "user:42" || b != a || data(a) != data(b) {
+		t.Fatalf("Intern returned %q at %x and %q at %x, want one copy", a, data(a), b, data(b))
+	}
+	big := string(buf)
+	if c := in.Intern(big[:7]); data(c) == data(big) {
+		t.Errorf("Intern kept a substring of its argument")
+	}
+	s := in.Stats()
+	want := intern.Stats{Len: 1, Bytes: 7, Hits: 2, Misses: 1, Saved: 14}
+	if s != want {
+		t.Errorf("Stats() = %+v, want %+v", s, want)
+	}
+
+	in.Reset()
+	if c := in.Intern("user:42"); data(c) == data(a) {
+		t.Errorf("the copy from before Reset is still canonical")
+	}
+	if s := in.Stats(); s.Len != 1 || s.Bytes != 7 || s.Misses != 2 {
+		t.Errorf("after Reset: Stats() = %+v", s)
+	}
+}
+
+func TestInternCapacity(t *testing.T) {
+	in := intern.Interner{Capacity: 2}
+	a := in.Intern("a")
+	in.Intern("b")
+	c := "c" + strconv.Itoa(1)
+	if got := in.Intern(c); data(got) != data(c) {
+		t.Errorf("Intern at Capacity did not return its argument")
+	}
+	if got := in.Intern("a"); data(got) != data(a) {
+		t.Errorf("Intern at Capacity did not return a string kept before")
+	}
+	if s := in.Stats(); s.Len != 2 || s.Rejected != 1 || s.Hits != 1 {
+		t.Errorf("Stats() = %+v, want Len 2, Rejected 1, Hits 1", s)
+	}
+	in.Reset()
+	if got := in.Intern(c); data(got) == data(c) {
+		t.Errorf("Intern after Reset still at Capacity")
+	}
+}
+
+func TestInternConcurrent(t *testing.T) {
+	const goroutines, keys = 8, 500
+	for _, capacity := range []int{0, keys / 2} {
+		in := intern.Interner{Capacity: capacity}
+		got := make([][]string, goroutines)
+		var wg sync.WaitGroup
+		for g := 0; g < goroutines; g++ {
+			wg.Add(1)
+			go func(g int) {
+				defer wg.Done()
+				for i := 0; i < keys; i++ {
+					got[g] = append(got[g], in.Intern(strconv.Itoa((i+g*37)%keys)))
+				}
+			}(g)
+		}
+		wg.Wait()
+
+		want := keys
+		if capacity > 0 {
+			want = capacity
+		}
+		s := in.Stats()
+		if s.Len != want || in.Len() != want || s.Misses != int64(want) {
+			t.Errorf("Capacity %d: Len = %d, Stats() = %+v; want %d strings kept", capacity, in.Len(), s, want)
+		}
+		if s.Hits+s.Misses+s.Rejected != goroutines*keys {
+			t.Errorf("Capacity %d: Stats() = %+v, counts do not add up to %d calls", capacity, s, goroutines*keys)
+		}
+		if capacity > 0 {
+			continue
+		}
+		// 没有容量限制时, 每个字符串只有一个副本
+		addr := make(map[string]uintptr)
+		for _, ss := range got {
+			for _, x := range ss {
+				if p, ok := addr[x]; ok && p != data(x) {
+					t.Fatalf("Intern returned two copies of %q", x)
+				}
+				addr[x] = data(x)
+			}
+		}
+	}
+}
+
+func BenchmarkIntern(b *testing.B) {
+	var in intern.Interner
+	keys := make([][]byte, 1024)
+	for i := range keys {
+		keys[i] = []byte("session:" + strconv.Itoa(i))
+	}
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			// string(b)作为map的key不会分配, 命中时Intern不分配
+			in.Intern(string(keys[i%len(keys)]))
+			i++
+		}
+	})
+}
@@ -0,0 +1,43 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lifecycle_test
+
+import (
+	"context"
+	"elements/cache"
+	"elements/expiry"
+	"elements/lifecycle"
+	"fmt"
+	"time"
+)
+
+type server struct{}
+
+func (*server) Shutdown(context.Context) error {
+	fmt.Println("server stopped")
+	return nil
+}
+
+func Example() {
+	expiries := expiry.Start(expiry.Config{})
+	leases := cache.NewLeaseMap(cache.LeaseConfig{Runner: expiries})
+	srv := new(server)
+	lifecycle.Register(srv, "server", srv.Shutdown, leases)
+	fmt.Println(lifecycle.Default.Len(), "components")
+
+	// 先停止server, 然后是LeaseMap, 最后是它们共用的Runner
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	fmt.Println(lifecycle.Shutdown(ctx))
+	_, err := leases.Store("job", "a", nil, time.Minute)
+	fmt.Println(err)
+	fmt.Println(lifecycle.Default.Len(), "components")
+	// Output:
+	// 3 components
+	// server stopped
+	// <nil>
+	// store job: cache: lease map closed
+	// 0 components
+}
@@ -0,0 +1,202 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package lifecycle stops the background components of a process in
+// dependency order.
+//
+// The components of go-elements that run goroutines of their own, such as
+// expiry.Runner, cache.LeaseMap, cache.Refresher, scheduler.Scheduler and
+// supervisor.Supervisor, register themselves in Default when they start,
+// and unregister when they are stopped. A service registers its own
+// components, naming what they use, and stops everything with one call:
+//
+//	lifecycle.Register(srv, "http", srv.Shutdown, sessions, sched)
+//	...
+//	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+//	defer cancel()
+//	err := lifecycle.Shutdown(ctx)
+//
+// Shutdown stops each component only once every component that depends on
+// it has stopped: above, the server first, then the SessionMap and the
+// Scheduler, then the expiry.Runner the SessionMap was given.
+package lifecycle
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// Default is the Group the components of go-elements register in.
+var Default = new(Group)
+
+// A Group is a set of running components. It is safe for concurrent use.
+// The zero value is an empty Group ready to use.
+type Group struct {
+	mu    sync.Mutex
+	comps map[interface{}]*component
+	seq   uint64
+}
+
+type component struct {
+	key  interface{} // the pointer it was registered with
+	name string
+	stop func(ctx context.Context) error
+	deps []interface{}
+	seq  uint64 // the order of registration
+
+	stopping bool          // a Shutdown has taken it; guarded by Group.mu
+	done     chan struct{} // closed once stop has returned
+	err      error         // the error of stop, set before done is closed
+}
+
+// A StopError is the error that the stop function of a component
+// returned.
+type StopError struct {
+	Component string // the name the component was registered with
+	Err       error
+}
+
+func (e *StopError) Error() string { return "lifecycle: " + e.Component + ": " + e.Err.Error() }
+
+func (e *StopError) Unwrap() error { return e.Err }
+
+// Errors is the error returned by Shutdown when several components fail
+// to stop. It is in the order the components were registered.
+type Errors []*StopError
+
+func (e Errors) Error() string {
+	s := e[0].Error()
+	if len(e) > 1 {
+		s += " (and " + strconv.Itoa(len(e)-1) + " more)"
+	}
+	return s
+}
+
+// Register adds the component c, a pointer that identifies it, which stop
+// stops. c depends on deps: Shutdown stops it before any of them. A dep
+// that is not registered in g, or was registered after c, is not waited
+// for, so the dependencies of a component cannot form a cycle. Register
+// panics if c is registered already.
+func (g *Group) Register(c interface{}, name string, stop func(ctx context.Context) error, deps ...interface{}) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.comps == nil {
+		g.comps = make(map[interface{}]*component)
+	}
+	if _, ok := g.comps[c]; ok {
+		panic("lifecycle: component " + name + " registered twice")
+	}
+	g.seq++
+	g.comps[c] = &component{
+		key:  c,
+		name: name,
+		stop: stop,
+		deps: append([]interface{}(nil), deps...),
+		seq:  g.seq,
+		done: make(chan struct{}),
+	}
+}
+
+// Unregister removes c, which its owner has stopped. It does nothing if c
+// is not registered.
+func (g *Group) Unregister(c interface{}) {
+	g.mu.Lock()
+	delete(g.comps, c)
+	g.mu.Unlock()
+}
+
+// Len returns the number of registered components.
+func (g *Group) Len() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.comps)
+}
+
+// Shutdown stops every registered component, each once all the components
+// that depend on it have stopped; components that do not depend on each
+// other stop concurrently. A component that fails to stop still counts as
+// stopped. Shutdown waits for them, and returns nil if all stop, the
+// StopError if one fails, and Errors if several do.
+//
+// If ctx is done first, Shutdown returns ctx.Err(), and the components
+// left go on stopping in the background, in order: ctx is passed to their
+// stop functions so that they can give up on what they were waiting for.
+//
+// Components registered during a Shutdown are not stopped by it, and the
+// Group can be shut down again. A component that another Shutdown is
+// stopping is waited for, but not stopped twice.
+func (g *Group) Shutdown(ctx context.Context) error {
+	g.mu.Lock()
+	comps := make([]*component, 0, len(g.comps))
+	var mine []*component
+	for _, c := range g.comps {
+		comps = append(comps, c)
+		if !c.stopping {
+			c.stopping = true
+			mine = append(mine, c)
+		}
+	}
+	// 每个组件要等依赖它的组件先停止
+	dependents := make(map[*component][]*component)
+	for _, c := range comps {
+		for _, d := range c.deps {
+			if dc, ok := g.comps[d]; ok && dc.seq < c.seq {
+				dependents[dc] = append(dependents[dc], c)
+			}
+		}
+	}
+	g.mu.Unlock()
+	sort.Slice(comps, func(i, j int) bool { return comps[i].seq < comps[j].seq })
+
+	for _, c := range mine {
+		go g.stop(ctx, c, dependents[c])
+	}
+	var failed Errors
+	for _, c := range comps {
+		select {
+		case <-c.done:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		if c.err != nil {
+			failed = append(failed, &StopError{Component: c.name, Err: c.err})
+		}
+	}
+	switch len(failed) {
+	case 0:
+		return nil
+	case 1:
+		return failed[0]
+	}
+	return failed
+}
+
+// stop stops c after waiting for its dependents, and removes it from g.
+func (g *Group) stop(ctx context.Context, c *component, dependents []*component) {
+	for _, d := range dependents {
+		<-d.done
+	}
+	c.err = c.stop(ctx)
+	g.mu.Lock()
+	// stop通常已经调用了Unregister, 之后同一个指针也可能又注册了一次
+	if g.comps[c.key] == c {
+		delete(g.comps, c.key)
+	}
+	g.mu.Unlock()
+	close(c.done)
+}
+
+// Register adds c to Default, as Group.Register does.
+func Register(c interface{}, name string, stop func(ctx context.Context) error, deps ...interface{}) {
+	Default.Register(c, name, stop, deps...)
+}
+
+// Unregister removes c from Default.
+func Unregister(c interface{}) { Default.Unregister(c) }
+
+// Shutdown stops every component registered in Default, as Group.Shutdown
+// does.
+func Shutdown(ctx context.Context) error { return Default.Shutdown(ctx) }
@@ -0,0 +1,176 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package lifecycle_test
+
+import (
+	"context"
+	"elements/lifecycle"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type comp struct{ name string }
+
+// recorder records the order in which components stop.
+type recorder struct {
+	mu    sync.Mutex
+	order []string
+}
+
+func (r *recorder) stop(name string, err error) func(context.Context) error {
+	return func(context.Context) error {
+		r.mu.Lock()
+		r.order = append(r.order, name)
+		r.mu.Unlock()
+		return err
+	}
+}
+
+func (r *recorder) index(name string) int {
+	for i, n := range r.order {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+func TestShutdownOrder(t *testing.T) {
+	var (
+		g                        lifecycle.Group
+		r                        recorder
+		runner, leases, sessions = &comp{"runner"}, &comp{"leases"}, &comp{"sessions"}
+		api                      = &comp{"api"}
+	)
+	g.Register(runner, "runner", r.stop("runner", nil))
+	g.Register(leases, "leases", r.stop("leases", nil), runner)
+	g.Register(sessions, "sessions", r.stop("sessions", nil), runner)
+	g.Register(api, "api", r.stop("api", nil), leases, sessions, &comp{"unknown"})
+	if err := g.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.order) != 4 || r.order[0] != "api" || r.order[3] != "runner" {
+		t.Errorf("stopped in the order %v, want api first and runner last", r.order)
+	}
+	if g.Len() != 0 {
+		t.Errorf("Len = %d after Shutdown", g.Len())
+	}
+}
+
+func TestShutdownConcurrent(t *testing.T) {
+	var g lifecycle.Group
+	// 两个互不依赖的组件同时停止: 各自等对方开始停止
+	a, b := make(chan struct{}), make(chan struct{})
+	g.Register(&comp{"a"}, "a", func(context.Context) error { close(a); <-b; return nil })
+	g.Register(&comp{"b"}, "b", func(context.Context) error { close(b); <-a; return nil })
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := g.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestShutdownErrors(t *testing.T) {
+	var (
+		g   lifecycle.Group
+		r   recorder
+		db  = &comp{"db"}
+		bad = errors.New("flush failed")
+	)
+	g.Register(db, "db", r.stop("db", nil))
+	g.Register(&comp{"cache"}, "cache", r.stop("cache", bad), db)
+	err := g.Shutdown(context.Background())
+	var se *lifecycle.StopError
+	if !errors.As(err, &se) || se.Component != "cache" || !errors.Is(err, bad) {
+		t.Fatalf("Shutdown = %v, want the StopError of cache", err)
+	}
+	if r.index("db") < 0 {
+		t.Error("db not stopped after cache failed to")
+	}
+
+	g.Register(&comp{"x"}, "x", r.stop("x", bad))
+	g.Register(&comp{"y"}, "y", r.stop("y", bad))
+	err = g.Shutdown(context.Background())
+	if errs, ok := err.(lifecycle.Errors); !ok || len(errs) != 2 || errs[0].Component != "x" {
+		t.Fatalf("Shutdown = %v, want the Errors of x and y", err)
+	}
+	if got, want := err.Error(), "lifecycle: x: flush failed (and 1 more)"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	var (
+		g       lifecycle.Group
+		r       recorder
+		runner  = &comp{"runner"}
+		release = make(chan struct{})
+	)
+	g.Register(runner, "runner", r.stop("runner", nil))
+	g.Register(&comp{"slow"}, "slow", func(ctx context.Context) error {
+		<-release
+		return nil
+	}, runner)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := g.Shutdown(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Shutdown = %v, want DeadlineExceeded", err)
+	}
+	if r.index("runner") >= 0 {
+		t.Fatal("runner stopped before the component that depends on it")
+	}
+
+	// 剩下的组件在后台按顺序继续停止
+	close(release)
+	for g.Len() > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	if r.index("runner") < 0 {
+		t.Error("runner not stopped")
+	}
+}
+
+func TestUnregister(t *testing.T) {
+	var g lifecycle.Group
+	c := &comp{"c"}
+	stopped := 0
+	g.Register(c, "c", func(context.Context) error {
+		stopped++
+		g.Unregister(c)
+		return nil
+	})
+	g.Unregister(c)
+	if err := g.Shutdown(context.Background()); err != nil || stopped != 0 {
+		t.Fatalf("Shutdown = %v, stopped %d times after Unregister", err, stopped)
+	}
+
+	g.Register(c, "c", func(context.Context) error {
+		stopped++
+		g.Unregister(c)
+		return nil
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			g.Shutdown(context.Background())
+		}()
+	}
+	wg.Wait()
+	if stopped != 1 {
+		t.Errorf("stopped %d times by two Shutdowns", stopped)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("no panic for a component registered twice")
+		}
+	}()
+	g.Register(c, "c", nil)
+	g.Register(c, "c", nil)
+}
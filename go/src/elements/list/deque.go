@@ -0,0 +1,95 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package list
+
+import "sync"
+
+// A Deque is a double-ended queue that is safe for concurrent use.
+// The zero Deque is empty and ready for use.
+//
+// 一把锁保护一个List: 两端的操作都只是几次指针赋值, 临界区很短.
+// 两端各用一把锁的做法在只剩一两个元素时两端会碰到同一个节点, 反而更复杂
+type Deque struct {
+	mu sync.Mutex
+	l  List
+}
+
+// PushFront adds v at the front of the deque.
+func (d *Deque) PushFront(v interface{}) {
+	d.mu.Lock()
+	d.l.PushFront(v)
+	d.mu.Unlock()
+}
+
+// PushBack adds v at the back of the deque.
+func (d *Deque) PushBack(v interface{}) {
+	d.mu.Lock()
+	d.l.PushBack(v)
+	d.mu.Unlock()
+}
+
+// PopFront removes and returns the value at the front of the deque.
+// The ok result is false if the deque is empty.
+func (d *Deque) PopFront() (v interface{}, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e := d.l.Front()
+	if e == nil {
+		return nil, false
+	}
+	return d.l.Remove(e), true
+}
+
+// PopBack removes and returns the value at the back of the deque.
+// The ok result is false if the deque is empty.
+func (d *Deque) PopBack() (v interface{}, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	e := d.l.Back()
+	if e == nil {
+		return nil, false
+	}
+	return d.l.Remove(e), true
+}
+
+// Front returns the value at the front of the deque without removing it.
+func (d *Deque) Front() (v interface{}, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e := d.l.Front(); e != nil {
+		return e.Value, true
+	}
+	return nil, false
+}
+
+// Back returns the value at the back of the deque without removing it.
+func (d *Deque) Back() (v interface{}, ok bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if e := d.l.Back(); e != nil {
+		return e.Value, true
+	}
+	return nil, false
+}
+
+// Len returns the number of values in the deque.
+func (d *Deque) Len() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.l.Len()
+}
+
+// Range calls f for each value from front to back while holding the
+// deque's lock, stopping if f returns false. f must not call methods
+// of d.
+func (d *Deque) Range(f func(v interface{}) bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for e := d.l.Front(); e != nil; e = e.Next() {
+		if !f(e.Value) {
+			return
+		}
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package list_test
+
+import (
+	"elements/list"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestDeque(t *testing.T) {
+	var d list.Deque
+	d.PushBack(2)
+	d.PushFront(1)
+	d.PushBack(3)
+	if v, _ := d.Front(); v != 1 {
+		t.Errorf("Front = %v, want 1", v)
+	}
+	if v, _ := d.Back(); v != 3 {
+		t.Errorf("Back = %v, want 3", v)
+	}
+	var got []interface{}
+	d.Range(func(v interface{}) bool { got = append(got, v); return true })
+	if len(got) != 3 || got[0] != 1 || got[2] != 3 {
+		t.Errorf("Range = %v", got)
+	}
+	if v, ok := d.PopBack(); !ok || v != 3 {
+		t.Errorf("PopBack = %v, %v", v, ok)
+	}
+	if v, ok := d.PopFront(); !ok || v != 1 {
+		t.Errorf("PopFront = %v, %v", v, ok)
+	}
+	if v, ok := d.PopFront(); !ok || v != 2 {
+		t.Errorf("PopFront = %v, %v", v, ok)
+	}
+	if _, ok := d.PopBack(); ok || d.Len() != 0 {
+		t.Error("deque not empty")
+	}
+}
+
+func TestDequeConcurrent(t *testing.T) {
+	const n = 10000
+	var d list.Deque
+	var wg sync.WaitGroup
+	var popped int64
+	for g := 0; g < 4; g++ {
+		wg.Add(2)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				if i%2 == 0 {
+					d.PushFront(i)
+				} else {
+					d.PushBack(i)
+				}
+			}
+		}(g)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < n; {
+				var ok bool
+				if g%2 == 0 {
+					_, ok = d.PopFront()
+				} else {
+					_, ok = d.PopBack()
+				}
+				if ok {
+					atomic.AddInt64(&popped, 1)
+					i++
+				} else {
+					runtime.Gosched()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if popped != 4*n || d.Len() != 0 {
+		t.Errorf("popped %d, %d left", popped, d.Len())
+	}
+}
+
+func BenchmarkDeque(b *testing.B) {
+	var d list.Deque
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			d.PushBack(1)
+			d.PopFront()
+		}
+	})
+}
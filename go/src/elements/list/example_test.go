@@ -0,0 +1,63 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package list_test
+
+import (
+	"elements/list"
+	"fmt"
+)
+
+// lru is a fixed-size cache that evicts the least recently used key.
+type lru struct {
+	size  int
+	order list.List // front is the most recently used
+	items map[string]*list.Element
+}
+
+type lruEntry struct {
+	key   string
+	value int
+}
+
+func (c *lru) Get(key string) (int, bool) {
+	e, ok := c.items[key]
+	if !ok {
+		return 0, false
+	}
+	c.order.MoveToFront(e)
+	return e.Value.(*lruEntry).value, true
+}
+
+func (c *lru) Put(key string, value int) {
+	if e, ok := c.items[key]; ok {
+		e.Value.(*lruEntry).value = value
+		c.order.MoveToFront(e)
+		return
+	}
+	c.items[key] = c.order.PushFront(&lruEntry{key, value})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// An LRU cache keeps a List in order of use and a map from key to Element,
+// so that both lookup and moving an entry to the front are O(1).
+func Example_lru() {
+	c := &lru{size: 2, items: make(map[string]*list.Element)}
+	c.Put("a", 1)
+	c.Put("b", 2)
+	c.Get("a") // a is now the most recently used
+	c.Put("c", 3)
+	for _, k := range []string{"a", "b", "c"} {
+		v, ok := c.Get(k)
+		fmt.Println(k, v, ok)
+	}
+	// Output:
+	// a 1 true
+	// b 0 false
+	// c 3 true
+}
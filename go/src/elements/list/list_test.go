@@ -0,0 +1,160 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package list_test
+
+import (
+	"elements/list"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+)
+
+// values returns the values of l from front to back, checking that
+// walking back to front gives the same values.
+func values(t *testing.T, l *list.List) []int {
+	t.Helper()
+	var fwd, back []int
+	for e := l.Front(); e != nil; e = e.Next() {
+		fwd = append(fwd, e.Value.(int))
+	}
+	for e := l.Back(); e != nil; e = e.Prev() {
+		back = append([]int{e.Value.(int)}, back...)
+	}
+	if !reflect.DeepEqual(fwd, back) || len(fwd) != l.Len() {
+		t.Fatalf("front to back %v, back to front %v, Len %d", fwd, back, l.Len())
+	}
+	return fwd
+}
+
+// listOps applies a random sequence of operations to a List and to a
+// slice and reports whether they agree after each one.
+type listOps []uint8
+
+func (ops listOps) run(t *testing.T, seed int64) bool {
+	rnd := rand.New(rand.NewSource(seed))
+	var l list.List // 零值可以直接使用
+	var model []int
+	var elems []*list.Element // 与model一一对应
+	next := 0
+	for _, op := range ops {
+		next++
+		i := 0
+		if len(model) > 0 {
+			i = rnd.Intn(len(model))
+		}
+		j := 0
+		if len(model) > 0 {
+			j = rnd.Intn(len(model))
+		}
+		switch op % 8 {
+		case 0:
+			elems = append([]*list.Element{l.PushFront(next)}, elems...)
+			model = append([]int{next}, model...)
+		case 1:
+			elems = append(elems, l.PushBack(next))
+			model = append(model, next)
+		case 2:
+			if len(model) == 0 {
+				continue
+			}
+			l.Remove(elems[i])
+			elems = append(elems[:i], elems[i+1:]...)
+			model = append(model[:i], model[i+1:]...)
+		case 3:
+			if len(model) == 0 {
+				continue
+			}
+			e := l.InsertBefore(next, elems[i])
+			elems = append(elems[:i], append([]*list.Element{e}, elems[i:]...)...)
+			model = append(model[:i], append([]int{next}, model[i:]...)...)
+		case 4:
+			if len(model) == 0 {
+				continue
+			}
+			e := l.InsertAfter(next, elems[i])
+			elems = append(elems[:i+1], append([]*list.Element{e}, elems[i+1:]...)...)
+			model = append(model[:i+1], append([]int{next}, model[i+1:]...)...)
+		case 5:
+			if len(model) == 0 {
+				continue
+			}
+			l.MoveToFront(elems[i])
+			e, v := elems[i], model[i]
+			elems = append([]*list.Element{e}, append(elems[:i:i], elems[i+1:]...)...)
+			model = append([]int{v}, append(model[:i:i], model[i+1:]...)...)
+		case 6:
+			if len(model) == 0 {
+				continue
+			}
+			l.MoveToBack(elems[i])
+			e, v := elems[i], model[i]
+			elems = append(append(elems[:i:i], elems[i+1:]...), e)
+			model = append(append(model[:i:i], model[i+1:]...), v)
+		case 7:
+			if len(model) == 0 || i == j {
+				continue
+			}
+			// MoveAfter(e, mark): 先从model中拿掉e, 再放到mark后面
+			e, mark, v := elems[i], elems[j], model[i]
+			l.MoveAfter(e, mark)
+			elems = append(elems[:i:i], elems[i+1:]...)
+			model = append(model[:i:i], model[i+1:]...)
+			k := 0
+			for elems[k] != mark {
+				k++
+			}
+			elems = append(elems[:k+1], append([]*list.Element{e}, elems[k+1:]...)...)
+			model = append(model[:k+1], append([]int{v}, model[k+1:]...)...)
+		}
+		got := values(t, &l)
+		if len(got) != len(model) || (len(got) > 0 && !reflect.DeepEqual(got, model)) {
+			t.Logf("after op %d: list %v, model %v", op%8, got, model)
+			return false
+		}
+	}
+	return true
+}
+
+func TestListModel(t *testing.T) {
+	f := func(ops listOps, seed int64) bool { return ops.run(t, seed) }
+	if err := quick.Check(f, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestForeignElement(t *testing.T) {
+	// 别的链表的元素不会破坏这个链表
+	l1, l2 := list.New(), list.New()
+	l1.PushBack(1)
+	e := l2.PushBack(2)
+	l1.Remove(e)
+	l1.MoveToFront(e)
+	if l1.InsertBefore(3, e) != nil || l1.InsertAfter(3, e) != nil {
+		t.Error("insert next to a foreign mark succeeded")
+	}
+	if got := values(t, l1); !reflect.DeepEqual(got, []int{1}) {
+		t.Errorf("l1 = %v, want [1]", got)
+	}
+	if got := values(t, l2); !reflect.DeepEqual(got, []int{2}) {
+		t.Errorf("l2 = %v, want [2]", got)
+	}
+	// 删除之后的元素不再属于任何链表
+	l2.Remove(e)
+	if e.Next() != nil || e.Prev() != nil || l2.Len() != 0 {
+		t.Error("removed element still linked")
+	}
+}
+
+func TestPushListSelf(t *testing.T) {
+	l := list.New()
+	l.PushBack(1)
+	l.PushBack(2)
+	l.PushBackList(l)
+	l.PushFrontList(l)
+	if got := values(t, l); !reflect.DeepEqual(got, []int{1, 2, 1, 2, 1, 2, 1, 2}) {
+		t.Errorf("l = %v", got)
+	}
+}
@@ -0,0 +1,153 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package list
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A StealDeque is a lock-free, unbounded work-stealing deque, after Chase
+// and Lev, "Dynamic Circular Work-Stealing Deque" (SPAA 2005).
+//
+// One goroutine, the owner, calls PushBottom and PopBottom and uses the
+// deque as a stack. Any number of other goroutines call Steal to take the
+// oldest value from the top. This is the shape of a scheduler's run queue:
+// the runtime's per-P run queues and sync.Pool's poolDequeue are bounded
+// variants of the same idea.
+//
+// The zero StealDeque is empty and ready for use.
+//
+// 链表不适合无锁的双端队列: 从两端删除要同时修改相邻两个节点的指针,
+// 而CAS一次只能修改一个字. 这里用环形数组, 两端各是一个下标, 只需要对top做CAS
+type StealDeque struct {
+	// top is the index of the oldest value. Thieves advance it with a CAS;
+	// the owner only CASes it when it competes for the last value.
+	top int64
+	// bottom is the index one past the newest value. Only the owner
+	// writes it.
+	bottom int64
+
+	buf unsafe.Pointer // *stealRing
+}
+
+// A stealRing is a circular array of values. Index i lives in slot
+// i&mask, so top and bottom grow without wrapping.
+type stealRing struct {
+	mask  int64
+	slots []unsafe.Pointer // *interface{}
+}
+
+func newStealRing(size int64) *stealRing {
+	return &stealRing{mask: size - 1, slots: make([]unsafe.Pointer, size)}
+}
+
+func (r *stealRing) get(i int64) *interface{} {
+	return (*interface{})(atomic.LoadPointer(&r.slots[i&r.mask]))
+}
+
+func (r *stealRing) put(i int64, v *interface{}) {
+	atomic.StorePointer(&r.slots[i&r.mask], unsafe.Pointer(v))
+}
+
+// grow returns a ring twice the size of r holding the values in [t, b).
+func (r *stealRing) grow(t, b int64) *stealRing {
+	n := newStealRing(2 * (r.mask + 1))
+	for i := t; i < b; i++ {
+		n.put(i, r.get(i))
+	}
+	return n
+}
+
+func (d *StealDeque) ring() *stealRing {
+	r := (*stealRing)(atomic.LoadPointer(&d.buf))
+	if r == nil {
+		// 只有所有者会走到这里: 窃取者看到top < bottom时, 所有者一定已经分配过
+		r = newStealRing(32)
+		atomic.StorePointer(&d.buf, unsafe.Pointer(r))
+	}
+	return r
+}
+
+// PushBottom adds v at the bottom of the deque. It must only be called by
+// the owner.
+func (d *StealDeque) PushBottom(v interface{}) {
+	b := atomic.LoadInt64(&d.bottom)
+	t := atomic.LoadInt64(&d.top)
+	r := d.ring()
+	if b-t > r.mask {
+		// 满了就换一个两倍大的环. 窃取者可能还在读旧的环: 旧环中[t, b)的内容
+		// 没有改变, 从旧环读到的值和新环中的一样, 旧环之后由GC回收
+		r = r.grow(t, b)
+		atomic.StorePointer(&d.buf, unsafe.Pointer(r))
+	}
+	r.put(b, &v)
+	// 先写入值, 再发布bottom: 窃取者看到新的bottom时一定能读到这个值
+	atomic.StoreInt64(&d.bottom, b+1)
+}
+
+// PopBottom removes and returns the newest value. It must only be called
+// by the owner. The ok result is false if the deque is empty.
+func (d *StealDeque) PopBottom() (v interface{}, ok bool) {
+	b := atomic.LoadInt64(&d.bottom) - 1
+	r := (*stealRing)(atomic.LoadPointer(&d.buf))
+	if r == nil {
+		return nil, false
+	}
+	// 先把bottom减一"预订"最后一个值, 再读top. 之后开始的Steal看到的bottom
+	// 已经不包括它了; 已经开始的Steal和我们在下面的CAS中竞争
+	atomic.StoreInt64(&d.bottom, b)
+	t := atomic.LoadInt64(&d.top)
+	if t > b {
+		// Empty. Restore bottom.
+		atomic.StoreInt64(&d.bottom, b+1)
+		return nil, false
+	}
+	p := r.get(b)
+	if t == b {
+		// 只剩最后一个值, 可能有窃取者也在取它: 和它们一样对top做CAS, 谁成功归谁
+		if !atomic.CompareAndSwapInt64(&d.top, t, t+1) {
+			p = nil
+		}
+		atomic.StoreInt64(&d.bottom, b+1)
+		if p == nil {
+			return nil, false
+		}
+	}
+	// 清空槽位, 让取出的值可以被回收. 槽位b只有所有者会再写入
+	r.put(b, nil)
+	return *p, true
+}
+
+// Steal removes and returns the oldest value. It may be called by any
+// goroutine. The ok result is false if the deque is empty or if Steal
+// lost a race with another Steal or PopBottom, in which case the caller
+// may retry.
+func (d *StealDeque) Steal() (v interface{}, ok bool) {
+	t := atomic.LoadInt64(&d.top)
+	b := atomic.LoadInt64(&d.bottom)
+	if t >= b {
+		return nil, false
+	}
+	r := (*stealRing)(atomic.LoadPointer(&d.buf))
+	// 先读值再CAS: CAS成功说明读的时候top还是t, 槽位t中的值还没有被别人取走,
+	// 也没有被所有者覆盖(覆盖槽位t需要bottom先超过t+容量, 而那时环已经换了)
+	p := r.get(t)
+	if !atomic.CompareAndSwapInt64(&d.top, t, t+1) {
+		return nil, false
+	}
+	return *p, true
+}
+
+// Len returns the number of values in the deque. It is only a snapshot
+// when other goroutines are using the deque.
+func (d *StealDeque) Len() int {
+	b := atomic.LoadInt64(&d.bottom)
+	t := atomic.LoadInt64(&d.top)
+	if b < t {
+		return 0
+	}
+	return int(b - t)
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package list_test
+
+import (
+	"elements/list"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestStealDequeOwner(t *testing.T) {
+	var d list.StealDeque
+	if _, ok := d.PopBottom(); ok {
+		t.Fatal("PopBottom on empty deque succeeded")
+	}
+	// 超过初始容量, 触发扩容
+	for i := 0; i < 100; i++ {
+		d.PushBottom(i)
+	}
+	if v, ok := d.Steal(); !ok || v != 0 {
+		t.Errorf("Steal = %v, %v, want 0, true", v, ok)
+	}
+	for i := 99; i > 0; i-- {
+		if v, ok := d.PopBottom(); !ok || v != i {
+			t.Fatalf("PopBottom = %v, %v, want %d, true", v, ok, i)
+		}
+	}
+	if _, ok := d.PopBottom(); ok || d.Len() != 0 {
+		t.Error("deque not empty")
+	}
+}
+
+func TestStealDequeConcurrent(t *testing.T) {
+	const n = 100000
+	const thieves = 4
+	var d list.StealDeque
+	taken := make([]int32, n)
+	var done int32
+	var wg sync.WaitGroup
+	for i := 0; i < thieves; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for atomic.LoadInt32(&done) == 0 || d.Len() > 0 {
+				if v, ok := d.Steal(); ok {
+					atomic.AddInt32(&taken[v.(int)], 1)
+				} else {
+					runtime.Gosched()
+				}
+			}
+		}()
+	}
+	// 所有者交替放入和取出, 经常和窃取者争抢最后一个值
+	for i := 0; i < n; i++ {
+		d.PushBottom(i)
+		if i%3 == 0 {
+			if v, ok := d.PopBottom(); ok {
+				atomic.AddInt32(&taken[v.(int)], 1)
+			}
+		}
+	}
+	for {
+		v, ok := d.PopBottom()
+		if !ok {
+			break
+		}
+		atomic.AddInt32(&taken[v.(int)], 1)
+	}
+	atomic.StoreInt32(&done, 1)
+	wg.Wait()
+	for i, c := range taken {
+		if c != 1 {
+			t.Fatalf("value %d taken %d times", i, c)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mapmodel_test
+
+import (
+	"elements/mapmodel"
+	"testing"
+)
+
+const benchKeys = 1 << 12
+
+func BenchmarkLoad(b *testing.B) {
+	b.Run("builtin", func(b *testing.B) {
+		m := make(map[interface{}]interface{})
+		for k := 0; k < benchKeys; k++ {
+			m[k] = k
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			_ = m[i&(benchKeys-1)]
+		}
+	})
+	b.Run("model", func(b *testing.B) {
+		m := mapmodel.New(0, nil)
+		for k := 0; k < benchKeys; k++ {
+			m.Store(k, k)
+		}
+		b.ResetTimer()
+		for i := 0; i < b.N; i++ {
+			m.Load(i & (benchKeys - 1))
+		}
+	})
+}
+
+// BenchmarkGrow inserts benchKeys keys into an empty map, so every
+// growth from one bucket up to 1<<10 buckets is in the measurement.
+func BenchmarkGrow(b *testing.B) {
+	b.Run("builtin", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			m := make(map[interface{}]interface{})
+			for k := 0; k < benchKeys; k++ {
+				m[k] = k
+			}
+		}
+	})
+	b.Run("model", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			m := mapmodel.New(0, nil)
+			for k := 0; k < benchKeys; k++ {
+				m.Store(k, k)
+			}
+		}
+	})
+}
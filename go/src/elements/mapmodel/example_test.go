@@ -0,0 +1,62 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mapmodel_test
+
+import (
+	"elements/mapmodel"
+	"fmt"
+)
+
+// mixHasher spreads int keys with a multiplicative hash, so the example
+// places keys in the same buckets on every run.
+type mixHasher struct{}
+
+func (mixHasher) Hash(key interface{}) uint64 {
+	return uint64(key.(int)) * 0x9E3779B97F4A7C15
+}
+
+// This example watches a map grow. Growth starts when an insert would
+// push the average bucket past 6.5 entries. Each later write then moves
+// the old bucket its key hashes to and the next one not yet moved, so
+// Evacuated sometimes jumps past buckets a write already moved.
+func ExampleMap_Stats() {
+	m := mapmodel.New(0, mixHasher{})
+	for k := 0; k < 105; k++ {
+		m.Store(k, k)
+	}
+	fmt.Printf("%+v\n", m.Stats())
+	for k := 105; m.Stats().Growing; k++ {
+		m.Store(k, k)
+		fmt.Printf("%+v\n", m.Stats())
+	}
+	// Output:
+	// {Count:105 B:5 Overflow:0 Growing:true SameSizeGrow:false Evacuated:1}
+	// {Count:106 B:5 Overflow:0 Growing:true SameSizeGrow:false Evacuated:2}
+	// {Count:107 B:5 Overflow:0 Growing:true SameSizeGrow:false Evacuated:4}
+	// {Count:108 B:5 Overflow:0 Growing:true SameSizeGrow:false Evacuated:5}
+	// {Count:109 B:5 Overflow:0 Growing:true SameSizeGrow:false Evacuated:6}
+	// {Count:110 B:5 Overflow:0 Growing:true SameSizeGrow:false Evacuated:9}
+	// {Count:111 B:5 Overflow:0 Growing:true SameSizeGrow:false Evacuated:10}
+	// {Count:112 B:5 Overflow:0 Growing:true SameSizeGrow:false Evacuated:14}
+	// {Count:113 B:5 Overflow:0 Growing:true SameSizeGrow:false Evacuated:15}
+	// {Count:114 B:5 Overflow:0 Growing:false SameSizeGrow:false Evacuated:16}
+}
+
+func ExampleIter() {
+	m := mapmodel.New(0, nil)
+	m.Store("a", 1)
+	m.Store("b", 2)
+	n := 0
+	for it := m.Iter(); it.Next(); {
+		n++
+		// 迭代中可以修改map, 包括删除还没有返回的key.
+		// 从哪个key开始是随机的, 但另一个key不会再返回
+		m.Delete("a")
+		m.Delete("b")
+	}
+	fmt.Println(n, m.Len())
+	// Output:
+	// 1 0
+}
@@ -0,0 +1,251 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mapmodel
+
+import "math/rand"
+
+// An Iter iterates over a Map like a for range loop does, with the same
+// guarantees: each entry that is neither deleted nor added during the
+// iteration is returned exactly once, an entry deleted before it is
+// reached is not returned, and an entry added during the iteration may
+// or may not be.
+//
+// The Map may be modified, including by this loop, between calls to
+// Next, and may grow while being iterated.
+//
+// 对应runtime的hiter. for range编译成mapiterinit加上循环中的mapiternext
+type Iter struct {
+	key  interface{}
+	elem interface{}
+	ok   bool // runtime中key为nil表示迭代结束, 模型中的key本身可以是nil
+
+	h           *Map
+	buckets     []bmap  // bucket ptr at hash_iter initialization time
+	bptr        *bmap   // current bucket
+	startBucket uintptr // bucket iteration started at
+	offset      uint8   // intra-bucket offset to start from during iteration (should be big enough to hold bucketCnt-1)
+	wrapped     bool    // already wrapped around from end of bucket array to beginning
+	logB        uint8
+	i           uint8
+	bucket      uintptr
+	checkBucket uintptr
+}
+
+// Iter returns an iterator positioned before the first entry.
+//
+// 对应mapiterinit, 但不调用mapiternext, 第一个entry由第一次Next返回
+func (h *Map) Iter() *Iter {
+	it := new(Iter)
+	if h == nil || h.count == 0 {
+		return it
+	}
+
+	it.h = h
+
+	// grab snapshot of bucket state
+	//
+	// 迭代的是开始时的桶数组. 之后即使开始扩容, 迭代器也还在这个数组上,
+	// 遇到已经搬走的槽再去当前的表中查找
+	it.logB = h.logB
+	it.buckets = h.buckets
+
+	// decide where to start
+	//
+	// 起始的桶和桶内的起始位置都是随机的. 这是为了让程序不能依赖遍历顺序:
+	// 如果顺序总是插入顺序或者哈希顺序, 迟早会有代码依赖它, map的实现就再也不能修改
+	r := uintptr(rand.Uint32())
+	if h.logB > 31-bucketCntBits {
+		r += uintptr(rand.Uint32()) << 31
+	}
+	it.startBucket = r & bucketMask(h.logB)
+	it.offset = uint8(r >> h.logB & (bucketCnt - 1))
+
+	// iterator state
+	it.bucket = it.startBucket
+
+	// Remember we have an iterator.
+	// Can run concurrently with another mapiterinit().
+	//
+	// 从此以后evacuate不再清空旧桶的key和elem, 迭代器可能还要读它们.
+	// 这两个标志只在扩容开始和mapclear时重置
+	h.flags |= iterator | oldIterator
+	return it
+}
+
+// Next advances the iterator to the next entry and reports whether there
+// was one.
+func (it *Iter) Next() bool {
+	it.key, it.elem, it.ok = nil, nil, false
+	h := it.h
+	if h == nil {
+		return false
+	}
+	if h.flags&hashWriting != 0 {
+		panic("concurrent map iteration and map write")
+	}
+	bucket := it.bucket
+	b := it.bptr
+	i := it.i
+	checkBucket := it.checkBucket
+
+next:
+	if b == nil {
+		if bucket == it.startBucket && it.wrapped {
+			// 转了一圈回到起点, 结束
+			it.h = nil
+			return false
+		}
+		if h.growing() && it.logB == h.logB {
+			// Iterator was started in the middle of a grow, and the grow isn't done yet.
+			// If the bucket we're looking at hasn't been filled in yet (i.e. the old
+			// bucket hasn't been evacuated) then we need to iterate through the old
+			// bucket and only return the ones that will be migrated to this bucket.
+			oldbucket := bucket & h.oldbucketmask()
+			b = &h.oldbuckets[oldbucket]
+			if !evacuated(b) {
+				checkBucket = bucket
+			} else {
+				b = &it.buckets[bucket]
+				checkBucket = noCheck
+			}
+		} else {
+			b = &it.buckets[bucket]
+			checkBucket = noCheck
+		}
+		bucket++
+		if bucket == bucketShift(it.logB) {
+			bucket = 0
+			it.wrapped = true
+		}
+		i = 0
+	}
+	for ; i < bucketCnt; i++ {
+		offi := (i + it.offset) & (bucketCnt - 1)
+		if isEmpty(b.tophash[offi]) || b.tophash[offi] == evacuatedEmpty {
+			// TODO: emptyRest is hard to use here, as we start iterating
+			// in the middle of a bucket. It's feasible, just tricky.
+			continue
+		}
+		k := b.keys[offi]
+		e := b.elems[offi]
+		if checkBucket != noCheck && !h.sameSizeGrow() {
+			// Special case: iterator was started during a grow to a larger size
+			// and the grow is not done yet. We're working on a bucket whose
+			// oldbucket has not been evacuated yet. Or at least, it wasn't
+			// evacuated when we started the bucket. So we're iterating
+			// through the oldbucket, skipping any keys that will go
+			// to the other new bucket (each oldbucket expands to two
+			// buckets during a grow).
+			//
+			// 旧桶oldbucket对应新桶oldbucket和oldbucket+newbit, 两个新桶都会
+			// 来读这个旧桶, 各自只取属于自己的一半, 否则每个key会返回两次
+			if k == k {
+				// If the item in the oldbucket is not destined for
+				// the current new bucket in the iteration, skip it.
+				hash := h.hash(k)
+				if uintptr(hash)&bucketMask(it.logB) != checkBucket {
+					continue
+				}
+			} else {
+				// Hash isn't repeatable if k != k (NaNs).  We need a
+				// repeatable and randomish choice of which direction
+				// to send NaNs during evacuation. We'll use the low
+				// bit of tophash to decide which way NaNs go.
+				// NOTE: this case is why we need two evacuate tophash
+				// values, evacuatedX and evacuatedY, that differ in
+				// their low bit.
+				if checkBucket>>(it.logB-1) != uintptr(b.tophash[offi]&1) {
+					continue
+				}
+			}
+		}
+		if (b.tophash[offi] != evacuatedX && b.tophash[offi] != evacuatedY) || k != k {
+			// This is the golden data, we can return it.
+			// OR
+			// key!=key, so the entry can't be deleted or updated, so we can just return it.
+			// That's lucky for us because when key!=key we can't look it up successfully.
+			it.key = k
+			it.elem = e
+		} else {
+			// The hash table has grown since the iterator was started.
+			// The golden data for this key is now somewhere else.
+			// Check the current hash table for the data.
+			// This code handles the case where the key
+			// has been deleted, updated, or deleted and reinserted.
+			// NOTE: we need to regrab the key as it has been updated.
+			rk, re, ok := h.accessK(k)
+			if !ok {
+				continue // key has been deleted
+			}
+			it.key = rk
+			it.elem = re
+		}
+		it.ok = true
+		it.bucket = bucket
+		it.bptr = b
+		it.i = i + 1
+		it.checkBucket = checkBucket
+		return true
+	}
+	b = b.overflow
+	i = 0
+	goto next
+}
+
+// Key returns the key of the entry returned by the last call to Next.
+func (it *Iter) Key() interface{} {
+	return it.key
+}
+
+// Value returns the value of the entry returned by the last call to Next.
+func (it *Iter) Value() interface{} {
+	return it.elem
+}
+
+// Range calls f for each entry in the map, like a for range loop, until
+// f returns false.
+func (h *Map) Range(f func(key, value interface{}) bool) {
+	for it := h.Iter(); it.Next(); {
+		if !f(it.Key(), it.Value()) {
+			break
+		}
+	}
+}
+
+// returns both key and elem. Used by map iterator
+func (h *Map) accessK(key interface{}) (interface{}, interface{}, bool) {
+	if h == nil || h.count == 0 {
+		return nil, nil, false
+	}
+	hash := h.hash(key)
+	m := bucketMask(h.logB)
+	b := &h.buckets[uintptr(hash)&m]
+	if c := h.oldbuckets; c != nil {
+		if !h.sameSizeGrow() {
+			// There used to be half as many buckets; mask down one more power of two.
+			m >>= 1
+		}
+		oldb := &c[uintptr(hash)&m]
+		if !evacuated(oldb) {
+			b = oldb
+		}
+	}
+	top := tophash(hash)
+bucketloop:
+	for ; b != nil; b = b.overflow {
+		for i := uintptr(0); i < bucketCnt; i++ {
+			if b.tophash[i] != top {
+				if b.tophash[i] == emptyRest {
+					break bucketloop
+				}
+				continue
+			}
+			if b.keys[i] == key {
+				return b.keys[i], b.elems[i], true
+			}
+		}
+	}
+	return nil, nil, false
+}
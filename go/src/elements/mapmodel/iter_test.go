@@ -0,0 +1,263 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mapmodel_test
+
+import (
+	"elements/mapmodel"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// iterChecker runs one iteration over m while mutating m between calls
+// to Next, and checks the guarantees of the Go spec for range over maps:
+//
+//   - an entry present for the whole iteration is returned exactly once;
+//   - an entry removed before it is reached is not returned;
+//   - an entry added during the iteration is returned at most once;
+//   - a returned value is the entry's value at the time it is returned.
+//
+// Deleted keys are never reinserted, because a reinserted key may or may
+// not be returned again.
+type iterChecker struct {
+	t     *testing.T
+	r     *rand.Rand
+	m     *mapmodel.Map
+	want  map[int]int // what m holds now
+	old   []int       // keys present when the iteration started
+	gone  map[int]bool
+	next  int // next fresh key
+	grows int // growths started during the iteration
+}
+
+func newIterChecker(t *testing.T, seed int64, m *mapmodel.Map, n int) *iterChecker {
+	c := &iterChecker{
+		t:    t,
+		r:    rand.New(rand.NewSource(seed)),
+		m:    m,
+		want: make(map[int]int),
+		gone: make(map[int]bool),
+	}
+	for ; c.next < n; c.next++ {
+		c.store(c.next, c.next)
+	}
+	return c
+}
+
+func (c *iterChecker) store(k, v int) {
+	before := c.m.Stats()
+	c.m.Store(k, v)
+	if after := c.m.Stats(); after.Growing && (!before.Growing || after.B != before.B) {
+		c.grows++
+	}
+	c.want[k] = v
+}
+
+// mutate makes a few random writes: it adds fresh keys, updates keys that
+// were present at the start, and deletes some of them.
+func (c *iterChecker) mutate(adds int) {
+	for i := 0; i < adds; i++ {
+		c.store(c.next, c.next)
+		c.next++
+	}
+	if len(c.old) == 0 {
+		return
+	}
+	k := c.old[c.r.Intn(len(c.old))]
+	if c.gone[k] {
+		return
+	}
+	switch c.r.Intn(3) {
+	case 0:
+		c.m.Delete(k)
+		delete(c.want, k)
+		c.gone[k] = true
+	case 1:
+		c.store(k, -k)
+	}
+}
+
+// run iterates over m, calling mutate with adds fresh keys after each
+// entry, and reports the number of entries returned.
+func (c *iterChecker) run(adds int) int {
+	c.old = c.old[:0]
+	for k := range c.want {
+		c.old = append(c.old, k)
+	}
+	seen := make(map[int]bool)
+	for it := c.m.Iter(); it.Next(); {
+		k, v := it.Key().(int), it.Value().(int)
+		if seen[k] {
+			c.t.Fatalf("key %d returned twice", k)
+		}
+		seen[k] = true
+		if c.gone[k] {
+			c.t.Fatalf("key %d returned after it was deleted", k)
+		}
+		if v != c.want[k] {
+			c.t.Fatalf("key %d returned with value %d; want %d", k, v, c.want[k])
+		}
+		c.mutate(adds)
+	}
+	for _, k := range c.old {
+		if !c.gone[k] && !seen[k] {
+			c.t.Fatalf("key %d present throughout the iteration was not returned", k)
+		}
+	}
+	c.check()
+	return len(seen)
+}
+
+// check compares m with want after the iteration.
+func (c *iterChecker) check() {
+	if c.m.Len() != len(c.want) {
+		c.t.Fatalf("Len() = %d; want %d", c.m.Len(), len(c.want))
+	}
+	for k, v := range c.want {
+		if got, ok := c.m.Load(k); !ok || got != v {
+			c.t.Fatalf("Load(%d) = %v, %v; want %d, true", k, got, ok, v)
+		}
+	}
+}
+
+func TestIterGrowDuringIteration(t *testing.T) {
+	// 迭代开始时没有在扩容. 52个元素正好填满8个桶, 迭代中的第一次写入就开始扩容,
+	// 之后还会再扩容几次. 迭代器一直在开始时的桶数组上, 遇到已经搬走的槽去新表中查找
+	grows := 0
+	for seed := int64(0); seed < 200; seed++ {
+		c := newIterChecker(t, seed, mapmodel.New(0, nil), 52)
+		for c.m.Stats().Growing {
+			c.m.Store(0, 0)
+		}
+		c.run(3)
+		grows += c.grows
+	}
+	if grows < 200 {
+		t.Errorf("only %d growths during 200 iterations; the test is not testing growth", grows)
+	}
+}
+
+func TestIterStartedDuringGrowth(t *testing.T) {
+	// 迭代开始时扩容已经在进行中, 旧桶还没有全部搬走: 迭代器在新的桶数组上,
+	// 没搬走的桶要去旧桶中读, 并跳过会搬到另一个新桶的key(checkBucket)
+	for seed := int64(0); seed < 200; seed++ {
+		// B=4有16个旧桶, 第105个元素开始扩容到B=5, 每次写入最多搬两个
+		c := newIterChecker(t, seed, mapmodel.New(0, nil), 105)
+		if s := c.m.Stats(); !s.Growing || s.B != 5 || s.Evacuated >= 16 {
+			t.Fatalf("before iterating: %+v; want growth to B 5 in progress", s)
+		}
+		c.run(1)
+	}
+}
+
+func TestIterNoWrites(t *testing.T) {
+	// 迭代中只删除和修改, 不增加元素, 扩容进行到一半时开始
+	for seed := int64(0); seed < 200; seed++ {
+		c := newIterChecker(t, seed, mapmodel.New(0, nil), 105)
+		c.run(0)
+	}
+}
+
+func TestIterSameSizeGrowth(t *testing.T) {
+	// 所有key都在桶0, 溢出链很长, 迭代中同时发生翻倍扩容和等量扩容
+	for seed := int64(0); seed < 50; seed++ {
+		c := newIterChecker(t, seed, mapmodel.New(0, shiftHasher(8)), 40)
+		c.run(2)
+		c.run(0)
+	}
+}
+
+func TestIterManyIterators(t *testing.T) {
+	// 多个迭代器交替前进, 期间表扩容了几次. 每个迭代器都返回开始时的每个key一次
+	r := rand.New(rand.NewSource(1))
+	m := mapmodel.New(0, nil)
+	for k := 0; k < 30; k++ {
+		m.Store(k, k)
+	}
+	its := make([]*mapmodel.Iter, 4)
+	seen := make([]map[int]bool, len(its))
+	for i := range its {
+		its[i] = m.Iter()
+		seen[i] = make(map[int]bool)
+	}
+	next := 30
+	for live := len(its); live > 0; {
+		i := r.Intn(len(its))
+		if its[i] == nil {
+			continue
+		}
+		if !its[i].Next() {
+			its[i] = nil
+			live--
+			continue
+		}
+		k := its[i].Key().(int)
+		if seen[i][k] {
+			t.Fatalf("iterator %d returned %d twice", i, k)
+		}
+		seen[i][k] = true
+		m.Store(next, next)
+		next++
+	}
+	for i := range seen {
+		for k := 0; k < 30; k++ {
+			if !seen[i][k] {
+				t.Errorf("iterator %d did not return %d", i, k)
+			}
+		}
+	}
+}
+
+func TestIterNaN(t *testing.T) {
+	// NaN的哈希每次都不同, 无法决定它搬到哪个新桶, 也无法用它查找.
+	// 迭代中扩容时用tophash的最低位决定方向, 迭代器用同一位跳过另一半
+	for seed := int64(0); seed < 50; seed++ {
+		r := rand.New(rand.NewSource(seed))
+		m := mapmodel.New(0, nil)
+		// 有的迭代开始时正在扩容
+		n := 50 + int(seed)
+		for i := 0; i < n; i++ {
+			m.Store(math.NaN(), i)
+		}
+		next := n
+		seen := make(map[int]bool)
+		for it := m.Iter(); it.Next(); {
+			v := it.Value().(int)
+			if seen[v] {
+				t.Fatalf("NaN -> %d returned twice", v)
+			}
+			seen[v] = true
+			for i := r.Intn(4); i > 0; i-- {
+				m.Store(math.NaN(), next)
+				next++
+			}
+		}
+		for i := 0; i < n; i++ {
+			if !seen[i] {
+				t.Fatalf("NaN -> %d not returned", i)
+			}
+		}
+	}
+}
+
+func TestIterRandomStart(t *testing.T) {
+	// 每次迭代的起点是随机的, 连续两次迭代的顺序几乎总是不同
+	m := mapmodel.New(0, nil)
+	for k := 0; k < 20; k++ {
+		m.Store(k, k)
+	}
+	first := func() interface{} {
+		it := m.Iter()
+		it.Next()
+		return it.Key()
+	}
+	starts := make(map[interface{}]bool)
+	for i := 0; i < 100; i++ {
+		starts[first()] = true
+	}
+	if len(starts) < 5 {
+		t.Errorf("100 iterations started at only %d different keys", len(starts))
+	}
+}
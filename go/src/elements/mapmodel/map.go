@@ -0,0 +1,777 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package mapmodel is a userspace model of the runtime's map
+// implementation (runtime/map.go).
+//
+// A Map is a hash table of interface{} keys and values that follows hmap
+// field for field: an array of 2^B buckets of 8 slots, the top byte of
+// each key's hash kept in the bucket to skip most key comparisons,
+// chained overflow buckets, and growth that moves buckets to the new
+// array a couple at a time, on later writes, instead of all at once.
+// Iterators follow the runtime's too, including iterating while the map
+// grows underneath them.
+//
+// Like a built-in map, a Map is not safe for concurrent use, and the
+// same hashWriting flag catches some concurrent writes. Unlike one, it
+// hashes keys with a sync.Hasher, so tests can choose the hashes.
+package mapmodel
+
+import (
+	"math/rand"
+	"sync"
+)
+
+// This file contains the implementation of Go's map type.
+//
+// A map is just a hash table. The data is arranged
+// into an array of buckets. Each bucket contains up to
+// 8 key/elem pairs. The low-order bits of the hash are
+// used to select a bucket. Each bucket contains a few
+// high-order bits of each hash to distinguish the entries
+// within a single bucket.
+//
+// If more than 8 keys hash to a bucket, we chain on
+// extra buckets.
+//
+// When the hashtable grows, we allocate a new array
+// of buckets twice as big. Buckets are incrementally
+// copied from the old bucket array to the new bucket array.
+//
+// Map iterators walk through the array of buckets and
+// return the keys in walk order (bucket #, then overflow
+// chain order, then bucket index).  To maintain iteration
+// semantics, we never move keys within their bucket (if
+// we did, keys might be returned 0 or 2 times).  When
+// growing the table, iterators remain iterating through the
+// old table and must check the new table if the bucket
+// they are iterating through has been moved ("evacuated")
+// to the new table.
+
+const (
+	// Maximum number of key/elem pairs a bucket can hold.
+	bucketCntBits = 3
+	bucketCnt     = 1 << bucketCntBits
+
+	// Maximum average load of a bucket that triggers growth is 6.5.
+	// Represent as loadFactorNum/loadFactDen, to allow integer math.
+	//
+	// 6.5是在溢出桶的比例和每个元素的额外内存之间的折中, runtime/map.go开头
+	// 的表格列出了不同负载因子下的测量结果
+	loadFactorNum = 13
+	loadFactorDen = 2
+
+	// Possible tophash values. We reserve a few possibilities for special marks.
+	// Each bucket (including its overflow buckets, if any) will have either all or none of its
+	// entries in the evacuated* states (except during the evacuate() method, which only happens
+	// during map writes and thus no one else can observe the map during that time).
+	emptyRest      = 0 // this cell is empty, and there are no more non-empty cells at higher indexes or overflows.
+	emptyOne       = 1 // this cell is empty
+	evacuatedX     = 2 // key/elem is valid.  Entry has been evacuated to first half of larger table.
+	evacuatedY     = 3 // same as above, but evacuated to second half of larger table.
+	evacuatedEmpty = 4 // cell is empty, bucket is evacuated.
+	minTopHash     = 5 // minimum tophash for a normal filled cell.
+
+	// flags
+	iterator     = 1 // there may be an iterator using buckets
+	oldIterator  = 2 // there may be an iterator using oldbuckets
+	hashWriting  = 4 // a goroutine is writing to the map
+	sameSizeGrow = 8 // the current map growth is to a new map of the same size
+
+	// sentinel bucket ID for iterator checks
+	noCheck = ^uintptr(0)
+)
+
+// isEmpty reports whether the given tophash array entry represents an empty bucket entry.
+func isEmpty(x uint8) bool {
+	return x <= emptyOne
+}
+
+// A Map is a hash map modeled on the runtime's hmap. The zero Map is not
+// usable; use New.
+type Map struct {
+	count     int // # live cells == size of map.
+	flags     uint8
+	logB      uint8  // log_2 of # of buckets (can hold up to loadFactor * 2^B items), B in hmap
+	noverflow uint16 // approximate number of overflow buckets; see incrnoverflow for details
+
+	buckets    []bmap  // array of 2^B Buckets. may be nil if count==0.
+	oldbuckets []bmap  // previous bucket array of half the size, non-nil only when growing
+	nevacuate  uintptr // progress counter for evacuation (buckets less than this have been evacuated)
+
+	// nextOverflow holds a pointer to a free overflow bucket.
+	//
+	// runtime中它在mapextra里, 和overflow, oldoverflow在一起: 键值都不含指针时
+	// bmap被标记为不含指针, GC不扫描它, 溢出桶要靠这两个切片保持可达.
+	// 模型中的桶总是含有指针(interface{}), 不需要它们
+	nextOverflow []bmap
+
+	// runtime中是hash0, 每个map一个随机种子, 和maptype中的hasher一起算哈希.
+	// 这里种子由Hasher自己保存
+	hasher sync.Hasher
+}
+
+// A bucket for a Go map.
+//
+// runtime中bmap只声明了tophash, 后面的8个key, 8个elem和overflow指针按
+// maptype中的大小用指针运算访问. 先放8个key再放8个elem, 而不是key/elem交替,
+// 是为了省掉map[int64]int8这类类型的对齐填充. 模型中直接写成数组
+type bmap struct {
+	// tophash generally contains the top byte of the hash value
+	// for each key in this bucket. If tophash[0] < minTopHash,
+	// tophash[0] is a bucket evacuation state instead.
+	tophash  [bucketCnt]uint8
+	keys     [bucketCnt]interface{}
+	elems    [bucketCnt]interface{}
+	overflow *bmap
+}
+
+// bucketShift returns 1<<b.
+func bucketShift(b uint8) uintptr {
+	return uintptr(1) << (b & 63)
+}
+
+// bucketMask returns 1<<b - 1.
+func bucketMask(b uint8) uintptr {
+	return bucketShift(b) - 1
+}
+
+// tophash calculates the tophash value for hash.
+//
+// 取哈希的最高8位, 低位已经用来选桶了. 小于minTopHash的值留给上面的标记,
+// 所以加上minTopHash: 有5个值会和别的值冲突, 只是多比较一次key
+func tophash(hash uint64) uint8 {
+	top := uint8(hash >> 56)
+	if top < minTopHash {
+		top += minTopHash
+	}
+	return top
+}
+
+func evacuated(b *bmap) bool {
+	h := b.tophash[0]
+	return h > emptyOne && h < minTopHash
+}
+
+// incrnoverflow increments h.noverflow.
+// noverflow counts the number of overflow buckets.
+// This is used to trigger same-size map growth.
+// See also tooManyOverflowBuckets.
+// To keep hmap small, noverflow is a uint16.
+// When there are few buckets, noverflow is an exact count.
+// When there are many buckets, noverflow is an approximate count.
+func (h *Map) incrnoverflow() {
+	// We trigger same-size map growth if there are
+	// as many overflow buckets as buckets.
+	// We need to be able to count to 1<<h.logB.
+	if h.logB < 16 {
+		h.noverflow++
+		return
+	}
+	// Increment with probability 1/(1<<(h.logB-15)).
+	// When we reach 1<<15 - 1, we will have approximately
+	// as many overflow buckets as buckets.
+	mask := uint32(1)<<(h.logB-15) - 1
+	// Example: if h.logB == 18, then mask == 7,
+	// and fastrand & 7 == 0 with probability 1/8.
+	if rand.Uint32()&mask == 0 {
+		h.noverflow++
+	}
+}
+
+func (h *Map) newoverflow(b *bmap) *bmap {
+	var ovf *bmap
+	if len(h.nextOverflow) > 0 {
+		// We have preallocated overflow buckets available.
+		// See makeBucketArray for more details.
+		//
+		// runtime中nextOverflow是指针, 用桶的大小做指针运算前进, 最后一个预分配的
+		// 桶的overflow指向桶数组的开头作为结束标记. 这里用切片, 不需要标记
+		ovf = &h.nextOverflow[0]
+		h.nextOverflow = h.nextOverflow[1:]
+	} else {
+		ovf = new(bmap)
+	}
+	h.incrnoverflow()
+	b.overflow = ovf
+	return ovf
+}
+
+// New returns an empty map with room for about hint entries, like
+// make(map[interface{}]interface{}, hint). If hasher is nil the map
+// hashes keys with a sync.MaphashHasher, the runtime's own map hash under
+// a random seed.
+func New(hint int, hasher sync.Hasher) *Map {
+	// initialize Hmap
+	h := new(Map)
+	h.hasher = hasher
+	if h.hasher == nil {
+		h.hasher = sync.NewMaphashHasher()
+	}
+
+	// Find the size parameter B which will hold the requested # of elements.
+	// For hint < 0 overLoadFactor returns false since hint < bucketCnt.
+	B := uint8(0)
+	for overLoadFactor(hint, B) {
+		B++
+	}
+	h.logB = B
+
+	// allocate initial hash table
+	// if B == 0, the buckets field is allocated lazily later (in mapassign)
+	// If hint is large zeroing this memory could take a while.
+	if h.logB != 0 {
+		h.buckets, h.nextOverflow = makeBucketArray(h.logB)
+	}
+	return h
+}
+
+// makeBucketArray initializes a backing array for map buckets.
+// 1<<b is the minimum number of buckets to allocate.
+func makeBucketArray(b uint8) (buckets []bmap, nextOverflow []bmap) {
+	base := bucketShift(b)
+	nbuckets := base
+	// For small b, overflow buckets are unlikely.
+	// Avoid the overhead of the calculation.
+	if b >= 4 {
+		// Add on the estimated number of overflow buckets
+		// required to insert the median number of elements
+		// used with this value of b.
+		//
+		// runtime还会把总大小向上取整到内存分配器的size class, 多出来的空间
+		// 也当作溢出桶
+		nbuckets += bucketShift(b - 4)
+	}
+
+	// 桶和预分配的溢出桶在同一次分配中, 溢出桶在末尾.
+	// 以后用到溢出桶时不用再分配, 也和桶在相邻的内存中
+	all := make([]bmap, nbuckets)
+	buckets = all[:base:base]
+	if base != nbuckets {
+		nextOverflow = all[base:]
+	}
+	return buckets, nextOverflow
+}
+
+// Len returns the number of entries in the map, like len(m).
+func (h *Map) Len() int {
+	if h == nil {
+		return 0
+	}
+	return h.count
+}
+
+// hash returns the hash of key. Like the compiler-generated hash
+// functions, it panics if key is not comparable.
+func (h *Map) hash(key interface{}) uint64 {
+	return h.hasher.Hash(key)
+}
+
+// Load returns the value stored for key, like v, ok := m[key].
+//
+// 对应runtime的mapaccess2. 编译器把v := m[k]和v, ok := m[k]分别编译成
+// mapaccess1和mapaccess2, 没有找到时返回元素类型零值的地址
+func (h *Map) Load(key interface{}) (value interface{}, ok bool) {
+	if h == nil || h.count == 0 {
+		// nil map和空map上查找不可比较的key也要panic(#23734)
+		h.hashOrPanic(key)
+		return nil, false
+	}
+	if h.flags&hashWriting != 0 {
+		panic("concurrent map read and map write")
+	}
+	hash := h.hash(key)
+	m := bucketMask(h.logB)
+	b := &h.buckets[uintptr(hash)&m]
+	if c := h.oldbuckets; c != nil {
+		if !h.sameSizeGrow() {
+			// There used to be half as many buckets; mask down one more power of two.
+			m >>= 1
+		}
+		oldb := &c[uintptr(hash)&m]
+		// 旧桶还没有搬走, 数据还在旧桶中. 读操作不帮忙搬迁, 只有写操作才会
+		if !evacuated(oldb) {
+			b = oldb
+		}
+	}
+	top := tophash(hash)
+bucketloop:
+	for ; b != nil; b = b.overflow {
+		for i := uintptr(0); i < bucketCnt; i++ {
+			if b.tophash[i] != top {
+				if b.tophash[i] == emptyRest {
+					// 后面都是空的, 包括溢出桶, 不用再找了
+					break bucketloop
+				}
+				continue
+			}
+			// tophash相同才比较key. 不同的key有1/256的概率tophash相同,
+			// 所以大多数槽只比较一个字节
+			if b.keys[i] == key {
+				return b.elems[i], true
+			}
+		}
+	}
+	return nil, false
+}
+
+func (h *Map) hashOrPanic(key interface{}) {
+	if h == nil {
+		sync.NewMaphashHasher().Hash(key)
+		return
+	}
+	h.hash(key)
+}
+
+// Store sets the value for key, like m[key] = value.
+//
+// 对应runtime的mapassign. runtime的mapassign返回存放elem的地址,
+// 由编译器生成的代码写入值, 这里直接写入
+func (h *Map) Store(key, value interface{}) {
+	if h == nil {
+		panic("assignment to entry in nil map")
+	}
+	if h.flags&hashWriting != 0 {
+		panic("concurrent map writes")
+	}
+	hash := h.hash(key)
+
+	// Set hashWriting after calling t.hasher, since t.hasher may panic,
+	// in which case we have not actually done a write.
+	h.flags ^= hashWriting
+
+	if h.buckets == nil {
+		h.buckets = make([]bmap, 1)
+	}
+
+again:
+	bucket := uintptr(hash) & bucketMask(h.logB)
+	if h.growing() {
+		// 每次写入之前先搬迁要写的桶对应的旧桶, 再多搬一个.
+		// 这样写入的总是新桶, 而每次写入最多多做两个桶的工作
+		h.growWork(bucket)
+	}
+	b := &h.buckets[bucket]
+	top := tophash(hash)
+
+	var insertb *bmap
+	var inserti uintptr
+bucketloop:
+	for {
+		for i := uintptr(0); i < bucketCnt; i++ {
+			if b.tophash[i] != top {
+				// 记住第一个空槽, 但要继续找: key可能在后面
+				if isEmpty(b.tophash[i]) && insertb == nil {
+					insertb = b
+					inserti = i
+				}
+				if b.tophash[i] == emptyRest {
+					break bucketloop
+				}
+				continue
+			}
+			if b.keys[i] != key {
+				continue
+			}
+			// already have a mapping for key. Update it.
+			//
+			// runtime只在needkeyupdate(浮点数的+0和-0, 字符串)时才覆盖key:
+			// +0.0 == -0.0, 新的key可能和旧的不一样. 直接覆盖结果相同
+			b.keys[i] = key
+			b.elems[i] = value
+			goto done
+		}
+		ovf := b.overflow
+		if ovf == nil {
+			break
+		}
+		b = ovf
+	}
+
+	// Did not find mapping for key. Allocate new cell & add entry.
+
+	// If we hit the max load factor or we have too many overflow buckets,
+	// and we're not already in the middle of growing, start growing.
+	if !h.growing() && (overLoadFactor(h.count+1, h.logB) || tooManyOverflowBuckets(h.noverflow, h.logB)) {
+		h.hashGrow()
+		goto again // Growing the table invalidates everything, so try again
+	}
+
+	if insertb == nil {
+		// all current buckets are full, allocate a new one.
+		insertb = h.newoverflow(b)
+		inserti = 0 // not necessary, but avoids needlessly spilling inserti
+	}
+
+	// store new key/elem at insert position
+	insertb.keys[inserti] = key
+	insertb.elems[inserti] = value
+	insertb.tophash[inserti] = top
+	h.count++
+
+done:
+	if h.flags&hashWriting == 0 {
+		panic("concurrent map writes")
+	}
+	h.flags &^= hashWriting
+}
+
+// Delete deletes the value for key, like delete(m, key).
+func (h *Map) Delete(key interface{}) {
+	if h == nil || h.count == 0 {
+		h.hashOrPanic(key)
+		return
+	}
+	if h.flags&hashWriting != 0 {
+		panic("concurrent map writes")
+	}
+
+	hash := h.hash(key)
+
+	// Set hashWriting after calling t.hasher, since t.hasher may panic,
+	// in which case we have not actually done a write (delete).
+	h.flags ^= hashWriting
+
+	bucket := uintptr(hash) & bucketMask(h.logB)
+	if h.growing() {
+		h.growWork(bucket)
+	}
+	b := &h.buckets[bucket]
+	bOrig := b
+	top := tophash(hash)
+search:
+	for ; b != nil; b = b.overflow {
+		for i := uintptr(0); i < bucketCnt; i++ {
+			if b.tophash[i] != top {
+				if b.tophash[i] == emptyRest {
+					break search
+				}
+				continue
+			}
+			if b.keys[i] != key {
+				continue
+			}
+			// Only clear key/elem if there are pointers in them.
+			//
+			// 模型中总是有指针. 清空它们, 以便GC回收. 槽位本身不会移动或回收,
+			// 桶中的key也不会重新排列, 否则正在进行的迭代可能漏掉或重复返回key
+			b.keys[i] = nil
+			b.elems[i] = nil
+			b.tophash[i] = emptyOne
+			// If the bucket now ends in a bunch of emptyOne states,
+			// change those to emptyRest states.
+			// It would be nice to make this a separate function, but
+			// for loops are not currently inlineable.
+			if i == bucketCnt-1 {
+				if b.overflow != nil && b.overflow.tophash[0] != emptyRest {
+					goto notLast
+				}
+			} else {
+				if b.tophash[i+1] != emptyRest {
+					goto notLast
+				}
+			}
+			for {
+				b.tophash[i] = emptyRest
+				if i == 0 {
+					if b == bOrig {
+						break // beginning of initial bucket, we're done.
+					}
+					// Find previous bucket, continue at its last entry.
+					c := b
+					for b = bOrig; b.overflow != c; b = b.overflow {
+					}
+					i = bucketCnt - 1
+				} else {
+					i--
+				}
+				if b.tophash[i] != emptyOne {
+					break
+				}
+			}
+		notLast:
+			h.count--
+			break search
+		}
+	}
+
+	if h.flags&hashWriting == 0 {
+		panic("concurrent map writes")
+	}
+	h.flags &^= hashWriting
+}
+
+// Clear deletes all entries, keeping the buckets for reuse.
+//
+// Go 1.14还没有clear内置函数, 但编译器把
+//
+//	for k := range m {
+//		delete(m, k)
+//	}
+//
+// 识别为mapclear. 它不逐个删除, 而是清空整个桶数组, 丢掉溢出桶和旧桶
+func (h *Map) Clear() {
+	if h == nil || h.count == 0 {
+		return
+	}
+	if h.flags&hashWriting != 0 {
+		panic("concurrent map writes")
+	}
+	h.flags ^= hashWriting
+
+	h.flags &^= sameSizeGrow
+	h.oldbuckets = nil
+	h.nevacuate = 0
+	h.noverflow = 0
+	h.count = 0
+
+	// makeBucketArray clears the memory pointed to by h.buckets
+	// and recovers any overflow buckets by generating them
+	// as if h.buckets was newly alloced.
+	h.buckets, h.nextOverflow = makeBucketArray(h.logB)
+
+	if h.flags&hashWriting == 0 {
+		panic("concurrent map writes")
+	}
+	h.flags &^= hashWriting
+}
+
+func (h *Map) hashGrow() {
+	// If we've hit the load factor, get bigger.
+	// Otherwise, there are too many overflow buckets,
+	// so keep the same number of buckets and "grow" laterally.
+	bigger := uint8(1)
+	if !overLoadFactor(h.count+1, h.logB) {
+		bigger = 0
+		h.flags |= sameSizeGrow
+	}
+	oldbuckets := h.buckets
+	newbuckets, nextOverflow := makeBucketArray(h.logB + bigger)
+
+	flags := h.flags &^ (iterator | oldIterator)
+	if h.flags&iterator != 0 {
+		flags |= oldIterator
+	}
+	// commit the grow (atomic wrt gc)
+	h.logB += bigger
+	h.flags = flags
+	h.oldbuckets = oldbuckets
+	h.buckets = newbuckets
+	h.nevacuate = 0
+	h.noverflow = 0
+
+	// runtime在这里把extra.overflow移到extra.oldoverflow, 让旧的溢出桶在
+	// 搬迁完之前保持可达. 模型中溢出桶由overflow指针引用, 不需要
+	h.nextOverflow = nextOverflow
+
+	// the actual copying of the hash table data is done incrementally
+	// by growWork() and evacuate().
+}
+
+// overLoadFactor reports whether count items placed in 1<<B buckets is over loadFactor.
+func overLoadFactor(count int, B uint8) bool {
+	return count > bucketCnt && uintptr(count) > loadFactorNum*(bucketShift(B)/loadFactorDen)
+}
+
+// tooManyOverflowBuckets reports whether noverflow buckets is too many for a map with 1<<B buckets.
+// Note that most of these overflow buckets must be in sparse use;
+// if use was dense, then we'd have already triggered regular map growth.
+//
+// 大量插入再删除之后, 元素数量不多, 却留下了很长的溢出链. 查找要走完整条链,
+// 而负载因子永远不会超过, 所以用溢出桶的数量触发等量扩容: 桶的数量不变,
+// 重新排列一遍, 把稀疏的溢出链压紧
+func tooManyOverflowBuckets(noverflow uint16, B uint8) bool {
+	// If the threshold is too low, we do extraneous work.
+	// If the threshold is too high, maps that grow and shrink can hold on to lots of unused memory.
+	// "too many" means (approximately) as many overflow buckets as regular buckets.
+	// See incrnoverflow for more details.
+	if B > 15 {
+		B = 15
+	}
+	// The compiler doesn't see here that B < 16; mask B to generate shorter shift code.
+	return noverflow >= uint16(1)<<(B&15)
+}
+
+// growing reports whether h is growing. The growth may be to the same size or bigger.
+func (h *Map) growing() bool {
+	return h.oldbuckets != nil
+}
+
+// sameSizeGrow reports whether the current growth is to a map of the same size.
+func (h *Map) sameSizeGrow() bool {
+	return h.flags&sameSizeGrow != 0
+}
+
+// noldbuckets calculates the number of buckets prior to the current map growth.
+func (h *Map) noldbuckets() uintptr {
+	oldB := h.logB
+	if !h.sameSizeGrow() {
+		oldB--
+	}
+	return bucketShift(oldB)
+}
+
+// oldbucketmask provides a mask that can be applied to calculate n % noldbuckets().
+func (h *Map) oldbucketmask() uintptr {
+	return h.noldbuckets() - 1
+}
+
+func (h *Map) growWork(bucket uintptr) {
+	// make sure we evacuate the oldbucket corresponding
+	// to the bucket we're about to use
+	h.evacuate(bucket & h.oldbucketmask())
+
+	// evacuate one more oldbucket to make progress on growing
+	if h.growing() {
+		h.evacuate(h.nevacuate)
+	}
+}
+
+func (h *Map) bucketEvacuated(bucket uintptr) bool {
+	return evacuated(&h.oldbuckets[bucket])
+}
+
+// evacDst is an evacuation destination.
+type evacDst struct {
+	b *bmap // current destination bucket
+	i int   // key/elem index into b
+}
+
+func (h *Map) evacuate(oldbucket uintptr) {
+	b := &h.oldbuckets[oldbucket]
+	newbit := h.noldbuckets()
+	if !evacuated(b) {
+		// TODO: reuse overflow buckets instead of using new ones, if there
+		// is no iterator using the old buckets.  (If !oldIterator.)
+
+		// xy contains the x and y (low and high) evacuation destinations.
+		//
+		// 翻倍扩容时, 旧桶i中的key只会去新桶i(x)或者i+newbit(y), 取决于哈希中
+		// 新多出来的那一位. 等量扩容只有x
+		var xy [2]evacDst
+		x := &xy[0]
+		x.b = &h.buckets[oldbucket]
+
+		if !h.sameSizeGrow() {
+			// Only calculate y pointers if we're growing bigger.
+			// Otherwise GC can see bad pointers.
+			y := &xy[1]
+			y.b = &h.buckets[oldbucket+newbit]
+		}
+
+		for ; b != nil; b = b.overflow {
+			for i := 0; i < bucketCnt; i++ {
+				top := b.tophash[i]
+				if isEmpty(top) {
+					b.tophash[i] = evacuatedEmpty
+					continue
+				}
+				if top < minTopHash {
+					panic("bad map state")
+				}
+				k := b.keys[i]
+				var useY uint8
+				if !h.sameSizeGrow() {
+					// Compute hash to make our evacuation decision (whether we need
+					// to send this key/elem to bucket x or bucket y).
+					hash := h.hash(k)
+					if h.flags&iterator != 0 && k != k {
+						// If key != key (NaNs), then the hash could be (and probably
+						// will be) entirely different from the old hash. Moreover,
+						// it isn't reproducible. Reproducibility is required in the
+						// presence of iterators, as our evacuation decision must
+						// match whatever decision the iterator made.
+						// Fortunately, we have the freedom to send these keys either
+						// way. Also, tophash is meaningless for these kinds of keys.
+						// We let the low bit of tophash drive the evacuation decision.
+						// We recompute a new random tophash for the next level so
+						// these keys will get evenly distributed across all buckets
+						// after multiple grows.
+						useY = top & 1
+						top = tophash(hash)
+					} else {
+						if uintptr(hash)&newbit != 0 {
+							useY = 1
+						}
+					}
+				}
+
+				if evacuatedX+1 != evacuatedY || evacuatedX^1 != evacuatedY {
+					panic("bad evacuatedN")
+				}
+
+				b.tophash[i] = evacuatedX + useY // evacuatedX + 1 == evacuatedY
+				dst := &xy[useY]                 // evacuation destination
+
+				if dst.i == bucketCnt {
+					dst.b = h.newoverflow(dst.b)
+					dst.i = 0
+				}
+				dst.b.tophash[dst.i&(bucketCnt-1)] = top // mask dst.i as an optimization, to avoid a bounds check
+				dst.b.keys[dst.i&(bucketCnt-1)] = k
+				dst.b.elems[dst.i&(bucketCnt-1)] = b.elems[i]
+				dst.i++
+			}
+		}
+		// Unlink the overflow buckets & clear key/elem to help GC.
+		//
+		// 有迭代器在旧桶上时不能清空: 迭代器还要从旧桶中读key和elem.
+		// 清空时保留tophash, 其中的evacuatedX/Y告诉以后的迭代器去新桶中找
+		if h.flags&oldIterator == 0 {
+			b := &h.oldbuckets[oldbucket]
+			b.keys = [bucketCnt]interface{}{}
+			b.elems = [bucketCnt]interface{}{}
+			b.overflow = nil
+		}
+	}
+
+	if oldbucket == h.nevacuate {
+		h.advanceEvacuationMark(newbit)
+	}
+}
+
+func (h *Map) advanceEvacuationMark(newbit uintptr) {
+	h.nevacuate++
+	// Experiments suggest that 1024 is overkill by at least an order of magnitude.
+	// Put it in there as a safeguard anyway, to ensure O(1) behavior.
+	stop := h.nevacuate + 1024
+	if stop > newbit {
+		stop = newbit
+	}
+	for h.nevacuate != stop && h.bucketEvacuated(h.nevacuate) {
+		h.nevacuate++
+	}
+	if h.nevacuate == newbit { // newbit == # of oldbuckets
+		// Growing is all done. Free old main bucket array.
+		h.oldbuckets = nil
+		// Can discard old overflow buckets as well.
+		// If they are still referenced by an iterator,
+		// then the iterator holds a pointers to the slice.
+		h.flags &^= sameSizeGrow
+	}
+}
+
+// Stats describes the shape of a Map's hash table.
+type Stats struct {
+	Count        int  // number of entries
+	B            int  // log_2 of the number of buckets
+	Overflow     int  // approximate number of overflow buckets, see incrnoverflow
+	Growing      bool // whether old buckets are still being evacuated
+	SameSizeGrow bool // whether the current growth keeps the number of buckets
+	Evacuated    int  // old buckets below this index have all been evacuated
+}
+
+// Stats returns the current shape of the hash table. Nothing like it is
+// available for built-in maps; it is here so tests and examples can watch
+// the incremental growth.
+func (h *Map) Stats() Stats {
+	return Stats{
+		Count:        h.count,
+		B:            int(h.logB),
+		Overflow:     int(h.noverflow),
+		Growing:      h.growing(),
+		SameSizeGrow: h.sameSizeGrow(),
+		Evacuated:    int(h.nevacuate),
+	}
+}
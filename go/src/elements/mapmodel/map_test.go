@@ -0,0 +1,317 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mapmodel_test
+
+import (
+	"elements/mapmodel"
+	"math"
+	"math/rand"
+	"reflect"
+	"sync"
+	"testing"
+	"testing/quick"
+)
+
+// shiftHasher hashes an int key to the key shifted left by shift bits, so
+// the low shift bits, which pick the bucket, are all zero: every key lands
+// in bucket 0 until the table has more than 1<<shift buckets. Overflow
+// chains get long and same-size growth is easy to trigger.
+type shiftHasher uint
+
+func (s shiftHasher) Hash(key interface{}) uint64 {
+	return uint64(key.(int)) << s
+}
+
+// identityHasher hashes an int key to itself, so tests can pick buckets.
+type identityHasher struct{}
+
+func (identityHasher) Hash(key interface{}) uint64 {
+	return uint64(key.(int))
+}
+
+type mapOp string
+
+const (
+	opLoad   = mapOp("Load")
+	opStore  = mapOp("Store")
+	opDelete = mapOp("Delete")
+	opLen    = mapOp("Len")
+	opClear  = mapOp("Clear")
+)
+
+var mapOps = [...]mapOp{opLoad, opStore, opStore, opStore, opDelete, opLen, opClear}
+
+// mapCall is a quick.Generator for calls on a map.
+type mapCall struct {
+	op   mapOp
+	k, v int
+}
+
+func (mapCall) Generate(r *rand.Rand, size int) reflect.Value {
+	c := mapCall{op: mapOps[r.Intn(len(mapOps))], k: r.Intn(200), v: r.Intn(100)}
+	// Clear ends most interesting sequences, so make it rare.
+	if c.op == opClear && r.Intn(10) != 0 {
+		c.op = opStore
+	}
+	return reflect.ValueOf(c)
+}
+
+type mapResult struct {
+	v  interface{}
+	ok bool
+	n  int
+}
+
+func (c mapCall) applyModel(m *mapmodel.Map) mapResult {
+	switch c.op {
+	case opLoad:
+		v, ok := m.Load(c.k)
+		return mapResult{v: v, ok: ok}
+	case opStore:
+		m.Store(c.k, c.v)
+	case opDelete:
+		m.Delete(c.k)
+	case opLen:
+		return mapResult{n: m.Len()}
+	case opClear:
+		m.Clear()
+	}
+	return mapResult{}
+}
+
+func (c mapCall) applyBuiltin(m map[interface{}]interface{}) mapResult {
+	switch c.op {
+	case opLoad:
+		v, ok := m[c.k]
+		return mapResult{v: v, ok: ok}
+	case opStore:
+		m[c.k] = c.v
+	case opDelete:
+		delete(m, c.k)
+	case opLen:
+		return mapResult{n: len(m)}
+	case opClear:
+		for k := range m {
+			delete(m, k)
+		}
+	}
+	return mapResult{}
+}
+
+func contents(m *mapmodel.Map) map[interface{}]interface{} {
+	got := make(map[interface{}]interface{})
+	m.Range(func(k, v interface{}) bool {
+		got[k] = v
+		return true
+	})
+	return got
+}
+
+func TestMatchesBuiltin(t *testing.T) {
+	for _, h := range []struct {
+		name   string
+		hasher sync.Hasher
+	}{
+		{"maphash", nil},
+		{"collide", shiftHasher(4)},
+	} {
+		t.Run(h.name, func(t *testing.T) {
+			check := func(calls []mapCall) bool {
+				m := mapmodel.New(0, h.hasher)
+				b := make(map[interface{}]interface{})
+				for i, c := range calls {
+					got, want := c.applyModel(m), c.applyBuiltin(b)
+					if got != want {
+						t.Errorf("call %d %v(%d, %d) = %+v; want %+v", i, c.op, c.k, c.v, got, want)
+						return false
+					}
+				}
+				if got := contents(m); !reflect.DeepEqual(got, b) {
+					t.Errorf("Range returned %v; want %v", got, b)
+					return false
+				}
+				return true
+			}
+			if err := quick.Check(check, nil); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestGrowth(t *testing.T) {
+	m := mapmodel.New(0, nil)
+	// 8个元素放得下一个桶; 之后每个桶平均超过6.5个元素才翻倍
+	for i := 0; i < 8; i++ {
+		m.Store(i, i)
+	}
+	if s := m.Stats(); s.B != 0 || s.Growing {
+		t.Fatalf("after 8 stores: %+v; want B 0, not growing", s)
+	}
+	// 只有一个旧桶, 触发扩容的那次写入就把它搬完了
+	m.Store(8, 8)
+	if s := m.Stats(); s.B != 1 || s.Growing {
+		t.Fatalf("after 9 stores: %+v; want B 1, not growing", s)
+	}
+
+	// 翻倍到B=3(8个桶)之后, 第53个元素触发下一次扩容, 之后每次写入最多搬迁两个
+	// 旧桶, 8个旧桶最多8次写入搬完
+	for i := 9; i < 52; i++ {
+		m.Store(i, i)
+	}
+	for m.Stats().Growing {
+		m.Store(0, 0)
+	}
+	if s := m.Stats(); s.B != 3 {
+		t.Fatalf("after 52 stores: %+v; want B 3", s)
+	}
+	m.Store(52, 52)
+	s := m.Stats()
+	if s.B != 4 || !s.Growing || s.SameSizeGrow {
+		t.Fatalf("after 53 stores: %+v; want B 4, growing", s)
+	}
+	writes := 0
+	for ; m.Stats().Growing; writes++ {
+		m.Store(writes%53, writes)
+	}
+	if writes > 8 {
+		t.Errorf("evacuating 8 old buckets took %d writes; want at most 8", writes)
+	}
+
+	// 只读不会推进搬迁
+	m.Store(53, 53)
+	for i := 54; m.Stats().B == 4; i++ {
+		m.Store(i, i)
+	}
+	before := m.Stats()
+	for i := 0; i < 1000; i++ {
+		m.Load(i)
+	}
+	m.Range(func(k, v interface{}) bool { return true })
+	if after := m.Stats(); after != before {
+		t.Errorf("reads changed the table from %+v to %+v", before, after)
+	}
+}
+
+func TestSameSizeGrow(t *testing.T) {
+	// identityHasher: 偶数在桶0, 奇数在桶1
+	m := mapmodel.New(9, identityHasher{})
+	if s := m.Stats(); s.B != 1 {
+		t.Fatalf("New(9) has B %d; want 1", s.B)
+	}
+	for k := 0; k < 18; k += 2 {
+		m.Store(k, k)
+	}
+	for k := 0; k < 18; k += 2 {
+		m.Delete(k)
+	}
+	// 桶0的溢出桶空了, 但不会被回收: 溢出桶的数量只增不减
+	for k := 1; k < 19; k += 2 {
+		m.Store(k, k)
+	}
+	if s := m.Stats(); s.Overflow != 2 || s.Growing {
+		t.Fatalf("after filling both buckets: %+v; want 2 overflow buckets, not growing", s)
+	}
+	// 溢出桶和桶一样多, 下一次插入触发等量扩容. 两个旧桶在这次写入中就搬完了,
+	// 桶0的空溢出桶被丢掉, 只剩桶1需要的一个
+	m.Store(19, 19)
+	if s := m.Stats(); s.B != 1 || s.Growing || s.Overflow != 1 || s.Count != 10 {
+		t.Errorf("after the same-size grow: %+v; want B 1, 10 entries and 1 overflow bucket", s)
+	}
+	for k := 1; k < 21; k += 2 {
+		if _, ok := m.Load(k); !ok {
+			t.Errorf("Load(%d) missing after the same-size grow", k)
+		}
+	}
+}
+
+func TestDeleteEmptyRest(t *testing.T) {
+	// 删除链尾的元素后, 前面连续的空槽都标记为emptyRest, 查找不用再走到底.
+	// 这里只能检查结果, 查找的步数看不到
+	m := mapmodel.New(0, shiftHasher(8))
+	for k := 0; k < 40; k++ {
+		m.Store(k, k)
+	}
+	for _, order := range [][]int{{39, 38, 37}, {0, 1, 2}, {20, 21, 19}} {
+		for _, k := range order {
+			m.Delete(k)
+			if _, ok := m.Load(k); ok {
+				t.Errorf("Load(%d) found a deleted key", k)
+			}
+		}
+	}
+	for k := 0; k < 40; k++ {
+		m.Store(k, -k)
+	}
+	if m.Len() != 40 {
+		t.Errorf("Len() = %d; want 40", m.Len())
+	}
+	for k := 0; k < 40; k++ {
+		if v, ok := m.Load(k); !ok || v != -k {
+			t.Errorf("Load(%d) = %v, %v; want %d, true", k, v, ok, -k)
+		}
+	}
+}
+
+func TestNaN(t *testing.T) {
+	m := mapmodel.New(0, nil)
+	nan := math.NaN()
+	for i := 0; i < 100; i++ {
+		m.Store(nan, i)
+	}
+	// NaN != NaN: 每次Store都是一个新的key, Load和Delete永远找不到它们
+	if m.Len() != 100 {
+		t.Errorf("Len() = %d after 100 NaN stores; want 100", m.Len())
+	}
+	if _, ok := m.Load(nan); ok {
+		t.Error("Load(NaN) found a value")
+	}
+	m.Delete(nan)
+	seen := make(map[interface{}]bool)
+	m.Range(func(k, v interface{}) bool {
+		if k := k.(float64); k == k {
+			t.Errorf("Range returned key %v; want NaN", k)
+		}
+		if seen[v] {
+			t.Errorf("Range returned NaN -> %v twice", v)
+		}
+		seen[v] = true
+		return true
+	})
+	if len(seen) != 100 {
+		t.Errorf("Range returned %d NaN keys; want 100", len(seen))
+	}
+	m.Clear()
+	if m.Len() != 0 {
+		t.Errorf("Len() = %d after Clear; want 0", m.Len())
+	}
+}
+
+func TestPanics(t *testing.T) {
+	shouldPanic := func(name, want string, f func()) {
+		defer func() {
+			if e := recover(); e == nil {
+				t.Errorf("%s did not panic", name)
+			} else if want != "" && e != want {
+				t.Errorf("%s panicked with %v; want %q", name, e, want)
+			}
+		}()
+		f()
+	}
+	var nilMap *mapmodel.Map
+	shouldPanic("Store on nil map", "assignment to entry in nil map", func() { nilMap.Store(1, 1) })
+	// 和内置map一样, 不可比较的key总是panic, 即使map是nil或者空的
+	shouldPanic("Load with a slice key", "", func() { nilMap.Load([]int{1}) })
+	shouldPanic("Delete with a slice key", "", func() { mapmodel.New(0, nil).Delete([]int{1}) })
+
+	if v, ok := nilMap.Load(1); v != nil || ok || nilMap.Len() != 0 {
+		t.Errorf("nil map Load(1) = %v, %v, Len() = %d; want nil, false, 0", v, ok, nilMap.Len())
+	}
+	nilMap.Delete(1)
+	nilMap.Range(func(k, v interface{}) bool {
+		t.Error("Range on nil map called f")
+		return true
+	})
+}
@@ -0,0 +1,46 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mapsim_test
+
+import (
+	"elements/mapsim"
+	"fmt"
+	"sync"
+)
+
+// This example steps through the stores and loads of
+// example/sync/map_exmaple.go. The first Store creates the dirty map and
+// the first miss promotes it; the deleted k1 is expunged when the next
+// dirty map is created, so it is not copied.
+func ExampleSim() {
+	sim := mapsim.New(mapsim.Config{})
+	step := func(name string, f func(m *sync.Map)) {
+		fmt.Println(name)
+		for _, b := range sim.Run(f) {
+			fmt.Println("   ", b)
+		}
+	}
+	step("Store k1", func(m *sync.Map) { m.Store("k1", "v1") })
+	step("Load k1", func(m *sync.Map) { m.Load("k1") })
+	step("Delete k1", func(m *sync.Map) { m.Delete("k1") })
+	step("Store k2", func(m *sync.Map) { m.Store("k2", "v2") })
+	step("Load k2", func(m *sync.Map) { m.Load("k2") })
+	step("Load k2", func(m *sync.Map) { m.Load("k2") })
+	// Output:
+	// Store k1
+	//     dirty-created key=k1 read=0 dirty=0 amended=true misses=0
+	//     dirty-stored  key=k1 read=0 dirty=1 amended=true misses=0
+	// Load k1
+	//     miss          key=k1 read=0 dirty=1 amended=true misses=1
+	//     promoted      key=k1 read=1 dirty=nil amended=false misses=0
+	// Delete k1
+	// Store k2
+	//     dirty-created key=k2 read=1 dirty=0 amended=true misses=0
+	//     dirty-stored  key=k2 read=1 dirty=1 amended=true misses=0
+	// Load k2
+	//     miss          key=k2 read=1 dirty=1 amended=true misses=1
+	//     promoted      key=k2 read=1 dirty=nil amended=false misses=0
+	// Load k2
+}
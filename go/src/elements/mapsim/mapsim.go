@@ -0,0 +1,177 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package mapsim single-steps a sync.Map through its internal transitions.
+//
+// A Sim runs operations on the Map in goroutines of their own and stops
+// each of them right after every transition that has a breakpoint: a
+// miss, the creation of the dirty map, a store into it, a promotion. The
+// stopped goroutine holds the Map's mutex, so the Map stays in the state
+// the Break describes until Next resumes it:
+//
+//	sim := mapsim.New(mapsim.Config{})
+//	sim.Go(func(m *sync.Map) { m.Store("k1", "v1") })
+//	for b, ok := sim.Next(); ok; b, ok = sim.Next() {
+//		fmt.Println(b)
+//	}
+//
+// Meanwhile the stepping goroutine can call the Map directly, to see
+// which operations still go through and which wait behind the stopped
+// one.
+//
+// With Config.Record, the Sim also keeps the full state of the Map at
+// every break and at the end of every operation, and a Timeline steps
+// back and forth through them once the operations have run.
+package mapsim
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Config configures a Sim.
+type Config struct {
+	// Breakpoints lists the transitions to stop at. Nil means all of them.
+	Breakpoints []sync.MapTransition
+
+	// Options are passed to sync.NewMap, for example to pick a backend.
+	Options []sync.MapOption
+
+	// Record makes the Sim snapshot the whole Map at every break and at
+	// the end of every operation, for History and Timeline. Each snapshot
+	// copies every key, so it is meant for the small maps of examples.
+	Record bool
+}
+
+// A Break is a stop of an operation after a transition of the Map.
+type Break struct {
+	sync.MapEvent
+
+	resume chan struct{}
+	state  *sync.MapState // 记录时, 停下时的状态
+}
+
+func (b Break) String() string {
+	dirty := "nil"
+	if b.Dirty >= 0 {
+		dirty = fmt.Sprint(b.Dirty)
+	}
+	return fmt.Sprintf("%-13s key=%v read=%d dirty=%s amended=%v misses=%d",
+		b.Transition, b.Key, b.Read, dirty, b.Amended, b.Misses)
+}
+
+// A Sim is a sync.Map whose transitions stop at breakpoints.
+//
+// Go, Next and Run must be called from a single goroutine, the one that
+// steps the simulation.
+type Sim struct {
+	m      *sync.Map
+	stop   map[sync.MapTransition]bool // nil stops at every transition
+	record bool
+	breaks chan Break     // 停下的操作发来Break, 等待resume被关闭
+	done   chan *Snapshot // 每个结束的操作发送一次, 不记录时为nil
+
+	// 以下只由单步的goroutine访问
+	running int    // 已经开始但还没有结束的操作
+	stopped *Break // 当前停下的操作
+	ops     int    // Go调用的次数
+	history []Snapshot
+}
+
+// New returns a Sim with an empty Map configured by cfg.
+func New(cfg Config) *Sim {
+	s := &Sim{
+		record: cfg.Record,
+		breaks: make(chan Break),
+		done:   make(chan *Snapshot),
+	}
+	if cfg.Breakpoints != nil {
+		s.stop = make(map[sync.MapTransition]bool)
+		for _, t := range cfg.Breakpoints {
+			s.stop[t] = true
+		}
+	}
+	opts := append([]sync.MapOption{sync.WithTransitionHook(s.hook)}, cfg.Options...)
+	s.m = sync.NewMap(opts...)
+	return s
+}
+
+// hook runs inside the Map, on the goroutine of an operation, with the
+// Map's mutex held.
+func (s *Sim) hook(e sync.MapEvent) {
+	if s.stop != nil && !s.stop[e.Transition] {
+		return
+	}
+	b := Break{MapEvent: e, resume: make(chan struct{})}
+	if s.record {
+		st := e.State()
+		b.state = &st
+	}
+	s.breaks <- b
+	<-b.resume
+}
+
+// Map returns the simulated Map. Calling it directly does not count as
+// an operation of the Sim, so the calling goroutine must not be the
+// stepping one if the call may reach a breakpoint or wait for a stopped
+// operation.
+func (s *Sim) Map() *sync.Map {
+	return s.m
+}
+
+// Go starts f on a new goroutine. f runs until its first breakpoint, or
+// to completion, concurrently with the caller; Next reports which.
+func (s *Sim) Go(f func(m *sync.Map)) {
+	op := s.ops
+	s.ops++
+	s.running++
+	go func() {
+		var end *Snapshot
+		defer func() { s.done <- end }()
+		f(s.m)
+		if s.record {
+			// State要锁住Map, 所以在操作自己的goroutine中取: 别的操作停在
+			// 断点上时, 这里等到它继续
+			end = &Snapshot{Op: op, State: s.m.State()}
+		}
+	}()
+}
+
+// Next resumes the stopped operation, if any, and waits until an
+// operation stops at a breakpoint. It returns false once no operation is
+// running.
+func (s *Sim) Next() (Break, bool) {
+	if s.stopped != nil {
+		close(s.stopped.resume)
+		s.stopped = nil
+	}
+	for s.running > 0 {
+		select {
+		case b := <-s.breaks:
+			s.stopped = &b
+			if b.state != nil {
+				e := b.MapEvent
+				s.history = append(s.history, Snapshot{Event: &e, Op: -1, State: *b.state})
+			}
+			return b, true
+		case end := <-s.done:
+			s.running--
+			if end != nil {
+				s.history = append(s.history, *end)
+			}
+		}
+	}
+	return Break{}, false
+}
+
+// Run runs f to completion, together with any operation already
+// running, and returns the breaks on the way.
+func (s *Sim) Run(f func(m *sync.Map)) []Break {
+	s.Go(f)
+	var bs []Break
+	for b, ok := s.Next(); ok; b, ok = s.Next() {
+		bs = append(bs, b)
+	}
+	return bs
+}
@@ -0,0 +1,109 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mapsim_test
+
+import (
+	"elements/mapsim"
+	"sync"
+	"testing"
+)
+
+func transitions(bs []mapsim.Break) []sync.MapTransition {
+	var ts []sync.MapTransition
+	for _, b := range bs {
+		ts = append(ts, b.Transition)
+	}
+	return ts
+}
+
+func equal(a, b []sync.MapTransition) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestStoreCreatesDirty(t *testing.T) {
+	sim := mapsim.New(mapsim.Config{})
+	bs := sim.Run(func(m *sync.Map) { m.Store("k1", 1) })
+	want := []sync.MapTransition{sync.MapDirtyCreated, sync.MapDirtyStored}
+	if got := transitions(bs); !equal(got, want) {
+		t.Fatalf("Store: %v, want %v", got, want)
+	}
+	if b := bs[0]; b.Dirty != 0 || !b.Amended || b.Key != "k1" {
+		t.Errorf("dirty-created: %v", b)
+	}
+
+	bs = sim.Run(func(m *sync.Map) { m.Load("k1") })
+	want = []sync.MapTransition{sync.MapMiss, sync.MapPromoted}
+	if got := transitions(bs); !equal(got, want) {
+		t.Fatalf("Load: %v, want %v", got, want)
+	}
+	if b := bs[1]; b.Read != 1 || b.Dirty != -1 || b.Amended {
+		t.Errorf("promoted: %v", b)
+	}
+
+	// read中已有的key, Store和Load都走快速路径, 没有任何状态变化
+	if bs := sim.Run(func(m *sync.Map) { m.Store("k1", 2); m.Load("k1") }); len(bs) != 0 {
+		t.Errorf("fast paths made transitions: %v", bs)
+	}
+}
+
+func TestBreakpoints(t *testing.T) {
+	sim := mapsim.New(mapsim.Config{Breakpoints: []sync.MapTransition{sync.MapPromoted}})
+	bs := sim.Run(func(m *sync.Map) {
+		for i := 0; i < 10; i++ {
+			m.Store(i, i)
+			m.Load(i)
+		}
+	})
+	for _, b := range bs {
+		if b.Transition != sync.MapPromoted {
+			t.Errorf("stopped at %v, which has no breakpoint", b)
+		}
+	}
+	if len(bs) == 0 {
+		t.Error("no promotion")
+	}
+}
+
+// TestStoppedHoldsMutex single-steps a Store and checks, at each stop,
+// that the Map is frozen for slow paths but not for the read map.
+func TestStoppedHoldsMutex(t *testing.T) {
+	sim := mapsim.New(mapsim.Config{})
+	sim.Run(func(m *sync.Map) { m.Store("old", 1); m.Load("old") })
+
+	sim.Go(func(m *sync.Map) { m.Store("new", 2) })
+	b, ok := sim.Next()
+	if !ok || b.Transition != sync.MapDirtyCreated {
+		t.Fatalf("first stop = %v, %v; want dirty-created", b, ok)
+	}
+	if v, ok := sim.Map().Load("old"); !ok || v != 1 {
+		t.Errorf("Load(old) at dirty-created = %v, %v; want 1, true", v, ok)
+	}
+	// 另一个慢路径的操作等在mutex上, 直到停下的Store继续
+	sim.Go(func(m *sync.Map) { m.Load("new") })
+	b, ok = sim.Next()
+	if !ok || b.Transition != sync.MapDirtyStored || b.Key != "new" {
+		t.Fatalf("second stop = %v, %v; want dirty-stored new", b, ok)
+	}
+	b, ok = sim.Next()
+	if !ok || b.Transition != sync.MapMiss || b.Key != "new" {
+		t.Fatalf("third stop = %v, %v; want the miss of the waiting Load", b, ok)
+	}
+	for _, ok := sim.Next(); ok; _, ok = sim.Next() {
+	}
+	// new还只在dirty中, 再Load一次是慢路径, 必须作为Sim的操作运行
+	var v interface{}
+	sim.Run(func(m *sync.Map) { v, ok = m.Load("new") })
+	if !ok || v != 2 {
+		t.Errorf("Load(new) = %v, %v; want 2, true", v, ok)
+	}
+}
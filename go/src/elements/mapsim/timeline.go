@@ -0,0 +1,98 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mapsim
+
+import "sync"
+
+// A Snapshot is the full state of the Map at a point of a simulation
+// recorded with Config.Record.
+type Snapshot struct {
+	// Event is the transition the Map had just made, for a snapshot taken
+	// at a break, or nil for one taken at the end of an operation.
+	Event *sync.MapEvent
+
+	// Op is the operation that ended, numbered from 0 in the order of the
+	// calls to Go, or -1 for a snapshot taken at a break.
+	Op int
+
+	State sync.MapState
+}
+
+// Entry returns the entry of key: the one in the read map if there is
+// one, and the one in the dirty map otherwise. ok is false if the key is
+// in neither.
+func (s Snapshot) Entry(key interface{}) (e sync.MapEntry, ok bool) {
+	for _, es := range [][]sync.MapEntry{s.State.Read, s.State.Dirty} {
+		for _, e := range es {
+			if e.Key == key {
+				return e, true
+			}
+		}
+	}
+	return sync.MapEntry{}, false
+}
+
+// History returns the snapshots recorded so far, in the order they were
+// taken. It is nil unless the Sim was configured with Record.
+func (s *Sim) History() []Snapshot {
+	return s.history
+}
+
+// A Timeline steps back and forth through the snapshots of a Sim. Unlike
+// Next, which drives the operations, it only replays what they recorded:
+// stepping back does not undo anything in the Map.
+type Timeline struct {
+	snaps []Snapshot
+	pos   int
+}
+
+// Timeline returns a Timeline of the snapshots recorded so far, at the
+// first one.
+func (s *Sim) Timeline() *Timeline {
+	return &Timeline{snaps: s.history}
+}
+
+// Len returns the number of snapshots.
+func (t *Timeline) Len() int { return len(t.snaps) }
+
+// Pos returns the index of the current snapshot.
+func (t *Timeline) Pos() int { return t.pos }
+
+// At returns the current snapshot. It panics if there are none.
+func (t *Timeline) At() Snapshot { return t.snaps[t.pos] }
+
+// Seek moves to the snapshot at index i, and reports whether there is
+// one. It stays where it is if not.
+func (t *Timeline) Seek(i int) bool {
+	if i < 0 || i >= len(t.snaps) {
+		return false
+	}
+	t.pos = i
+	return true
+}
+
+// Forward moves to the next snapshot, and reports whether there was one.
+func (t *Timeline) Forward() bool { return t.Seek(t.pos + 1) }
+
+// Back moves to the previous snapshot, and reports whether there was one.
+func (t *Timeline) Back() bool { return t.Seek(t.pos - 1) }
+
+// SeekState moves forward to the next snapshot in which the entry of key
+// has changed to state, such as the one where a deleted entry was
+// expunged, and reports whether there is one. It stays where it is if
+// not.
+func (t *Timeline) SeekState(key interface{}, state sync.MapEntryState) bool {
+	has := func(i int) bool {
+		e, ok := t.snaps[i].Entry(key)
+		return ok && e.State == state
+	}
+	for i := t.pos + 1; i < len(t.snaps); i++ {
+		if has(i) && !has(i-1) {
+			t.pos = i
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,88 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package mapsim_test
+
+import (
+	"elements/mapsim"
+	"sync"
+	"testing"
+)
+
+func TestRecord(t *testing.T) {
+	sim := mapsim.New(mapsim.Config{Record: true})
+	sim.Run(func(m *sync.Map) { m.Store("k1", "v1") })
+	sim.Run(func(m *sync.Map) { m.Load("k1") })
+	h := sim.History()
+	// Store: dirty-created, dirty-stored, 结束; Load: miss, promoted, 结束
+	if len(h) != 6 {
+		t.Fatalf("%d snapshots, want 6", len(h))
+	}
+	for i, want := range []int{-1, -1, 0, -1, -1, 1} {
+		if h[i].Op != want || (h[i].Event == nil) != (want >= 0) {
+			t.Errorf("snapshot %d: op %d event %v, want op %d", i, h[i].Op, h[i].Event, want)
+		}
+	}
+	if e, ok := h[1].Entry("k1"); !ok || e.State != sync.MapEntryLive || e.Value != "v1" {
+		t.Errorf("k1 at dirty-stored = %+v, %v", e, ok)
+	}
+	if h[1].State.Read != nil || len(h[1].State.Dirty) != 1 {
+		t.Errorf("at dirty-stored: %+v", h[1].State)
+	}
+	if s := h[5].State; len(s.Read) != 1 || s.Dirty != nil || s.Amended {
+		t.Errorf("after the promotion: %+v", s)
+	}
+
+	if h := mapsim.New(mapsim.Config{}).History(); h != nil {
+		t.Errorf("History without Record = %v", h)
+	}
+}
+
+// TestTimelineExpunged finds the snapshot where a deleted key was
+// expunged: the creation of the next dirty map, before the new key is in.
+func TestTimelineExpunged(t *testing.T) {
+	sim := mapsim.New(mapsim.Config{Record: true})
+	sim.Run(func(m *sync.Map) { m.Store("k1", "v1") })
+	sim.Run(func(m *sync.Map) { m.Load("k1") })
+	sim.Run(func(m *sync.Map) { m.Delete("k1") })
+	sim.Run(func(m *sync.Map) { m.Store("k2", "v2") })
+
+	tl := sim.Timeline()
+	if tl.Len() != len(sim.History()) || tl.Pos() != 0 {
+		t.Fatalf("Len %d Pos %d, want %d and 0", tl.Len(), tl.Pos(), len(sim.History()))
+	}
+	if !tl.SeekState("k1", sync.MapEntryDeleted) {
+		t.Fatal("k1 never deleted")
+	}
+	if s := tl.At(); s.Op != 2 {
+		t.Errorf("k1 deleted at %+v, want the end of Delete", s)
+	}
+	if !tl.SeekState("k1", sync.MapEntryExpunged) {
+		t.Fatal("k1 never expunged")
+	}
+	s := tl.At()
+	if s.Event == nil || s.Event.Transition != sync.MapDirtyCreated || s.Event.Key != "k2" {
+		t.Errorf("k1 expunged at %+v, want dirty-created k2", s)
+	}
+	if len(s.State.Dirty) != 0 {
+		t.Errorf("dirty at dirty-created = %v, want empty", s.State.Dirty)
+	}
+
+	pos := tl.Pos()
+	if !tl.Back() || tl.Pos() != pos-1 {
+		t.Fatalf("Back from %d: at %d", pos, tl.Pos())
+	}
+	if e, _ := tl.At().Entry("k1"); e.State != sync.MapEntryDeleted {
+		t.Errorf("k1 before the expunge = %v, want deleted", e.State)
+	}
+	if !tl.Forward() || tl.Pos() != pos {
+		t.Errorf("Forward: at %d, want %d", tl.Pos(), pos)
+	}
+	if tl.SeekState("k1", sync.MapEntryExpunged) || tl.Pos() != pos {
+		t.Errorf("k1 expunged again, at %d", tl.Pos())
+	}
+	if tl.Seek(tl.Len()) || tl.Seek(-1) || tl.Pos() != pos {
+		t.Errorf("Seek out of range moved to %d", tl.Pos())
+	}
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// An EWMA is an exponentially weighted moving average: each Update moves
+// the average a fraction alpha of the way towards the new sample, so the
+// weight of a sample decays by 1-alpha with every later one. It is safe
+// for concurrent use and takes no lock.
+//
+// The Map's adaptive promotion policy in package sync keeps the same kind
+// of average of its write rate, under the Map's mutex; sync cannot import
+// this package.
+type EWMA struct {
+	alpha float64
+	v     uint64 // math.Float64bits; NaN until the first Update
+}
+
+// NewEWMA returns an EWMA giving each new sample the weight alpha, which
+// must be in (0, 1]. An alpha of 2/(n+1) averages over roughly the last n
+// samples. The average starts at the first sample.
+func NewEWMA(alpha float64) *EWMA {
+	if !(alpha > 0 && alpha <= 1) {
+		panic("metrics: EWMA alpha must be in (0, 1]")
+	}
+	return &EWMA{alpha: alpha, v: math.Float64bits(math.NaN())}
+}
+
+// Update adds the sample x to the average.
+func (e *EWMA) Update(x float64) {
+	for {
+		old := atomic.LoadUint64(&e.v)
+		v := math.Float64frombits(old)
+		if math.IsNaN(v) {
+			v = x
+		} else {
+			v += e.alpha * (x - v)
+		}
+		if atomic.CompareAndSwapUint64(&e.v, old, math.Float64bits(v)) {
+			return
+		}
+	}
+}
+
+// Value returns the current average, or 0 before the first Update.
+func (e *EWMA) Value() float64 {
+	v := math.Float64frombits(atomic.LoadUint64(&e.v))
+	if math.IsNaN(v) {
+		return 0
+	}
+	return v
+}
+
+// Reset forgets all samples; the next Update starts the average again.
+func (e *EWMA) Reset() {
+	atomic.StoreUint64(&e.v, math.Float64bits(math.NaN()))
+}
+
+// A MovingAverage is the plain mean of the last n samples. It is safe
+// for concurrent use; Update is two atomic operations and takes no lock,
+// and Value reads all n samples.
+//
+// Concurrent Updates each claim their own slot, but a Value running at
+// the same time may see a slot before it is written, and count the
+// sample it replaces instead.
+type MovingAverage struct {
+	next    uint64   // number of Updates
+	samples []uint64 // math.Float64bits, ring indexed by Update number
+}
+
+// NewMovingAverage returns a MovingAverage of the last n samples.
+func NewMovingAverage(n int) *MovingAverage {
+	if n <= 0 {
+		panic("metrics: MovingAverage of no samples")
+	}
+	return &MovingAverage{samples: make([]uint64, n)}
+}
+
+// Update adds the sample x, replacing the oldest one if there are n.
+func (m *MovingAverage) Update(x float64) {
+	i := atomic.AddUint64(&m.next, 1) - 1
+	atomic.StoreUint64(&m.samples[i%uint64(len(m.samples))], math.Float64bits(x))
+}
+
+// Value returns the mean of the last n samples, or of all of them if there
+// have been fewer, or 0 if there have been none.
+func (m *MovingAverage) Value() float64 {
+	n := atomic.LoadUint64(&m.next)
+	if n == 0 {
+		return 0
+	}
+	if n > uint64(len(m.samples)) {
+		n = uint64(len(m.samples))
+	}
+	// 少于n个样本时只有前n个槽被写过
+	var sum float64
+	for i := uint64(0); i < n; i++ {
+		sum += math.Float64frombits(atomic.LoadUint64(&m.samples[i]))
+	}
+	return sum / float64(n)
+}
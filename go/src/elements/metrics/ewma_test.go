@@ -0,0 +1,112 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics_test
+
+import (
+	"elements/metrics"
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestEWMA(t *testing.T) {
+	e := metrics.NewEWMA(0.5)
+	if v := e.Value(); v != 0 {
+		t.Errorf("Value before Update = %v, want 0", v)
+	}
+	for _, c := range []struct{ x, want float64 }{
+		{10, 10}, {20, 15}, {20, 17.5}, {0, 8.75},
+	} {
+		e.Update(c.x)
+		if v := e.Value(); v != c.want {
+			t.Errorf("after Update(%v): Value = %v, want %v", c.x, v, c.want)
+		}
+	}
+	e.Reset()
+	e.Update(3)
+	if v := e.Value(); v != 3 {
+		t.Errorf("after Reset and Update(3): Value = %v, want 3", v)
+	}
+}
+
+// 所有样本相同时, 不管更新的先后顺序如何, 并发更新后平均值都是那个样本;
+// 从0和1交替的样本中平均值不会跑出[0, 1]
+func TestEWMAConcurrent(t *testing.T) {
+	e := metrics.NewEWMA(0.1)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 10000; i++ {
+				e.Update(float64((g + i) % 2))
+			}
+		}(g)
+	}
+	wg.Wait()
+	if v := e.Value(); v < 0 || v > 1 {
+		t.Errorf("Value = %v, want within [0, 1]", v)
+	}
+	e.Reset()
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				e.Update(7)
+			}
+		}()
+	}
+	wg.Wait()
+	if v := e.Value(); v != 7 {
+		t.Errorf("Value = %v, want 7", v)
+	}
+}
+
+func TestNewEWMAPanics(t *testing.T) {
+	for _, alpha := range []float64{0, -1, 1.5, math.NaN()} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewEWMA(%v) did not panic", alpha)
+				}
+			}()
+			metrics.NewEWMA(alpha)
+		}()
+	}
+}
+
+func TestMovingAverage(t *testing.T) {
+	m := metrics.NewMovingAverage(3)
+	if v := m.Value(); v != 0 {
+		t.Errorf("Value before Update = %v, want 0", v)
+	}
+	for _, c := range []struct{ x, want float64 }{
+		{3, 3}, {6, 4.5}, {9, 6}, {12, 9}, {0, 7},
+	} {
+		m.Update(c.x)
+		if v := m.Value(); v != c.want {
+			t.Errorf("after Update(%v): Value = %v, want %v", c.x, v, c.want)
+		}
+	}
+}
+
+func TestMovingAverageConcurrent(t *testing.T) {
+	m := metrics.NewMovingAverage(100)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10000; i++ {
+				m.Update(5)
+			}
+		}()
+	}
+	wg.Wait()
+	if v := m.Value(); v != 5 {
+		t.Errorf("Value = %v, want 5", v)
+	}
+}
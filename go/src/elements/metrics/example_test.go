@@ -0,0 +1,69 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics_test
+
+import (
+	"elements/metrics"
+	"fmt"
+	"sync"
+	"time"
+)
+
+func ExampleKeyedWindow() {
+	requests := metrics.NewKeyedWindow(metrics.WindowConfig{Width: time.Second, Buckets: 60})
+	for _, client := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.1", "10.0.0.1"} {
+		requests.Incr(client)
+		if requests.CountLast(client, time.Minute) > 2 {
+			fmt.Println("throttle", client)
+		}
+	}
+	// Output: throttle 10.0.0.1
+}
+
+func ExampleHistogram() {
+	// 1%的相对误差
+	latency := metrics.NewHistogram(metrics.HistogramConfig{Accuracy: 0.01})
+	for ms := 1; ms <= 1000; ms++ {
+		latency.Observe(float64(ms) / 1000)
+	}
+	s := latency.Snapshot()
+	fmt.Printf("n=%d mean=%.4f p50=%.4f p99=%.4f\n", s.Count, s.Mean(), s.Quantile(0.5), s.Quantile(0.99))
+	// Output: n=1000 mean=0.5005 p50=0.5015 p99=0.9900
+}
+
+func ExampleEWMA() {
+	// 最近大约20个请求的平均延迟(毫秒), 超过100就拒绝新的请求
+	latency := metrics.NewEWMA(2.0 / 21)
+	for i := 0; i < 30; i++ {
+		ms := 20.0
+		if i >= 10 {
+			ms = 200 // 下游变慢了
+		}
+		latency.Update(ms)
+		if latency.Value() > 100 {
+			fmt.Printf("shedding after request %d: %.0fms\n", i, latency.Value())
+			break
+		}
+	}
+	// Output: shedding after request 15: 101ms
+}
+
+func ExampleTopK_MapHook() {
+	misses := metrics.NewTopK(10)
+	m := sync.NewMap(sync.WithTransitionHook(misses.MapHook()))
+	for _, k := range []string{"user:1", "user:2", "user:3"} {
+		m.Store(k, k)
+	}
+	// 新的key都还在dirty中, 这几次Load都要加锁
+	for _, k := range []string{"user:1", "user:2", "user:1", "user:1"} {
+		m.Load(k)
+	}
+	for _, h := range misses.Top(2) {
+		fmt.Println(h.Key, h.Count)
+	}
+	// Output:
+	// user:1 3
+	// user:2 1
+}
@@ -0,0 +1,258 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"math"
+	"sort"
+	"sync/atomic"
+)
+
+// HistogramConfig configures a Histogram.
+//
+// With Accuracy zero, the Histogram counts values into the fixed buckets
+// given by Bounds. With Accuracy set, it is a DDSketch: buckets are spaced
+// logarithmically so that every quantile is within a relative error of
+// Accuracy, whatever the distribution of the values, and Bounds is
+// ignored.
+type HistogramConfig struct {
+	// Bounds are the inclusive upper bounds of the buckets, in increasing
+	// order. Values above the last bound are counted in one more bucket.
+	Bounds []float64
+
+	// Accuracy is the relative error of quantiles in sketch mode, for
+	// example 0.01 for 1%.
+	Accuracy float64
+
+	// Min and Max are the range of values tracked accurately in sketch
+	// mode; values outside it are counted at Min or Max. Zero means 1e-9
+	// and 1e9, enough for latencies in seconds from a nanosecond to
+	// thirty years.
+	Min, Max float64
+}
+
+// A Histogram counts observed values into buckets and estimates their
+// quantiles. It is safe for concurrent use; Observe is a few atomic
+// operations and takes no lock.
+type Histogram struct {
+	l      layout
+	counts []uint64
+	count  uint64
+	sum    uint64 // math.Float64bits
+}
+
+// A layout maps values to buckets and buckets back to values.
+type layout interface {
+	index(v float64) int
+	// value returns the value estimating the frac-th part of the way
+	// through bucket i.
+	value(i int, frac float64) float64
+	// upper returns the inclusive upper bound of bucket i.
+	upper(i int) float64
+	len() int
+}
+
+// NewHistogram returns a Histogram configured by cfg. It panics if
+// neither Bounds nor Accuracy is set, or if Bounds are not increasing.
+func NewHistogram(cfg HistogramConfig) *Histogram {
+	var l layout
+	if cfg.Accuracy > 0 {
+		l = newSketchLayout(cfg.Accuracy, cfg.Min, cfg.Max)
+	} else {
+		if len(cfg.Bounds) == 0 {
+			panic("metrics: histogram with neither Bounds nor Accuracy")
+		}
+		if !sort.Float64sAreSorted(cfg.Bounds) {
+			panic("metrics: histogram Bounds are not increasing")
+		}
+		l = fixedLayout(append([]float64(nil), cfg.Bounds...))
+	}
+	return &Histogram{l: l, counts: make([]uint64, l.len())}
+}
+
+// Observe records the value v.
+func (h *Histogram) Observe(v float64) {
+	atomic.AddUint64(&h.counts[h.l.index(v)], 1)
+	atomic.AddUint64(&h.count, 1)
+	for {
+		old := atomic.LoadUint64(&h.sum)
+		if atomic.CompareAndSwapUint64(&h.sum, old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+// Snapshot returns a copy of the current counts.
+//
+// The copy is not atomic: values observed while it is taken may be
+// missing from some of Count, Sum and the buckets, so Count can differ
+// slightly from the sum of the buckets.
+func (h *Histogram) Snapshot() *HistogramSnapshot {
+	s := &HistogramSnapshot{l: h.l, counts: make([]uint64, len(h.counts))}
+	for i := range h.counts {
+		s.counts[i] = atomic.LoadUint64(&h.counts[i])
+		s.total += s.counts[i]
+	}
+	s.Count = atomic.LoadUint64(&h.count)
+	s.Sum = math.Float64frombits(atomic.LoadUint64(&h.sum))
+	return s
+}
+
+// Quantile is shorthand for h.Snapshot().Quantile(q).
+func (h *Histogram) Quantile(q float64) float64 {
+	return h.Snapshot().Quantile(q)
+}
+
+// A HistogramSnapshot is a copy of a Histogram's counts.
+type HistogramSnapshot struct {
+	Count uint64  // number of values observed
+	Sum   float64 // sum of the values observed
+
+	l      layout
+	counts []uint64
+	total  uint64 // sum of counts
+}
+
+// Mean returns the mean of the values observed, or NaN if there are none.
+func (s *HistogramSnapshot) Mean() float64 {
+	if s.Count == 0 {
+		return math.NaN()
+	}
+	return s.Sum / float64(s.Count)
+}
+
+// Quantile returns an estimate of the q-quantile of the values observed,
+// for q in [0, 1], or NaN if there are none.
+//
+// With fixed buckets the value is interpolated linearly inside the bucket
+// holding the quantile, so its error depends on how wide that bucket is;
+// above the last bound it is the last bound. In sketch mode it is within
+// the configured relative accuracy of some value observed at that rank.
+func (s *HistogramSnapshot) Quantile(q float64) float64 {
+	if s.total == 0 || math.IsNaN(q) {
+		return math.NaN()
+	}
+	if q < 0 {
+		q = 0
+	} else if q > 1 {
+		q = 1
+	}
+	rank := q * float64(s.total)
+	var cum uint64
+	for i, c := range s.counts {
+		if c == 0 {
+			continue
+		}
+		if float64(cum+c) >= rank {
+			return s.l.value(i, (rank-float64(cum))/float64(c))
+		}
+		cum += c
+	}
+	// 浮点的误差让rank稍微超过了total
+	for i := len(s.counts) - 1; ; i-- {
+		if s.counts[i] != 0 {
+			return s.l.value(i, 1)
+		}
+	}
+}
+
+// Buckets calls f for each non-empty bucket, in increasing order, with an
+// inclusive upper bound of the values in it and its count. The bound of
+// the bucket above the last of fixed Bounds is +Inf.
+func (s *HistogramSnapshot) Buckets(f func(upper float64, count uint64)) {
+	for i, c := range s.counts {
+		if c != 0 {
+			f(s.l.upper(i), c)
+		}
+	}
+}
+
+// fixedLayout is the bucket upper bounds given by the user. Bucket i
+// holds (bounds[i-1], bounds[i]], and bucket len(bounds) the rest.
+type fixedLayout []float64
+
+func (b fixedLayout) index(v float64) int { return sort.SearchFloat64s(b, v) }
+
+func (b fixedLayout) len() int { return len(b) + 1 }
+
+func (b fixedLayout) upper(i int) float64 {
+	if i == len(b) {
+		return math.Inf(1)
+	}
+	return b[i]
+}
+
+func (b fixedLayout) value(i int, frac float64) float64 {
+	if i == len(b) {
+		return b[len(b)-1]
+	}
+	// 第一个桶的下界: 像延迟这样的非负值从0开始
+	lo := math.Min(0, b[0])
+	if i > 0 {
+		lo = b[i-1]
+	}
+	return lo + (b[i]-lo)*frac
+}
+
+// sketchLayout is DDSketch's logarithmic mapping: with gamma =
+// (1+a)/(1-a), bucket i holds (gamma^(i-1), gamma^i], and every value in
+// it is within a relative error a of 2*gamma^i/(gamma+1). Indexes are
+// shifted so that bucket 0 holds everything up to min.
+type sketchLayout struct {
+	gamma    float64
+	logGamma float64
+	offset   int // index of min
+	n        int
+}
+
+func newSketchLayout(accuracy, min, max float64) *sketchLayout {
+	if accuracy >= 1 {
+		panic("metrics: histogram Accuracy must be below 1")
+	}
+	if min <= 0 {
+		min = 1e-9
+	}
+	if max <= 0 {
+		max = 1e9
+	}
+	if max <= min {
+		panic("metrics: histogram Max must be above Min")
+	}
+	gamma := (1 + accuracy) / (1 - accuracy)
+	l := &sketchLayout{gamma: gamma, logGamma: math.Log(gamma)}
+	l.offset = l.rawIndex(min)
+	l.n = l.rawIndex(max) - l.offset + 1
+	return l
+}
+
+func (l *sketchLayout) rawIndex(v float64) int {
+	return int(math.Ceil(math.Log(v) / l.logGamma))
+}
+
+func (l *sketchLayout) index(v float64) int {
+	// 小于min的(包括0和负数)都算作min, 大于max的都算作max
+	if !(v > 0) {
+		return 0
+	}
+	i := l.rawIndex(v) - l.offset
+	if i < 0 {
+		return 0
+	}
+	if i >= l.n {
+		return l.n - 1
+	}
+	return i
+}
+
+func (l *sketchLayout) len() int { return l.n }
+
+func (l *sketchLayout) upper(i int) float64 {
+	return math.Pow(l.gamma, float64(i+l.offset))
+}
+
+func (l *sketchLayout) value(i int, frac float64) float64 {
+	// 桶内的值没有更多的信息, 用相对误差最小的那个值代表整个桶
+	return 2 * math.Pow(l.gamma, float64(i+l.offset)) / (l.gamma + 1)
+}
@@ -0,0 +1,139 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics_test
+
+import (
+	"elements/metrics"
+	"math"
+	"math/rand"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestHistogramFixed(t *testing.T) {
+	h := metrics.NewHistogram(metrics.HistogramConfig{Bounds: []float64{1, 2, 4}})
+	for _, v := range []float64{0.5, 1, 1.5, 3, 3, 10} {
+		h.Observe(v)
+	}
+	s := h.Snapshot()
+	if s.Count != 6 || s.Sum != 19 || s.Mean() != 19.0/6 {
+		t.Errorf("Count, Sum, Mean = %d, %v, %v", s.Count, s.Sum, s.Mean())
+	}
+	var got []float64
+	s.Buckets(func(upper float64, count uint64) {
+		got = append(got, upper, float64(count))
+	})
+	want := []float64{1, 2, 2, 1, 4, 2, math.Inf(1), 1}
+	if !equal(got, want) {
+		t.Errorf("Buckets = %v, want %v", got, want)
+	}
+	// 第3个值是(1, 2]中唯一的值, 插值到桶的上界; 超过最后一个上界的算作最后一个上界
+	for _, c := range []struct{ q, want float64 }{
+		{0, 0}, {1.0 / 6, 0.5}, {0.5, 2}, {4.5 / 6, 3.5}, {1, 4},
+	} {
+		if v := s.Quantile(c.q); v != c.want {
+			t.Errorf("Quantile(%v) = %v, want %v", c.q, v, c.want)
+		}
+	}
+}
+
+func TestHistogramEmpty(t *testing.T) {
+	h := metrics.NewHistogram(metrics.HistogramConfig{Accuracy: 0.01})
+	if v := h.Quantile(0.5); !math.IsNaN(v) {
+		t.Errorf("Quantile of nothing = %v, want NaN", v)
+	}
+	if v := h.Snapshot().Mean(); !math.IsNaN(v) {
+		t.Errorf("Mean of nothing = %v, want NaN", v)
+	}
+}
+
+// 草图模式下每个分位数和真实值的相对误差都在Accuracy之内, 不管值的分布如何
+func TestHistogramSketchAccuracy(t *testing.T) {
+	const accuracy = 0.01
+	r := rand.New(rand.NewSource(1))
+	for name, gen := range map[string]func() float64{
+		"uniform":     func() float64 { return r.Float64() * 100 },
+		"exponential": func() float64 { return r.ExpFloat64() * 1e-3 },
+		"pareto":      func() float64 { return math.Pow(1-r.Float64(), -1/1.2) },
+	} {
+		h := metrics.NewHistogram(metrics.HistogramConfig{Accuracy: accuracy})
+		vs := make([]float64, 10000)
+		for i := range vs {
+			vs[i] = gen()
+			h.Observe(vs[i])
+		}
+		sort.Float64s(vs)
+		for _, q := range []float64{0.01, 0.25, 0.5, 0.9, 0.99, 0.999} {
+			exact := vs[int(math.Ceil(q*float64(len(vs))))-1]
+			if got := h.Quantile(q); math.Abs(got-exact) > accuracy*exact*1.0001 {
+				t.Errorf("%s: Quantile(%v) = %v, exact %v", name, q, got, exact)
+			}
+		}
+	}
+}
+
+func TestHistogramSketchRange(t *testing.T) {
+	h := metrics.NewHistogram(metrics.HistogramConfig{Accuracy: 0.01, Min: 1, Max: 100})
+	h.Observe(0)
+	h.Observe(-5)
+	h.Observe(1e6)
+	if lo, hi := h.Quantile(0), h.Quantile(1); math.Abs(lo-1) > 0.01 || math.Abs(hi-100) > 1 {
+		t.Errorf("out-of-range values at %v and %v, want near 1 and 100", lo, hi)
+	}
+}
+
+func TestHistogramConcurrent(t *testing.T) {
+	h := metrics.NewHistogram(metrics.HistogramConfig{Bounds: []float64{10, 100}})
+	const goroutines, n = 8, 10000
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				h.Observe(float64(i % 200))
+			}
+		}()
+	}
+	wg.Wait()
+	s := h.Snapshot()
+	var total uint64
+	s.Buckets(func(_ float64, c uint64) { total += c })
+	want := float64(goroutines) * n / 200 * (199 * 200 / 2)
+	if s.Count != goroutines*n || total != s.Count || s.Sum != want {
+		t.Errorf("Count %d, buckets %d, Sum %v; want %d, %d, %v", s.Count, total, s.Sum, goroutines*n, goroutines*n, want)
+	}
+}
+
+func TestHistogramConfigPanics(t *testing.T) {
+	for name, cfg := range map[string]metrics.HistogramConfig{
+		"empty":    {},
+		"unsorted": {Bounds: []float64{2, 1}},
+		"accuracy": {Accuracy: 1},
+		"range":    {Accuracy: 0.01, Min: 10, Max: 1},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: NewHistogram did not panic", name)
+				}
+			}()
+			metrics.NewHistogram(cfg)
+		}()
+	}
+}
+
+func equal(a, b []float64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
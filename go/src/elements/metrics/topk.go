@@ -0,0 +1,157 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics
+
+import (
+	"container/heap"
+	"sort"
+	"sync"
+)
+
+// A TopK finds the most frequent keys of a stream in bounded memory, with
+// the Space-Saving algorithm of Metwally, Agrawal and El Abbadi. It keeps
+// k counters; when a key without one arrives, it takes over the counter
+// with the smallest count and adds to it. A key occurring more than
+// total/k times is therefore always counted, and every count is an
+// overestimate by at most its Error.
+//
+// A TopK is safe for concurrent use. Updates take a mutex for a map
+// lookup and a heap fix, so it suits streams such as a Map's misses
+// better than every Load of a hot map.
+type TopK struct {
+	mu      sync.Mutex
+	k       int
+	keys    map[interface{}]*hitter
+	byCount hitterHeap // min-heap: the counter to take over is at 0
+}
+
+// A HeavyHitter is a key tracked by a TopK.
+type HeavyHitter struct {
+	Key interface{}
+
+	// Count is the estimated number of occurrences of Key. The true
+	// number is between Count-Error and Count.
+	Count uint64
+
+	// Error is the count the key's counter had when Key took it over.
+	Error uint64
+}
+
+type hitter struct {
+	HeavyHitter
+	index int // in byCount
+}
+
+// NewTopK returns a TopK keeping k counters. It reports at most k keys,
+// and keeping a few times more counters than the number of keys of
+// interest makes their counts more accurate.
+func NewTopK(k int) *TopK {
+	if k <= 0 {
+		panic("metrics: TopK with no counters")
+	}
+	return &TopK{k: k, keys: make(map[interface{}]*hitter, k)}
+}
+
+// Add counts one occurrence of key. key must be comparable.
+func (t *TopK) Add(key interface{}) { t.AddN(key, 1) }
+
+// AddN counts n occurrences of key.
+func (t *TopK) AddN(key interface{}, n uint64) {
+	t.mu.Lock()
+	if h, ok := t.keys[key]; ok {
+		h.Count += n
+		heap.Fix(&t.byCount, h.index)
+	} else if len(t.byCount) < t.k {
+		h := &hitter{HeavyHitter: HeavyHitter{Key: key, Count: n}}
+		t.keys[key] = h
+		heap.Push(&t.byCount, h)
+	} else {
+		// 计数最小的key让出它的计数器. 新的key可能在它之前就出现过,
+		// 最多出现过Count次, 所以继承这个计数并记为误差
+		h := t.byCount[0]
+		delete(t.keys, h.Key)
+		h.Key, h.Error = key, h.Count
+		h.Count += n
+		t.keys[key] = h
+		heap.Fix(&t.byCount, 0)
+	}
+	t.mu.Unlock()
+}
+
+// Top returns the tracked keys, most frequent first, at most n of them,
+// or all of them if n <= 0.
+func (t *TopK) Top(n int) []HeavyHitter {
+	t.mu.Lock()
+	s := make([]HeavyHitter, len(t.byCount))
+	for i, h := range t.byCount {
+		s[i] = h.HeavyHitter
+	}
+	t.mu.Unlock()
+	// 计数相同时误差小的更可信
+	sort.Slice(s, func(i, j int) bool {
+		if s[i].Count != s[j].Count {
+			return s[i].Count > s[j].Count
+		}
+		return s[i].Error < s[j].Error
+	})
+	if n > 0 && n < len(s) {
+		s = s[:n]
+	}
+	return s
+}
+
+// Reset forgets all keys.
+func (t *TopK) Reset() {
+	t.mu.Lock()
+	t.keys = make(map[interface{}]*hitter, t.k)
+	t.byCount = nil
+	t.mu.Unlock()
+}
+
+// MapHook returns a function for sync.WithTransitionHook that counts the
+// key of each of the given transitions, or of each MapMiss if none are
+// given. Counting misses finds the keys that most often make Loads take
+// the Map's slow path; counting MapDirtyStored finds the keys stored anew
+// most often, such as ones repeatedly deleted and recreated.
+//
+// The hook runs with the Map's mutex held, as it must; it takes only the
+// TopK's own mutex.
+func (t *TopK) MapHook(transitions ...sync.MapTransition) func(sync.MapEvent) {
+	if len(transitions) == 0 {
+		transitions = []sync.MapTransition{sync.MapMiss}
+	}
+	var want uint64 // 1<<transition
+	for _, tr := range transitions {
+		want |= 1 << uint(tr)
+	}
+	return func(ev sync.MapEvent) {
+		if want&(1<<uint(ev.Transition)) != 0 && ev.Key != nil {
+			t.Add(ev.Key)
+		}
+	}
+}
+
+type hitterHeap []*hitter
+
+func (h hitterHeap) Len() int           { return len(h) }
+func (h hitterHeap) Less(i, j int) bool { return h[i].Count < h[j].Count }
+func (h hitterHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *hitterHeap) Push(x interface{}) {
+	e := x.(*hitter)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *hitterHeap) Pop() interface{} {
+	old := *h
+	e := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return e
+}
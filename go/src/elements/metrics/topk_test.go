@@ -0,0 +1,121 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics_test
+
+import (
+	"elements/metrics"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func TestTopKExact(t *testing.T) {
+	top := metrics.NewTopK(3)
+	for _, k := range []string{"a", "b", "a", "c", "a", "b"} {
+		top.Add(k)
+	}
+	got := top.Top(0)
+	want := []metrics.HeavyHitter{{Key: "a", Count: 3}, {Key: "b", Count: 2}, {Key: "c", Count: 1}}
+	if len(got) != len(want) {
+		t.Fatalf("Top = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Top[%d] = %v, want %v", i, got[i], want[i])
+		}
+	}
+	if got := top.Top(1); len(got) != 1 || got[0].Key != "a" {
+		t.Errorf("Top(1) = %v", got)
+	}
+	top.Reset()
+	if got := top.Top(0); len(got) != 0 {
+		t.Errorf("Top after Reset = %v", got)
+	}
+}
+
+// Space-Saving的保证: 出现次数超过total/k的key一定被保留, 每个计数在
+// [真实次数, 真实次数+Error]之间
+func TestTopKGuarantees(t *testing.T) {
+	const k, total = 20, 100000
+	r := rand.New(rand.NewSource(1))
+	top := metrics.NewTopK(k)
+	exact := make(map[int]uint64)
+	for i := 0; i < total; i++ {
+		// 热key 0..4占一半, 其余的均匀地分布在10000个key上
+		key := 5 + r.Intn(10000)
+		if r.Intn(2) == 0 {
+			key = r.Intn(5)
+		}
+		exact[key]++
+		top.Add(key)
+	}
+	tracked := make(map[interface{}]metrics.HeavyHitter)
+	for _, h := range top.Top(0) {
+		tracked[h.Key] = h
+		if e := exact[h.Key.(int)]; h.Count < e || h.Count-h.Error > e {
+			t.Errorf("key %v: Count %d, Error %d, exact %d", h.Key, h.Count, h.Error, e)
+		}
+	}
+	for key, n := range exact {
+		if _, ok := tracked[key]; n > total/k && !ok {
+			t.Errorf("key %d occurred %d > total/k times but is not tracked", key, n)
+		}
+	}
+	for i, h := range top.Top(5) {
+		if h.Key.(int) >= 5 {
+			t.Errorf("Top(5)[%d] = %v, want a hot key", i, h)
+		}
+	}
+}
+
+func TestTopKConcurrent(t *testing.T) {
+	top := metrics.NewTopK(4)
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 10000; i++ {
+				top.Add(i % 4)
+			}
+		}()
+	}
+	wg.Wait()
+	for _, h := range top.Top(0) {
+		if h.Count != 20000 || h.Error != 0 {
+			t.Errorf("%v, want Count 20000 and Error 0", h)
+		}
+	}
+}
+
+func TestTopKMapHook(t *testing.T) {
+	top := metrics.NewTopK(2)
+	m := sync.NewMap(sync.WithTransitionHook(top.MapHook()))
+	m.Store("hot", 1)
+	m.Store("cold", 2)
+	// 两个key都在dirty中, Load每次都是miss, 直到提升
+	for i := 0; i < 3; i++ {
+		m.Load("hot")
+	}
+	got := top.Top(0)
+	if len(got) == 0 || got[0].Key != "hot" {
+		t.Errorf("Top = %v, want hot first", got)
+	}
+	for _, h := range got {
+		if h.Key == "cold" {
+			t.Errorf("cold was never loaded but counted: %v", h)
+		}
+	}
+
+	stores := metrics.NewTopK(2)
+	m = sync.NewMap(sync.WithTransitionHook(stores.MapHook(sync.MapDirtyStored)))
+	m.Store("a", 1)
+	m.Store("b", 2)
+	m.Load("a") // miss, 不计数
+	got = stores.Top(0)
+	if len(got) != 2 || got[0].Count != 1 || got[1].Count != 1 {
+		t.Errorf("stores = %v, want a and b stored once each", got)
+	}
+}
@@ -0,0 +1,172 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package metrics provides concurrent counters and summaries cheap enough
+// to update on every request: sliding-window counts, histograms, moving
+// averages and heavy hitters.
+//
+// Updates are atomic operations on preallocated memory, without locks on
+// the hot path, so that measuring a fast operation does not make it slow
+// or serialize the goroutines performing it.
+package metrics
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// WindowConfig configures a Window.
+type WindowConfig struct {
+	// Width is the time covered by one bucket, and the resolution of the
+	// counts. Zero means one second.
+	Width time.Duration
+
+	// Buckets is the number of buckets. The longest window that can be
+	// counted is Width*Buckets. Zero means 60.
+	Buckets int
+}
+
+func (c *WindowConfig) width() int64 {
+	if c.Width <= 0 {
+		return int64(time.Second)
+	}
+	return int64(c.Width)
+}
+
+func (c *WindowConfig) buckets() int {
+	if c.Buckets <= 0 {
+		return 60
+	}
+	return c.Buckets
+}
+
+// A Window counts events over a sliding window of time. It is safe for
+// concurrent use; Incr is a few atomic operations and takes no lock.
+//
+// Time is cut into buckets of Width, kept in a ring. Each bucket is one
+// 64-bit word holding the low 32 bits of the bucket's time index next to
+// its count, so that moving a bucket on to a new time and counting in it
+// are the same compare-and-swap: an increment can never land in a bucket
+// that has just been reset, nor be wiped by the reset. A bucket holds up
+// to 2^32-1 events, and stays at that count once it gets there.
+type Window struct {
+	width   int64
+	buckets []uint64 // index<<32 | count
+}
+
+// NewWindow returns a Window configured by cfg.
+func NewWindow(cfg WindowConfig) *Window {
+	return &Window{width: cfg.width(), buckets: make([]uint64, cfg.buckets())}
+}
+
+// Incr counts one event now.
+func (w *Window) Incr() { w.Add(1) }
+
+// Add counts n events now.
+func (w *Window) Add(n uint32) {
+	idx := time.Now().UnixNano() / w.width
+	b := &w.buckets[idx%int64(len(w.buckets))]
+	tag := uint64(uint32(idx)) << 32
+	for {
+		old := atomic.LoadUint64(b)
+		if old&^(1<<32-1) == tag {
+			// 桶已经是当前的时间. 不能直接AddUint64: 计数溢出的话会进位到
+			// 标记中, 整个桶就被当成别的一圈丢掉了. 到了上限就不再增加
+			count := old&(1<<32-1) + uint64(n)
+			if count > 1<<32-1 {
+				count = 1<<32 - 1
+			}
+			if count == old&(1<<32-1) || atomic.CompareAndSwapUint64(b, old, tag|count) {
+				return
+			}
+			continue
+		}
+		// 桶中是一圈之前的计数: 换成当前的时间, 同时计入这次的事件
+		if atomic.CompareAndSwapUint64(b, old, tag|uint64(n)) {
+			return
+		}
+	}
+}
+
+// CountLast returns the number of events counted in the last window,
+// which is rounded up to a whole number of buckets and capped at
+// Width*Buckets. The bucket in progress counts in full, so the result
+// covers between window-Width and window of the past.
+func (w *Window) CountLast(window time.Duration) uint64 {
+	k := (int64(window) + w.width - 1) / w.width
+	if k > int64(len(w.buckets)) {
+		k = int64(len(w.buckets))
+	}
+	idx := time.Now().UnixNano() / w.width
+	var sum uint64
+	for i := idx - k + 1; i <= idx; i++ {
+		v := atomic.LoadUint64(&w.buckets[i%int64(len(w.buckets))])
+		// 标记不是i的是更早的一圈留下的, 这段时间没有事件
+		if v>>32 == uint64(uint32(i)) {
+			sum += v & (1<<32 - 1)
+		}
+	}
+	return sum
+}
+
+// Rate returns the events per second over the last window, as counted by
+// CountLast.
+func (w *Window) Rate(window time.Duration) float64 {
+	k := (int64(window) + w.width - 1) / w.width
+	if k > int64(len(w.buckets)) {
+		k = int64(len(w.buckets))
+	}
+	if k == 0 {
+		return 0
+	}
+	return float64(w.CountLast(window)) / (float64(k*w.width) / float64(time.Second))
+}
+
+// A KeyedWindow keeps a Window per key, created on first use. It is
+// meant for per-client or per-route accounting, where the set of keys is
+// bounded; a Window is never removed unless Delete is called.
+type KeyedWindow struct {
+	cfg WindowConfig
+	m   sync.Map // key -> *Window
+}
+
+// NewKeyedWindow returns a KeyedWindow whose Windows are configured by
+// cfg.
+func NewKeyedWindow(cfg WindowConfig) *KeyedWindow {
+	return &KeyedWindow{cfg: cfg}
+}
+
+// Window returns the Window for key, creating it if needed.
+func (k *KeyedWindow) Window(key interface{}) *Window {
+	if w, ok := k.m.Load(key); ok {
+		return w.(*Window)
+	}
+	// 没有的时候才分配: 大多数调用是已有的key, 不能每次都为LoadOrStore分配一个
+	w, _ := k.m.LoadOrStore(key, NewWindow(k.cfg))
+	return w.(*Window)
+}
+
+// Incr counts one event for key now.
+func (k *KeyedWindow) Incr(key interface{}) { k.Window(key).Add(1) }
+
+// CountLast returns the number of events counted for key in the last
+// window, as Window.CountLast does.
+func (k *KeyedWindow) CountLast(key interface{}, window time.Duration) uint64 {
+	w, ok := k.m.Load(key)
+	if !ok {
+		return 0
+	}
+	return w.(*Window).CountLast(window)
+}
+
+// Delete forgets key's Window.
+func (k *KeyedWindow) Delete(key interface{}) { k.m.Delete(key) }
+
+// Range calls f for each key and its Window, as sync.Map.Range does.
+func (k *KeyedWindow) Range(f func(key interface{}, w *Window) bool) {
+	k.m.Range(func(key, w interface{}) bool {
+		return f(key, w.(*Window))
+	})
+}
@@ -0,0 +1,101 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package metrics_test
+
+import (
+	"elements/metrics"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWindowCounts(t *testing.T) {
+	w := metrics.NewWindow(metrics.WindowConfig{Width: time.Hour, Buckets: 4})
+	for i := 0; i < 10; i++ {
+		w.Incr()
+	}
+	w.Add(5)
+	if n := w.CountLast(time.Hour); n != 15 {
+		t.Errorf("CountLast = %d, want 15", n)
+	}
+	if r := w.Rate(4 * time.Hour); r != 15/(4*3600.0) {
+		t.Errorf("Rate = %v", r)
+	}
+}
+
+// 桶的计数到了上限就停在上限, 不会进位到桶的时间标记中
+func TestWindowSaturates(t *testing.T) {
+	w := metrics.NewWindow(metrics.WindowConfig{Width: time.Hour, Buckets: 4})
+	w.Add(1<<32 - 1)
+	w.Add(2)
+	// 两次Add之间可能刚好跨过了桶的边界, 那样的话两个桶各自计数
+	if n := w.CountLast(2 * time.Hour); n < 1<<32-1 {
+		t.Errorf("CountLast = %d after overflowing a bucket, want at least %d", n, uint64(1<<32-1))
+	}
+}
+
+func TestWindowSlides(t *testing.T) {
+	const width = 20 * time.Millisecond
+	w := metrics.NewWindow(metrics.WindowConfig{Width: width, Buckets: 3})
+	w.Add(7)
+	time.Sleep(width)
+	w.Add(1)
+	if n := w.CountLast(3 * width); n != 8 {
+		t.Fatalf("CountLast(3 buckets) = %d, want 8", n)
+	}
+	// 一整圈之后, 环中只剩下一圈之前的计数, 都不应该算进去
+	time.Sleep(4 * width)
+	if n := w.CountLast(3 * width); n != 0 {
+		t.Fatalf("CountLast after a full turn = %d, want 0", n)
+	}
+	// 重新使用旧的桶: 旧的计数被换掉, 不是加上去
+	w.Add(2)
+	if n := w.CountLast(width); n != 2 {
+		t.Fatalf("CountLast in a reused bucket = %d, want 2", n)
+	}
+}
+
+// 并发的Incr跨越桶的边界: 每个事件都被计入, 重置桶不会丢掉刚刚计入的事件
+func TestWindowConcurrent(t *testing.T) {
+	w := metrics.NewWindow(metrics.WindowConfig{Width: time.Millisecond, Buckets: 1000})
+	const goroutines, n = 8, 20000
+	var wg sync.WaitGroup
+	start := time.Now()
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				w.Incr()
+			}
+		}()
+	}
+	wg.Wait()
+	if time.Since(start) > 900*time.Millisecond {
+		t.Skip("too slow to stay within the window")
+	}
+	if got := w.CountLast(time.Second); got != goroutines*n {
+		t.Errorf("CountLast = %d, want %d", got, goroutines*n)
+	}
+}
+
+func TestKeyedWindow(t *testing.T) {
+	k := metrics.NewKeyedWindow(metrics.WindowConfig{Width: time.Hour})
+	k.Incr("/a")
+	k.Incr("/a")
+	k.Incr("/b")
+	if a, b, c := k.CountLast("/a", time.Hour), k.CountLast("/b", time.Hour), k.CountLast("/c", time.Hour); a != 2 || b != 1 || c != 0 {
+		t.Errorf("counts = %d %d %d, want 2 1 0", a, b, c)
+	}
+	n := 0
+	k.Range(func(key interface{}, w *metrics.Window) bool {
+		n++
+		return true
+	})
+	k.Delete("/a")
+	if n != 2 || k.CountLast("/a", time.Hour) != 0 {
+		t.Errorf("Range saw %d keys; /a after Delete = %d", n, k.CountLast("/a", time.Hour))
+	}
+}
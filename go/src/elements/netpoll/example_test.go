@@ -0,0 +1,72 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package netpoll_test
+
+import (
+	"elements/netpoll"
+	"fmt"
+)
+
+// This example traces a goroutine that holds a mutex while it waits for
+// I/O. G1 parks in the poller with the lock held, so G2 parks on the
+// lock; once G3 writes, the poller readies G1, and G1's Unlock readies G2.
+func ExampleLoop() {
+	l, err := netpoll.NewLoop(netpoll.Config{Trace: func(e netpoll.Event) {
+		fmt.Println(e)
+	}})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer l.Close()
+	r, w, err := l.Pipe()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	mu := l.NewMutex()
+
+	l.Go(func() {
+		mu.Lock()
+		buf := make([]byte, 5)
+		n, _ := r.Read(buf)
+		l.Log("read " + string(buf[:n]))
+		mu.Unlock()
+	})
+	l.Go(func() {
+		mu.Lock()
+		l.Log("locked")
+		mu.Unlock()
+	})
+	l.Go(func() {
+		w.Write([]byte("hello"))
+	})
+	if err := l.Run(); err != nil {
+		fmt.Println(err)
+	}
+	r.Close()
+	w.Close()
+	// Output:
+	// 1    go     G1
+	// 2    go     G2
+	// 3    go     G3
+	// 4    run    G1
+	// 5    park   G1 (IO wait)
+	// 6    run    G2
+	// 7    park   G2 (sync.Mutex.Lock)
+	// 8    run    G3
+	// 9    exit   G3
+	// 10   poll   (block)
+	// 11   ready  G1 (netpoll)
+	// 12   run    G1
+	// 13   log    G1 (read hello)
+	// 14   ready  G2 (unlock)
+	// 15   exit   G1
+	// 16   run    G2
+	// 17   log    G2 (locked)
+	// 18   exit   G2
+}
@@ -0,0 +1,52 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package netpoll
+
+import "syscall"
+
+func sysRead(fd int, p []byte) (int, error) {
+	return syscall.Read(fd, p)
+}
+
+func sysWrite(fd int, p []byte) (int, error) {
+	return syscall.Write(fd, p)
+}
+
+func sysClose(fd int) error {
+	return syscall.Close(fd)
+}
+
+func isEAGAIN(err error) bool {
+	return err == syscall.EAGAIN
+}
+
+func setNonblock(fd int) error {
+	return syscall.SetNonblock(fd, true)
+}
+
+// sysPipe returns a non-blocking, close-on-exec pipe.
+func sysPipe() (r, w int, err error) {
+	var fds [2]int
+	syscall.ForkLock.RLock()
+	err = syscall.Pipe(fds[:])
+	if err == nil {
+		syscall.CloseOnExec(fds[0])
+		syscall.CloseOnExec(fds[1])
+	}
+	syscall.ForkLock.RUnlock()
+	if err != nil {
+		return -1, -1, err
+	}
+	for _, fd := range fds {
+		if err := syscall.SetNonblock(fd, true); err != nil {
+			syscall.Close(fds[0])
+			syscall.Close(fds[1])
+			return -1, -1, err
+		}
+	}
+	return fds[0], fds[1], nil
+}
@@ -0,0 +1,431 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netpoll
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrDeadlock is returned by Run when goroutines remain but all of them
+// are parked on something other than I/O, so nothing can ever wake them.
+var ErrDeadlock = errors.New("netpoll: all goroutines are asleep - deadlock!")
+
+// forcePollNS is how long Run may keep running goroutines without
+// checking the poller, the 10ms after which sysmon polls the network.
+const forcePollNS = 10 * time.Millisecond
+
+// Wait reasons recorded in EvPark events.
+const (
+	waitIO    = "IO wait"
+	waitMutex = "sync.Mutex.Lock"
+	waitYield = "Gosched"
+)
+
+// A g is a goroutine started by Loop.Go. It is a real goroutine, but it
+// only runs between receiving on wake and sending on the Loop's back
+// channel, so at most one g of a Loop runs at a time, as on a single P.
+type g struct {
+	id     int
+	wake   chan struct{}
+	exited bool
+	panicv interface{}
+}
+
+type timedoutG struct {
+	gp  *g
+	why string
+}
+
+// Config configures a Loop.
+type Config struct {
+	// Trace, if not nil, is called with every scheduling event. Calls
+	// are never concurrent: they come from Run or from the goroutine
+	// running on the Loop.
+	Trace func(Event)
+}
+
+// A Loop runs goroutines one at a time and parks them on file descriptors
+// and mutexes, like a Go program with GOMAXPROCS=1.
+type Loop struct {
+	poller poller
+	trace  func(Event)
+
+	// lock is sched.lock: it protects the run queue and the waiter count,
+	// which deadline timers update from their own goroutines.
+	lock           sync.Mutex
+	runq           []*g
+	timedout       []timedoutG // Gs unparked by deadline timers, not yet in runq
+	netpollWaiters int         // Gs parked on a Desc
+	ngo            int         // Gs that have not exited
+	descs          map[int]*Desc
+
+	// The rest is only used by the goroutine calling Run and by the
+	// running g, which hand control back and forth.
+	back     chan struct{}
+	cur      *g
+	commit   func(*g) bool
+	reason   string
+	goid     int
+	seq      int
+	lastpoll time.Time
+}
+
+// NewLoop returns a Loop with its own poller.
+func NewLoop(cfg Config) (*Loop, error) {
+	l := &Loop{
+		trace: cfg.Trace,
+		descs: make(map[int]*Desc),
+		back:  make(chan struct{}),
+	}
+	// netpollinit
+	if err := l.poller.init(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Open registers the file descriptor fd with the Loop's poller and puts
+// it in non-blocking mode. The Desc takes ownership of fd.
+//
+// 对应poll_runtime_pollOpen. 注册时就同时关注可读和可写, 并且是边沿触发的:
+// 之后不需要再修改注册, 每次状态变化内核只通知一次
+func (l *Loop) Open(fd int) (*Desc, error) {
+	if err := setNonblock(fd); err != nil {
+		return nil, err
+	}
+	pd := &Desc{l: l, fd: fd}
+	// runtime把pollDesc的指针存在epoll_event.data(kqueue是udata)中, 通知
+	// 中直接带着它. syscall.EpollEvent只能放一个int32的fd, 所以模型用fd查表
+	l.lock.Lock()
+	l.descs[fd] = pd
+	l.lock.Unlock()
+	if err := l.poller.open(fd); err != nil {
+		l.lock.Lock()
+		delete(l.descs, fd)
+		l.lock.Unlock()
+		return nil, err
+	}
+	return pd, nil
+}
+
+// Pipe returns the two ends of a new pipe, registered with the Loop.
+func (l *Loop) Pipe() (r, w *Desc, err error) {
+	rfd, wfd, err := sysPipe()
+	if err != nil {
+		return nil, nil, err
+	}
+	if r, err = l.Open(rfd); err != nil {
+		sysClose(rfd)
+		sysClose(wfd)
+		return nil, nil, err
+	}
+	if w, err = l.Open(wfd); err != nil {
+		r.Close()
+		sysClose(wfd)
+		return nil, nil, err
+	}
+	return r, w, nil
+}
+
+// Go starts f in a new goroutine on the Loop. It may be called before Run
+// or from a goroutine already on the Loop.
+func (l *Loop) Go(f func()) {
+	l.lock.Lock()
+	l.goid++
+	gp := &g{id: l.goid, wake: make(chan struct{})}
+	l.ngo++
+	l.lock.Unlock()
+
+	go func() {
+		<-gp.wake
+		defer func() {
+			gp.panicv = recover()
+			gp.exited = true
+			l.back <- struct{}{}
+		}()
+		f()
+	}()
+	l.event(EvGo, gp, "")
+	l.runqput(gp)
+}
+
+// Gosched yields to the other runnable goroutines of the Loop, like
+// runtime.Gosched. It must be called from a goroutine on the Loop.
+func (l *Loop) Gosched() {
+	l.park(func(gp *g) bool {
+		l.runq = append(l.runq, gp)
+		return true
+	}, waitYield)
+}
+
+// Run runs the goroutines of the Loop until all of them have exited. It
+// blocks in the poller while every remaining goroutine is waiting for
+// I/O, and returns ErrDeadlock if goroutines remain but none of them is.
+// If a goroutine panics, Run panics with the same value.
+//
+// Run是schedule和findrunnable的简化版本: 本地队列中有G就运行它, 没有就
+// 检查有没有G在等待I/O, 有就阻塞在netpoll中, 否则整个程序死锁
+func (l *Loop) Run() error {
+	l.lastpoll = time.Now()
+	for {
+		l.injectTimedout()
+		l.lock.Lock()
+		gp := l.runqget()
+		if gp == nil {
+			if l.ngo == 0 {
+				l.lock.Unlock()
+				return nil
+			}
+			if l.netpollWaiters == 0 && len(l.timedout) == 0 {
+				l.lock.Unlock()
+				return ErrDeadlock
+			}
+			l.lock.Unlock()
+			// findrunnable中最后一步: 没有任何可运行的G, 但有G在等待I/O,
+			// 就阻塞在netpoll中. 只要有一个fd就绪(或者deadline到期)就醒来
+			l.netpoll(-1)
+			continue
+		}
+		l.lock.Unlock()
+
+		// sysmon: 超过10ms没有检查过netpoll, 就非阻塞地检查一次, 防止一直有G
+		// 可运行时, 等待I/O的G永远得不到运行
+		if time.Since(l.lastpoll) > forcePollNS {
+			l.netpoll(0)
+		}
+		l.execute(gp)
+	}
+}
+
+// Close closes the Loop's poller. The Descs opened on the Loop must be
+// closed first.
+func (l *Loop) Close() error {
+	return l.poller.destroy()
+}
+
+// execute runs gp until it parks or exits.
+func (l *Loop) execute(gp *g) {
+	for {
+		l.cur = gp
+		l.event(EvRun, gp, "")
+		gp.wake <- struct{}{}
+		<-l.back
+		l.cur = nil
+
+		if gp.exited {
+			l.lock.Lock()
+			l.ngo--
+			l.lock.Unlock()
+			l.event(EvExit, gp, "")
+			if gp.panicv != nil {
+				panic(gp.panicv)
+			}
+			return
+		}
+
+		// park_m: G已经停下, 在g0上运行commit决定是不是真的停车.
+		// 持有lock, 和从定时器goroutine中唤醒G的goreadyExternal互斥
+		commit, reason := l.commit, l.reason
+		l.commit, l.reason = nil, ""
+		l.lock.Lock()
+		parked := commit(gp)
+		l.lock.Unlock()
+		if parked {
+			l.event(EvPark, gp, reason)
+			return
+		}
+		// commit失败: 停车之前等待的事件已经发生, 立即继续运行
+	}
+}
+
+// park is gopark: the running g stops, and the Loop calls commit, which
+// reports whether gp really parks. A parked g runs again after someone
+// passes it to goready.
+func (l *Loop) park(commit func(gp *g) bool, reason string) {
+	gp := l.cur
+	if gp == nil {
+		panic("netpoll: blocking operation outside a goroutine started by Loop.Go")
+	}
+	l.commit = commit
+	l.reason = reason
+	l.back <- struct{}{}
+	<-gp.wake
+}
+
+// goready makes gp runnable. It is called on the Loop, by the running g
+// or by Run.
+func (l *Loop) goready(gp *g, why string) {
+	l.event(EvReady, gp, why)
+	l.runqput(gp)
+}
+
+// goreadyExternal is netpollgoready for goroutines unparked off the Loop,
+// by deadline timers. Run moves them to the run queue; the poller is woken
+// because Run may be blocked in netpoll waiting for I/O that will never
+// come.
+func (l *Loop) goreadyExternal(gp *g, why string) {
+	l.lock.Lock()
+	l.netpollWaiters--
+	l.timedout = append(l.timedout, timedoutG{gp, why})
+	l.lock.Unlock()
+	l.poller.wakeup()
+}
+
+// injectTimedout moves the goroutines readied by deadline timers to the
+// run queue. Trace must not be called concurrently, so their EvReady
+// events are recorded here rather than by the timers.
+func (l *Loop) injectTimedout() {
+	l.lock.Lock()
+	list := l.timedout
+	l.timedout = nil
+	l.lock.Unlock()
+	for _, t := range list {
+		l.goready(t.gp, t.why)
+	}
+}
+
+func (l *Loop) runqput(gp *g) {
+	l.lock.Lock()
+	l.runq = append(l.runq, gp)
+	l.lock.Unlock()
+}
+
+// runqget takes the next g off the run queue. l.lock must be held.
+func (l *Loop) runqget() *g {
+	if len(l.runq) == 0 {
+		return nil
+	}
+	gp := l.runq[0]
+	l.runq[0] = nil
+	l.runq = l.runq[1:]
+	return gp
+}
+
+// netpoll polls the poller and makes the goroutines parked on ready
+// descriptors runnable. delay is as for the runtime's netpoll: block
+// indefinitely if negative, don't block if zero.
+func (l *Loop) netpoll(delay time.Duration) {
+	var toRun []*g
+	what := "block"
+	if delay == 0 {
+		what = "nonblock"
+	}
+	l.event(EvPoll, nil, what)
+	err := l.poller.poll(delay, func(fd int, mode int32) {
+		l.lock.Lock()
+		pd := l.descs[fd]
+		l.lock.Unlock()
+		if pd == nil {
+			// fd已经关闭, 删除注册之前内核已经放进了就绪列表的通知
+			return
+		}
+		// netpollready
+		if mode == 'r' || mode == 'r'+'w' {
+			if rg := pd.unblock('r', true); rg != nil {
+				toRun = append(toRun, rg)
+			}
+		}
+		if mode == 'w' || mode == 'r'+'w' {
+			if wg := pd.unblock('w', true); wg != nil {
+				toRun = append(toRun, wg)
+			}
+		}
+	})
+	if err != nil {
+		panic("netpoll: poll failed: " + err.Error())
+	}
+	l.lastpoll = time.Now()
+
+	// injectglist: 就绪的G放到运行队列的末尾
+	l.lock.Lock()
+	l.netpollWaiters -= len(toRun)
+	l.lock.Unlock()
+	for _, gp := range toRun {
+		l.goready(gp, "netpoll")
+	}
+}
+
+// An EventKind is a kind of scheduling event.
+type EventKind int
+
+const (
+	EvGo    EventKind = iota // a goroutine was created
+	EvRun                    // the Loop ran the goroutine
+	EvPark                   // the goroutine parked; Note is the wait reason
+	EvReady                  // the goroutine became runnable; Note says who readied it
+	EvPoll                   // the Loop polled for I/O; Note is block or nonblock
+	EvExit                   // the goroutine finished
+	EvUser                   // Loop.Log was called; Note is the message
+)
+
+var eventNames = [...]string{
+	EvGo:    "go",
+	EvRun:   "run",
+	EvPark:  "park",
+	EvReady: "ready",
+	EvPoll:  "poll",
+	EvExit:  "exit",
+	EvUser:  "log",
+}
+
+func (k EventKind) String() string {
+	if k >= 0 && int(k) < len(eventNames) {
+		return eventNames[k]
+	}
+	return "EventKind(" + strconv.Itoa(int(k)) + ")"
+}
+
+// An Event is something the Loop did. G is 0 when it does not apply.
+type Event struct {
+	Seq  int
+	Kind EventKind
+	G    int
+	Note string
+}
+
+func (e Event) String() string {
+	var b strings.Builder
+	b.WriteString(strconv.Itoa(e.Seq))
+	for b.Len() < 4 {
+		b.WriteByte(' ')
+	}
+	b.WriteString(" ")
+	b.WriteString(e.Kind.String())
+	for b.Len() < 11 {
+		b.WriteByte(' ')
+	}
+	if e.G != 0 {
+		b.WriteString(" G")
+		b.WriteString(strconv.Itoa(e.G))
+	}
+	if e.Note != "" {
+		b.WriteString(" (")
+		b.WriteString(e.Note)
+		b.WriteString(")")
+	}
+	return b.String()
+}
+
+// Log records an EvUser event for the running goroutine, so that a trace
+// shows what the goroutines themselves did between scheduling events.
+func (l *Loop) Log(msg string) {
+	l.event(EvUser, l.cur, msg)
+}
+
+func (l *Loop) event(kind EventKind, gp *g, note string) {
+	if l.trace == nil {
+		return
+	}
+	l.seq++
+	e := Event{Seq: l.seq, Kind: kind, Note: note}
+	if gp != nil {
+		e.G = gp.id
+	}
+	l.trace(e)
+}
@@ -0,0 +1,335 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package netpoll_test
+
+import (
+	"bytes"
+	"elements/netpoll"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newLoop(t *testing.T) (*netpoll.Loop, *[]netpoll.Event) {
+	t.Helper()
+	var events []netpoll.Event
+	l, err := netpoll.NewLoop(netpoll.Config{Trace: func(e netpoll.Event) {
+		events = append(events, e)
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l, &events
+}
+
+func pipe(t *testing.T, l *netpoll.Loop) (r, w *netpoll.Desc) {
+	t.Helper()
+	r, w, err := l.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, w
+}
+
+// has reports whether events contains an event of kind for goroutine gid
+// with the given note.
+func has(events []netpoll.Event, kind netpoll.EventKind, gid int, note string) bool {
+	for _, e := range events {
+		if e.Kind == kind && e.G == gid && e.Note == note {
+			return true
+		}
+	}
+	return false
+}
+
+func TestReadParks(t *testing.T) {
+	l, events := newLoop(t)
+	defer l.Close()
+	r, w := pipe(t, l)
+	var got string
+	l.Go(func() {
+		buf := make([]byte, 16)
+		n, err := r.Read(buf)
+		if err != nil {
+			t.Errorf("Read: %v", err)
+		}
+		got = string(buf[:n])
+		r.Close()
+	})
+	l.Go(func() {
+		if _, err := w.Write([]byte("hello")); err != nil {
+			t.Errorf("Write: %v", err)
+		}
+		w.Close()
+	})
+	if err := l.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if got != "hello" {
+		t.Errorf("Read got %q; want %q", got, "hello")
+	}
+	// G1在G2写入之前运行, 管道是空的, 只能停车等待netpoll唤醒
+	if !has(*events, netpoll.EvPark, 1, "IO wait") || !has(*events, netpoll.EvReady, 1, "netpoll") {
+		t.Errorf("G1 did not park for I/O and get readied by netpoll:\n%s", trace(*events))
+	}
+}
+
+func trace(events []netpoll.Event) string {
+	var b strings.Builder
+	for _, e := range events {
+		b.WriteString(e.String())
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
+
+func TestMutexHeldAcrossIO(t *testing.T) {
+	l, events := newLoop(t)
+	defer l.Close()
+	r, w := pipe(t, l)
+	mu := l.NewMutex()
+	var order []string
+	l.Go(func() {
+		mu.Lock()
+		buf := make([]byte, 1)
+		r.Read(buf)
+		order = append(order, "G1 read "+string(buf))
+		mu.Unlock()
+	})
+	l.Go(func() {
+		mu.Lock()
+		order = append(order, "G2 locked")
+		mu.Unlock()
+	})
+	l.Go(func() {
+		order = append(order, "G3 write")
+		w.Write([]byte("x"))
+	})
+	if err := l.Run(); err != nil {
+		t.Fatal(err)
+	}
+	r.Close()
+	w.Close()
+	// G1持有锁等待I/O, G2只能在锁上停车, 直到数据到达后G1解锁
+	want := []string{"G3 write", "G1 read x", "G2 locked"}
+	if strings.Join(order, ", ") != strings.Join(want, ", ") {
+		t.Errorf("order = %v; want %v", order, want)
+	}
+	if !has(*events, netpoll.EvPark, 2, "sync.Mutex.Lock") || !has(*events, netpoll.EvReady, 2, "unlock") {
+		t.Errorf("G2 did not park on the mutex and get readied by unlock:\n%s", trace(*events))
+	}
+}
+
+func TestDeadline(t *testing.T) {
+	l, events := newLoop(t)
+	defer l.Close()
+	r, w := pipe(t, l)
+	const d = 20 * time.Millisecond
+	l.Go(func() {
+		buf := make([]byte, 1)
+		start := time.Now()
+		r.SetReadDeadline(start.Add(d))
+		if _, err := r.Read(buf); err != netpoll.ErrTimeout {
+			t.Errorf("Read with deadline = %v; want ErrTimeout", err)
+		}
+		if elapsed := time.Since(start); elapsed < d {
+			t.Errorf("Read timed out after %v; want at least %v", elapsed, d)
+		}
+		// 过期的deadline一直有效, 直到被修改
+		if _, err := r.Read(buf); err != netpoll.ErrTimeout {
+			t.Errorf("Read after the deadline = %v; want ErrTimeout", err)
+		}
+		r.SetReadDeadline(time.Time{})
+		w.Write([]byte("y"))
+		if n, err := r.Read(buf); n != 1 || err != nil {
+			t.Errorf("Read after clearing the deadline = %d, %v; want 1, nil", n, err)
+		}
+		// 已经过去的时间立即过期
+		r.SetReadDeadline(time.Now().Add(-time.Second))
+		if _, err := r.Read(buf); err != netpoll.ErrTimeout {
+			t.Errorf("Read with a past deadline = %v; want ErrTimeout", err)
+		}
+		r.Close()
+		w.Close()
+	})
+	if err := l.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !has(*events, netpoll.EvReady, 1, "deadline") {
+		t.Errorf("G1 was not readied by its deadline:\n%s", trace(*events))
+	}
+}
+
+func TestDeadlineReset(t *testing.T) {
+	// 等待中把deadline推迟: 旧的定时器作废(rseq), 新的定时器到期才超时
+	l, _ := newLoop(t)
+	defer l.Close()
+	r, w := pipe(t, l)
+	l.Go(func() {
+		start := time.Now()
+		r.SetReadDeadline(start.Add(10 * time.Millisecond))
+		r.SetReadDeadline(start.Add(40 * time.Millisecond))
+		if _, err := r.Read(make([]byte, 1)); err != netpoll.ErrTimeout {
+			t.Errorf("Read = %v; want ErrTimeout", err)
+		}
+		if elapsed := time.Since(start); elapsed < 40*time.Millisecond {
+			t.Errorf("Read timed out after %v; want the later deadline", elapsed)
+		}
+		r.Close()
+		w.Close()
+	})
+	if err := l.Run(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCloseUnblocks(t *testing.T) {
+	l, events := newLoop(t)
+	defer l.Close()
+	r, w := pipe(t, l)
+	l.Go(func() {
+		if _, err := r.Read(make([]byte, 1)); err != netpoll.ErrClosed {
+			t.Errorf("Read on closed Desc = %v; want ErrClosed", err)
+		}
+	})
+	l.Go(func() {
+		r.Close()
+		if err := r.Close(); err != netpoll.ErrClosed {
+			t.Errorf("second Close = %v; want ErrClosed", err)
+		}
+		w.Close()
+	})
+	if err := l.Run(); err != nil {
+		t.Fatal(err)
+	}
+	if !has(*events, netpoll.EvReady, 1, "close") {
+		t.Errorf("G1 was not readied by Close:\n%s", trace(*events))
+	}
+}
+
+func TestEOF(t *testing.T) {
+	l, _ := newLoop(t)
+	defer l.Close()
+	r, w := pipe(t, l)
+	l.Go(func() {
+		if _, err := r.Read(make([]byte, 1)); err != io.EOF {
+			t.Errorf("Read after the writer closed = %v; want io.EOF", err)
+		}
+		r.Close()
+	})
+	l.Go(func() {
+		w.Close()
+	})
+	if err := l.Run(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestManyPipes(t *testing.T) {
+	// 每个写者写的数据都超过管道的缓冲区, 读者和写者都要反复停车
+	l, _ := newLoop(t)
+	defer l.Close()
+	const pipes = 8
+	data := bytes.Repeat([]byte("0123456789abcdef"), 1<<14) // 256KB
+	got := make([][]byte, pipes)
+	for i := 0; i < pipes; i++ {
+		i := i
+		r, w := pipe(t, l)
+		l.Go(func() {
+			var buf bytes.Buffer
+			tmp := make([]byte, 4096)
+			for {
+				n, err := r.Read(tmp)
+				buf.Write(tmp[:n])
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Errorf("pipe %d: Read: %v", i, err)
+					break
+				}
+			}
+			got[i] = buf.Bytes()
+			r.Close()
+		})
+		l.Go(func() {
+			if n, err := w.Write(data); n != len(data) || err != nil {
+				t.Errorf("pipe %d: Write = %d, %v; want %d, nil", i, n, err, len(data))
+			}
+			w.Close()
+		})
+	}
+	if err := l.Run(); err != nil {
+		t.Fatal(err)
+	}
+	for i := range got {
+		if !bytes.Equal(got[i], data) {
+			t.Errorf("pipe %d: read %d bytes; want the %d written", i, len(got[i]), len(data))
+		}
+	}
+}
+
+func TestDeadlock(t *testing.T) {
+	// G1退出时没有解锁, G2永远停在锁上. 没有G在等待I/O, Run不能阻塞在netpoll中
+	l, _ := newLoop(t)
+	defer l.Close()
+	mu := l.NewMutex()
+	l.Go(func() { mu.Lock() })
+	l.Go(func() { mu.Lock() })
+	if err := l.Run(); err != netpoll.ErrDeadlock {
+		t.Errorf("Run = %v; want ErrDeadlock", err)
+	}
+}
+
+func TestGosched(t *testing.T) {
+	l, _ := newLoop(t)
+	defer l.Close()
+	var order []int
+	for i := 1; i <= 3; i++ {
+		i := i
+		l.Go(func() {
+			order = append(order, i)
+			l.Gosched()
+			order = append(order, i)
+		})
+	}
+	if err := l.Run(); err != nil {
+		t.Fatal(err)
+	}
+	want := []int{1, 2, 3, 1, 2, 3}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("order = %v; want %v", order, want)
+		}
+	}
+}
+
+func TestPanic(t *testing.T) {
+	l, _ := newLoop(t)
+	defer l.Close()
+	l.Go(func() { panic("boom") })
+	defer func() {
+		if e := recover(); e != "boom" {
+			t.Errorf("Run panicked with %v; want boom", e)
+		}
+	}()
+	l.Run()
+}
+
+func TestOutsideLoop(t *testing.T) {
+	l, _ := newLoop(t)
+	defer l.Close()
+	mu := l.NewMutex()
+	mu.Lock()
+	defer func() {
+		if recover() == nil {
+			t.Error("Lock of a held Mutex outside the Loop did not panic")
+		}
+	}()
+	mu.Lock()
+}
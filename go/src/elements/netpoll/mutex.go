@@ -0,0 +1,62 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package netpoll
+
+// A Mutex is a mutual exclusion lock for the goroutines of one Loop.
+//
+// A goroutine that finds the Mutex locked parks on it, the way sync.Mutex
+// parks on its semaphore with runtime_SemacquireMutex, and Unlock hands
+// the lock to the longest waiting goroutine and makes it runnable. Parking
+// on a Mutex and parking on a Desc are the same gopark; they differ only
+// in who calls goready, and in that goroutines parked on a Mutex do not
+// count as waiting for the poller.
+//
+// sync.Mutex only hands the lock over in starvation mode. In normal mode
+// the woken waiter competes with the goroutines already running, which
+// usually win; on a single P that is the unlocking goroutine itself, if
+// it locks again before yielding. The model always hands over, so traces
+// are easier to follow.
+type Mutex struct {
+	l       *Loop
+	locked  bool
+	waiters []*g // the semaphore's wait queue, FIFO
+}
+
+// NewMutex returns an unlocked Mutex for the goroutines of l.
+func (l *Loop) NewMutex() *Mutex {
+	return &Mutex{l: l}
+}
+
+// Lock locks m, parking the calling goroutine until m is available. It
+// must be called from a goroutine on the Loop.
+func (m *Mutex) Lock() {
+	// 同一时刻只有一个G在运行, 不需要CAS
+	if !m.locked {
+		m.locked = true
+		return
+	}
+	m.l.park(func(gp *g) bool {
+		m.waiters = append(m.waiters, gp)
+		return true
+	}, waitMutex)
+	// 被唤醒时Unlock已经把锁交给了这个G, locked一直是true
+}
+
+// Unlock unlocks m. It is a run-time error if m is not locked.
+func (m *Mutex) Unlock() {
+	if !m.locked {
+		panic("netpoll: unlock of unlocked mutex")
+	}
+	if len(m.waiters) == 0 {
+		m.locked = false
+		return
+	}
+	gp := m.waiters[0]
+	m.waiters[0] = nil
+	m.waiters = m.waiters[1:]
+	// semrelease -> readyWithTime -> goready: 放进运行队列, 当前G继续运行.
+	// starvation模式的sync.Mutex传入handoff=true, 当前G紧接着让出P
+	m.l.goready(gp, "unlock")
+}
@@ -0,0 +1,413 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package netpoll is a userspace model of the runtime's network poller
+// (runtime/netpoll.go, netpoll_epoll.go and netpoll_kqueue.go) and of the
+// way the scheduler drives it.
+//
+// A Loop plays a single P: it runs the goroutines started with Loop.Go one
+// at a time, and when none of them can run it blocks in epoll_wait or
+// kevent until a file descriptor becomes ready, exactly where findrunnable
+// calls netpoll. A goroutine that reads a Desc when no data is available
+// parks on the Desc's read semaphore; one that locks a held Mutex parks on
+// the Mutex. Both kinds of parked goroutines are made runnable again by
+// the Loop, so a trace of a Loop shows how I/O readiness and lock handoff
+// interleave.
+//
+// Loops are only available on Linux (epoll) and the BSDs including macOS
+// (kqueue). Elsewhere NewLoop returns an error.
+package netpoll
+
+import (
+	"errors"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+var (
+	// ErrClosed is returned by operations on a closed Desc, including
+	// operations that were blocked when it was closed.
+	ErrClosed = errors.New("netpoll: use of closed file")
+
+	// ErrTimeout is returned by operations on a Desc whose deadline has
+	// passed.
+	ErrTimeout = errors.New("netpoll: i/o timeout")
+)
+
+// pollDesc contains 2 binary semaphores, rg and wg, to park reader and writer
+// goroutines respectively. The semaphore can be in the following states:
+// pdReady - io readiness notification is pending;
+//           a goroutine consumes the notification by changing the state to nil.
+// pdWait - a goroutine prepares to park on the semaphore, but not yet parked;
+//          the goroutine commits to park by changing the state to G pointer,
+//          or, alternatively, concurrent io notification changes the state to READY,
+//          or, alternatively, concurrent timeout/close changes the state to nil.
+// G pointer - the goroutine is blocked on the semaphore;
+//             io notification or timeout/close changes the state to READY or nil respectively
+//             and unparks the goroutine.
+// nil - nothing of the above.
+//
+// runtime中pdReady和pdWait是uintptr的1和2, 和*g存在同一个uintptr中.
+// 模型中用unsafe.Pointer, 两个哨兵指向各自的变量, 不会和真正的*g相同
+var (
+	pdReady = unsafe.Pointer(new(uint8))
+	pdWait  = unsafe.Pointer(new(uint8))
+)
+
+// A Desc is a non-blocking file descriptor registered with a Loop, the
+// model's pollDesc together with the Read and Write loops of
+// internal/poll.FD.
+//
+// Read, Write and Close must be called from goroutines started with the
+// Loop's Go method. SetDeadline, SetReadDeadline and SetWriteDeadline may
+// be called from any goroutine.
+type Desc struct {
+	l  *Loop
+	fd int
+
+	// The lock protects the deadline operations and Close.
+	// This fully covers seq, rt and wt variables. fd is constant throughout the Desc lifetime.
+	// Read, Write, the waits and netpollready (IO readiness notification)
+	// proceed w/o taking the lock. So closing, rg, rd, wg and wd are manipulated
+	// in a lock-free way by all operations.
+	lock    sync.Mutex
+	closing int32          // atomic
+	rseq    uintptr        // protects from stale read timers
+	rg      unsafe.Pointer // pdReady, pdWait, G waiting for read or nil
+	rt      *time.Timer    // read deadline timer
+	rd      int64          // read deadline, unix nanoseconds; atomic
+	wseq    uintptr        // protects from stale write timers
+	wg      unsafe.Pointer // pdReady, pdWait, G waiting for write or nil
+	wt      *time.Timer    // write deadline timer
+	wd      int64          // write deadline, unix nanoseconds; atomic
+}
+
+// Fd returns the file descriptor.
+func (pd *Desc) Fd() int {
+	return pd.fd
+}
+
+func (pd *Desc) sema(mode int32) *unsafe.Pointer {
+	if mode == 'w' {
+		return &pd.wg
+	}
+	return &pd.rg
+}
+
+// checkerr is netpollcheckerr: a closed Desc or an expired deadline fails
+// the wait before it starts.
+func (pd *Desc) checkerr(mode int32) error {
+	if atomic.LoadInt32(&pd.closing) != 0 {
+		return ErrClosed
+	}
+	if (mode == 'r' && atomic.LoadInt64(&pd.rd) < 0) || (mode == 'w' && atomic.LoadInt64(&pd.wd) < 0) {
+		return ErrTimeout
+	}
+	return nil
+}
+
+// reset is poll_runtime_pollReset, called before the first attempt of a
+// read or write. It drops a readiness notification left over from an
+// earlier operation; the system call that follows sees the current state
+// anyway.
+func (pd *Desc) reset(mode int32) error {
+	if err := pd.checkerr(mode); err != nil {
+		return err
+	}
+	atomic.StorePointer(pd.sema(mode), nil)
+	return nil
+}
+
+// wait is poll_runtime_pollWait: it parks the calling goroutine until fd
+// is ready for mode, or the Desc is closed or times out.
+func (pd *Desc) wait(mode int32) error {
+	if err := pd.checkerr(mode); err != nil {
+		return err
+	}
+	for !pd.block(mode) {
+		if err := pd.checkerr(mode); err != nil {
+			return err
+		}
+		// Can happen if timeout has fired and unblocked us,
+		// but before we had a chance to run, timeout has been reset.
+		// Pretend it has not happened and retry.
+	}
+	return nil
+}
+
+// returns true if IO is ready, or false if timedout or closed
+//
+// 对应netpollblock
+func (pd *Desc) block(mode int32) bool {
+	gpp := pd.sema(mode)
+
+	// set the gpp semaphore to pdWait
+	for {
+		old := atomic.LoadPointer(gpp)
+		if old == pdReady {
+			// 已经有一个就绪通知, 消费它, 不用停车
+			atomic.StorePointer(gpp, nil)
+			return true
+		}
+		if old != nil {
+			panic("netpoll: double wait")
+		}
+		if atomic.CompareAndSwapPointer(gpp, nil, pdWait) {
+			break
+		}
+	}
+
+	// need to recheck error states after setting gpp to pdWait
+	// this is necessary because Close/SetDeadline/deadline
+	// do the opposite: store to closing/rd/wd, membarrier, load of rg/wg
+	if pd.checkerr(mode) == nil {
+		pd.l.park(func(gp *g) bool {
+			// netpollblockcommit: 在G已经停下之后才把pdWait换成*g.
+			// 这期间就绪通知可能已经把pdWait换成了pdReady, CAS失败, G不停车继续运行
+			if atomic.CompareAndSwapPointer(gpp, pdWait, unsafe.Pointer(gp)) {
+				// Bump the count of goroutines waiting for the poller.
+				// The scheduler uses this to decide whether to block
+				// waiting for the poller if there is nothing else to do.
+				pd.l.netpollWaiters++
+				return true
+			}
+			return false
+		}, waitIO)
+	}
+	// be careful to not lose concurrent pdReady notification
+	old := atomic.SwapPointer(gpp, nil)
+	if old != nil && old != pdReady && old != pdWait {
+		panic("netpoll: corrupted polldesc")
+	}
+	return old == pdReady
+}
+
+// unblock is netpollunblock. It returns the goroutine parked on the
+// semaphore for mode, if any, which the caller must make runnable.
+func (pd *Desc) unblock(mode int32, ioready bool) *g {
+	gpp := pd.sema(mode)
+
+	for {
+		old := atomic.LoadPointer(gpp)
+		if old == pdReady {
+			return nil
+		}
+		if old == nil && !ioready {
+			// Only set READY for ioready. runtime_pollWait
+			// will check for timeout/cancel before waiting.
+			return nil
+		}
+		var new unsafe.Pointer
+		if ioready {
+			new = pdReady
+		}
+		if atomic.CompareAndSwapPointer(gpp, old, new) {
+			if old == pdReady || old == pdWait {
+				old = nil
+			}
+			return (*g)(old)
+		}
+	}
+}
+
+// Read reads from the file descriptor like internal/poll.FD.Read: it
+// tries the read system call, and when that would block it parks until
+// the poller reports the descriptor readable, then tries again.
+func (pd *Desc) Read(p []byte) (int, error) {
+	if err := pd.reset('r'); err != nil {
+		return 0, err
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	for {
+		n, err := sysRead(pd.fd, p)
+		if err != nil {
+			n = 0
+			if isEAGAIN(err) {
+				if err = pd.wait('r'); err == nil {
+					continue
+				}
+			}
+		}
+		if n == 0 && err == nil {
+			err = io.EOF
+		}
+		return n, err
+	}
+}
+
+// Write writes all of p to the file descriptor like internal/poll.FD.Write,
+// parking whenever the descriptor is not writable.
+func (pd *Desc) Write(p []byte) (int, error) {
+	if err := pd.reset('w'); err != nil {
+		return 0, err
+	}
+	var nn int
+	for {
+		n, err := sysWrite(pd.fd, p[nn:])
+		if n > 0 {
+			nn += n
+		}
+		if nn == len(p) {
+			return nn, err
+		}
+		if err != nil && isEAGAIN(err) {
+			if err = pd.wait('w'); err == nil {
+				continue
+			}
+		}
+		if err != nil {
+			return nn, err
+		}
+		if n == 0 {
+			return nn, io.ErrUnexpectedEOF
+		}
+	}
+}
+
+// SetDeadline sets both the read and write deadlines. A zero t clears
+// them.
+func (pd *Desc) SetDeadline(t time.Time) {
+	pd.setDeadline(t, 'r'+'w')
+}
+
+// SetReadDeadline sets the deadline for Read. A Read blocked when the
+// deadline passes, and every Read after it, fails with ErrTimeout until
+// the deadline is moved. A zero t clears the deadline.
+func (pd *Desc) SetReadDeadline(t time.Time) {
+	pd.setDeadline(t, 'r')
+}
+
+// SetWriteDeadline sets the deadline for Write, like SetReadDeadline.
+func (pd *Desc) SetWriteDeadline(t time.Time) {
+	pd.setDeadline(t, 'w')
+}
+
+// setDeadline is poll_runtime_pollSetDeadline. The runtime reuses the
+// timers embedded in the pollDesc with modtimer; the model stops and
+// replaces a time.AfterFunc, and the sequence numbers make a timer that
+// fires after being replaced do nothing.
+func (pd *Desc) setDeadline(t time.Time, mode int32) {
+	var d int64
+	if !t.IsZero() {
+		d = t.UnixNano()
+		if !t.After(time.Now()) {
+			d = -1 // already expired
+		}
+	}
+	pd.lock.Lock()
+	if atomic.LoadInt32(&pd.closing) != 0 {
+		pd.lock.Unlock()
+		return
+	}
+	var rg, wg *g
+	if mode == 'r' || mode == 'r'+'w' {
+		pd.rseq++
+		if pd.rt != nil {
+			pd.rt.Stop()
+			pd.rt = nil
+		}
+		atomic.StoreInt64(&pd.rd, d)
+		if d > 0 {
+			seq := pd.rseq
+			pd.rt = time.AfterFunc(time.Until(t), func() { pd.deadline('r', seq) })
+		}
+		if d < 0 {
+			rg = pd.unblock('r', false)
+		}
+	}
+	if mode == 'w' || mode == 'r'+'w' {
+		pd.wseq++
+		if pd.wt != nil {
+			pd.wt.Stop()
+			pd.wt = nil
+		}
+		atomic.StoreInt64(&pd.wd, d)
+		if d > 0 {
+			seq := pd.wseq
+			pd.wt = time.AfterFunc(time.Until(t), func() { pd.deadline('w', seq) })
+		}
+		if d < 0 {
+			wg = pd.unblock('w', false)
+		}
+	}
+	pd.lock.Unlock()
+	if rg != nil {
+		pd.l.goreadyExternal(rg, "deadline")
+	}
+	if wg != nil {
+		pd.l.goreadyExternal(wg, "deadline")
+	}
+}
+
+// deadline is netpolldeadlineimpl, run by a deadline timer.
+func (pd *Desc) deadline(mode int32, seq uintptr) {
+	var rg, wg *g
+	pd.lock.Lock()
+	// Seq arg is seq when the timer was set.
+	// If it's stale, ignore the timer event.
+	if mode == 'r' && seq == pd.rseq {
+		atomic.StoreInt64(&pd.rd, -1)
+		pd.rt = nil
+		rg = pd.unblock('r', false)
+	}
+	if mode == 'w' && seq == pd.wseq {
+		atomic.StoreInt64(&pd.wd, -1)
+		pd.wt = nil
+		wg = pd.unblock('w', false)
+	}
+	pd.lock.Unlock()
+	// 定时器在自己的goroutine中触发, 而Loop可能正睡在epoll_wait中.
+	// runtime中定时器由P自己运行, 不存在这个问题
+	if rg != nil {
+		pd.l.goreadyExternal(rg, "deadline")
+	}
+	if wg != nil {
+		pd.l.goreadyExternal(wg, "deadline")
+	}
+}
+
+// Close unblocks the goroutines waiting on the Desc, which then fail with
+// ErrClosed, removes the descriptor from the poller and closes it.
+//
+// 对应internal/poll.FD.Close: 先poll_runtime_pollUnblock, 再pollClose和close(2).
+// runtime等所有正在进行的读写都返回(fdMutex的引用计数归零)之后才真正关闭, 防止fd被重用后,
+// 还没返回的读写操作了另一个文件. 模型中同一时刻只有一个G在运行, 不会发生
+func (pd *Desc) Close() error {
+	pd.lock.Lock()
+	if atomic.LoadInt32(&pd.closing) != 0 {
+		pd.lock.Unlock()
+		return ErrClosed
+	}
+	atomic.StoreInt32(&pd.closing, 1)
+	pd.rseq++
+	pd.wseq++
+	rg := pd.unblock('r', false)
+	wg := pd.unblock('w', false)
+	if pd.rt != nil {
+		pd.rt.Stop()
+		pd.rt = nil
+	}
+	if pd.wt != nil {
+		pd.wt.Stop()
+		pd.wt = nil
+	}
+	pd.lock.Unlock()
+	if rg != nil {
+		pd.l.goready(rg, "close")
+	}
+	if wg != nil {
+		pd.l.goready(wg, "close")
+	}
+
+	pd.l.lock.Lock()
+	delete(pd.l.descs, pd.fd)
+	pd.l.lock.Unlock()
+	pd.l.poller.close(pd.fd)
+	return sysClose(pd.fd)
+}
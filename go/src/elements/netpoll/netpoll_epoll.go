@@ -0,0 +1,153 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build linux
+
+package netpoll
+
+import (
+	"syscall"
+	"time"
+)
+
+// _EPOLLET as the runtime spells it; syscall.EPOLLET is a negative int.
+const epollet = 0x80000000
+
+type poller struct {
+	epfd int
+
+	// 对应netpollBreakRd和netpollBreakWr: 一个非阻塞的管道, 读端注册在epoll中,
+	// 向写端写一个字节就能把阻塞在epoll_wait中的netpoll唤醒
+	breakRd, breakWr int
+
+	events [128]syscall.EpollEvent
+}
+
+// init is netpollinit.
+func (p *poller) init() error {
+	epfd, err := syscall.EpollCreate1(syscall.EPOLL_CLOEXEC)
+	if err != nil {
+		return err
+	}
+	var fds [2]int
+	if err := syscall.Pipe2(fds[:], syscall.O_NONBLOCK|syscall.O_CLOEXEC); err != nil {
+		syscall.Close(epfd)
+		return err
+	}
+	ev := syscall.EpollEvent{Events: syscall.EPOLLIN, Fd: int32(fds[0])}
+	if err := syscall.EpollCtl(epfd, syscall.EPOLL_CTL_ADD, fds[0], &ev); err != nil {
+		syscall.Close(epfd)
+		syscall.Close(fds[0])
+		syscall.Close(fds[1])
+		return err
+	}
+	p.epfd, p.breakRd, p.breakWr = epfd, fds[0], fds[1]
+	return nil
+}
+
+// open is netpollopen.
+func (p *poller) open(fd int) error {
+	// 可读, 可写和对端关闭一起注册, 边沿触发
+	ev := syscall.EpollEvent{
+		Events: syscall.EPOLLIN | syscall.EPOLLOUT | syscall.EPOLLRDHUP | epollet,
+		Fd:     int32(fd),
+	}
+	return syscall.EpollCtl(p.epfd, syscall.EPOLL_CTL_ADD, fd, &ev)
+}
+
+// close is netpollclose.
+func (p *poller) close(fd int) error {
+	var ev syscall.EpollEvent
+	return syscall.EpollCtl(p.epfd, syscall.EPOLL_CTL_DEL, fd, &ev)
+}
+
+func (p *poller) destroy() error {
+	syscall.Close(p.breakRd)
+	syscall.Close(p.breakWr)
+	return syscall.Close(p.epfd)
+}
+
+// wakeup is netpollBreak.
+func (p *poller) wakeup() {
+	for {
+		b := [1]byte{0}
+		n, err := syscall.Write(p.breakWr, b[:])
+		if n == 1 {
+			break
+		}
+		if err == syscall.EINTR {
+			continue
+		}
+		if err == syscall.EAGAIN {
+			// 管道满了, 已经有足够多的唤醒在等着
+			return
+		}
+		panic("netpoll: netpollBreak write failed: " + err.Error())
+	}
+}
+
+// poll is netpoll: it waits for up to delay (forever if delay < 0) and
+// calls ready for each descriptor that became ready, with mode 'r', 'w'
+// or 'r'+'w'.
+func (p *poller) poll(delay time.Duration, ready func(fd int, mode int32)) error {
+	var waitms int
+	if delay < 0 {
+		waitms = -1
+	} else if delay == 0 {
+		waitms = 0
+	} else if delay < time.Millisecond {
+		waitms = 1
+	} else if delay < 1e15 {
+		waitms = int(delay / time.Millisecond)
+	} else {
+		// An arbitrary cap on how long to wait for a timer.
+		// 1e9 ms == ~11.5 days.
+		waitms = 1e9
+	}
+retry:
+	n, err := syscall.EpollWait(p.epfd, p.events[:], waitms)
+	if err != nil {
+		if err != syscall.EINTR {
+			return err
+		}
+		// If a timed sleep was interrupted, just return to
+		// recalculate how long we should sleep now.
+		if waitms > 0 {
+			return nil
+		}
+		goto retry
+	}
+	for i := 0; i < n; i++ {
+		ev := &p.events[i]
+		if ev.Events == 0 {
+			continue
+		}
+
+		if int(ev.Fd) == p.breakRd {
+			if ev.Events != syscall.EPOLLIN {
+				panic("netpoll: bad events on break pipe")
+			}
+			if delay != 0 {
+				// netpollBreak could be picked up by a
+				// nonblocking poll. Only read the byte
+				// if blocking.
+				var tmp [16]byte
+				syscall.Read(p.breakRd, tmp[:])
+			}
+			continue
+		}
+
+		var mode int32
+		if ev.Events&(syscall.EPOLLIN|syscall.EPOLLRDHUP|syscall.EPOLLHUP|syscall.EPOLLERR) != 0 {
+			mode += 'r'
+		}
+		if ev.Events&(syscall.EPOLLOUT|syscall.EPOLLHUP|syscall.EPOLLERR) != 0 {
+			mode += 'w'
+		}
+		if mode != 0 {
+			ready(int(ev.Fd), mode)
+		}
+	}
+	return nil
+}
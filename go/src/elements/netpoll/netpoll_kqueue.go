@@ -0,0 +1,158 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package netpoll
+
+import (
+	"syscall"
+	"time"
+)
+
+type poller struct {
+	kq int
+
+	// 对应netpollBreakRd和netpollBreakWr, 见netpoll_epoll.go
+	breakRd, breakWr int
+
+	events [64]syscall.Kevent_t
+}
+
+// init is netpollinit.
+func (p *poller) init() error {
+	kq, err := syscall.Kqueue()
+	if err != nil {
+		return err
+	}
+	syscall.CloseOnExec(kq)
+	rfd, wfd, err := sysPipe()
+	if err != nil {
+		syscall.Close(kq)
+		return err
+	}
+	var ev [1]syscall.Kevent_t
+	syscall.SetKevent(&ev[0], rfd, syscall.EVFILT_READ, syscall.EV_ADD)
+	if _, err := syscall.Kevent(kq, ev[:], nil, nil); err != nil {
+		syscall.Close(kq)
+		syscall.Close(rfd)
+		syscall.Close(wfd)
+		return err
+	}
+	p.kq, p.breakRd, p.breakWr = kq, rfd, wfd
+	return nil
+}
+
+// open is netpollopen.
+func (p *poller) open(fd int) error {
+	// Arm both EVFILT_READ and EVFILT_WRITE in edge-triggered mode (EV_CLEAR)
+	// for the whole fd lifetime. The notifications are automatically unregistered
+	// when fd is closed.
+	var ev [2]syscall.Kevent_t
+	syscall.SetKevent(&ev[0], fd, syscall.EVFILT_READ, syscall.EV_ADD|syscall.EV_CLEAR)
+	syscall.SetKevent(&ev[1], fd, syscall.EVFILT_WRITE, syscall.EV_ADD|syscall.EV_CLEAR)
+	_, err := syscall.Kevent(p.kq, ev[:], nil, nil)
+	return err
+}
+
+// close is netpollclose.
+func (p *poller) close(fd int) error {
+	// Don't need to unregister because calling close()
+	// on fd will remove any kevents that reference the descriptor.
+	return nil
+}
+
+func (p *poller) destroy() error {
+	syscall.Close(p.breakRd)
+	syscall.Close(p.breakWr)
+	return syscall.Close(p.kq)
+}
+
+// wakeup is netpollBreak.
+func (p *poller) wakeup() {
+	for {
+		b := [1]byte{0}
+		n, err := syscall.Write(p.breakWr, b[:])
+		if n == 1 || err == syscall.EAGAIN {
+			break
+		}
+		if err == syscall.EINTR {
+			continue
+		}
+		panic("netpoll: netpollBreak write failed: " + err.Error())
+	}
+}
+
+// poll is netpoll, see netpoll_epoll.go.
+func (p *poller) poll(delay time.Duration, ready func(fd int, mode int32)) error {
+	var tp *syscall.Timespec
+	var ts syscall.Timespec
+	if delay < 0 {
+		tp = nil
+	} else if delay == 0 {
+		tp = &ts
+	} else {
+		// Darwin returns EINVAL if the sleep time is too long.
+		if delay > 1e6*time.Second {
+			delay = 1e6 * time.Second
+		}
+		ts = syscall.NsecToTimespec(int64(delay))
+		tp = &ts
+	}
+retry:
+	n, err := syscall.Kevent(p.kq, nil, p.events[:], tp)
+	if err != nil {
+		if err != syscall.EINTR {
+			return err
+		}
+		// If a timed sleep was interrupted, just return to
+		// recalculate how long we should sleep now.
+		if delay > 0 {
+			return nil
+		}
+		goto retry
+	}
+	for i := 0; i < n; i++ {
+		ev := &p.events[i]
+
+		if int(ev.Ident) == p.breakRd {
+			if ev.Filter != syscall.EVFILT_READ {
+				panic("netpoll: bad filter on break pipe")
+			}
+			if delay != 0 {
+				// netpollBreak could be picked up by a
+				// nonblocking poll. Only read the byte
+				// if blocking.
+				var tmp [16]byte
+				syscall.Read(p.breakRd, tmp[:])
+			}
+			continue
+		}
+
+		var mode int32
+		switch ev.Filter {
+		case syscall.EVFILT_READ:
+			mode += 'r'
+
+			// On some systems when the read end of a pipe
+			// is closed the write end will not get a
+			// _EVFILT_WRITE event, but will get a
+			// _EVFILT_READ event with EV_EOF set.
+			// Note that setting 'w' here just means that we
+			// will wake up a goroutine waiting to write;
+			// that goroutine will try the write again,
+			// and the appropriate thing will happen based
+			// on what that write returns (success, EPIPE, EAGAIN).
+			if ev.Flags&syscall.EV_EOF != 0 {
+				mode += 'w'
+			}
+		case syscall.EVFILT_WRITE:
+			mode += 'w'
+		}
+		if mode != 0 {
+			ready(int(ev.Ident), mode)
+		}
+	}
+	return nil
+}
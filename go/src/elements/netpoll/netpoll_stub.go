@@ -0,0 +1,31 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package netpoll
+
+import (
+	"errors"
+	"time"
+)
+
+var errNoPoller = errors.New("netpoll: no epoll or kqueue on this system")
+
+type poller struct{}
+
+func (p *poller) init() error                                        { return errNoPoller }
+func (p *poller) open(fd int) error                                  { return errNoPoller }
+func (p *poller) close(fd int) error                                 { return errNoPoller }
+func (p *poller) destroy() error                                     { return errNoPoller }
+func (p *poller) wakeup()                                            {}
+func (p *poller) poll(time.Duration, func(fd int, mode int32)) error { return errNoPoller }
+
+func sysRead(fd int, p []byte) (int, error)  { return 0, errNoPoller }
+func sysWrite(fd int, p []byte) (int, error) { return 0, errNoPoller }
+func sysClose(fd int) error                  { return errNoPoller }
+func isEAGAIN(err error) bool                { return false }
+func setNonblock(fd int) error               { return errNoPoller }
+func sysPipe() (r, w int, err error)         { return -1, -1, errNoPoller }
@@ -0,0 +1,34 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package registry_test
+
+import (
+	"elements/registry"
+	"fmt"
+)
+
+type pool struct{ name string }
+
+func (p *pool) Start() error { fmt.Println("open", p.name); return nil }
+func (p *pool) Stop() error  { fmt.Println("close", p.name); return nil }
+
+func Example() {
+	var r registry.Registry
+	r.Register("orders", &pool{"orders"})
+	r.Register("users", &pool{"users"})
+	r.Start()
+
+	var users *pool
+	if r.Lookup("users", &users) {
+		fmt.Println("found", users.name)
+	}
+	r.Stop()
+	// Output:
+	// open orders
+	// open users
+	// found users
+	// close users
+	// close orders
+}
@@ -0,0 +1,190 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package registry provides a registry of named objects, keyed by type
+// and name, with an ordered start and stop of the objects that need it.
+//
+// It is the plumbing a service builds on sync.Map to share its database
+// pools, clients and caches between components: lookups are lock-free,
+// and Lookup checks the type the caller asks for, so a name registered
+// with one type is not returned as another.
+package registry
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+)
+
+// A Starter is an object that must be started before use. Start is
+// called by Registry.Start.
+type Starter interface {
+	Start() error
+}
+
+// A Stopper is an object that must be stopped to release its resources.
+// Stop is called by Registry.Stop.
+type Stopper interface {
+	Stop() error
+}
+
+// ErrExists is returned by Register when the type and name are taken.
+var ErrExists = errors.New("registry: already registered")
+
+// ErrStarted is returned by Register once the Registry has started.
+var ErrStarted = errors.New("registry: registry has started")
+
+// A Registry holds objects by type and name. It is safe for concurrent
+// use. The zero value is an empty Registry ready to use.
+//
+// Objects are started in the order they were registered and stopped in
+// the reverse order, so an object registered after its dependencies is
+// started after them and stopped before them.
+type Registry struct {
+	m sync.Map // key -> interface{}
+
+	mu      sync.Mutex
+	order   []entry // registered objects, in order
+	started int           // number of objects in order that have been started
+	running bool
+}
+
+type key struct {
+	t    reflect.Type
+	name string
+}
+
+type entry struct {
+	name string
+	v    interface{}
+}
+
+// Register registers v under name and v's dynamic type. To register v as
+// an interface type, use RegisterAs.
+func (r *Registry) Register(name string, v interface{}) error {
+	if v == nil {
+		panic("registry: Register of nil")
+	}
+	return r.register(key{reflect.TypeOf(v), name}, v)
+}
+
+// RegisterAs registers *ptr under name and the type ptr points to, which
+// may be an interface type:
+//
+//	var s Store = newRedisStore()
+//	r.RegisterAs("sessions", &s)
+//
+// registers s so that it is found by Lookup("sessions", &store) for any
+// store of type Store, but not as a *redisStore.
+func (r *Registry) RegisterAs(name string, ptr interface{}) error {
+	p := pointer(ptr)
+	if p.Elem().Kind() == reflect.Interface && p.Elem().IsNil() {
+		panic("registry: RegisterAs of nil")
+	}
+	return r.register(key{p.Type().Elem(), name}, p.Elem().Interface())
+}
+
+func (r *Registry) register(k key, v interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.running {
+		return ErrStarted
+	}
+	if _, loaded := r.m.LoadOrStore(k, v); loaded {
+		return ErrExists
+	}
+	r.order = append(r.order, entry{k.name, v})
+	return nil
+}
+
+// Lookup stores into *ptr the object registered under name and the type
+// ptr points to, and reports whether there is one. It takes no lock.
+//
+//	var db *sql.DB
+//	if !r.Lookup("orders", &db) {
+//		...
+//	}
+func (r *Registry) Lookup(name string, ptr interface{}) bool {
+	p := pointer(ptr)
+	v, ok := r.m.Load(key{p.Type().Elem(), name})
+	if !ok {
+		return false
+	}
+	p.Elem().Set(reflect.ValueOf(v))
+	return true
+}
+
+// MustLookup is like Lookup but panics if there is no such object.
+func (r *Registry) MustLookup(name string, ptr interface{}) {
+	if !r.Lookup(name, ptr) {
+		panic("registry: no " + reflect.TypeOf(ptr).Elem().String() + " named " + quote(name))
+	}
+}
+
+// Range calls f for each registered object, in registration order, until
+// f returns false.
+func (r *Registry) Range(f func(name string, v interface{}) bool) {
+	r.mu.Lock()
+	all := r.order[:len(r.order):len(r.order)] // 之后的Register不会写到这个切片中
+	r.mu.Unlock()
+	for _, e := range all {
+		if !f(e.name, e.v) {
+			return
+		}
+	}
+}
+
+// Start starts every Starter in registration order. If one fails, Start
+// stops the objects it has already started, in reverse order, and returns
+// the error. After Start, Register fails with ErrStarted.
+func (r *Registry) Start() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.running {
+		return ErrStarted
+	}
+	r.running = true
+	for r.started < len(r.order) {
+		if s, ok := r.order[r.started].v.(Starter); ok {
+			if err := s.Start(); err != nil {
+				r.stopLocked()
+				return err
+			}
+		}
+		r.started++
+	}
+	return nil
+}
+
+// Stop stops every started Stopper in the reverse of registration order,
+// and returns the first error. All of them are stopped even if some fail.
+// Afterwards the Registry can be added to and started again.
+func (r *Registry) Stop() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stopLocked()
+}
+
+func (r *Registry) stopLocked() error {
+	var first error
+	for ; r.started > 0; r.started-- {
+		if s, ok := r.order[r.started-1].v.(Stopper); ok {
+			if err := s.Stop(); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	r.running = false
+	return first
+}
+
+func pointer(ptr interface{}) reflect.Value {
+	p := reflect.ValueOf(ptr)
+	if p.Kind() != reflect.Ptr || p.IsNil() {
+		panic("registry: not a non-nil pointer")
+	}
+	return p
+}
+
+func quote(s string) string { return `"` + s + `"` }
@@ -0,0 +1,148 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package registry_test
+
+import (
+	"elements/registry"
+	"errors"
+	"testing"
+)
+
+type store interface{ Get(string) string }
+
+type memStore struct{ prefix string }
+
+func (s *memStore) Get(k string) string { return s.prefix + k }
+
+func TestLookupByTypeAndName(t *testing.T) {
+	var r registry.Registry
+	a, b := &memStore{"a:"}, &memStore{"b:"}
+	if err := r.Register("a", a); err != nil {
+		t.Fatal(err)
+	}
+	var s store = b
+	if err := r.RegisterAs("b", &s); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("a", &memStore{}); err != registry.ErrExists {
+		t.Errorf("second Register(a) = %v, want ErrExists", err)
+	}
+	// 同一个名字, 不同的类型是不同的对象
+	if err := r.Register("a", 42); err != nil {
+		t.Errorf("Register(a, 42) = %v", err)
+	}
+
+	var got *memStore
+	if !r.Lookup("a", &got) || got != a {
+		t.Errorf("Lookup(a, *memStore) = %v", got)
+	}
+	var gs store
+	if !r.Lookup("b", &gs) || gs != store(b) {
+		t.Errorf("Lookup(b, store) = %v", gs)
+	}
+	// 按接口类型注册的不能按具体类型取出, 反过来也一样
+	if r.Lookup("b", &got) {
+		t.Error("Lookup(b, *memStore) found an object registered as store")
+	}
+	if r.Lookup("a", &gs) {
+		t.Error("Lookup(a, store) found an object registered as *memStore")
+	}
+	var n int
+	if !r.Lookup("a", &n) || n != 42 {
+		t.Errorf("Lookup(a, int) = %d", n)
+	}
+	var names []string
+	r.Range(func(name string, v interface{}) bool {
+		names = append(names, name)
+		return true
+	})
+	if len(names) != 3 || names[0] != "a" || names[1] != "b" || names[2] != "a" {
+		t.Errorf("Range in order %v", names)
+	}
+}
+
+func TestMustLookupPanics(t *testing.T) {
+	var r registry.Registry
+	defer func() {
+		if e := recover(); e != `registry: no int named "x"` {
+			t.Errorf("panic %v", e)
+		}
+	}()
+	var n int
+	r.MustLookup("x", &n)
+}
+
+type component struct {
+	name     string
+	log      *[]string
+	startErr error
+}
+
+func (c *component) Start() error {
+	*c.log = append(*c.log, "start "+c.name)
+	return c.startErr
+}
+
+func (c *component) Stop() error {
+	*c.log = append(*c.log, "stop "+c.name)
+	return nil
+}
+
+func TestStartStopOrder(t *testing.T) {
+	var r registry.Registry
+	var log []string
+	for _, name := range []string{"db", "cache", "server"} {
+		r.Register(name, &component{name: name, log: &log})
+	}
+	r.Register("config", "not a component")
+	if err := r.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register("late", &component{}); err != registry.ErrStarted {
+		t.Errorf("Register after Start = %v, want ErrStarted", err)
+	}
+	if err := r.Start(); err != registry.ErrStarted {
+		t.Errorf("second Start = %v, want ErrStarted", err)
+	}
+	if err := r.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"start db", "start cache", "start server", "stop server", "stop cache", "stop db"}
+	if !equal(log, want) {
+		t.Errorf("log = %v, want %v", log, want)
+	}
+}
+
+// 启动失败时, 已经启动的按相反的顺序停止, 失败的和之后的不会被停止
+func TestStartFailure(t *testing.T) {
+	var r registry.Registry
+	var log []string
+	boom := errors.New("boom")
+	r.Register("db", &component{name: "db", log: &log})
+	r.Register("cache", &component{name: "cache", log: &log, startErr: boom})
+	r.Register("server", &component{name: "server", log: &log})
+	if err := r.Start(); err != boom {
+		t.Fatalf("Start = %v, want boom", err)
+	}
+	want := []string{"start db", "start cache", "stop db"}
+	if !equal(log, want) {
+		t.Errorf("log = %v, want %v", log, want)
+	}
+	if err := r.Register("retry", &component{name: "retry", log: &log}); err != nil {
+		t.Errorf("Register after a failed Start = %v", err)
+	}
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
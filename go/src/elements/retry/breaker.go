@@ -0,0 +1,170 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package retry
+
+import (
+	"sync"
+	"time"
+)
+
+// A State is the state of a Breaker.
+type State int
+
+const (
+	// Closed lets every attempt through.
+	Closed State = iota
+
+	// Open refuses every attempt with ErrOpen.
+	Open
+
+	// HalfOpen lets one attempt through, to probe whether the dependency
+	// has recovered: its success closes the Breaker, and its failure
+	// opens it again.
+	HalfOpen
+)
+
+var stateNames = [...]string{"closed", "open", "half-open"}
+
+func (s State) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return "unknown"
+	}
+	return stateNames[s]
+}
+
+// BreakerConfig configures a Breaker.
+type BreakerConfig struct {
+	// Failures is how many failures in a row open the Breaker. Zero means
+	// 5.
+	Failures int
+
+	// Cooldown is how long the Breaker stays open before it lets a probe
+	// through. Zero means 10 seconds.
+	Cooldown time.Duration
+
+	// OnStateChange, if not nil, is called on each change of state. It
+	// must not call the Breaker.
+	OnStateChange func(from, to State)
+}
+
+// A Breaker is a circuit breaker: after a run of failures it refuses
+// attempts for a while, so that a dependency that is down is not sent
+// requests that cannot succeed, and gets room to recover. It is safe for
+// concurrent use, and is shared by the Policies of the calls to one
+// dependency.
+type Breaker struct {
+	failures int
+	cooldown time.Duration
+	onChange func(from, to State)
+
+	mu       sync.Mutex
+	state    State
+	inRow    int       // failures in a row while Closed
+	openedAt time.Time // when the Breaker last opened
+	probing  bool      // the probe of HalfOpen is in flight
+	gen      uint64    // counts the changes of state
+}
+
+// NewBreaker returns a closed Breaker configured by cfg.
+func NewBreaker(cfg BreakerConfig) *Breaker {
+	b := &Breaker{failures: cfg.Failures, cooldown: cfg.Cooldown, onChange: cfg.OnStateChange}
+	if b.failures <= 0 {
+		b.failures = 5
+	}
+	if b.cooldown <= 0 {
+		b.cooldown = 10 * time.Second
+	}
+	return b
+}
+
+// State returns the state of b.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == Open && time.Since(b.openedAt) >= b.cooldown {
+		// 冷却已经结束, 下一次尝试会作为探测放行
+		return HalfOpen
+	}
+	return b.state
+}
+
+// Do calls fn through b: it returns ErrOpen without calling fn if b
+// refuses the attempt, and records the outcome otherwise.
+func (b *Breaker) Do(fn func() error) error {
+	gen, err := b.allow()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	b.record(gen, err == nil)
+	return err
+}
+
+// allow reports whether an attempt may go through, and returns the
+// generation of the state that let it. Every attempt it lets through must
+// be recorded.
+func (b *Breaker) allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case Open:
+		if time.Since(b.openedAt) < b.cooldown {
+			return 0, ErrOpen
+		}
+		b.setLocked(HalfOpen)
+		b.probing = true
+	case HalfOpen:
+		if b.probing {
+			return 0, ErrOpen
+		}
+		b.probing = true
+	}
+	return b.gen, nil
+}
+
+// record records the outcome of an attempt that allow let through in
+// generation gen.
+func (b *Breaker) record(gen uint64, ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if gen != b.gen {
+		// 放行之后状态已经变了: 比如Closed时放行的慢请求, 在断路器打开又
+		// 进入HalfOpen之后才返回, 它的结果不能当作探测的结果
+		return
+	}
+	switch b.state {
+	case Closed:
+		if ok {
+			b.inRow = 0
+		} else if b.inRow++; b.inRow >= b.failures {
+			b.openLocked()
+		}
+	case HalfOpen:
+		b.probing = false
+		if ok {
+			b.inRow = 0
+			b.setLocked(Closed)
+		} else {
+			b.openLocked()
+		}
+	}
+}
+
+func (b *Breaker) openLocked() {
+	b.openedAt = time.Now()
+	b.setLocked(Open)
+}
+
+func (b *Breaker) setLocked(s State) {
+	from := b.state
+	if from == s {
+		return
+	}
+	b.state = s
+	b.gen++
+	if b.onChange != nil {
+		b.onChange(from, s)
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package retry_test
+
+import (
+	"context"
+	"elements/retry"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	var changes []string
+	b := retry.NewBreaker(retry.BreakerConfig{
+		Failures:      3,
+		Cooldown:      20 * time.Millisecond,
+		OnStateChange: func(from, to retry.State) { changes = append(changes, from.String()+">"+to.String()) },
+	})
+	fail := func() error { return errBoom }
+	ok := func() error { return nil }
+	b.Do(fail)
+	b.Do(fail)
+	b.Do(ok) // 成功让连续失败的计数清零
+	for i := 0; i < 3; i++ {
+		if err := b.Do(fail); err != errBoom {
+			t.Fatalf("Do = %v; want %v", err, errBoom)
+		}
+	}
+	if s := b.State(); s != retry.Open {
+		t.Fatalf("State = %v after 3 failures; want open", s)
+	}
+	called := false
+	if err := b.Do(func() error { called = true; return nil }); err != retry.ErrOpen || called {
+		t.Fatalf("Do of an open Breaker = %v, called %v; want %v, not called", err, called, retry.ErrOpen)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if s := b.State(); s != retry.HalfOpen {
+		t.Fatalf("State = %v after the cooldown; want half-open", s)
+	}
+	b.Do(fail) // 探测失败, 重新打开
+	if err := b.Do(ok); err != retry.ErrOpen {
+		t.Fatalf("Do after a failed probe = %v; want %v", err, retry.ErrOpen)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if err := b.Do(ok); err != nil {
+		t.Fatalf("probe = %v", err)
+	}
+	if s := b.State(); s != retry.Closed {
+		t.Fatalf("State = %v after a successful probe; want closed", s)
+	}
+	got := ""
+	for _, c := range changes {
+		got += c + " "
+	}
+	if got != "closed>open open>half-open half-open>open open>half-open half-open>closed " {
+		t.Fatalf("changes = %v", changes)
+	}
+}
+
+// TestHalfOpenProbe checks that a half-open Breaker lets one probe
+// through at a time.
+func TestHalfOpenProbe(t *testing.T) {
+	b := retry.NewBreaker(retry.BreakerConfig{Failures: 1, Cooldown: time.Millisecond})
+	b.Do(func() error { return errBoom })
+	time.Sleep(time.Millisecond)
+	var inner error
+	b.Do(func() error {
+		inner = b.Do(func() error { return nil })
+		return nil
+	})
+	if inner != retry.ErrOpen {
+		t.Fatalf("second attempt during the probe = %v; want %v", inner, retry.ErrOpen)
+	}
+}
+
+func TestDoBreaker(t *testing.T) {
+	b := retry.NewBreaker(retry.BreakerConfig{Failures: 2, Cooldown: time.Hour})
+	p := retry.Policy{MaxAttempts: 5, Initial: time.Microsecond, Breaker: b}
+	fn, calls := failing(10)
+	if err := retry.Do(context.Background(), p, fn); err != retry.ErrOpen || *calls != 2 {
+		t.Fatalf("Do = %v after %d calls; want %v after 2", err, *calls, retry.ErrOpen)
+	}
+	// 永久性的错误不算依赖的故障
+	b = retry.NewBreaker(retry.BreakerConfig{Failures: 1, Cooldown: time.Hour})
+	p.Breaker = b
+	retry.Do(context.Background(), p, func(context.Context) error { return retry.Permanent(errBoom) })
+	if s := b.State(); s != retry.Closed {
+		t.Fatalf("State = %v after a permanent error; want closed", s)
+	}
+}
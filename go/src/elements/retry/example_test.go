@@ -0,0 +1,35 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package retry_test
+
+import (
+	"context"
+	"elements/retry"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func ExampleDo() {
+	attempts := 0
+	err := retry.Do(context.Background(), retry.Policy{
+		MaxAttempts: 5,
+		Initial:     time.Millisecond,
+		Jitter:      retry.FullJitter,
+		OnRetry: func(attempt int, err error, wait time.Duration) {
+			fmt.Printf("attempt %d: %v\n", attempt, err)
+		},
+	}, func(ctx context.Context) error {
+		if attempts++; attempts < 3 {
+			return errors.New("connection reset")
+		}
+		return nil
+	})
+	fmt.Println(err, attempts)
+	// Output:
+	// attempt 1: connection reset
+	// attempt 2: connection reset
+	// <nil> 3
+}
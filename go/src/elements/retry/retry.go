@@ -0,0 +1,232 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package retry retries failing operations with exponential backoff and
+// jitter, within a retry budget, behind a circuit breaker.
+//
+//	err := retry.Do(ctx, retry.Policy{Jitter: retry.FullJitter}, func(ctx context.Context) error {
+//		return client.Call(ctx, req)
+//	})
+//
+// Backoff alone keeps one caller from hammering a failing dependency; the
+// Budget and the Breaker keep all of them from doing it together, which
+// is when retries turn a slow dependency into a dead one.
+package retry
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// A Jitter randomizes the waits between attempts, so that the callers
+// that failed together do not retry together.
+type Jitter int
+
+const (
+	// NoJitter waits the backoff exactly.
+	NoJitter Jitter = iota
+
+	// FullJitter waits a random duration in [0, backoff).
+	FullJitter
+
+	// EqualJitter waits half the backoff, plus a random duration in
+	// [0, backoff/2).
+	EqualJitter
+)
+
+// A Policy says how an operation is retried. The zero Policy makes 3
+// attempts, waiting 100 milliseconds and then 200.
+type Policy struct {
+	// MaxAttempts is how many times the operation is tried, the first
+	// time included. Zero means 3.
+	MaxAttempts int
+
+	// Initial is the backoff before the first retry. It is multiplied by
+	// Multiplier after each retry, up to Max. Zero means 100
+	// milliseconds, 10 seconds and 2.
+	Initial, Max time.Duration
+	Multiplier   float64
+
+	Jitter Jitter
+
+	// Retryable, if not nil, reports whether an error is worth retrying.
+	// Nil means every error is, except those marked Permanent.
+	Retryable func(err error) bool
+
+	// Budget, if not nil, limits retries to a share of the operations.
+	Budget *Budget
+
+	// Breaker, if not nil, fails attempts at once while it is open, and
+	// records the outcome of the others.
+	Breaker *Breaker
+
+	// OnRetry, if not nil, is called after each failed attempt that is
+	// going to be retried, with its number, from 1, its error, and the
+	// wait before the next attempt.
+	OnRetry func(attempt int, err error, wait time.Duration)
+}
+
+type permanent struct{ err error }
+
+func (p permanent) Error() string { return p.err.Error() }
+func (p permanent) Unwrap() error { return p.err }
+
+// Permanent marks err as not worth retrying: Do returns it, unwrapped, at
+// once. It returns nil for a nil err.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanent{err}
+}
+
+// Do calls fn until it succeeds, fails with an error that is not
+// retryable, or has been tried p.MaxAttempts times, and returns its last
+// error. It gives up early, with the last error, when the Budget has no
+// retry left; when the Breaker is open, with ErrOpen; and when ctx is done
+// during a wait, with ctx.Err().
+func Do(ctx context.Context, p Policy, fn func(ctx context.Context) error) error {
+	max := p.MaxAttempts
+	if max <= 0 {
+		max = 3
+	}
+	var timer *time.Timer
+	for attempt := 1; ; attempt++ {
+		err := p.try(ctx, fn)
+		if err == nil {
+			if p.Budget != nil {
+				p.Budget.succeeded()
+			}
+			return nil
+		}
+		if pe, ok := err.(permanent); ok {
+			return pe.err
+		}
+		// 断路器打开时不记入预算: 这次尝试根本没有发出
+		if err == ErrOpen {
+			return err
+		}
+		// 不论是否重试, 失败都要记入预算: 预算衡量的是依赖的失败率
+		if p.Budget != nil && !p.Budget.failed() {
+			return err
+		}
+		if attempt >= max || ctx.Err() != nil || p.Retryable != nil && !p.Retryable(err) {
+			return err
+		}
+		wait := p.backoff(attempt)
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, err, wait)
+		}
+		if timer == nil {
+			timer = time.NewTimer(wait)
+			defer timer.Stop()
+		} else {
+			timer.Reset(wait)
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// try makes one attempt through the Breaker.
+func (p *Policy) try(ctx context.Context, fn func(ctx context.Context) error) error {
+	if p.Breaker == nil {
+		return fn(ctx)
+	}
+	gen, err := p.Breaker.allow()
+	if err != nil {
+		return err
+	}
+	err = fn(ctx)
+	_, perm := err.(permanent)
+	// 永久性的错误说明请求本身有问题, 不是依赖出了故障
+	p.Breaker.record(gen, err == nil || perm)
+	return err
+}
+
+// backoff returns the wait after attempt, with jitter.
+func (p *Policy) backoff(attempt int) time.Duration {
+	initial, max, mult := p.Initial, p.Max, p.Multiplier
+	if initial <= 0 {
+		initial = 100 * time.Millisecond
+	}
+	if max <= 0 {
+		max = 10 * time.Second
+	}
+	if mult < 1 {
+		mult = 2
+	}
+	d := float64(initial)
+	for i := 1; i < attempt && d < float64(max); i++ {
+		d *= mult
+	}
+	if d > float64(max) {
+		d = float64(max)
+	}
+	switch p.Jitter {
+	case FullJitter:
+		d = rand.Float64() * d
+	case EqualJitter:
+		d = d/2 + rand.Float64()*d/2
+	}
+	return time.Duration(d)
+}
+
+// A Budget limits retries to a share of the operations that use it, as
+// the retry throttling of gRPC does. It holds up to max tokens, and
+// starts full: each failed attempt costs a token, each success gives back
+// ratio of one, and retries stop while at most half the tokens are left. When a
+// dependency fails for everyone, the callers soon stop retrying it, and
+// start again as their first attempts begin to succeed.
+type Budget struct {
+	max, ratio float64
+
+	mu     sync.Mutex
+	tokens float64
+}
+
+// NewBudget returns a full Budget of max tokens, of which each success
+// gives back ratio. A ratio of 0.1 allows about one retry for ten
+// successes in the long run.
+func NewBudget(max int, ratio float64) *Budget {
+	if max <= 0 || ratio <= 0 {
+		panic("retry: NewBudget with non-positive max or ratio")
+	}
+	return &Budget{max: float64(max), ratio: ratio, tokens: float64(max)}
+}
+
+// Tokens returns how many tokens b has left.
+func (b *Budget) Tokens() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.tokens
+}
+
+// failed records a failed attempt, and reports whether it may be
+// retried.
+func (b *Budget) failed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.tokens--; b.tokens < 0 {
+		b.tokens = 0
+	}
+	return b.tokens > b.max/2
+}
+
+func (b *Budget) succeeded() {
+	b.mu.Lock()
+	if b.tokens += b.ratio; b.tokens > b.max {
+		b.tokens = b.max
+	}
+	b.mu.Unlock()
+}
+
+// ErrOpen is returned for attempts refused by an open Breaker.
+var ErrOpen = errors.New("retry: circuit breaker is open")
@@ -0,0 +1,178 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package retry_test
+
+import (
+	"context"
+	"elements/retry"
+	"errors"
+	"testing"
+	"time"
+)
+
+var errBoom = errors.New("boom")
+
+// failing returns an operation that fails n times, and then succeeds, and
+// a pointer to the count of its calls.
+func failing(n int) (func(context.Context) error, *int) {
+	calls := 0
+	return func(context.Context) error {
+		calls++
+		if calls <= n {
+			return errBoom
+		}
+		return nil
+	}, &calls
+}
+
+func TestDo(t *testing.T) {
+	var waits []time.Duration
+	p := retry.Policy{
+		MaxAttempts: 4,
+		Initial:     time.Millisecond,
+		OnRetry:     func(attempt int, err error, wait time.Duration) { waits = append(waits, wait) },
+	}
+	fn, calls := failing(3)
+	if err := retry.Do(context.Background(), p, fn); err != nil || *calls != 4 {
+		t.Fatalf("Do = %v after %d calls; want nil after 4", err, *calls)
+	}
+	want := []time.Duration{time.Millisecond, 2 * time.Millisecond, 4 * time.Millisecond}
+	if len(waits) != len(want) {
+		t.Fatalf("waits = %v; want %v", waits, want)
+	}
+	for i := range want {
+		if waits[i] != want[i] {
+			t.Fatalf("waits = %v; want %v", waits, want)
+		}
+	}
+
+	fn, calls = failing(10)
+	if err := retry.Do(context.Background(), p, fn); err != errBoom || *calls != 4 {
+		t.Fatalf("Do = %v after %d calls; want %v after 4", err, *calls, errBoom)
+	}
+}
+
+func TestDefaults(t *testing.T) {
+	var waits []time.Duration
+	fn, calls := failing(10)
+	retry.Do(context.Background(), retry.Policy{
+		Initial: time.Millisecond,
+		OnRetry: func(attempt int, err error, wait time.Duration) { waits = append(waits, wait) },
+	}, fn)
+	if *calls != 3 || len(waits) != 2 || waits[1] != 2*time.Millisecond {
+		t.Fatalf("%d calls, waits %v; want 3 calls, waits [1ms 2ms]", *calls, waits)
+	}
+}
+
+func TestJitter(t *testing.T) {
+	for _, tt := range []struct {
+		jitter   retry.Jitter
+		min, max time.Duration
+	}{
+		{retry.FullJitter, 0, 8 * time.Millisecond},
+		{retry.EqualJitter, 4 * time.Millisecond, 8 * time.Millisecond},
+	} {
+		p := retry.Policy{
+			MaxAttempts: 2,
+			Initial:     8 * time.Millisecond,
+			Jitter:      tt.jitter,
+			OnRetry: func(attempt int, err error, wait time.Duration) {
+				if wait < tt.min || wait >= tt.max {
+					t.Errorf("jitter %d: wait %v not in [%v, %v)", tt.jitter, wait, tt.min, tt.max)
+				}
+			},
+		}
+		for i := 0; i < 20; i++ {
+			fn, _ := failing(1)
+			retry.Do(context.Background(), p, fn)
+		}
+	}
+}
+
+func TestMax(t *testing.T) {
+	var waits []time.Duration
+	fn, _ := failing(10)
+	retry.Do(context.Background(), retry.Policy{
+		MaxAttempts: 5,
+		Initial:     time.Millisecond,
+		Max:         3 * time.Millisecond,
+		Multiplier:  3,
+		OnRetry:     func(attempt int, err error, wait time.Duration) { waits = append(waits, wait) },
+	}, fn)
+	for i, want := range []time.Duration{1, 3, 3, 3} {
+		if waits[i] != want*time.Millisecond {
+			t.Fatalf("waits = %v; want [1ms 3ms 3ms 3ms]", waits)
+		}
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	calls := 0
+	err := retry.Do(context.Background(), retry.Policy{Initial: time.Millisecond}, func(context.Context) error {
+		calls++
+		return retry.Permanent(errBoom)
+	})
+	if err != errBoom || calls != 1 {
+		t.Fatalf("Do = %v after %d calls; want %v after 1", err, calls, errBoom)
+	}
+	if retry.Permanent(nil) != nil {
+		t.Fatal("Permanent(nil) != nil")
+	}
+
+	calls = 0
+	errOther := errors.New("other")
+	retry.Do(context.Background(), retry.Policy{
+		Initial:   time.Millisecond,
+		Retryable: func(err error) bool { return err != errOther },
+	}, func(context.Context) error {
+		calls++
+		return errOther
+	})
+	if calls != 1 {
+		t.Fatalf("%d calls of an operation that is not retryable", calls)
+	}
+}
+
+func TestContext(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	fn, calls := failing(10)
+	err := retry.Do(ctx, retry.Policy{MaxAttempts: 10, Initial: time.Hour}, fn)
+	if err != context.DeadlineExceeded || *calls != 1 {
+		t.Fatalf("Do = %v after %d calls; want %v after 1", err, *calls, context.DeadlineExceeded)
+	}
+}
+
+func TestBudget(t *testing.T) {
+	b := retry.NewBudget(4, 0.5)
+	p := retry.Policy{MaxAttempts: 10, Initial: time.Microsecond, Budget: b}
+	// 4个token, 每次失败一个, 剩下不超过一半时停止重试: 第二次失败之后
+	fn, calls := failing(10)
+	if err := retry.Do(context.Background(), p, fn); err != errBoom || *calls != 2 {
+		t.Fatalf("Do = %v after %d calls; want %v after 2", err, *calls, errBoom)
+	}
+	fn, calls = failing(10)
+	retry.Do(context.Background(), p, fn)
+	if *calls != 1 {
+		t.Fatalf("%d calls with an exhausted budget; want 1", *calls)
+	}
+	// 每次成功还回半个token
+	for i := 0; i < 4; i++ {
+		retry.Do(context.Background(), p, func(context.Context) error { return nil })
+	}
+	if got := b.Tokens(); got != 3 {
+		t.Fatalf("Tokens = %v after four successes; want 3", got)
+	}
+	for i := 0; i < 4; i++ {
+		retry.Do(context.Background(), p, func(context.Context) error { return nil })
+	}
+	if got := b.Tokens(); got != 4 {
+		t.Fatalf("Tokens = %v; want at most 4", got)
+	}
+	fn, calls = failing(1)
+	if err := retry.Do(context.Background(), p, fn); err != nil || *calls != 2 {
+		t.Fatalf("Do = %v after %d calls with a refilled budget; want nil after 2", err, *calls)
+	}
+}
@@ -0,0 +1,189 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scheduler
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// A CronSchedule is a parsed cron expression.
+type CronSchedule struct {
+	minute, hour, dom, month, dow uint64 // bit i is set if value i matches
+
+	// domStar and dowStar record a day field that was *: cron matches a
+	// day on either field when both are restricted, and on the other one
+	// when one is *.
+	domStar, dowStar bool
+}
+
+// ErrCronSyntax is returned by ParseCron for a malformed expression.
+var ErrCronSyntax = errors.New("scheduler: invalid cron expression")
+
+type cronField struct {
+	min, max int
+	names    []string // names of min, min+1, ...
+}
+
+var (
+	minuteField = cronField{0, 59, nil}
+	hourField   = cronField{0, 23, nil}
+	domField    = cronField{1, 31, nil}
+	monthField  = cronField{1, 12, []string{"jan", "feb", "mar", "apr", "may", "jun", "jul", "aug", "sep", "oct", "nov", "dec"}}
+	dowField    = cronField{0, 7, []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"}}
+)
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// ParseCron parses a cron expression of five fields: minute, hour, day of
+// the month, month and day of the week. A field is *, or a list of values
+// and ranges, each optionally with a step:
+//
+//	*/15 9-17 * * mon-fri   every 15 minutes during working hours
+//	0 0 1,15 * *            midnight on the 1st and 15th
+//
+// Months and days of the week may be named by their first three letters,
+// and Sunday is 0 or 7. The macros @yearly, @monthly, @weekly, @daily and
+// @hourly are accepted too.
+func ParseCron(expr string) (*CronSchedule, error) {
+	if m, ok := cronMacros[strings.ToLower(strings.TrimSpace(expr))]; ok {
+		expr = m
+	}
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, ErrCronSyntax
+	}
+	var s CronSchedule
+	var err error
+	for i, p := range []struct {
+		f    cronField
+		bits *uint64
+	}{
+		{minuteField, &s.minute},
+		{hourField, &s.hour},
+		{domField, &s.dom},
+		{monthField, &s.month},
+		{dowField, &s.dow},
+	} {
+		if *p.bits, err = p.f.parse(strings.ToLower(fields[i])); err != nil {
+			return nil, err
+		}
+	}
+	if s.dow&(1<<7) != 0 {
+		s.dow |= 1 // 7也是星期日
+	}
+	s.domStar, s.dowStar = fields[2] == "*", fields[4] == "*"
+	return &s, nil
+}
+
+// MustParseCron is like ParseCron but panics if expr is malformed.
+func MustParseCron(expr string) *CronSchedule {
+	s, err := ParseCron(expr)
+	if err != nil {
+		panic("scheduler: MustParseCron(" + strconv.Quote(expr) + "): " + err.Error())
+	}
+	return s
+}
+
+// parse parses one field into a bit set.
+func (f cronField) parse(s string) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(s, ",") {
+		lo, hi, step := f.min, f.max, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			n, err := strconv.Atoi(part[i+1:])
+			if err != nil || n <= 0 {
+				return 0, ErrCronSyntax
+			}
+			step, part = n, part[:i]
+		}
+		switch i := strings.IndexByte(part, '-'); {
+		case part == "*":
+		case i >= 0:
+			var err1, err2 error
+			lo, err1 = f.value(part[:i])
+			hi, err2 = f.value(part[i+1:])
+			if err1 != nil || err2 != nil || lo > hi {
+				return 0, ErrCronSyntax
+			}
+		default:
+			v, err := f.value(part)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if step == 1 {
+				hi = v
+			}
+			// 5/10这样的写法, 从5开始每10个一次, 直到最大值
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func (f cronField) value(s string) (int, error) {
+	for i, name := range f.names {
+		if s == name {
+			return f.min + i, nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil || v < f.min || v > f.max {
+		return 0, ErrCronSyntax
+	}
+	return v, nil
+}
+
+// Next returns the first time after t that s matches, in the location of
+// t, or the zero Time if there is none within five years, which happens
+// only for days that do not exist, such as February 30th.
+func (s *CronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.Year() + 5
+	for t.Year() <= limit {
+		// 从大到小, 不符合的字段直接跳到它的下一个值, 更小的字段从头开始
+		if s.month&(1<<uint(t.Month())) == 0 {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+			continue
+		}
+		if s.hour&(1<<uint(t.Hour())) == 0 {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+			continue
+		}
+		if s.minute&(1<<uint(t.Minute())) == 0 {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+func (s *CronSchedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domStar || s.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scheduler_test
+
+import (
+	"elements/scheduler"
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// 2020-03-04 10:17:30 is a Wednesday
+	from := time.Date(2020, 3, 4, 10, 17, 30, 0, time.UTC)
+	for _, tt := range []struct {
+		expr string
+		want string
+	}{
+		{"* * * * *", "2020-03-04 10:18"},
+		{"*/15 * * * *", "2020-03-04 10:30"},
+		{"5/20 * * * *", "2020-03-04 10:25"},
+		{"0 9-17 * * mon-fri", "2020-03-04 11:00"},
+		{"0 0 1,15 * *", "2020-03-15 00:00"},
+		{"30 8 * * sun", "2020-03-08 08:30"},
+		{"30 8 * * 7", "2020-03-08 08:30"},
+		{"0 0 1 jan *", "2021-01-01 00:00"},
+		{"@daily", "2020-03-05 00:00"},
+		{"@hourly", "2020-03-04 11:00"},
+		// 两个日期字段都有限制时, 满足一个就可以
+		{"0 0 13 * fri", "2020-03-06 00:00"},
+		{"0 0 29 2 *", "2024-02-29 00:00"},
+		{"0 0 30 2 *", ""},
+	} {
+		got := scheduler.MustParseCron(tt.expr).Next(from)
+		s := ""
+		if !got.IsZero() {
+			s = got.Format("2006-01-02 15:04")
+		}
+		if s != tt.want {
+			t.Errorf("Next of %q = %q; want %q", tt.expr, s, tt.want)
+		}
+	}
+}
+
+func TestCronSyntax(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"* * * foo *",
+	} {
+		if _, err := scheduler.ParseCron(expr); err != scheduler.ErrCronSyntax {
+			t.Errorf("ParseCron(%q) = %v; want %v", expr, err, scheduler.ErrCronSyntax)
+		}
+	}
+}
@@ -0,0 +1,27 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scheduler_test
+
+import (
+	"elements/scheduler"
+	"fmt"
+	"time"
+)
+
+func ExampleParseCron() {
+	c, err := scheduler.ParseCron("*/15 9-17 * * mon-fri")
+	if err != nil {
+		panic(err)
+	}
+	t := time.Date(2020, 3, 6, 17, 50, 0, 0, time.UTC) // a Friday
+	for i := 0; i < 3; i++ {
+		t = c.Next(t)
+		fmt.Println(t.Format("Mon 15:04"))
+	}
+	// Output:
+	// Mon 09:00
+	// Mon 09:15
+	// Mon 09:30
+}
@@ -0,0 +1,294 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package scheduler runs tasks after a delay, periodically, or on a cron
+// schedule, on a timing wheel.
+//
+//	s := scheduler.New(ctx, scheduler.Config{})
+//	s.After(time.Minute, sendReminder)
+//	s.FixedRate(10*time.Second, reportMetrics)
+//	s.FixedDelay(time.Second, drainOutbox)
+//	s.Cron("0 3 * * *", compactTables)
+//
+// The tasks share one goroutine that advances the wheel, rather than a
+// runtime timer each, and each run of a task has its own goroutine: a
+// task that panics is recovered and reported, and does not stop the
+// others, or its own next runs.
+package scheduler
+
+import (
+	"context"
+	"elements/clock"
+	"elements/lifecycle"
+	"elements/timermodel"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Config configures a Scheduler.
+type Config struct {
+	// Tick is the resolution of the timing wheel: tasks run up to a tick
+	// late. Zero means 10 milliseconds.
+	Tick time.Duration
+
+	// OnPanic, if not nil, is called with the value and the stack of a
+	// task that panicked. The panic is recovered either way.
+	OnPanic func(p interface{}, stack []byte)
+
+	// Clock, if not nil, is the clock the tasks are scheduled on, and the
+	// timing wheel runs on. Otherwise it is clock.Real.
+	Clock clock.Clock
+}
+
+// A Scheduler runs tasks at the times they are scheduled for. It is safe
+// for concurrent use.
+type Scheduler struct {
+	wheel   *timermodel.Wheel
+	clock   clock.Clock
+	onPanic func(p interface{}, stack []byte)
+	ctx     context.Context // the context of every run; done when the Scheduler stops
+	cancel  func()
+	done    chan struct{} // closed once the Scheduler has stopped
+
+	mu      sync.Mutex
+	stopped bool
+	runs    sync.WaitGroup // running tasks; Add with mu held and stopped false
+}
+
+// A Task is a scheduled task.
+type Task struct {
+	s    *Scheduler
+	f    func(ctx context.Context)
+	kind taskKind
+	d    time.Duration // the period of FixedRate and FixedDelay tasks
+	cron *CronSchedule
+
+	mu      sync.Mutex
+	timer   *timermodel.WheelTimer
+	due     time.Time
+	running bool // a run is in progress
+	stopped bool
+}
+
+type taskKind int
+
+const (
+	once taskKind = iota
+	fixedRate
+	fixedDelay
+	cron
+)
+
+// New returns a Scheduler that runs until ctx is done or Stop is called,
+// registered in lifecycle.Default.
+func New(ctx context.Context, cfg Config) *Scheduler {
+	tick := cfg.Tick
+	if tick <= 0 {
+		tick = 10 * time.Millisecond
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	c := clock.Or(cfg.Clock)
+	s := &Scheduler{
+		wheel:   timermodel.NewWheelClock(tick, 1024, c),
+		clock:   c,
+		onPanic: cfg.OnPanic,
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	go s.shutdown()
+	lifecycle.Register(s, "scheduler.Scheduler", func(ctx context.Context) error {
+		s.cancel()
+		select {
+		case <-s.done:
+			return nil
+		case <-ctx.Done():
+			// 不再等正在运行的任务, 它们的context已经取消了
+			return ctx.Err()
+		}
+	})
+	return s
+}
+
+// shutdown stops s once its context is done.
+func (s *Scheduler) shutdown() {
+	<-s.ctx.Done()
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	s.wheel.Stop()
+	s.runs.Wait()
+	lifecycle.Unregister(s)
+	close(s.done)
+}
+
+// Stop stops s: no task runs afterwards, and the context of the running
+// ones is canceled. Stop waits for them to return.
+func (s *Scheduler) Stop() {
+	s.cancel()
+	<-s.done
+}
+
+// Done returns a channel that is closed once s has stopped, because its
+// context is done or Stop was called, and its running tasks have
+// returned.
+func (s *Scheduler) Done() <-chan struct{} { return s.done }
+
+// After runs f once, after d.
+func (s *Scheduler) After(d time.Duration, f func(ctx context.Context)) *Task {
+	t := &Task{s: s, f: f, kind: once}
+	t.start(s.clock.Now().Add(d))
+	return t
+}
+
+// FixedRate runs f every d, the first time d from now. The runs keep to
+// the schedule however long they take: if a run is still in progress
+// when the next one is due, that one is skipped, and runs missed while
+// the process was stalled are not made up.
+func (s *Scheduler) FixedRate(d time.Duration, f func(ctx context.Context)) *Task {
+	if d <= 0 {
+		panic("scheduler: FixedRate with non-positive period")
+	}
+	t := &Task{s: s, f: f, kind: fixedRate, d: d}
+	t.start(s.clock.Now().Add(d))
+	return t
+}
+
+// FixedDelay runs f repeatedly, waiting d before the first run and after
+// each run returns.
+func (s *Scheduler) FixedDelay(d time.Duration, f func(ctx context.Context)) *Task {
+	if d <= 0 {
+		panic("scheduler: FixedDelay with non-positive delay")
+	}
+	t := &Task{s: s, f: f, kind: fixedDelay, d: d}
+	t.start(s.clock.Now().Add(d))
+	return t
+}
+
+// Cron runs f at the times matched by the cron expression expr, as parsed
+// by ParseCron, in local time. Like FixedRate, it skips a run that is due
+// while the previous one is in progress.
+func (s *Scheduler) Cron(expr string, f func(ctx context.Context)) (*Task, error) {
+	c, err := ParseCron(expr)
+	if err != nil {
+		return nil, err
+	}
+	return s.CronSchedule(c, f), nil
+}
+
+// CronSchedule is like Cron, with a parsed expression.
+func (s *Scheduler) CronSchedule(c *CronSchedule, f func(ctx context.Context)) *Task {
+	t := &Task{s: s, f: f, kind: cron, cron: c}
+	if next := c.Next(s.clock.Now()); !next.IsZero() {
+		t.start(next)
+	}
+	return t
+}
+
+// Stop stops t from running again. It does not wait for a run in
+// progress. It returns false if t was stopped already, or was a task of
+// After that has run.
+func (t *Task) Stop() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stopped {
+		return false
+	}
+	t.stopped = true
+	if t.timer != nil {
+		t.timer.Stop()
+	}
+	return true
+}
+
+func (t *Task) start(due time.Time) {
+	t.mu.Lock()
+	t.armLocked(due)
+	t.mu.Unlock()
+}
+
+// armLocked schedules the next run of t at due. t.mu must be held.
+func (t *Task) armLocked(due time.Time) {
+	if t.stopped {
+		return
+	}
+	t.due = due
+	t.timer = t.s.wheel.AfterFunc(clock.Until(t.s.clock, due), t.fire)
+}
+
+// fire is called by the wheel when the run due at t.due may be due.
+func (t *Task) fire() {
+	now := t.s.clock.Now()
+	t.mu.Lock()
+	if t.stopped {
+		t.mu.Unlock()
+		return
+	}
+	if now.Before(t.due) {
+		// 时间轮按tick取整, 可能早不到一个tick; 很长的等待中ticker也可能
+		// 丢掉tick. 这里按时钟检查, 没到就再等剩下的时间
+		t.armLocked(t.due)
+		t.mu.Unlock()
+		return
+	}
+	skip := t.running
+	switch t.kind {
+	case once:
+		t.stopped = true
+	case fixedRate:
+		// 按计划的时间推算下一次, 不因为这一次晚了而漂移; 错过的不补
+		next := t.due.Add(t.d)
+		if !next.After(now) {
+			next = next.Add((now.Sub(next)/t.d + 1) * t.d)
+		}
+		t.armLocked(next)
+	case cron:
+		if next := t.cron.Next(now); !next.IsZero() {
+			t.armLocked(next)
+		} else {
+			t.stopped = true
+		}
+	case fixedDelay:
+		// 运行结束之后才安排下一次
+	}
+	if !skip {
+		t.running = true
+	}
+	t.mu.Unlock()
+	if !skip {
+		t.run()
+	}
+}
+
+// run runs f once, in the goroutine the wheel started for fire.
+func (t *Task) run() {
+	s := t.s
+	s.mu.Lock()
+	if s.stopped {
+		s.mu.Unlock()
+		return
+	}
+	s.runs.Add(1)
+	s.mu.Unlock()
+	defer s.runs.Done()
+
+	t.call(s.ctx)
+	t.mu.Lock()
+	t.running = false
+	if t.kind == fixedDelay {
+		t.armLocked(s.clock.Now().Add(t.d))
+	}
+	t.mu.Unlock()
+}
+
+// call calls f, recovering a panic.
+func (t *Task) call(ctx context.Context) {
+	defer func() {
+		if p := recover(); p != nil && t.s.onPanic != nil {
+			t.s.onPanic(p, debug.Stack())
+		}
+	}()
+	t.f(ctx)
+}
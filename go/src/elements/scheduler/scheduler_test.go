@@ -0,0 +1,177 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package scheduler_test
+
+import (
+	"context"
+	"elements/clock"
+	"elements/scheduler"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newScheduler(t *testing.T, cfg scheduler.Config) *scheduler.Scheduler {
+	if cfg.Tick == 0 {
+		cfg.Tick = time.Millisecond
+	}
+	s := scheduler.New(context.Background(), cfg)
+	t.Cleanup(s.Stop)
+	return s
+}
+
+// eventually waits for cond to hold.
+func eventually(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("never %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAfter(t *testing.T) {
+	s := newScheduler(t, scheduler.Config{})
+	start := time.Now()
+	ran := make(chan time.Duration, 2)
+	task := s.After(20*time.Millisecond, func(ctx context.Context) { ran <- time.Since(start) })
+	if d := <-ran; d < 20*time.Millisecond {
+		t.Fatalf("ran after %v; want at least 20ms", d)
+	}
+	if task.Stop() {
+		t.Fatal("Stop of a task that has run = true")
+	}
+	stopped := s.After(10*time.Millisecond, func(ctx context.Context) { ran <- 0 })
+	if !stopped.Stop() {
+		t.Fatal("Stop of a pending task = false")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if len(ran) != 0 {
+		t.Fatal("a stopped task ran")
+	}
+}
+
+func TestFixedRate(t *testing.T) {
+	s := newScheduler(t, scheduler.Config{})
+	var runs int32
+	task := s.FixedRate(5*time.Millisecond, func(ctx context.Context) { atomic.AddInt32(&runs, 1) })
+	eventually(t, "ran 3 times", func() bool { return atomic.LoadInt32(&runs) >= 3 })
+	task.Stop()
+	n := atomic.LoadInt32(&runs)
+	time.Sleep(20 * time.Millisecond)
+	if m := atomic.LoadInt32(&runs); m > n+1 {
+		t.Fatalf("%d runs after Stop", m-n)
+	}
+}
+
+// TestFixedRateSkips runs a task that takes longer than its period: the
+// runs never overlap.
+func TestFixedRateSkips(t *testing.T) {
+	s := newScheduler(t, scheduler.Config{})
+	var running, overlaps, runs int32
+	s.FixedRate(2*time.Millisecond, func(ctx context.Context) {
+		if atomic.AddInt32(&running, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		time.Sleep(10 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+		atomic.AddInt32(&runs, 1)
+	})
+	eventually(t, "ran 3 times", func() bool { return atomic.LoadInt32(&runs) >= 3 })
+	if n := atomic.LoadInt32(&overlaps); n != 0 {
+		t.Fatalf("%d runs overlapped", n)
+	}
+}
+
+func TestFixedDelay(t *testing.T) {
+	s := newScheduler(t, scheduler.Config{})
+	var last time.Time
+	gaps := make(chan time.Duration, 10)
+	s.FixedDelay(10*time.Millisecond, func(ctx context.Context) {
+		if !last.IsZero() {
+			gaps <- time.Since(last)
+		}
+		time.Sleep(5 * time.Millisecond)
+		last = time.Now()
+	})
+	for i := 0; i < 3; i++ {
+		if d := <-gaps; d < 10*time.Millisecond {
+			t.Fatalf("run started %v after the previous returned; want at least 10ms", d)
+		}
+	}
+}
+
+func TestPanic(t *testing.T) {
+	panics := make(chan interface{}, 10)
+	s := newScheduler(t, scheduler.Config{OnPanic: func(p interface{}, stack []byte) {
+		if len(stack) == 0 {
+			p = "no stack"
+		}
+		panics <- p
+	}})
+	var runs int32
+	s.FixedRate(2*time.Millisecond, func(ctx context.Context) {
+		atomic.AddInt32(&runs, 1)
+		panic("oops")
+	})
+	for i := 0; i < 2; i++ {
+		if p := <-panics; p != "oops" {
+			t.Fatalf("OnPanic got %v; want oops", p)
+		}
+	}
+	if atomic.LoadInt32(&runs) < 2 {
+		t.Fatal("a panic stopped the task")
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := scheduler.New(ctx, scheduler.Config{Tick: time.Millisecond})
+	started := make(chan struct{})
+	var returned int32
+	s.After(time.Millisecond, func(ctx context.Context) {
+		close(started)
+		<-ctx.Done()
+		atomic.StoreInt32(&returned, 1)
+	})
+	var late int32
+	s.After(time.Hour, func(ctx context.Context) { atomic.StoreInt32(&late, 1) })
+	<-started
+	cancel()
+	<-s.Done()
+	if atomic.LoadInt32(&returned) != 1 {
+		t.Fatal("Done closed before the running task returned")
+	}
+	s.Stop()
+	s.After(time.Millisecond, func(ctx context.Context) { atomic.StoreInt32(&late, 1) })
+	time.Sleep(10 * time.Millisecond)
+	if atomic.LoadInt32(&late) != 0 {
+		t.Fatal("a task ran after the Scheduler stopped")
+	}
+}
+
+func TestFakeClock(t *testing.T) {
+	c := clock.NewFake(time.Date(2020, 1, 1, 0, 0, 0, 0, time.Local))
+	s := newScheduler(t, scheduler.Config{Tick: time.Second, Clock: c})
+	ran := make(chan time.Time, 10)
+	s.FixedRate(time.Hour, func(ctx context.Context) { ran <- c.Now() })
+	s.Cron("30 3 * * *", func(ctx context.Context) { ran <- c.Now() })
+	// 每次等任务运行完再前进, 否则FixedRate会把错过的一次跳过
+	for i := 1; i <= 3; i++ {
+		c.Advance(time.Hour)
+		if at := <-ran; at.Sub(c.Now()) != 0 {
+			t.Fatalf("run %d at %v, want %v", i, at, c.Now())
+		}
+	}
+	c.Advance(30 * time.Minute)
+	if at := <-ran; at.Hour() != 3 || at.Minute() != 30 {
+		t.Fatalf("cron task ran at %v, want 3:30", at)
+	}
+	if len(ran) != 0 {
+		t.Errorf("%d runs more than scheduled", len(ran))
+	}
+}
@@ -0,0 +1,240 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package semaphore
+
+import (
+	"context"
+	"elements/clock"
+	"elements/errs"
+	"sync"
+	"time"
+)
+
+// ErrBurst is returned by Wait for more tokens than a bucket holds. It
+// is errs.ErrCapacity to errors.Is.
+var ErrBurst = errs.New("semaphore: wait for more tokens than the burst", errs.ErrCapacity)
+
+// ErrWaitTimeout is returned by Wait when the tokens will not be there
+// before the deadline of its context. It is errs.ErrTimeout to errors.Is.
+var ErrWaitTimeout = errs.New("semaphore: tokens not available before the deadline", errs.ErrTimeout)
+
+// A Limiter is a token bucket: it limits events to rate per second on
+// average, with bursts of up to burst at once. It is safe for concurrent
+// use.
+//
+// Weighted限制同时进行的数量, Limiter限制单位时间内的数量. 实现是GCRA:
+// 不记录令牌数, 只记录桶"理论上空到什么时候"(tat). 每个事件把tat推后
+// 一个间隔, tat超过now太多(多于burst个间隔)就拒绝. 全是整数纳秒, 没有
+// 浮点数累积误差, 也不需要goroutine定时放入令牌
+type Limiter struct {
+	interval time.Duration // between tokens: 1/rate
+	burst    int
+	clock    clock.Clock
+
+	mu  sync.Mutex
+	tat time.Time // the theoretical arrival time: when the bucket is full again
+}
+
+// NewLimiter returns a full Limiter of rate events per second and bursts
+// of burst.
+func NewLimiter(rate float64, burst int) *Limiter {
+	return NewLimiterClock(rate, burst, clock.Real)
+}
+
+// NewLimiterClock is like NewLimiter, for a Limiter whose Allow and Wait
+// tell the time by c, or clock.Real if c is nil.
+func NewLimiterClock(rate float64, burst int, c clock.Clock) *Limiter {
+	if rate <= 0 || burst <= 0 {
+		panic("semaphore: NewLimiter with non-positive rate or burst")
+	}
+	return &Limiter{interval: time.Duration(float64(time.Second) / rate), burst: burst, clock: clock.Or(c)}
+}
+
+// Allow reports whether an event may happen now, and takes a token if it
+// may.
+func (l *Limiter) Allow() bool {
+	ok, _ := l.TakeN(l.clock.Now(), 1)
+	return ok
+}
+
+// TakeN takes n tokens at now if there are that many, and reports whether
+// it did. If not, it takes none, and returns how long after now the n
+// tokens will be there, which is the Retry-After of a rejected request. A
+// bucket never holds more than burst tokens, so for n larger than that
+// wait is negative, meaning never.
+func (l *Limiter) TakeN(now time.Time, n int) (ok bool, wait time.Duration) {
+	if n > l.burst {
+		return false, -1
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	tat := l.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	tat = tat.Add(time.Duration(n) * l.interval)
+	// 桶最多容纳burst个令牌: tat最多领先now burst个间隔
+	if over := tat.Sub(now) - time.Duration(l.burst)*l.interval; over > 0 {
+		return false, over
+	}
+	l.tat = tat
+	return true, 0
+}
+
+// Wait takes n tokens, waiting until they are there. It returns ErrBurst
+// if n is more than the burst, ErrWaitTimeout without waiting if the
+// tokens will be there only after the deadline of ctx, and ctx.Err() if
+// ctx is done first; in each case it takes no tokens.
+//
+// The tokens are reserved as soon as Wait is called, so that callers
+// waiting together get them in turn, and later Allows do not overtake
+// them.
+func (l *Limiter) Wait(ctx context.Context, n int) error {
+	if n > l.burst {
+		return ErrBurst
+	}
+	now := l.clock.Now()
+	l.mu.Lock()
+	tat := l.tat
+	if tat.Before(now) {
+		tat = now
+	}
+	tat = tat.Add(time.Duration(n) * l.interval)
+	wait := tat.Sub(now) - time.Duration(l.burst)*l.interval
+	if wait <= 0 {
+		l.tat = tat
+		l.mu.Unlock()
+		return nil
+	}
+	// 截止时间是真实的时间, 等待时间在l.clock上: 比较的是剩下的时间
+	if d, ok := ctx.Deadline(); ok && time.Until(d) < wait {
+		l.mu.Unlock()
+		return ErrWaitTimeout
+	}
+	l.tat = tat
+	l.mu.Unlock()
+
+	t := l.clock.NewTimer(wait)
+	defer t.Stop()
+	select {
+	case <-t.C():
+		return nil
+	case <-ctx.Done():
+		// 退还预订的令牌. 之后预订的调用者仍然按原来的时间等待, 它们只是
+		// 少等了; 不会有人因此多等
+		l.mu.Lock()
+		l.tat = l.tat.Add(-time.Duration(n) * l.interval)
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// full reports whether l is full at now: it has no state worth keeping.
+func (l *Limiter) full(now time.Time) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return !l.tat.After(now)
+}
+
+// A KeyedLimiter keeps a Limiter per key, such as a client or a tenant,
+// created on first use. Limiters that have refilled are dropped now and
+// then, since a full bucket is the same as a new one, so the keys need
+// not be a bounded set.
+type KeyedLimiter struct {
+	rate  float64
+	burst int
+	idle  time.Duration // time to refill an empty bucket
+	clock clock.Clock
+
+	m sync.Map // key -> *Limiter
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+// NewKeyedLimiter returns a KeyedLimiter whose Limiters have rate events
+// per second and bursts of burst.
+func NewKeyedLimiter(rate float64, burst int) *KeyedLimiter {
+	return NewKeyedLimiterClock(rate, burst, clock.Real)
+}
+
+// NewKeyedLimiterClock is like NewKeyedLimiter, for a KeyedLimiter whose
+// Limiters tell the time by c, or clock.Real if c is nil.
+func NewKeyedLimiterClock(rate float64, burst int, c clock.Clock) *KeyedLimiter {
+	if rate <= 0 || burst <= 0 {
+		panic("semaphore: NewKeyedLimiter with non-positive rate or burst")
+	}
+	c = clock.Or(c)
+	return &KeyedLimiter{
+		rate:      rate,
+		burst:     burst,
+		idle:      time.Duration(float64(burst) / rate * float64(time.Second)),
+		clock:     c,
+		lastSweep: c.Now(),
+	}
+}
+
+// Allow reports whether an event for key may happen now, as
+// Limiter.Allow does.
+func (k *KeyedLimiter) Allow(key interface{}) bool {
+	ok, _ := k.TakeN(key, k.clock.Now(), 1)
+	return ok
+}
+
+// TakeN takes n tokens for key, as Limiter.TakeN does.
+func (k *KeyedLimiter) TakeN(key interface{}, now time.Time, n int) (ok bool, wait time.Duration) {
+	l, found := k.m.Load(key)
+	if !found {
+		l, _ = k.m.LoadOrStore(key, NewLimiterClock(k.rate, k.burst, k.clock))
+	}
+	ok, wait = l.(*Limiter).TakeN(now, n)
+	k.maybeSweep(now)
+	return ok, wait
+}
+
+// Wait takes n tokens for key, as Limiter.Wait does. Its errors are
+// *errs.KeyError, naming the key.
+func (k *KeyedLimiter) Wait(ctx context.Context, key interface{}, n int) error {
+	l, found := k.m.Load(key)
+	if !found {
+		l, _ = k.m.LoadOrStore(key, NewLimiterClock(k.rate, k.burst, k.clock))
+	}
+	err := l.(*Limiter).Wait(ctx, n)
+	k.maybeSweep(k.clock.Now())
+	if err != nil {
+		return &errs.KeyError{Op: "wait", Key: key, Err: err}
+	}
+	return nil
+}
+
+// Len returns the number of keys with a Limiter.
+func (k *KeyedLimiter) Len() int {
+	n := 0
+	k.m.Range(func(_, _ interface{}) bool {
+		n++
+		return true
+	})
+	return n
+}
+
+// maybeSweep drops the full Limiters, at most once per the time it takes
+// to refill one.
+func (k *KeyedLimiter) maybeSweep(now time.Time) {
+	k.mu.Lock()
+	if now.Sub(k.lastSweep) < k.idle {
+		k.mu.Unlock()
+		return
+	}
+	k.lastSweep = now
+	k.mu.Unlock()
+	// 删除和另一个goroutine取用同一个Limiter可能同时发生: 它取走的令牌
+	// 随Limiter一起丢掉, 新建的Limiter是满的, 这个key最多多得到一次突发
+	k.m.Range(func(key, l interface{}) bool {
+		if l.(*Limiter).full(now) {
+			k.m.Delete(key)
+		}
+		return true
+	})
+}
@@ -0,0 +1,151 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package semaphore_test
+
+import (
+	"context"
+	"elements/clock"
+	"elements/errs"
+	"elements/semaphore"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiter(t *testing.T) {
+	now := time.Now()
+	l := semaphore.NewLimiter(10, 3)
+	for i := 0; i < 3; i++ {
+		if ok, _ := l.TakeN(now, 1); !ok {
+			t.Fatalf("take %d of a burst of 3 refused", i)
+		}
+	}
+	ok, wait := l.TakeN(now, 1)
+	if ok || wait != 100*time.Millisecond {
+		t.Fatalf("TakeN of an empty bucket = %v, %v; want false, 100ms", ok, wait)
+	}
+	if ok, _ := l.TakeN(now.Add(wait), 1); !ok {
+		t.Fatal("TakeN after the wait refused")
+	}
+	// 空闲很久也只攒到burst个
+	later := now.Add(time.Hour)
+	if ok, _ := l.TakeN(later, 3); !ok {
+		t.Fatal("TakeN of a full burst refused")
+	}
+	if ok, wait := l.TakeN(later, 2); ok || wait != 200*time.Millisecond {
+		t.Fatalf("TakeN(2) of an empty bucket = %v, %v; want false, 200ms", ok, wait)
+	}
+	if ok, wait := l.TakeN(later, 4); ok || wait >= 0 {
+		t.Fatalf("TakeN beyond the burst = %v, %v; want false and a negative wait", ok, wait)
+	}
+}
+
+func TestKeyedLimiter(t *testing.T) {
+	now := time.Now()
+	k := semaphore.NewKeyedLimiter(1, 2)
+	for i := 0; i < 2; i++ {
+		if ok, _ := k.TakeN("a", now, 1); !ok {
+			t.Fatalf("take %d for a refused", i)
+		}
+	}
+	if ok, _ := k.TakeN("a", now, 1); ok {
+		t.Fatal("take beyond the burst for a allowed")
+	}
+	if ok, _ := k.TakeN("b", now, 1); !ok {
+		t.Fatal("b limited by the tokens of a")
+	}
+	if n := k.Len(); n != 2 {
+		t.Fatalf("Len = %d; want 2", n)
+	}
+	// 两个桶都在2秒后满了, 之后的一次取用顺便清理它们
+	k.TakeN("c", now.Add(3*time.Second), 1)
+	if n := k.Len(); n != 1 {
+		t.Fatalf("Len = %d after the buckets refilled; want 1", n)
+	}
+}
+
+func TestLimiterWait(t *testing.T) {
+	l := semaphore.NewLimiter(100, 1)
+	ctx := context.Background()
+	if err := l.Wait(ctx, 2); err != semaphore.ErrBurst || !errors.Is(err, errs.ErrCapacity) {
+		t.Fatalf("Wait beyond the burst = %v, want ErrBurst", err)
+	}
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := l.Wait(ctx, 1); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 第一个令牌是现成的, 之后每个等10ms
+	if d := time.Since(start); d < 15*time.Millisecond {
+		t.Errorf("3 Waits at 100/s took %v, want about 20ms", d)
+	}
+
+	// 等不到截止时间就立即返回, 不取走令牌
+	short, cancel := context.WithTimeout(ctx, time.Millisecond)
+	defer cancel()
+	if err := l.Wait(short, 1); err != semaphore.ErrWaitTimeout || !errors.Is(err, errs.ErrTimeout) {
+		t.Fatalf("Wait past the deadline = %v, want ErrWaitTimeout", err)
+	}
+	canceled, cancel2 := context.WithCancel(ctx)
+	cancel2()
+	if err := l.Wait(canceled, 1); err != context.Canceled {
+		t.Fatalf("Wait with a canceled context = %v", err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if !l.Allow() {
+		t.Error("the tokens of the failed Waits were not given back")
+	}
+}
+
+func TestKeyedLimiterWait(t *testing.T) {
+	k := semaphore.NewKeyedLimiter(1, 1)
+	err := k.Wait(context.Background(), "a", 2)
+	var ke *errs.KeyError
+	if !errors.As(err, &ke) || ke.Key != "a" || !errors.Is(err, semaphore.ErrBurst) {
+		t.Fatalf("Wait beyond the burst = %v, want a KeyError for a", err)
+	}
+	if err.Error() != "wait a: "+semaphore.ErrBurst.Error() {
+		t.Errorf("Error() = %q", err.Error())
+	}
+	if err := k.Wait(context.Background(), "a", 1); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLimiterFakeClock(t *testing.T) {
+	c := clock.NewFake(time.Unix(0, 0))
+	l := semaphore.NewLimiterClock(1, 2, c)
+	if !l.Allow() || !l.Allow() || l.Allow() {
+		t.Fatal("a bucket of 2 did not allow exactly 2 events at once")
+	}
+	c.Advance(time.Second)
+	if !l.Allow() || l.Allow() {
+		t.Fatal("not exactly one token a second later")
+	}
+
+	done := make(chan error)
+	go func() { done <- l.Wait(context.Background(), 2) }()
+	c.BlockUntil(1)
+	c.Advance(time.Second)
+	select {
+	case err := <-done:
+		t.Fatalf("Wait for 2 tokens returned %v after 1s", err)
+	default:
+	}
+	c.Advance(time.Second)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+
+	k := semaphore.NewKeyedLimiterClock(1, 1, c)
+	if !k.Allow("a") || k.Allow("a") {
+		t.Fatal("a bucket of 1 did not allow exactly 1 event")
+	}
+	c.Advance(time.Second)
+	if !k.Allow("a") {
+		t.Error("no token a second later")
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package semaphore
+
+import (
+	"context"
+	"time"
+)
+
+// A Mutex is a mutual exclusion lock whose Lock can give up: on a
+// context, after a timeout, or at once.
+//
+// sync.Mutex的Lock不能放弃等待. 容量为1的Weighted就是一把可以被取消的锁,
+// 而且等待者按FIFO获得锁, 不会像sync.Mutex的正常模式那样被新来的goroutine插队
+type Mutex struct {
+	s *Weighted
+}
+
+// NewMutex returns an unlocked Mutex.
+func NewMutex() *Mutex {
+	return &Mutex{s: NewWeighted(1)}
+}
+
+// Lock locks m, blocking until it is available.
+func (m *Mutex) Lock() {
+	m.s.Acquire(context.Background(), 1)
+}
+
+// LockContext locks m, blocking until it is available or ctx is done.
+// It returns ctx.Err() if it gave up, and nil if m is now locked.
+func (m *Mutex) LockContext(ctx context.Context) error {
+	return m.s.Acquire(ctx, 1)
+}
+
+// LockTimeout locks m, waiting at most d. It reports whether m is now locked.
+func (m *Mutex) LockTimeout(d time.Duration) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return m.s.Acquire(ctx, 1) == nil
+}
+
+// TryLock locks m if it is free and nobody is waiting for it, and reports
+// whether it did.
+func (m *Mutex) TryLock() bool {
+	return m.s.TryAcquire(1)
+}
+
+// Unlock unlocks m. It panics if m is not locked.
+func (m *Mutex) Unlock() {
+	m.s.Release(1)
+}
+
+// An RWMutex is a reader/writer lock whose lock methods can give up.
+// At most MaxReaders readers hold it at once.
+//
+// 读者获取1个单位, 写者获取全部. 正是notifyWaiters注释中的例子: 队列是FIFO,
+// 写者排到队首之后, 后来的读者都在它后面等, 写者不会饿死
+type RWMutex struct {
+	s *Weighted
+	n int64
+}
+
+// NewRWMutex returns an unlocked RWMutex that admits up to maxReaders
+// readers at once.
+func NewRWMutex(maxReaders int64) *RWMutex {
+	if maxReaders < 1 {
+		panic("semaphore: NewRWMutex with maxReaders < 1")
+	}
+	return &RWMutex{s: NewWeighted(maxReaders), n: maxReaders}
+}
+
+// Lock locks rw for writing, blocking until it is available.
+func (rw *RWMutex) Lock() {
+	rw.s.Acquire(context.Background(), rw.n)
+}
+
+// LockContext locks rw for writing, blocking until it is available or ctx
+// is done. It returns ctx.Err() if it gave up.
+func (rw *RWMutex) LockContext(ctx context.Context) error {
+	return rw.s.Acquire(ctx, rw.n)
+}
+
+// TryLock locks rw for writing if that is possible without waiting, and
+// reports whether it did.
+func (rw *RWMutex) TryLock() bool {
+	return rw.s.TryAcquire(rw.n)
+}
+
+// Unlock unlocks rw for writing.
+func (rw *RWMutex) Unlock() {
+	rw.s.Release(rw.n)
+}
+
+// RLock locks rw for reading, blocking until it is available.
+func (rw *RWMutex) RLock() {
+	rw.s.Acquire(context.Background(), 1)
+}
+
+// RLockContext locks rw for reading, blocking until it is available or ctx
+// is done. It returns ctx.Err() if it gave up.
+func (rw *RWMutex) RLockContext(ctx context.Context) error {
+	return rw.s.Acquire(ctx, 1)
+}
+
+// TryRLock locks rw for reading if that is possible without waiting, and
+// reports whether it did.
+func (rw *RWMutex) TryRLock() bool {
+	return rw.s.TryAcquire(1)
+}
+
+// RUnlock undoes a single RLock call.
+func (rw *RWMutex) RUnlock() {
+	rw.s.Release(1)
+}
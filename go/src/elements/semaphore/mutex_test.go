@@ -0,0 +1,118 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package semaphore_test
+
+import (
+	"context"
+	"elements/semaphore"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMutex(t *testing.T) {
+	m := semaphore.NewMutex()
+	n := 0
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				m.Lock()
+				n++
+				m.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	if n != 8000 {
+		t.Errorf("n = %d, want 8000", n)
+	}
+}
+
+func TestMutexGiveUp(t *testing.T) {
+	m := semaphore.NewMutex()
+	m.Lock()
+	if m.TryLock() {
+		t.Fatal("TryLock succeeded on a locked Mutex")
+	}
+	if m.LockTimeout(10 * time.Millisecond) {
+		t.Fatal("LockTimeout succeeded on a locked Mutex")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := m.LockContext(ctx); err != context.Canceled {
+		t.Fatalf("LockContext = %v, want %v", err, context.Canceled)
+	}
+	m.Unlock()
+	// 放弃的等待者不能留在队列中, 否则锁再也拿不到了
+	if !m.TryLock() {
+		t.Fatal("TryLock failed on an unlocked Mutex")
+	}
+	m.Unlock()
+}
+
+func TestMutexUnlockUnlocked(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Unlock of an unlocked Mutex did not panic")
+		}
+	}()
+	semaphore.NewMutex().Unlock()
+}
+
+func TestRWMutex(t *testing.T) {
+	rw := semaphore.NewRWMutex(4)
+	for i := 0; i < 4; i++ {
+		if !rw.TryRLock() {
+			t.Fatalf("TryRLock %d failed", i)
+		}
+	}
+	if rw.TryRLock() {
+		t.Fatal("fifth reader admitted")
+	}
+	if rw.TryLock() {
+		t.Fatal("writer admitted with readers")
+	}
+	for i := 0; i < 4; i++ {
+		rw.RUnlock()
+	}
+	if !rw.TryLock() {
+		t.Fatal("TryLock failed on an unlocked RWMutex")
+	}
+	if rw.TryRLock() {
+		t.Fatal("reader admitted with a writer")
+	}
+	rw.Unlock()
+}
+
+// TestRWMutexWriterNotStarved checks that a waiting writer holds back
+// readers that arrive after it, so that a steady stream of readers cannot
+// keep it out forever.
+func TestRWMutexWriterNotStarved(t *testing.T) {
+	rw := semaphore.NewRWMutex(4)
+	rw.RLock()
+
+	locked := make(chan bool)
+	go func() {
+		rw.Lock()
+		close(locked)
+		rw.Unlock()
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	// 还有3个空位, 但写者在排队, 新的读者要排在它后面
+	if rw.TryRLock() {
+		t.Fatal("reader overtook a waiting writer")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := rw.RLockContext(ctx); err == nil {
+		t.Fatal("reader overtook a waiting writer")
+	}
+	rw.RUnlock()
+	<-locked
+}
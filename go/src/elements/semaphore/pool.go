@@ -0,0 +1,122 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package semaphore
+
+import (
+	"context"
+	"elements/diag"
+	"elements/errs"
+	"sync"
+)
+
+// ErrPoolFull is returned by Pool.TryGet when every resource is in use.
+// It is errs.ErrCapacity to errors.Is.
+var ErrPoolFull = errs.New("semaphore: every resource of the pool is in use", errs.ErrCapacity)
+
+// A Pool is a bounded pool of reusable resources, such as connections.
+// At most Size resources exist at once; Get waits for one to be returned
+// when they are all in use.
+//
+// 和sync.Pool不同: sync.Pool中的对象随时可能被GC丢掉, 数量也没有上限,
+// 适合缓存; Pool限制同时存在的资源数量, 资源不会被丢掉, 适合连接这样
+// 创建代价大, 对端又限制了数量的资源. 信号量负责数量, idle只是缓存
+type Pool struct {
+	sem *Weighted
+	new func(ctx context.Context) (interface{}, error)
+
+	mu   sync.Mutex
+	idle []interface{}
+}
+
+// NewPool returns a pool of at most size resources. New creates a resource
+// when Get finds none idle.
+func NewPool(size int64, new func(ctx context.Context) (interface{}, error)) *Pool {
+	return &Pool{sem: NewWeighted(size), new: new}
+}
+
+// NewNamedPool returns a pool as NewPool does, and registers it in package
+// diag as a "semaphore.Pool" named name, with its Stats.
+func NewNamedPool(name string, size int64, new func(ctx context.Context) (interface{}, error)) *Pool {
+	p := NewPool(size, new)
+	diag.Register("semaphore.Pool", name, func() interface{} { return p.Stats() })
+	return p
+}
+
+// Get returns an idle resource, or a new one if there is room for it,
+// waiting until ctx is done for one to be returned. The caller must pass
+// the resource to Put or Discard.
+func (p *Pool) Get(ctx context.Context) (interface{}, error) {
+	if err := p.sem.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+	return p.get(ctx)
+}
+
+// TryGet is like Get, but returns ErrPoolFull at once instead of waiting
+// when Size resources are in use. ctx is passed to New.
+func (p *Pool) TryGet(ctx context.Context) (interface{}, error) {
+	if !p.sem.TryAcquire(1) {
+		return nil, ErrPoolFull
+	}
+	return p.get(ctx)
+}
+
+// get returns an idle resource or a new one, once its room is acquired.
+func (p *Pool) get(ctx context.Context) (interface{}, error) {
+	p.mu.Lock()
+	if n := len(p.idle); n > 0 {
+		x := p.idle[n-1]
+		p.idle[n-1] = nil
+		p.idle = p.idle[:n-1]
+		p.mu.Unlock()
+		return x, nil
+	}
+	p.mu.Unlock()
+
+	// 在锁外创建: 建立连接可能很慢, 不能让所有Put和Get等它
+	x, err := p.new(ctx)
+	if err != nil {
+		p.sem.Release(1)
+		return nil, err
+	}
+	return x, nil
+}
+
+// Put returns x to the pool for reuse.
+func (p *Pool) Put(x interface{}) {
+	p.mu.Lock()
+	p.idle = append(p.idle, x)
+	p.mu.Unlock()
+	// 先放回idle再释放: 被唤醒的Get可以直接复用它, 不用再创建一个
+	p.sem.Release(1)
+}
+
+// Discard gives up x, which must not be used again, making room for a new
+// resource. Use it for a resource that is broken or closed.
+func (p *Pool) Discard(x interface{}) {
+	p.sem.Release(1)
+}
+
+// Idle returns the number of idle resources in the pool.
+func (p *Pool) Idle() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.idle)
+}
+
+// PoolStats describes the resources of a Pool.
+type PoolStats struct {
+	Size  int64 // the most resources that may exist at once
+	InUse int64 // resources got and not yet put back or discarded
+	Idle  int   // resources waiting in the pool to be reused
+}
+
+// Stats returns the numbers of resources of p.
+func (p *Pool) Stats() PoolStats {
+	p.sem.mu.Lock()
+	inUse := p.sem.cur
+	p.sem.mu.Unlock()
+	return PoolStats{Size: p.sem.size, InUse: inUse, Idle: p.Idle()}
+}
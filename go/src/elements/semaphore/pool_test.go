@@ -0,0 +1,138 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package semaphore_test
+
+import (
+	"context"
+	"elements/errs"
+	"elements/semaphore"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type conn struct{ id int32 }
+
+func TestPool(t *testing.T) {
+	var created, inUse, maxInUse int32
+	p := semaphore.NewPool(3, func(context.Context) (interface{}, error) {
+		return &conn{atomic.AddInt32(&created, 1)}, nil
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				c, err := p.Get(context.Background())
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				n := atomic.AddInt32(&inUse, 1)
+				for {
+					m := atomic.LoadInt32(&maxInUse)
+					if n <= m || atomic.CompareAndSwapInt32(&maxInUse, m, n) {
+						break
+					}
+				}
+				atomic.AddInt32(&inUse, -1)
+				p.Put(c)
+			}
+		}()
+	}
+	wg.Wait()
+	if created > 3 {
+		t.Errorf("created %d resources, want at most 3", created)
+	}
+	if maxInUse > 3 {
+		t.Errorf("%d resources in use at once, want at most 3", maxInUse)
+	}
+	if p.Idle() != int(created) {
+		t.Errorf("Idle = %d, want %d", p.Idle(), created)
+	}
+}
+
+func TestPoolWaitsAndTimesOut(t *testing.T) {
+	p := semaphore.NewPool(1, func(context.Context) (interface{}, error) {
+		return new(conn), nil
+	})
+	c, _ := p.Get(context.Background())
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.Get(ctx); err != context.DeadlineExceeded {
+		t.Fatalf("Get = %v, want %v", err, context.DeadlineExceeded)
+	}
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		p.Put(c)
+	}()
+	got, err := p.Get(context.Background())
+	if err != nil || got != c {
+		t.Fatalf("Get = %v, %v, want the returned resource", got, err)
+	}
+}
+
+func TestPoolNewError(t *testing.T) {
+	errDial := errors.New("dial failed")
+	fail := true
+	p := semaphore.NewPool(1, func(context.Context) (interface{}, error) {
+		if fail {
+			return nil, errDial
+		}
+		return new(conn), nil
+	})
+	if _, err := p.Get(context.Background()); err != errDial {
+		t.Fatalf("Get = %v, want %v", err, errDial)
+	}
+	// 创建失败要还回位置, 否则一次失败就永久少一个资源
+	fail = false
+	c, err := p.Get(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.Discard(c)
+	if _, err := p.Get(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if p.Idle() != 0 {
+		t.Errorf("Idle = %d after Discard, want 0", p.Idle())
+	}
+}
+
+func TestPoolTryGet(t *testing.T) {
+	p := semaphore.NewPool(1, func(context.Context) (interface{}, error) {
+		return new(conn), nil
+	})
+	c, err := p.TryGet(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.TryGet(context.Background()); err != semaphore.ErrPoolFull || !errors.Is(err, errs.ErrCapacity) {
+		t.Fatalf("TryGet of a full pool = %v, want ErrPoolFull", err)
+	}
+	p.Put(c)
+	if got, err := p.TryGet(context.Background()); err != nil || got != c {
+		t.Fatalf("TryGet = %v, %v, want the returned resource", got, err)
+	}
+}
+
+func TestPoolStats(t *testing.T) {
+	p := semaphore.NewPool(3, func(context.Context) (interface{}, error) {
+		return new(conn), nil
+	})
+	a, _ := p.Get(context.Background())
+	b, _ := p.Get(context.Background())
+	p.Put(a)
+	if got, want := p.Stats(), (semaphore.PoolStats{Size: 3, InUse: 1, Idle: 1}); got != want {
+		t.Errorf("Stats = %+v, want %+v", got, want)
+	}
+	p.Discard(b)
+	if got := p.Stats(); got.InUse != 0 {
+		t.Errorf("InUse = %d after Discard", got.InUse)
+	}
+}
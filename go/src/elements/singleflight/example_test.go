@@ -0,0 +1,65 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package singleflight_test
+
+import (
+	"elements/singleflight"
+	"fmt"
+	"time"
+)
+
+func ExampleGroup() {
+	g := new(singleflight.Group)
+
+	block := make(chan struct{})
+	res1c := g.DoChan("key", func() (interface{}, error) {
+		<-block
+		return "func 1", nil
+	})
+	res2c := g.DoChan("key", func() (interface{}, error) {
+		<-block
+		return "func 2", nil
+	})
+	close(block)
+
+	res1 := <-res1c
+	res2 := <-res2c
+
+	// Results are shared by functions executed with duplicate keys.
+	fmt.Println("Shared:", res2.Shared)
+	// Only the first function is executed: it is registered and started with "key",
+	// and doesn't complete before the second function is registered with a duplicate key.
+	fmt.Println("Equal results:", res1.Val.(string) == res2.Val.(string))
+	fmt.Println("Result:", res1.Val)
+
+	// Output:
+	// Shared: true
+	// Equal results: true
+	// Result: func 1
+}
+
+func ExampleGroup_Forget() {
+	g := new(singleflight.Group)
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	old := g.DoChan("config", func() (interface{}, error) {
+		close(started)
+		<-release
+		return "v1", nil
+	})
+	<-started
+
+	// 配置刚被修改, 正在进行的读取会得到旧值. Forget之后的调用重新读取
+	g.Forget("config")
+	fresh := g.DoChan("config", func() (interface{}, error) {
+		time.Sleep(time.Millisecond)
+		return "v2", nil
+	})
+	close(release)
+
+	fmt.Println((<-old).Val, (<-fresh).Val)
+	// Output: v1 v2
+}
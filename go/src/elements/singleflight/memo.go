@@ -0,0 +1,117 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package singleflight
+
+import (
+	"sync"
+	"time"
+)
+
+// A MemoGroup is a Group that also remembers each key's result for TTL
+// after its call completes. Callers that arrive while the call is in
+// flight share it, as with Group; callers that arrive just after it
+// returned reuse its result instead of calling fn again.
+//
+// A Group alone suppresses only simultaneous calls. Under a request storm
+// the calls are rarely perfectly simultaneous: the first flight returns,
+// the next caller finds nothing in flight and starts another one, and
+// the backend still sees a call per flight duration. A short TTL, even a
+// fraction of a second, lets a whole storm ride on one call.
+//
+// The zero value is usable and caches for a zero TTL, which makes it a
+// plain Group.
+type MemoGroup struct {
+	// TTL is how long a result is reused after its call returns.
+	TTL time.Duration
+
+	// CacheErrors makes errors reused for TTL like values. By default an
+	// error is only shared by the callers of its flight, and the next
+	// caller tries again. Panics and runtime.Goexit are never cached.
+	CacheErrors bool
+
+	g Group
+
+	mu      sync.Mutex
+	m       map[string]memo // lazily initialized
+	sweepAt int
+}
+
+type memo struct {
+	val     interface{}
+	err     error
+	expires time.Time
+}
+
+// Do is like Group.Do, but returns a remembered result of fn if one is
+// less than TTL old. shared reports whether v was given to other callers:
+// those waiting on the same flight, and those served from the memo.
+func (g *MemoGroup) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
+	if v, err, ok := g.lookup(key); ok {
+		return v, err, true
+	}
+	var ran bool
+	v, err, shared = g.g.Do(key, func() (interface{}, error) {
+		// 在飞行中检查: lookup之后, 上一次调用可能刚刚返回并且记下了结果
+		if v, err, ok := g.lookup(key); ok {
+			return v, err
+		}
+		ran = true
+		v, err := fn()
+		// 在fn返回之后, 飞行结束(从Group.m中删除)之前记下结果. 之后到达的调用者
+		// 要么还能加入飞行, 要么能在memo中找到结果, 不会有空档
+		g.remember(key, v, err)
+		return v, err
+	})
+	return v, err, shared || !ran
+}
+
+func (g *MemoGroup) lookup(key string) (v interface{}, err error, ok bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	m, ok := g.m[key]
+	if !ok {
+		return nil, nil, false
+	}
+	if !time.Now().Before(m.expires) {
+		delete(g.m, key)
+		return nil, nil, false
+	}
+	return m.val, m.err, true
+}
+
+func (g *MemoGroup) remember(key string, v interface{}, err error) {
+	if g.TTL <= 0 || err != nil && !g.CacheErrors {
+		return
+	}
+	now := time.Now()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.m == nil {
+		g.m = make(map[string]memo)
+	}
+	g.m[key] = memo{v, err, now.Add(g.TTL)}
+	// 过期的结果只在被查到时删除, 从不再查的key会一直留着. map的大小每翻一倍
+	// 清理一次, 均摊到每次插入是O(1)
+	if len(g.m) > g.sweepAt {
+		for k, m := range g.m {
+			if !now.Before(m.expires) {
+				delete(g.m, k)
+			}
+		}
+		g.sweepAt = 2 * len(g.m)
+		if g.sweepAt < 64 {
+			g.sweepAt = 64
+		}
+	}
+}
+
+// Forget forgets the remembered result for key, and the call in flight
+// for it as Group.Forget does. The next Do calls fn.
+func (g *MemoGroup) Forget(key string) {
+	g.mu.Lock()
+	delete(g.m, key)
+	g.mu.Unlock()
+	g.g.Forget(key)
+}
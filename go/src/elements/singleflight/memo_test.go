@@ -0,0 +1,113 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package singleflight_test
+
+import (
+	"elements/singleflight"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoReuses(t *testing.T) {
+	g := singleflight.MemoGroup{TTL: time.Hour}
+	var calls int32
+	fn := func() (interface{}, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	}
+	v, _, shared := g.Do("k", fn)
+	if v != int32(1) || shared {
+		t.Fatalf("first Do = %v, shared %v", v, shared)
+	}
+	// 调用已经结束, Group会再调用一次, MemoGroup复用结果
+	v, _, shared = g.Do("k", fn)
+	if v != int32(1) || !shared || calls != 1 {
+		t.Fatalf("second Do = %v, shared %v, %d calls", v, shared, calls)
+	}
+	if v, _, _ := g.Do("other", fn); v != int32(2) {
+		t.Fatalf("another key got %v", v)
+	}
+	g.Forget("k")
+	if v, _, _ := g.Do("k", fn); v != int32(3) {
+		t.Fatalf("Do after Forget = %v", v)
+	}
+}
+
+func TestMemoExpires(t *testing.T) {
+	g := singleflight.MemoGroup{TTL: 20 * time.Millisecond}
+	var calls int32
+	fn := func() (interface{}, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	}
+	g.Do("k", fn)
+	g.Do("k", fn)
+	time.Sleep(30 * time.Millisecond)
+	if v, _, _ := g.Do("k", fn); v != int32(2) {
+		t.Fatalf("Do after TTL = %v, want a new call", v)
+	}
+}
+
+func TestMemoErrors(t *testing.T) {
+	errBackend := errors.New("backend down")
+	var calls int32
+	fn := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		return nil, errBackend
+	}
+	g := singleflight.MemoGroup{TTL: time.Hour}
+	g.Do("k", fn)
+	if _, err, _ := g.Do("k", fn); err != errBackend || calls != 2 {
+		t.Fatalf("default: %v, %d calls, want the error not cached", err, calls)
+	}
+	calls = 0
+	g = singleflight.MemoGroup{TTL: time.Hour, CacheErrors: true}
+	g.Do("k", fn)
+	if _, err, _ := g.Do("k", fn); err != errBackend || calls != 1 {
+		t.Fatalf("CacheErrors: %v, %d calls", err, calls)
+	}
+}
+
+func TestMemoZeroTTL(t *testing.T) {
+	var g singleflight.MemoGroup
+	var calls int32
+	fn := func() (interface{}, error) {
+		return atomic.AddInt32(&calls, 1), nil
+	}
+	g.Do("k", fn)
+	g.Do("k", fn)
+	if calls != 2 {
+		t.Errorf("%d calls with a zero TTL, want 2", calls)
+	}
+}
+
+// 一波接一波的调用者: 每一波都在上一次调用结束之后才到达. Group每一波调用一次,
+// MemoGroup在TTL之内只调用一次
+func TestMemoStorm(t *testing.T) {
+	var calls int32
+	fn := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		time.Sleep(time.Millisecond)
+		return "v", nil
+	}
+	g := singleflight.MemoGroup{TTL: time.Hour}
+	for wave := 0; wave < 10; wave++ {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if v, err, _ := g.Do("k", fn); v != "v" || err != nil {
+					t.Errorf("Do = %v, %v", v, err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+	if calls != 1 {
+		t.Errorf("%d calls for 10 waves, want 1", calls)
+	}
+}
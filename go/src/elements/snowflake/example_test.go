@@ -0,0 +1,18 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package snowflake_test
+
+import (
+	"elements/snowflake"
+	"fmt"
+)
+
+func Example() {
+	g := snowflake.New(snowflake.Config{Node: 42})
+	a, _ := g.Next()
+	b, _ := g.Next()
+	fmt.Println(a < b, a.String() < b.String(), len(a.String()), b.Node())
+	// Output: true true 13 42
+}
@@ -0,0 +1,9 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package snowflake
+
+// SetClock makes g read the time, in milliseconds since its Epoch, from
+// now. It must be called before g is used.
+func SetClock(g *Generator, now func() int64) { g.now = now }
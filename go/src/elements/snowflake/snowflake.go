@@ -0,0 +1,222 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package snowflake generates unique 64-bit IDs without coordination, in
+// the layout of Twitter's Snowflake:
+//
+//	| 1 bit 0 | 41 bits milliseconds since Epoch | 10 bits node | 12 bits sequence |
+//
+// IDs from the same Generator increase, IDs of Generators with different
+// nodes never collide, and IDs sort by the time they were made to within
+// the clock skew between the nodes. Their String form is 13 characters of
+// Crockford's base32 that sorts in the same order.
+package snowflake
+
+import (
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	nodeBits = 10
+	seqBits  = 12
+	timeBits = 63 - nodeBits - seqBits
+
+	// MaxNode is the largest node number.
+	MaxNode = 1<<nodeBits - 1
+
+	seqMask = 1<<seqBits - 1
+)
+
+// DefaultEpoch is the Epoch of a Config that sets none.
+var DefaultEpoch = time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// ErrClockSkew is returned by Next when the clock has gone back by more
+// than Config.MaxSkew since the last ID.
+var ErrClockSkew = errors.New("snowflake: clock moved backwards")
+
+// Config configures a Generator.
+type Config struct {
+	// Node is the number of this node, from 0 to MaxNode. No two
+	// Generators running at the same time may share one.
+	Node int
+
+	// Epoch is the time of the first ID. Zero means DefaultEpoch. IDs
+	// run out 2^41 milliseconds, about 69 years, after it.
+	Epoch time.Time
+
+	// MaxSkew is how far the clock may go back before Next fails. Until
+	// the clock catches up, IDs keep the time of the last one, and Next
+	// waits when their sequence runs out. Zero means 10 milliseconds.
+	MaxSkew time.Duration
+}
+
+// A Generator makes IDs. It is safe for concurrent use, and lock-free:
+// Next is a compare-and-swap of the last time and sequence issued.
+type Generator struct {
+	// state is the time in milliseconds since epoch, shifted left by
+	// seqBits, or'ed with the sequence of the last ID. It comes first so
+	// that it is 64-bit aligned; accessed atomically.
+	state uint64
+
+	waits, skews uint64 // accessed atomically
+
+	node    uint64
+	epoch   time.Time
+	maxSkew uint64       // milliseconds
+	now     func() int64 // milliseconds since epoch
+}
+
+// Stats holds counters describing a Generator's activity.
+type Stats struct {
+	// Waits counts the Next calls that waited for the next millisecond
+	// because the 4096 IDs of the current one were used up.
+	Waits uint64
+
+	// Skews counts the Next calls that found the clock behind the time of
+	// the last ID.
+	Skews uint64
+}
+
+// New returns a Generator configured by cfg. It panics if cfg.Node is out
+// of range.
+func New(cfg Config) *Generator {
+	if cfg.Node < 0 || cfg.Node > MaxNode {
+		panic("snowflake: node out of range")
+	}
+	g := &Generator{node: uint64(cfg.Node), epoch: cfg.Epoch}
+	if g.epoch.IsZero() {
+		g.epoch = DefaultEpoch
+	}
+	skew := cfg.MaxSkew
+	if skew <= 0 {
+		skew = 10 * time.Millisecond
+	}
+	g.maxSkew = uint64(skew / time.Millisecond)
+	epoch := g.epoch.UnixNano()
+	g.now = func() int64 { return (time.Now().UnixNano() - epoch) / int64(time.Millisecond) }
+	return g
+}
+
+// Next returns a new ID. It fails with ErrClockSkew if the clock is more
+// than MaxSkew behind the time of the last ID, and panics once the 41
+// bits of time run out.
+func (g *Generator) Next() (ID, error) {
+	// 每次调用最多计一次等待和一次回拨, 不论重试了多少次
+	skewed, waited := false, false
+	for {
+		old := atomic.LoadUint64(&g.state)
+		last := old >> seqBits
+		now := g.now()
+		if now < 0 || now>>timeBits != 0 {
+			panic("snowflake: clock outside the 41 bits after Epoch")
+		}
+		var next uint64
+		switch {
+		case uint64(now) > last:
+			next = uint64(now) << seqBits
+		case last-uint64(now) > g.maxSkew:
+			if !skewed {
+				atomic.AddUint64(&g.skews, 1)
+			}
+			return 0, ErrClockSkew
+		case old&seqMask < seqMask:
+			// 同一毫秒内, 或者时钟回拨了不超过MaxSkew: 沿用上一个ID的时间,
+			// ID仍然递增
+			next = old + 1
+			if uint64(now) < last && !skewed {
+				skewed = true
+				atomic.AddUint64(&g.skews, 1)
+			}
+		default:
+			// 这一毫秒的序号用完了. 不向下一毫秒借: 借了之后ID的时间跑在
+			// 时钟之前, 之后回拨的检查就不准了
+			if !waited {
+				waited = true
+				atomic.AddUint64(&g.waits, 1)
+			}
+			runtime.Gosched()
+			continue
+		}
+		if atomic.CompareAndSwapUint64(&g.state, old, next) {
+			return ID(next>>seqBits<<(nodeBits+seqBits) | g.node<<seqBits | next&seqMask), nil
+		}
+	}
+}
+
+// Stats returns the Generator's counters.
+func (g *Generator) Stats() Stats {
+	return Stats{Waits: atomic.LoadUint64(&g.waits), Skews: atomic.LoadUint64(&g.skews)}
+}
+
+// Time returns the time id was made at, to the millisecond, if it was
+// made by a Generator with the same Epoch as g.
+func (g *Generator) Time(id ID) time.Time {
+	return g.epoch.Add(time.Duration(id>>(nodeBits+seqBits)) * time.Millisecond)
+}
+
+// An ID is a unique identifier made by a Generator.
+type ID uint64
+
+// Node returns the node of the Generator that made id.
+func (id ID) Node() int { return int(id >> seqBits & MaxNode) }
+
+// Seq returns the sequence number of id within its millisecond.
+func (id ID) Seq() int { return int(id & seqMask) }
+
+// crockford is Crockford's base32 alphabet: digits and letters, without
+// I, L, O and U, in ASCII order so that the encoding sorts as the number.
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// String returns id in 13 characters of Crockford's base32. Strings of
+// IDs compare in the same order as the IDs.
+func (id ID) String() string {
+	var b [13]byte
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = crockford[id&31]
+		id >>= 5
+	}
+	return string(b[:])
+}
+
+// ErrSyntax is returned by Parse for a string that is not an ID.
+var ErrSyntax = errors.New("snowflake: invalid ID syntax")
+
+// Parse returns the ID whose String is s. It accepts lower case, and the
+// letters Crockford's base32 reads as digits: I and L as 1, O as 0.
+func Parse(s string) (ID, error) {
+	if len(s) != 13 {
+		return 0, ErrSyntax
+	}
+	var id ID
+	for i := 0; i < len(s); i++ {
+		d := decode(s[i])
+		if d < 0 || i == 0 && d > 7 {
+			// 第一个字符只有3位: 13个字符是65位, ID只有63位
+			return 0, ErrSyntax
+		}
+		id = id<<5 | ID(d)
+	}
+	return id, nil
+}
+
+func decode(c byte) int {
+	if 'a' <= c && c <= 'z' {
+		c -= 'a' - 'A'
+	}
+	switch c {
+	case 'I', 'L':
+		return 1
+	case 'O':
+		return 0
+	}
+	for i := 0; i < len(crockford); i++ {
+		if crockford[i] == c {
+			return i
+		}
+	}
+	return -1
+}
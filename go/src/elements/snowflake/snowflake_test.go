@@ -0,0 +1,169 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package snowflake_test
+
+import (
+	"elements/snowflake"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestNext(t *testing.T) {
+	g := snowflake.New(snowflake.Config{Node: 7})
+	before := time.Now().Truncate(time.Millisecond)
+	var last snowflake.ID
+	for i := 0; i < 10000; i++ {
+		id, err := g.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id <= last {
+			t.Fatalf("ID %d after %d", id, last)
+		}
+		if id.Node() != 7 {
+			t.Fatalf("Node = %d, want 7", id.Node())
+		}
+		last = id
+	}
+	if tm := g.Time(last); tm.Before(before) || tm.After(time.Now()) {
+		t.Errorf("Time = %v, want between %v and now", tm, before)
+	}
+}
+
+// 不同节点的Generator同时生成, ID互不相同
+func TestNextConcurrent(t *testing.T) {
+	const nodes, goroutines, ids = 3, 4, 5000
+	var mu sync.Mutex
+	seen := make(map[snowflake.ID]bool)
+	var wg sync.WaitGroup
+	for n := 0; n < nodes; n++ {
+		g := snowflake.New(snowflake.Config{Node: n})
+		for i := 0; i < goroutines; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				got := make([]snowflake.ID, 0, ids)
+				for j := 0; j < ids; j++ {
+					id, err := g.Next()
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					got = append(got, id)
+				}
+				// 同一个goroutine拿到的ID递增
+				if !sort.SliceIsSorted(got, func(a, b int) bool { return got[a] < got[b] }) {
+					t.Error("IDs of one goroutine out of order")
+				}
+				mu.Lock()
+				for _, id := range got {
+					if seen[id] {
+						t.Errorf("duplicate ID %v", id)
+					}
+					seen[id] = true
+				}
+				mu.Unlock()
+			}()
+		}
+	}
+	wg.Wait()
+	if len(seen) != nodes*goroutines*ids {
+		t.Errorf("%d distinct IDs, want %d", len(seen), nodes*goroutines*ids)
+	}
+}
+
+// 一毫秒的4096个序号用完之后, 等到下一毫秒
+func TestSequenceExhausted(t *testing.T) {
+	g := snowflake.New(snowflake.Config{})
+	var now int64 = 100
+	snowflake.SetClock(g, func() int64 { return atomic.LoadInt64(&now) })
+	for i := 0; i < 4096; i++ {
+		id, _ := g.Next()
+		if id.Seq() != i || g.Time(id) != snowflake.DefaultEpoch.Add(100*time.Millisecond) {
+			t.Fatalf("ID %d: Seq %d, Time %v", i, id.Seq(), g.Time(id))
+		}
+	}
+	done := make(chan snowflake.ID)
+	go func() {
+		id, _ := g.Next()
+		done <- id
+	}()
+	time.Sleep(10 * time.Millisecond)
+	select {
+	case <-done:
+		t.Fatal("Next returned with the sequence used up")
+	default:
+	}
+	atomic.StoreInt64(&now, 101)
+	if id := <-done; id.Seq() != 0 || g.Time(id) != snowflake.DefaultEpoch.Add(101*time.Millisecond) {
+		t.Errorf("ID after the wait: Seq %d, Time %v", id.Seq(), g.Time(id))
+	}
+	// 等待的Next在这10ms中重试了很多次, 只计一次
+	if st := g.Stats(); st.Waits != 1 {
+		t.Errorf("Stats = %+v, want 1 wait", st)
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	g := snowflake.New(snowflake.Config{MaxSkew: 5 * time.Millisecond})
+	now := int64(1000)
+	snowflake.SetClock(g, func() int64 { return now })
+	first, _ := g.Next()
+
+	// 小的回拨: 沿用上一个ID的时间, ID继续递增
+	now = 997
+	id, err := g.Next()
+	if err != nil || id <= first || g.Time(id) != g.Time(first) {
+		t.Errorf("Next after a 3ms skew = %v, %v", id, err)
+	}
+	// 超过MaxSkew的回拨报错, 时钟追上之后恢复
+	now = 990
+	if _, err := g.Next(); err != snowflake.ErrClockSkew {
+		t.Errorf("Next after a 10ms skew: err = %v, want ErrClockSkew", err)
+	}
+	now = 1001
+	if next, err := g.Next(); err != nil || next <= id {
+		t.Errorf("Next after the clock caught up = %v, %v", next, err)
+	}
+	if st := g.Stats(); st.Skews != 2 {
+		t.Errorf("Stats = %+v, want 2 skews", st)
+	}
+}
+
+func TestString(t *testing.T) {
+	ids := []snowflake.ID{0, 1, 31, 32, 1 << 40, 1<<63 - 1}
+	var last string
+	for _, id := range ids {
+		s := id.String()
+		if len(s) != 13 || s <= last {
+			t.Errorf("String(%d) = %q, after %q", id, s, last)
+		}
+		last = s
+		got, err := snowflake.Parse(s)
+		if err != nil || got != id {
+			t.Errorf("Parse(%q) = %d, %v; want %d", s, got, err, id)
+		}
+	}
+	if id, err := snowflake.Parse("0000000000o1l"); err != nil || id != 32+1 {
+		t.Errorf("Parse of lower case and look-alikes = %d, %v", id, err)
+	}
+	for _, s := range []string{"", "000000000000U", "8000000000000", "00000000000000"} {
+		if _, err := snowflake.Parse(s); err != snowflake.ErrSyntax {
+			t.Errorf("Parse(%q): err = %v, want ErrSyntax", s, err)
+		}
+	}
+}
+
+func BenchmarkNext(b *testing.B) {
+	g := snowflake.New(snowflake.Config{})
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			g.Next()
+		}
+	})
+}
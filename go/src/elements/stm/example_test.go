@@ -0,0 +1,71 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stm_test
+
+import (
+	"elements/stm"
+	"errors"
+	"fmt"
+)
+
+func Example() {
+	alice, bob := stm.NewTVar(100), stm.NewTVar(20)
+	errInsufficient := errors.New("insufficient funds")
+	transfer := func(from, to *stm.TVar, amount int) error {
+		return stm.Atomically(func(tx *stm.Tx) error {
+			f := tx.Get(from).(int)
+			if f < amount {
+				return errInsufficient
+			}
+			tx.Set(from, f-amount)
+			tx.Set(to, tx.Get(to).(int)+amount)
+			return nil
+		})
+	}
+	fmt.Println(transfer(alice, bob, 70))
+	fmt.Println(transfer(alice, bob, 70))
+	fmt.Println(alice.Load(), bob.Load())
+	// Output:
+	// <nil>
+	// insufficient funds
+	// 30 90
+}
+
+func ExampleTx_Retry() {
+	// 容量为2的队列: 空的时候取, 满的时候放, 都用Retry等待
+	items := stm.NewTVar([]string(nil))
+	put := func(s string) {
+		stm.Atomically(func(tx *stm.Tx) error {
+			q := tx.Get(items).([]string)
+			if len(q) == 2 {
+				tx.Retry()
+			}
+			tx.Set(items, append(q[:len(q):len(q)], s))
+			return nil
+		})
+	}
+	take := func() (s string) {
+		stm.Atomically(func(tx *stm.Tx) error {
+			q := tx.Get(items).([]string)
+			if len(q) == 0 {
+				tx.Retry()
+			}
+			s = q[0]
+			tx.Set(items, q[1:])
+			return nil
+		})
+		return s
+	}
+	go func() {
+		for _, s := range []string{"a", "b", "c", "d"} {
+			put(s)
+		}
+	}()
+	for i := 0; i < 4; i++ {
+		fmt.Print(take())
+	}
+	fmt.Println()
+	// Output: abcd
+}
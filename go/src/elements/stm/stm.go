@@ -0,0 +1,325 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package stm provides software transactional memory: variables that
+// are read and written together, atomically, by transactions.
+//
+// An invariant over several variables, say that money moved between
+// accounts is neither created nor lost, needs the variables locked
+// together, and code that locks more than one mutex must agree on an
+// order. With stm each variable is a TVar and the code that changes them
+// is a function run by Atomically:
+//
+//	err := stm.Atomically(func(tx *stm.Tx) error {
+//		from, to := tx.Get(a).(int), tx.Get(b).(int)
+//		if from < amount {
+//			return errInsufficient
+//		}
+//		tx.Set(a, from-amount)
+//		tx.Set(b, to+amount)
+//		return nil
+//	})
+//
+// The function sees the variables as they were at one point in time and
+// its writes take effect all at once, or not at all.
+//
+// There are no type parameters in this tree, so TVars hold an
+// interface{}, as sync.Map does.
+package stm
+
+import (
+	"errors"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// clock is the global version clock. Each transaction that writes takes
+// the next version, and every TVar records the version of the last
+// transaction that wrote it.
+var clock uint64 // accessed atomically
+
+// ids numbers the TVars, for committing transactions to lock them in a
+// common order.
+var ids uint64 // accessed atomically
+
+// A TVar is a transactional variable. It is read and written by the
+// transactions run by Atomically, and may be read on its own by Load.
+type TVar struct {
+	// lock is the version of the value, shifted left by one, with the low
+	// bit set while a committing transaction holds the TVar. First so it
+	// is 64-bit aligned; accessed atomically.
+	lock uint64
+
+	id uint64
+	p  unsafe.Pointer // *interface{}; written with the low bit of lock set
+
+	mu      sync.Mutex
+	waiters map[chan struct{}]struct{} // transactions blocked in Retry after reading the TVar
+}
+
+// NewTVar returns a TVar holding v.
+func NewTVar(v interface{}) *TVar {
+	return &TVar{id: atomic.AddUint64(&ids, 1), p: unsafe.Pointer(&v)}
+}
+
+// Load returns the value of v, as a transaction that only reads v would.
+func (v *TVar) Load() interface{} {
+	for {
+		l1 := atomic.LoadUint64(&v.lock)
+		p := atomic.LoadPointer(&v.p)
+		if l1&1 == 0 && atomic.LoadUint64(&v.lock) == l1 {
+			return *(*interface{})(p)
+		}
+		runtime.Gosched()
+	}
+}
+
+// A Tx is a transaction in progress. It is only valid inside the
+// function it was passed to, and must not be shared between goroutines.
+type Tx struct {
+	rv     uint64 // the version of the clock when the attempt began
+	reads  map[*TVar]struct{}
+	writes map[*TVar]interface{}
+}
+
+// Both are raised as panics by the Tx methods and recovered by
+// Atomically, so that they unwind the function however deep it is.
+var (
+	// errConflict aborts an attempt that read a TVar written since it
+	// began. Atomically runs the function again.
+	errConflict = errors.New("stm: conflict")
+
+	// errRetry aborts an attempt that called Retry. Atomically waits for
+	// a TVar it read to change before running the function again.
+	errRetry = errors.New("stm: retry")
+)
+
+// Get returns the value of v in the transaction: the value it last Set,
+// or else the value v had when the transaction began.
+func (tx *Tx) Get(v *TVar) interface{} {
+	if x, ok := tx.writes[v]; ok {
+		return x
+	}
+	l1 := atomic.LoadUint64(&v.lock)
+	p := atomic.LoadPointer(&v.p)
+	l2 := atomic.LoadUint64(&v.lock)
+	// v正在被提交, 在读的过程中被写过, 或者在这次尝试开始之后被写过:
+	// 继续下去的话, 读到的各个TVar可能不属于同一个时间点
+	if l1&1 != 0 || l1 != l2 || l1>>1 > tx.rv {
+		panic(errConflict)
+	}
+	tx.reads[v] = struct{}{}
+	return *(*interface{})(p)
+}
+
+// Set sets the value of v in the transaction. Other goroutines see it
+// once the transaction commits.
+func (tx *Tx) Set(v *TVar, x interface{}) {
+	tx.writes[v] = x
+}
+
+// Retry abandons the transaction and blocks until a TVar it read has
+// been changed by another transaction, then runs it again. It is how a
+// transaction waits for a condition, such as a queue being non-empty:
+//
+//	if tx.Get(n).(int) == 0 {
+//		tx.Retry()
+//	}
+//
+// Retry panics if the transaction has read no TVar, as nothing could wake
+// it.
+func (tx *Tx) Retry() {
+	if len(tx.reads) == 0 {
+		panic("stm: Retry in a transaction that read no TVar")
+	}
+	panic(errRetry)
+}
+
+// Atomically runs fn as a transaction and returns its error.
+//
+// If fn returns nil, its Sets take effect at once, as one change of all
+// the TVars. If it returns an error, they are discarded. If another
+// transaction commits a change to a TVar fn read before fn is done, fn is
+// run again, so fn must have no effect other than on TVars, and must not
+// call Atomically or recover the panics of the Tx methods.
+//
+// Transactions that touch different TVars do not wait for each other.
+func Atomically(fn func(tx *Tx) error) error {
+	tx := &Tx{
+		reads:  make(map[*TVar]struct{}),
+		writes: make(map[*TVar]interface{}),
+	}
+	for {
+		tx.rv = atomic.LoadUint64(&clock)
+		err := tx.run(fn)
+		switch {
+		case err == errConflict:
+		case err == errRetry:
+			tx.wait()
+		case err != nil:
+			return err
+		case tx.commit():
+			return nil
+		}
+		for v := range tx.reads {
+			delete(tx.reads, v)
+		}
+		for v := range tx.writes {
+			delete(tx.writes, v)
+		}
+		// 冲突的对方可能还在提交, 马上重来多半再次冲突
+		runtime.Gosched()
+	}
+}
+
+// run calls fn, turning the panics of the Tx methods into errors.
+func (tx *Tx) run(fn func(tx *Tx) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if r != errConflict && r != errRetry {
+				panic(r)
+			}
+			err = r.(error)
+		}
+	}()
+	return fn(tx)
+}
+
+// OrElse returns a transaction function that runs fns in turn until one
+// of them does not Retry, and returns its error. The Sets of a function
+// that Retries are discarded before the next one runs. If every function
+// Retries, the transaction Retries, and waits for any TVar read by any of
+// them to change.
+func OrElse(fns ...func(tx *Tx) error) func(tx *Tx) error {
+	return func(tx *Tx) error {
+		for _, fn := range fns {
+			saved := make(map[*TVar]interface{}, len(tx.writes))
+			for v, x := range tx.writes {
+				saved[v] = x
+			}
+			err := tx.run(fn)
+			if err != errRetry {
+				if err == errConflict {
+					panic(errConflict)
+				}
+				return err
+			}
+			// 读集合保留: 后面的分支也Retry的话, 任何一个分支读过的TVar
+			// 改变都应该唤醒这个事务
+			tx.writes = saved
+		}
+		tx.Retry()
+		return nil
+	}
+}
+
+// commit makes the writes of tx take effect, and reports whether it
+// could: false means a TVar tx read had been written since it began.
+func (tx *Tx) commit() bool {
+	if len(tx.writes) == 0 {
+		// 只读的事务: 每次Get都检查过版本不晚于rv, 读到的就是rv时刻的值
+		return true
+	}
+	vars := make([]*TVar, 0, len(tx.writes))
+	for v := range tx.writes {
+		vars = append(vars, v)
+	}
+	// 按id加锁, 提交的事务之间不会死锁. 持有锁的时间很短, 其中不运行用户的代码
+	sort.Slice(vars, func(i, j int) bool { return vars[i].id < vars[j].id })
+	locked := make([]uint64, len(vars))
+	for i, v := range vars {
+		locked[i] = v.acquire()
+	}
+
+	wv := atomic.AddUint64(&clock, 1)
+	if wv != tx.rv+1 {
+		// 开始之后有别的事务提交过, 检查读过的TVar没有被它们写过
+		for v := range tx.reads {
+			l := atomic.LoadUint64(&v.lock)
+			if _, mine := tx.writes[v]; mine {
+				l = locked[sort.Search(len(vars), func(i int) bool { return vars[i].id >= v.id })]
+			} else if l&1 != 0 {
+				tx.release(vars, locked)
+				return false
+			}
+			if l>>1 > tx.rv {
+				tx.release(vars, locked)
+				return false
+			}
+		}
+	}
+
+	for _, v := range vars {
+		x := tx.writes[v]
+		atomic.StorePointer(&v.p, unsafe.Pointer(&x))
+		atomic.StoreUint64(&v.lock, wv<<1)
+	}
+	for _, v := range vars {
+		v.notify()
+	}
+	return true
+}
+
+// acquire locks v for a committing transaction and returns its lock word
+// from before.
+func (v *TVar) acquire() uint64 {
+	for {
+		l := atomic.LoadUint64(&v.lock)
+		if l&1 == 0 && atomic.CompareAndSwapUint64(&v.lock, l, l|1) {
+			return l
+		}
+		runtime.Gosched()
+	}
+}
+
+// release unlocks vars, restoring the lock words they had.
+func (tx *Tx) release(vars []*TVar, locked []uint64) {
+	for i, v := range vars {
+		atomic.StoreUint64(&v.lock, locked[i])
+	}
+}
+
+// notify wakes the transactions waiting for v to change.
+func (v *TVar) notify() {
+	v.mu.Lock()
+	for ch := range v.waiters {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	v.mu.Unlock()
+}
+
+// wait blocks until a TVar tx read has changed since tx began.
+func (tx *Tx) wait() {
+	ch := make(chan struct{}, 1)
+	for v := range tx.reads {
+		v.mu.Lock()
+		if v.waiters == nil {
+			v.waiters = make(map[chan struct{}]struct{})
+		}
+		v.waiters[ch] = struct{}{}
+		v.mu.Unlock()
+	}
+	// 先登记再检查版本: 登记之前完成的提交在这里被发现, 之后的提交会唤醒ch
+	changed := false
+	for v := range tx.reads {
+		if atomic.LoadUint64(&v.lock)>>1 > tx.rv {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		<-ch
+	}
+	for v := range tx.reads {
+		v.mu.Lock()
+		delete(v.waiters, ch)
+		v.mu.Unlock()
+	}
+}
@@ -0,0 +1,237 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stm_test
+
+import (
+	"elements/stm"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestAtomically(t *testing.T) {
+	a, b := stm.NewTVar(1), stm.NewTVar("x")
+	err := stm.Atomically(func(tx *stm.Tx) error {
+		tx.Set(a, tx.Get(a).(int)+1)
+		if got := tx.Get(a); got != 2 {
+			t.Errorf("Get after Set = %v, want 2", got)
+		}
+		tx.Set(b, nil)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Load() != 2 || b.Load() != nil {
+		t.Errorf("after commit a = %v, b = %v", a.Load(), b.Load())
+	}
+}
+
+// 返回错误的事务不提交
+func TestAtomicallyError(t *testing.T) {
+	a := stm.NewTVar(1)
+	errStop := errors.New("stop")
+	err := stm.Atomically(func(tx *stm.Tx) error {
+		tx.Set(a, 2)
+		return errStop
+	})
+	if err != errStop {
+		t.Fatalf("Atomically = %v, want %v", err, errStop)
+	}
+	if a.Load() != 1 {
+		t.Errorf("a = %v after a failed transaction", a.Load())
+	}
+}
+
+// 并发的转账: 冲突的事务重新运行, 总额不变, 每次转账都生效
+func TestTransfers(t *testing.T) {
+	const accounts, goroutines, transfers = 8, 8, 500
+	vars := make([]*stm.TVar, accounts)
+	for i := range vars {
+		vars[i] = stm.NewTVar(1000)
+	}
+	total := func(tx *stm.Tx) int {
+		n := 0
+		for _, v := range vars {
+			n += tx.Get(v).(int)
+		}
+		return n
+	}
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		// 只读的事务总是看到同一个时间点的所有账户
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			stm.Atomically(func(tx *stm.Tx) error {
+				if n := total(tx); n != accounts*1000 {
+					t.Errorf("total = %d during transfers", n)
+				}
+				return nil
+			})
+		}
+	}()
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < transfers; i++ {
+				from, to := vars[(g+i)%accounts], vars[(g+2*i+1)%accounts]
+				if from == to {
+					continue
+				}
+				stm.Atomically(func(tx *stm.Tx) error {
+					tx.Set(from, tx.Get(from).(int)-1)
+					tx.Set(to, tx.Get(to).(int)+1)
+					return nil
+				})
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(stop)
+	<-done
+	n := 0
+	for _, v := range vars {
+		n += v.Load().(int)
+	}
+	if n != accounts*1000 {
+		t.Errorf("total = %d, want %d", n, accounts*1000)
+	}
+}
+
+func TestCounter(t *testing.T) {
+	const goroutines, incs = 8, 1000
+	c := stm.NewTVar(0)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < incs; i++ {
+				stm.Atomically(func(tx *stm.Tx) error {
+					tx.Set(c, tx.Get(c).(int)+1)
+					return nil
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	if n := c.Load(); n != goroutines*incs {
+		t.Errorf("counter = %v, want %d", n, goroutines*incs)
+	}
+}
+
+// Retry阻塞到读过的TVar被改变
+func TestRetry(t *testing.T) {
+	n := stm.NewTVar(0)
+	got := make(chan int)
+	go func() {
+		var v int
+		stm.Atomically(func(tx *stm.Tx) error {
+			v = tx.Get(n).(int)
+			if v == 0 {
+				tx.Retry()
+			}
+			tx.Set(n, v-1)
+			return nil
+		})
+		got <- v
+	}()
+	select {
+	case v := <-got:
+		t.Fatalf("transaction returned %d before n was set", v)
+	case <-time.After(20 * time.Millisecond):
+	}
+	stm.Atomically(func(tx *stm.Tx) error {
+		tx.Set(n, 3)
+		return nil
+	})
+	if v := <-got; v != 3 {
+		t.Errorf("transaction saw %d, want 3", v)
+	}
+	if n.Load() != 2 {
+		t.Errorf("n = %v, want 2", n.Load())
+	}
+}
+
+func TestOrElse(t *testing.T) {
+	a, b := stm.NewTVar(0), stm.NewTVar(5)
+	take := func(v *stm.TVar) func(tx *stm.Tx) error {
+		return func(tx *stm.Tx) error {
+			n := tx.Get(v).(int)
+			tx.Set(v, n) // Retry的分支的写不生效
+			if n == 0 {
+				tx.Retry()
+			}
+			tx.Set(v, n-1)
+			return nil
+		}
+	}
+	if err := stm.Atomically(stm.OrElse(take(a), take(b))); err != nil {
+		t.Fatal(err)
+	}
+	if a.Load() != 0 || b.Load() != 4 {
+		t.Errorf("a = %v, b = %v; want 0, 4", a.Load(), b.Load())
+	}
+
+	// 两个分支都Retry时, 任何一个TVar的改变都唤醒事务
+	b = stm.NewTVar(0)
+	done := make(chan struct{})
+	go func() {
+		stm.Atomically(stm.OrElse(take(a), take(b)))
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	stm.Atomically(func(tx *stm.Tx) error {
+		tx.Set(b, 1)
+		return nil
+	})
+	<-done
+	if a.Load() != 0 || b.Load() != 0 {
+		t.Errorf("a = %v, b = %v; want 0, 0", a.Load(), b.Load())
+	}
+}
+
+func TestRetryWithoutReads(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Retry with no reads did not panic")
+		}
+	}()
+	stm.Atomically(func(tx *stm.Tx) error {
+		tx.Retry()
+		return nil
+	})
+}
+
+// 用户代码的panic原样传出
+func TestPanicPropagates(t *testing.T) {
+	defer func() {
+		if r := recover(); r != "boom" {
+			t.Errorf("recovered %v, want boom", r)
+		}
+	}()
+	stm.Atomically(func(tx *stm.Tx) error { panic("boom") })
+}
+
+func BenchmarkAtomicallyIncrement(b *testing.B) {
+	c := stm.NewTVar(0)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			stm.Atomically(func(tx *stm.Tx) error {
+				tx.Set(c, tx.Get(c).(int)+1)
+				return nil
+			})
+		}
+	})
+}
@@ -0,0 +1,29 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stress_test
+
+import (
+	"elements/stress"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// This example compares a read-mostly and a write-heavy mix on a
+// sync.Map. The numbers depend on the machine, so there is no output to
+// check.
+func ExampleRun() {
+	for _, mix := range [][3]int{{90, 9, 1}, {50, 40, 10}} {
+		r, err := stress.Run(new(sync.Map), stress.Config{
+			Reads: mix[0], Writes: mix[1], Deletes: mix[2],
+			Keys: 1 << 12, Prefill: true, Duration: 100 * time.Millisecond,
+		})
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		fmt.Println(r)
+	}
+}
@@ -0,0 +1,91 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stress
+
+import (
+	"math/bits"
+	"time"
+)
+
+// subBits is the number of bits of a latency kept below its leading one:
+// every power of two is split into 1<<subBits buckets.
+const subBits = 3
+
+// numBuckets covers every non-negative int64.
+const numBuckets = (64 - subBits) << subBits
+
+// A histogram counts latencies in log-linear buckets: exact below
+// 1<<subBits nanoseconds, then 1<<subBits buckets per power of two.
+type histogram struct {
+	counts [numBuckets]int64
+	n      int64
+	max    time.Duration
+}
+
+func bucketOf(d time.Duration) int {
+	v := uint64(d)
+	if d < 0 {
+		v = 0
+	}
+	if v < 1<<subBits {
+		return int(v)
+	}
+	// v = 1mmm... , 保留最高位下面的subBits位
+	shift := uint(bits.Len64(v) - 1 - subBits)
+	return int(shift<<subBits + uint(v>>shift))
+}
+
+// bucketLow returns the smallest latency in bucket i.
+func bucketLow(i int) time.Duration {
+	if i < 2<<subBits {
+		return time.Duration(i)
+	}
+	shift := uint(i>>subBits - 1)
+	return time.Duration(uint64(i-int(shift)<<subBits) << shift)
+}
+
+func (h *histogram) record(d time.Duration) {
+	h.counts[bucketOf(d)]++
+	h.n++
+	if d > h.max {
+		h.max = d
+	}
+}
+
+func (h *histogram) merge(o *histogram) {
+	for i, c := range o.counts {
+		h.counts[i] += c
+	}
+	h.n += o.n
+	if o.max > h.max {
+		h.max = o.max
+	}
+}
+
+// quantile returns the lower bound of the bucket holding the q-quantile.
+func (h *histogram) quantile(q float64) time.Duration {
+	if h.n == 0 {
+		return 0
+	}
+	rank := int64(q*float64(h.n-1)) + 1
+	var seen int64
+	for i, c := range h.counts {
+		seen += c
+		if seen >= rank {
+			return bucketLow(i)
+		}
+	}
+	return h.max
+}
+
+func (h *histogram) stats() OpStats {
+	return OpStats{
+		Count: h.n,
+		P50:   h.quantile(0.50),
+		P90:   h.quantile(0.90),
+		P99:   h.quantile(0.99),
+		Max:   h.max,
+	}
+}
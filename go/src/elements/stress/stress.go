@@ -0,0 +1,271 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package stress runs configurable mixes of loads, stores and deletes
+// against a concurrent map and reports throughput, latency percentiles
+// and allocations.
+//
+// Any type with the methods of Target can be stressed: sync.Map,
+// sync.HybridMap and sync.ShardedMap as they are, other structures
+// through a small adapter.
+//
+//	r, err := stress.Run(new(sync.Map), stress.Config{
+//		Reads: 90, Writes: 9, Deletes: 1,
+//		Keys: 1 << 16, Goroutines: 8, Duration: time.Second,
+//	})
+//	fmt.Println(r)
+package stress
+
+import (
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A Target is a concurrent map under test.
+type Target interface {
+	Load(key interface{}) (value interface{}, ok bool)
+	Store(key, value interface{})
+	Delete(key interface{})
+}
+
+// Config describes a run. The percentages Reads, Writes and Deletes must
+// add up to 100.
+type Config struct {
+	Reads   int // percentage of operations that are Loads
+	Writes  int // percentage of operations that are Stores
+	Deletes int // percentage of operations that are Deletes
+
+	// Keys is the size of the key space. Keys are the ints [0, Keys),
+	// chosen uniformly. Zero means 1024.
+	Keys int
+
+	// Prefill stores every key before the run, so that Loads hit from the
+	// start instead of only once Stores have filled the map.
+	Prefill bool
+
+	// Goroutines is the number of goroutines issuing operations. Zero
+	// means GOMAXPROCS.
+	Goroutines int
+
+	// Duration is how long the run lasts. Zero means one second.
+	Duration time.Duration
+
+	// Seed seeds the choice of operations and keys. Goroutine i uses
+	// Seed+i, so a run is reproducible apart from interleaving.
+	Seed int64
+}
+
+func (c *Config) check() error {
+	if c.Reads < 0 || c.Writes < 0 || c.Deletes < 0 || c.Reads+c.Writes+c.Deletes != 100 {
+		return errors.New("stress: Reads, Writes and Deletes must be percentages adding up to 100")
+	}
+	if c.Keys < 0 || c.Goroutines < 0 || c.Duration < 0 {
+		return errors.New("stress: negative Keys, Goroutines or Duration")
+	}
+	return nil
+}
+
+func (c *Config) keys() int {
+	if c.Keys == 0 {
+		return 1024
+	}
+	return c.Keys
+}
+
+func (c *Config) goroutines() int {
+	if c.Goroutines == 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return c.Goroutines
+}
+
+func (c *Config) duration() time.Duration {
+	if c.Duration == 0 {
+		return time.Second
+	}
+	return c.Duration
+}
+
+// An Op is a kind of operation.
+type Op int
+
+const (
+	OpLoad Op = iota
+	OpStore
+	OpDelete
+	numOps
+)
+
+var opNames = [...]string{
+	OpLoad:   "load",
+	OpStore:  "store",
+	OpDelete: "delete",
+}
+
+func (op Op) String() string {
+	if op >= 0 && op < numOps {
+		return opNames[op]
+	}
+	return fmt.Sprintf("Op(%d)", int(op))
+}
+
+// OpStats describes the latencies of one kind of operation. Percentiles
+// are read from a histogram whose buckets are 1/8 of a power of two
+// wide, so they are within 12.5% of the exact value. All latencies
+// include the cost of reading the clock, some tens of nanoseconds.
+type OpStats struct {
+	Count         int64
+	Hits          int64 // Loads that found the key; 0 for other operations
+	P50, P90, P99 time.Duration
+	Max           time.Duration
+}
+
+// A Report is the result of a run.
+type Report struct {
+	Config  Config // with defaults filled in
+	Ops     int64
+	Elapsed time.Duration
+
+	// Throughput is operations per second over all goroutines.
+	Throughput float64
+
+	// Latency is indexed by Op. All merges every operation.
+	Latency [numOps]OpStats
+	All     OpStats
+
+	// AllocsPerOp and BytesPerOp are the heap allocations of the whole
+	// process during the run divided by Ops, as testing.B reports them.
+	AllocsPerOp float64
+	BytesPerOp  float64
+}
+
+func (r *Report) String() string {
+	var b strings.Builder
+	c := &r.Config
+	fmt.Fprintf(&b, "%d%% load, %d%% store, %d%% delete over %d keys; %d goroutines for %v\n",
+		c.Reads, c.Writes, c.Deletes, c.Keys, c.Goroutines, r.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(&b, "%d ops, %.0f ops/s, %.1f allocs/op, %.1f B/op\n",
+		r.Ops, r.Throughput, r.AllocsPerOp, r.BytesPerOp)
+	fmt.Fprintf(&b, "%-7s %10s %8s %8s %8s %8s\n", "op", "count", "p50", "p90", "p99", "max")
+	row := func(name string, s *OpStats) {
+		max := s.Max
+		if max > time.Microsecond {
+			max = max.Round(time.Microsecond)
+		}
+		fmt.Fprintf(&b, "%-7s %10d %8v %8v %8v %8v\n", name, s.Count, s.P50, s.P90, s.P99, max)
+	}
+	for op := OpLoad; op < numOps; op++ {
+		if r.Latency[op].Count > 0 {
+			row(op.String(), &r.Latency[op])
+		}
+	}
+	row("all", &r.All)
+	return b.String()
+}
+
+// A worker is the state of one goroutine of a run.
+type worker struct {
+	hist [numOps]histogram
+	hits int64
+}
+
+// Run stresses t as cfg describes and returns the report.
+func Run(t Target, cfg Config) (*Report, error) {
+	if err := cfg.check(); err != nil {
+		return nil, err
+	}
+	cfg.Keys = cfg.keys()
+	cfg.Goroutines = cfg.goroutines()
+	cfg.Duration = cfg.duration()
+
+	// key先装箱好, 大于255的int转换成interface{}会分配,
+	// 否则报告的分配中大半是压测自己的
+	keys := make([]interface{}, cfg.Keys)
+	for i := range keys {
+		keys[i] = i
+	}
+	if cfg.Prefill {
+		for _, k := range keys {
+			t.Store(k, k)
+		}
+	}
+
+	workers := make([]worker, cfg.Goroutines)
+	var stop int32
+	var wg sync.WaitGroup
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	for i := range workers {
+		wg.Add(1)
+		go func(w *worker, seed int64) {
+			defer wg.Done()
+			w.run(t, &cfg, keys, seed, &stop)
+		}(&workers[i], cfg.Seed+int64(i))
+	}
+	time.Sleep(cfg.Duration)
+	atomic.StoreInt32(&stop, 1)
+	wg.Wait()
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+
+	r := &Report{Config: cfg, Elapsed: elapsed}
+	var all histogram
+	for op := OpLoad; op < numOps; op++ {
+		var h histogram
+		for i := range workers {
+			h.merge(&workers[i].hist[op])
+		}
+		r.Latency[op] = h.stats()
+		all.merge(&h)
+	}
+	for i := range workers {
+		r.Latency[OpLoad].Hits += workers[i].hits
+	}
+	r.All = all.stats()
+	r.Ops = r.All.Count
+	if r.Ops > 0 {
+		r.Throughput = float64(r.Ops) / elapsed.Seconds()
+		r.AllocsPerOp = float64(after.Mallocs-before.Mallocs) / float64(r.Ops)
+		r.BytesPerOp = float64(after.TotalAlloc-before.TotalAlloc) / float64(r.Ops)
+	}
+	return r, nil
+}
+
+// checkStopEvery is how many operations a worker runs between checks of
+// the stop flag.
+const checkStopEvery = 64
+
+func (w *worker) run(t Target, cfg *Config, keys []interface{}, seed int64, stop *int32) {
+	rng := rand.New(rand.NewSource(seed))
+	for {
+		if atomic.LoadInt32(stop) != 0 {
+			return
+		}
+		for i := 0; i < checkStopEvery; i++ {
+			k := keys[rng.Intn(len(keys))]
+			p := rng.Intn(100)
+			start := time.Now()
+			switch {
+			case p < cfg.Reads:
+				if _, ok := t.Load(k); ok {
+					w.hits++
+				}
+				w.hist[OpLoad].record(time.Since(start))
+			case p < cfg.Reads+cfg.Writes:
+				t.Store(k, k)
+				w.hist[OpStore].record(time.Since(start))
+			default:
+				t.Delete(k)
+				w.hist[OpDelete].record(time.Since(start))
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package stress_test
+
+import (
+	"elements/stress"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// countingTarget is a sync.Map that counts its calls.
+type countingTarget struct {
+	sync.Map
+	loads, stores, deletes int64
+}
+
+func (t *countingTarget) Load(key interface{}) (interface{}, bool) {
+	atomic.AddInt64(&t.loads, 1)
+	return t.Map.Load(key)
+}
+
+func (t *countingTarget) Store(key, value interface{}) {
+	atomic.AddInt64(&t.stores, 1)
+	t.Map.Store(key, value)
+}
+
+func (t *countingTarget) Delete(key interface{}) {
+	atomic.AddInt64(&t.deletes, 1)
+	t.Map.Delete(key)
+}
+
+func TestConfigErrors(t *testing.T) {
+	for _, cfg := range []stress.Config{
+		{Reads: 90, Writes: 9},
+		{Reads: 110, Writes: -10},
+		{Reads: 100, Keys: -1},
+		{Reads: 100, Duration: -time.Second},
+	} {
+		if _, err := stress.Run(new(sync.Map), cfg); err == nil {
+			t.Errorf("Run with %+v succeeded", cfg)
+		}
+	}
+}
+
+func TestMix(t *testing.T) {
+	target := new(countingTarget)
+	r, err := stress.Run(target, stress.Config{
+		Reads: 70, Writes: 20, Deletes: 10,
+		Keys: 100, Goroutines: 3, Duration: 50 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	counts := []int64{target.loads, target.stores, target.deletes}
+	var sum int64
+	for op, want := range counts {
+		if got := r.Latency[op].Count; got != want {
+			t.Errorf("%v count = %d, want %d", stress.Op(op), got, want)
+		}
+		sum += want
+	}
+	if r.Ops != sum || r.All.Count != sum {
+		t.Errorf("Ops = %d, All.Count = %d; want %d", r.Ops, r.All.Count, sum)
+	}
+	for op, pct := range []int{70, 20, 10} {
+		got := float64(counts[op]) / float64(sum) * 100
+		if got < float64(pct)-3 || got > float64(pct)+3 {
+			t.Errorf("%v: %.1f%% of operations, want about %d%%", stress.Op(op), got, pct)
+		}
+	}
+	if r.Config.Goroutines != 3 || r.Config.Keys != 100 {
+		t.Errorf("Config in report = %+v", r.Config)
+	}
+	if r.Throughput <= 0 {
+		t.Errorf("Throughput = %v", r.Throughput)
+	}
+}
+
+func TestPrefillHits(t *testing.T) {
+	r, err := stress.Run(new(sync.Map), stress.Config{
+		Reads: 100, Keys: 10, Prefill: true, Goroutines: 2, Duration: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l := r.Latency[stress.OpLoad]; l.Hits != l.Count || l.Count == 0 {
+		t.Errorf("prefilled loads: %d hits of %d", l.Hits, l.Count)
+	}
+}
+
+// slowTarget spins for d in every Store.
+type slowTarget struct {
+	sync.Map
+	d time.Duration
+}
+
+func (t *slowTarget) Store(key, value interface{}) {
+	for start := time.Now(); time.Since(start) < t.d; {
+	}
+}
+
+func TestLatency(t *testing.T) {
+	const d = 100 * time.Microsecond
+	r, err := stress.Run(&slowTarget{d: d}, stress.Config{
+		Writes: 100, Goroutines: 1, Duration: 30 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := r.Latency[stress.OpStore]
+	// 直方图的下界最多比真实值小1/8
+	if s.P50 < d*7/8 || s.P50 > 2*d {
+		t.Errorf("P50 = %v, want about %v", s.P50, d)
+	}
+	if !(s.P50 <= s.P90 && s.P90 <= s.P99 && s.P99 <= s.Max) {
+		t.Errorf("percentiles out of order: %+v", s)
+	}
+}
+
+// allocTarget allocates once per Store.
+type allocTarget struct {
+	sync.Map
+	sink atomic.Value
+}
+
+func (t *allocTarget) Store(key, value interface{}) {
+	t.sink.Store(new([64]byte))
+}
+
+func TestAllocs(t *testing.T) {
+	r, err := stress.Run(new(allocTarget), stress.Config{
+		Writes: 100, Goroutines: 1, Duration: 10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.AllocsPerOp < 0.9 || r.AllocsPerOp > 1.5 {
+		t.Errorf("AllocsPerOp = %v, want about 1", r.AllocsPerOp)
+	}
+	if r.BytesPerOp < 60 || r.BytesPerOp > 100 {
+		t.Errorf("BytesPerOp = %v, want about 64", r.BytesPerOp)
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package supervisor_test
+
+import (
+	"context"
+	"elements/supervisor"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func Example() {
+	failures := 0
+	s := supervisor.New(supervisor.Config{
+		OnRestart: func(name string, err error, wait time.Duration) {
+			fmt.Printf("restarting %s after %v: %v\n", name, wait, err)
+		},
+	})
+	done := make(chan struct{})
+	s.Add(supervisor.Spec{
+		Name:       "poller",
+		MinBackoff: time.Millisecond,
+		Run: func(ctx context.Context) error {
+			if failures < 2 {
+				failures++
+				return errors.New("connection refused")
+			}
+			close(done)
+			<-ctx.Done()
+			return nil
+		},
+	})
+	<-done
+	h := s.Health()[0]
+	fmt.Println(h.Name, h.State, h.Restarts)
+	s.Stop()
+	fmt.Println(s.Health()[0].State)
+	// Output:
+	// restarting poller after 1ms: connection refused
+	// restarting poller after 2ms: connection refused
+	// poller running 2
+	// stopped
+}
@@ -0,0 +1,324 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package supervisor runs long-lived goroutines and restarts them when
+// they fail, with exponential backoff, and reports their health.
+//
+//	s := supervisor.New(supervisor.Config{})
+//	s.Add(supervisor.Spec{
+//		Name: "consumer",
+//		Run:  consumer.Run, // func(ctx context.Context) error
+//	})
+//	...
+//	s.Stop()
+//
+// It replaces the loop each service writes around its background
+// goroutines, which usually forgets one of: recovering a panic, waiting
+// between restarts, giving up, or telling anyone it did.
+package supervisor
+
+import (
+	"context"
+	"elements/lifecycle"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A Policy decides when a goroutine is restarted.
+type Policy int
+
+const (
+	// OnFailure restarts a goroutine whose Run returned an error or
+	// panicked. A Run that returns nil is done.
+	OnFailure Policy = iota
+
+	// Always restarts a goroutine whenever its Run returns.
+	Always
+
+	// Never runs a goroutine once.
+	Never
+)
+
+// A State is the state of a supervised goroutine.
+type State int
+
+const (
+	Running State = iota // Run is running
+	Backoff              // waiting to restart Run
+	Exited               // Run returned and is not restarted
+	Failed               // Run failed and is not restarted
+	Stopped              // the Supervisor has stopped
+)
+
+var stateNames = [...]string{"running", "backoff", "exited", "failed", "stopped"}
+
+func (s State) String() string {
+	if s < 0 || int(s) >= len(stateNames) {
+		return "State(" + fmt.Sprint(int(s)) + ")"
+	}
+	return stateNames[s]
+}
+
+// ErrExists is returned by Add for a name that is taken.
+var ErrExists = errors.New("supervisor: name already added")
+
+// ErrStopped is returned by Add once the Supervisor has stopped.
+var ErrStopped = errors.New("supervisor: stopped")
+
+// A PanicError is the error of a Run that panicked.
+type PanicError struct {
+	Value interface{} // the value passed to panic
+	Stack []byte      // the stack of the goroutine at the panic
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("supervisor: panic: %v\n\n%s", p.Value, p.Stack)
+}
+
+// A Spec describes a supervised goroutine.
+type Spec struct {
+	// Name identifies the goroutine in Health. It must be unique within a
+	// Supervisor.
+	Name string
+
+	// Run is the body of the goroutine. It should return when ctx is
+	// done, which happens when the Supervisor stops.
+	Run func(ctx context.Context) error
+
+	Policy Policy
+
+	// MinBackoff is the wait before the first restart, doubled after each
+	// restart up to MaxBackoff. Zero means 100 milliseconds and 30
+	// seconds.
+	MinBackoff, MaxBackoff time.Duration
+
+	// MaxRestarts is how many restarts in a row, without a run lasting
+	// StableAfter, the goroutine gets before it is left Failed. Zero means
+	// no limit.
+	MaxRestarts int
+
+	// StableAfter is how long a run must last for the goroutine to count
+	// as healthy again: the next restart waits MinBackoff, and is the
+	// first in a row. Zero means MaxBackoff.
+	StableAfter time.Duration
+}
+
+// Health is a report on a supervised goroutine.
+type Health struct {
+	Name      string
+	State     State
+	Restarts  int       // total restarts
+	LastError error     // the error of the last failed run, or nil
+	Since     time.Time // when the goroutine entered State
+}
+
+// Config configures a Supervisor.
+type Config struct {
+	// OnRestart, if not nil, is called before the wait to restart the
+	// goroutine name, with the reason, which is nil after a run that
+	// returned nil under Always, and the wait. Health reports Backoff once
+	// it returns.
+	OnRestart func(name string, err error, wait time.Duration)
+
+	// OnFailed, if not nil, is called when the goroutine name fails and is
+	// not restarted.
+	OnFailed func(name string, err error)
+}
+
+// A Supervisor runs supervised goroutines. It is safe for concurrent use.
+type Supervisor struct {
+	cfg    Config
+	ctx    context.Context
+	cancel func()
+	wg     sync.WaitGroup
+
+	mu       sync.Mutex
+	children map[string]*child
+	stopped  bool
+}
+
+// A child is a supervised goroutine. Its fields after spec are guarded by
+// the mutex of the Supervisor.
+type child struct {
+	spec Spec
+
+	state    State
+	restarts int
+	lastErr  error
+	since    time.Time
+}
+
+// New returns a Supervisor with no goroutines, registered in
+// lifecycle.Default.
+func New(cfg Config) *Supervisor {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Supervisor{cfg: cfg, ctx: ctx, cancel: cancel, children: make(map[string]*child)}
+	lifecycle.Register(s, "supervisor.Supervisor", func(context.Context) error {
+		s.Stop()
+		return nil
+	})
+	return s
+}
+
+// Add starts the goroutine described by spec.
+func (s *Supervisor) Add(spec Spec) error {
+	if spec.Run == nil {
+		panic("supervisor: Add with nil Run")
+	}
+	if spec.MinBackoff <= 0 {
+		spec.MinBackoff = 100 * time.Millisecond
+	}
+	if spec.MaxBackoff <= 0 {
+		spec.MaxBackoff = 30 * time.Second
+	}
+	if spec.MaxBackoff < spec.MinBackoff {
+		spec.MaxBackoff = spec.MinBackoff
+	}
+	if spec.StableAfter <= 0 {
+		spec.StableAfter = spec.MaxBackoff
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopped {
+		return ErrStopped
+	}
+	if _, ok := s.children[spec.Name]; ok {
+		return ErrExists
+	}
+	c := &child{spec: spec, state: Running, since: time.Now()}
+	s.children[spec.Name] = c
+	s.wg.Add(1)
+	go s.supervise(c)
+	return nil
+}
+
+// Stop cancels the context of every Run, and waits for them to return.
+// Goroutines waiting to restart are not restarted.
+func (s *Supervisor) Stop() {
+	s.mu.Lock()
+	s.stopped = true
+	s.mu.Unlock()
+	lifecycle.Unregister(s)
+	s.cancel()
+	s.wg.Wait()
+}
+
+// Health returns a report on each goroutine, sorted by name.
+func (s *Supervisor) Health() []Health {
+	s.mu.Lock()
+	h := make([]Health, 0, len(s.children))
+	for _, c := range s.children {
+		h = append(h, Health{Name: c.spec.Name, State: c.state, Restarts: c.restarts, LastError: c.lastErr, Since: c.since})
+	}
+	s.mu.Unlock()
+	sort.Slice(h, func(i, j int) bool { return h[i].Name < h[j].Name })
+	return h
+}
+
+// Healthy reports whether every goroutine is Running or Exited: none is
+// waiting to restart or has failed.
+func (s *Supervisor) Healthy() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, c := range s.children {
+		if c.state != Running && c.state != Exited {
+			return false
+		}
+	}
+	return true
+}
+
+// supervise runs c until its policy says it is done, or the Supervisor
+// stops.
+func (s *Supervisor) supervise(c *child) {
+	defer s.wg.Done()
+	var (
+		wait  = c.spec.MinBackoff
+		inRow = 0 // 连续重启的次数
+		timer *time.Timer
+	)
+	for {
+		start := time.Now()
+		err := run(s.ctx, c.spec.Run)
+		if s.ctx.Err() != nil {
+			// 停止时Run因为ctx返回的错误不算失败
+			s.set(c, Stopped, nil, false)
+			return
+		}
+		failed := err != nil
+		if c.spec.Policy == Never || !failed && c.spec.Policy == OnFailure {
+			if failed {
+				s.fail(c, err)
+			} else {
+				s.set(c, Exited, nil, false)
+			}
+			return
+		}
+		if time.Since(start) >= c.spec.StableAfter {
+			wait, inRow = c.spec.MinBackoff, 0
+		}
+		if c.spec.MaxRestarts > 0 && inRow >= c.spec.MaxRestarts {
+			s.fail(c, err)
+			return
+		}
+		inRow++
+		if s.cfg.OnRestart != nil {
+			s.cfg.OnRestart(c.spec.Name, err, wait)
+		}
+		s.set(c, Backoff, err, true)
+		if timer == nil {
+			timer = time.NewTimer(wait)
+			defer timer.Stop()
+		} else {
+			timer.Reset(wait)
+		}
+		select {
+		case <-s.ctx.Done():
+			s.set(c, Stopped, nil, false)
+			return
+		case <-timer.C:
+		}
+		if wait *= 2; wait > c.spec.MaxBackoff {
+			wait = c.spec.MaxBackoff
+		}
+		s.set(c, Running, nil, false)
+	}
+}
+
+// set moves c to state, recording err if it is not nil, and counting a
+// restart if restart is set.
+func (s *Supervisor) set(c *child, state State, err error, restart bool) {
+	s.mu.Lock()
+	c.state, c.since = state, time.Now()
+	if err != nil {
+		c.lastErr = err
+	}
+	if restart {
+		c.restarts++
+	}
+	s.mu.Unlock()
+}
+
+// fail leaves c Failed. The hook runs first, so that it happens before
+// Health reports the failure.
+func (s *Supervisor) fail(c *child, err error) {
+	if s.cfg.OnFailed != nil {
+		s.cfg.OnFailed(c.spec.Name, err)
+	}
+	s.set(c, Failed, err, false)
+}
+
+// run calls f, turning a panic into a *PanicError.
+func run(ctx context.Context, f func(context.Context) error) (err error) {
+	defer func() {
+		if v := recover(); v != nil {
+			err = &PanicError{Value: v, Stack: debug.Stack()}
+		}
+	}()
+	return f(ctx)
+}
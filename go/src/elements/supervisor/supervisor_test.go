@@ -0,0 +1,180 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package supervisor_test
+
+import (
+	"context"
+	"elements/supervisor"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var errBoom = errors.New("boom")
+
+// waitState waits for the goroutine name of s to be in state.
+func waitState(t *testing.T, s *supervisor.Supervisor, name string, state supervisor.State) supervisor.Health {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		for _, h := range s.Health() {
+			if h.Name == name && h.State == state {
+				return h
+			}
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s never %v: %+v", name, state, s.Health())
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOnFailure(t *testing.T) {
+	s := supervisor.New(supervisor.Config{})
+	defer s.Stop()
+	var runs int32
+	s.Add(supervisor.Spec{
+		Name:       "flaky",
+		MinBackoff: time.Millisecond,
+		Run: func(ctx context.Context) error {
+			if atomic.AddInt32(&runs, 1) < 3 {
+				return errBoom
+			}
+			return nil
+		},
+	})
+	h := waitState(t, s, "flaky", supervisor.Exited)
+	if h.Restarts != 2 || h.LastError != errBoom || atomic.LoadInt32(&runs) != 3 {
+		t.Fatalf("Health = %+v after %d runs; want 2 restarts of %v", h, runs, errBoom)
+	}
+	if !s.Healthy() {
+		t.Fatal("Healthy = false with every goroutine Exited")
+	}
+}
+
+func TestPanic(t *testing.T) {
+	s := supervisor.New(supervisor.Config{})
+	defer s.Stop()
+	s.Add(supervisor.Spec{
+		Name:   "panics",
+		Policy: supervisor.Never,
+		Run:    func(ctx context.Context) error { panic("oops") },
+	})
+	h := waitState(t, s, "panics", supervisor.Failed)
+	if pe, ok := h.LastError.(*supervisor.PanicError); !ok || pe.Value != "oops" || len(pe.Stack) == 0 {
+		t.Fatalf("LastError = %v; want a *PanicError of oops", h.LastError)
+	}
+	if s.Healthy() {
+		t.Fatal("Healthy = true with a goroutine Failed")
+	}
+}
+
+func TestMaxRestarts(t *testing.T) {
+	var failed error
+	var waits []time.Duration
+	s := supervisor.New(supervisor.Config{
+		OnRestart: func(name string, err error, wait time.Duration) { waits = append(waits, wait) },
+		OnFailed:  func(name string, err error) { failed = err },
+	})
+	defer s.Stop()
+	s.Add(supervisor.Spec{
+		Name:        "broken",
+		Policy:      supervisor.Always,
+		MinBackoff:  time.Millisecond,
+		MaxBackoff:  4 * time.Millisecond,
+		StableAfter: time.Hour,
+		MaxRestarts: 4,
+		Run:         func(ctx context.Context) error { return errBoom },
+	})
+	h := waitState(t, s, "broken", supervisor.Failed)
+	if h.Restarts != 4 || failed != errBoom {
+		t.Fatalf("Health = %+v, OnFailed got %v; want 4 restarts and %v", h, failed, errBoom)
+	}
+	want := []time.Duration{1, 2, 4, 4}
+	for i := range want {
+		want[i] *= time.Millisecond
+	}
+	if len(waits) != len(want) {
+		t.Fatalf("waits = %v; want %v", waits, want)
+	}
+	for i := range want {
+		if waits[i] != want[i] {
+			t.Fatalf("waits = %v; want %v", waits, want)
+		}
+	}
+}
+
+// TestStable checks that a run lasting StableAfter resets the backoff and
+// the count of restarts in a row.
+func TestStable(t *testing.T) {
+	var runs int32
+	var waits []time.Duration
+	s := supervisor.New(supervisor.Config{
+		OnRestart: func(name string, err error, wait time.Duration) { waits = append(waits, wait) },
+	})
+	defer s.Stop()
+	s.Add(supervisor.Spec{
+		Name:        "recovers",
+		MinBackoff:  time.Millisecond,
+		MaxRestarts: 2,
+		StableAfter: 20 * time.Millisecond,
+		Run: func(ctx context.Context) error {
+			if atomic.AddInt32(&runs, 1) == 3 {
+				time.Sleep(20 * time.Millisecond)
+			}
+			return errBoom
+		},
+	})
+	h := waitState(t, s, "recovers", supervisor.Failed)
+	// 第三次运行之后计数清零, 所以一共重启4次
+	if h.Restarts != 4 || len(waits) != 4 || waits[2] != time.Millisecond {
+		t.Fatalf("Health = %+v, waits = %v; want 4 restarts, the third after 1ms", h, waits)
+	}
+}
+
+func TestStop(t *testing.T) {
+	s := supervisor.New(supervisor.Config{})
+	started := make(chan struct{})
+	s.Add(supervisor.Spec{
+		Name: "server",
+		Run: func(ctx context.Context) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		},
+	})
+	s.Add(supervisor.Spec{
+		Name:       "waiting",
+		MinBackoff: time.Hour,
+		Run:        func(ctx context.Context) error { return errBoom },
+	})
+	<-started
+	waitState(t, s, "waiting", supervisor.Backoff)
+	if s.Healthy() {
+		t.Fatal("Healthy = true with a goroutine in Backoff")
+	}
+	s.Stop()
+	for _, h := range s.Health() {
+		if h.State != supervisor.Stopped {
+			t.Fatalf("after Stop, %s is %v", h.Name, h.State)
+		}
+	}
+	if err := s.Add(supervisor.Spec{Name: "late", Run: func(context.Context) error { return nil }}); err != supervisor.ErrStopped {
+		t.Fatalf("Add after Stop = %v; want %v", err, supervisor.ErrStopped)
+	}
+}
+
+func TestExists(t *testing.T) {
+	s := supervisor.New(supervisor.Config{})
+	defer s.Stop()
+	run := func(ctx context.Context) error { <-ctx.Done(); return nil }
+	if err := s.Add(supervisor.Spec{Name: "a", Run: run}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Add(supervisor.Spec{Name: "a", Run: run}); err != supervisor.ErrExists {
+		t.Fatalf("second Add = %v; want %v", err, supervisor.ErrExists)
+	}
+}
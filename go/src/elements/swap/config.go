@@ -0,0 +1,126 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package swap
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+)
+
+// ErrVersionConflict is returned by ConfigStore.Publish when the version
+// it was given is no longer the current one.
+var ErrVersionConflict = errors.New("swap: config has changed since the base version")
+
+// A ConfigStore holds a configuration that is published as a whole, in
+// numbered versions. A writer publishes a new configuration on the basis
+// of the version it read, and the publish fails if another writer got in
+// first, so that two writers editing the same configuration cannot lose
+// each other's changes. Readers load the current version with no lock,
+// and wait for the next one on a channel.
+//
+// The zero value holds a nil configuration at version 0 and is ready to
+// use. A ConfigStore must not be copied after first use.
+type ConfigStore struct {
+	v atomic.Value // *config
+
+	mu   sync.Mutex // serializes Publish
+	init bool       // v has been stored; written with mu held
+}
+
+type config struct {
+	value   interface{}
+	version uint64
+	next    chan struct{} // closed when the next version is published
+}
+
+// A Config is one version of the configuration of a ConfigStore. It never
+// changes.
+type Config struct {
+	c *config
+}
+
+// Value returns the configuration. It is shared by every reader of the
+// version, and must not be modified.
+func (c Config) Value() interface{} { return c.c.value }
+
+// Version returns the version of the configuration: 0 for the initial
+// nil configuration, and one more for each successful Publish.
+func (c Config) Version() uint64 { return c.c.version }
+
+// Changed returns a channel that is closed when a newer version is
+// published. A reader keeps up with the store with
+//
+//	for {
+//		cfg := store.Load()
+//		apply(cfg.Value())
+//		<-cfg.Changed()
+//	}
+//
+// and never misses a change, though it may skip versions published
+// while it was applying an earlier one.
+func (c Config) Changed() <-chan struct{} { return c.c.next }
+
+// Load returns the current configuration.
+func (s *ConfigStore) Load() Config {
+	if c, ok := s.v.Load().(*config); ok {
+		return Config{c}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return Config{s.currentLocked()}
+}
+
+// currentLocked returns the current version, storing the initial one if
+// there is none yet. s.mu must be held.
+func (s *ConfigStore) currentLocked() *config {
+	if !s.init {
+		// 零值的store第一次被使用: 版本0需要自己的channel, 不能在Load中无锁地创建
+		s.v.Store(&config{next: make(chan struct{})})
+		s.init = true
+	}
+	return s.v.Load().(*config)
+}
+
+// Publish makes v the configuration, if the current version is still
+// base, and returns the new version. Otherwise it publishes nothing and
+// returns the current version and ErrVersionConflict: the caller should
+// apply its change again to that version, or give up.
+//
+// The store takes ownership of v, which must not be modified afterwards.
+func (s *ConfigStore) Publish(base uint64, v interface{}) (Config, error) {
+	s.mu.Lock()
+	old := s.currentLocked()
+	if old.version != base {
+		s.mu.Unlock()
+		return Config{old}, ErrVersionConflict
+	}
+	c := &config{value: v, version: base + 1, next: make(chan struct{})}
+	s.v.Store(c)
+	s.mu.Unlock()
+	// 先发布新版本再通知: 被唤醒的读者Load到的至少是这个版本
+	close(old.next)
+	return Config{c}, nil
+}
+
+// Update publishes the configuration returned by f, which is passed the
+// current one, and retries with the newer version if another writer
+// publishes first. f may be called more than once, and must not modify
+// the configuration it is passed. If f returns an error, nothing is
+// published and Update returns it.
+func (s *ConfigStore) Update(f func(old interface{}) (interface{}, error)) (Config, error) {
+	cur := s.Load()
+	for {
+		v, err := f(cur.Value())
+		if err != nil {
+			return cur, err
+		}
+		c, err := s.Publish(cur.Version(), v)
+		if err != ErrVersionConflict {
+			return c, err
+		}
+		cur = c
+	}
+}
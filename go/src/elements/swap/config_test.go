@@ -0,0 +1,106 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package swap_test
+
+import (
+	"elements/swap"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConfigStore(t *testing.T) {
+	var s swap.ConfigStore
+	c0 := s.Load()
+	if c0.Version() != 0 || c0.Value() != nil {
+		t.Fatalf("zero store: version %d, value %v", c0.Version(), c0.Value())
+	}
+	c1, err := s.Publish(0, "a")
+	if err != nil || c1.Version() != 1 || c1.Value() != "a" {
+		t.Fatalf("Publish(0) = %d %v, %v", c1.Version(), c1.Value(), err)
+	}
+	select {
+	case <-c0.Changed():
+	default:
+		t.Error("Changed of version 0 not closed by Publish")
+	}
+	select {
+	case <-c1.Changed():
+		t.Error("Changed of the current version is closed")
+	default:
+	}
+
+	// 基于旧版本的发布失败, 返回当前版本
+	cur, err := s.Publish(0, "b")
+	if err != swap.ErrVersionConflict || cur.Version() != 1 || cur.Value() != "a" {
+		t.Errorf("stale Publish = %d %v, %v", cur.Version(), cur.Value(), err)
+	}
+	if v := s.Load().Value(); v != "a" {
+		t.Errorf("Load after a conflict = %v", v)
+	}
+	if c0.Value() != nil {
+		t.Error("an old Config changed")
+	}
+}
+
+// 并发的Update不会丢失彼此的修改
+func TestConfigStoreUpdate(t *testing.T) {
+	const goroutines, updates = 8, 200
+	var s swap.ConfigStore
+	s.Publish(0, 0)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < updates; i++ {
+				s.Update(func(old interface{}) (interface{}, error) {
+					return old.(int) + 1, nil
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	c := s.Load()
+	if c.Value() != goroutines*updates || c.Version() != goroutines*updates+1 {
+		t.Errorf("after Updates: value %v, version %d", c.Value(), c.Version())
+	}
+
+	errStop := errors.New("stop")
+	got, err := s.Update(func(old interface{}) (interface{}, error) { return nil, errStop })
+	if err != errStop || got.Version() != c.Version() || s.Load().Version() != c.Version() {
+		t.Errorf("failed Update = %d, %v; published version %d", got.Version(), err, s.Load().Version())
+	}
+}
+
+// 等待Changed的读者看到最后一个版本
+func TestConfigStoreWatch(t *testing.T) {
+	var s swap.ConfigStore
+	done := make(chan int)
+	go func() {
+		for {
+			c := s.Load()
+			if c.Value() == 100 {
+				done <- int(c.Version())
+				return
+			}
+			<-c.Changed()
+		}
+	}()
+	for i := 1; i <= 100; i++ {
+		if _, err := s.Publish(uint64(i-1), i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case v := <-done:
+		if v != 100 {
+			t.Errorf("watcher saw version %d, want 100", v)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("watcher missed the last version")
+	}
+}
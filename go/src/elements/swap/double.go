@@ -0,0 +1,115 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package swap
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A DoubleBuffer holds two values, an active one that readers use and a
+// standby one that a writer rebuilds, and switches them. Unlike a
+// SnapshotStore, whose old versions are left to the garbage collector, a
+// DoubleBuffer hands the old active value back to the writer once no
+// reader uses it, so that expensive structures can be rebuilt in place
+// rather than allocated anew for every version.
+//
+// Readers count themselves in on the side they read. Swap makes the
+// standby value active and then waits until the count of the old side
+// drains to zero, after which readers never observe it again and the
+// writer may modify it freely.
+type DoubleBuffer struct {
+	mu   sync.Mutex // serializes writers
+	bufs [2]interface{}
+
+	active  uint32   // index into bufs; written with mu held
+	readers [2]int64 // readers in each side
+}
+
+// NewDoubleBuffer returns a DoubleBuffer with the given active and
+// standby values.
+func NewDoubleBuffer(active, standby interface{}) *DoubleBuffer {
+	return &DoubleBuffer{bufs: [2]interface{}{active, standby}}
+}
+
+// A Lease is a reader's hold on the active value of a DoubleBuffer. Value
+// does not change, and is not modified by writers, until Release.
+type Lease struct {
+	Value interface{}
+
+	d    *DoubleBuffer
+	side uint32
+}
+
+// Acquire returns a Lease on the active value. The caller must Release
+// it, and should do so promptly: every Swap waits for the leases of the
+// value it swaps out.
+func (d *DoubleBuffer) Acquire() Lease {
+	for {
+		i := atomic.LoadUint32(&d.active)
+		atomic.AddInt64(&d.readers[i], 1)
+		// 计数之前Swap可能已经换了一边, 并且认为这一边已经没有读者了.
+		// 重新检查, 还是i才能读; 否则撤销计数, 换到新的一边
+		if atomic.LoadUint32(&d.active) == i {
+			return Lease{Value: d.bufs[i], d: d, side: i}
+		}
+		atomic.AddInt64(&d.readers[i], -1)
+	}
+}
+
+// Release ends the lease.
+func (l Lease) Release() {
+	atomic.AddInt64(&l.d.readers[l.side], -1)
+}
+
+// Read calls f with the active value, holding a lease while f runs.
+func (d *DoubleBuffer) Read(f func(v interface{})) {
+	l := d.Acquire()
+	defer l.Release()
+	f(l.Value)
+}
+
+// Prepare replaces the standby value with f(standby). No reader sees the
+// standby value, so f may modify it in place.
+func (d *DoubleBuffer) Prepare(f func(standby interface{}) interface{}) {
+	d.mu.Lock()
+	i := 1 - atomic.LoadUint32(&d.active)
+	d.bufs[i] = f(d.bufs[i])
+	d.mu.Unlock()
+}
+
+// Swap makes the standby value active, and waits until every lease on
+// the formerly active value is released. When Swap returns, that value is
+// the standby one.
+func (d *DoubleBuffer) Swap() {
+	d.mu.Lock()
+	d.swapLocked()
+	d.mu.Unlock()
+}
+
+// Update prepares the standby value with f and swaps it in, as one step:
+// no other writer runs in between.
+func (d *DoubleBuffer) Update(f func(standby interface{}) interface{}) {
+	d.mu.Lock()
+	i := 1 - atomic.LoadUint32(&d.active)
+	d.bufs[i] = f(d.bufs[i])
+	d.swapLocked()
+	d.mu.Unlock()
+}
+
+func (d *DoubleBuffer) swapLocked() {
+	old := atomic.LoadUint32(&d.active)
+	atomic.StoreUint32(&d.active, 1-old)
+	// 读者持有租约的时间通常很短, 先让出几次, 再逐渐加长睡眠
+	for spin := 0; atomic.LoadInt64(&d.readers[old]) != 0; spin++ {
+		if spin < 10 {
+			runtime.Gosched()
+		} else {
+			time.Sleep(time.Duration(spin-9) * 10 * time.Microsecond)
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package swap_test
+
+import (
+	"elements/swap"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDoubleBuffer(t *testing.T) {
+	d := swap.NewDoubleBuffer("a", "b")
+	d.Read(func(v interface{}) {
+		if v != "a" {
+			t.Errorf("active = %v, want a", v)
+		}
+	})
+	d.Prepare(func(standby interface{}) interface{} {
+		if standby != "b" {
+			t.Errorf("standby = %v, want b", standby)
+		}
+		return "c"
+	})
+	d.Swap()
+	if l := d.Acquire(); l.Value != "c" {
+		t.Errorf("active after Swap = %v, want c", l.Value)
+	} else {
+		l.Release()
+	}
+	d.Update(func(standby interface{}) interface{} {
+		if standby != "a" {
+			t.Errorf("standby after Swap = %v, want a", standby)
+		}
+		return "d"
+	})
+	d.Read(func(v interface{}) {
+		if v != "d" {
+			t.Errorf("active after Update = %v, want d", v)
+		}
+	})
+}
+
+// Swap要等换下来的一边的租约全部释放
+func TestDoubleBufferSwapWaitsForReaders(t *testing.T) {
+	d := swap.NewDoubleBuffer(1, 2)
+	l := d.Acquire()
+	var swapped int32
+	go func() {
+		d.Swap()
+		atomic.StoreInt32(&swapped, 1)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	if atomic.LoadInt32(&swapped) != 0 {
+		t.Fatal("Swap returned while a lease on the old value was held")
+	}
+	// 新的读者已经读到新的一边, 不会被Swap挡住
+	if l2 := d.Acquire(); l2.Value != 2 {
+		t.Errorf("new reader got %v, want 2", l2.Value)
+	} else {
+		l2.Release()
+	}
+	l.Release()
+	for atomic.LoadInt32(&swapped) == 0 {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+type buffer struct {
+	gen  int
+	data [16]int
+}
+
+// 写者在standby中原地重建, 读者永远看不到写了一半的状态
+func TestDoubleBufferNoPartialState(t *testing.T) {
+	d := swap.NewDoubleBuffer(new(buffer), new(buffer))
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				d.Read(func(v interface{}) {
+					b := v.(*buffer)
+					for _, x := range b.data {
+						if x != b.gen {
+							t.Errorf("read %d in generation %d", x, b.gen)
+							return
+						}
+					}
+				})
+			}
+		}()
+	}
+	for gen := 1; gen <= 500; gen++ {
+		d.Update(func(standby interface{}) interface{} {
+			b := standby.(*buffer)
+			b.gen = gen
+			for i := range b.data {
+				b.data[i] = gen
+			}
+			return b
+		})
+	}
+	close(done)
+	wg.Wait()
+}
@@ -0,0 +1,67 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package swap_test
+
+import (
+	"elements/swap"
+	"fmt"
+)
+
+func ExampleSnapshotStore() {
+	var routes swap.SnapshotStore
+	routes.Replace(map[string]interface{}{"/api": "10.0.0.1", "/static": "10.0.0.2"})
+
+	snap := routes.Snapshot()
+	// 从配置中心重新加载了一次, 整个替换
+	routes.Replace(map[string]interface{}{"/api": "10.0.0.3"})
+
+	v, _ := routes.Get("/api")
+	fmt.Println("now:", v)
+	v, _ = snap.Get("/api")
+	fmt.Println("snapshot:", v, snap.Len(), "routes, version", snap.Version())
+	// Output:
+	// now: 10.0.0.3
+	// snapshot: 10.0.0.1 2 routes, version 1
+}
+
+func ExampleDoubleBuffer() {
+	index := swap.NewDoubleBuffer(map[string]int{"go": 1}, map[string]int{})
+
+	// 在standby中原地重建索引, 不用为每个版本分配一个新的map
+	index.Update(func(standby interface{}) interface{} {
+		m := standby.(map[string]int)
+		for k := range m {
+			delete(m, k)
+		}
+		m["go"] = 2
+		m["rust"] = 1
+		return m
+	})
+
+	index.Read(func(v interface{}) {
+		m := v.(map[string]int)
+		fmt.Println(m["go"], m["rust"], len(m))
+	})
+	// Output: 2 1 2
+}
+
+func ExampleConfigStore() {
+	var store swap.ConfigStore
+	store.Publish(0, map[string]int{"timeout": 5})
+
+	// 两个管理员同时基于版本1修改配置, 后提交的那个失败
+	base := store.Load()
+	if _, err := store.Publish(base.Version(), map[string]int{"timeout": 10}); err != nil {
+		fmt.Println(err)
+	}
+	if _, err := store.Publish(base.Version(), map[string]int{"timeout": 3}); err != nil {
+		fmt.Println(err)
+	}
+	cfg := store.Load()
+	fmt.Println(cfg.Value(), "version", cfg.Version())
+	// Output:
+	// swap: config has changed since the base version
+	// map[timeout:10] version 2
+}
@@ -0,0 +1,110 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package swap provides values that are replaced as a whole rather than
+// modified in place: readers load the current version with one atomic
+// operation and keep a consistent view of it for as long as they like,
+// while writers build the next version off to the side and publish it
+// when it is complete.
+package swap
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A SnapshotStore holds an immutable map that is replaced as a whole. It
+// suits data rebuilt periodically from a source of truth, such as
+// configuration or routing tables: Get is an atomic load and a map lookup,
+// with none of the per-key bookkeeping of a sync.Map.
+//
+// The zero value is an empty store ready to use. A SnapshotStore must not
+// be copied after first use.
+type SnapshotStore struct {
+	p unsafe.Pointer // *snapshot; nil means emptySnapshot
+}
+
+type snapshot struct {
+	m       map[string]interface{}
+	version uint64
+}
+
+// A Snapshot is one version of a SnapshotStore's map. It never changes.
+type Snapshot struct {
+	s *snapshot
+}
+
+// Replace publishes m as the store's map. The store takes ownership of m,
+// which must not be modified afterwards by anyone: readers use it without
+// locking. Snapshots taken earlier keep the map they had.
+//
+// Replace returns the version of the new map, one more than the version
+// it replaced; the empty map of a new store is version 0. Concurrent
+// Replaces are serialized by a compare-and-swap, so versions are never
+// skipped or repeated.
+func (s *SnapshotStore) Replace(m map[string]interface{}) uint64 {
+	for {
+		old := atomic.LoadPointer(&s.p)
+		var version uint64
+		if old != nil {
+			version = (*snapshot)(old).version
+		}
+		next := &snapshot{m: m, version: version + 1}
+		if atomic.CompareAndSwapPointer(&s.p, old, unsafe.Pointer(next)) {
+			return next.version
+		}
+	}
+}
+
+// Get returns the value for key in the current map.
+func (s *SnapshotStore) Get(key string) (interface{}, bool) {
+	v, ok := s.load().m[key]
+	return v, ok
+}
+
+// Snapshot returns the current map. Lookups in the Snapshot all see the
+// same version, however many Replaces happen meanwhile.
+func (s *SnapshotStore) Snapshot() Snapshot {
+	return Snapshot{s.load()}
+}
+
+var emptySnapshot = &snapshot{}
+
+func (s *SnapshotStore) load() *snapshot {
+	p := (*snapshot)(atomic.LoadPointer(&s.p))
+	if p == nil {
+		return emptySnapshot
+	}
+	return p
+}
+
+// Get returns the value for key.
+func (s Snapshot) Get(key string) (interface{}, bool) {
+	v, ok := s.snap().m[key]
+	return v, ok
+}
+
+// Len returns the number of keys.
+func (s Snapshot) Len() int { return len(s.snap().m) }
+
+// Version returns the version of the map, as returned by the Replace
+// that published it.
+func (s Snapshot) Version() uint64 { return s.snap().version }
+
+// Range calls f for each key and value, in unspecified order, until f
+// returns false.
+func (s Snapshot) Range(f func(key string, v interface{}) bool) {
+	for k, v := range s.snap().m {
+		if !f(k, v) {
+			return
+		}
+	}
+}
+
+func (s Snapshot) snap() *snapshot {
+	if s.s == nil {
+		return emptySnapshot
+	}
+	return s.s
+}
@@ -0,0 +1,104 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package swap_test
+
+import (
+	"elements/swap"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestSnapshotStore(t *testing.T) {
+	var s swap.SnapshotStore
+	if _, ok := s.Get("a"); ok {
+		t.Error("Get in an empty store succeeded")
+	}
+	if snap := s.Snapshot(); snap.Len() != 0 || snap.Version() != 0 {
+		t.Errorf("empty Snapshot: Len %d, Version %d", snap.Len(), snap.Version())
+	}
+	if v := s.Replace(map[string]interface{}{"a": 1, "b": 2}); v != 1 {
+		t.Errorf("first Replace = %d, want 1", v)
+	}
+	old := s.Snapshot()
+	if v := s.Replace(map[string]interface{}{"a": 10}); v != 2 {
+		t.Errorf("second Replace = %d, want 2", v)
+	}
+	if v, ok := s.Get("a"); !ok || v != 10 {
+		t.Errorf("Get(a) = %v, %v; want 10", v, ok)
+	}
+	if _, ok := s.Get("b"); ok {
+		t.Error("b survived a Replace without it")
+	}
+	// 之前取的快照不受影响
+	if v, _ := old.Get("a"); v != 1 || old.Len() != 2 || old.Version() != 1 {
+		t.Errorf("old snapshot: a = %v, Len %d, Version %d", v, old.Len(), old.Version())
+	}
+	n := 0
+	old.Range(func(key string, v interface{}) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Errorf("Range did not stop: %d calls", n)
+	}
+}
+
+// 读者在一个快照中总是看到同一个版本的所有key, 并发的Replace不会漏掉或者重复版本号
+func TestSnapshotStoreConcurrent(t *testing.T) {
+	var s swap.SnapshotStore
+	const writers, replaces, keys = 4, 200, 8
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	seen := make(chan uint64, writers*replaces)
+	for w := 0; w < writers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < replaces; i++ {
+				m := make(map[string]interface{}, keys)
+				for k := 0; k < keys; k++ {
+					m[strconv.Itoa(k)] = w*replaces + i
+				}
+				seen <- s.Replace(m)
+			}
+		}(w)
+	}
+	var rg sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		rg.Add(1)
+		go func() {
+			defer rg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				snap := s.Snapshot()
+				first, _ := snap.Get("0")
+				snap.Range(func(key string, v interface{}) bool {
+					if v != first {
+						t.Errorf("snapshot %d mixes %v and %v", snap.Version(), first, v)
+					}
+					return true
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	rg.Wait()
+	close(seen)
+	versions := make(map[uint64]bool)
+	for v := range seen {
+		versions[v] = true
+	}
+	for v := uint64(1); v <= writers*replaces; v++ {
+		if !versions[v] {
+			t.Fatalf("version %d missing", v)
+		}
+	}
+}
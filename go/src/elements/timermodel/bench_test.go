@@ -0,0 +1,86 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package timermodel_test
+
+import (
+	"elements/timermodel"
+	"testing"
+	"time"
+)
+
+// Each benchmark starts timers that never fire and stops them, the pattern
+// of context.WithTimeout on a request that finishes in time. The pending
+// timers keep the heaps and buckets at a realistic size.
+
+const pending = 10000
+
+func BenchmarkStartStop(b *testing.B) {
+	b.Run("runtime", func(b *testing.B) {
+		for i := 0; i < pending; i++ {
+			defer time.AfterFunc(time.Hour, func() {}).Stop()
+		}
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				time.AfterFunc(time.Hour, func() {}).Stop()
+			}
+		})
+	})
+	b.Run("model", func(b *testing.B) {
+		ts := timermodel.New(4)
+		defer ts.Stop()
+		for i := 0; i < pending; i++ {
+			ts.AfterFunc(time.Hour, func() {})
+		}
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				ts.AfterFunc(time.Hour, func() {}).Stop()
+			}
+		})
+	})
+	b.Run("wheel", func(b *testing.B) {
+		w := timermodel.NewWheel(time.Millisecond, 4096)
+		defer w.Stop()
+		for i := 0; i < pending; i++ {
+			w.AfterFunc(time.Hour, func() {})
+		}
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				w.AfterFunc(time.Hour, func() {}).Stop()
+			}
+		})
+	})
+}
+
+func BenchmarkReset(b *testing.B) {
+	b.Run("runtime", func(b *testing.B) {
+		t := time.NewTimer(time.Hour)
+		defer t.Stop()
+		for i := 0; i < b.N; i++ {
+			t.Reset(time.Hour)
+		}
+	})
+	b.Run("model", func(b *testing.B) {
+		ts := timermodel.New(1)
+		defer ts.Stop()
+		t := ts.NewTimer(time.Hour)
+		defer t.Stop()
+		for i := 0; i < b.N; i++ {
+			t.Reset(time.Hour)
+		}
+	})
+	b.Run("wheel", func(b *testing.B) {
+		// 轮子没有Reset, 只能Stop后重新加入
+		w := timermodel.NewWheel(time.Millisecond, 4096)
+		defer w.Stop()
+		t := w.AfterFunc(time.Hour, func() {})
+		for i := 0; i < b.N; i++ {
+			t.Stop()
+			t = w.AfterFunc(time.Hour, func() {})
+		}
+	})
+}
@@ -0,0 +1,250 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package timermodel
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Timers is a set of timer heaps, one per modeled P, each driven by its own
+// goroutine. The zero Timers is not usable; create one with New.
+type Timers struct {
+	ps    []*p
+	next  uint32 // round-robin choice of heap for new timers
+	start time.Time
+	done  chan struct{}
+}
+
+// New returns a Timers with procs heaps, at least one. Call Stop to
+// release its goroutines.
+func New(procs int) *Timers {
+	if procs < 1 {
+		procs = 1
+	}
+	ts := &Timers{start: time.Now(), done: make(chan struct{})}
+	for i := 0; i < procs; i++ {
+		pp := &p{pollUntil: maxWhen, wake: make(chan struct{}, 1)}
+		ts.ps = append(ts.ps, pp)
+		go ts.run(pp)
+	}
+	return ts
+}
+
+// Stop stops the goroutines driving the heaps. Timers that have not fired
+// never fire.
+func (ts *Timers) Stop() {
+	close(ts.done)
+}
+
+// nanotime returns the monotonic time in nanoseconds since ts was created.
+// It is never 0, which checkTimers would take for an unknown time.
+func (ts *Timers) nanotime() int64 {
+	return int64(time.Since(ts.start)) + 1
+}
+
+// when is a helper function for setting the 'when' field of a timer.
+func (ts *Timers) when(d time.Duration) int64 {
+	if d <= 0 {
+		return ts.nanotime()
+	}
+	t := ts.nanotime() + int64(d)
+	if t < 0 {
+		t = 1<<63 - 1 // math.MaxInt64
+	}
+	return t
+}
+
+// local returns the heap for a new timer.
+//
+// runtime把定时器加到当前P的堆中, 用户态拿不到P, 就轮流分配
+func (ts *Timers) local() *p {
+	n := atomic.AddUint32(&ts.next, 1)
+	return ts.ps[n%uint32(len(ts.ps))]
+}
+
+// run is the goroutine driving pp: it runs expired timers and sleeps until
+// the next one, like a P calling checkTimers and an M in netpoll(delay).
+func (ts *Timers) run(pp *p) {
+	sleep := time.NewTimer(time.Hour)
+	for {
+		// 醒着的时候pollUntil是maxWhen, 这期间加入的任何定时器都会发出唤醒信号,
+		// 下面的select不会错过它
+		atomic.StoreInt64(&pp.pollUntil, maxWhen)
+		_, next, _ := checkTimers(pp, ts.nanotime())
+		if next == 0 {
+			next = maxWhen
+		}
+		atomic.StoreInt64(&pp.pollUntil, next)
+
+		var c <-chan time.Time
+		if next != maxWhen {
+			if !sleep.Stop() {
+				select {
+				case <-sleep.C:
+				default:
+				}
+			}
+			sleep.Reset(time.Duration(next - ts.nanotime()))
+			c = sleep.C
+		}
+		select {
+		case <-c:
+		case <-pp.wake:
+		case <-ts.done:
+			sleep.Stop()
+			return
+		}
+	}
+}
+
+// Stats describes the timer heaps.
+type Stats struct {
+	Timers   int // timers in the heaps, including deleted ones
+	Deleted  int // stopped timers not yet removed from the heaps
+	Adjusted int // timers reset to an earlier time, not yet moved
+}
+
+// Stats returns the current state of the heaps.
+func (ts *Timers) Stats() Stats {
+	var s Stats
+	for _, pp := range ts.ps {
+		s.Timers += int(atomic.LoadInt32(&pp.numTimers))
+		s.Deleted += int(atomic.LoadInt32(&pp.deletedTimers))
+		s.Adjusted += int(atomic.LoadInt32(&pp.adjustTimers))
+	}
+	return s
+}
+
+// The Timer type represents a single event. When the Timer expires, the
+// current time will be sent on C, unless the Timer was created by
+// AfterFunc. A Timer must be created with NewTimer or AfterFunc.
+type Timer struct {
+	C  <-chan time.Time
+	r  timer
+	ts *Timers
+}
+
+// Stop prevents the Timer from firing.
+// It returns true if the call stops the timer, false if the timer has
+// already expired or been stopped.
+// Stop does not close the channel, to prevent a read from the channel
+// succeeding incorrectly.
+//
+// 和time.Timer一样, Stop只把定时器标记为timerDeleted, 并不从堆中取出.
+// 它可能在别的P的堆中, 只有那个P能改动自己的堆
+func (t *Timer) Stop() bool {
+	if t.r.f == nil {
+		panic("timermodel: Stop called on uninitialized Timer")
+	}
+	return deltimer(&t.r)
+}
+
+// NewTimer creates a new Timer that will send
+// the current time on its channel after at least duration d.
+func (ts *Timers) NewTimer(d time.Duration) *Timer {
+	c := make(chan time.Time, 1)
+	t := &Timer{
+		C:  c,
+		ts: ts,
+		r: timer{
+			when: ts.when(d),
+			f:    sendTime,
+			arg:  c,
+		},
+	}
+	addtimer(ts.local(), &t.r)
+	return t
+}
+
+// Reset changes the timer to expire after duration d.
+// It returns true if the timer had been active, false if the timer had
+// expired or been stopped.
+//
+// Reset should be invoked only on stopped or expired timers with drained
+// channels, as for time.Timer.
+func (t *Timer) Reset(d time.Duration) bool {
+	if t.r.f == nil {
+		panic("timermodel: Reset called on uninitialized Timer")
+	}
+	w := t.ts.when(d)
+	// Go 1.14的time.Timer.Reset也是先stopTimer再resetTimer: 还在堆中的定时器
+	// 从timerDeleted改为timerModifiedXX, 已经移出堆的重新加入
+	active := deltimer(&t.r)
+	resettimer(t.ts.local(), &t.r, w)
+	return active
+}
+
+func sendTime(c interface{}, seq uintptr) {
+	// Non-blocking send of time on c.
+	// Used in NewTimer, it cannot block anyway (buffer).
+	// Used in NewTicker, dropping sends on the floor is
+	// the desired behavior when the reader gets behind,
+	// because the sends are periodic.
+	select {
+	case c.(chan time.Time) <- time.Now():
+	default:
+	}
+}
+
+// AfterFunc waits for the duration to elapse and then calls f
+// in its own goroutine. It returns a Timer that can
+// be used to cancel the call using its Stop method.
+func (ts *Timers) AfterFunc(d time.Duration, f func()) *Timer {
+	t := &Timer{
+		ts: ts,
+		r: timer{
+			when: ts.when(d),
+			f:    goFunc,
+			arg:  f,
+		},
+	}
+	addtimer(ts.local(), &t.r)
+	return t
+}
+
+func goFunc(arg interface{}, seq uintptr) {
+	go arg.(func())()
+}
+
+// A Ticker holds a channel that delivers `ticks' of a clock
+// at intervals.
+type Ticker struct {
+	C <-chan time.Time // The channel on which the ticks are delivered.
+	r timer
+}
+
+// NewTicker returns a new Ticker containing a channel that will send the
+// time with a period specified by the duration argument.
+// It adjusts the intervals or drops ticks to make up for slow receivers.
+// The duration d must be greater than zero; if not, NewTicker will panic.
+// Stop the ticker to release associated resources.
+func (ts *Timers) NewTicker(d time.Duration) *Ticker {
+	if d <= 0 {
+		panic("timermodel: non-positive interval for NewTicker")
+	}
+	// Give the channel a 1-element time buffer.
+	// If the client falls behind while reading, we drop ticks
+	// on the floor until the client catches up.
+	c := make(chan time.Time, 1)
+	t := &Ticker{
+		C: c,
+		r: timer{
+			when:   ts.when(d),
+			period: int64(d),
+			f:      sendTime,
+			arg:    c,
+		},
+	}
+	addtimer(ts.local(), &t.r)
+	return t
+}
+
+// Stop turns off a ticker. After Stop, no more ticks will be sent.
+// Stop does not close the channel, to prevent a concurrent goroutine
+// reading from the channel from seeing an erroneous "tick".
+func (t *Ticker) Stop() {
+	deltimer(&t.r)
+}
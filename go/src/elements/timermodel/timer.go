@@ -0,0 +1,857 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package timermodel is a userspace model of the runtime timers of Go 1.14
+// (runtime/time.go), for teaching.
+//
+// Since Go 1.14 every P has its own 4-ary heap of timers, and the P that
+// owns a heap is the only one that changes its order. Stopping or resetting
+// a timer that sits in another P's heap only changes the timer's status
+// with a CAS; the owner removes or moves it the next time it looks at its
+// heap. The model keeps the runtime's timer structure, status values and
+// the functions addtimer, deltimer, modtimer, cleantimers, adjusttimers,
+// runtimer and clearDeletedTimers line by line. Each heap is driven by a
+// goroutine that plays the part of the P running checkTimers.
+//
+// Timer, Ticker and AfterFunc on top of the model behave like those of
+// package time. Wheel is a hashed timing wheel with the same AfterFunc
+// interface, for comparing the two designs.
+package timermodel
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+type timer struct {
+	// If this timer is on a heap, which P's heap it is on.
+	pp *p
+
+	// Timer wakes up at when, and then at when+period, ... (period > 0 only)
+	// each time calling f(arg, now) in the timer goroutine, so f must be
+	// a well-behaved function and not block.
+	when   int64
+	period int64
+	f      func(interface{}, uintptr)
+	arg    interface{}
+	seq    uintptr
+
+	// What to set the when field to in timerModifiedXX status.
+	nextwhen int64
+
+	// The status field holds one of the values below.
+	status uint32
+}
+
+// Values for the timer status field.
+//
+// 状态机是这个设计的核心: 只有拥有堆的P会移动堆中的元素, 其他P(这里是调用
+// Stop和Reset的goroutine)只通过CAS修改状态, 把真正的删除和移动留给拥有者.
+// 带ing的状态(Running, Removing, Modifying, Moving)都只持续很短的时间,
+// 遇到它们的一方让出CPU后重试
+const (
+	// Timer has no status set yet.
+	timerNoStatus = iota
+
+	// Waiting for timer to fire.
+	// The timer is in some P's heap.
+	timerWaiting
+
+	// Running the timer function.
+	// A timer will only have this status briefly.
+	timerRunning
+
+	// The timer is deleted and should be removed.
+	// It should not be run, but it is still in some P's heap.
+	timerDeleted
+
+	// The timer is being removed.
+	// The timer will only have this status briefly.
+	timerRemoving
+
+	// The timer has been stopped.
+	// It is not in any P's heap.
+	timerRemoved
+
+	// The timer is being modified.
+	// The timer will only have this status briefly.
+	timerModifying
+
+	// The timer has been modified to an earlier time.
+	// The new when value is in the nextwhen field.
+	// The timer is in some P's heap, possibly in the wrong place.
+	timerModifiedEarlier
+
+	// The timer has been modified to the same or a later time.
+	// The new when value is in the nextwhen field.
+	// The timer is in some P's heap, possibly in the wrong place.
+	timerModifiedLater
+
+	// The timer has been modified and is being moved.
+	// The timer will only have this status briefly.
+	timerMoving
+)
+
+// maxWhen is the maximum value for timer's when field.
+const maxWhen = 1<<63 - 1
+
+// A p holds the timer fields of a runtime P.
+type p struct {
+	// Lock for timers. We normally access the timers while running
+	// on this P, but the scheduler can also do it from a different P.
+	timersLock sync.Mutex
+
+	// Actions to take at some time. This is used to implement the
+	// standard library's time package.
+	// Must hold timersLock to access.
+	timers []*timer
+
+	// The when field of the first entry on the timer heap.
+	// This is updated using atomic functions.
+	// This is 0 if the timer heap is empty.
+	timer0When int64
+
+	// Number of timers in P's heap.
+	// Modified using atomic instructions.
+	numTimers int32
+
+	// Number of timerModifiedEarlier timers on P's heap.
+	// This should only be modified while holding timersLock,
+	// or while the timer status is in a transient state
+	// such as timerModifying.
+	adjustTimers int32
+
+	// Number of timerDeleted timers in P's heap.
+	// Modified using atomic instructions.
+	deletedTimers int32
+
+	// pollUntil is when the goroutine driving this heap will wake up,
+	// maxWhen while it is awake. See wakeNetPoller.
+	pollUntil int64
+	wake      chan struct{}
+}
+
+func badTimer() {
+	panic("timermodel: timer data corruption")
+}
+
+// osyield gives up the CPU while another goroutine finishes a transient
+// status change.
+func osyield() {
+	runtime.Gosched()
+}
+
+// wakeNetPoller wakes up the goroutine sleeping on pp's heap if when is
+// before the time it plans to wake up.
+//
+// runtime中所有P的定时器共用一个睡在netpoll中的M, 这里每个堆有自己的goroutine
+func wakeNetPoller(pp *p, when int64) {
+	if when < atomic.LoadInt64(&pp.pollUntil) {
+		select {
+		case pp.wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// addtimer adds a timer to pp.
+// This should only be called with a newly created timer.
+// That avoids the risk of changing the when field of a timer in some P's heap,
+// which could cause the heap to become unsorted.
+//
+// runtime中总是加到当前P的堆中, 模型由调用者选择pp
+func addtimer(pp *p, t *timer) {
+	// when must never be negative; otherwise runtimer will overflow
+	// during its delta calculation and never expire other runtime timers.
+	if t.when < 0 {
+		t.when = maxWhen
+	}
+	if t.status != timerNoStatus {
+		panic("timermodel: addtimer called with initialized timer")
+	}
+	t.status = timerWaiting
+
+	when := t.when
+
+	pp.timersLock.Lock()
+	// 顺便清理堆顶已经删除或修改过的定时器, 创建后很快又Stop的定时器
+	// (比如context.WithTimeout)就不会在堆中堆积
+	cleantimers(pp)
+	doaddtimer(pp, t)
+	pp.timersLock.Unlock()
+
+	wakeNetPoller(pp, when)
+}
+
+// doaddtimer adds t to pp's heap.
+// The caller must have locked the timers for pp.
+func doaddtimer(pp *p, t *timer) {
+	if t.pp != nil {
+		panic("timermodel: doaddtimer: P already set in timer")
+	}
+	t.pp = pp
+	i := len(pp.timers)
+	pp.timers = append(pp.timers, t)
+	siftupTimer(pp.timers, i)
+	if t == pp.timers[0] {
+		atomic.StoreInt64(&pp.timer0When, t.when)
+	}
+	atomic.AddInt32(&pp.numTimers, 1)
+}
+
+// deltimer deletes the timer t. It may be on some other P, so we can't
+// actually remove it from the timers heap. We can only mark it as deleted.
+// It will be removed in due course by the P whose heap it is on.
+// Reports whether the timer was removed before it was run.
+func deltimer(t *timer) bool {
+	for {
+		switch s := atomic.LoadUint32(&t.status); s {
+		case timerWaiting, timerModifiedLater:
+			// runtime在这里用acquirem禁止抢占: 停在timerModifying状态时被抢占,
+			// 同一个P上的runtimer会一直等待它, 造成自死锁(#38070).
+			// goroutine没有这个问题
+			if atomic.CompareAndSwapUint32(&t.status, s, timerModifying) {
+				// Must fetch t.pp before changing status,
+				// as cleantimers in another goroutine
+				// can clear t.pp of a timerDeleted timer.
+				tpp := t.pp
+				if !atomic.CompareAndSwapUint32(&t.status, timerModifying, timerDeleted) {
+					badTimer()
+				}
+				atomic.AddInt32(&tpp.deletedTimers, 1)
+				// Timer was not yet run.
+				return true
+			}
+		case timerModifiedEarlier:
+			if atomic.CompareAndSwapUint32(&t.status, s, timerModifying) {
+				// Must fetch t.pp before setting status
+				// to timerDeleted.
+				tpp := t.pp
+				atomic.AddInt32(&tpp.adjustTimers, -1)
+				if !atomic.CompareAndSwapUint32(&t.status, timerModifying, timerDeleted) {
+					badTimer()
+				}
+				atomic.AddInt32(&tpp.deletedTimers, 1)
+				// Timer was not yet run.
+				return true
+			}
+		case timerDeleted, timerRemoving, timerRemoved:
+			// Timer was already run.
+			return false
+		case timerRunning, timerMoving:
+			// The timer is being run or moved, by a different P.
+			// Wait for it to complete.
+			osyield()
+		case timerNoStatus:
+			// Removing timer that was never added or
+			// has already been run. Also see issue 21874.
+			return false
+		case timerModifying:
+			// Simultaneous calls to deltimer and modtimer.
+			// Wait for the other call to complete.
+			osyield()
+		default:
+			badTimer()
+		}
+	}
+}
+
+// dodeltimer removes timer i from pp's heap.
+// The caller must have locked the timers for pp.
+func dodeltimer(pp *p, i int) {
+	if t := pp.timers[i]; t.pp != pp {
+		panic("timermodel: dodeltimer: wrong P")
+	} else {
+		t.pp = nil
+	}
+	last := len(pp.timers) - 1
+	if i != last {
+		pp.timers[i] = pp.timers[last]
+	}
+	pp.timers[last] = nil
+	pp.timers = pp.timers[:last]
+	if i != last {
+		// Moving to i may have moved the last timer to a new parent,
+		// so sift up to preserve the heap guarantee.
+		siftupTimer(pp.timers, i)
+		siftdownTimer(pp.timers, i)
+	}
+	if i == 0 {
+		updateTimer0When(pp)
+	}
+	atomic.AddInt32(&pp.numTimers, -1)
+}
+
+// dodeltimer0 removes timer 0 from pp's heap.
+// The caller must have locked the timers for pp.
+func dodeltimer0(pp *p) {
+	if t := pp.timers[0]; t.pp != pp {
+		panic("timermodel: dodeltimer0: wrong P")
+	} else {
+		t.pp = nil
+	}
+	last := len(pp.timers) - 1
+	if last > 0 {
+		pp.timers[0] = pp.timers[last]
+	}
+	pp.timers[last] = nil
+	pp.timers = pp.timers[:last]
+	if last > 0 {
+		siftdownTimer(pp.timers, 0)
+	}
+	updateTimer0When(pp)
+	atomic.AddInt32(&pp.numTimers, -1)
+}
+
+// modtimer modifies an existing timer. A timer that is not in a heap is
+// added to pp.
+func modtimer(pp *p, t *timer, when, period int64, f func(interface{}, uintptr), arg interface{}, seq uintptr) {
+	if when < 0 {
+		when = maxWhen
+	}
+
+	status := uint32(timerNoStatus)
+	wasRemoved := false
+loop:
+	for {
+		switch status = atomic.LoadUint32(&t.status); status {
+		case timerWaiting, timerModifiedEarlier, timerModifiedLater:
+			if atomic.CompareAndSwapUint32(&t.status, status, timerModifying) {
+				break loop
+			}
+		case timerNoStatus, timerRemoved:
+			// Timer was already run and t is no longer in a heap.
+			// Act like addtimer.
+			if atomic.CompareAndSwapUint32(&t.status, status, timerModifying) {
+				wasRemoved = true
+				break loop
+			}
+		case timerDeleted:
+			if atomic.CompareAndSwapUint32(&t.status, status, timerModifying) {
+				atomic.AddInt32(&t.pp.deletedTimers, -1)
+				break loop
+			}
+		case timerRunning, timerRemoving, timerMoving:
+			// The timer is being run or moved, by a different P.
+			// Wait for it to complete.
+			osyield()
+		case timerModifying:
+			// Multiple simultaneous calls to modtimer.
+			// Wait for the other call to complete.
+			osyield()
+		default:
+			badTimer()
+		}
+	}
+
+	t.period = period
+	t.f = f
+	t.arg = arg
+	t.seq = seq
+
+	if wasRemoved {
+		t.when = when
+		pp.timersLock.Lock()
+		doaddtimer(pp, t)
+		pp.timersLock.Unlock()
+		if !atomic.CompareAndSwapUint32(&t.status, timerModifying, timerWaiting) {
+			badTimer()
+		}
+		wakeNetPoller(pp, when)
+	} else {
+		// The timer is in some other P's heap, so we can't change
+		// the when field. If we did, the other P's heap would
+		// be out of order. So we put the new when value in the
+		// nextwhen field, and let the other P set the when field
+		// when it is prepared to resort the heap.
+		t.nextwhen = when
+
+		newStatus := uint32(timerModifiedLater)
+		if when < t.when {
+			newStatus = timerModifiedEarlier
+		}
+
+		// Update the adjustTimers field.  Subtract one if we
+		// are removing a timerModifiedEarlier, add one if we
+		// are adding a timerModifiedEarlier.
+		//
+		// 改晚的定时器留在原位不会出错: 它到期时runtimer会发现状态是
+		// timerModifiedLater, 把它移到正确的位置. 改早的定时器却可能被
+		// 埋在堆的深处错过时间, 所以要计数, 让adjusttimers去找它们
+		adjust := int32(0)
+		if status == timerModifiedEarlier {
+			adjust--
+		}
+		if newStatus == timerModifiedEarlier {
+			adjust++
+		}
+		tpp := t.pp
+		if adjust != 0 {
+			atomic.AddInt32(&tpp.adjustTimers, adjust)
+		}
+
+		// Set the new status of the timer.
+		if !atomic.CompareAndSwapUint32(&t.status, timerModifying, newStatus) {
+			badTimer()
+		}
+
+		// If the new status is earlier, wake up the poller.
+		if newStatus == timerModifiedEarlier {
+			wakeNetPoller(tpp, when)
+		}
+	}
+}
+
+// resettimer resets the time when a timer should fire.
+// If used for an inactive timer, the timer will become active.
+// This should be called instead of addtimer if the timer value has been,
+// or may have been, used previously.
+func resettimer(pp *p, t *timer, when int64) {
+	modtimer(pp, t, when, t.period, t.f, t.arg, t.seq)
+}
+
+// cleantimers cleans up the head of the timer queue. This speeds up
+// programs that create and delete timers; leaving them in the heap
+// slows down addtimer.
+// The caller must have locked the timers for pp.
+func cleantimers(pp *p) {
+	for {
+		if len(pp.timers) == 0 {
+			return
+		}
+		t := pp.timers[0]
+		if t.pp != pp {
+			panic("timermodel: cleantimers: bad p")
+		}
+		switch s := atomic.LoadUint32(&t.status); s {
+		case timerDeleted:
+			if !atomic.CompareAndSwapUint32(&t.status, s, timerRemoving) {
+				continue
+			}
+			dodeltimer0(pp)
+			if !atomic.CompareAndSwapUint32(&t.status, timerRemoving, timerRemoved) {
+				badTimer()
+			}
+			atomic.AddInt32(&pp.deletedTimers, -1)
+		case timerModifiedEarlier, timerModifiedLater:
+			if !atomic.CompareAndSwapUint32(&t.status, s, timerMoving) {
+				continue
+			}
+			// Now we can change the when field.
+			t.when = t.nextwhen
+			// Move t to the right position.
+			dodeltimer0(pp)
+			doaddtimer(pp, t)
+			if s == timerModifiedEarlier {
+				atomic.AddInt32(&pp.adjustTimers, -1)
+			}
+			if !atomic.CompareAndSwapUint32(&t.status, timerMoving, timerWaiting) {
+				badTimer()
+			}
+		default:
+			// Head of timers does not need adjustment.
+			return
+		}
+	}
+}
+
+// adjusttimers looks through the timers in pp's heap for
+// any timers that have been modified to run earlier, and puts them in
+// the correct place in the heap. While looking for those timers,
+// it also moves timers that have been modified to run later,
+// and removes deleted timers. The caller must have locked the timers for pp.
+func adjusttimers(pp *p) {
+	if len(pp.timers) == 0 {
+		return
+	}
+	if atomic.LoadInt32(&pp.adjustTimers) == 0 {
+		return
+	}
+	var moved []*timer
+loop:
+	for i := 0; i < len(pp.timers); i++ {
+		t := pp.timers[i]
+		if t.pp != pp {
+			panic("timermodel: adjusttimers: bad p")
+		}
+		switch s := atomic.LoadUint32(&t.status); s {
+		case timerDeleted:
+			if atomic.CompareAndSwapUint32(&t.status, s, timerRemoving) {
+				dodeltimer(pp, i)
+				if !atomic.CompareAndSwapUint32(&t.status, timerRemoving, timerRemoved) {
+					badTimer()
+				}
+				atomic.AddInt32(&pp.deletedTimers, -1)
+				// Look at this heap position again.
+				i--
+			}
+		case timerModifiedEarlier, timerModifiedLater:
+			if atomic.CompareAndSwapUint32(&t.status, s, timerMoving) {
+				// Now we can change the when field.
+				t.when = t.nextwhen
+				// Take t off the heap, and hold onto it.
+				// We don't add it back yet because the
+				// heap manipulation could cause our
+				// loop to skip some other timer.
+				dodeltimer(pp, i)
+				moved = append(moved, t)
+				if s == timerModifiedEarlier {
+					// 所有改早的定时器都找到了, 剩下的不用再看
+					if n := atomic.AddInt32(&pp.adjustTimers, -1); n <= 0 {
+						break loop
+					}
+				}
+				// Look at this heap position again.
+				i--
+			}
+		case timerNoStatus, timerRunning, timerRemoving, timerRemoved, timerMoving:
+			badTimer()
+		case timerWaiting:
+			// OK, nothing to do.
+		case timerModifying:
+			// Check again after modification is complete.
+			osyield()
+			i--
+		default:
+			badTimer()
+		}
+	}
+
+	if len(moved) > 0 {
+		addAdjustedTimers(pp, moved)
+	}
+}
+
+// addAdjustedTimers adds any timers we adjusted in adjusttimers
+// back to the timer heap.
+func addAdjustedTimers(pp *p, moved []*timer) {
+	for _, t := range moved {
+		doaddtimer(pp, t)
+		if !atomic.CompareAndSwapUint32(&t.status, timerMoving, timerWaiting) {
+			badTimer()
+		}
+	}
+}
+
+// runtimer examines the first timer in timers. If it is ready based on now,
+// it runs the timer and removes or updates it.
+// Returns 0 if it ran a timer, -1 if there are no more timers, or the time
+// when the first timer should run.
+// The caller must have locked the timers for pp.
+// If a timer is run, this will temporarily unlock the timers.
+func runtimer(pp *p, now int64) int64 {
+	for {
+		t := pp.timers[0]
+		if t.pp != pp {
+			panic("timermodel: runtimer: bad p")
+		}
+		switch s := atomic.LoadUint32(&t.status); s {
+		case timerWaiting:
+			if t.when > now {
+				// Not ready to run.
+				return t.when
+			}
+
+			if !atomic.CompareAndSwapUint32(&t.status, s, timerRunning) {
+				continue
+			}
+			// Note that runOneTimer may temporarily unlock
+			// pp.timersLock.
+			runOneTimer(pp, t, now)
+			return 0
+
+		case timerDeleted:
+			if !atomic.CompareAndSwapUint32(&t.status, s, timerRemoving) {
+				continue
+			}
+			dodeltimer0(pp)
+			if !atomic.CompareAndSwapUint32(&t.status, timerRemoving, timerRemoved) {
+				badTimer()
+			}
+			atomic.AddInt32(&pp.deletedTimers, -1)
+			if len(pp.timers) == 0 {
+				return -1
+			}
+
+		case timerModifiedEarlier, timerModifiedLater:
+			if !atomic.CompareAndSwapUint32(&t.status, s, timerMoving) {
+				continue
+			}
+			t.when = t.nextwhen
+			dodeltimer0(pp)
+			doaddtimer(pp, t)
+			if s == timerModifiedEarlier {
+				atomic.AddInt32(&pp.adjustTimers, -1)
+			}
+			if !atomic.CompareAndSwapUint32(&t.status, timerMoving, timerWaiting) {
+				badTimer()
+			}
+
+		case timerModifying:
+			// Wait for modification to complete.
+			osyield()
+
+		case timerNoStatus, timerRemoved:
+			// Should not see a new or inactive timer on the heap.
+			badTimer()
+		case timerRunning, timerRemoving, timerMoving:
+			// These should only be set when timers are locked,
+			// and we didn't do it.
+			badTimer()
+		default:
+			badTimer()
+		}
+	}
+}
+
+// runOneTimer runs a single timer.
+// The caller must have locked the timers for pp.
+// This will temporarily unlock the timers while running the timer function.
+func runOneTimer(pp *p, t *timer, now int64) {
+	f := t.f
+	arg := t.arg
+	seq := t.seq
+
+	if t.period > 0 {
+		// Leave in heap but adjust next time to fire.
+		//
+		// 跳过已经错过的周期: 下一次触发时间是when之后第一个晚于now的
+		// when+k*period, 所以落后的Ticker不会连续触发来追赶
+		delta := t.when - now
+		t.when += t.period * (1 + -delta/t.period)
+		siftdownTimer(pp.timers, 0)
+		if !atomic.CompareAndSwapUint32(&t.status, timerRunning, timerWaiting) {
+			badTimer()
+		}
+		updateTimer0When(pp)
+	} else {
+		// Remove from heap.
+		dodeltimer0(pp)
+		if !atomic.CompareAndSwapUint32(&t.status, timerRunning, timerNoStatus) {
+			badTimer()
+		}
+	}
+
+	pp.timersLock.Unlock()
+
+	f(arg, seq)
+
+	pp.timersLock.Lock()
+}
+
+// clearDeletedTimers removes all deleted timers from the P's timer heap.
+// This is used to avoid clogging up the heap if the program
+// starts a lot of long-running timers and then stops them.
+// For example, this can happen via context.WithTimeout.
+//
+// This is the only function that walks through the entire timer heap,
+// other than moveTimers which only runs when the world is stopped.
+//
+// The caller must have locked the timers for pp.
+func clearDeletedTimers(pp *p) {
+	cdel := int32(0)
+	cearlier := int32(0)
+	to := 0
+	changedHeap := false
+	timers := pp.timers
+nextTimer:
+	for _, t := range timers {
+		for {
+			switch s := atomic.LoadUint32(&t.status); s {
+			case timerWaiting:
+				if changedHeap {
+					timers[to] = t
+					siftupTimer(timers, to)
+				}
+				to++
+				continue nextTimer
+			case timerModifiedEarlier, timerModifiedLater:
+				if atomic.CompareAndSwapUint32(&t.status, s, timerMoving) {
+					t.when = t.nextwhen
+					timers[to] = t
+					siftupTimer(timers, to)
+					to++
+					changedHeap = true
+					if !atomic.CompareAndSwapUint32(&t.status, timerMoving, timerWaiting) {
+						badTimer()
+					}
+					if s == timerModifiedEarlier {
+						cearlier++
+					}
+					continue nextTimer
+				}
+			case timerDeleted:
+				if atomic.CompareAndSwapUint32(&t.status, s, timerRemoving) {
+					t.pp = nil
+					cdel++
+					if !atomic.CompareAndSwapUint32(&t.status, timerRemoving, timerRemoved) {
+						badTimer()
+					}
+					changedHeap = true
+					continue nextTimer
+				}
+			case timerModifying:
+				// Loop until modification complete.
+				osyield()
+			case timerNoStatus, timerRemoved:
+				// We should not see these status values in a timer heap.
+				badTimer()
+			case timerRunning, timerRemoving, timerMoving:
+				// Some other P thinks it owns this timer,
+				// which should not happen.
+				badTimer()
+			default:
+				badTimer()
+			}
+		}
+	}
+
+	// Set remaining slots in timers slice to nil,
+	// so that the timer values can be garbage collected.
+	for i := to; i < len(timers); i++ {
+		timers[i] = nil
+	}
+
+	atomic.AddInt32(&pp.deletedTimers, -cdel)
+	atomic.AddInt32(&pp.numTimers, -cdel)
+	atomic.AddInt32(&pp.adjustTimers, -cearlier)
+
+	timers = timers[:to]
+	pp.timers = timers
+	updateTimer0When(pp)
+}
+
+// updateTimer0When sets the P's timer0When field.
+// The caller must have locked the timers for pp.
+func updateTimer0When(pp *p) {
+	if len(pp.timers) == 0 {
+		atomic.StoreInt64(&pp.timer0When, 0)
+	} else {
+		atomic.StoreInt64(&pp.timer0When, pp.timers[0].when)
+	}
+}
+
+// checkTimers runs any timers for pp that are ready.
+// If now is not 0 it is the current time.
+// It returns the current time or 0 if it is not known,
+// and the time when the next timer should run or 0 if there is no next timer,
+// and reports whether it ran any timers.
+//
+// runtime在schedule, findrunnable和stealWork中调用它, P每次调度都顺便检查
+// 自己的定时器; 模型由驱动堆的goroutine调用
+func checkTimers(pp *p, now int64) (rnow, pollUntil int64, ran bool) {
+	// If there are no timers to adjust, and the first timer on
+	// the heap is not yet ready to run, then there is nothing to do.
+	if atomic.LoadInt32(&pp.adjustTimers) == 0 {
+		next := atomic.LoadInt64(&pp.timer0When)
+		if next == 0 {
+			return now, 0, false
+		}
+		if now < next {
+			// Next timer is not ready to run.
+			// But keep going if we would clear deleted timers.
+			// This corresponds to the condition below where
+			// we decide whether to call clearDeletedTimers.
+			if atomic.LoadInt32(&pp.deletedTimers) <= atomic.LoadInt32(&pp.numTimers)/4 {
+				return now, next, false
+			}
+		}
+	}
+
+	pp.timersLock.Lock()
+
+	adjusttimers(pp)
+
+	rnow = now
+	if len(pp.timers) > 0 {
+		for len(pp.timers) > 0 {
+			// Note that runtimer may temporarily unlock
+			// pp.timersLock.
+			if tw := runtimer(pp, rnow); tw != 0 {
+				if tw > 0 {
+					pollUntil = tw
+				}
+				break
+			}
+			ran = true
+		}
+	}
+
+	// If this is the local P, and there are a lot of deleted timers,
+	// clear them out. We only do this for the local P to reduce
+	// lock contention on timersLock.
+	//
+	// 删除的定时器超过1/4时整理整个堆, 大量Stop的长定时器不会一直占着内存
+	if int(atomic.LoadInt32(&pp.deletedTimers)) > len(pp.timers)/4 {
+		clearDeletedTimers(pp)
+	}
+
+	pp.timersLock.Unlock()
+
+	return rnow, pollUntil, ran
+}
+
+// siftupTimer and siftdownTimer maintain a 4-ary heap ordered by when.
+//
+// 四叉堆比二叉堆矮一半, 上浮(添加定时器, 最常见的操作)比较的次数更少;
+// 下沉时每层要比较4个孩子, 但它们在同一条缓存行中
+func siftupTimer(t []*timer, i int) {
+	if i >= len(t) {
+		badTimer()
+	}
+	when := t[i].when
+	tmp := t[i]
+	for i > 0 {
+		p := (i - 1) / 4 // parent
+		if when >= t[p].when {
+			break
+		}
+		t[i] = t[p]
+		i = p
+	}
+	if tmp != t[i] {
+		t[i] = tmp
+	}
+}
+
+func siftdownTimer(t []*timer, i int) {
+	n := len(t)
+	if i >= n {
+		badTimer()
+	}
+	when := t[i].when
+	tmp := t[i]
+	for {
+		c := i*4 + 1 // left child
+		c3 := c + 2  // mid child
+		if c >= n {
+			break
+		}
+		w := t[c].when
+		if c+1 < n && t[c+1].when < w {
+			w = t[c+1].when
+			c++
+		}
+		if c3 < n {
+			w3 := t[c3].when
+			if c3+1 < n && t[c3+1].when < w3 {
+				w3 = t[c3+1].when
+				c3++
+			}
+			if w3 < w {
+				w = w3
+				c = c3
+			}
+		}
+		if w >= when {
+			break
+		}
+		t[i] = t[c]
+		i = c
+	}
+	if tmp != t[i] {
+		t[i] = tmp
+	}
+}
@@ -0,0 +1,241 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package timermodel_test
+
+import (
+	"elements/timermodel"
+	"sync"
+	"testing"
+	"time"
+)
+
+// waitFor polls cond until it holds or a second has passed.
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTimer(t *testing.T) {
+	ts := timermodel.New(2)
+	defer ts.Stop()
+
+	start := time.Now()
+	tm := ts.NewTimer(20 * time.Millisecond)
+	select {
+	case <-tm.C:
+	case <-time.After(time.Second):
+		t.Fatal("timer did not fire")
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Errorf("timer fired after %v, want at least 20ms", d)
+	}
+	if tm.Stop() {
+		t.Error("Stop of a fired timer returned true")
+	}
+}
+
+func TestAfterFuncOrder(t *testing.T) {
+	ts := timermodel.New(1)
+	defer ts.Stop()
+
+	var wg sync.WaitGroup
+	for _, i := range []int{5, 1, 4, 2, 3} {
+		wg.Add(1)
+		ts.AfterFunc(time.Duration(i)*5*time.Millisecond, wg.Done)
+	}
+	// AfterFunc的回调各自在新的goroutine中运行, 它们运行的先后不能说明
+	// 定时器触发的顺序, 只检查都运行了
+	wg.Wait()
+}
+
+func TestTimerOrder(t *testing.T) {
+	// 只有一个堆时, 定时器严格按到期时间的顺序运行. NewTimer的定时器在
+	// 堆的运行循环中取当前时间发送到C, 这个时间就是它触发的先后
+	ts := timermodel.New(1)
+	defer ts.Stop()
+
+	timers := make(map[int]*timermodel.Timer)
+	for _, i := range []int{5, 1, 4, 2, 3} {
+		timers[i] = ts.NewTimer(time.Duration(i) * 5 * time.Millisecond)
+	}
+	var prev time.Time
+	for i := 1; i <= 5; i++ {
+		var fired time.Time
+		select {
+		case fired = <-timers[i].C:
+		case <-time.After(time.Second):
+			t.Fatalf("timer %d did not fire", i)
+		}
+		if fired.Before(prev) {
+			t.Errorf("timer %d fired at %v, before timer %d at %v", i, fired, i-1, prev)
+		}
+		prev = fired
+	}
+}
+
+func TestStop(t *testing.T) {
+	ts := timermodel.New(4)
+	defer ts.Stop()
+
+	fired := make(chan bool, 1)
+	tm := ts.AfterFunc(20*time.Millisecond, func() { fired <- true })
+	if !tm.Stop() {
+		t.Fatal("Stop of an active timer returned false")
+	}
+	if tm.Stop() {
+		t.Error("second Stop returned true")
+	}
+	select {
+	case <-fired:
+		t.Fatal("stopped timer fired")
+	case <-time.After(60 * time.Millisecond):
+	}
+}
+
+func TestReset(t *testing.T) {
+	ts := timermodel.New(2)
+	defer ts.Stop()
+
+	// 改早: 定时器变成timerModifiedEarlier, 由adjusttimers移到正确的位置
+	start := time.Now()
+	tm := ts.NewTimer(time.Hour)
+	if !tm.Reset(10 * time.Millisecond) {
+		t.Error("Reset of an active timer returned false")
+	}
+	select {
+	case <-tm.C:
+	case <-time.After(time.Second):
+		t.Fatal("timer reset to an earlier time did not fire")
+	}
+	if d := time.Since(start); d < 10*time.Millisecond {
+		t.Errorf("fired after %v, want at least 10ms", d)
+	}
+
+	// 已经触发的定时器重新加入堆
+	if tm.Reset(10 * time.Millisecond) {
+		t.Error("Reset of a fired timer returned true")
+	}
+	select {
+	case <-tm.C:
+	case <-time.After(time.Second):
+		t.Fatal("timer reset after firing did not fire")
+	}
+
+	// 改晚
+	tm.Reset(10 * time.Millisecond)
+	tm.Reset(80 * time.Millisecond)
+	select {
+	case <-tm.C:
+		t.Fatal("timer fired at the time it was reset away from")
+	case <-time.After(40 * time.Millisecond):
+	}
+	select {
+	case <-tm.C:
+	case <-time.After(time.Second):
+		t.Fatal("timer reset to a later time did not fire")
+	}
+	waitFor(t, "empty heaps", func() bool { return ts.Stats() == timermodel.Stats{} })
+}
+
+func TestTicker(t *testing.T) {
+	ts := timermodel.New(2)
+	defer ts.Stop()
+
+	const period = 10 * time.Millisecond
+	tk := ts.NewTicker(period)
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		<-tk.C
+	}
+	if d := time.Since(start); d < 4*period {
+		t.Errorf("5 ticks in %v, want at least %v", d, 4*period)
+	}
+	tk.Stop()
+	time.Sleep(2 * period)
+	select {
+	case <-tk.C: // 可能还有一个Stop之前发送的
+	default:
+	}
+	select {
+	case <-tk.C:
+		t.Fatal("tick after Stop")
+	case <-time.After(3 * period):
+	}
+}
+
+func TestDeletedTimersCleared(t *testing.T) {
+	ts := timermodel.New(1)
+	defer ts.Stop()
+
+	var timers []*timermodel.Timer
+	for i := 0; i < 100; i++ {
+		timers = append(timers, ts.NewTimer(time.Hour))
+	}
+	for _, tm := range timers {
+		tm.Stop()
+	}
+	// Stop不会从堆中取出定时器
+	if s := ts.Stats(); s.Timers != 100 || s.Deleted != 100 {
+		t.Fatalf("after 100 Stops: %+v, want 100 timers, all deleted", s)
+	}
+	// 下一次checkTimers发现删除的定时器超过1/4, 整理整个堆
+	done := make(chan bool)
+	ts.AfterFunc(time.Millisecond, func() { close(done) })
+	<-done
+	waitFor(t, "deleted timers to be cleared", func() bool { return ts.Stats() == timermodel.Stats{} })
+}
+
+func TestConcurrentResetStop(t *testing.T) {
+	ts := timermodel.New(4)
+	defer ts.Stop()
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 200; i++ {
+				tm := ts.AfterFunc(time.Duration(i%7)*time.Microsecond, func() {})
+				if i%3 == 0 {
+					tm.Reset(time.Duration(i%5) * time.Microsecond)
+				}
+				tm.Stop()
+			}
+		}()
+	}
+	wg.Wait()
+	waitFor(t, "empty heaps", func() bool {
+		s := ts.Stats()
+		return s.Deleted == 0 && s.Adjusted == 0
+	})
+}
+
+func TestWheel(t *testing.T) {
+	w := timermodel.NewWheel(time.Millisecond, 8)
+	defer w.Stop()
+
+	// 30 tick的定时器要在8个桶的轮子上转3圈多
+	fired := make(chan time.Duration, 1)
+	start := time.Now()
+	w.AfterFunc(30*time.Millisecond, func() { fired <- time.Since(start) })
+	stopped := w.AfterFunc(10*time.Millisecond, func() { t.Error("stopped wheel timer fired") })
+	if !stopped.Stop() || stopped.Stop() {
+		t.Error("Stop results wrong")
+	}
+	select {
+	case d := <-fired:
+		if d < 30*time.Millisecond {
+			t.Errorf("fired after %v, want at least 30ms", d)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("wheel timer did not fire")
+	}
+}
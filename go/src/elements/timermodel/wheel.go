@@ -0,0 +1,165 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package timermodel
+
+import (
+	"elements/clock"
+	"sync"
+	"time"
+)
+
+// A Wheel is a hashed timing wheel: a ring of buckets, one per tick of a
+// fixed resolution, that a goroutine advances once per tick.
+//
+// Adding and stopping a timer are O(1), where the runtime's heaps take
+// O(log n) to add one, but a Wheel only fires timers on tick boundaries
+// and must wake up every tick even when no timer is due. It is here to
+// compare with the heaps of Timers.
+//
+// The ticks are counted on the clock, not by the ticker: when the
+// goroutine wakes up late, it moves the wheel by every tick since the
+// last, and the ticks the ticker dropped are not lost.
+type Wheel struct {
+	tick  time.Duration
+	clock clock.Clock
+	start time.Time
+
+	mu      sync.Mutex
+	buckets []*WheelTimer // heads of doubly-linked lists
+	pos     int           // bucket of the current tick
+	ticks   int64         // ticks the wheel has moved since start
+
+	ticker clock.Ticker
+	done   chan struct{}
+}
+
+// A WheelTimer is a timer scheduled on a Wheel.
+type WheelTimer struct {
+	w          *Wheel
+	f          func()
+	bucket     int
+	rounds     int // full turns of the wheel left before firing
+	prev, next *WheelTimer
+	active     bool
+}
+
+// NewWheel returns a Wheel with the given resolution and number of buckets.
+// Call Stop to release its goroutine.
+func NewWheel(tick time.Duration, buckets int) *Wheel {
+	return NewWheelClock(tick, buckets, clock.Real)
+}
+
+// NewWheelClock is like NewWheel, for a Wheel that runs on c, or on
+// clock.Real if c is nil.
+func NewWheelClock(tick time.Duration, buckets int, c clock.Clock) *Wheel {
+	if tick <= 0 || buckets <= 0 {
+		panic("timermodel: non-positive tick or bucket count for NewWheel")
+	}
+	c = clock.Or(c)
+	w := &Wheel{
+		tick:    tick,
+		clock:   c,
+		start:   c.Now(),
+		buckets: make([]*WheelTimer, buckets),
+		ticker:  c.NewTicker(tick),
+		done:    make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+// Stop stops the wheel. Timers that have not fired never fire.
+func (w *Wheel) Stop() {
+	w.ticker.Stop()
+	close(w.done)
+}
+
+func (w *Wheel) run() {
+	for {
+		select {
+		case <-w.ticker.C():
+			for n := int64(clock.Since(w.clock, w.start) / w.tick); w.ticks < n; {
+				w.advance()
+			}
+		case <-w.done:
+			return
+		}
+	}
+}
+
+// advance moves the wheel one tick forward and fires the timers that are due.
+func (w *Wheel) advance() {
+	var due []func()
+	w.mu.Lock()
+	w.ticks++
+	w.pos = (w.pos + 1) % len(w.buckets)
+	for t := w.buckets[w.pos]; t != nil; {
+		next := t.next
+		// 同一个桶中可能有还要再转几圈的定时器, 超时时间越长于一圈,
+		// 每个tick要跳过的定时器就越多
+		if t.rounds > 0 {
+			t.rounds--
+		} else {
+			w.remove(t)
+			due = append(due, t.f)
+		}
+		t = next
+	}
+	w.mu.Unlock()
+	for _, f := range due {
+		go f()
+	}
+}
+
+// AfterFunc waits for at least the duration d, rounded up to a whole
+// number of ticks, and then calls f in its own goroutine.
+func (w *Wheel) AfterFunc(d time.Duration, f func()) *WheelTimer {
+	ticks := int((d + w.tick - 1) / w.tick)
+	if ticks < 1 {
+		ticks = 1
+	}
+	t := &WheelTimer{w: w, f: f}
+	w.mu.Lock()
+	n := len(w.buckets)
+	t.bucket = (w.pos + ticks) % n
+	t.rounds = (ticks - 1) / n
+	t.next = w.buckets[t.bucket]
+	if t.next != nil {
+		t.next.prev = t
+	}
+	w.buckets[t.bucket] = t
+	t.active = true
+	w.mu.Unlock()
+	return t
+}
+
+// remove unlinks t. w.mu must be held.
+func (w *Wheel) remove(t *WheelTimer) {
+	if t.prev != nil {
+		t.prev.next = t.next
+	} else {
+		w.buckets[t.bucket] = t.next
+	}
+	if t.next != nil {
+		t.next.prev = t.prev
+	}
+	t.prev, t.next = nil, nil
+	t.active = false
+}
+
+// Stop prevents the timer from firing. It returns true if the call stops
+// the timer, false if the timer has already fired or been stopped.
+//
+// 和堆不同, 定时器在双向链表中, 可以直接摘除
+func (t *WheelTimer) Stop() bool {
+	w := t.w
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !t.active {
+		return false
+	}
+	w.remove(t)
+	return true
+}
@@ -0,0 +1,265 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// Package workerpool runs the tasks of many tenants on a fixed set of
+// goroutines, sharing them fairly between the tenants.
+//
+//	p := workerpool.New(workerpool.Config{Workers: 16})
+//	p.SetWeight("checkout", 4)
+//	...
+//	err := p.Submit(tenant, func() { handle(req) })
+//
+// A single queue in front of the workers runs the tasks in the order they
+// come: one tenant that submits 100k tasks at once makes every other
+// tenant wait for all of them. A Pool keeps a queue per tenant instead,
+// and the workers take from the queues by deficit round robin: each
+// tenant with tasks waiting gets, in its turn, as many tasks run as its
+// weight, then the next tenant gets its turn. Tenants thus share the
+// workers in proportion to their weights whatever they submit, and a
+// tenant that submits a task waits at most one round of the others for
+// it to start.
+package workerpool
+
+import (
+	"context"
+	"elements/errs"
+	"elements/lifecycle"
+	"runtime"
+	"runtime/debug"
+	"sync"
+)
+
+// ErrClosed is returned by Submit once Shutdown has been called. It is
+// errs.ErrClosed to errors.Is.
+var ErrClosed = errs.New("workerpool: pool shut down", errs.ErrClosed)
+
+// ErrQueueFull is returned by Submit when the tenant has QueueLimit tasks
+// waiting. It is errs.ErrCapacity to errors.Is.
+var ErrQueueFull = errs.New("workerpool: tenant queue full", errs.ErrCapacity)
+
+// Config configures a Pool.
+type Config struct {
+	// Workers is the number of goroutines that run the tasks. Zero means
+	// runtime.GOMAXPROCS(0).
+	Workers int
+
+	// QueueLimit, if positive, is the number of tasks a tenant may have
+	// waiting; Submit rejects the tasks beyond it with ErrQueueFull. Zero
+	// means no limit.
+	QueueLimit int
+
+	// OnPanic, if not nil, is called with the value and the stack of a
+	// task that panicked. The panic is recovered either way, and the
+	// worker goes on with the next task.
+	OnPanic func(p interface{}, stack []byte)
+}
+
+// A Pool is a set of workers shared by tenants. It is safe for concurrent
+// use.
+type Pool struct {
+	limit   int
+	onPanic func(p interface{}, stack []byte)
+	workers int
+
+	mu      sync.Mutex
+	cond    sync.Cond               // signaled when a task is queued, or the pool shut down
+	tenants map[string]*tenantQueue // the tenants with tasks waiting
+	weights map[string]int          // the weights set by SetWeight
+	active  []*tenantQueue          // the tenants with tasks waiting, in round robin order
+	turn    int                     // the index in active of the tenant whose turn it is
+	queued  int
+	running int
+	closed  bool
+
+	done chan struct{} // closed once every worker has returned
+}
+
+type tenantQueue struct {
+	name    string
+	weight  int
+	deficit int      // the tasks left of its turn; 0 when the turn has not begun
+	q       []func() // its tasks, first in, first out
+}
+
+// Stats describes the activity of a Pool.
+type Stats struct {
+	Workers int // goroutines running tasks
+	Running int // tasks running now
+	Queued  int // tasks waiting
+	Tenants int // tenants with tasks waiting
+}
+
+// New returns a Pool with its workers running, registered in
+// lifecycle.Default. Call Shutdown to stop it.
+func New(cfg Config) *Pool {
+	n := cfg.Workers
+	if n <= 0 {
+		n = runtime.GOMAXPROCS(0)
+	}
+	p := &Pool{
+		limit:   cfg.QueueLimit,
+		onPanic: cfg.OnPanic,
+		workers: n,
+		tenants: make(map[string]*tenantQueue),
+		weights: make(map[string]int),
+		done:    make(chan struct{}),
+	}
+	p.cond.L = &p.mu
+	lifecycle.Register(p, "workerpool.Pool", p.Shutdown)
+	var wg sync.WaitGroup
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		go func() {
+			defer wg.Done()
+			p.work()
+		}()
+	}
+	go func() {
+		wg.Wait()
+		lifecycle.Unregister(p)
+		close(p.done)
+	}()
+	return p
+}
+
+// SetWeight sets the share of the workers that tenant gets: the number of
+// its tasks run in each of its turns, against the other tenants' weights.
+// The weight of a tenant not set is 1. SetWeight panics if weight is not
+// positive.
+func (p *Pool) SetWeight(tenant string, weight int) {
+	if weight <= 0 {
+		panic("workerpool: SetWeight with non-positive weight")
+	}
+	p.mu.Lock()
+	p.weights[tenant] = weight
+	if t := p.tenants[tenant]; t != nil {
+		// 正在进行的这一轮不变, 下一轮按新的权重
+		t.weight = weight
+	}
+	p.mu.Unlock()
+}
+
+// Submit queues f to run as a task of tenant. It returns ErrQueueFull if
+// tenant has QueueLimit tasks waiting already, and ErrClosed after
+// Shutdown.
+func (p *Pool) Submit(tenant string, f func()) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.closed {
+		return ErrClosed
+	}
+	t := p.tenants[tenant]
+	if t == nil {
+		t = &tenantQueue{name: tenant, weight: 1}
+		if w, ok := p.weights[tenant]; ok {
+			t.weight = w
+		}
+		p.tenants[tenant] = t
+		// 新的租户排在这一轮的最后, 不插到正在轮到的租户前面
+		p.active = append(p.active, nil)
+		copy(p.active[p.turn+1:], p.active[p.turn:])
+		p.active[p.turn] = t
+		if len(p.active) > 1 {
+			p.turn++
+		}
+	} else if p.limit > 0 && len(t.q) >= p.limit {
+		return ErrQueueFull
+	}
+	t.q = append(t.q, f)
+	p.queued++
+	p.cond.Signal()
+	return nil
+}
+
+// next removes and returns the next task to run, or nil if there is none.
+// p.mu must be held.
+func (p *Pool) next() func() {
+	if len(p.active) == 0 {
+		return nil
+	}
+	t := p.active[p.turn]
+	if t.deficit == 0 {
+		// 轮到它了: 这一轮可以运行weight个任务
+		t.deficit = t.weight
+	}
+	f := t.q[0]
+	t.q[0] = nil
+	t.q = t.q[1:]
+	t.deficit--
+	p.queued--
+	switch {
+	case len(t.q) == 0:
+		// 队列空了就退出轮转, 没用完的份额不留到以后
+		delete(p.tenants, t.name)
+		copy(p.active[p.turn:], p.active[p.turn+1:])
+		p.active[len(p.active)-1] = nil
+		p.active = p.active[:len(p.active)-1]
+	case t.deficit == 0:
+		p.turn++
+	default:
+		return f
+	}
+	if p.turn >= len(p.active) {
+		p.turn = 0
+	}
+	return f
+}
+
+func (p *Pool) work() {
+	p.mu.Lock()
+	for {
+		f := p.next()
+		if f == nil {
+			if p.closed {
+				p.mu.Unlock()
+				return
+			}
+			p.cond.Wait()
+			continue
+		}
+		p.running++
+		p.mu.Unlock()
+		p.run(f)
+		p.mu.Lock()
+		p.running--
+	}
+}
+
+// run runs f, recovering a panic.
+func (p *Pool) run(f func()) {
+	defer func() {
+		if r := recover(); r != nil && p.onPanic != nil {
+			p.onPanic(r, debug.Stack())
+		}
+	}()
+	f()
+}
+
+// Stats returns the current activity of p.
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return Stats{Workers: p.workers, Running: p.running, Queued: p.queued, Tenants: len(p.active)}
+}
+
+// Shutdown stops p from accepting tasks, and waits for the tasks queued
+// to run and the workers to return. If ctx is done first, Shutdown
+// returns ctx.Err(), and the workers go on with the tasks left in the
+// background.
+func (p *Pool) Shutdown(ctx context.Context) error {
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	select {
+	case <-p.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Done returns a channel that is closed once p has shut down and its
+// workers have returned.
+func (p *Pool) Done() <-chan struct{} { return p.done }
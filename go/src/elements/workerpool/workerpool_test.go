@@ -0,0 +1,159 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package workerpool_test
+
+import (
+	"context"
+	"elements/errs"
+	"elements/workerpool"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// A recorder is a Pool of one worker that holds it busy until release
+// is called, so that the tasks submitted meanwhile all queue up, and
+// records the tenants of the tasks in the order they run.
+type recorder struct {
+	p    *workerpool.Pool
+	hold chan struct{}
+
+	mu  sync.Mutex
+	ran []string
+}
+
+func newRecorder(t *testing.T, cfg workerpool.Config) *recorder {
+	cfg.Workers = 1
+	r := &recorder{p: workerpool.New(cfg), hold: make(chan struct{})}
+	t.Cleanup(func() { r.p.Shutdown(context.Background()) })
+	started := make(chan struct{})
+	r.p.Submit("hold", func() {
+		close(started)
+		<-r.hold
+	})
+	<-started
+	return r
+}
+
+func (r *recorder) submit(t *testing.T, tenant string, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		err := r.p.Submit(tenant, func() {
+			r.mu.Lock()
+			r.ran = append(r.ran, tenant)
+			r.mu.Unlock()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// order releases the worker, waits for every task, and returns the
+// tenants in the order their tasks ran.
+func (r *recorder) order() []string {
+	close(r.hold)
+	r.p.Shutdown(context.Background())
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.ran
+}
+
+func TestFairness(t *testing.T) {
+	r := newRecorder(t, workerpool.Config{})
+	r.submit(t, "noisy", 1000)
+	r.submit(t, "a", 3)
+	r.submit(t, "b", 3)
+	order := r.order()
+	if len(order) != 1006 {
+		t.Fatalf("%d tasks ran, want 1006", len(order))
+	}
+	// 轮流运行: 吵闹的租户排了1000个任务, 其他租户也只等它每轮一个
+	if got, want := strings.Join(order[:9], " "), "noisy a b noisy a b noisy a b"; got != want {
+		t.Errorf("the first tasks ran for %s, want %s", got, want)
+	}
+}
+
+func TestWeights(t *testing.T) {
+	r := newRecorder(t, workerpool.Config{})
+	r.p.SetWeight("gold", 3)
+	r.submit(t, "gold", 30)
+	r.submit(t, "free", 30)
+	order := r.order()
+	gold := 0
+	for _, tenant := range order[:20] {
+		if tenant == "gold" {
+			gold++
+		}
+	}
+	if gold != 15 {
+		t.Errorf("gold ran %d of the first 20 tasks, want 15 at a weight of 3 to 1", gold)
+	}
+	if order[len(order)-1] != "free" {
+		t.Error("gold did not finish first")
+	}
+}
+
+func TestQueueLimit(t *testing.T) {
+	r := newRecorder(t, workerpool.Config{QueueLimit: 2})
+	r.submit(t, "a", 2)
+	if err := r.p.Submit("a", func() {}); err != workerpool.ErrQueueFull || !errors.Is(err, errs.ErrCapacity) {
+		t.Fatalf("Submit beyond the limit = %v, want ErrQueueFull", err)
+	}
+	// 限制是每个租户的
+	r.submit(t, "b", 2)
+	if got := r.p.Stats(); got.Queued != 4 || got.Tenants != 2 || got.Running != 1 {
+		t.Errorf("Stats = %+v", got)
+	}
+	if n := len(r.order()); n != 4 {
+		t.Errorf("%d tasks ran, want 4", n)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	var panics int
+	p := workerpool.New(workerpool.Config{
+		Workers: 2,
+		OnPanic: func(interface{}, []byte) { panics++ },
+	})
+	var mu sync.Mutex
+	n := 0
+	for i := 0; i < 100; i++ {
+		p.Submit("a", func() {
+			mu.Lock()
+			n++
+			mu.Unlock()
+		})
+	}
+	p.Submit("b", func() { panic("boom") })
+	if err := p.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if n != 100 || panics != 1 {
+		t.Errorf("ran %d tasks and %d panics before Shutdown returned, want 100 and 1", n, panics)
+	}
+	if err := p.Submit("a", func() {}); err != workerpool.ErrClosed || !errors.Is(err, errs.ErrClosed) {
+		t.Errorf("Submit after Shutdown = %v, want ErrClosed", err)
+	}
+	select {
+	case <-p.Done():
+	default:
+		t.Error("Done not closed after Shutdown")
+	}
+}
+
+func BenchmarkSubmit(b *testing.B) {
+	p := workerpool.New(workerpool.Config{})
+	defer p.Shutdown(context.Background())
+	var wg sync.WaitGroup
+	tenants := []string{"a", "b", "c", "d"}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wg.Add(1)
+		p.Submit(tenants[i%len(tenants)], wg.Done)
+	}
+	wg.Wait()
+}
@@ -453,6 +453,48 @@ var pkgDeps = map[string][]string{
 	"net/http/pprof":    {"L4", "OS", "html/template", "net/http", "runtime/pprof", "runtime/trace"},
 	"net/rpc":           {"L4", "NET", "encoding/gob", "html/template", "net/http", "go/token"},
 	"net/rpc/jsonrpc":   {"L4", "NET", "encoding/json", "net/rpc"},
+
+	// go-elements: data structures and teaching models built on the above.
+	"elements/actor":         {"L0", "elements/future"},
+	"elements/atomicx":       {"L0", "math", "time"},
+	"elements/builder":       {"L1"},
+	"elements/cache":         {"L0", "context", "elements/clock", "elements/diag", "elements/errs", "elements/expiry", "elements/heap", "elements/intern", "elements/lifecycle", "elements/retry", "elements/singleflight", "time"},
+	"elements/chanmodel":     {"L0"},
+	"elements/chanx":         {"L0", "context", "elements/heap", "time"},
+	"elements/chaos":         {"L1", "time"},
+	"elements/clock":         {"L0", "time"},
+	"elements/coalesce":      {"L0", "context", "elements/clock", "elements/lifecycle", "time"},
+	"elements/diag":          {"L0", "sort"},
+	"elements/diag/diaghttp": {"L0", "elements/diag", "encoding/json", "net/http"},
+	"elements/dlock":         {"L0", "context", "crypto/rand", "elements/cache", "elements/errs", "encoding/hex", "time"},
+	"elements/errgroup":      {"L0", "context", "fmt"},
+	"elements/errs":          {"L0", "fmt"},
+	"elements/expiry":        {"L0", "context", "elements/clock", "elements/heap", "elements/lifecycle", "time"},
+	"elements/future":        {"L0", "context"},
+	"elements/gmp":           {"L1", "fmt", "strings"},
+	"elements/hamt":          {"L1"},
+	"elements/heap":          {"L1", "context", "elements/clock", "elements/errs", "time"},
+	"elements/httplimit":     {"L0", "context", "elements/semaphore", "net/http", "strconv", "time"},
+	"elements/initgraph":     {"L1", "context"},
+	"elements/intern":        {"L0", "strings"},
+	"elements/lifecycle":     {"L1", "context"},
+	"elements/list":          {"L0"},
+	"elements/mapmodel":      {"L1"},
+	"elements/mapsim":        {"L0", "fmt"},
+	"elements/metrics":       {"L1", "container/heap", "time"},
+	"elements/netpoll":       {"L2", "syscall", "time"},
+	"elements/registry":      {"L0", "reflect"},
+	"elements/retry":         {"L0", "context", "math/rand", "time"},
+	"elements/scheduler":     {"L0", "context", "elements/clock", "elements/lifecycle", "elements/timermodel", "runtime/debug", "strconv", "strings", "time"},
+	"elements/semaphore":     {"L0", "context", "elements/clock", "elements/diag", "elements/errs", "elements/list", "time"},
+	"elements/singleflight":  {"L0", "bytes", "fmt", "runtime/debug", "time"},
+	"elements/snowflake":     {"L0", "time"},
+	"elements/stm":           {"L0", "sort"},
+	"elements/stress":        {"L1", "fmt", "strings", "time"},
+	"elements/supervisor":    {"L0", "context", "elements/lifecycle", "fmt", "runtime/debug", "sort", "time"},
+	"elements/swap":          {"L0", "time"},
+	"elements/timermodel":    {"L0", "elements/clock", "time"},
+	"elements/workerpool":    {"L0", "context", "elements/errs", "elements/lifecycle", "runtime/debug"},
 }
 
 // isMacro reports whether p is a package dependency macro
@@ -233,6 +233,14 @@ func reflect_typehash(t *_type, p unsafe.Pointer, h uintptr) uintptr {
 	return typehash(t, p, h)
 }
 
+// sync_runtime_efaceHash hashes an interface value the way a
+// map[interface{}]T would. It is used by the sync package's
+// alternative Map backends.
+//go:linkname sync_runtime_efaceHash sync.runtime_efaceHash
+func sync_runtime_efaceHash(i interface{}, seed uintptr) uintptr {
+	return nilinterhash(noescape(unsafe.Pointer(&i)), seed)
+}
+
 func memequal0(p, q unsafe.Pointer) bool {
 	return true
 }
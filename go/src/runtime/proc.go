@@ -5328,6 +5328,14 @@ func sync_runtime_doSpin() {
 	procyield(active_spin_cnt)
 }
 
+// sync_runtime_goid returns the id of the calling goroutine. It is used
+// by the sync package's lock-order validator to key per-goroutine state.
+//go:linkname sync_runtime_goid sync.runtime_goid
+//go:nosplit
+func sync_runtime_goid() int64 {
+	return getg().goid
+}
+
 var stealOrder randomOrder
 
 // randomOrder/randomEnum are helper types for randomized work stealing.
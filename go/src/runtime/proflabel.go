@@ -38,3 +38,16 @@ func runtime_setProfLabel(labels unsafe.Pointer) {
 func runtime_getProfLabel() unsafe.Pointer {
 	return getg().labels
 }
+
+// sync.Map sets labels around its slow paths without importing
+// runtime/pprof; see sync/proflabel.go.
+
+//go:linkname sync_runtime_setProfLabel sync.runtime_setProfLabel
+func sync_runtime_setProfLabel(labels unsafe.Pointer) {
+	runtime_setProfLabel(labels)
+}
+
+//go:linkname sync_runtime_getProfLabel sync.runtime_getProfLabel
+func sync_runtime_getProfLabel() unsafe.Pointer {
+	return getg().labels
+}
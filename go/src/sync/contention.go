@@ -0,0 +1,223 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"runtime"
+	"sync/atomic"
+)
+
+// ContentionBuckets is the number of wait-time buckets kept per call site.
+// Bucket i counts waits of [2^i, 2^(i+1)) nanoseconds; the last bucket also
+// counts every longer wait.
+const ContentionBuckets = 40
+
+// A ContentionProfile records how long goroutines wait to acquire the
+// mutexes that report to it, grouped by lock name and by the call site that
+// asked for the lock.
+//
+// A ProfiledMutex reports to the profile in its Profile field; a Map reports
+// the acquisitions of its internal mutex once SetContentionProfile has been
+// called, attributing each one to the code that called the Map method.
+//
+// The zero ContentionProfile records every acquisition and is ready for use.
+type ContentionProfile struct {
+	// Rate is the sampling rate: on average one in Rate acquisitions is
+	// recorded. A Rate of 0 or 1 records every acquisition.
+	// Rate must not be changed once the profile is in use.
+	Rate int
+
+	sites Map // contentionKey -> *contentionSite
+}
+
+type contentionKey struct {
+	lock     string
+	function string
+	file     string
+	line     int
+}
+
+type contentionSite struct {
+	pc           uintptr
+	acquisitions int64
+	contended    int64
+	wait         int64
+	buckets      [ContentionBuckets]int64
+}
+
+// A ContentionSite summarizes the sampled acquisitions of one lock from one
+// call site.
+type ContentionSite struct {
+	Lock     string  // name of the lock
+	PC       uintptr // program counter of the call that acquired the lock
+	Function string  // function containing PC
+	File     string  // source file containing PC
+	Line     int     // line containing PC
+
+	Acquisitions int64 // sampled acquisitions
+	Contended    int64 // sampled acquisitions that had to wait
+	Wait         int64 // total nanoseconds spent waiting
+
+	// Buckets is a histogram of the contended waits: Buckets[i] counts
+	// waits of [2^i, 2^(i+1)) nanoseconds.
+	Buckets [ContentionBuckets]int64
+}
+
+// Labels returns the site as alternating label keys and values, in the form
+// accepted by runtime/pprof.Labels, so that profiles taken while a hot site
+// is being worked on can be attributed to it.
+func (s *ContentionSite) Labels() []string {
+	return []string{"lock", s.Lock, "site", s.Function}
+}
+
+// Report returns one ContentionSite per recorded call site, ordered by
+// total wait time, longest first.
+func (p *ContentionProfile) Report() []ContentionSite {
+	var r []ContentionSite
+	p.sites.Range(func(k, v interface{}) bool {
+		key, s := k.(contentionKey), v.(*contentionSite)
+		cs := ContentionSite{
+			Lock:         key.lock,
+			PC:           s.pc,
+			Function:     key.function,
+			File:         key.file,
+			Line:         key.line,
+			Acquisitions: atomic.LoadInt64(&s.acquisitions),
+			Contended:    atomic.LoadInt64(&s.contended),
+			Wait:         atomic.LoadInt64(&s.wait),
+		}
+		for i := range s.buckets {
+			cs.Buckets[i] = atomic.LoadInt64(&s.buckets[i])
+		}
+		r = append(r, cs)
+		return true
+	})
+	// Insertion sort: this package cannot depend on sort.
+	for i := 1; i < len(r); i++ {
+		for j := i; j > 0 && r[j].Wait > r[j-1].Wait; j-- {
+			r[j], r[j-1] = r[j-1], r[j]
+		}
+	}
+	return r
+}
+
+// Reset discards everything recorded so far.
+func (p *ContentionProfile) Reset() {
+	p.sites.Range(func(k, _ interface{}) bool {
+		p.sites.Delete(k)
+		return true
+	})
+}
+
+// sample reports whether the next acquisition should be recorded.
+func (p *ContentionProfile) sample() bool {
+	return p.Rate <= 1 || fastrand()%uint32(p.Rate) == 0
+}
+
+// site returns the record of the acquisitions of the lock called name from
+// the call site f. It looks the site up in p.sites, a Map of its own, so it
+// must be called before the lock is acquired: the lock of a profiled Map is
+// a leaf, and lockorder builds panic if p.sites is locked while it is held.
+func (p *ContentionProfile) site(name string, f runtime.Frame) *contentionSite {
+	key := contentionKey{lock: name, function: f.Function, file: f.File, line: f.Line}
+	v, ok := p.sites.Load(key)
+	if !ok {
+		v, _ = p.sites.LoadOrStore(key, &contentionSite{pc: f.PC})
+	}
+	return v.(*contentionSite)
+}
+
+// lockSampled acquires mu and records the acquisition in s. The caller
+// resolves s before calling so that the critical section is not lengthened
+// by the stack walk or the lookup of the site.
+func lockSampled(mu *Mutex, s *contentionSite) {
+	// 先尝试不等待地获取锁, 成功说明这次获取没有竞争,
+	// 失败才计时, 统计真正阻塞等待的时间
+	var wait int64
+	contended := !mu.tryLock()
+	if contended {
+		start := runtime_nanotime()
+		mu.Lock()
+		wait = runtime_nanotime() - start
+	}
+
+	// 持有锁期间只做原子加法
+	atomic.AddInt64(&s.acquisitions, 1)
+	if contended {
+		atomic.AddInt64(&s.contended, 1)
+		atomic.AddInt64(&s.wait, wait)
+		i := 0
+		for w := wait >> 1; w > 0 && i < ContentionBuckets-1; w >>= 1 {
+			i++
+		}
+		atomic.AddInt64(&s.buckets[i], 1)
+	}
+}
+
+// callerFrame returns the frame skip levels above its caller.
+func callerFrame(skip int) runtime.Frame {
+	var pc [1]uintptr
+	runtime.Callers(skip+2, pc[:])
+	f, _ := runtime.CallersFrames(pc[:]).Next()
+	return f
+}
+
+// mapCallerFrame returns the innermost frame on the stack that does not
+// belong to a method of Map: the code that called into the Map. It must be
+// called from a method of Map.
+func mapCallerFrame() runtime.Frame {
+	var pcs [16]uintptr
+	n := runtime.Callers(2, pcs[:])
+	frames := runtime.CallersFrames(pcs[:n])
+	// 第一帧就是Map的某个方法, 用它的名字得到"包路径.(*Map)."前缀,
+	// 跳过所有带这个前缀的帧 (方法可能被内联, 所以不能按固定层数跳过)
+	f, more := frames.Next()
+	prefix := f.Function
+	if i := lastIndexByte(prefix, '.'); i >= 0 {
+		prefix = prefix[:i+1]
+	}
+	for more {
+		f, more = frames.Next()
+		if len(f.Function) < len(prefix) || f.Function[:len(prefix)] != prefix {
+			return f
+		}
+	}
+	return f
+}
+
+func lastIndexByte(s string, c byte) int {
+	for i := len(s) - 1; i >= 0; i-- {
+		if s[i] == c {
+			return i
+		}
+	}
+	return -1
+}
+
+// A ProfiledMutex is a Mutex whose acquisitions are sampled into Profile,
+// attributed to the caller of Lock. A nil Profile records nothing.
+//
+// Name and Profile must be set before first use. A ProfiledMutex must not be
+// copied after first use.
+type ProfiledMutex struct {
+	Name    string
+	Profile *ContentionProfile
+
+	mu Mutex
+}
+
+// Lock locks m.
+func (m *ProfiledMutex) Lock() {
+	if p := m.Profile; p != nil && p.sample() {
+		lockSampled(&m.mu, p.site(m.Name, callerFrame(1)))
+		return
+	}
+	m.mu.Lock()
+}
+
+// Unlock unlocks m.
+func (m *ProfiledMutex) Unlock() {
+	m.mu.Unlock()
+}
@@ -0,0 +1,76 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"strings"
+	. "sync"
+	"testing"
+	"time"
+)
+
+func TestProfiledMutexContention(t *testing.T) {
+	var p ContentionProfile
+	m := &ProfiledMutex{Name: "test", Profile: &p}
+
+	m.Lock() // uncontended
+	done := make(chan struct{})
+	go func() {
+		m.Lock() // contended: waits for the sleep below
+		m.Unlock()
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	m.Unlock()
+	<-done
+
+	var acq, contended int64
+	var wait int64
+	for _, s := range p.Report() {
+		if s.Lock != "test" {
+			t.Errorf("site %s has lock name %q, want %q", s.Function, s.Lock, "test")
+		}
+		if !strings.Contains(s.Function, "TestProfiledMutexContention") {
+			t.Errorf("site attributed to %s, want the test function", s.Function)
+		}
+		acq += s.Acquisitions
+		contended += s.Contended
+		wait += s.Wait
+	}
+	if acq != 2 || contended != 1 {
+		t.Fatalf("got %d acquisitions, %d contended; want 2, 1", acq, contended)
+	}
+	if wait < int64(5*time.Millisecond) {
+		t.Errorf("recorded wait %v, want at least 5ms", time.Duration(wait))
+	}
+
+	p.Reset()
+	if r := p.Report(); len(r) != 0 {
+		t.Errorf("Report after Reset returned %d sites", len(r))
+	}
+}
+
+func TestMapContentionProfile(t *testing.T) {
+	var p ContentionProfile
+	var m Map
+	m.SetContentionProfile(&p)
+	for i := 0; i < 10; i++ {
+		m.Store(i, i) // new keys always take the slow path
+	}
+	r := p.Report()
+	if len(r) != 1 {
+		t.Fatalf("got %d sites, want 1: %+v", len(r), r)
+	}
+	s := r[0]
+	if s.Lock != "sync.Map" || s.Acquisitions != 10 {
+		t.Errorf("got lock %q with %d acquisitions, want %q with 10", s.Lock, s.Acquisitions, "sync.Map")
+	}
+	if !strings.Contains(s.Function, "TestMapContentionProfile") {
+		t.Errorf("site attributed to %s, want the test function", s.Function)
+	}
+	if l := s.Labels(); len(l) != 4 || l[1] != "sync.Map" {
+		t.Errorf("Labels() = %q", l)
+	}
+}
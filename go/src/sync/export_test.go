@@ -4,12 +4,17 @@
 
 package sync
 
+import "sync/atomic"
+
 // Export for testing.
 var Runtime_Semacquire = runtime_Semacquire
 var Runtime_Semrelease = runtime_Semrelease
 var Runtime_procPin = runtime_procPin
 var Runtime_procUnpin = runtime_procUnpin
 
+// LockorderEnabled reports whether the lockorder build tag is set.
+const LockorderEnabled = lockorderEnabled
+
 // poolDequeue testing.
 type PoolDequeue interface {
 	PushHead(val interface{}) bool
@@ -55,3 +60,51 @@ func (c *poolChain) PopHead() (interface{}, bool) {
 func (c *poolChain) PopTail() (interface{}, bool) {
 	return c.popTail()
 }
+
+// LockMap and UnlockMap acquire and release the mutex guarding m's dirty
+// map, so that tests can exercise the paths taken when it is contended.
+func LockMap(m *Map)   { m.lock(MapOpStore) }
+func UnlockMap(m *Map) { m.unlock() }
+
+// ProfLabel returns the profiler labels of the calling goroutine.
+func ProfLabel() uintptr { return uintptr(runtime_getProfLabel()) }
+
+// AwaitReplica waits until no dirty map of m is being built in the
+// background.
+func AwaitReplica(m *Map) {
+	m.lock(mapOpReplica)
+	m.awaitReplicaLocked(mapOpReplica)
+	m.unlock()
+}
+
+// SpinEstimate returns the estimate of WithSpinWait, in whole rounds, after
+// a slow-path Load for each of rounds, starting from 0: one that got the
+// mutex after that many rounds, or one that gave up for a negative count.
+func SpinEstimate(rounds ...int) int {
+	var est int32
+	for _, i := range rounds {
+		if i < 0 {
+			est = spinEstFallback(est)
+		} else {
+			est = spinEstAcquired(est, int32(i))
+		}
+	}
+	return int(est / spinEstScale)
+}
+
+// SetPromoteHook makes every promotion of a Map, and every ReplaceAll, call
+// f with the mutex held, after the pending deletes are drained and before
+// the new read map is stored. A nil f removes the hook.
+func SetPromoteHook(f func(m *Map)) { testHookPromote = f }
+
+// DeferDelete runs the part of Delete taken when the mutex is held by
+// someone else, and reports whether the delete of key was left to the next
+// holder of the mutex. It returns false if the key is not dirty-only.
+func DeferDelete(m *Map, key interface{}) bool {
+	gen := atomic.LoadUint32(&m.promoGen)
+	read, _ := m.read.Load().(readOnly)
+	if _, ok := read.m.load(key); ok || !read.amended {
+		return false
+	}
+	return m.deferDelete(key, gen)
+}
@@ -0,0 +1,177 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import "unsafe"
+
+// A Hasher hashes the keys of a Map that uses OpenAddressingBackend or
+// SwissTableBackend. By default those backends hash keys with the runtime's
+// map hash under a per-table random seed; a Hasher lets callers whose keys may
+// be chosen by an adversary pick and control the seed themselves.
+//
+// Hash must return equal hashes for equal keys, must panic for keys that are
+// not comparable, and must be safe for concurrent use.
+type Hasher interface {
+	Hash(key interface{}) uint64
+}
+
+// WithHasher makes the Map hash its keys with h. It has no effect on Maps
+// using BuiltinBackend, whose built-in maps always use the runtime's hash.
+func WithHasher(h Hasher) MapOption {
+	return func(m *Map) {
+		m.hasher = h
+	}
+}
+
+// MaphashHasher hashes keys with the runtime's map hash, as hash/maphash
+// does, under a fixed seed. The hashes are only stable within one process.
+type MaphashHasher struct {
+	seed uintptr
+}
+
+// NewMaphashHasher returns a MaphashHasher with a random seed.
+func NewMaphashHasher() *MaphashHasher {
+	seed := uintptr(fastrand())
+	if unsafe.Sizeof(seed) == 8 {
+		seed = seed<<32 | uintptr(fastrand())
+	}
+	return &MaphashHasher{seed: seed}
+}
+
+// Hash returns the hash of key.
+func (h *MaphashHasher) Hash(key interface{}) uint64 {
+	return uint64(runtime_efaceHash(key, h.seed))
+}
+
+// XXHasher hashes keys with XXH64 under a caller-chosen seed, so string and
+// integer keys hash the same way in every process and on every platform.
+// Keys of other types fall back to the runtime's map hash, seeded from the
+// same seed.
+type XXHasher struct {
+	Seed uint64
+}
+
+// NewXXHasher returns an XXHasher using seed.
+func NewXXHasher(seed uint64) *XXHasher {
+	return &XXHasher{Seed: seed}
+}
+
+// Hash returns the hash of key.
+func (h *XXHasher) Hash(key interface{}) uint64 {
+	var buf [8]byte
+	switch k := key.(type) {
+	case string:
+		return xxhash64(k, h.Seed)
+	case int:
+		putUint64(buf[:], uint64(k))
+	case int64:
+		putUint64(buf[:], uint64(k))
+	case int32:
+		putUint64(buf[:], uint64(k))
+	case uint:
+		putUint64(buf[:], uint64(k))
+	case uint64:
+		putUint64(buf[:], k)
+	case uint32:
+		putUint64(buf[:], uint64(k))
+	case uintptr:
+		putUint64(buf[:], uint64(k))
+	default:
+		return uint64(runtime_efaceHash(key, uintptr(h.Seed)))
+	}
+	return xxhash64(string(buf[:]), h.Seed)
+}
+
+func putUint64(b []byte, v uint64) {
+	_ = b[7]
+	b[0] = byte(v)
+	b[1] = byte(v >> 8)
+	b[2] = byte(v >> 16)
+	b[3] = byte(v >> 24)
+	b[4] = byte(v >> 32)
+	b[5] = byte(v >> 40)
+	b[6] = byte(v >> 48)
+	b[7] = byte(v >> 56)
+}
+
+func getUint64(b string) uint64 {
+	_ = b[7]
+	return uint64(b[0]) | uint64(b[1])<<8 | uint64(b[2])<<16 | uint64(b[3])<<24 |
+		uint64(b[4])<<32 | uint64(b[5])<<40 | uint64(b[6])<<48 | uint64(b[7])<<56
+}
+
+func getUint32(b string) uint32 {
+	_ = b[3]
+	return uint32(b[0]) | uint32(b[1])<<8 | uint32(b[2])<<16 | uint32(b[3])<<24
+}
+
+const (
+	xxPrime1 uint64 = 11400714785074694791
+	xxPrime2 uint64 = 14029467366897019727
+	xxPrime3 uint64 = 1609587929392839161
+	xxPrime4 uint64 = 9650029242287828579
+	xxPrime5 uint64 = 2870177450012600261
+)
+
+func rotl64(x uint64, k uint) uint64 {
+	return x<<k | x>>(64-k)
+}
+
+func xxRound(acc, input uint64) uint64 {
+	acc += input * xxPrime2
+	return rotl64(acc, 31) * xxPrime1
+}
+
+func xxMerge(acc, v uint64) uint64 {
+	acc ^= xxRound(0, v)
+	return acc*xxPrime1 + xxPrime4
+}
+
+// xxhash64 returns the XXH64 hash of b under seed.
+func xxhash64(b string, seed uint64) uint64 {
+	n := len(b)
+	var h uint64
+	if n >= 32 {
+		v1 := seed + xxPrime1 + xxPrime2
+		v2 := seed + xxPrime2
+		v3 := seed
+		v4 := seed - xxPrime1
+		for ; len(b) >= 32; b = b[32:] {
+			v1 = xxRound(v1, getUint64(b[0:]))
+			v2 = xxRound(v2, getUint64(b[8:]))
+			v3 = xxRound(v3, getUint64(b[16:]))
+			v4 = xxRound(v4, getUint64(b[24:]))
+		}
+		h = rotl64(v1, 1) + rotl64(v2, 7) + rotl64(v3, 12) + rotl64(v4, 18)
+		h = xxMerge(h, v1)
+		h = xxMerge(h, v2)
+		h = xxMerge(h, v3)
+		h = xxMerge(h, v4)
+	} else {
+		h = seed + xxPrime5
+	}
+	h += uint64(n)
+
+	for ; len(b) >= 8; b = b[8:] {
+		h ^= xxRound(0, getUint64(b))
+		h = rotl64(h, 27)*xxPrime1 + xxPrime4
+	}
+	if len(b) >= 4 {
+		h ^= uint64(getUint32(b)) * xxPrime1
+		h = rotl64(h, 23)*xxPrime2 + xxPrime3
+		b = b[4:]
+	}
+	for i := 0; i < len(b); i++ {
+		h ^= uint64(b[i]) * xxPrime5
+		h = rotl64(h, 11) * xxPrime1
+	}
+
+	h ^= h >> 33
+	h *= xxPrime2
+	h ^= h >> 29
+	h *= xxPrime3
+	h ^= h >> 32
+	return h
+}
@@ -0,0 +1,75 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"sync"
+	"testing"
+	"testing/quick"
+)
+
+func TestXXHasherVectors(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		seed uint64
+		want uint64
+	}{
+		{"", 0, 0xef46db3751d8e999},
+		{"a", 0, 0xd24ec4f1a98c6e5b},
+		{"abc", 0, 0x44bc2cf5ad770999},
+	} {
+		if got := sync.NewXXHasher(tt.seed).Hash(tt.in); got != tt.want {
+			t.Errorf("XXH64(%q, %d) = %#x, want %#x", tt.in, tt.seed, got, tt.want)
+		}
+	}
+}
+
+func TestXXHasherLongInput(t *testing.T) {
+	// Inputs of 32 bytes or more go through the four-lane loop; check that
+	// the hash depends on every byte and on the seed.
+	b := make([]byte, 100)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	h := sync.NewXXHasher(1)
+	base := h.Hash(string(b))
+	for i := range b {
+		b[i]++
+		if h.Hash(string(b)) == base {
+			t.Errorf("hash unchanged after modifying byte %d", i)
+		}
+		b[i]--
+	}
+	if sync.NewXXHasher(2).Hash(string(b)) == base {
+		t.Errorf("hash unchanged after changing the seed")
+	}
+}
+
+// collidingHasher hashes every key to the same value, the worst case an
+// adversary can force on a table.
+type collidingHasher struct{}
+
+func (collidingHasher) Hash(key interface{}) uint64 { return 42 }
+
+func TestMapHashersMatchRWMutex(t *testing.T) {
+	hashers := map[string]sync.Hasher{
+		"maphash":   sync.NewMaphashHasher(),
+		"xxhash":    sync.NewXXHasher(0x9e3779b97f4a7c15),
+		"colliding": collidingHasher{},
+	}
+	for _, b := range mapBackends {
+		for name, h := range hashers {
+			b, h := b, h
+			t.Run(b.String()+"/"+name, func(t *testing.T) {
+				apply := func(calls []mapCall) ([]mapResult, map[interface{}]interface{}) {
+					return applyCalls(sync.NewMap(sync.WithBackend(b), sync.WithHasher(h)), calls)
+				}
+				if err := quick.CheckEqual(apply, applyRWMutexMap, nil); err != nil {
+					t.Error(err)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// A LockLevel is a named rank in a lock hierarchy.
+//
+// In builds with the lockorder build tag, every acquisition of an
+// OrderedMutex, and of the mutex internal to every Map, is checked against
+// the ordered locks already held by the calling goroutine: a lock may only be
+// acquired if its rank is strictly greater than the rank of every ordered
+// lock that goroutine holds. A violation panics, naming both locks, at the
+// point where the inverted acquisition happens rather than at the point where
+// two goroutines finally deadlock.
+//
+// Without the lockorder tag the checks compile away and OrderedMutex costs
+// the same as Mutex.
+type LockLevel struct {
+	name string
+	rank int
+}
+
+// mapLockRank is the rank of MapLockLevel. No user level may reach it.
+const mapLockRank = int(^uint(0) >> 1)
+
+// MapLockLevel is the level of the mutex internal to every Map.
+//
+// It is the highest possible rank, which makes a Map's mutex a leaf in the
+// hierarchy: any ordered lock acquired while a Map's mutex is held, for
+// example by a callback that the Map runs on its slow path, is reported as a
+// violation.
+var MapLockLevel = &LockLevel{name: "sync.Map", rank: mapLockRank}
+
+// NewLockLevel returns a LockLevel with the given name and rank.
+// Locks with lower ranks must be acquired before locks with higher ranks.
+// NewLockLevel panics if rank is not below the rank of MapLockLevel.
+func NewLockLevel(name string, rank int) *LockLevel {
+	if rank >= mapLockRank {
+		panic("sync: lock rank " + name + " must be below MapLockLevel")
+	}
+	return &LockLevel{name: name, rank: rank}
+}
+
+// Name returns the name l was created with.
+func (l *LockLevel) Name() string { return l.name }
+
+// Rank returns the rank l was created with.
+func (l *LockLevel) Rank() int { return l.rank }
+
+// An OrderedMutex is a Mutex that takes part in lock-order validation.
+//
+// Level must be set before the first call to Lock and must not change
+// afterwards. An OrderedMutex with a nil Level is an ordinary, unchecked
+// mutex. In lockorder builds an OrderedMutex must be unlocked by the
+// goroutine that locked it.
+//
+// An OrderedMutex must not be copied after first use.
+type OrderedMutex struct {
+	Level *LockLevel
+
+	mu Mutex
+}
+
+// Lock locks m. In lockorder builds it first panics if the calling goroutine
+// holds an ordered lock whose rank is not below m.Level.
+func (m *OrderedMutex) Lock() {
+	if lockorderEnabled && m.Level != nil {
+		lockorderAcquire(m.Level)
+	}
+	m.mu.Lock()
+}
+
+// Unlock unlocks m.
+func (m *OrderedMutex) Unlock() {
+	m.mu.Unlock()
+	if lockorderEnabled && m.Level != nil {
+		lockorderRelease(m.Level)
+	}
+}
@@ -0,0 +1,15 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build !lockorder
+
+package sync
+
+const lockorderEnabled = false
+
+func lockorderAcquire(l *LockLevel) {
+}
+
+func lockorderRelease(l *LockLevel) {
+}
@@ -0,0 +1,65 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build lockorder
+
+package sync
+
+const lockorderEnabled = true
+
+// lockorderState records the ordered locks each goroutine currently holds,
+// in acquisition order. It is guarded by a plain Mutex, which is itself
+// never validated.
+var lockorderState struct {
+	mu   Mutex
+	held map[int64][]*LockLevel
+}
+
+// lockorderAcquire panics if the calling goroutine holds an ordered lock whose
+// rank is not below l's rank, and otherwise records l as held.
+func lockorderAcquire(l *LockLevel) {
+	gid := runtime_goid()
+	s := &lockorderState
+	s.mu.Lock()
+	held := s.held[gid]
+	for _, h := range held {
+		if h.rank >= l.rank {
+			s.mu.Unlock()
+			panic("sync: lock order violation: acquiring " + l.describe() + " while holding " + h.describe())
+		}
+	}
+	if s.held == nil {
+		s.held = make(map[int64][]*LockLevel)
+	}
+	s.held[gid] = append(held, l)
+	s.mu.Unlock()
+}
+
+// lockorderRelease forgets the most recent acquisition of l by the calling
+// goroutine. Locks may be released in any order.
+func lockorderRelease(l *LockLevel) {
+	gid := runtime_goid()
+	s := &lockorderState
+	s.mu.Lock()
+	held := s.held[gid]
+	for i := len(held) - 1; i >= 0; i-- {
+		if held[i] == l {
+			held = append(held[:i], held[i+1:]...)
+			break
+		}
+	}
+	if len(held) == 0 {
+		delete(s.held, gid)
+	} else {
+		s.held[gid] = held
+	}
+	s.mu.Unlock()
+}
+
+func (l *LockLevel) describe() string {
+	if l.rank == mapLockRank {
+		return l.name + " (leaf)"
+	}
+	return l.name + " (rank " + itoa(l.rank) + ")"
+}
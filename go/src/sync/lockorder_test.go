@@ -0,0 +1,76 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"strings"
+	. "sync"
+	"testing"
+)
+
+func TestOrderedMutexInOrder(t *testing.T) {
+	outer := &OrderedMutex{Level: NewLockLevel("outer", 1)}
+	inner := &OrderedMutex{Level: NewLockLevel("inner", 2)}
+	var m Map
+
+	outer.Lock()
+	inner.Lock()
+	m.Store("k", "v") // a Map's mutex is a leaf and may be taken last
+	inner.Unlock()
+	outer.Unlock()
+
+	// Releasing out of order is allowed.
+	outer.Lock()
+	inner.Lock()
+	outer.Unlock()
+	inner.Unlock()
+}
+
+func TestOrderedMutexInversion(t *testing.T) {
+	if !LockorderEnabled {
+		t.Skip("lock-order validation requires the lockorder build tag")
+	}
+	outer := &OrderedMutex{Level: NewLockLevel("outer", 1)}
+	inner := &OrderedMutex{Level: NewLockLevel("inner", 2)}
+
+	inner.Lock()
+	defer inner.Unlock()
+	defer func() {
+		r := recover()
+		if r == nil {
+			t.Fatal("acquiring outer while holding inner did not panic")
+		}
+		msg, _ := r.(string)
+		if !strings.Contains(msg, "outer (rank 1)") || !strings.Contains(msg, "inner (rank 2)") {
+			t.Fatalf("panic message %q does not name both locks", msg)
+		}
+	}()
+	outer.Lock()
+}
+
+func TestOrderedMutexPerGoroutine(t *testing.T) {
+	outer := &OrderedMutex{Level: NewLockLevel("outer", 1)}
+	inner := &OrderedMutex{Level: NewLockLevel("inner", 2)}
+
+	// Locks held by one goroutine do not constrain another.
+	inner.Lock()
+	done := make(chan struct{})
+	go func() {
+		outer.Lock()
+		outer.Unlock()
+		close(done)
+	}()
+	<-done
+	inner.Unlock()
+}
+
+func TestNewLockLevelMapRank(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("NewLockLevel at MapLockLevel's rank did not panic")
+		}
+	}()
+	NewLockLevel("too-high", MapLockLevel.Rank())
+}
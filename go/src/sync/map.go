@@ -25,7 +25,12 @@ import (
 //
 // The zero Map is empty and ready for use. A Map must not be copied after first use.
 type Map struct {
-	mu Mutex
+	// The fields are grouped by how they are accessed, and the groups are
+	// padded onto separate cache lines: read, prof and backend are loaded by
+	// every call but almost never written; misses is written by every Load
+	// that misses read; mu and the fields it guards are written on every slow
+	// path. Without the padding, a Load on one core and a Store of a new key
+	// on another keep invalidating each other's copy of read.
 
 	// read contains the portion of the map's contents that are safe for
 	// concurrent access (with or without mu held).
@@ -38,6 +43,86 @@ type Map struct {
 	// map and unexpunged with mu held.
 	read atomic.Value // readOnly
 
+	// prof, if non-nil, records how long the slow paths wait for mu.
+	prof *ContentionProfile
+
+	// backend selects the index type of new dirty maps. It is set by NewMap
+	// and never changes.
+	backend MapBackend
+
+	// hasher, if non-nil, hashes keys for backends other than BuiltinBackend.
+	// It is set by NewMap and never changes.
+	hasher Hasher
+
+	// paddedEntries makes newEntryLocked give each entry a cache line of its
+	// own. It is set by NewMap and never changes.
+	paddedEntries bool
+
+	// entryStats makes newEntryLocked allocate statsEntries, and the
+	// accessors update their counters. It is set by NewMap and never
+	// changes.
+	entryStats bool
+
+	// hook, if non-nil, is called after each internal transition. It is set
+	// by NewMap and never changes.
+	hook func(MapEvent)
+
+	// rec, if non-nil, keeps the last operations. It is set by NewMap and
+	// never changes.
+	rec *flightRecorder
+
+	// labels, if non-nil, names the Map for profilers. It is set by NewMap
+	// and never changes.
+	labels *mapLabels
+
+	// compress, if non-nil, compresses large values. It is set by NewMap
+	// and never changes.
+	compress *valueCompression
+
+	// index, if non-nil, is the secondary index of WithIndex. It is set by
+	// NewMap and never changes.
+	index *mapIndex
+
+	// replicas makes promotions build the next dirty map in the
+	// background; see map_replica.go. It is set by NewMap and never
+	// changes.
+	replicas bool
+
+	// spin, if non-nil, makes the slow path of Load spin for mu before it
+	// parks; see map_spin.go. It is set by NewMap and never changes.
+	spin *mapSpin
+
+	// workload, if non-nil, counts the operations for Profile; see
+	// map_profile.go. It is set by NewMap and never changes.
+	workload *mapWorkload
+
+	// snap, if non-nil, is the *mapSnapshot of the running WriteSnapshot,
+	// which writers must tell about changes to entries. It is accessed
+	// atomically; see map_snapshot.go.
+	snap unsafe.Pointer
+
+	_ [cacheLinePad - unsafe.Sizeof(mapReadMostly{})%cacheLinePad]byte
+
+	// misses counts the number of loads since the read map was last updated that
+	// needed to lock mu to determine whether the key was present.
+	//
+	// Once enough misses have occurred to cover the cost of copying the dirty
+	// map, the dirty map will be promoted to the read map (in the unamended
+	// state) and the next store to the map will make a new dirty copy.
+	misses int
+
+	// pendingDeletes is a stack of *deleteNode recorded by Deletes that
+	// found mu held, applied by the next holder of mu. promoGen is
+	// incremented at the start and at the end of every promotion, so it
+	// is odd while one is in progress. Both are accessed atomically; see
+	// map_delete.go.
+	pendingDeletes unsafe.Pointer
+	promoGen       uint32
+
+	_ [cacheLinePad - unsafe.Sizeof(mapMissFields{})%cacheLinePad]byte
+
+	mu Mutex
+
 	// dirty contains the portion of the map's contents that require mu to be
 	// held. To ensure that the dirty map can be promoted to the read map quickly,
 	// it also includes all of the non-expunged entries in the read map.
@@ -48,21 +133,77 @@ type Map struct {
 	//
 	// If the dirty map is nil, the next write to the map will initialize it by
 	// making a shallow copy of the clean map, omitting stale entries.
-	dirty map[interface{}]*entry
+	dirty entries
 
-	// misses counts the number of loads since the read map was last updated that
-	// needed to lock mu to determine whether the key was present.
-	//
-	// Once enough misses have occurred to cover the cost of copying the dirty
-	// map, the dirty map will be promoted to the read map (in the unamended
-	// state) and the next store to the map will make a new dirty copy.
-	misses int
+	// promo is the state the promotion policy decides on. It is guarded
+	// by mu.
+	promo promotionState
+
+	// replica, if non-nil, is the dirty map being built in the background
+	// by WithReadReplica. It is guarded by mu.
+	replica *replicaBuild
+
+	// policy decides when the dirty map is promoted; nil means
+	// AdaptivePromotion. It is set by NewMap and never changes.
+	policy PromotionPolicy
+
+	// sizeHint is the number of keys WithTuningProfile expects the map to
+	// hold. It is set by NewMap and never changes.
+	sizeHint int
+
+	// slabs holds entries allocated but not yet handed out by
+	// newEntryLocked. It is guarded by mu.
+	slabs entrySlabs
+
+	// snapMu serializes WriteSnapshots.
+	snapMu Mutex
+
+	// initMu guards inits, the calls of GetOrCreate running init, by key.
+	initMu Mutex
+	inits  map[interface{}]*initCall
+
+	// prevLabels holds the profiler labels the goroutine holding mu had
+	// before lock set the Map's, for unlock to restore. It is guarded by mu.
+	prevLabels unsafe.Pointer
+}
+
+// cacheLinePad is the distance kept between fields written by different
+// cores. It prevents false sharing on widespread platforms with
+// 128 mod (cache line size) = 0, as in poolLocal.
+const cacheLinePad = 128
+
+// mapReadMostly mirrors the leading, read-mostly fields of Map so that the
+// padding after them can be computed.
+type mapReadMostly struct {
+	read          atomic.Value
+	prof          *ContentionProfile
+	backend       MapBackend
+	hasher        Hasher
+	paddedEntries bool
+	entryStats    bool
+	hook          func(MapEvent)
+	rec           *flightRecorder
+	labels        *mapLabels
+	compress      *valueCompression
+	index         *mapIndex
+	replicas      bool
+	spin          *mapSpin
+	workload      *mapWorkload
+	snap          unsafe.Pointer
+}
+
+// mapMissFields mirrors the fields of Map between the first two paddings.
+type mapMissFields struct {
+	misses         int
+	pendingDeletes unsafe.Pointer
+	promoGen       uint32
 }
 
 // readOnly is an immutable struct stored atomically in the Map.read field.
 type readOnly struct {
-	m       map[interface{}]*entry // 存放readonly的map, 初始时为ni;
-	amended bool                   // true if the dirty map contains some key not in m.
+	m       entries   // 存放readonly的map, 初始时为nil;
+	amended bool      // true if the dirty map contains some key not in m.
+	bloom   *mapBloom // the filter of WithBloomFilter, shared with the dirty map
 }
 
 // expunged is an arbitrary pointer that marks entries which have been deleted
@@ -92,21 +233,106 @@ type entry struct {
 	p unsafe.Pointer // *interface{}
 }
 
-func newEntry(i interface{}) *entry {
-	return &entry{p: unsafe.Pointer(&i)}
+// maxEntrySlab is the largest number of entries newEntryLocked allocates
+// at once.
+const maxEntrySlab = 64
+
+// newEntryLocked returns a new entry holding *i. m.mu must be held.
+//
+// Entries are carved out of slabs rather than allocated one at a time, which
+// turns the per-key allocation of a Store into one allocation per slab. An
+// entry is never recycled for another key: a goroutine that found it in a
+// read map, or in the dirty map just before releasing mu, may still load
+// from it after the key is deleted, and a reused entry would hand that
+// goroutine another key's value. A slab is freed once none of its entries is
+// reachable.
+func (m *Map) newEntryLocked(i *interface{}) *entry {
+	return m.slabs.next(m, slabSize(m.dirtyCapacity(m.dirty.len())), i)
+}
+
+// entrySlabs are the slabs that the entries of a Map are carved out of, one
+// for each kind of entry.
+type entrySlabs struct {
+	plain  []entry
+	padded []paddedEntry
+	stats  []statsEntry
+}
+
+// next returns a new entry of m holding *i, allocating a slab of size
+// entries when the slab of its kind is used up.
+func (s *entrySlabs) next(m *Map, size int, i *interface{}) *entry {
+	var e *entry
+	if m.entryStats {
+		// statsEntry本身已经占满cache line, 不需要再看paddedEntries
+		if len(s.stats) == 0 {
+			s.stats = make([]statsEntry, size)
+		}
+		e = &s.stats[0].entry
+		s.stats = s.stats[1:]
+	} else if m.paddedEntries {
+		if len(s.padded) == 0 {
+			s.padded = make([]paddedEntry, size)
+		}
+		e = &s.padded[0].entry
+		s.padded = s.padded[1:]
+	} else {
+		if len(s.plain) == 0 {
+			s.plain = make([]entry, size)
+		}
+		e = &s.plain[0]
+		s.plain = s.plain[1:]
+	}
+	e.p = unsafe.Pointer(i)
+	return e
+}
+
+// slabSize returns the number of entries in the next slab of a map of n
+// keys.
+func slabSize(n int) int {
+	// slab随map增大而增大, 小map不会因为整块分配浪费内存
+	n /= 8
+	if n < 1 {
+		n = 1
+	} else if n > maxEntrySlab {
+		n = maxEntrySlab
+	}
+	return n
+}
+
+// A paddedEntry is an entry alone on its cache lines. Slab-allocated entries
+// otherwise share lines with their neighbours, so concurrent Stores to
+// different existing keys can contend even though they never touch mu.
+type paddedEntry struct {
+	entry
+	_ [cacheLinePad - unsafe.Sizeof(entry{})%cacheLinePad]byte
 }
 
 // Load returns the value stored in the map for a key, or nil if no
 // value is present.
 // The ok result indicates whether value was found in the map.
 func (m *Map) Load(key interface{}) (value interface{}, ok bool) {
+	if w := m.workload; w != nil {
+		w.count(false)
+	}
 	read, _ := m.read.Load().(readOnly)
-	e, ok := read.m[key]
+	if b := read.bloom; b != nil && !b.mayContain(b.hash(key)) {
+		// 过滤器里没有的key一定不在map中, read和dirty都不用查
+		if m.rec != nil {
+			m.rec.record(MapOpLoad, MapPathFiltered, key, false)
+		}
+		return nil, false
+	}
+	e, ok := read.m.load(key)
+	path := MapPathRead
 
 	// !ok说明read.m中没有, 如果read.amended == true,
 	// 说明存在于dirty中, lock住从dirty中查找
 	if !ok && read.amended {
-		m.mu.Lock()
+		if mapChaosEnabled {
+			mapChaosPoint("load")
+		}
+		m.lockSpin(MapOpLoad)
+		path = MapPathLocked
 		// Avoid reporting a spurious miss if m.dirty got promoted while we were
 		// blocked on m.mu. (If further loads of the same key will not miss, it's
 		// not worth copying the dirty map for this key.)
@@ -115,26 +341,34 @@ func (m *Map) Load(key interface{}) (value interface{}, ok bool) {
 		// 过程中, 另一个线程的访问可能会将dirty提升为read.m, 提升后数据会在read.m中, 同时
 		// read.amended会设置为false, 因此需要double-check一次, 如果read.m中有数据直接返回
 		read, _ = m.read.Load().(readOnly)
-		e, ok = read.m[key]
+		e, ok = read.m.load(key)
 
 		if !ok && read.amended {
-			e, ok = m.dirty[key]
+			e, ok = m.dirty.load(key)
 			// Regardless of whether the entry was present, record a miss: this key
 			// will take the slow path until the dirty map is promoted to the read
 			// map.
 
 			// 计算miss次数, 如果达到miss上限则提升read为dirty
-			m.missLocked()
+			m.missLocked(key)
 		}
-		m.mu.Unlock()
+		m.unlock()
 	}
 
 	// here, 说明没有数据
-	if !ok {
-		return nil, false
+	if ok {
+		value, ok = e.load()
+		if ok && m.entryStats {
+			e.stats().touch(true)
+		}
+		if ok && m.compress != nil {
+			value = m.compress.decode(value)
+		}
 	}
-
-	return e.load()
+	if m.rec != nil {
+		m.rec.record(MapOpLoad, path, key, ok)
+	}
+	return value, ok
 }
 
 // 实现的atomic.Value Load, 对应entry
@@ -154,32 +388,91 @@ func (e *entry) load() (value interface{}, ok bool) {
 
 // Store sets the value for a key.
 func (m *Map) Store(key, value interface{}) {
+	if ix := m.index; ix != nil {
+		ix.mu.Lock()
+		defer ix.mu.Unlock()
+		ix.setLocked(key, value, true)
+	}
+	value = m.encodeValue(value)
+	m.store(key, &value)
+}
+
+// StorePointer sets the value for a key to *value, keeping value itself as
+// the map's storage for it. Store has to copy its argument to the heap on
+// every call; callers that already hold the value behind a pointer avoid that
+// allocation with StorePointer.
+//
+// *value must not be modified after the call. StorePointer panics if value
+// is nil.
+func (m *Map) StorePointer(key interface{}, value *interface{}) {
+	if value == nil {
+		panic("sync: StorePointer of nil pointer")
+	}
+	if ix := m.index; ix != nil {
+		ix.mu.Lock()
+		defer ix.mu.Unlock()
+		ix.setLocked(key, *value, true)
+	}
+	if m.compress != nil {
+		// 压缩了的值只能另外存放, 没有压缩的仍然用value本身
+		if v, ok := m.compress.encode(*value); ok {
+			value = &v
+		}
+	}
+	m.store(key, value)
+}
+
+func (m *Map) store(key interface{}, value *interface{}) {
+	if w := m.workload; w != nil {
+		w.count(true)
+	}
 	read, _ := m.read.Load().(readOnly)
+	b := read.bloom
+	h := b.hash(key)
 	// key存在于read.m, tryStore尝试存储新的value,
 	// tryStore成功直接返回
-	if e, ok := read.m[key]; ok && e.tryStore(&value) {
+	if e, ok := read.m.load(key); ok && m.tryStore(e, value, b, h) {
+		if m.entryStats {
+			e.stats().touch(false)
+		}
+		if m.rec != nil {
+			m.rec.record(MapOpStore, MapPathRead, key, false)
+		}
 		return
 	}
 
 	// tryStroe失败, lock住开始继续操作
-	m.mu.Lock()
+	if mapChaosEnabled {
+		mapChaosPoint("store")
+	}
+	m.lock(MapOpStore)
+	path := MapPathLocked
 
 	read, _ = m.read.Load().(readOnly)
+	b = read.bloom
 
-	if e, ok := read.m[key]; ok {
+	if e, ok := read.m.load(key); ok {
 		// read.m中有对应的entry, 但被设置为expunged,
 		// 因此不可再read.m中使用了, 这里将entry设置为unexpunge并
 		// 存储到dirty
 		if e.unexpungeLocked() {
 			// The entry was previously expunged, which implies that there is a
 			// non-nil dirty map and this entry is not in it.
-			m.dirty[key] = e
+			m.dirty.store(key, e)
+			m.transitionLocked(MapUnexpunged, key)
+			path = MapPathUnexpunged
 		}
 
-		e.storeLocked(&value)
-	} else if e, ok := m.dirty[key]; ok {
+		m.storeLocked(e, value, b, h)
+		if m.entryStats {
+			e.stats().touch(false)
+		}
+	} else if e, ok := m.dirty.load(key); ok {
 		// read.m中没找到, dirty中找到, 更新dirty中对应的value
-		e.storeLocked(&value)
+		m.storeLocked(e, value, b, h)
+		if m.entryStats {
+			e.stats().touch(false)
+		}
 	} else {
 		// !read.amended 表示dirty为nil,
 		// 需要创建dirty并复制read.m到新的dirty
@@ -191,35 +484,63 @@ func (m *Map) Store(key, value interface{}) {
 			m.dirtyLocked()
 
 			// 将read.amended 标记为 true
-			m.read.Store(readOnly{m: read.m, amended: true})
+			m.read.Store(readOnly{m: read.m, amended: true, bloom: read.bloom})
+			m.transitionLocked(MapDirtyCreated, key)
 		}
 
 		// read.amended表示dirty不为nil, 直接将新的
 		// kv存储到dirty中
-		m.dirty[key] = newEntry(value)
+		b.add(h)
+		e := m.newEntryLocked(value)
+		if m.entryStats {
+			e.stats().touch(false)
+		}
+		m.dirty.store(key, e)
+		m.noteWriteLocked()
+		m.transitionLocked(MapDirtyStored, key)
+		path = MapPathNewKey
+	}
+	m.unlock()
+	if m.rec != nil {
+		m.rec.record(MapOpStore, path, key, false)
 	}
-	m.mu.Unlock()
 }
 
 // tryStore stores a value if the entry has not been expunged.
 //
 // If the entry is expunged, tryStore returns false and leaves the entry
-// unchanged.
-func (e *entry) tryStore(i *interface{}) bool {
+// unchanged. Otherwise it returns the pointer it replaced. A store over a
+// deleted value counts the key of hash h in b first.
+func (e *entry) tryStore(i *interface{}, b *mapBloom, h uint64) (old unsafe.Pointer, ok bool) {
 	for {
 		p := atomic.LoadPointer(&e.p)
 		// read.m中的entry状态为expunged, 不会去Store新的值
 		if p == expunged {
-			return false
+			return nil, false
+		}
+		if p == nil {
+			// key在新值可见之前计入过滤器
+			b.add(h)
 		}
 
 		// 使用CAS操作存储新的值
 		if atomic.CompareAndSwapPointer(&e.p, p, unsafe.Pointer(i)) {
-			return true
+			return p, true
+		}
+		if p == nil {
+			b.remove(h)
 		}
 	}
 }
 
+// tryStore is e.tryStore, telling a running WriteSnapshot about the write.
+func (m *Map) tryStore(e *entry, i *interface{}, b *mapBloom, h uint64) bool {
+	sh := m.beginEntryWrite(e)
+	old, ok := e.tryStore(i, b, h)
+	m.endEntryWrite(sh, e, old, ok)
+	return ok
+}
+
 // unexpungeLocked ensures that the entry is not marked as expunged.
 //
 // If the entry was previously expunged, it must be added to the dirty map
@@ -228,47 +549,125 @@ func (e *entry) unexpungeLocked() (wasExpunged bool) {
 	return atomic.CompareAndSwapPointer(&e.p, expunged, nil)
 }
 
-// storeLocked unconditionally stores a value to the entry.
+// storeLocked unconditionally stores a value to the entry and returns the
+// pointer it replaced.
 //
 // The entry must be known not to be expunged.
-func (e *entry) storeLocked(i *interface{}) {
-	atomic.StorePointer(&e.p, unsafe.Pointer(i))
+func (e *entry) storeLocked(i *interface{}) (old unsafe.Pointer) {
+	return atomic.SwapPointer(&e.p, unsafe.Pointer(i))
+}
+
+// storeLocked is e.storeLocked, telling a running WriteSnapshot about the
+// write and counting the key of hash h in b if it was deleted. m.mu must be
+// held.
+func (m *Map) storeLocked(e *entry, i *interface{}, b *mapBloom, h uint64) {
+	b.add(h)
+	sh := m.beginEntryWrite(e)
+	old := e.storeLocked(i)
+	m.endEntryWrite(sh, e, old, true)
+	if old != nil {
+		// 替换的是现有的值, key原本就已计入
+		b.remove(h)
+	}
 }
 
 // LoadOrStore returns the existing value for the key if present.
 // Otherwise, it stores and returns the given value.
 // The loaded result is true if the value was loaded, false if stored.
 func (m *Map) LoadOrStore(key, value interface{}) (actual interface{}, loaded bool) {
+	if ix := m.index; ix != nil {
+		ix.mu.Lock()
+		defer ix.mu.Unlock()
+		if actual, loaded = m.loadOrStoreValue(key, value); !loaded {
+			ix.setLocked(key, value, true)
+		}
+		return actual, loaded
+	}
+	return m.loadOrStoreValue(key, value)
+}
+
+// loadOrStoreValue is LoadOrStore, compressing value if m has value
+// compression.
+func (m *Map) loadOrStoreValue(key, value interface{}) (actual interface{}, loaded bool) {
+	if m.compress == nil {
+		return m.loadOrStore(key, value)
+	}
+	v, _ := m.compress.encode(value)
+	if actual, loaded = m.loadOrStore(key, v); !loaded {
+		return value, false
+	}
+	return m.compress.decode(actual), true
+}
+
+// loadOrStore is LoadOrStore of a value as the Map holds it.
+func (m *Map) loadOrStore(key, value interface{}) (actual interface{}, loaded bool) {
+	if w := m.workload; w != nil {
+		w.count(true)
+	}
 	// Avoid locking if it's a clean hit.
 	read, _ := m.read.Load().(readOnly)
-	if e, ok := read.m[key]; ok {
-		actual, loaded, ok := e.tryLoadOrStore(value)
+	b := read.bloom
+	h := b.hash(key)
+	if e, ok := read.m.load(key); ok {
+		actual, loaded, ok := m.tryLoadOrStore(e, value, b, h)
 		if ok {
+			if m.entryStats {
+				e.stats().touch(loaded)
+			}
+			if m.rec != nil {
+				m.rec.record(MapOpLoadOrStore, MapPathRead, key, loaded)
+			}
 			return actual, loaded
 		}
 	}
 
-	m.mu.Lock()
+	if mapChaosEnabled {
+		mapChaosPoint("loadorstore")
+	}
+	m.lock(MapOpLoadOrStore)
+	path := MapPathLocked
 	read, _ = m.read.Load().(readOnly)
-	if e, ok := read.m[key]; ok {
+	b = read.bloom
+	if e, ok := read.m.load(key); ok {
 		if e.unexpungeLocked() {
-			m.dirty[key] = e
+			m.dirty.store(key, e)
+			m.transitionLocked(MapUnexpunged, key)
+			path = MapPathUnexpunged
 		}
-		actual, loaded, _ = e.tryLoadOrStore(value)
-	} else if e, ok := m.dirty[key]; ok {
-		actual, loaded, _ = e.tryLoadOrStore(value)
-		m.missLocked()
+		actual, loaded, _ = m.tryLoadOrStore(e, value, b, h)
+		if m.entryStats {
+			e.stats().touch(loaded)
+		}
+	} else if e, ok := m.dirty.load(key); ok {
+		actual, loaded, _ = m.tryLoadOrStore(e, value, b, h)
+		if m.entryStats {
+			e.stats().touch(loaded)
+		}
+		m.missLocked(key)
 	} else {
 		if !read.amended {
 			// We're adding the first new key to the dirty map.
 			// Make sure it is allocated and mark the read-only map as incomplete.
 			m.dirtyLocked()
-			m.read.Store(readOnly{m: read.m, amended: true})
+			m.read.Store(readOnly{m: read.m, amended: true, bloom: read.bloom})
+			m.transitionLocked(MapDirtyCreated, key)
+		}
+		b.add(h)
+		ic := value
+		e := m.newEntryLocked(&ic)
+		if m.entryStats {
+			e.stats().touch(false)
 		}
-		m.dirty[key] = newEntry(value)
+		m.dirty.store(key, e)
+		m.noteWriteLocked()
+		m.transitionLocked(MapDirtyStored, key)
 		actual, loaded = value, false
+		path = MapPathNewKey
+	}
+	m.unlock()
+	if m.rec != nil {
+		m.rec.record(MapOpLoadOrStore, path, key, loaded)
 	}
-	m.mu.Unlock()
 
 	return actual, loaded
 }
@@ -277,8 +676,9 @@ func (m *Map) LoadOrStore(key, value interface{}) (actual interface{}, loaded bo
 // expunged.
 //
 // If the entry is expunged, tryLoadOrStore leaves the entry unchanged and
-// returns with ok==false.
-func (e *entry) tryLoadOrStore(i interface{}) (actual interface{}, loaded, ok bool) {
+// returns with ok==false. If it stores i, it counts the key of hash h in b
+// first.
+func (e *entry) tryLoadOrStore(i interface{}, b *mapBloom, h uint64) (actual interface{}, loaded, ok bool) {
 	p := atomic.LoadPointer(&e.p)
 	if p == expunged {
 		return nil, false, false
@@ -292,9 +692,11 @@ func (e *entry) tryLoadOrStore(i interface{}) (actual interface{}, loaded, ok bo
 	// shouldn't bother heap-allocating.
 	ic := i
 	for {
+		b.add(h)
 		if atomic.CompareAndSwapPointer(&e.p, nil, unsafe.Pointer(&ic)) {
 			return i, false, true
 		}
+		b.remove(h)
 		p = atomic.LoadPointer(&e.p)
 		if p == expunged {
 			return nil, false, false
@@ -305,38 +707,81 @@ func (e *entry) tryLoadOrStore(i interface{}) (actual interface{}, loaded, ok bo
 	}
 }
 
+// tryLoadOrStore is e.tryLoadOrStore, telling a running WriteSnapshot
+// about the write if it stores i.
+func (m *Map) tryLoadOrStore(e *entry, i interface{}, b *mapBloom, h uint64) (actual interface{}, loaded, ok bool) {
+	sh := m.beginEntryWrite(e)
+	actual, loaded, ok = e.tryLoadOrStore(i, b, h)
+	// 存入的只可能是nil上, 被替换的指针就是nil
+	m.endEntryWrite(sh, e, nil, ok && !loaded)
+	return actual, loaded, ok
+}
+
 // Delete deletes the value for a key.
 func (m *Map) Delete(key interface{}) {
+	if w := m.workload; w != nil {
+		w.count(true)
+	}
+	if ix := m.index; ix != nil {
+		ix.mu.Lock()
+		defer ix.mu.Unlock()
+		ix.setLocked(key, nil, false)
+	}
+	// promoGen必须在读read之前读取, 见deferDelete
+	gen := atomic.LoadUint32(&m.promoGen)
 	read, _ := m.read.Load().(readOnly)
-	e, ok := read.m[key]
+	e, ok := read.m.load(key)
+	path := MapPathRead
 	if !ok && read.amended {
-		m.mu.Lock()
+		// key只可能在dirty中. mu被占用时不等待, 把删除交给
+		// 下一个持有mu的goroutine去做
+		if mapChaosEnabled {
+			mapChaosPoint("delete")
+		}
+		if !m.tryLock(MapOpDelete) {
+			if m.deferDelete(key, gen) {
+				if m.rec != nil {
+					m.rec.record(MapOpDelete, MapPathDeferred, key, false)
+				}
+				return
+			}
+			m.lock(MapOpDelete)
+		}
+		path = MapPathLocked
 		// double-check
 		read, _ = m.read.Load().(readOnly)
-		e, ok = read.m[key]
+		e, ok = read.m.load(key)
 
 		if !ok && read.amended {
 			// 从dirty删除
-			delete(m.dirty, key)
+			m.deleteDirtyLocked(key)
 		}
-		m.mu.Unlock()
+		m.unlock()
 	}
 	// 从read.m中删除
 	if ok {
-		e.delete()
+		sh := m.beginEntryWrite(e)
+		old, deleted := e.delete()
+		m.endEntryWrite(sh, e, old, deleted)
+		if b := read.bloom; deleted && b != nil {
+			b.remove(b.hash(key))
+		}
+	}
+	if m.rec != nil {
+		m.rec.record(MapOpDelete, path, key, false)
 	}
 }
 
-func (e *entry) delete() (hadValue bool) {
+func (e *entry) delete() (old unsafe.Pointer, hadValue bool) {
 	for {
 		p := atomic.LoadPointer(&e.p)
 		// p已经是删除状态
 		if p == nil || p == expunged {
-			return false
+			return nil, false
 		}
 		// 使用CAS设置p=nil
 		if atomic.CompareAndSwapPointer(&e.p, p, nil) {
-			return true
+			return p, true
 		}
 	}
 }
@@ -352,11 +797,27 @@ func (e *entry) delete() (hadValue bool) {
 // Range may be O(N) with the number of elements in the map even if f returns
 // false after a constant number of calls.
 func (m *Map) Range(f func(key, value interface{}) bool) {
+	read := m.rangeRead()
+
+	// 遍历并传入到user func
+	read.m.iterate(func(k interface{}, e *entry) bool {
+		v, ok := e.load()
+		if !ok {
+			return true
+		}
+		return f(k, m.decodeValue(v))
+	})
+}
+
+// rangeRead returns the read map for Range to iterate over, first promoting
+// the dirty map if read is missing keys.
+func (m *Map) rangeRead() readOnly {
 	// We need to be able to iterate over all of the keys that were already
 	// present at the start of the call to Range.
 	// If read.amended is false, then read.m satisfies that property without
 	// requiring us to hold m.mu for a long time.
 	read, _ := m.read.Load().(readOnly)
+	path := MapPathRead
 
 	// 只要read.amended为true, 则dirty中存在数据且数据没有提升到read
 	if read.amended {
@@ -364,66 +825,165 @@ func (m *Map) Range(f func(key, value interface{}) bool) {
 		// (assuming the caller does not break out early), so a call to Range
 		// amortizes an entire copy of the map: we can promote the dirty copy
 		// immediately!
-		m.mu.Lock()
+		if mapChaosEnabled {
+			mapChaosPoint("range")
+		}
+		m.lock(MapOpRange)
+		m.awaitReplicaLocked(MapOpRange)
 		read, _ = m.read.Load().(readOnly)
 		// double-check
 		if read.amended {
 			// 拷贝m.dirty
-			read = readOnly{m: m.dirty}
-			m.read.Store(read)
-			m.dirty = nil
-			m.misses = 0
+			read = readOnly{m: m.dirty, bloom: read.bloom}
+			m.promoteLocked(nil)
+			path = MapPathPromoted
 		}
-		m.mu.Unlock()
+		m.unlock()
+	}
+	if m.rec != nil {
+		m.rec.record(MapOpRange, path, nil, false)
 	}
+	return read
+}
 
-	// 遍历并传入到user func
-	for k, e := range read.m {
-		v, ok := e.load()
-		if !ok {
-			continue
-		}
-		if !f(k, v) {
-			break
+// SetContentionProfile makes m record the acquisitions of its internal mutex
+// in p, under the lock name "sync.Map" (or the name given by
+// WithProfilerLabels) and attributed to the code that called the Map method.
+// Only slow paths acquire the mutex, so the report shows how often and for
+// how long they block. A nil p stops the recording.
+//
+// SetContentionProfile must not be called concurrently with other methods.
+func (m *Map) SetContentionProfile(p *ContentionProfile) {
+	m.prof = p
+}
+
+// lock acquires m.mu. All slow paths of the Map go through lock and unlock
+// so that debugging aids (such as the lockorder validator) see every
+// acquisition of m.mu.
+func (m *Map) lock(op MapOp) {
+	var prev unsafe.Pointer
+	if m.labels != nil {
+		prev = m.labels.enter(op)
+	}
+	var site *contentionSite
+	if p := m.prof; p != nil && p.sample() {
+		// 把等待时间记到调用Map方法的代码上, 而不是Map自己的方法上.
+		// 查找调用点要用到p.sites这个Map, 所以必须在获取mu之前
+		site = p.site(m.lockName(), mapCallerFrame())
+	}
+	// 在lockorder构建下, 记录当前goroutine持有了Map的mu,
+	// mu是叶子锁, 持有期间再获取其他有序锁会panic
+	if lockorderEnabled {
+		lockorderAcquire(MapLockLevel)
+	}
+	if site != nil {
+		lockSampled(&m.mu, site)
+	} else {
+		m.mu.Lock()
+	}
+	m.prevLabels = prev
+	if mapChaosEnabled {
+		mapChaosPoint("locked")
+	}
+	m.drainDeletesLocked()
+}
+
+// tryLock acquires m.mu if it is free and reports whether it did.
+func (m *Map) tryLock(op MapOp) bool {
+	var prev unsafe.Pointer
+	if m.labels != nil {
+		prev = m.labels.enter(op)
+	}
+	if !m.mu.tryLock() {
+		if m.labels != nil {
+			runtime_setProfLabel(prev)
 		}
+		return false
+	}
+	// 只有真的获取了mu才记录: 没有获取到的tryLock不会阻塞, 不参与锁的顺序.
+	// 在持有某个Map的mu时对它tryLock失败 (如Delete推迟删除) 是允许的
+	if lockorderEnabled {
+		lockorderAcquire(MapLockLevel)
+	}
+	m.prevLabels = prev
+	if mapChaosEnabled {
+		mapChaosPoint("locked")
+	}
+	m.drainDeletesLocked()
+	return true
+}
+
+// unlock releases m.mu.
+func (m *Map) unlock() {
+	// 释放mu之后prevLabels就属于下一个持有者了, 先取出来
+	prev := m.prevLabels
+	m.prevLabels = nil
+	m.mu.Unlock()
+	if lockorderEnabled {
+		lockorderRelease(MapLockLevel)
+	}
+	if m.labels != nil {
+		runtime_setProfLabel(prev)
 	}
 }
 
 // locked during execution
-func (m *Map) missLocked() {
+func (m *Map) missLocked(key interface{}) {
 	// 递增 misses
 	m.misses++
+	m.noteMissLocked()
+	m.transitionLocked(MapMiss, key)
 
-	// 当misses次数小于len(m.dirty)时, 不做任何工作
-	if m.misses < len(m.dirty) {
+	// 当misses次数小于阈值时, 不做任何工作.
+	// 阈值由PromotionPolicy决定, 默认至少是len(m.dirty),
+	// 最近写入多时会更大, 见map_promote.go
+	if t := m.promotionThresholdLocked(); t < 0 || m.misses < t {
+		return
+	}
+	// 后台还在复制的dirty缺少read中的entry, 不能提升, 等下一次miss
+	if m.replica != nil {
 		return
 	}
+	m.promoteLocked(key)
+}
 
-	// 当misses次数大于len(m.dirty)时, 提升dirty map为read map,
-	// 同时隐式的amended是false
-	m.read.Store(readOnly{m: m.dirty})
+// promoteLocked makes the dirty map the read map. key is the key of the
+// miss that caused it, or nil.
+func (m *Map) promoteLocked(key interface{}) {
+	// 提升dirty map为read map, 同时隐式的amended是false
+	m.beginPromotionLocked()
+	read, _ := m.read.Load().(readOnly)
+	m.read.Store(readOnly{m: m.dirty, bloom: read.bloom})
+	m.endPromotionLocked()
+	m.promo.promotions++
 
 	// dirty设置为nil
-	m.dirty = nil
+	m.dirty = entries{}
 	// miss计数设置为0
 	m.misses = 0
+	m.transitionLocked(MapPromoted, key)
+	if m.replicas {
+		m.startReplicaLocked()
+	}
 }
 
 func (m *Map) dirtyLocked() {
 	// 仅在dirty存在时才会进行拷贝
-	if m.dirty != nil {
+	if !m.dirty.isNil() {
 		return
 	}
 
 	read, _ := m.read.Load().(readOnly)
 	// 从read复制到dirty
-	m.dirty = make(map[interface{}]*entry, len(read.m))
-	for k, e := range read.m {
+	m.dirty = newEntries(m.backend, m.hasher, m.dirtyCapacity(read.m.len()))
+	m.noteDirtyLocked()
+	read.m.iterate(func(k interface{}, e *entry) bool {
 		// e不是nil或unexpunged的状态下, 才会复制到dirty
 		if !e.tryExpungeLocked() {
-			m.dirty[k] = e
+			m.dirty.store(k, e)
 		}
-	}
+		return true
+	})
 }
 
 func (e *entry) tryExpungeLocked() (isExpunged bool) {
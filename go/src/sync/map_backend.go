@@ -0,0 +1,231 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// A MapBackend selects the data structure a Map indexes its entries with.
+//
+// The backend only changes how keys are found. Every backend keeps the
+// read/dirty design of the Map: the read table is immutable from the moment
+// it is promoted, so Loads probe it without locking, and all writes to a
+// table happen while it is the dirty table, with the Map's mutex held.
+type MapBackend int
+
+const (
+	// BuiltinBackend indexes entries with Go's built-in map.
+	// It is the backend of the zero Map.
+	BuiltinBackend MapBackend = iota
+
+	// OpenAddressingBackend indexes entries with a single linearly probed
+	// array of slots that hold the key, its hash and the entry pointer inline.
+	// A lookup touches one contiguous run of slots instead of following
+	// bucket and overflow pointers, and growing the table allocates one
+	// array rather than a set of buckets.
+	OpenAddressingBackend
+
+	// SwissTableBackend indexes entries with a Swiss table: slots in groups
+	// of eight, each group with a word of per-slot hash metadata that is
+	// matched eight slots at a time. Keys are compared only where the
+	// metadata matches, which keeps lookups in large maps to about one
+	// metadata word and one key comparison.
+	SwissTableBackend
+)
+
+func (b MapBackend) String() string {
+	switch b {
+	case BuiltinBackend:
+		return "builtin"
+	case OpenAddressingBackend:
+		return "open-addressing"
+	case SwissTableBackend:
+		return "swiss-table"
+	}
+	return "MapBackend(" + itoa(int(b)) + ")"
+}
+
+// A MapOption configures a Map created by NewMap.
+type MapOption func(*Map)
+
+// WithBackend makes the Map index its entries with b.
+func WithBackend(b MapBackend) MapOption {
+	return func(m *Map) {
+		m.backend = b
+	}
+}
+
+// WithPaddedEntries gives every entry of the Map its own cache line. It
+// trades memory for less contention between concurrent Stores to distinct
+// existing keys, and only pays off when a few hot keys are updated from
+// many cores.
+func WithPaddedEntries() MapOption {
+	return func(m *Map) {
+		m.paddedEntries = true
+	}
+}
+
+// NewMap returns an empty Map configured by opts.
+// NewMap() with no options is equivalent to new(Map).
+func NewMap(opts ...MapOption) *Map {
+	m := new(Map)
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// An entryTable is an alternative index from keys to entries.
+//
+// A table is written (store, delete) only while it is a Map's dirty table,
+// with the Map's mutex held. Once promoted to the read table it is never
+// written again, which is what allows load and iterate to run concurrently
+// on it without synchronization.
+type entryTable interface {
+	load(key interface{}) (e *entry, ok bool)
+	store(key interface{}, e *entry)
+	delete(key interface{})
+	len() int
+	iterate(f func(key interface{}, e *entry) bool)
+}
+
+// entries is the index behind both readOnly.m and Map.dirty. Maps using
+// BuiltinBackend keep a built-in map in m, or, while they hold at most
+// smallEntriesMax keys, an inline array in small; so their fast paths pay no
+// indirect calls. Other backends keep an entryTable in t. At most one of the
+// three is non-nil, and the zero entries is an empty, nil index.
+type entries struct {
+	m     map[interface{}]*entry
+	small *smallEntries
+	t     entryTable
+}
+
+// smallEntriesMax is the most keys a BuiltinBackend index keeps inline.
+const smallEntriesMax = 8
+
+// smallEntries is an index of a few keys, searched linearly. For a handful
+// of keys, comparing the key against each one is cheaper than hashing it,
+// and the whole index fits in a few cache lines. Like a built-in map it
+// rejects unhashable keys on store; a load of an unhashable key simply
+// finds nothing unless a key of the same type is present.
+type smallEntries struct {
+	n    int
+	keys [smallEntriesMax]interface{}
+	es   [smallEntriesMax]*entry
+}
+
+// newEntries returns an empty index of the given backend with room for
+// at least capacity entries. Tables of backends other than BuiltinBackend
+// hash keys with h if it is non-nil.
+func newEntries(b MapBackend, h Hasher, capacity int) entries {
+	switch b {
+	case OpenAddressingBackend:
+		return entries{t: newOpenTable(h, capacity)}
+	case SwissTableBackend:
+		return entries{t: newSwissTable(h, capacity)}
+	}
+	if capacity <= smallEntriesMax {
+		return entries{small: new(smallEntries)}
+	}
+	return entries{m: make(map[interface{}]*entry, capacity)}
+}
+
+func (s entries) isNil() bool {
+	return s.m == nil && s.small == nil && s.t == nil
+}
+
+func (s entries) load(key interface{}) (e *entry, ok bool) {
+	if s.small != nil {
+		// 先用==比较interface, 类型不同时只比较类型指针
+		for i := 0; i < s.small.n; i++ {
+			if s.small.keys[i] == key {
+				return s.small.es[i], true
+			}
+		}
+		return nil, false
+	}
+	if s.t != nil {
+		return s.t.load(key)
+	}
+	e, ok = s.m[key]
+	return e, ok
+}
+
+// store sets the entry of key. It takes a pointer because a small index that
+// outgrows smallEntriesMax is replaced by a built-in map.
+func (s *entries) store(key interface{}, e *entry) {
+	if sm := s.small; sm != nil {
+		for i := 0; i < sm.n; i++ {
+			if sm.keys[i] == key {
+				sm.es[i] = e
+				return
+			}
+		}
+		if sm.n < smallEntriesMax {
+			// 内置map会对不可比较的key panic, 这里也要保持一致
+			runtime_efaceHash(key, 0)
+			sm.keys[sm.n], sm.es[sm.n] = key, e
+			sm.n++
+			return
+		}
+		m := make(map[interface{}]*entry, 2*smallEntriesMax)
+		for i := 0; i < sm.n; i++ {
+			m[sm.keys[i]] = sm.es[i]
+		}
+		s.m, s.small = m, nil
+	}
+	if s.t != nil {
+		s.t.store(key, e)
+		return
+	}
+	s.m[key] = e
+}
+
+func (s entries) delete(key interface{}) {
+	if sm := s.small; sm != nil {
+		for i := 0; i < sm.n; i++ {
+			if sm.keys[i] == key {
+				last := sm.n - 1
+				sm.keys[i], sm.es[i] = sm.keys[last], sm.es[last]
+				sm.keys[last], sm.es[last] = nil, nil
+				sm.n--
+				return
+			}
+		}
+		return
+	}
+	if s.t != nil {
+		s.t.delete(key)
+		return
+	}
+	delete(s.m, key)
+}
+
+func (s entries) len() int {
+	if s.small != nil {
+		return s.small.n
+	}
+	if s.t != nil {
+		return s.t.len()
+	}
+	return len(s.m)
+}
+
+func (s entries) iterate(f func(key interface{}, e *entry) bool) {
+	if sm := s.small; sm != nil {
+		for i := 0; i < sm.n; i++ {
+			if !f(sm.keys[i], sm.es[i]) {
+				return
+			}
+		}
+		return
+	}
+	if s.t != nil {
+		s.t.iterate(f)
+		return
+	}
+	for k, e := range s.m {
+		if !f(k, e) {
+			return
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"fmt"
+	"math/rand"
+	"sync"
+	"testing"
+	"testing/quick"
+)
+
+var mapBackends = []sync.MapBackend{
+	sync.BuiltinBackend,
+	sync.OpenAddressingBackend,
+	sync.SwissTableBackend,
+}
+
+func TestMapBackendsMatchRWMutex(t *testing.T) {
+	for _, b := range mapBackends {
+		b := b
+		t.Run(b.String(), func(t *testing.T) {
+			apply := func(calls []mapCall) ([]mapResult, map[interface{}]interface{}) {
+				return applyCalls(sync.NewMap(sync.WithBackend(b)), calls)
+			}
+			if err := quick.CheckEqual(apply, applyRWMutexMap, nil); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestMapBackendChurn(t *testing.T) {
+	const n = 1 << 12
+	for _, b := range mapBackends {
+		t.Run(b.String(), func(t *testing.T) {
+			m := sync.NewMap(sync.WithBackend(b))
+			// Interleave stores, promotions (via Load misses and Range) and
+			// deletes so that tables are grown, copied and tombstoned.
+			for round := 0; round < 4; round++ {
+				for i := 0; i < n; i++ {
+					m.Store(i, round)
+					if i%3 == 0 {
+						m.Delete(i)
+					}
+					m.Load(-i - 1)
+				}
+				count := 0
+				m.Range(func(k, v interface{}) bool {
+					if k.(int)%3 == 0 {
+						t.Fatalf("round %d: deleted key %v still present", round, k)
+					}
+					if v.(int) != round {
+						t.Fatalf("round %d: key %v has value %v", round, k, v)
+					}
+					count++
+					return true
+				})
+				if want := n - (n+2)/3; count != want {
+					t.Fatalf("round %d: Range visited %d keys, want %d", round, count, want)
+				}
+			}
+			for i := 0; i < n; i++ {
+				v, ok := m.Load(i)
+				if ok != (i%3 != 0) || ok && v.(int) != 3 {
+					t.Fatalf("Load(%d) = %v, %v", i, v, ok)
+				}
+			}
+		})
+	}
+}
+
+func TestMapBackendUnhashableKey(t *testing.T) {
+	for _, b := range mapBackends {
+		t.Run(b.String(), func(t *testing.T) {
+			m := sync.NewMap(sync.WithBackend(b))
+			defer func() {
+				if recover() == nil {
+					t.Fatal("storing an unhashable key did not panic")
+				}
+			}()
+			m.Store([]int{1}, 1)
+		})
+	}
+}
+
+// BenchmarkMapBackendLoadLarge measures read-map hits in maps too large
+// for their index to stay in cache, where the backends differ most.
+func BenchmarkMapBackendLoadLarge(b *testing.B) {
+	for _, size := range []int{1 << 10, 1 << 16, 1 << 20} {
+		for _, backend := range mapBackends {
+			b.Run(fmt.Sprintf("%s/%d", backend, size), func(b *testing.B) {
+				m := sync.NewMap(sync.WithBackend(backend))
+				for i := 0; i < size; i++ {
+					m.Store(i, i)
+				}
+				m.Range(func(_, _ interface{}) bool { return false }) // promote
+				b.ResetTimer()
+				b.RunParallel(func(pb *testing.PB) {
+					r := rand.New(rand.NewSource(rand.Int63()))
+					for pb.Next() {
+						m.Load(r.Intn(size))
+					}
+				})
+			})
+		}
+	}
+}
+
+func TestMapPaddedEntriesMatchesRWMutex(t *testing.T) {
+	apply := func(calls []mapCall) ([]mapResult, map[interface{}]interface{}) {
+		return applyCalls(sync.NewMap(sync.WithPaddedEntries()), calls)
+	}
+	if err := quick.CheckEqual(apply, applyRWMutexMap, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMapSmallIndexGrowth(t *testing.T) {
+	// Keys are added and removed around the size at which the inline
+	// index is replaced by a built-in map.
+	var m sync.Map
+	for n := 1; n <= 20; n++ {
+		for i := 0; i < n; i++ {
+			m.Store(i, n)
+		}
+		m.Delete(n / 2)
+		m.Range(func(k, v interface{}) bool { return true }) // promote
+		for i := 0; i < n; i++ {
+			v, ok := m.Load(i)
+			if i == n/2 {
+				if ok {
+					t.Fatalf("n=%d: deleted key %d present with %v", n, i, v)
+				}
+				continue
+			}
+			if !ok || v != n {
+				t.Fatalf("n=%d: Load(%d) = %v, %v; want %d, true", n, i, v, ok, n)
+			}
+		}
+	}
+}
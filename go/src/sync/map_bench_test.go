@@ -5,8 +5,6 @@
 package sync_test
 
 import (
-	"fmt"
-	"reflect"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -17,10 +15,35 @@ type bench struct {
 	perG  func(b *testing.B, pb *testing.PB, i int, m mapInterface)
 }
 
+// benchMaps are the implementations benchMap compares, each with a
+// constructor for a fresh, empty instance.
+var benchMaps = []struct {
+	name string
+	new  func() mapInterface
+}{
+	{"*sync_test.DeepCopyMap", func() mapInterface { return new(DeepCopyMap) }},
+	{"*sync_test.RWMutexMap", func() mapInterface { return new(RWMutexMap) }},
+	{"*sync.Map", func() mapInterface { return new(sync.Map) }},
+	{"*sync.Map[" + sync.OpenAddressingBackend.String() + "]", func() mapInterface {
+		return sync.NewMap(sync.WithBackend(sync.OpenAddressingBackend))
+	}},
+	{"*sync.Map[" + sync.SwissTableBackend.String() + "]", func() mapInterface {
+		return sync.NewMap(sync.WithBackend(sync.SwissTableBackend))
+	}},
+	{"*sync.Map[padded]", func() mapInterface { return sync.NewMap(sync.WithPaddedEntries()) }},
+	{"*sync.Map[spin]", func() mapInterface { return sync.NewMap(sync.WithSpinWait(0)) }},
+	{"*sync.HybridMap", func() mapInterface { return new(sync.HybridMap) }},
+	{"*sync.ShardedMap", func() mapInterface { return new(sync.ShardedMap) }},
+	{"*sync.QuotaMap", func() mapInterface {
+		return sync.NewQuotaMap(sync.QuotaMapConfig{Quota: 1 << 40, Size: blobSize})
+	}},
+}
+
 func benchMap(b *testing.B, bench bench) {
-	for _, m := range [...]mapInterface{&DeepCopyMap{}, &RWMutexMap{}, &sync.Map{}} {
-		b.Run(fmt.Sprintf("%T", m), func(b *testing.B) {
-			m = reflect.New(reflect.TypeOf(m).Elem()).Interface().(mapInterface)
+	for _, impl := range benchMaps {
+		impl := impl
+		b.Run(impl.name, func(b *testing.B) {
+			m := impl.new()
 			if bench.setup != nil {
 				bench.setup(b, m)
 			}
@@ -58,6 +81,28 @@ func BenchmarkLoadMostlyHits(b *testing.B) {
 	})
 }
 
+func BenchmarkLoadSmallConfig(b *testing.B) {
+	// A handful of string keys read constantly, as in a configuration map.
+	keys := [...]string{"addr", "timeout", "retries", "log-level", "tls"}
+
+	benchMap(b, bench{
+		setup: func(_ *testing.B, m mapInterface) {
+			for _, k := range keys {
+				m.LoadOrStore(k, k)
+			}
+			for i := 0; i < len(keys)*2; i++ {
+				m.Load(keys[i%len(keys)])
+			}
+		},
+
+		perG: func(b *testing.B, pb *testing.PB, i int, m mapInterface) {
+			for ; pb.Next(); i++ {
+				m.Load(keys[i%len(keys)])
+			}
+		},
+	})
+}
+
 func BenchmarkLoadMostlyMisses(b *testing.B) {
 	const hits, misses = 1, 1023
 
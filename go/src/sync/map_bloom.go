@@ -0,0 +1,169 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import "sync/atomic"
+
+// WithBloomFilter makes the Map keep a Bloom filter of its keys, sized for
+// expected of them, which Load consults before anything else. A Load of a
+// key the filter rules out returns at once: it neither probes the read map
+// nor, when the dirty map holds keys the read map lacks, locks the Map and
+// counts a miss. Where most Loads are of absent keys, as when deduplicating
+// a stream of mostly new IDs, this skips the map for nearly all of them,
+// and keeps the misses from promoting the dirty map over and over.
+//
+// The filter counts the keys, so that Delete takes them out again: every
+// write that makes a key present adds it before the value is visible, and
+// every write that takes a value away removes it afterwards, so the filter
+// never rules out a key that is present. About 1% of the Loads of absent
+// keys get past it while the map holds up to expected keys, and more
+// beyond that. Stores of new keys and Deletes update seven counters with
+// atomic operations; a Store over a value present in the read map updates
+// none.
+func WithBloomFilter(expected int) MapOption {
+	return func(m *Map) {
+		m.read.Store(readOnly{bloom: newMapBloom(expected)})
+	}
+}
+
+const (
+	// bloomCountersPerKey is the number of counters a mapBloom has for
+	// each key it is sized for.
+	bloomCountersPerKey = 10
+
+	// bloomHashes is the number of counters each key is counted in: the
+	// optimum of ln 2 * bloomCountersPerKey, for a false positive rate of
+	// about 0.8%.
+	bloomHashes = 7
+
+	// bloomSeed seeds the hash of the keys. Every mapBloom uses the same,
+	// so that a key hashed for one filter of a Map is hashed for all of
+	// them.
+	bloomSeed = 0x5bd1e995
+)
+
+// A mapBloom is a counting Bloom filter of the keys of a read map and its
+// dirty map. A nil *mapBloom rules out no key, and counts nothing.
+//
+// Each counter is a byte, four to a word. A counter that reaches 255 stays
+// there, since it can no longer tell how many keys it counts: the keys
+// behind it are never ruled out again, which costs false positives but
+// never a false negative.
+type mapBloom struct {
+	words    []uint32
+	mask     uint64 // the number of counters, a power of two, less one
+	expected int
+}
+
+func newMapBloom(expected int) *mapBloom {
+	if expected < 1 {
+		expected = 1
+	}
+	n := uint64(64)
+	for n < uint64(expected)*bloomCountersPerKey {
+		n <<= 1
+	}
+	return &mapBloom{words: make([]uint32, n/4), mask: n - 1, expected: expected}
+}
+
+// hash returns the hash of key for b, or 0 if b is nil.
+func (b *mapBloom) hash(key interface{}) uint64 {
+	if b == nil {
+		return 0
+	}
+	return uint64(runtime_efaceHash(key, bloomSeed))
+}
+
+// counter returns the word holding the i'th counter of the key of hash h,
+// and the shift of the counter in it.
+func (b *mapBloom) counter(h uint64, i int) (*uint32, uint) {
+	// 双重哈希: 第二个哈希是奇数, 在2的幂大小的表中bloomHashes个位置互不相同
+	h2 := (h*0x9e3779b97f4a7c15)>>32 | 1
+	c := (h + uint64(i)*h2) & b.mask
+	return &b.words[c>>2], uint(c&3) * 8
+}
+
+// mayContain reports whether the key of hash h may be present.
+func (b *mapBloom) mayContain(h uint64) bool {
+	if b == nil {
+		return true
+	}
+	for i := 0; i < bloomHashes; i++ {
+		w, shift := b.counter(h, i)
+		if atomic.LoadUint32(w)>>shift&0xff == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// add counts the key of hash h once more.
+func (b *mapBloom) add(h uint64) {
+	if b == nil {
+		return
+	}
+	for i := 0; i < bloomHashes; i++ {
+		w, shift := b.counter(h, i)
+		for {
+			old := atomic.LoadUint32(w)
+			if old>>shift&0xff == 0xff || atomic.CompareAndSwapUint32(w, old, old+1<<shift) {
+				break
+			}
+		}
+	}
+}
+
+// remove counts the key of hash h once less. It must have been added.
+func (b *mapBloom) remove(h uint64) {
+	if b == nil {
+		return
+	}
+	for i := 0; i < bloomHashes; i++ {
+		w, shift := b.counter(h, i)
+		for {
+			old := atomic.LoadUint32(w)
+			// 饱和的计数器不知道自己计了多少个key, 不能再减
+			if c := old >> shift & 0xff; c == 0xff || c == 0 || atomic.CompareAndSwapUint32(w, old, old-1<<shift) {
+				break
+			}
+		}
+	}
+}
+
+// deleteDirtyLocked deletes key from the dirty map, where the read map
+// does not have it. m.mu must be held.
+func (m *Map) deleteDirtyLocked(key interface{}) {
+	read, _ := m.read.Load().(readOnly)
+	if b := read.bloom; b != nil {
+		// 只在dirty中的entry不加锁碰不到, 把它也删掉, 才知道过滤器要不要减
+		if e, ok := m.dirty.load(key); ok {
+			sh := m.beginEntryWrite(e)
+			old, deleted := e.delete()
+			m.endEntryWrite(sh, e, old, deleted)
+			if deleted {
+				b.remove(b.hash(key))
+			}
+		}
+	}
+	m.dirty.delete(key)
+	m.transitionLocked(MapDirtyDeleted, key)
+}
+
+// newReplacedBloom returns the filter for the keys of data to replace the
+// filter b with, or nil if b is nil.
+func newReplacedBloom(b *mapBloom, data map[interface{}]interface{}) *mapBloom {
+	if b == nil {
+		return nil
+	}
+	n := b.expected
+	if len(data) > n {
+		n = len(data)
+	}
+	nb := newMapBloom(n)
+	for k := range data {
+		nb.add(nb.hash(k))
+	}
+	return nb
+}
@@ -0,0 +1,182 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// checkBloomMap checks that m holds exactly the keys of want.
+func checkBloomMap(t *testing.T, step string, m *sync.Map, want map[int]int, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		v, ok := m.Load(i)
+		if w, present := want[i]; ok != present || ok && v != w {
+			t.Fatalf("after %s: Load(%d) = %v, %v; want %v, %v", step, i, v, ok, w, present)
+		}
+	}
+}
+
+func TestMapBloomFilter(t *testing.T) {
+	const n = 1000
+	for _, opts := range [][]sync.MapOption{
+		nil,
+		{sync.WithBackend(sync.SwissTableBackend)},
+		{sync.WithReadReplica()},
+	} {
+		m := sync.NewMap(append(opts, sync.WithBloomFilter(n))...)
+		want := make(map[int]int)
+		for i := 0; i < n; i += 2 {
+			m.Store(i, i)
+			want[i] = i
+		}
+		checkBloomMap(t, "Store", m, want, n)
+
+		m.Promote()
+		for i := 0; i < n; i += 4 {
+			m.Delete(i)
+			delete(want, i)
+		}
+		for i := 1; i < n; i += 4 {
+			m.LoadOrStore(i, i)
+			want[i] = i
+		}
+		// 只在dirty中的key, 加锁删除
+		for i := 1; i < n; i += 8 {
+			m.Delete(i)
+			delete(want, i)
+		}
+		checkBloomMap(t, "Delete and LoadOrStore", m, want, n)
+
+		m.PurgeWhere(func(k, v interface{}) bool { return k.(int)%3 == 0 }, 16, nil)
+		for k := range want {
+			if k%3 == 0 {
+				delete(want, k)
+			}
+		}
+		m.RangeEntries(func(h sync.EntryHandle) bool {
+			if k := h.Key().(int); k%5 == 0 {
+				h.Delete()
+				delete(want, k)
+			}
+			return true
+		})
+		checkBloomMap(t, "PurgeWhere and EntryHandle.Delete", m, want, n)
+
+		// 删除之后再写回来
+		for i := 0; i < n; i += 3 {
+			m.Store(i, -i)
+			want[i] = -i
+		}
+		checkBloomMap(t, "Store after Delete", m, want, n)
+
+		data := make(map[interface{}]interface{})
+		want = make(map[int]int)
+		for i := n / 2; i < n; i++ {
+			data[i] = i
+			want[i] = i
+		}
+		m.ReplaceAll(data)
+		checkBloomMap(t, "ReplaceAll", m, want, n)
+		m.Store(0, 0)
+		want[0] = 0
+		checkBloomMap(t, "Store after ReplaceAll", m, want, n)
+	}
+}
+
+// TestMapBloomFilterSkips checks that the Loads of absent keys stop at the
+// filter.
+func TestMapBloomFilterSkips(t *testing.T) {
+	const n = 1000
+	m := sync.NewMap(sync.WithBloomFilter(n), sync.WithFlightRecorder(2*n))
+	for i := 0; i < n; i++ {
+		m.Store(i, i)
+	}
+	for i := n; i < 2*n; i++ {
+		if _, ok := m.Load(i); ok {
+			t.Fatalf("Load(%d) of an absent key found it", i)
+		}
+	}
+	filtered := 0
+	for _, r := range m.FlightRecord() {
+		if r.Op == sync.MapOpLoad && r.Path == sync.MapPathFiltered {
+			filtered++
+		}
+	}
+	// 按n个key设计的过滤器, 误判率约1%
+	if filtered < n*95/100 {
+		t.Errorf("%d of %d Loads of absent keys went past the filter", n-filtered, n)
+	}
+}
+
+// TestMapBloomFilterConsistent checks that the filter never rules out a
+// key present while other goroutines store and delete keys sharing its
+// counters.
+func TestMapBloomFilterConsistent(t *testing.T) {
+	// 很小的过滤器, 所有key的计数器都互相重叠
+	m := sync.NewMap(sync.WithBloomFilter(1))
+	procs := runtime.GOMAXPROCS(0) + 2
+	const iters = 5000
+	var wg sync.WaitGroup
+	for g := 0; g < procs; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < iters; i++ {
+				k := g*iters + i
+				m.Store(k, i)
+				if _, ok := m.Load(k); !ok {
+					t.Errorf("Load(%d) right after its Store found nothing", k)
+					return
+				}
+				if i%2 == 0 {
+					m.Delete(k)
+				}
+				if i%7 == 0 {
+					runtime.Gosched()
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	for g := 0; g < procs; g++ {
+		for i := 1; i < iters; i += 2 {
+			if _, ok := m.Load(g*iters + i); !ok {
+				t.Fatalf("Load(%d) found nothing after the writers finished", g*iters+i)
+			}
+		}
+	}
+}
+
+func BenchmarkMapBloomMiss(b *testing.B) {
+	const n = 1 << 16
+	for _, bench := range []struct {
+		name string
+		opts []sync.MapOption
+	}{
+		{"plain", nil},
+		{"bloom", []sync.MapOption{sync.WithBloomFilter(n)}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			m := sync.NewMap(bench.opts...)
+			for i := 0; i < n; i++ {
+				m.Store(i, i)
+			}
+			m.Promote()
+			// dirty中有新key, 没有过滤器的miss都要加锁
+			m.Store(-1, -1)
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				m.Load(n + i)
+				if i%1024 == 0 {
+					// 让miss引起的提升之后dirty中又有新key
+					m.Store(-1-i, i)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// A ValueCodec compresses the values of a Map configured by
+// WithValueCompression. Its methods are those of snappy's Encode and
+// Decode, so snappy is a ValueCodec as it is; other codecs, such as zstd,
+// need a few lines of adapter.
+type ValueCodec interface {
+	// Encode returns the encoding of src, using dst if it is large
+	// enough.
+	Encode(dst, src []byte) []byte
+
+	// Decode returns the decoding of src, using dst if it is large
+	// enough.
+	Decode(dst, src []byte) ([]byte, error)
+}
+
+// valueCompression is the configuration of WithValueCompression.
+type valueCompression struct {
+	codec     ValueCodec
+	threshold int
+}
+
+// A compressedValue is what a Map with value compression holds in place
+// of a large value. Its type is unexported, so no value stored by a
+// caller is one.
+type compressedValue struct {
+	b   []byte
+	str bool // the value was a string rather than a []byte
+}
+
+// WithValueCompression makes the Map compress, with c, the values that
+// are a []byte or a string of at least threshold bytes, when they are
+// stored, and decompress them whenever they are returned: by Load,
+// LoadOrStore, Range and the other methods passing values on. It trades
+// CPU for memory, for Maps that hold large text blobs such as JSON. A
+// value that does not get smaller is stored as it is.
+//
+// Each return of a compressed value decodes it again, into a new []byte or
+// string: a caller that modifies a []byte it loaded does not change the
+// value in the Map, as it would without compression. Decode must succeed
+// on every encoding Encode returned; the Map panics otherwise.
+func WithValueCompression(c ValueCodec, threshold int) MapOption {
+	if c == nil {
+		panic("sync: WithValueCompression with nil ValueCodec")
+	}
+	return func(m *Map) {
+		m.compress = &valueCompression{codec: c, threshold: threshold}
+	}
+}
+
+// encode returns the value to store in place of v, and whether it is a
+// compressed one.
+func (vc *valueCompression) encode(v interface{}) (interface{}, bool) {
+	var src []byte
+	str := false
+	switch x := v.(type) {
+	case []byte:
+		src = x
+	case string:
+		if len(x) < vc.threshold {
+			return v, false
+		}
+		src, str = []byte(x), true
+	default:
+		return v, false
+	}
+	if len(src) < vc.threshold {
+		return v, false
+	}
+	b := vc.codec.Encode(nil, src)
+	if len(b) >= len(src) {
+		// 压缩不了的(已经压缩过的图片之类)原样存放, 省得每次Load白白解码
+		return v, false
+	}
+	return &compressedValue{b: b, str: str}, true
+}
+
+// decode returns the value stored as v.
+func (vc *valueCompression) decode(v interface{}) interface{} {
+	c, ok := v.(*compressedValue)
+	if !ok {
+		return v
+	}
+	b, err := vc.codec.Decode(nil, c.b)
+	if err != nil {
+		panic("sync: ValueCodec failed to decode a value it encoded: " + err.Error())
+	}
+	if c.str {
+		return string(b)
+	}
+	return b
+}
+
+// encodeValue and decodeValue compress and decompress v if m has value
+// compression, and return it as it is otherwise.
+func (m *Map) encodeValue(v interface{}) interface{} {
+	if m.compress == nil {
+		return v
+	}
+	v, _ = m.compress.encode(v)
+	return v
+}
+
+func (m *Map) decodeValue(v interface{}) interface{} {
+	if m.compress == nil {
+		return v
+	}
+	return m.compress.decode(v)
+}
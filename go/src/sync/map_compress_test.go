@@ -0,0 +1,98 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// rleCodec is a run-length encoding: pairs of a count and a byte.
+type rleCodec struct {
+	encoded, decoded int
+}
+
+func (c *rleCodec) Encode(dst, src []byte) []byte {
+	c.encoded++
+	dst = dst[:0]
+	for i := 0; i < len(src); {
+		j := i + 1
+		for j < len(src) && src[j] == src[i] && j-i < 255 {
+			j++
+		}
+		dst = append(dst, byte(j-i), src[i])
+		i = j
+	}
+	return dst
+}
+
+func (c *rleCodec) Decode(dst, src []byte) ([]byte, error) {
+	c.decoded++
+	if len(src)%2 != 0 {
+		return nil, errors.New("odd length")
+	}
+	dst = dst[:0]
+	for i := 0; i < len(src); i += 2 {
+		dst = append(dst, bytes.Repeat(src[i+1:i+2], int(src[i]))...)
+	}
+	return dst, nil
+}
+
+func TestMapValueCompression(t *testing.T) {
+	c := new(rleCodec)
+	m := sync.NewMap(sync.WithValueCompression(c, 64))
+	blob := bytes.Repeat([]byte("a"), 1000)
+	text := strings.Repeat("x", 500)
+	m.Store("bytes", blob)
+	m.Store("string", text)
+	m.Store("small", []byte("aaaa"))
+	m.Store("random", []byte("abcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyz"))
+	m.Store("int", 1)
+	if c.encoded != 3 {
+		t.Errorf("%d values encoded; want the 3 []byte and string values over the threshold", c.encoded)
+	}
+
+	if v, ok := m.Load("bytes"); !ok || !bytes.Equal(v.([]byte), blob) {
+		t.Errorf("Load(bytes) = %d bytes, %v", len(v.([]byte)), ok)
+	}
+	if v, ok := m.Load("string"); !ok || v != text {
+		t.Errorf("Load(string) = %T, %v; want the string stored", v, ok)
+	}
+	decoded := c.decoded
+	if v, _ := m.Load("random"); len(v.([]byte)) != 78 || c.decoded != decoded {
+		t.Error("a value that did not compress was decoded")
+	}
+
+	// 修改Load到的[]byte不影响Map中的值
+	v, _ := m.Load("bytes")
+	v.([]byte)[0] = 'b'
+	if v, _ := m.Load("bytes"); v.([]byte)[0] != 'a' {
+		t.Error("modifying a loaded value changed the Map")
+	}
+
+	if v, loaded := m.LoadOrStore("bytes", nil); !loaded || !bytes.Equal(v.([]byte), blob) {
+		t.Errorf("LoadOrStore of a compressed value = %v, %v", len(v.([]byte)), loaded)
+	}
+	if v, loaded := m.LoadOrStore("new", text); loaded || v != text {
+		t.Errorf("LoadOrStore of a new key = %v, %v; want the value given", v, loaded)
+	}
+	m.Range(func(k, v interface{}) bool {
+		if k == "string" && v != text {
+			t.Errorf("Range passed %T for the compressed string", v)
+		}
+		return true
+	})
+	if v, _ := m.Freeze().Load("bytes"); !bytes.Equal(v.([]byte), blob) {
+		t.Error("Freeze holds the compressed value")
+	}
+	var p interface{} = text
+	m.StorePointer("pointer", &p)
+	if v, _ := m.Load("pointer"); v != text {
+		t.Errorf("Load after StorePointer = %T", v)
+	}
+}
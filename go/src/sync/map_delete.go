@@ -0,0 +1,111 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// A Delete of a key that is only in the dirty map has to remove it from the
+// dirty map, which is guarded by mu. When mu is held by someone else, Delete
+// does not wait for it: it pushes the key onto m.pendingDeletes and returns,
+// and whoever holds mu next removes the key before doing anything else.
+//
+// This is correct because, until the next promotion, nothing can observe a
+// dirty-only key without holding mu: Load, LoadOrStore and Store all lock mu
+// for keys missing from the read map, and every acquisition of mu drains the
+// pending deletes first. A write to the key made by the goroutine that held
+// mu when the Delete was pushed is invisible until mu is released, so it can
+// be ordered before the Delete.
+//
+// A promotion makes dirty-only keys visible without mu, so it must apply
+// every delete pushed before it. m.promoGen is odd while a promotion is in
+// progress: the promotion increments it, drains under mu, stores the new
+// read map and only then increments it again. A Delete that loads an odd
+// m.promoGen does not defer. Otherwise it loads m.promoGen before it loads
+// the read map and again after pushing: if the two loads agree, the push
+// preceded the first increment and therefore the drain, and the read map
+// the Delete consulted was still current when it pushed. If they differ, a
+// promotion raced with the Delete, which cancels its node and falls back to
+// locking mu.
+//
+// Incrementing once, before the drain, is not enough: a Delete that loads
+// m.promoGen after the increment but the read map before the new one is
+// stored pushes its node after the drain, sees no change of m.promoGen and
+// returns, and the key it deleted is then promoted to the read map.
+
+// A deleteNode is a Delete waiting for mu.
+type deleteNode struct {
+	key  interface{}
+	next *deleteNode
+	// done is set to 1 by whichever of the draining goroutine and a
+	// cancelling Delete claims the node first.
+	done uint32
+}
+
+// deferDelete records a Delete of key, which was missing from the read map
+// loaded when m.promoGen was gen, without waiting for mu. It reports whether
+// the key will be deleted by the next holder of mu; if it returns false, the
+// caller must delete the key itself with mu held.
+func (m *Map) deferDelete(key interface{}, gen uint32) bool {
+	if gen&1 != 0 {
+		// 提升正在进行, read可能已经过时
+		return false
+	}
+	n := &deleteNode{key: key}
+	for {
+		head := atomic.LoadPointer(&m.pendingDeletes)
+		n.next = (*deleteNode)(head)
+		if atomic.CompareAndSwapPointer(&m.pendingDeletes, head, unsafe.Pointer(n)) {
+			break
+		}
+	}
+	if atomic.LoadUint32(&m.promoGen) == gen {
+		return true
+	}
+	// 有提升和这次删除并发, 撤销节点, 改为加锁删除.
+	// 即使节点已经被取走并应用过, 再删一次也只是在这次Delete期间重复删除
+	atomic.CompareAndSwapUint32(&n.done, 0, 1)
+	return false
+}
+
+// drainDeletesLocked applies the pending deletes. m.mu must be held.
+func (m *Map) drainDeletesLocked() {
+	if atomic.LoadPointer(&m.pendingDeletes) == nil {
+		return
+	}
+	n := (*deleteNode)(atomic.SwapPointer(&m.pendingDeletes, nil))
+	for ; n != nil; n = n.next {
+		if !atomic.CompareAndSwapUint32(&n.done, 0, 1) {
+			continue
+		}
+		// 没有提升发生过, 所以key仍然只可能在dirty中
+		if !m.dirty.isNil() {
+			m.deleteDirtyLocked(n.key)
+		}
+		m.promo.deferredDeletes++
+	}
+}
+
+// beginPromotionLocked must be called with m.mu held immediately before the
+// read map is replaced, and endPromotionLocked right after the new one is
+// stored.
+func (m *Map) beginPromotionLocked() {
+	// promoGen变为奇数: 从这里到新的read存入, Delete都不能推迟
+	atomic.AddUint32(&m.promoGen, 1)
+	m.drainDeletesLocked()
+	if testHookPromote != nil {
+		testHookPromote(m)
+	}
+}
+
+func (m *Map) endPromotionLocked() {
+	atomic.AddUint32(&m.promoGen, 1)
+}
+
+// testHookPromote, if not nil, is called by beginPromotionLocked once the
+// pending deletes are drained, before the new read map is stored.
+var testHookPromote func(m *Map)
@@ -0,0 +1,94 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+)
+
+func TestMapDeleteDoesNotWaitForLock(t *testing.T) {
+	var m sync.Map
+	m.Store("dirty-only", 1)
+
+	// With the lock held, a Delete of a dirty-only key must return without
+	// blocking; this goroutine would deadlock otherwise.
+	sync.LockMap(&m)
+	m.Delete("dirty-only")
+	sync.UnlockMap(&m)
+
+	if v, ok := m.Load("dirty-only"); ok {
+		t.Fatalf("Load after deferred Delete = %v, true; want nil, false", v)
+	}
+	if s := m.Stats(); s.DeferredDeletes != 1 {
+		t.Errorf("DeferredDeletes = %d, want 1", s.DeferredDeletes)
+	}
+
+	// A Store after the deferred Delete must not be undone by it.
+	sync.LockMap(&m)
+	m.Delete("again")
+	sync.UnlockMap(&m)
+	m.Store("dirty-only", 2)
+	if v, ok := m.Load("dirty-only"); !ok || v != 2 {
+		t.Fatalf("Load after re-Store = %v, %v; want 2, true", v, ok)
+	}
+}
+
+func TestMapConcurrentDeletes(t *testing.T) {
+	const (
+		writers = 4
+		keys    = 128
+		rounds  = 200
+	)
+	var m sync.Map
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	// Readers miss on dirty-only keys to force promotions concurrently with
+	// the deletes.
+	for g := 0; g < 2; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				m.Load(i % keys)
+				if i%64 == 0 {
+					runtime.Gosched()
+				}
+			}
+		}()
+	}
+	var writersWG sync.WaitGroup
+	for g := 0; g < writers; g++ {
+		writersWG.Add(1)
+		go func(g int) {
+			defer writersWG.Done()
+			for r := 0; r < rounds; r++ {
+				for k := g; k < keys; k += writers {
+					m.Store(k, r)
+					m.Delete(k)
+					if r == rounds-1 && k%2 == 0 {
+						m.Store(k, r)
+					}
+				}
+			}
+		}(g)
+	}
+	writersWG.Wait()
+	close(done)
+	wg.Wait()
+
+	for k := 0; k < keys; k++ {
+		v, ok := m.Load(k)
+		if want := k%2 == 0; ok != want || ok && v != rounds-1 {
+			t.Errorf("Load(%d) = %v, %v; want present = %v", k, v, ok, want)
+		}
+	}
+}
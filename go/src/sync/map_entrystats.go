@@ -0,0 +1,126 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// WithEntryStats makes the Map count the hits of every key and record when
+// it was last accessed, for EntryStats and RangeStats to return. The
+// counters live next to the entry, on a cache line of its own, so that
+// Loads of one hot key do not slow down Loads of its neighbours; like
+// WithPaddedEntries, this costs a cache line per key.
+//
+// Every Load and LoadOrStore that finds the key adds to its hits, and
+// every Load, Store and LoadOrStore of a present key reads the clock.
+func WithEntryStats() MapOption {
+	return func(m *Map) {
+		m.entryStats = true
+	}
+}
+
+// MapEntryStats describes the accesses to a key of a Map created with
+// WithEntryStats.
+type MapEntryStats struct {
+	Hits       int64 // Loads and LoadOrStores that found the key
+	LastAccess int64 // the runtime's monotonic clock at the last Load, Store or LoadOrStore
+	Idle       int64 // nanoseconds between LastAccess and the call that returned the stats
+}
+
+// A statsEntry is an entry with its access counters. The counters come
+// first so that they are 8-byte aligned on 32-bit platforms: slabs of
+// statsEntry are, and its size is a multiple of 8.
+type statsEntry struct {
+	hits int64 // accessed atomically
+	last int64 // accessed atomically
+	entry
+	_ [cacheLinePad - unsafe.Sizeof(statsEntryFields{})%cacheLinePad]byte
+}
+
+// statsEntryFields mirrors the fields of statsEntry before its padding.
+type statsEntryFields struct {
+	hits, last int64
+	entry
+}
+
+// stats returns the statsEntry e is part of. It is only valid for entries
+// of a Map created with WithEntryStats.
+func (e *entry) stats() *statsEntry {
+	return (*statsEntry)(unsafe.Pointer(uintptr(unsafe.Pointer(e)) - unsafe.Offsetof(statsEntry{}.entry)))
+}
+
+// touch records an access to e, and a hit if hit is set.
+func (s *statsEntry) touch(hit bool) {
+	if hit {
+		atomic.AddInt64(&s.hits, 1)
+	}
+	// 热点key上每次Load都写last会让各个核抢这一行; 时钟没变就不写
+	if now := runtime_nanotime(); atomic.LoadInt64(&s.last) != now {
+		atomic.StoreInt64(&s.last, now)
+	}
+}
+
+func (s *statsEntry) read(now int64) MapEntryStats {
+	st := MapEntryStats{
+		Hits:       atomic.LoadInt64(&s.hits),
+		LastAccess: atomic.LoadInt64(&s.last),
+	}
+	if st.LastAccess != 0 {
+		st.Idle = now - st.LastAccess
+	}
+	return st
+}
+
+// EntryStats returns the access statistics of key and reports whether key
+// is present in the Map. The statistics are zero if the Map was not created
+// with WithEntryStats.
+//
+// EntryStats is not an access: it changes neither the hits nor the last
+// access of key, and does not count towards promoting the dirty map.
+func (m *Map) EntryStats(key interface{}) (s MapEntryStats, ok bool) {
+	read, _ := m.read.Load().(readOnly)
+	e, ok := read.m.load(key)
+	if !ok && read.amended {
+		m.lock(mapOpEntryStats)
+		read, _ = m.read.Load().(readOnly)
+		e, ok = read.m.load(key)
+		if !ok && read.amended {
+			e, ok = m.dirty.load(key)
+		}
+		m.unlock()
+	}
+	if !ok {
+		return MapEntryStats{}, false
+	}
+	if _, ok := e.load(); !ok {
+		return MapEntryStats{}, false
+	}
+	if !m.entryStats {
+		return MapEntryStats{}, true
+	}
+	return e.stats().read(runtime_nanotime()), true
+}
+
+// RangeStats is like Range, but also passes f the access statistics of each
+// key, as EntryStats would return them. It is meant for deciding what to
+// evict, for example the keys idle for longest or hit least. Like
+// EntryStats, it does not count as an access to the keys.
+func (m *Map) RangeStats(f func(key, value interface{}, s MapEntryStats) bool) {
+	read := m.rangeRead()
+	now := runtime_nanotime()
+	read.m.iterate(func(k interface{}, e *entry) bool {
+		v, ok := e.load()
+		if !ok {
+			return true
+		}
+		var s MapEntryStats
+		if m.entryStats {
+			s = e.stats().read(now)
+		}
+		return f(k, m.decodeValue(v), s)
+	})
+}
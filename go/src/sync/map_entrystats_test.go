@@ -0,0 +1,159 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"sync"
+	"testing"
+	"testing/quick"
+)
+
+func TestMapEntryStats(t *testing.T) {
+	m := sync.NewMap(sync.WithEntryStats())
+	m.Store("a", 1)
+	m.Store("b", 1)
+	for i := 0; i < 3; i++ {
+		m.Load("a") // 前几次在dirty中, 之后提升到read
+	}
+	m.LoadOrStore("a", 2)
+	m.LoadOrStore("c", 1) // 新key, 不算命中
+	m.Load("nosuch")
+
+	want := map[string]int64{"a": 4, "b": 0, "c": 0}
+	for k, hits := range want {
+		s, ok := m.EntryStats(k)
+		if !ok || s.Hits != hits {
+			t.Errorf("EntryStats(%q) = %+v, %v; want %d hits", k, s, ok, hits)
+		}
+		if s.LastAccess == 0 || s.Idle < 0 {
+			t.Errorf("EntryStats(%q) = %+v; want a last access in the past", k, s)
+		}
+	}
+	if s, ok := m.EntryStats("nosuch"); ok || s != (sync.MapEntryStats{}) {
+		t.Errorf("EntryStats of a missing key = %+v, %v", s, ok)
+	}
+
+	// EntryStats不是一次访问
+	before, _ := m.EntryStats("a")
+	after, _ := m.EntryStats("a")
+	if after.Hits != before.Hits || after.LastAccess != before.LastAccess {
+		t.Errorf("EntryStats changed the stats from %+v to %+v", before, after)
+	}
+
+	m.Delete("b")
+	if _, ok := m.EntryStats("b"); ok {
+		t.Error("EntryStats found a deleted key")
+	}
+	got := make(map[string]int64)
+	m.RangeStats(func(k, v interface{}, s sync.MapEntryStats) bool {
+		got[k.(string)] = s.Hits
+		return true
+	})
+	if len(got) != 2 || got["a"] != 4 || got["c"] != 0 {
+		t.Errorf("RangeStats visited %v, want a:4 c:0", got)
+	}
+}
+
+func TestMapEntryStatsLastAccess(t *testing.T) {
+	m := sync.NewMap(sync.WithEntryStats())
+	m.Store("old", 1)
+	m.Store("new", 1)
+	s0, _ := m.EntryStats("old")
+	for {
+		// 时钟走过至少一格, 再访问new
+		if s, _ := m.EntryStats("old"); s.Idle > 0 {
+			break
+		}
+	}
+	m.Load("new")
+	old, _ := m.EntryStats("old")
+	nw, _ := m.EntryStats("new")
+	if old.LastAccess != s0.LastAccess || nw.LastAccess <= old.LastAccess {
+		t.Errorf("after a Load of new: old %+v, new %+v", old, nw)
+	}
+	m.Store("old", 2)
+	if s, _ := m.EntryStats("old"); s.LastAccess <= old.LastAccess || s.Hits != 0 {
+		t.Errorf("after a Store, stats of old = %+v", s)
+	}
+}
+
+func TestMapEntryStatsDisabled(t *testing.T) {
+	var m sync.Map
+	m.Store("a", 1)
+	m.Load("a")
+	if s, ok := m.EntryStats("a"); !ok || s != (sync.MapEntryStats{}) {
+		t.Errorf("EntryStats without WithEntryStats = %+v, %v", s, ok)
+	}
+	n := 0
+	m.RangeStats(func(k, v interface{}, s sync.MapEntryStats) bool {
+		n++
+		return s == (sync.MapEntryStats{})
+	})
+	if n != 1 {
+		t.Errorf("RangeStats visited %d keys, want 1", n)
+	}
+}
+
+func TestMapEntryStatsMatchesRWMutex(t *testing.T) {
+	apply := func(calls []mapCall) ([]mapResult, map[interface{}]interface{}) {
+		return applyCalls(sync.NewMap(sync.WithEntryStats()), calls)
+	}
+	if err := quick.CheckEqual(apply, applyRWMutexMap, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestMapEntryStatsConcurrent(t *testing.T) {
+	const goroutines, loads = 4, 1600
+	m := sync.NewMap(sync.WithEntryStats(), sync.WithBackend(sync.SwissTableBackend))
+	for i := 0; i < 16; i++ {
+		m.Store(i, i)
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < loads; i++ {
+				m.Load(i % 16)
+				if i%100 == 0 {
+					m.Store(16+g, i) // 不断产生新的dirty
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	for i := 0; i < 16; i++ {
+		if s, _ := m.EntryStats(i); s.Hits != goroutines*loads/16 {
+			t.Errorf("key %d has %d hits, want %d", i, s.Hits, goroutines*loads/16)
+		}
+	}
+}
+
+func BenchmarkMapEntryStatsLoad(b *testing.B) {
+	for _, bm := range []struct {
+		name string
+		opts []sync.MapOption
+	}{
+		{"off", nil},
+		{"on", []sync.MapOption{sync.WithEntryStats()}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			m := sync.NewMap(bm.opts...)
+			for i := 0; i < 1024; i++ {
+				m.Store(i, i)
+			}
+			m.Range(func(_, _ interface{}) bool { return false }) // promote
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					m.Load(i & 1023)
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,265 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import "sync/atomic"
+
+// A MapOp is the kind of a Map operation kept by a flight recorder.
+type MapOp uint8
+
+const (
+	MapOpLoad MapOp = iota
+	MapOpStore
+	MapOpLoadOrStore
+	MapOpDelete
+	MapOpRange
+)
+
+var mapOpNames = [...]string{
+	MapOpLoad:        "load",
+	MapOpStore:       "store",
+	MapOpLoadOrStore: "loadorstore",
+	MapOpDelete:      "delete",
+	MapOpRange:       "range",
+	mapOpStats:       "stats",
+	mapOpPromote:     "promote",
+	mapOpEntryStats:  "entrystats",
+	mapOpSnapshot:    "snapshot",
+	mapOpPurge:       "purge",
+	mapOpFreeze:      "freeze",
+	mapOpState:       "state",
+	mapOpReplica:     "replica",
+	mapOpReplace:     "replace",
+}
+
+func (op MapOp) String() string {
+	if int(op) < len(mapOpNames) {
+		return mapOpNames[op]
+	}
+	return "MapOp(" + itoa(int(op)) + ")"
+}
+
+// A MapPath is the way an operation went through a Map.
+type MapPath uint8
+
+const (
+	// MapPathRead: the operation was done on the read map, without
+	// locking.
+	MapPathRead MapPath = iota
+
+	// MapPathLocked: the operation locked the Map and found the key in the
+	// read or the dirty map, or found it missing from both.
+	MapPathLocked
+
+	// MapPathNewKey: a Store or LoadOrStore added a new key to the dirty
+	// map.
+	MapPathNewKey
+
+	// MapPathUnexpunged: a Store or LoadOrStore brought back a key that
+	// had been expunged from the dirty map.
+	MapPathUnexpunged
+
+	// MapPathDeferred: a Delete found the Map locked and left the key to
+	// the goroutine holding the lock.
+	MapPathDeferred
+
+	// MapPathPromoted: a Range promoted the dirty map before iterating.
+	MapPathPromoted
+
+	// MapPathFiltered: a Load found the key ruled out by the Bloom filter
+	// of WithBloomFilter, and looked no further.
+	MapPathFiltered
+)
+
+var mapPathNames = [...]string{
+	MapPathRead:       "read",
+	MapPathLocked:     "locked",
+	MapPathNewKey:     "new-key",
+	MapPathUnexpunged: "unexpunged",
+	MapPathDeferred:   "deferred",
+	MapPathPromoted:   "promoted",
+	MapPathFiltered:   "filtered",
+}
+
+func (p MapPath) String() string {
+	if int(p) < len(mapPathNames) {
+		return mapPathNames[p]
+	}
+	return "MapPath(" + itoa(int(p)) + ")"
+}
+
+// A MapRecord is an operation kept by a Map's flight recorder.
+type MapRecord struct {
+	Op    MapOp
+	Path  MapPath
+	Found bool // for Load and LoadOrStore, whether the key was present
+
+	KeyHash   uint64 // MapKeyHash of the key; 0 for Range
+	Goroutine int64  // id of the goroutine that called the Map
+	Nanotime  int64  // the runtime's monotonic clock when the operation ended
+	Age       int64  // nanoseconds between the operation and the FlightRecord call
+}
+
+func (r MapRecord) String() string {
+	s := r.Op.String()
+	if r.Op != MapOpRange {
+		s += " key=" + hex64(r.KeyHash)
+	}
+	s += " g=" + itoa(int(r.Goroutine)) + " path=" + r.Path.String()
+	if r.Op == MapOpLoad || r.Op == MapOpLoadOrStore {
+		if r.Found {
+			s += " found"
+		} else {
+			s += " missing"
+		}
+	}
+	return s + " " + itoa(int(r.Age)) + "ns ago"
+}
+
+func hex64(v uint64) string {
+	const digits = "0123456789abcdef"
+	var b [18]byte
+	i := len(b)
+	for {
+		i--
+		b[i] = digits[v&0xf]
+		v >>= 4
+		if v == 0 {
+			break
+		}
+	}
+	i--
+	b[i] = 'x'
+	i--
+	b[i] = '0'
+	return string(b[i:])
+}
+
+// MapKeyHash returns the hash a flight recorder keeps for key, so that
+// the records of a key can be found in FlightRecord. It is the same for
+// every Map of the process, but differs between processes.
+func MapKeyHash(key interface{}) uint64 {
+	return uint64(runtime_efaceHash(key, 0))
+}
+
+// WithFlightRecorder makes the Map keep its last n operations, which
+// FlightRecord returns: which goroutine did what to which key, and how.
+// n is rounded up to a power of two.
+//
+// Recording an operation takes a hash of the key, an atomic add and a
+// handful of atomic stores, and never locks. An operation is dropped if
+// it would overwrite another one still being recorded, which only
+// happens when writers lap the whole ring during one record.
+func WithFlightRecorder(n int) MapOption {
+	if n <= 0 {
+		panic("sync: WithFlightRecorder with non-positive size")
+	}
+	size := 1
+	for size < n {
+		size <<= 1
+	}
+	return func(m *Map) {
+		m.rec = &flightRecorder{slots: make([]flightSlot, size)}
+	}
+}
+
+// FlightRecord returns the operations kept by the Map's flight recorder,
+// oldest first, or nil if it has none. Operations being recorded while
+// FlightRecord runs may be missing.
+func (m *Map) FlightRecord() []MapRecord {
+	if m.rec == nil {
+		return nil
+	}
+	return m.rec.dump()
+}
+
+// A flightRecorder is a ring of the last operations on a Map.
+//
+// Every slot is a seqlock of its own. A writer takes the index of its
+// record with an atomic add, marks the slot busy with a CAS, stores the
+// record and publishes it by storing its index + 1 as seq. A reader
+// accepts a slot if seq is the index it expects before and after reading
+// the record. seq only grows, so a reader cannot mistake a newer record
+// in the slot for the one it read.
+type flightRecorder struct {
+	next  uint64 // index of the next record; accessed atomically
+	slots []flightSlot
+}
+
+// flightBusy is the seq of a slot whose record is being written.
+const flightBusy = ^uint64(0)
+
+type flightSlot struct {
+	seq uint64 // index + 1 of the record in the slot, 0 if none, or flightBusy
+	// 全部用原子操作读写: 读者可能和写者同时访问一个slot, 读到一半被覆盖的
+	// 记录由seq发现并丢弃, 但读写本身不能是数据竞争
+	opPath   uint64 // op | path<<8 | found<<16
+	keyHash  uint64
+	goid     uint64
+	nanotime uint64
+}
+
+func (r *flightRecorder) record(op MapOp, path MapPath, key interface{}, found bool) {
+	var h uint64
+	if op != MapOpRange {
+		h = MapKeyHash(key)
+	}
+	i := atomic.AddUint64(&r.next, 1) - 1
+	s := &r.slots[i&uint64(len(r.slots)-1)]
+	for {
+		old := atomic.LoadUint64(&s.seq)
+		// 另一个写者正在写这个slot, 或者已经写了更新的记录:
+		// 丢掉这一条, 而不是等它, 记录永远不阻塞Map的操作
+		if old == flightBusy || old > i {
+			return
+		}
+		if atomic.CompareAndSwapUint64(&s.seq, old, flightBusy) {
+			break
+		}
+	}
+	w := uint64(op) | uint64(path)<<8
+	if found {
+		w |= 1 << 16
+	}
+	atomic.StoreUint64(&s.opPath, w)
+	atomic.StoreUint64(&s.keyHash, h)
+	atomic.StoreUint64(&s.goid, uint64(runtime_goid()))
+	atomic.StoreUint64(&s.nanotime, uint64(runtime_nanotime()))
+	atomic.StoreUint64(&s.seq, i+1)
+}
+
+func (r *flightRecorder) dump() []MapRecord {
+	next := atomic.LoadUint64(&r.next)
+	first := uint64(0)
+	if n := uint64(len(r.slots)); next > n {
+		first = next - n
+	}
+	recs := make([]MapRecord, 0, next-first)
+	for i := first; i < next; i++ {
+		s := &r.slots[i&uint64(len(r.slots)-1)]
+		if atomic.LoadUint64(&s.seq) != i+1 {
+			continue
+		}
+		w := atomic.LoadUint64(&s.opPath)
+		rec := MapRecord{
+			Op:        MapOp(w),
+			Path:      MapPath(w >> 8),
+			Found:     w&(1<<16) != 0,
+			KeyHash:   atomic.LoadUint64(&s.keyHash),
+			Goroutine: int64(atomic.LoadUint64(&s.goid)),
+			Nanotime:  int64(atomic.LoadUint64(&s.nanotime)),
+		}
+		if atomic.LoadUint64(&s.seq) != i+1 {
+			continue
+		}
+		recs = append(recs, rec)
+	}
+	// 读完之后才读时钟, Age不会是负数
+	now := runtime_nanotime()
+	for i := range recs {
+		recs[i].Age = now - recs[i].Nanotime
+	}
+	return recs
+}
@@ -0,0 +1,155 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMapFlightRecorder(t *testing.T) {
+	m := sync.NewMap(sync.WithFlightRecorder(16))
+	m.Store("a", 1) // 第一个新key
+	m.Store("a", 2) // read中没有, dirty中有
+	m.Load("a")     // miss, 提升
+	m.Store("a", 3) // read中有
+	m.Load("b")
+	m.Delete("a")
+	m.Store("c", 1) // 创建dirty, a被清除
+	m.Store("a", 4)
+	m.LoadOrStore("a", 5)
+	m.Range(func(k, v interface{}) bool { return true })
+
+	type rec struct {
+		op    sync.MapOp
+		path  sync.MapPath
+		key   interface{}
+		found bool
+	}
+	want := []rec{
+		{sync.MapOpStore, sync.MapPathNewKey, "a", false},
+		{sync.MapOpStore, sync.MapPathLocked, "a", false},
+		{sync.MapOpLoad, sync.MapPathLocked, "a", true},
+		{sync.MapOpStore, sync.MapPathRead, "a", false},
+		{sync.MapOpLoad, sync.MapPathRead, "b", false},
+		{sync.MapOpDelete, sync.MapPathRead, "a", false},
+		{sync.MapOpStore, sync.MapPathNewKey, "c", false},
+		{sync.MapOpStore, sync.MapPathUnexpunged, "a", false},
+		{sync.MapOpLoadOrStore, sync.MapPathRead, "a", true},
+		{sync.MapOpRange, sync.MapPathPromoted, nil, false},
+	}
+	recs := m.FlightRecord()
+	if len(recs) != len(want) {
+		t.Fatalf("FlightRecord returned %d records, want %d:\n%v", len(recs), len(want), recs)
+	}
+	for i, r := range recs {
+		w := want[i]
+		var h uint64
+		if w.key != nil {
+			h = sync.MapKeyHash(w.key)
+		}
+		if r.Op != w.op || r.Path != w.path || r.Found != w.found || r.KeyHash != h {
+			t.Errorf("record %d = %v, want %v %v %v found=%v", i, r, w.op, w.key, w.path, w.found)
+		}
+		if r.Age < 0 || i > 0 && r.Nanotime < recs[i-1].Nanotime {
+			t.Errorf("record %d: Nanotime %d, Age %d out of order", i, r.Nanotime, r.Age)
+		}
+	}
+	if s := recs[4].String(); !strings.HasPrefix(s, "load key=0x") || !strings.Contains(s, " path=read missing ") {
+		t.Errorf("String = %q", s)
+	}
+}
+
+func TestMapFlightRecorderWraps(t *testing.T) {
+	m := sync.NewMap(sync.WithFlightRecorder(5)) // 向上取整到8
+	for i := 0; i < 20; i++ {
+		m.Store(i, i)
+	}
+	recs := m.FlightRecord()
+	var got []uint64
+	for _, r := range recs {
+		got = append(got, r.KeyHash)
+	}
+	var want []uint64
+	for i := 12; i < 20; i++ {
+		want = append(want, sync.MapKeyHash(i))
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("after 20 Stores, FlightRecord kept %v, want the hashes of 12..19", recs)
+	}
+	if recs := new(sync.Map).FlightRecord(); recs != nil {
+		t.Errorf("FlightRecord of a Map without a recorder = %v", recs)
+	}
+}
+
+func TestMapFlightRecorderConcurrent(t *testing.T) {
+	const goroutines, ops = 4, 2000
+	m := sync.NewMap(sync.WithFlightRecorder(64))
+	var wg sync.WaitGroup
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			recs := m.FlightRecord()
+			if len(recs) > 64 {
+				t.Errorf("FlightRecord returned %d records from a ring of 64", len(recs))
+				return
+			}
+			for _, r := range recs {
+				// 每个goroutine只写自己的key, 一条撕裂的记录会把
+				// 一个goroutine的key和另一个的g配在一起
+				if r.Op != sync.MapOpStore && r.Op != sync.MapOpLoad {
+					t.Errorf("torn record %v", r)
+					return
+				}
+			}
+		}
+	}()
+	gids := make([]map[uint64]bool, goroutines)
+	for g := range gids {
+		gids[g] = make(map[uint64]bool)
+		for i := 0; i < ops; i++ {
+			gids[g][sync.MapKeyHash(g*ops+i)] = true
+		}
+	}
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < ops; i++ {
+				m.Store(g*ops+i, i)
+				m.Load(g*ops + i)
+			}
+		}(g)
+	}
+	wg.Wait()
+	close(stop)
+	<-done
+
+	owner := make(map[int64]int)
+	for _, r := range m.FlightRecord() {
+		g := -1
+		for i := range gids {
+			if gids[i][r.KeyHash] {
+				g = i
+			}
+		}
+		if g < 0 {
+			t.Fatalf("record %v has the hash of no stored key", r)
+		}
+		if o, ok := owner[r.Goroutine]; ok && o != g {
+			t.Fatalf("goroutine %d wrote keys of workers %d and %d", r.Goroutine, o, g)
+		}
+		owner[r.Goroutine] = g
+	}
+}
@@ -0,0 +1,54 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// A ReadOnlyMap is an immutable view of the contents of a Map at one
+// point in time, returned by Map.Freeze. It has no methods that modify it,
+// and later changes to the Map do not show through, so it can be handed
+// to code that must not change the Map, without a copy for each. The
+// values themselves are shared with the Map: a value that is a pointer
+// still points to the same variable.
+//
+// A ReadOnlyMap is safe for concurrent use, and needs no locking. The zero
+// ReadOnlyMap is empty.
+type ReadOnlyMap struct {
+	m map[interface{}]interface{}
+}
+
+// Freeze returns a ReadOnlyMap of the entries of m at one point in time
+// during the call. Like WriteSnapshot, it promotes the dirty map and takes
+// the values of the promoted read map as they were then, blocking neither
+// readers nor writers; the view holds its own index of those entries,
+// built once, in O(N) time and memory.
+func (m *Map) Freeze() ReadOnlyMap {
+	v := make(map[interface{}]interface{})
+	m.rangeSnapshot(mapOpFreeze, func(key, value interface{}) bool {
+		v[key] = value
+		return true
+	})
+	return ReadOnlyMap{m: v}
+}
+
+// Load returns the value for key in the view, or nil if there is none.
+// The ok result indicates whether value was found.
+func (r ReadOnlyMap) Load(key interface{}) (value interface{}, ok bool) {
+	value, ok = r.m[key]
+	return
+}
+
+// Range calls f sequentially for each key and value in the view. If f
+// returns false, Range stops the iteration.
+func (r ReadOnlyMap) Range(f func(key, value interface{}) bool) {
+	for k, v := range r.m {
+		if !f(k, v) {
+			break
+		}
+	}
+}
+
+// Len returns the number of entries in the view.
+func (r ReadOnlyMap) Len() int {
+	return len(r.m)
+}
@@ -0,0 +1,97 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestMapFreeze(t *testing.T) {
+	var m sync.Map
+	for i := 0; i < 100; i++ {
+		m.Store(i, i)
+	}
+	m.Delete(0)
+	m.Store("dirty", 1) // 只在dirty中, Freeze要提升它
+	r := m.Freeze()
+
+	m.Store(1, "changed")
+	m.Delete(2)
+	m.Store("later", 1)
+
+	if n := r.Len(); n != 100 {
+		t.Errorf("Len = %d; want 100", n)
+	}
+	if _, ok := r.Load(0); ok {
+		t.Error("deleted key in the view")
+	}
+	for k, want := range map[interface{}]interface{}{1: 1, 2: 2, "dirty": 1} {
+		if v, ok := r.Load(k); !ok || v != want {
+			t.Errorf("Load(%v) = %v, %v; want %v, the value at Freeze", k, v, ok, want)
+		}
+	}
+	if _, ok := r.Load("later"); ok {
+		t.Error("key stored after Freeze in the view")
+	}
+	n := 0
+	r.Range(func(k, v interface{}) bool {
+		n++
+		return n < 10
+	})
+	if n != 10 {
+		t.Errorf("Range visited %d entries after f returned false at 10", n)
+	}
+
+	var zero sync.ReadOnlyMap
+	if _, ok := zero.Load(1); ok || zero.Len() != 0 {
+		t.Error("zero ReadOnlyMap not empty")
+	}
+}
+
+// 并发的写者一轮一轮地覆盖所有key, 视图中的值必须是某一时刻的:
+// 前面几个key是r, 其余是r-1
+func TestMapFreezeConsistent(t *testing.T) {
+	const n = 1000
+	var m sync.Map
+	for k := 0; k < n; k++ {
+		m.Store(k, 0)
+	}
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for r := 1; ; r++ {
+			for k := 0; k < n; k++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				m.Store(k, r)
+			}
+		}
+	}()
+	for i := 0; i < 20; i++ {
+		view := m.Freeze()
+		top, _ := view.Load(0)
+		step := n
+		for k := 0; k < n; k++ {
+			v, _ := view.Load(k)
+			switch {
+			case v == top && step == n:
+			case v == top.(int)-1 && (step == n || step < k):
+				if step == n {
+					step = k
+				}
+			default:
+				t.Fatalf("view is not a point in time: key %d = %v, key 0 = %v, step at %d", k, v, top, step)
+			}
+		}
+	}
+	close(stop)
+	wg.Wait()
+}
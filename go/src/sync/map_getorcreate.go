@@ -0,0 +1,76 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// An initCall is a GetOrCreate running init. v and err are written
+// before wg is done, and read after.
+type initCall struct {
+	wg  WaitGroup
+	v   interface{}
+	err error
+}
+
+// GetOrCreate returns the value for key, calling init to create it if key
+// is not present. It is LoadOrStore for a value that is expensive or may
+// fail to create: concurrent GetOrCreates of the same key wait for a
+// single call of init, as the callers of a OnceError's Do do, and return
+// its value or its error.
+//
+// A failed init is not cached. The callers that waited for it get its
+// error, and the next GetOrCreate of the key calls init again. If init
+// panics, the panic propagates to the caller that ran it, and the callers
+// that waited for it get an error reporting the panic.
+//
+// The value init returns is stored as by LoadOrStore: if a Store of key
+// happened while init ran, GetOrCreate returns the stored value instead.
+func (m *Map) GetOrCreate(key interface{}, init func() (interface{}, error)) (interface{}, error) {
+	if v, ok := m.Load(key); ok {
+		return v, nil
+	}
+	m.initMu.Lock()
+	if c, ok := m.inits[key]; ok {
+		m.initMu.Unlock()
+		c.wg.Wait()
+		return c.v, c.err
+	}
+	// 加锁之前刚好有一次init完成: 它在从inits删除之前已经存入了值
+	if v, ok := m.Load(key); ok {
+		m.initMu.Unlock()
+		return v, nil
+	}
+	c := new(initCall)
+	c.wg.Add(1)
+	if m.inits == nil {
+		m.inits = make(map[interface{}]*initCall)
+	}
+	m.inits[key] = c
+	m.initMu.Unlock()
+
+	m.runInit(key, c, init)
+	return c.v, c.err
+}
+
+// runInit calls init for c, stores its value if it succeeds, and then
+// releases the callers waiting for c.
+func (m *Map) runInit(key interface{}, c *initCall, init func() (interface{}, error)) {
+	defer func() {
+		// 先存入值再删除c, 之后的调用者要么等c, 要么Load到值
+		m.initMu.Lock()
+		delete(m.inits, key)
+		m.initMu.Unlock()
+		c.wg.Done()
+	}()
+	// init正常返回时被覆盖, panic的话等待者看到这个错误
+	c.err = errInitPanicked
+	v, err := init()
+	if err != nil {
+		c.v, c.err = nil, err
+		return
+	}
+	c.v, _ = m.LoadOrStore(key, v)
+	c.err = nil
+}
+
+var errInitPanicked error = onceError("sync: GetOrCreate init panicked")
@@ -0,0 +1,127 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMapGetOrCreate(t *testing.T) {
+	var m sync.Map
+	var calls int32
+	release := make(chan struct{})
+	init := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "v", nil
+	}
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := m.GetOrCreate("k", init); v != "v" || err != nil {
+				t.Errorf("GetOrCreate = %v, %v", v, err)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if n := atomic.LoadInt32(&calls); n != 1 {
+		t.Errorf("init called %d times; want 1", n)
+	}
+	if v, ok := m.Load("k"); v != "v" || !ok {
+		t.Errorf("Load = %v, %v after GetOrCreate", v, ok)
+	}
+	v, err := m.GetOrCreate("k", func() (interface{}, error) {
+		t.Error("init called for a present key")
+		return nil, nil
+	})
+	if v != "v" || err != nil {
+		t.Errorf("GetOrCreate of a present key = %v, %v", v, err)
+	}
+}
+
+func TestMapGetOrCreateError(t *testing.T) {
+	var m sync.Map
+	errInit := errors.New("init failed")
+	release := make(chan struct{})
+	var wg sync.WaitGroup
+	var failed int32
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := m.GetOrCreate("k", func() (interface{}, error) {
+				<-release
+				return nil, errInit
+			})
+			if err == errInit {
+				atomic.AddInt32(&failed, 1)
+			}
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if _, ok := m.Load("k"); ok {
+		t.Error("failed init stored a value")
+	}
+	if failed == 0 {
+		t.Error("no caller got the error of init")
+	}
+	// 失败不缓存, 下一次重新初始化
+	v, err := m.GetOrCreate("k", func() (interface{}, error) { return 1, nil })
+	if v != 1 || err != nil {
+		t.Errorf("GetOrCreate after a failed init = %v, %v", v, err)
+	}
+}
+
+func TestMapGetOrCreatePanic(t *testing.T) {
+	var m sync.Map
+	started := make(chan struct{})
+	waited := make(chan error)
+	go func() {
+		<-started
+		_, err := m.GetOrCreate("k", func() (interface{}, error) { return 1, nil })
+		waited <- err
+	}()
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("panic of init did not propagate")
+			}
+		}()
+		m.GetOrCreate("k", func() (interface{}, error) {
+			close(started)
+			time.Sleep(10 * time.Millisecond)
+			panic("boom")
+		})
+	}()
+	// 等待者拿到报告panic的错误; 来得太晚的话它自己初始化成功
+	if err := <-waited; err != nil && err.Error() != "sync: GetOrCreate init panicked" {
+		t.Errorf("waiter got %v", err)
+	}
+	if v, err := m.GetOrCreate("k", func() (interface{}, error) { return 2, nil }); err != nil || v == nil {
+		t.Errorf("GetOrCreate after a panic = %v, %v", v, err)
+	}
+}
+
+// init期间有Store的话, 返回Store的值
+func TestMapGetOrCreateStoredMeanwhile(t *testing.T) {
+	var m sync.Map
+	v, err := m.GetOrCreate("k", func() (interface{}, error) {
+		m.Store("k", "stored")
+		return "created", nil
+	})
+	if v != "stored" || err != nil {
+		t.Errorf("GetOrCreate = %v, %v; want the value stored meanwhile", v, err)
+	}
+}
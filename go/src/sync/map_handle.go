@@ -0,0 +1,134 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// An EntryHandle is an entry of a Map that RangeEntries has located. Its
+// methods work on the entry directly, without looking the key up again.
+//
+// A handle is meant for the call of f it is passed to. Afterwards it
+// still refers to the same entry, but once the key is deleted the Map may
+// drop the entry, and a later Store of the key then goes to a new one:
+// the handle reports the key absent, and its writes fail, whatever the
+// key holds.
+type EntryHandle struct {
+	m     *Map
+	key   interface{}
+	e     *entry
+	bloom *mapBloom // the filter of the read map e is in
+}
+
+// RangeEntries calls f sequentially for each key present in the map,
+// with a handle on its entry, as Range calls f with the key and value. If
+// f returns false, RangeEntries stops the iteration.
+//
+// It visits the entries Range would, and like Range, it does not copy
+// the map. A read-modify-write of each value, such as
+//
+//	m.RangeEntries(func(h sync.EntryHandle) bool {
+//		if v, ok := h.Load(); ok {
+//			h.CompareAndSwap(v, v.(int)+1)
+//		}
+//		return true
+//	})
+//
+// costs no lookup of the key beyond the iteration itself.
+func (m *Map) RangeEntries(f func(h EntryHandle) bool) {
+	read := m.rangeRead()
+	read.m.iterate(func(k interface{}, e *entry) bool {
+		if p := atomic.LoadPointer(&e.p); p == nil || p == expunged {
+			return true
+		}
+		return f(EntryHandle{m: m, key: k, e: e, bloom: read.bloom})
+	})
+}
+
+// Key returns the key of the entry.
+func (h EntryHandle) Key() interface{} { return h.key }
+
+// Load returns the value of the entry, as Map.Load does for its key. ok
+// is false if the key has been deleted.
+func (h EntryHandle) Load() (value interface{}, ok bool) {
+	m := h.m
+	value, ok = h.e.load()
+	if ok && m.entryStats {
+		h.e.stats().touch(true)
+	}
+	if ok && m.compress != nil {
+		value = m.compress.decode(value)
+	}
+	if m.rec != nil {
+		m.rec.record(MapOpLoad, MapPathRead, h.key, ok)
+	}
+	return value, ok
+}
+
+// CompareAndSwap stores new for the key if its value is old, and reports
+// whether it did. It does nothing if the key has been deleted. The values
+// are compared with ==, so old must be of a comparable type.
+func (h EntryHandle) CompareAndSwap(old, new interface{}) bool {
+	m, e := h.m, h.e
+	if ix := m.index; ix != nil {
+		ix.mu.Lock()
+		defer ix.mu.Unlock()
+	}
+	v := m.encodeValue(new)
+	sh := m.beginEntryWrite(e)
+	p, swapped := m.compareAndSwapEntry(e, old, &v)
+	m.endEntryWrite(sh, e, p, swapped)
+	if !swapped {
+		return false
+	}
+	if ix := m.index; ix != nil {
+		ix.setLocked(h.key, new, true)
+	}
+	if m.entryStats {
+		e.stats().touch(false)
+	}
+	if m.rec != nil {
+		m.rec.record(MapOpStore, MapPathRead, h.key, false)
+	}
+	return true
+}
+
+// compareAndSwapEntry replaces the value of e with new if it is present
+// and decodes to old, and returns the pointer it replaced.
+func (m *Map) compareAndSwapEntry(e *entry, old interface{}, new *interface{}) (unsafe.Pointer, bool) {
+	for {
+		p := atomic.LoadPointer(&e.p)
+		if p == nil || p == expunged || m.decodeValue(*(*interface{})(p)) != old {
+			return nil, false
+		}
+		if atomic.CompareAndSwapPointer(&e.p, p, unsafe.Pointer(new)) {
+			return p, true
+		}
+	}
+}
+
+// Delete deletes the key, as Map.Delete does, if the entry still holds
+// it.
+func (h EntryHandle) Delete() {
+	m, e := h.m, h.e
+	if ix := m.index; ix != nil {
+		ix.mu.Lock()
+		defer ix.mu.Unlock()
+	}
+	sh := m.beginEntryWrite(e)
+	old, deleted := e.delete()
+	m.endEntryWrite(sh, e, old, deleted)
+	if deleted {
+		h.bloom.remove(h.bloom.hash(h.key))
+	}
+	if deleted && m.index != nil {
+		m.index.setLocked(h.key, nil, false)
+	}
+	if m.rec != nil {
+		m.rec.record(MapOpDelete, MapPathRead, h.key, false)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestMapRangeEntries(t *testing.T) {
+	m := new(sync.Map)
+	for i := 0; i < 10; i++ {
+		m.Store(i, i)
+	}
+	m.Delete(9)
+	n := 0
+	m.RangeEntries(func(h sync.EntryHandle) bool {
+		n++
+		k := h.Key().(int)
+		v, ok := h.Load()
+		if !ok || v != k {
+			t.Fatalf("Load of %d = %v, %v", k, v, ok)
+		}
+		if k%2 == 0 {
+			h.Delete()
+		} else if !h.CompareAndSwap(v, v.(int)*10) {
+			t.Errorf("CompareAndSwap of %d failed", k)
+		}
+		return true
+	})
+	if n != 9 {
+		t.Errorf("visited %d entries, want 9", n)
+	}
+	for i := 0; i < 10; i++ {
+		v, ok := m.Load(i)
+		if i%2 == 0 || i == 9 {
+			if ok {
+				t.Errorf("%d = %v after Delete", i, v)
+			}
+		} else if !ok || v != i*10 {
+			t.Errorf("%d = %v, %v; want %d", i, v, ok, i*10)
+		}
+	}
+
+	// 旧值不对, 或者key已经被删除, CompareAndSwap都不写
+	m.RangeEntries(func(h sync.EntryHandle) bool {
+		if h.CompareAndSwap(-1, 0) {
+			t.Errorf("CompareAndSwap of %v with a wrong old value succeeded", h.Key())
+		}
+		v, _ := h.Load()
+		m.Delete(h.Key())
+		if h.CompareAndSwap(v, 0) {
+			t.Errorf("CompareAndSwap of deleted %v succeeded", h.Key())
+		}
+		if _, ok := h.Load(); ok {
+			t.Errorf("Load of deleted %v succeeded", h.Key())
+		}
+		return false
+	})
+}
+
+func TestMapRangeEntriesIndex(t *testing.T) {
+	// user有切片, 不能比较; 这里的值是租户本身
+	m := sync.NewMap(sync.WithIndex(func(v interface{}) []string {
+		return []string{"tenant:" + v.(string)}
+	}))
+	m.Store("a", "t1")
+	m.Store("b", "t1")
+	m.RangeEntries(func(h sync.EntryHandle) bool {
+		if h.Key() == "a" {
+			h.CompareAndSwap("t1", "t2")
+		} else {
+			h.Delete()
+		}
+		return true
+	})
+	if got := indexKeys(m.LoadByIndex("tenant:t1")); len(got) != 0 {
+		t.Errorf("tenant:t1 = %v after the swap and the delete", got)
+	}
+	if got := indexKeys(m.LoadByIndex("tenant:t2")); len(got) != 1 || got[0] != "a" {
+		t.Errorf("tenant:t2 = %v, want [a]", got)
+	}
+}
+
+// 几个goroutine同时用CompareAndSwap给所有的值加一, 一次也不丢
+func TestMapRangeEntriesConcurrent(t *testing.T) {
+	m := new(sync.Map)
+	const keys, goroutines, rounds = 100, 4, 50
+	for i := 0; i < keys; i++ {
+		m.Store(i, 0)
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				m.RangeEntries(func(h sync.EntryHandle) bool {
+					for {
+						v, _ := h.Load()
+						if h.CompareAndSwap(v, v.(int)+1) {
+							return true
+						}
+					}
+				})
+			}
+		}()
+	}
+	wg.Wait()
+	m.Range(func(k, v interface{}) bool {
+		if v != goroutines*rounds {
+			t.Errorf("%v = %v, want %d", k, v, goroutines*rounds)
+		}
+		return true
+	})
+}
+
+func BenchmarkMapRangeEntries(b *testing.B) {
+	const n = 1 << 12
+	m := new(sync.Map)
+	for i := 0; i < n; i++ {
+		m.Store(i, 0)
+	}
+	b.Run("Range+Store", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			m.Range(func(k, v interface{}) bool {
+				m.Store(k, v.(int)+1)
+				return true
+			})
+		}
+	})
+	b.Run("RangeEntries", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			m.RangeEntries(func(h sync.EntryHandle) bool {
+				v, _ := h.Load()
+				h.CompareAndSwap(v, v.(int)+1)
+				return true
+			})
+		}
+	})
+}
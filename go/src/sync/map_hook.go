@@ -0,0 +1,208 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import "sync/atomic"
+
+// A MapTransition is a change of the internal state of a Map, as reported
+// to the hook installed by WithTransitionHook.
+type MapTransition int
+
+const (
+	// MapMiss: a Load or LoadOrStore missed the read map and counted a
+	// miss. Key is the key looked up.
+	MapMiss MapTransition = iota
+
+	// MapDirtyCreated: the first new key since the last promotion made the
+	// Map copy the live entries of the read map into a new dirty map, and
+	// mark the read map amended. Deleted entries were expunged on the way.
+	// Key is the new key, which is not stored yet.
+	MapDirtyCreated
+
+	// MapDirtyStored: a new key was stored into the dirty map.
+	MapDirtyStored
+
+	// MapUnexpunged: a key deleted while the dirty map was created was
+	// stored again, and its entry was put back into the dirty map.
+	MapUnexpunged
+
+	// MapDirtyDeleted: a Delete of a key missing from the read map was
+	// applied to the dirty map, either by Delete itself or, for a Delete
+	// that found the Map locked, by the next goroutine to lock it. The key
+	// need not have been in the dirty map.
+	MapDirtyDeleted
+
+	// MapPromoted: the dirty map became the read map, because of misses
+	// (Key is the key of the last miss) or because of Range or Promote
+	// (Key is nil).
+	MapPromoted
+
+	// MapReplaced: ReplaceAll made a new read map of its own the read map,
+	// and dropped the dirty map. Key is nil.
+	MapReplaced
+)
+
+var mapTransitionNames = [...]string{
+	MapMiss:         "miss",
+	MapDirtyCreated: "dirty-created",
+	MapDirtyStored:  "dirty-stored",
+	MapUnexpunged:   "unexpunged",
+	MapDirtyDeleted: "dirty-deleted",
+	MapPromoted:     "promoted",
+	MapReplaced:     "replaced",
+}
+
+func (t MapTransition) String() string {
+	if t >= 0 && int(t) < len(mapTransitionNames) {
+		return mapTransitionNames[t]
+	}
+	return "MapTransition(" + itoa(int(t)) + ")"
+}
+
+// A MapEvent describes a transition and the state of the Map right after it.
+type MapEvent struct {
+	Transition MapTransition
+	Key        interface{}
+
+	Read    int  // keys in the read map, including deleted ones not yet expunged
+	Dirty   int  // keys in the dirty map, or -1 if there is none
+	Amended bool // whether the dirty map has keys the read map lacks
+	Misses  int  // misses since the last promotion
+
+	m *Map
+}
+
+// State returns the full state of the Map right after the transition. It
+// must be called from the hook, while the Map's mutex is still held.
+func (e MapEvent) State() MapState {
+	return e.m.stateLocked()
+}
+
+// WithTransitionHook makes the Map call f after each of its internal
+// transitions. f runs on the goroutine that made the transition, with the
+// Map's mutex held: it must not call methods of the Map, and while it runs
+// every other slow path of the Map waits, although Loads of keys in the
+// read map still succeed. This makes f a breakpoint: blocking in it stops
+// the Map in the state described by the event.
+func WithTransitionHook(f func(MapEvent)) MapOption {
+	return func(m *Map) {
+		m.hook = f
+	}
+}
+
+// transitionLocked reports t to the hook, if any. m.mu must be held.
+func (m *Map) transitionLocked(t MapTransition, key interface{}) {
+	if m.hook == nil {
+		return
+	}
+	read, _ := m.read.Load().(readOnly)
+	ev := MapEvent{
+		Transition: t,
+		Key:        key,
+		Read:       read.m.len(),
+		Dirty:      -1,
+		Amended:    read.amended,
+		Misses:     m.misses,
+		m:          m,
+	}
+	if !m.dirty.isNil() {
+		ev.Dirty = m.dirty.len()
+	}
+	m.hook(ev)
+}
+
+// A MapEntryState is the state of an entry of a Map.
+type MapEntryState int
+
+const (
+	// MapEntryLive: the entry holds a value.
+	MapEntryLive MapEntryState = iota
+
+	// MapEntryDeleted: the key was deleted. The entry stays in the read
+	// map, and in the dirty map if there is one, until the next copy of
+	// the read map drops it.
+	MapEntryDeleted
+
+	// MapEntryExpunged: the key was deleted, and left out of the dirty map
+	// when it was created. The entry is only in the read map, and a Store
+	// of the key must put it back into the dirty map.
+	MapEntryExpunged
+)
+
+var mapEntryStateNames = [...]string{
+	MapEntryLive:     "live",
+	MapEntryDeleted:  "deleted",
+	MapEntryExpunged: "expunged",
+}
+
+func (s MapEntryState) String() string {
+	if s >= 0 && int(s) < len(mapEntryStateNames) {
+		return mapEntryStateNames[s]
+	}
+	return "MapEntryState(" + itoa(int(s)) + ")"
+}
+
+// A MapEntry is a key of a Map and the state of its entry.
+type MapEntry struct {
+	Key   interface{}
+	Value interface{} // nil unless State is MapEntryLive
+	State MapEntryState
+}
+
+// MapState is the full internal state of a Map, for debugging and
+// teaching tools. The entries of Read and Dirty are in no particular
+// order; an entry in both is the same one, so it has the same state.
+type MapState struct {
+	Read    []MapEntry
+	Dirty   []MapEntry // nil if there is no dirty map
+	Amended bool       // whether the dirty map has keys the read map lacks
+	Misses  int        // misses since the last promotion
+}
+
+// State returns the full state of m. It locks m, so unlike Load it waits
+// for the slow paths of other goroutines; it must not be called from a
+// transition hook, which can use MapEvent.State instead.
+func (m *Map) State() MapState {
+	m.lock(mapOpState)
+	defer m.unlock()
+	return m.stateLocked()
+}
+
+// stateLocked implements State. m.mu must be held. The entries of the
+// read map can still change under it, through the fast paths, so each
+// state is what one atomic load of the entry saw.
+func (m *Map) stateLocked() MapState {
+	read, _ := m.read.Load().(readOnly)
+	s := MapState{
+		Read:    m.entryStates(read.m),
+		Amended: read.amended,
+		Misses:  m.misses,
+	}
+	if !m.dirty.isNil() {
+		s.Dirty = m.entryStates(m.dirty)
+		if s.Dirty == nil {
+			s.Dirty = []MapEntry{}
+		}
+	}
+	return s
+}
+
+func (m *Map) entryStates(es entries) []MapEntry {
+	var s []MapEntry
+	es.iterate(func(k interface{}, e *entry) bool {
+		me := MapEntry{Key: k}
+		switch p := atomic.LoadPointer(&e.p); p {
+		case nil:
+			me.State = MapEntryDeleted
+		case expunged:
+			me.State = MapEntryExpunged
+		default:
+			me.Value = m.decodeValue(*(*interface{})(p))
+		}
+		s = append(s, me)
+		return true
+	})
+	return s
+}
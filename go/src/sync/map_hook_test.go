@@ -0,0 +1,150 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestMapTransitionHook(t *testing.T) {
+	var got []string
+	m := sync.NewMap(sync.WithTransitionHook(func(e sync.MapEvent) {
+		got = append(got, fmt.Sprintf("%v %v read=%d dirty=%d amended=%v misses=%d",
+			e.Transition, e.Key, e.Read, e.Dirty, e.Amended, e.Misses))
+	}))
+	m.Store("a", 1)
+	m.Load("a")
+	m.Delete("a")
+	m.Store("b", 2) // 创建dirty, 清除a
+	m.Store("a", 1)
+	m.Delete("b")
+	m.LoadOrStore("d", 4)
+	m.Range(func(k, v interface{}) bool { return true })
+	want := []string{
+		"dirty-created a read=0 dirty=0 amended=true misses=0",
+		"dirty-stored a read=0 dirty=1 amended=true misses=0",
+		"miss a read=0 dirty=1 amended=true misses=1",
+		"promoted a read=1 dirty=-1 amended=false misses=0",
+		"dirty-created b read=1 dirty=0 amended=true misses=0",
+		"dirty-stored b read=1 dirty=1 amended=true misses=0",
+		"unexpunged a read=1 dirty=2 amended=true misses=0",
+		"dirty-deleted b read=1 dirty=1 amended=true misses=0",
+		"dirty-stored d read=1 dirty=2 amended=true misses=0",
+		"promoted <nil> read=2 dirty=-1 amended=false misses=0",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("transitions:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+// TestMapTransitionHookBlocks checks that a hook blocked in a transition
+// holds up the slow paths of the Map but not loads from the read map.
+func TestMapTransitionHookBlocks(t *testing.T) {
+	hold := make(chan struct{})
+	held := make(chan sync.MapEvent)
+	m := sync.NewMap(sync.WithTransitionHook(func(e sync.MapEvent) {
+		if e.Transition == sync.MapDirtyStored && e.Key == "new" {
+			held <- e
+			<-hold
+		}
+	}))
+	m.Store("old", 1)
+	m.Load("old") // promote
+
+	stored := make(chan struct{})
+	go func() {
+		m.Store("new", 2)
+		close(stored)
+	}()
+	<-held
+	if v, ok := m.Load("old"); !ok || v != 1 {
+		t.Errorf("Load(old) while the hook blocks = %v, %v; want 1, true", v, ok)
+	}
+	slow := make(chan struct{})
+	go func() {
+		m.Store("other", 3)
+		close(slow)
+	}()
+	select {
+	case <-slow:
+		t.Fatal("Store of a new key finished while the hook held the Map")
+	case <-stored:
+		t.Fatal("Store finished while the hook blocked")
+	default:
+	}
+	close(hold)
+	<-stored
+	<-slow
+	if v, ok := m.Load("other"); !ok || v != 3 {
+		t.Errorf("Load(other) = %v, %v; want 3, true", v, ok)
+	}
+}
+
+// states formats the entries of a MapState sorted by key.
+func states(es []sync.MapEntry) string {
+	s := make([]string, len(es))
+	for i, e := range es {
+		s[i] = fmt.Sprintf("%v=%v", e.Key, e.State)
+		if e.State == sync.MapEntryLive {
+			s[i] = fmt.Sprintf("%v:%v", s[i], e.Value)
+		}
+	}
+	sort.Strings(s)
+	return strings.Join(s, " ")
+}
+
+func TestMapState(t *testing.T) {
+	m := sync.NewMap()
+	if s := m.State(); s.Read != nil || s.Dirty != nil || s.Amended {
+		t.Fatalf("empty map: %+v", s)
+	}
+	m.Store("a", 1)
+	m.Store("b", 2)
+	m.Promote()
+	m.Delete("a")
+	s := m.State()
+	if got, want := states(s.Read), "a=deleted b=live:2"; got != want || s.Dirty != nil {
+		t.Fatalf("after Delete: read %q dirty %v, want read %q and no dirty", got, s.Dirty, want)
+	}
+
+	m.Store("c", 3) // 创建dirty, a被标记为expunged
+	s = m.State()
+	if got, want := states(s.Read), "a=expunged b=live:2"; got != want {
+		t.Errorf("read = %q, want %q", got, want)
+	}
+	if got, want := states(s.Dirty), "b=live:2 c=live:3"; got != want {
+		t.Errorf("dirty = %q, want %q", got, want)
+	}
+	if !s.Amended {
+		t.Error("not amended")
+	}
+}
+
+// TestMapEventState checks that the hook sees the entry expunged as soon
+// as the dirty map is created, before the new key is stored.
+func TestMapEventState(t *testing.T) {
+	var read, dirty string
+	m := sync.NewMap(sync.WithTransitionHook(func(e sync.MapEvent) {
+		if e.Transition == sync.MapDirtyCreated && e.Key == "b" {
+			s := e.State()
+			read, dirty = states(s.Read), states(s.Dirty)
+			if s.Dirty == nil {
+				dirty = "nil"
+			}
+		}
+	}))
+	m.Store("a", 1)
+	m.Promote()
+	m.Delete("a")
+	m.Store("b", 2)
+	if read != "a=expunged" || dirty != "" {
+		t.Errorf("at dirty-created: read %q dirty %q, want %q and empty", read, dirty, "a=expunged")
+	}
+}
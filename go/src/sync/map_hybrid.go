@@ -0,0 +1,419 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+// A HybridMode is the algorithm a HybridMap is currently using.
+type HybridMode int
+
+const (
+	// HybridReadDirty stores the contents in a Map. It wins when keys are
+	// read far more often than new keys are added.
+	HybridReadDirty HybridMode = iota
+
+	// HybridRWMutex stores the contents in hash-sharded maps, each guarded
+	// by an RWMutex. It wins when new keys keep arriving, which would make a
+	// Map copy its read map over and over.
+	HybridRWMutex
+)
+
+func (m HybridMode) String() string {
+	switch m {
+	case HybridReadDirty:
+		return "read-dirty"
+	case HybridRWMutex:
+		return "rwmutex"
+	}
+	return "HybridMode(" + itoa(int(m)) + ")"
+}
+
+// HybridMap is like a Map but switches between Map's read/dirty algorithm
+// and a sharded RWMutex map as the workload changes.
+//
+// Every hybridWindow operations on one P, the map compares the share of
+// operations that needed a lock under the current algorithm against a
+// threshold: while using a Map, loads that missed the read map and stores of
+// new keys; while using RWMutex shards, stores of new keys only, since that
+// is what would make a Map slow. The two thresholds are far apart, so a
+// steady workload does not flip back and forth.
+//
+// A switch copies the whole map while no other operation is in progress, so
+// its cost is proportional to the size of the map. Operations otherwise
+// announce themselves on a per-P counter and never share a cache line with
+// operations on other Ps.
+//
+// The zero HybridMap is empty, uses HybridReadDirty and is ready for use.
+// A HybridMap must not be copied after first use.
+type HybridMap struct {
+	switches  int64          // accessed atomically; first so it is 64-bit aligned
+	impl      unsafe.Pointer // *hybridImpl
+	slots     unsafe.Pointer // *hybridSlots
+	switching uint32
+	mu        Mutex // serializes switches and the lazy allocation of impl and slots
+}
+
+const (
+	// hybridWindow is the number of operations on a P between policy
+	// evaluations.
+	hybridWindow = 1 << 12
+
+	// A Map is replaced by RWMutex shards when more than 1/hybridToRWMutex
+	// of the operations take its lock, and RWMutex shards are replaced by a
+	// Map when fewer than 1/hybridToReadDirty of them store a new key.
+	hybridToRWMutex   = 8
+	hybridToReadDirty = 64
+)
+
+type hybridImpl struct {
+	mode   HybridMode
+	m      *Map
+	shards *rwShards
+
+	// baseOps and baseSlow are the operation and slow-operation counts when
+	// the last window was evaluated. They are guarded by HybridMap.mu.
+	baseOps, baseSlow uint64
+}
+
+type hybridSlots struct {
+	s []hybridSlot
+}
+
+// A hybridSlot counts the operations started on one P.
+type hybridSlot struct {
+	hybridSlotInternal
+
+	// Prevents false sharing on widespread platforms with
+	// 128 mod (cache line size) = 0 .
+	pad [cacheLinePad - unsafe.Sizeof(hybridSlotInternal{})%cacheLinePad]byte
+}
+
+type hybridSlotInternal struct {
+	// state packs the number of operations in progress into its low
+	// hybridActiveBits bits and the number of operations completed into
+	// the rest, so that entering and exiting cost one atomic add each.
+	state   uint64
+	newKeys uint64 // stores of keys that were not present, RWMutex mode only
+}
+
+const (
+	hybridActiveBits = 20
+	hybridActiveMask = 1<<hybridActiveBits - 1
+)
+
+// enter announces an operation and returns the implementation to run it on
+// and the slot to pass to exit.
+func (h *HybridMap) enter() (*hybridImpl, *hybridSlot) {
+	for {
+		slots := (*hybridSlots)(atomic.LoadPointer(&h.slots))
+		if slots == nil {
+			h.init()
+			continue
+		}
+		pid := runtime_procPin()
+		runtime_procUnpin()
+		s := &slots.s[pid%len(slots.s)]
+		atomic.AddUint64(&s.state, 1)
+		// 先登记再检查switching, 切换方先设置switching再检查active,
+		// 两边总有一方能看到对方
+		if atomic.LoadUint32(&h.switching) == 0 {
+			return (*hybridImpl)(atomic.LoadPointer(&h.impl)), s
+		}
+		atomic.AddUint64(&s.state, ^uint64(0))
+		// 等待切换结束
+		h.mu.Lock()
+		h.mu.Unlock()
+	}
+}
+
+// exit ends an operation announced by enter and, at the end of a window,
+// evaluates whether to switch algorithms.
+func (h *HybridMap) exit(s *hybridSlot) {
+	// 同时把进行中的数量减一, 完成的数量加一
+	state := atomic.AddUint64(&s.state, 1<<hybridActiveBits-1)
+	if (state>>hybridActiveBits)%hybridWindow == 0 {
+		h.evaluate()
+	}
+}
+
+func (h *HybridMap) init() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.slots != nil {
+		return
+	}
+	atomic.StorePointer(&h.impl, unsafe.Pointer(&hybridImpl{mode: HybridReadDirty, m: new(Map)}))
+	slots := &hybridSlots{s: make([]hybridSlot, runtime.GOMAXPROCS(0))}
+	atomic.StorePointer(&h.slots, unsafe.Pointer(slots))
+}
+
+// counts returns the total number of operations and of stores of new keys
+// counted by the slots.
+func (h *HybridMap) counts() (ops, newKeys uint64) {
+	slots := (*hybridSlots)(atomic.LoadPointer(&h.slots))
+	for i := range slots.s {
+		ops += atomic.LoadUint64(&slots.s[i].state) >> hybridActiveBits
+		newKeys += atomic.LoadUint64(&slots.s[i].newKeys)
+	}
+	return ops, newKeys
+}
+
+func (h *HybridMap) evaluate() {
+	if !h.mu.tryLock() {
+		// 别的goroutine正在评估或切换
+		return
+	}
+	defer h.mu.Unlock()
+
+	impl := (*hybridImpl)(h.impl)
+	ops, slow := h.counts()
+	if impl.mode == HybridReadDirty {
+		s := impl.m.Stats()
+		slow = uint64(s.Misses + s.Writes)
+	}
+	dOps, dSlow := ops-impl.baseOps, slow-impl.baseSlow
+	impl.baseOps, impl.baseSlow = ops, slow
+	if dOps < hybridWindow {
+		return
+	}
+	switch impl.mode {
+	case HybridReadDirty:
+		if dSlow*hybridToRWMutex > dOps {
+			h.switchLocked(HybridRWMutex)
+		}
+	case HybridRWMutex:
+		if dSlow*hybridToReadDirty < dOps {
+			h.switchLocked(HybridReadDirty)
+		}
+	}
+}
+
+// switchLocked moves the contents of h to a new implementation of the given
+// mode. h.mu must be held.
+func (h *HybridMap) switchLocked(mode HybridMode) {
+	atomic.StoreUint32(&h.switching, 1)
+	slots := (*hybridSlots)(h.slots)
+	for i := range slots.s {
+		for atomic.LoadUint64(&slots.s[i].state)&hybridActiveMask != 0 {
+			runtime.Gosched()
+		}
+	}
+
+	old := (*hybridImpl)(h.impl)
+	next := &hybridImpl{mode: mode}
+	switch mode {
+	case HybridReadDirty:
+		next.m = new(Map)
+		old.shards.rangeAll(func(k, v interface{}) bool {
+			next.m.Store(k, v)
+			return true
+		})
+		// 新Map的Stats已经包含了上面搬迁时的写入, 以它为基准
+		st := next.m.Stats()
+		next.baseOps, _ = h.counts()
+		next.baseSlow = uint64(st.Misses + st.Writes)
+	case HybridRWMutex:
+		next.shards = newRWShards()
+		old.m.Range(func(k, v interface{}) bool {
+			next.shards.store(k, v)
+			return true
+		})
+		next.baseOps, next.baseSlow = h.counts()
+	}
+	atomic.StorePointer(&h.impl, unsafe.Pointer(next))
+	atomic.AddInt64(&h.switches, 1)
+	atomic.StoreUint32(&h.switching, 0)
+}
+
+// Load returns the value stored in the map for a key, or nil if no
+// value is present.
+// The ok result indicates whether value was found in the map.
+func (h *HybridMap) Load(key interface{}) (value interface{}, ok bool) {
+	impl, s := h.enter()
+	if impl.mode == HybridReadDirty {
+		value, ok = impl.m.Load(key)
+	} else {
+		value, ok = impl.shards.load(key)
+	}
+	h.exit(s)
+	return value, ok
+}
+
+// Store sets the value for a key.
+func (h *HybridMap) Store(key, value interface{}) {
+	impl, s := h.enter()
+	if impl.mode == HybridReadDirty {
+		impl.m.Store(key, value)
+	} else if impl.shards.store(key, value) {
+		atomic.AddUint64(&s.newKeys, 1)
+	}
+	h.exit(s)
+}
+
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value.
+// The loaded result is true if the value was loaded, false if stored.
+func (h *HybridMap) LoadOrStore(key, value interface{}) (actual interface{}, loaded bool) {
+	impl, s := h.enter()
+	if impl.mode == HybridReadDirty {
+		actual, loaded = impl.m.LoadOrStore(key, value)
+	} else {
+		actual, loaded = impl.shards.loadOrStore(key, value)
+		if !loaded {
+			atomic.AddUint64(&s.newKeys, 1)
+		}
+	}
+	h.exit(s)
+	return actual, loaded
+}
+
+// Delete deletes the value for a key.
+func (h *HybridMap) Delete(key interface{}) {
+	impl, s := h.enter()
+	if impl.mode == HybridReadDirty {
+		impl.m.Delete(key)
+	} else {
+		impl.shards.delete(key)
+	}
+	h.exit(s)
+}
+
+// Range calls f sequentially for each key and value present in the map.
+// If f returns false, range stops the iteration.
+//
+// Range has the same consistency as Map.Range. The map may switch
+// algorithms while f runs; f may modify the map.
+func (h *HybridMap) Range(f func(key, value interface{}) bool) {
+	impl, s := h.enter()
+	// Range期间不能阻塞切换 (f可能很慢, 也可能修改map),
+	// 所以先退出, 之后的遍历只访问旧的实现. 切换时旧实现只会被读取
+	h.exit(s)
+	if impl.mode == HybridReadDirty {
+		impl.m.Range(f)
+	} else {
+		impl.shards.rangeAll(f)
+	}
+}
+
+// HybridStats describes the state of a HybridMap.
+type HybridStats struct {
+	// Mode is the algorithm currently in use.
+	Mode HybridMode
+
+	// Switches is the number of times the map has changed algorithms.
+	Switches int64
+
+	// Map holds the statistics of the underlying Map while Mode is
+	// HybridReadDirty.
+	Map MapStats
+}
+
+// Stats returns a snapshot of the state of h.
+func (h *HybridMap) Stats() HybridStats {
+	impl, s := h.enter()
+	h.exit(s)
+	st := HybridStats{Mode: impl.mode, Switches: atomic.LoadInt64(&h.switches)}
+	if impl.mode == HybridReadDirty {
+		st.Map = impl.m.Stats()
+	}
+	return st
+}
+
+// rwShards is a hash-sharded map whose shards are each guarded by an
+// RWMutex.
+type rwShards struct {
+	seed   uintptr
+	shards []rwShard
+}
+
+type rwShard struct {
+	rwShardInternal
+
+	// Prevents false sharing on widespread platforms with
+	// 128 mod (cache line size) = 0 .
+	pad [cacheLinePad - unsafe.Sizeof(rwShardInternal{})%cacheLinePad]byte
+}
+
+type rwShardInternal struct {
+	mu RWMutex
+	m  map[interface{}]interface{}
+}
+
+func newRWShards() *rwShards {
+	// 分片数取不小于4*GOMAXPROCS的2的幂, 让不同P上的写基本落在不同分片
+	n := 1
+	for n < 4*runtime.GOMAXPROCS(0) {
+		n <<= 1
+	}
+	s := &rwShards{seed: uintptr(fastrand()), shards: make([]rwShard, n)}
+	for i := range s.shards {
+		s.shards[i].m = make(map[interface{}]interface{})
+	}
+	return s
+}
+
+func (s *rwShards) shard(key interface{}) *rwShard {
+	return &s.shards[runtime_efaceHash(key, s.seed)&uintptr(len(s.shards)-1)]
+}
+
+func (s *rwShards) load(key interface{}) (interface{}, bool) {
+	sh := s.shard(key)
+	sh.mu.RLock()
+	v, ok := sh.m[key]
+	sh.mu.RUnlock()
+	return v, ok
+}
+
+// store sets the value for key and reports whether key was new.
+func (s *rwShards) store(key, value interface{}) bool {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	_, ok := sh.m[key]
+	sh.m[key] = value
+	sh.mu.Unlock()
+	return !ok
+}
+
+func (s *rwShards) loadOrStore(key, value interface{}) (interface{}, bool) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	defer sh.mu.Unlock()
+	if v, ok := sh.m[key]; ok {
+		return v, true
+	}
+	sh.m[key] = value
+	return value, false
+}
+
+func (s *rwShards) delete(key interface{}) {
+	sh := s.shard(key)
+	sh.mu.Lock()
+	delete(sh.m, key)
+	sh.mu.Unlock()
+}
+
+// rangeAll calls f for each key and value, holding no lock while f runs.
+// Each shard is copied under its read lock before f sees its contents.
+func (s *rwShards) rangeAll(f func(key, value interface{}) bool) {
+	var kvs []interface{}
+	for i := range s.shards {
+		sh := &s.shards[i]
+		kvs = kvs[:0]
+		sh.mu.RLock()
+		for k, v := range sh.m {
+			kvs = append(kvs, k, v)
+		}
+		sh.mu.RUnlock()
+		for j := 0; j < len(kvs); j += 2 {
+			if !f(kvs[j], kvs[j+1]) {
+				return
+			}
+		}
+	}
+}
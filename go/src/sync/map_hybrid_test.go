@@ -0,0 +1,96 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"sync"
+	"testing"
+	"testing/quick"
+)
+
+func applyHybridMap(calls []mapCall) ([]mapResult, map[interface{}]interface{}) {
+	return applyCalls(new(sync.HybridMap), calls)
+}
+
+func TestHybridMapMatchesRWMutex(t *testing.T) {
+	if err := quick.CheckEqual(applyHybridMap, applyRWMutexMap, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHybridMapSwitchesModes(t *testing.T) {
+	var m sync.HybridMap
+	if mode := m.Stats().Mode; mode != sync.HybridReadDirty {
+		t.Fatalf("initial Mode = %v, want %v", mode, sync.HybridReadDirty)
+	}
+
+	// A stream of new keys, each read back once, keeps a Map on its slow
+	// path.
+	const n = 1 << 16
+	for i := 0; i < n && m.Stats().Mode == sync.HybridReadDirty; i++ {
+		m.Store(i, i)
+		m.Load(i)
+	}
+	s := m.Stats()
+	if s.Mode != sync.HybridRWMutex || s.Switches != 1 {
+		t.Fatalf("after inserts: Mode = %v, Switches = %d; want %v, 1", s.Mode, s.Switches, sync.HybridRWMutex)
+	}
+
+	// Reads of existing keys alone favor the read/dirty algorithm.
+	for i := 0; i < n && m.Stats().Mode == sync.HybridRWMutex; i++ {
+		m.Load(i % 100)
+	}
+	s = m.Stats()
+	if s.Mode != sync.HybridReadDirty || s.Switches != 2 {
+		t.Fatalf("after reads: Mode = %v, Switches = %d; want %v, 2", s.Mode, s.Switches, sync.HybridReadDirty)
+	}
+
+	// Nothing was lost in either switch.
+	count := 0
+	m.Range(func(k, v interface{}) bool {
+		if k != v {
+			t.Errorf("key %v has value %v", k, v)
+		}
+		count++
+		return true
+	})
+	if count == 0 {
+		t.Errorf("Range found no keys after switching")
+	}
+	for i := 0; i < count; i++ {
+		if v, ok := m.Load(i); !ok || v != i {
+			t.Fatalf("Load(%d) = %v, %v", i, v, ok)
+		}
+	}
+}
+
+func TestHybridMapConcurrentSwitch(t *testing.T) {
+	var m sync.HybridMap
+	const (
+		goroutines = 4
+		perG       = 1 << 14
+	)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < perG; i++ {
+				k := g*perG + i
+				m.Store(k, k)
+				if v, ok := m.Load(k); !ok || v != k {
+					t.Errorf("Load(%d) = %v, %v right after Store", k, v, ok)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	for k := 0; k < goroutines*perG; k++ {
+		if v, ok := m.Load(k); !ok || v != k {
+			t.Fatalf("Load(%d) = %v, %v", k, v, ok)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// An IndexFunc returns the index keys of a value: the groups the value
+// belongs to, under which LoadByIndex finds its entry. It must not call
+// methods of the Map.
+type IndexFunc func(value interface{}) []string
+
+// A mapIndex is the secondary index of a Map configured by WithIndex.
+type mapIndex struct {
+	f IndexFunc
+
+	// mu serializes the writes to the Map, so that the index changes with
+	// each entry. It is acquired before the Map's mutex.
+	mu      Mutex
+	byIndex map[string]map[interface{}]struct{} // index key -> keys
+	byKey   map[interface{}][]string            // key -> its index keys
+}
+
+// WithIndex gives the Map a secondary index: the entries whose values f
+// maps to an index key are returned together by LoadByIndex.
+//
+// The index is maintained by every write to the Map, Store, LoadOrStore,
+// Delete and PurgeWhere alike, atomically with the write: LoadByIndex
+// never returns an entry whose value no longer has the index key, or
+// misses one that has it. For this, writes to a Map with an index are
+// serialized by a mutex of the index, and no longer proceed in parallel
+// on the fast path. Loads are unaffected.
+func WithIndex(f IndexFunc) MapOption {
+	if f == nil {
+		panic("sync: WithIndex with nil IndexFunc")
+	}
+	return func(m *Map) {
+		m.index = &mapIndex{
+			f:       f,
+			byIndex: make(map[string]map[interface{}]struct{}),
+			byKey:   make(map[interface{}][]string),
+		}
+	}
+}
+
+// setLocked records that key now holds value, if present is set, or no
+// value otherwise. ix.mu must be held.
+func (ix *mapIndex) setLocked(key, value interface{}, present bool) {
+	for _, ik := range ix.byKey[key] {
+		keys := ix.byIndex[ik]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(ix.byIndex, ik)
+		}
+	}
+	delete(ix.byKey, key)
+	if !present {
+		return
+	}
+	iks := ix.f(value)
+	if len(iks) == 0 {
+		return
+	}
+	for _, ik := range iks {
+		keys := ix.byIndex[ik]
+		if keys == nil {
+			keys = make(map[interface{}]struct{})
+			ix.byIndex[ik] = keys
+		}
+		keys[key] = struct{}{}
+	}
+	ix.byKey[key] = iks
+}
+
+// LoadByIndex returns the entries whose values have the index key
+// indexKey, at one point in time, as a ReadOnlyMap. It panics if the Map
+// has no index.
+func (m *Map) LoadByIndex(indexKey string) ReadOnlyMap {
+	ix := m.index
+	if ix == nil {
+		panic("sync: LoadByIndex on a Map without WithIndex")
+	}
+	ix.mu.Lock()
+	defer ix.mu.Unlock()
+	keys := ix.byIndex[indexKey]
+	v := make(map[interface{}]interface{}, len(keys))
+	for k := range keys {
+		// 写者都在等ix.mu, 索引中的key一定在Map中
+		if value, ok := m.Load(k); ok {
+			v[k] = value
+		}
+	}
+	return ReadOnlyMap{m: v}
+}
@@ -0,0 +1,124 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+type user struct {
+	name   string
+	tenant string
+	roles  []string
+}
+
+func userIndex(v interface{}) []string {
+	u := v.(user)
+	keys := []string{"tenant:" + u.tenant}
+	for _, r := range u.roles {
+		keys = append(keys, "role:"+r)
+	}
+	return keys
+}
+
+func indexKeys(r sync.ReadOnlyMap) []string {
+	var keys []string
+	r.Range(func(k, v interface{}) bool {
+		keys = append(keys, k.(string))
+		return true
+	})
+	sort.Strings(keys)
+	return keys
+}
+
+func TestMapIndex(t *testing.T) {
+	m := sync.NewMap(sync.WithIndex(userIndex))
+	m.Store("a", user{"a", "t1", []string{"admin"}})
+	m.Store("b", user{"b", "t1", nil})
+	m.LoadOrStore("c", user{"c", "t2", []string{"admin"}})
+	m.LoadOrStore("c", user{"c", "t3", nil}) // 已经存在, 索引不变
+
+	check := func(ik string, want ...string) {
+		t.Helper()
+		got := indexKeys(m.LoadByIndex(ik))
+		if len(got) != len(want) {
+			t.Errorf("LoadByIndex(%q) = %v; want %v", ik, got, want)
+			return
+		}
+		for i := range got {
+			if got[i] != want[i] {
+				t.Errorf("LoadByIndex(%q) = %v; want %v", ik, got, want)
+				return
+			}
+		}
+	}
+	check("tenant:t1", "a", "b")
+	check("role:admin", "a", "c")
+	check("tenant:t3")
+
+	m.Store("b", user{"b", "t2", []string{"admin"}})
+	check("tenant:t1", "a")
+	check("tenant:t2", "b", "c")
+	check("role:admin", "a", "b", "c")
+
+	m.Delete("a")
+	check("tenant:t1")
+	check("role:admin", "b", "c")
+
+	m.PurgeWhere(func(k, v interface{}) bool { return v.(user).tenant == "t2" && k == "c" }, 0, nil)
+	check("tenant:t2", "b")
+	if v, _ := m.LoadByIndex("tenant:t2").Load("b"); v.(user).roles[0] != "admin" {
+		t.Errorf("LoadByIndex returned %v", v)
+	}
+}
+
+// 并发地在租户之间移动用户, 索引和值不会不一致
+func TestMapIndexConcurrent(t *testing.T) {
+	const users = 50
+	m := sync.NewMap(sync.WithIndex(userIndex))
+	for i := 0; i < users; i++ {
+		m.Store(i, user{tenant: "0"})
+	}
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				m.Store((g*13+i)%users, user{tenant: strconv.Itoa(i % 3)})
+			}
+		}(g)
+	}
+	for r := 0; r < 200; r++ {
+		for tenant := 0; tenant < 3; tenant++ {
+			// 每次查询的结果是同一时刻的: 其中的用户都属于这个租户
+			view := m.LoadByIndex("tenant:" + strconv.Itoa(tenant))
+			view.Range(func(k, v interface{}) bool {
+				if v.(user).tenant != strconv.Itoa(tenant) {
+					t.Errorf("user %v of tenant %s under tenant %d", k, v.(user).tenant, tenant)
+				}
+				return true
+			})
+		}
+	}
+	close(stop)
+	wg.Wait()
+	n := 0
+	for tenant := 0; tenant < 3; tenant++ {
+		n += m.LoadByIndex("tenant:" + strconv.Itoa(tenant)).Len()
+	}
+	if n != users {
+		t.Errorf("%d users in the index; want %d", n, users)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import "unsafe"
+
+// mapOpStats, mapOpPromote, mapOpEntryStats, mapOpSnapshot, mapOpPurge,
+// mapOpFreeze, mapOpState and mapOpReplace are the operations of
+// Map.Stats, Map.Promote, Map.EntryStats, Map.WriteSnapshot,
+// Map.PurgeWhere, Map.Freeze, Map.State and Map.ReplaceAll, which also
+// lock the Map, and mapOpReplica is the builder of WithReadReplica.
+const (
+	mapOpStats = MapOpRange + 1 + iota
+	mapOpPromote
+	mapOpEntryStats
+	mapOpSnapshot
+	mapOpPurge
+	mapOpFreeze
+	mapOpState
+	mapOpReplica
+	mapOpReplace
+)
+
+// WithProfilerLabels names the Map for profilers. While a goroutine is on
+// a slow path of the Map, from just before it locks the Map's mutex until
+// it unlocks it, it carries the pprof labels map=name and op=the Map
+// method, on top of the labels it already has. CPU profile samples taken
+// there, and goroutine profiles showing goroutines waiting for the
+// mutex, are then attributed to the Map by name.
+//
+// Block and mutex profiles do not record labels. For those the name is
+// also used as the Map's lock name in a ContentionProfile: "sync.Map "
+// followed by name.
+//
+// The fast paths, which do not lock, are not labeled.
+func WithProfilerLabels(name string) MapOption {
+	l := &mapLabels{name: name, lockName: "sync.Map " + name}
+	for op := range l.byOp {
+		l.byOp[op] = profLabelsWith(nil, "map", name, "op", MapOp(op).String())
+	}
+	return func(m *Map) {
+		m.labels = l
+	}
+}
+
+// mapLabels holds the labels of a Map named by WithProfilerLabels.
+type mapLabels struct {
+	name     string
+	lockName string
+
+	// byOp holds the labels of each operation for goroutines without
+	// labels of their own, so that the common case does not allocate.
+	byOp [mapOpReplace + 1]unsafe.Pointer
+}
+
+// enter sets the labels of op on the calling goroutine and returns the
+// labels it had.
+func (l *mapLabels) enter(op MapOp) unsafe.Pointer {
+	prev := runtime_getProfLabel()
+	if prev == nil {
+		runtime_setProfLabel(l.byOp[op])
+	} else {
+		// 调用者自己有label(比如在pprof.Do中): 合并, 每次都要分配.
+		// 慢路径本来就要加锁, 这点代价可以接受
+		runtime_setProfLabel(profLabelsWith(prev, "map", l.name, "op", op.String()))
+	}
+	return prev
+}
+
+// lockName returns the name of m's mutex in a ContentionProfile.
+func (m *Map) lockName() string {
+	if m.labels != nil {
+		return m.labels.lockName
+	}
+	return "sync.Map"
+}
@@ -0,0 +1,83 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"bytes"
+	"context"
+	"runtime/pprof"
+	"strings"
+	. "sync"
+	"testing"
+)
+
+// labelsWhileLocked stores a new key in a Map named sessions from a
+// goroutine running f, and returns the goroutine profile taken while
+// that goroutine held the Map's mutex.
+func labelsWhileLocked(t *testing.T, f func(func())) string {
+	in, out := make(chan struct{}), make(chan struct{})
+	m := NewMap(WithProfilerLabels("sessions"), WithTransitionHook(func(e MapEvent) {
+		if e.Transition == MapDirtyStored {
+			// 停在慢路径中, mu还被持有
+			in <- struct{}{}
+			<-out
+		}
+	}))
+	done := make(chan struct{})
+	go f(func() {
+		m.Store("k", 1)
+		close(done)
+	})
+	<-in
+	var buf bytes.Buffer
+	pprof.Lookup("goroutine").WriteTo(&buf, 1)
+	out <- struct{}{}
+	<-done
+	return buf.String()
+}
+
+func TestMapProfilerLabels(t *testing.T) {
+	prof := labelsWhileLocked(t, func(store func()) { store() })
+	if !strings.Contains(prof, `"map":"sessions"`) || !strings.Contains(prof, `"op":"store"`) {
+		t.Errorf("goroutine profile has no map and op labels:\n%s", prof)
+	}
+
+	prof = labelsWhileLocked(t, func(store func()) {
+		pprof.Do(context.Background(), pprof.Labels("request", "r1"), func(context.Context) {
+			before := ProfLabel()
+			store()
+			if after := ProfLabel(); after != before {
+				t.Errorf("labels not restored after the slow path")
+			}
+		})
+	})
+	if !strings.Contains(prof, `"map":"sessions"`) || !strings.Contains(prof, `"request":"r1"`) {
+		t.Errorf("the Map's labels did not extend the goroutine's:\n%s", prof)
+	}
+}
+
+func TestMapProfilerLabelsFastPath(t *testing.T) {
+	m := NewMap(WithProfilerLabels("sessions"))
+	m.Store("k", 1)
+	m.Load("k") // 提升
+	before := ProfLabel()
+	m.Load("k")
+	m.Delete("nosuch")
+	m.Range(func(k, v interface{}) bool { return true })
+	if ProfLabel() != before {
+		t.Errorf("labels changed by the Map")
+	}
+}
+
+func TestMapProfilerLabelsContention(t *testing.T) {
+	var p ContentionProfile
+	m := NewMap(WithProfilerLabels("sessions"))
+	m.SetContentionProfile(&p)
+	m.Store("k", 1)
+	r := p.Report()
+	if len(r) != 1 || r[0].Lock != "sync.Map sessions" {
+		t.Errorf("Report() = %+v, want one site of lock %q", r, "sync.Map sessions")
+	}
+}
@@ -0,0 +1,62 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// namedMaps holds the Maps made by NewNamedMap, by name.
+var namedMaps struct {
+	mu Mutex
+	m  map[string]*Map
+}
+
+// NewNamedMap returns an empty Map configured by opts, as NewMap does,
+// and lists it under name for RangeNamedMaps, so that a debugging tool
+// can find it without being handed it.
+//
+// The list holds on to the Map, which is never freed while it is listed:
+// call UnregisterNamedMap once the Map is no longer used. A later
+// NewNamedMap with the same name replaces the Map in the list.
+func NewNamedMap(name string, opts ...MapOption) *Map {
+	m := NewMap(opts...)
+	namedMaps.mu.Lock()
+	if namedMaps.m == nil {
+		namedMaps.m = make(map[string]*Map)
+	}
+	namedMaps.m[name] = m
+	namedMaps.mu.Unlock()
+	return m
+}
+
+// UnregisterNamedMap removes m from the list of RangeNamedMaps, so that
+// the list no longer holds on to it. It does nothing if m is not listed,
+// as when a later NewNamedMap has replaced it.
+func UnregisterNamedMap(m *Map) {
+	namedMaps.mu.Lock()
+	for name, listed := range namedMaps.m {
+		if listed == m {
+			delete(namedMaps.m, name)
+			break
+		}
+	}
+	namedMaps.mu.Unlock()
+}
+
+// RangeNamedMaps calls f for each Map made by NewNamedMap, and its name,
+// in no particular order, until f returns false. f is called without any
+// lock held, on the Maps listed when RangeNamedMaps was called.
+func RangeNamedMaps(f func(name string, m *Map) bool) {
+	namedMaps.mu.Lock()
+	names := make([]string, 0, len(namedMaps.m))
+	maps := make([]*Map, 0, len(namedMaps.m))
+	for name, m := range namedMaps.m {
+		names = append(names, name)
+		maps = append(maps, m)
+	}
+	namedMaps.mu.Unlock()
+	for i, m := range maps {
+		if !f(names[i], m) {
+			return
+		}
+	}
+}
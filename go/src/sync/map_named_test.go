@@ -0,0 +1,63 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"sync"
+	"testing"
+)
+
+func namedMap(name string) *sync.Map {
+	var found *sync.Map
+	sync.RangeNamedMaps(func(n string, m *sync.Map) bool {
+		if n == name {
+			found = m
+			return false
+		}
+		return true
+	})
+	return found
+}
+
+func TestNewNamedMap(t *testing.T) {
+	a := sync.NewNamedMap("test/a")
+	b := sync.NewNamedMap("test/b", sync.WithPromotionPolicy(sync.SizePromotion{}))
+	if namedMap("test/a") != a || namedMap("test/b") != b {
+		t.Fatal("RangeNamedMaps does not list the named maps")
+	}
+	if got := b.Stats().Policy; got != (sync.SizePromotion{}).Name() {
+		t.Errorf("policy of the named map = %q", got)
+	}
+
+	// 同名的Map替换之前的
+	a2 := sync.NewNamedMap("test/a")
+	if namedMap("test/a") != a2 {
+		t.Error("NewNamedMap did not replace the map of the same name")
+	}
+
+	n := 0
+	sync.RangeNamedMaps(func(string, *sync.Map) bool {
+		n++
+		return false
+	})
+	if n != 1 {
+		t.Errorf("RangeNamedMaps went on after f returned false: %d calls", n)
+	}
+}
+
+func TestUnregisterNamedMap(t *testing.T) {
+	a := sync.NewNamedMap("test/unregister")
+	a2 := sync.NewNamedMap("test/unregister")
+	// 已经被替换的Map不在表中, 不影响替换它的Map
+	sync.UnregisterNamedMap(a)
+	if namedMap("test/unregister") != a2 {
+		t.Fatal("UnregisterNamedMap of a replaced map removed its replacement")
+	}
+	sync.UnregisterNamedMap(a2)
+	if namedMap("test/unregister") != nil {
+		t.Error("the map is still listed after UnregisterNamedMap")
+	}
+	sync.UnregisterNamedMap(a2)
+}
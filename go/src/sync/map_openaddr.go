@@ -0,0 +1,155 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// openTable is the entryTable of OpenAddressingBackend: a power-of-two array
+// of slots probed linearly from the key's hash.
+//
+// A slot is empty when e is nil and a tombstone when e is openDeleted.
+// Probing stops at the first empty slot, so the table always keeps at least
+// a quarter of its slots empty or tombstoned-and-reclaimable: it grows (and
+// drops its tombstones) once live plus deleted slots exceed 3/4 of its size.
+type openTable struct {
+	hasher Hasher // nil for the runtime's hash under seed
+	seed   uintptr
+	slots  []openSlot
+	count  int // live slots
+	used   int // live and tombstone slots
+}
+
+type openSlot struct {
+	hash uintptr
+	key  interface{}
+	e    *entry
+}
+
+// openDeleted marks a slot whose key has been deleted. Its address is all
+// that matters.
+var openDeleted = new(entry)
+
+func newOpenTable(h Hasher, capacity int) *openTable {
+	n := 8
+	for n*3 < capacity*4 {
+		n <<= 1
+	}
+	return &openTable{
+		hasher: h,
+		seed:   uintptr(fastrand()),
+		slots:  make([]openSlot, n),
+	}
+}
+
+func (t *openTable) hash(key interface{}) uintptr {
+	if t.hasher != nil {
+		return uintptr(t.hasher.Hash(key))
+	}
+	return runtime_efaceHash(key, t.seed)
+}
+
+func (t *openTable) load(key interface{}) (*entry, bool) {
+	h := t.hash(key)
+	mask := uintptr(len(t.slots) - 1)
+	for i := h & mask; ; i = (i + 1) & mask {
+		s := &t.slots[i]
+		if s.e == nil {
+			return nil, false
+		}
+		// 先比较hash, 只有hash相同才做interface比较, 省去大部分的类型和值比较
+		if s.e != openDeleted && s.hash == h && s.key == key {
+			return s.e, true
+		}
+	}
+}
+
+func (t *openTable) store(key interface{}, e *entry) {
+	h := t.hash(key)
+	mask := uintptr(len(t.slots) - 1)
+	var free *openSlot
+	for i := h & mask; ; i = (i + 1) & mask {
+		s := &t.slots[i]
+		if s.e == nil {
+			if free == nil {
+				free = s
+			}
+			break
+		}
+		if s.e == openDeleted {
+			// 记录第一个墓碑, 若key不存在, 复用这个位置
+			if free == nil {
+				free = s
+			}
+			continue
+		}
+		if s.hash == h && s.key == key {
+			s.e = e
+			return
+		}
+	}
+	if free.e == nil {
+		t.used++
+	}
+	*free = openSlot{hash: h, key: key, e: e}
+	t.count++
+	if t.used*4 > len(t.slots)*3 {
+		t.grow()
+	}
+}
+
+func (t *openTable) delete(key interface{}) {
+	h := t.hash(key)
+	mask := uintptr(len(t.slots) - 1)
+	for i := h & mask; ; i = (i + 1) & mask {
+		s := &t.slots[i]
+		if s.e == nil {
+			return
+		}
+		if s.e != openDeleted && s.hash == h && s.key == key {
+			// 不能直接置为空槽, 否则会截断经过这里的探测序列
+			*s = openSlot{e: openDeleted}
+			t.count--
+			return
+		}
+	}
+}
+
+// grow rehashes the live slots into a table sized for twice their number,
+// which also discards every tombstone.
+func (t *openTable) grow() {
+	old := t.slots
+	n := 8
+	for n*3 < t.count*2*4 {
+		n <<= 1
+	}
+	t.slots = make([]openSlot, n)
+	t.used = t.count
+	mask := uintptr(n - 1)
+	for i := range old {
+		s := &old[i]
+		if s.e == nil || s.e == openDeleted {
+			continue
+		}
+		j := s.hash & mask
+		for t.slots[j].e != nil {
+			j = (j + 1) & mask
+		}
+		t.slots[j] = *s
+	}
+}
+
+func (t *openTable) len() int {
+	return t.count
+}
+
+func (t *openTable) iterate(f func(key interface{}, e *entry) bool) {
+	for i := range t.slots {
+		s := &t.slots[i]
+		if s.e == nil || s.e == openDeleted {
+			continue
+		}
+		if !f(s.key, s.e) {
+			return
+		}
+	}
+}
@@ -0,0 +1,184 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+// A MapProfile describes the workload a Map has seen, for a new Map to
+// start out tuned for it. A service exports the profile of its maps before
+// it stops, and makes them with WithTuningProfile when it starts again:
+//
+//	data, _ := json.Marshal(sessions.Profile())
+//	...
+//	var p sync.MapProfile
+//	json.Unmarshal(data, &p)
+//	sessions := sync.NewMap(sync.WithTuningProfile(p))
+//
+// Without it, a fresh Map grows its dirty map from nothing, copying it
+// over and over, and promotes it as a read-mostly map would until its
+// estimate of the write rate has caught up with the writes.
+//
+// Loads, Writes and Procs are counted only by a Map made with
+// WithWorkloadProfile; they are 0 otherwise.
+type MapProfile struct {
+	// Keys is the number of keys in the map, counting the keys deleted
+	// since the dirty map was last copied.
+	Keys int
+
+	// Loads is the number of Loads, and Writes the number of Stores,
+	// LoadOrStores and Deletes.
+	Loads  int64
+	Writes int64
+
+	// Misses is the number of Loads and LoadOrStores that locked the map
+	// because the key was not in the read map, as in MapStats.
+	Misses int64
+
+	// NewKeys is the number of new keys stored into the dirty map, as
+	// MapStats.Writes.
+	NewKeys int64
+
+	// WriteRate is MapStats.WriteRate: the recent fraction of slow-path
+	// operations that stored a new key.
+	WriteRate float64
+
+	// Procs is the number of Ps that wrote to the map.
+	Procs int
+}
+
+// ReadRatio returns the fraction of the operations counted that were
+// Loads, or 0 if none were counted.
+func (p MapProfile) ReadRatio() float64 {
+	if p.Loads+p.Writes == 0 {
+		return 0
+	}
+	return float64(p.Loads) / float64(p.Loads+p.Writes)
+}
+
+// MissRate returns the fraction of the Loads counted that missed the read
+// map, or 0 if none were counted.
+func (p MapProfile) MissRate() float64 {
+	if p.Loads == 0 {
+		return 0
+	}
+	r := float64(p.Misses) / float64(p.Loads)
+	if r > 1 {
+		// Misses也计入了LoadOrStore
+		r = 1
+	}
+	return r
+}
+
+// Shards returns the number of shards for a ShardedMap, to be passed to
+// Resize, doing the workload of p: one for each P that wrote, since every
+// Load consults every shard.
+func (p MapProfile) Shards() int {
+	if p.Procs < 1 {
+		return 1
+	}
+	return p.Procs
+}
+
+// WithWorkloadProfile makes the Map count its operations by P, for the
+// Loads, Writes and Procs of its Profile. Each operation then pins its P
+// and adds to a counter of that P, which costs a few nanoseconds but
+// shares no cache line with the other Ps.
+func WithWorkloadProfile() MapOption {
+	return func(m *Map) {
+		m.workload = &mapWorkload{slots: make([]workloadSlot, runtime.GOMAXPROCS(0))}
+	}
+}
+
+// WithTuningProfile starts the Map out tuned for the workload of p: its
+// first dirty map, and the slabs its entries are carved out of, are
+// allocated for p.Keys keys, so that a map filling up again does not
+// reallocate its way there; and the promotion policy starts from
+// p.WriteRate, so that a write-heavy map does not promote as if it were
+// read-mostly until its estimate catches up.
+func WithTuningProfile(p MapProfile) MapOption {
+	return func(m *Map) {
+		if p.Keys > 0 {
+			m.sizeHint = p.Keys
+		}
+		if r := p.WriteRate; r > 0 && r <= 1 {
+			m.promo.writeRate = ewma(r)
+		}
+	}
+}
+
+// dirtyCapacity returns the number of keys to allocate a dirty map for,
+// when the read map has n. m.mu must be held.
+func (m *Map) dirtyCapacity(n int) int {
+	// 只有第一个dirty按WithTuningProfile预计的大小分配, 填满之前不用扩容.
+	// 之后的dirty从read复制而来, 已经接近它的大小; 提升前往往还远没有
+	// 填满, 每次都按预计的大小分配反而浪费
+	if n < m.sizeHint && m.promo.promotions == 0 {
+		return m.sizeHint
+	}
+	return n
+}
+
+// Profile returns the workload m has seen so far.
+func (m *Map) Profile() MapProfile {
+	m.lock(mapOpStats)
+	read, _ := m.read.Load().(readOnly)
+	keys := read.m.len()
+	if !m.dirty.isNil() {
+		keys = m.dirty.len()
+	}
+	p := MapProfile{
+		Keys:      keys,
+		Misses:    m.promo.misses,
+		NewKeys:   m.promo.writes,
+		WriteRate: float64(m.promo.writeRate),
+	}
+	m.unlock()
+	if w := m.workload; w != nil {
+		for i := range w.slots {
+			s := &w.slots[i]
+			p.Loads += int64(atomic.LoadUint64(&s.loads))
+			if n := atomic.LoadUint64(&s.writes); n > 0 {
+				p.Writes += int64(n)
+				p.Procs++
+			}
+		}
+	}
+	return p
+}
+
+// A mapWorkload counts the operations of a Map made with
+// WithWorkloadProfile, by P.
+type mapWorkload struct {
+	slots []workloadSlot
+}
+
+type workloadSlot struct {
+	workloadCounts
+
+	// Prevents false sharing between the counters of neighbouring Ps.
+	pad [cacheLinePad - unsafe.Sizeof(workloadCounts{})%cacheLinePad]byte
+}
+
+type workloadCounts struct {
+	loads  uint64
+	writes uint64
+}
+
+// count counts an operation on the P of the calling goroutine.
+func (w *mapWorkload) count(write bool) {
+	pid := runtime_procPin()
+	runtime_procUnpin()
+	// GOMAXPROCS增大之后的P和小的P共用计数器
+	s := &w.slots[pid%len(w.slots)]
+	if write {
+		atomic.AddUint64(&s.writes, 1)
+	} else {
+		atomic.AddUint64(&s.loads, 1)
+	}
+}
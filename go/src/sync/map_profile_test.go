@@ -0,0 +1,116 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"encoding/json"
+	"sync"
+	"testing"
+)
+
+func TestMapProfile(t *testing.T) {
+	m := sync.NewMap(sync.WithWorkloadProfile())
+	for i := 0; i < 100; i++ {
+		m.Store(i, i)
+	}
+	m.Promote()
+	for i := 0; i < 300; i++ {
+		m.Load(i % 100)
+	}
+	m.LoadOrStore(100, 100)
+	m.Delete(0)
+	m.Store(101, 101) // 只在dirty中
+	m.Load(101)
+
+	p := m.Profile()
+	// 删除的0还在dirty中, 也计入Keys
+	if p.Keys != 102 || p.Loads != 301 || p.Writes != 103 || p.Procs != 1 {
+		t.Errorf("Profile = %+v, want 102 keys, 301 Loads and 103 writes on 1 P", p)
+	}
+	if p.NewKeys != 102 || p.Misses == 0 || p.WriteRate == 0 {
+		t.Errorf("Profile = %+v, want the promotion counts of MapStats", p)
+	}
+	if r := p.ReadRatio(); r < 0.74 || r > 0.75 {
+		t.Errorf("ReadRatio = %v, want 301/404", r)
+	}
+	if r := p.MissRate(); r <= 0 || r > 1 {
+		t.Errorf("MissRate = %v", r)
+	}
+
+	// 不计数的Map也有Keys和提升的计数
+	plain := sync.NewMap()
+	plain.Store(1, 1)
+	plain.Load(1)
+	if p := plain.Profile(); p.Keys != 1 || p.Loads != 0 || p.NewKeys != 1 {
+		t.Errorf("Profile without WithWorkloadProfile = %+v", p)
+	}
+}
+
+func TestMapTuningProfile(t *testing.T) {
+	src := sync.NewMap(sync.WithWorkloadProfile())
+	for i := 0; i < 1000; i++ {
+		src.Store(i, i)
+		src.Load(i)
+	}
+	data, err := json.Marshal(src.Profile())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p sync.MapProfile
+	if err := json.Unmarshal(data, &p); err != nil {
+		t.Fatal(err)
+	}
+	if p != src.Profile() {
+		t.Fatalf("profile changed through JSON: %+v, want %+v", p, src.Profile())
+	}
+
+	m := sync.NewMap(sync.WithTuningProfile(p))
+	if got := m.Stats().WriteRate; got != p.WriteRate {
+		t.Errorf("WriteRate of the tuned Map = %v, want %v from the profile", got, p.WriteRate)
+	}
+	for i := 0; i < 2000; i++ {
+		m.Store(i, -i)
+	}
+	for i := 0; i < 2000; i++ {
+		if v, ok := m.Load(i); !ok || v != -i {
+			t.Fatalf("Load(%d) = %v, %v", i, v, ok)
+		}
+	}
+	if p.Shards() != 1 {
+		t.Errorf("Shards = %d for a profile of 1 P", p.Shards())
+	}
+}
+
+// BenchmarkMapWarmStart fills a new Map and then reads it, as a service
+// reloading its data after a restart does, cold and tuned by the profile of
+// a previous fill.
+func BenchmarkMapWarmStart(b *testing.B) {
+	const n = 1 << 16
+	fill := func(m *sync.Map) {
+		for i := 0; i < n; i++ {
+			m.Store(i, i)
+		}
+		for i := 0; i < 2*n; i++ {
+			m.Load(i % n)
+		}
+	}
+	prev := sync.NewMap()
+	fill(prev)
+	p := prev.Profile()
+	for _, bench := range []struct {
+		name string
+		opts []sync.MapOption
+	}{
+		{"cold", nil},
+		{"tuned", []sync.MapOption{sync.WithTuningProfile(p)}},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				fill(sync.NewMap(bench.opts...))
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// Promoting the dirty map to the read map is cheap by itself, but the next
+// Store of a new key then has to copy the whole read map into a fresh dirty
+// map. The original rule, promote once misses reach len(dirty), pays for that
+// copy with the misses it saves only if new keys stop arriving. Right after a
+// bulk insert they do not: every promotion is followed by another copy, the
+// copy's new keys miss again, and the map promotes over and over.
+//
+// The adaptive policy therefore scales the threshold by how write-heavy the
+// slow path has recently been. writeRate is an exponentially weighted moving
+// average, over slow-path operations, of the fraction that stored a new key.
+// A read-mostly map has writeRate near 0 and promotes at len(dirty) misses
+// as before; while new keys keep arriving the threshold rises up to
+// (1+promoteMaxDelay) times that, and it falls back within a few dozen misses
+// once the writes stop.
+const (
+	// promoteEWMAShift sets the weight of each new sample to 1/16.
+	promoteEWMAShift = 4
+
+	// promoteMaxDelay is how many extra copies' worth of misses a
+	// write-heavy map may accumulate before promoting.
+	promoteMaxDelay = 3
+)
+
+// ewma is an exponentially weighted moving average giving each new sample
+// the weight 1/(1<<promoteEWMAShift). It starts at 0, and is not safe for
+// concurrent use; elements/metrics.EWMA is the concurrent version.
+type ewma float64
+
+func (e *ewma) update(x float64) {
+	*e += ewma((x - float64(*e)) / (1 << promoteEWMAShift))
+}
+
+// promotionState is the promotion policies' view of the map. It is
+// guarded by Map.mu.
+type promotionState struct {
+	writeRate  ewma
+	promotions int64
+	misses     int64
+	writes     int64
+
+	deferredDeletes int64
+	replicas        int64
+
+	// dirtyCreated is the runtime_nanotime at which the dirty map was
+	// created, and dirtyWrites the number of new keys stored into it.
+	dirtyCreated int64
+	dirtyWrites  int
+}
+
+// noteWriteLocked records that a new key was added to the dirty map.
+func (m *Map) noteWriteLocked() {
+	p := &m.promo
+	p.writes++
+	p.dirtyWrites++
+	p.writeRate.update(1)
+}
+
+// noteDirtyLocked records that a new dirty map was created.
+func (m *Map) noteDirtyLocked() {
+	m.promo.dirtyCreated = runtime_nanotime()
+	m.promo.dirtyWrites = 0
+}
+
+// noteMissLocked records a load that had to consult the dirty map.
+func (m *Map) noteMissLocked() {
+	p := &m.promo
+	p.misses++
+	p.writeRate.update(0)
+}
+
+// promotionThresholdLocked returns the number of misses after which the
+// dirty map is promoted, or -1 if misses alone do not promote it now.
+func (m *Map) promotionThresholdLocked() int {
+	s := PromotionState{
+		Misses:    m.misses,
+		Dirty:     m.dirty.len(),
+		NewKeys:   m.promo.dirtyWrites,
+		Age:       runtime_nanotime() - m.promo.dirtyCreated,
+		WriteRate: float64(m.promo.writeRate),
+	}
+	if m.policy == nil {
+		return AdaptivePromotion{}.MissThreshold(s)
+	}
+	return m.policy.MissThreshold(s)
+}
+
+// A PromotionPolicy decides when a Map promotes its dirty map to the read
+// map. Promoting is cheap, but the next Store of a new key copies the
+// whole read map into a new dirty map; until the promotion, every Load of
+// a key added since the last one locks the Map.
+//
+// A Map asks its policy after each Load (or LoadOrStore) that missed the
+// read map, with the Map's mutex held. Range promotes whatever the policy,
+// and so does Promote.
+type PromotionPolicy interface {
+	// Name names the policy in MapStats.
+	Name() string
+
+	// MissThreshold returns the number of misses at which the dirty map
+	// described by s is promoted: it is promoted once s.Misses reaches
+	// it. A negative threshold means not to promote yet.
+	MissThreshold(s PromotionState) int
+}
+
+// PromotionState describes a dirty map to a PromotionPolicy.
+type PromotionState struct {
+	Misses    int     // misses since the last promotion
+	Dirty     int     // keys in the dirty map, which is what the next copy costs
+	NewKeys   int     // keys added to the dirty map since it was created
+	Age       int64   // nanoseconds since the dirty map was created
+	WriteRate float64 // MapStats.WriteRate
+}
+
+// WithPromotionPolicy makes the Map promote its dirty map when p says so.
+// The default is AdaptivePromotion.
+func WithPromotionPolicy(p PromotionPolicy) MapOption {
+	return func(m *Map) {
+		m.policy = p
+	}
+}
+
+// AdaptivePromotion is the default policy: promote once misses reach the
+// size of the dirty map, scaled up by up to four times while new keys keep
+// arriving (see the top of this file).
+type AdaptivePromotion struct{}
+
+func (AdaptivePromotion) Name() string { return "adaptive" }
+
+func (AdaptivePromotion) MissThreshold(s PromotionState) int {
+	// 提升的代价是下一次写新key时把整个read复制一遍, 即len(dirty).
+	// 最近写得越多, 提升后越可能马上又要复制, 所以阈值随写入比例放大
+	cost := s.Dirty
+	return cost + int(float64(cost)*promoteMaxDelay*s.WriteRate)
+}
+
+// SizePromotion promotes once misses reach Factor times the size of the
+// dirty map. A Factor of 1 is the rule of the Map of the standard library;
+// zero means 1.
+type SizePromotion struct {
+	Factor float64
+}
+
+func (SizePromotion) Name() string { return "size" }
+
+func (p SizePromotion) MissThreshold(s PromotionState) int {
+	f := p.Factor
+	if f <= 0 {
+		f = 1
+	}
+	return int(f * float64(s.Dirty))
+}
+
+// MissCountPromotion promotes after a fixed number of misses, whatever the
+// size of the map. It suits a large map whose new keys are read right away:
+// waiting for len(dirty) misses would make every one of those reads lock.
+type MissCountPromotion struct {
+	Misses int
+}
+
+func (MissCountPromotion) Name() string { return "misscount" }
+
+func (p MissCountPromotion) MissThreshold(PromotionState) int {
+	return p.Misses
+}
+
+// TimePromotion promotes at the first miss once the dirty map is After
+// nanoseconds old, so that a map with a steady trickle of new keys copies
+// itself at most once per After, however hot the new keys are.
+type TimePromotion struct {
+	After int64 // nanoseconds; a time.Duration converted to int64
+}
+
+func (TimePromotion) Name() string { return "time" }
+
+func (p TimePromotion) MissThreshold(s PromotionState) int {
+	if s.Age < p.After {
+		return -1
+	}
+	return 0
+}
+
+// ManualPromotion never promotes on misses: the dirty map is promoted only
+// by Promote and Range. The caller takes the copy when it chooses, for
+// instance right after loading a batch of keys.
+type ManualPromotion struct{}
+
+func (ManualPromotion) Name() string { return "manual" }
+
+func (ManualPromotion) MissThreshold(PromotionState) int { return -1 }
+
+// Promote promotes the dirty map to the read map, if there is one, so that
+// Loads of every key stored so far no longer lock the Map.
+func (m *Map) Promote() {
+	read, _ := m.read.Load().(readOnly)
+	if !read.amended {
+		return
+	}
+	m.lock(mapOpPromote)
+	m.awaitReplicaLocked(mapOpPromote)
+	read, _ = m.read.Load().(readOnly)
+	if read.amended {
+		m.promoteLocked(nil)
+	}
+	m.unlock()
+}
+
+// MapStats describes the state of a Map's promotion policy.
+type MapStats struct {
+	// Policy names the rule that decides when the dirty map is promoted.
+	Policy string
+
+	// Promotions is the number of times the dirty map has been promoted to
+	// the read map, by misses or by Range.
+	Promotions int64
+
+	// Misses is the number of loads that had to lock the map because the
+	// key was not in the read map.
+	Misses int64
+
+	// Writes is the number of new keys stored into the dirty map.
+	Writes int64
+
+	// DeferredDeletes is the number of Deletes that found the map locked
+	// and left the removal to the next goroutine to lock it.
+	DeferredDeletes int64
+
+	// Replicas is the number of dirty maps built in the background, for a
+	// map made with WithReadReplica.
+	Replicas int64
+
+	// SpinAcquired is the number of slow-path Loads of a map made with
+	// WithSpinWait that got the mutex without parking, and SpinFallbacks
+	// the number that gave up spinning and called Lock.
+	SpinAcquired  int64
+	SpinFallbacks int64
+
+	// WriteRate is the recent fraction of slow-path operations that stored
+	// a new key, between 0 and 1.
+	WriteRate float64
+
+	// PromotionThreshold is the number of misses since the last promotion
+	// at which the dirty map will be promoted, or -1 if the policy does not
+	// promote it yet, and Pending is how many have occurred. Both are 0 if
+	// there is no dirty map.
+	PromotionThreshold int
+	Pending            int
+}
+
+// Stats returns a snapshot of the promotion statistics of m.
+func (m *Map) Stats() MapStats {
+	m.lock(mapOpStats)
+	defer m.unlock()
+	s := MapStats{
+		Policy:     AdaptivePromotion{}.Name(),
+		Promotions: m.promo.promotions,
+		Misses:     m.promo.misses,
+		Writes:     m.promo.writes,
+		WriteRate:  float64(m.promo.writeRate),
+
+		DeferredDeletes: m.promo.deferredDeletes,
+		Replicas:        m.promo.replicas,
+	}
+	if m.policy != nil {
+		s.Policy = m.policy.Name()
+	}
+	if sp := m.spin; sp != nil {
+		s.SpinAcquired, s.SpinFallbacks = sp.counts()
+	}
+	if !m.dirty.isNil() {
+		s.PromotionThreshold = m.promotionThresholdLocked()
+		s.Pending = m.misses
+	}
+	return s
+}
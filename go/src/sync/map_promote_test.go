@@ -0,0 +1,138 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMapStatsAdaptivePromotion(t *testing.T) {
+	const n = 1000
+	var m sync.Map
+	m.Store(-1, -1)
+	m.Range(func(k, v interface{}) bool { return true }) // promote -1
+
+	for i := 0; i < n; i++ {
+		m.Store(i, i)
+	}
+	s := m.Stats()
+	if s.Policy != "adaptive" {
+		t.Errorf("Policy = %q, want %q", s.Policy, "adaptive")
+	}
+	if s.Writes != n+1 || s.Promotions != 1 {
+		t.Errorf("after bulk insert: Writes = %d, Promotions = %d; want %d, 1", s.Writes, s.Promotions, n+1)
+	}
+	if s.WriteRate < 0.9 {
+		t.Errorf("after bulk insert: WriteRate = %v, want close to 1", s.WriteRate)
+	}
+	if s.PromotionThreshold <= n {
+		t.Errorf("after bulk insert: PromotionThreshold = %d, want more than len(dirty) = %d", s.PromotionThreshold, n+1)
+	}
+
+	// Once writes stop, misses pull the threshold back down to len(dirty)
+	// and the dirty map is promoted well before the maximum delay.
+	misses := 0
+	for m.Stats().Promotions == 1 {
+		if _, ok := m.Load(misses % n); !ok {
+			t.Fatalf("Load(%d) missing", misses%n)
+		}
+		misses++
+		if misses > 2*n {
+			t.Fatalf("no promotion after %d misses", misses)
+		}
+	}
+	if misses < n {
+		t.Errorf("promoted after %d misses, want at least len(dirty) = %d", misses, n+1)
+	}
+	if s = m.Stats(); s.PromotionThreshold != 0 || s.Pending != 0 {
+		t.Errorf("after promotion: PromotionThreshold = %d, Pending = %d; want 0, 0", s.PromotionThreshold, s.Pending)
+	}
+}
+
+// missesToPromote stores n new keys in a Map using p and returns how many
+// Loads of them it takes to promote the dirty map.
+func missesToPromote(t *testing.T, p sync.PromotionPolicy, n int) int {
+	t.Helper()
+	m := sync.NewMap(sync.WithPromotionPolicy(p))
+	for i := 0; i < n; i++ {
+		m.Store(i, i)
+	}
+	if s := m.Stats(); s.Policy != p.Name() {
+		t.Errorf("Policy = %q, want %q", s.Policy, p.Name())
+	}
+	for misses := 0; misses <= 10*n; misses++ {
+		if m.Stats().Promotions > 0 {
+			return misses
+		}
+		m.Load(misses % n)
+	}
+	return -1
+}
+
+func TestMapPromotionPolicies(t *testing.T) {
+	const n = 100
+	for _, tt := range []struct {
+		p    sync.PromotionPolicy
+		want int
+	}{
+		{sync.SizePromotion{}, n},
+		{sync.SizePromotion{Factor: 2}, 2 * n},
+		{sync.MissCountPromotion{Misses: 3}, 3},
+		{sync.TimePromotion{}, 1},
+		{sync.ManualPromotion{}, -1},
+	} {
+		if got := missesToPromote(t, tt.p, n); got != tt.want {
+			t.Errorf("%s %+v: promoted after %d misses, want %d", tt.p.Name(), tt.p, got, tt.want)
+		}
+	}
+}
+
+func TestMapTimePromotion(t *testing.T) {
+	m := sync.NewMap(sync.WithPromotionPolicy(sync.TimePromotion{After: int64(time.Hour)}))
+	m.Store("a", 1)
+	for i := 0; i < 100; i++ {
+		m.Load("a")
+	}
+	s := m.Stats()
+	if s.Promotions != 0 || s.PromotionThreshold != -1 || s.Pending != 100 {
+		t.Errorf("before After: %+v, want no promotion, threshold -1 and 100 pending", s)
+	}
+}
+
+func TestMapPromote(t *testing.T) {
+	var events []sync.MapTransition
+	m := sync.NewMap(
+		sync.WithPromotionPolicy(sync.ManualPromotion{}),
+		sync.WithTransitionHook(func(e sync.MapEvent) { events = append(events, e.Transition) }),
+	)
+	m.Promote() // 没有dirty
+	m.Store("a", 1)
+	m.Load("a")
+	m.Promote()
+	m.Promote()
+	want := []sync.MapTransition{sync.MapDirtyCreated, sync.MapDirtyStored, sync.MapMiss, sync.MapPromoted}
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("transitions = %v, want %v", events, want)
+	}
+	if _, ok := m.Load("a"); !ok || m.Stats().Misses != 1 {
+		t.Errorf("Load after Promote missed the read map")
+	}
+}
+
+// A promoteEvery policy promotes at every other miss: any type can be a
+// policy.
+type promoteEvery struct{}
+
+func (promoteEvery) Name() string                            { return "every" }
+func (promoteEvery) MissThreshold(s sync.PromotionState) int { return 2 }
+
+func TestMapCustomPromotionPolicy(t *testing.T) {
+	if got := missesToPromote(t, promoteEvery{}, 10); got != 2 {
+		t.Errorf("promoted after %d misses, want 2", got)
+	}
+}
@@ -0,0 +1,114 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// defaultPurgeBatch is the batch size of a PurgeWhere given a non-positive
+// one.
+const defaultPurgeBatch = 1024
+
+// A purgeCandidate is an entry that pred matched, with the value it saw.
+type purgeCandidate struct {
+	key interface{}
+	e   *entry
+	p   unsafe.Pointer
+}
+
+// PurgeWhere deletes the entries for which pred returns true, and returns
+// how many it deleted.
+//
+// pred is called without any lock held, as Range calls f. The entries it
+// matches are deleted batchSize at a time, each batch under one
+// acquisition of the Map's mutex, which is released between batches so that
+// concurrent writers of new keys wait for one batch at most. A
+// non-positive batchSize means 1024. An entry is deleted only if it still
+// holds the value pred was called with: one stored again in the meantime is
+// kept.
+//
+// Unlike Delete, PurgeWhere also removes the keys it deletes from the
+// dirty map, if there is one, so that they no longer take space there or
+// have to be skipped when it is promoted.
+//
+// If progress is not nil, it is called after each batch with the number
+// of entries visited and deleted so far; if it returns false, PurgeWhere
+// stops.
+func (m *Map) PurgeWhere(pred func(key, value interface{}) bool, batchSize int, progress func(scanned, purged int) bool) int {
+	if batchSize <= 0 {
+		batchSize = defaultPurgeBatch
+	}
+	read := m.rangeRead()
+	batch := make([]purgeCandidate, 0, batchSize)
+	scanned, purged := 0, 0
+	flush := func() bool {
+		purged += m.purgeLocked(read.bloom, batch)
+		for i := range batch {
+			batch[i] = purgeCandidate{}
+		}
+		batch = batch[:0]
+		return progress == nil || progress(scanned, purged)
+	}
+	stopped := false
+	read.m.iterate(func(k interface{}, e *entry) bool {
+		p := atomic.LoadPointer(&e.p)
+		if p == nil || p == expunged {
+			return true
+		}
+		scanned++
+		if !pred(k, m.decodeValue(*(*interface{})(p))) {
+			return true
+		}
+		batch = append(batch, purgeCandidate{k, e, p})
+		if len(batch) == batchSize && !flush() {
+			stopped = true
+			return false
+		}
+		return true
+	})
+	if !stopped && len(batch) > 0 {
+		flush()
+	}
+	return purged
+}
+
+// purgeLocked deletes the candidates of one batch with m.mu held, and
+// returns how many it deleted. b is the filter of the read map they are
+// in.
+func (m *Map) purgeLocked(b *mapBloom, batch []purgeCandidate) int {
+	if len(batch) == 0 {
+		return 0
+	}
+	n := 0
+	if ix := m.index; ix != nil {
+		ix.mu.Lock()
+		defer ix.mu.Unlock()
+	}
+	m.lock(mapOpPurge)
+	for _, c := range batch {
+		sh := m.beginEntryWrite(c.e)
+		ok := atomic.CompareAndSwapPointer(&c.e.p, c.p, nil)
+		m.endEntryWrite(sh, c.e, c.p, ok)
+		if !ok {
+			// 之后又被写过, 不是pred看到的值了
+			continue
+		}
+		n++
+		b.remove(b.hash(c.key))
+		if m.index != nil {
+			m.index.setLocked(c.key, nil, false)
+		}
+		// 有dirty时, 它包含read中所有没有expunged的entry. 把entry标记为
+		// expunged再从dirty删除, 之后再Store这个key要加锁放回dirty
+		if !m.dirty.isNil() && c.e.tryExpungeLocked() {
+			m.dirty.delete(c.key)
+			m.transitionLocked(MapDirtyDeleted, c.key)
+		}
+	}
+	m.unlock()
+	return n
+}
@@ -0,0 +1,117 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"sync"
+	"testing"
+)
+
+func even(k, v interface{}) bool { return k.(int)%2 == 0 }
+
+func TestMapPurgeWhere(t *testing.T) {
+	var m sync.Map
+	for i := 0; i < 1000; i++ {
+		m.Store(i, i)
+	}
+	var calls []int
+	n := m.PurgeWhere(even, 100, func(scanned, purged int) bool {
+		calls = append(calls, purged)
+		return true
+	})
+	if n != 500 {
+		t.Errorf("PurgeWhere = %d; want 500", n)
+	}
+	if len(calls) != 5 || calls[0] != 100 || calls[4] != 500 {
+		t.Errorf("progress called with purged %v; want 100, 200, ... 500", calls)
+	}
+	for i := 0; i < 1000; i++ {
+		if _, ok := m.Load(i); ok != (i%2 == 1) {
+			t.Fatalf("Load(%d) ok = %v after purging the even keys", i, ok)
+		}
+	}
+}
+
+func TestMapPurgeWhereStop(t *testing.T) {
+	var m sync.Map
+	for i := 0; i < 1000; i++ {
+		m.Store(i, i)
+	}
+	n := m.PurgeWhere(even, 10, func(scanned, purged int) bool { return false })
+	if n != 10 {
+		t.Errorf("PurgeWhere = %d after stopping at the first batch; want 10", n)
+	}
+	left := 0
+	m.Range(func(k, v interface{}) bool {
+		left++
+		return true
+	})
+	if left != 990 {
+		t.Errorf("%d keys left; want 990", left)
+	}
+}
+
+// pred看到的值之后又被改写, 不删除
+func TestMapPurgeWhereStoredAgain(t *testing.T) {
+	var m sync.Map
+	m.Store("a", 1)
+	m.Store("b", 1)
+	n := m.PurgeWhere(func(k, v interface{}) bool {
+		if k == "a" {
+			m.Store("a", 2)
+		}
+		return true
+	}, 0, nil)
+	if n != 1 {
+		t.Errorf("PurgeWhere = %d; want 1", n)
+	}
+	if v, ok := m.Load("a"); !ok || v != 2 {
+		t.Errorf("Load(a) = %v, %v; want the value stored during PurgeWhere", v, ok)
+	}
+	if _, ok := m.Load("b"); ok {
+		t.Error("b not purged")
+	}
+}
+
+// 遍历期间有新key创建了dirty, 删除的key也从dirty中删除
+func TestMapPurgeWhereDirty(t *testing.T) {
+	deleted := 0
+	m := sync.NewMap(sync.WithTransitionHook(func(ev sync.MapEvent) {
+		if ev.Transition == sync.MapDirtyDeleted {
+			deleted++
+		}
+	}))
+	for i := 0; i < 100; i++ {
+		m.Store(i, i)
+	}
+	m.Promote()
+	first := true
+	n := m.PurgeWhere(func(k, v interface{}) bool {
+		if first {
+			first = false
+			m.Store("new", 0)
+		}
+		return k != "new" && even(k, v)
+	}, 1, nil)
+	if n != 50 || deleted != 50 {
+		t.Errorf("PurgeWhere = %d, with %d keys deleted from the dirty map; want 50 and 50", n, deleted)
+	}
+	m.Store(0, "again")
+	m.Promote()
+	got := 0
+	m.Range(func(k, v interface{}) bool {
+		got++
+		if i, ok := k.(int); ok && i%2 == 0 && i != 0 {
+			t.Errorf("purged key %v present", k)
+		}
+		return true
+	})
+	if got != 52 {
+		t.Errorf("Range visited %d keys; want 52", got)
+	}
+	if v, _ := m.Load(0); v != "again" {
+		t.Errorf("Load(0) = %v after storing it again", v)
+	}
+}
@@ -0,0 +1,374 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+// QuotaMap is a map bounded by the approximate memory of its contents
+// rather than by their number. When values range from a hundred bytes to
+// megabytes, a bound on the number of entries says nothing about the memory
+// they take.
+//
+// The memory of an entry is whatever the Size function of its
+// QuotaMapConfig says it is, and is charged when the entry is stored. Once
+// the total exceeds the quota, the Store that went over evicts entries until
+// it is back under.
+//
+// The entries are spread over hash-sharded maps, each guarded by an RWMutex
+// and keeping its own byte count, like the RWMutex shards of a HybridMap.
+// Eviction picks shards in turn and, within a shard, the entry found by a
+// CLOCK hand: an entry loaded since the hand last passed it gets a second
+// chance. So the entries evicted are close to, but not exactly, the least
+// recently used ones.
+//
+// A QuotaMap must be created with NewQuotaMap and must not be copied after
+// first use.
+type QuotaMap struct {
+	bytes        int64 // accessed atomically; first so it is 64-bit aligned
+	evicted      int64 // accessed atomically
+	evictedBytes int64 // accessed atomically
+
+	quota   int64
+	size    func(key, value interface{}) int64
+	onEvict func(key, value interface{})
+
+	hand   uint32 // accessed atomically; the next shard to evict from
+	seed   uintptr
+	shards []quotaShard
+}
+
+// QuotaMapConfig configures a QuotaMap.
+type QuotaMapConfig struct {
+	// Quota is the most bytes the entries may take, as measured by Size.
+	// It must be positive.
+	Quota int64
+
+	// Size returns the approximate number of bytes of an entry. It must not
+	// be nil, must not return a negative number, and must return the same
+	// size every time for the same key and value.
+	Size func(key, value interface{}) int64
+
+	// OnEvict, if not nil, is called with each entry evicted to stay within
+	// the quota, after the entry has been removed and with no lock held.
+	// It is not called for entries replaced by Store or removed by Delete.
+	OnEvict func(key, value interface{})
+}
+
+type quotaShard struct {
+	quotaShardInternal
+
+	// Prevents false sharing on widespread platforms with
+	// 128 mod (cache line size) = 0 .
+	pad [cacheLinePad - unsafe.Sizeof(quotaShardInternal{})%cacheLinePad]byte
+}
+
+type quotaShardInternal struct {
+	bytes int64 // written with mu held, read atomically; first so it is 64-bit aligned
+
+	mu RWMutex
+	m  map[interface{}]*quotaEntry
+
+	// hand is the next entry the CLOCK hand looks at. The entries of the
+	// shard form a ring through prev and next; new entries go in just
+	// behind the hand, so that they are the last it reaches.
+	hand *quotaEntry
+}
+
+type quotaEntry struct {
+	key, value interface{}
+	size       int64
+	ref        uint32 // set by Load, cleared by the hand; accessed atomically
+	prev, next *quotaEntry
+}
+
+// NewQuotaMap returns an empty QuotaMap configured by cfg.
+// It panics if cfg.Quota is not positive or cfg.Size is nil.
+func NewQuotaMap(cfg QuotaMapConfig) *QuotaMap {
+	if cfg.Quota <= 0 {
+		panic("sync: NewQuotaMap with non-positive Quota")
+	}
+	if cfg.Size == nil {
+		panic("sync: NewQuotaMap with nil Size")
+	}
+	// 和rwShards一样, 分片数取不小于4*GOMAXPROCS的2的幂
+	n := 1
+	for n < 4*runtime.GOMAXPROCS(0) {
+		n <<= 1
+	}
+	m := &QuotaMap{
+		quota:   cfg.Quota,
+		size:    cfg.Size,
+		onEvict: cfg.OnEvict,
+		seed:    uintptr(fastrand()),
+		shards:  make([]quotaShard, n),
+	}
+	for i := range m.shards {
+		m.shards[i].m = make(map[interface{}]*quotaEntry)
+	}
+	return m
+}
+
+func (m *QuotaMap) shard(key interface{}) *quotaShard {
+	return &m.shards[runtime_efaceHash(key, m.seed)&uintptr(len(m.shards)-1)]
+}
+
+// Load returns the value stored in the map for a key, or nil if no
+// value is present.
+// The ok result indicates whether value was found in the map.
+func (m *QuotaMap) Load(key interface{}) (value interface{}, ok bool) {
+	sh := m.shard(key)
+	sh.mu.RLock()
+	e, ok := sh.m[key]
+	if ok {
+		value = e.value
+		// 已经置位就不再写, 热点key不会让各个核争抢这个entry
+		if atomic.LoadUint32(&e.ref) == 0 {
+			atomic.StoreUint32(&e.ref, 1)
+		}
+	}
+	sh.mu.RUnlock()
+	return value, ok
+}
+
+// Store sets the value for a key, and then evicts entries until the map is
+// within its quota again.
+//
+// An entry larger than the whole quota is not stored: Store deletes the
+// key and hands the entry straight to OnEvict.
+func (m *QuotaMap) Store(key, value interface{}) {
+	size := m.size(key, value)
+	if size < 0 {
+		panic("sync: QuotaMap Size returned a negative size")
+	}
+	if size > m.quota {
+		m.Delete(key)
+		atomic.AddInt64(&m.evicted, 1)
+		atomic.AddInt64(&m.evictedBytes, size)
+		if m.onEvict != nil {
+			m.onEvict(key, value)
+		}
+		return
+	}
+
+	sh := m.shard(key)
+	sh.mu.Lock()
+	delta := size
+	e, ok := sh.m[key]
+	if ok {
+		delta -= e.size
+		e.value, e.size = value, size
+	} else {
+		e = &quotaEntry{key: key, value: value, size: size}
+		sh.m[key] = e
+		sh.insertLocked(e)
+	}
+	atomic.StoreInt64(&sh.bytes, sh.bytes+delta)
+	sh.mu.Unlock()
+
+	if atomic.AddInt64(&m.bytes, delta) > m.quota {
+		m.evict(e)
+	}
+}
+
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores the given value, as Store would, and returns it.
+// The loaded result is true if the value was loaded, false if stored.
+func (m *QuotaMap) LoadOrStore(key, value interface{}) (actual interface{}, loaded bool) {
+	if v, ok := m.Load(key); ok {
+		return v, true
+	}
+	size := m.size(key, value)
+	if size < 0 {
+		panic("sync: QuotaMap Size returned a negative size")
+	}
+	sh := m.shard(key)
+	sh.mu.Lock()
+	if e, ok := sh.m[key]; ok {
+		atomic.StoreUint32(&e.ref, 1)
+		v := e.value
+		sh.mu.Unlock()
+		return v, true
+	}
+	if size > m.quota {
+		sh.mu.Unlock()
+		atomic.AddInt64(&m.evicted, 1)
+		atomic.AddInt64(&m.evictedBytes, size)
+		if m.onEvict != nil {
+			m.onEvict(key, value)
+		}
+		return value, false
+	}
+	e := &quotaEntry{key: key, value: value, size: size}
+	sh.m[key] = e
+	sh.insertLocked(e)
+	atomic.StoreInt64(&sh.bytes, sh.bytes+size)
+	sh.mu.Unlock()
+
+	if atomic.AddInt64(&m.bytes, size) > m.quota {
+		m.evict(e)
+	}
+	return value, false
+}
+
+// Delete deletes the value for a key.
+func (m *QuotaMap) Delete(key interface{}) {
+	sh := m.shard(key)
+	sh.mu.Lock()
+	e, ok := sh.m[key]
+	if !ok {
+		sh.mu.Unlock()
+		return
+	}
+	delete(sh.m, key)
+	sh.removeLocked(e)
+	sh.mu.Unlock()
+	atomic.AddInt64(&m.bytes, -e.size)
+}
+
+// Range calls f sequentially for each key and value present in the map.
+// If f returns false, range stops the iteration.
+//
+// Like the Range of a HybridMap, it copies each shard under its read lock
+// and calls f with no lock held, so f may use the map. Range does not count
+// as a use of the entries it visits.
+func (m *QuotaMap) Range(f func(key, value interface{}) bool) {
+	var kvs []interface{}
+	for i := range m.shards {
+		sh := &m.shards[i]
+		kvs = kvs[:0]
+		sh.mu.RLock()
+		for k, e := range sh.m {
+			kvs = append(kvs, k, e.value)
+		}
+		sh.mu.RUnlock()
+		for j := 0; j < len(kvs); j += 2 {
+			if !f(kvs[j], kvs[j+1]) {
+				return
+			}
+		}
+	}
+}
+
+// QuotaMapStats describes the contents of a QuotaMap.
+type QuotaMapStats struct {
+	Len          int   // entries in the map
+	Bytes        int64 // total size of the entries, as measured by Size
+	Quota        int64 // QuotaMapConfig.Quota
+	Evicted      int64 // entries evicted so far
+	EvictedBytes int64 // total size of the entries evicted so far
+}
+
+// Stats returns a snapshot of the contents of m. Concurrent Stores may make
+// Bytes briefly exceed Quota.
+func (m *QuotaMap) Stats() QuotaMapStats {
+	s := QuotaMapStats{
+		Bytes:        atomic.LoadInt64(&m.bytes),
+		Quota:        m.quota,
+		Evicted:      atomic.LoadInt64(&m.evicted),
+		EvictedBytes: atomic.LoadInt64(&m.evictedBytes),
+	}
+	for i := range m.shards {
+		sh := &m.shards[i]
+		sh.mu.RLock()
+		s.Len += len(sh.m)
+		sh.mu.RUnlock()
+	}
+	return s
+}
+
+// evict removes entries until m is within its quota. It does not evict
+// keep, the entry whose Store went over the quota: the entry just stored is
+// the most recently used one.
+func (m *QuotaMap) evict(keep *quotaEntry) {
+	for idle := 0; atomic.LoadInt64(&m.bytes) > m.quota; {
+		sh := m.victimShard()
+		if sh == nil || idle > len(m.shards) {
+			// 分片中已经没有可以淘汰的了: 超出的字节数属于还没有
+			// 加进分片的Store, 由它们自己淘汰
+			return
+		}
+		sh.mu.Lock()
+		e := sh.victimLocked(keep)
+		if e != nil {
+			delete(sh.m, e.key)
+			sh.removeLocked(e)
+		}
+		sh.mu.Unlock()
+		if e == nil {
+			idle++
+			continue
+		}
+		idle = 0
+		atomic.AddInt64(&m.bytes, -e.size)
+		atomic.AddInt64(&m.evicted, 1)
+		atomic.AddInt64(&m.evictedBytes, e.size)
+		if m.onEvict != nil {
+			m.onEvict(e.key, e.value)
+		}
+	}
+}
+
+// victimShard returns the next shard in turn that holds any bytes, or nil
+// if every shard is empty.
+func (m *QuotaMap) victimShard() *quotaShard {
+	// 每个分片有自己的字节数, 轮流从非空的分片中淘汰, 不需要全局的顺序
+	for range m.shards {
+		i := atomic.AddUint32(&m.hand, 1)
+		sh := &m.shards[i&uint32(len(m.shards)-1)]
+		if atomic.LoadInt64(&sh.bytes) > 0 {
+			return sh
+		}
+	}
+	return nil
+}
+
+// victimLocked advances the hand to the next entry other than keep not
+// loaded since the hand last passed it and returns it, or nil if the shard
+// holds no entry but keep. It stops within two turns of the ring. sh.mu
+// must be held.
+func (sh *quotaShard) victimLocked(keep *quotaEntry) *quotaEntry {
+	for n := 2*len(sh.m) + 1; n > 0 && sh.hand != nil; n-- {
+		e := sh.hand
+		if e != keep && atomic.LoadUint32(&e.ref) == 0 {
+			return e
+		}
+		atomic.StoreUint32(&e.ref, 0)
+		sh.hand = e.next
+	}
+	return nil
+}
+
+// insertLocked adds e to the ring just behind the hand. sh.mu must be held.
+func (sh *quotaShard) insertLocked(e *quotaEntry) {
+	if sh.hand == nil {
+		e.prev, e.next = e, e
+		sh.hand = e
+		return
+	}
+	e.next = sh.hand
+	e.prev = sh.hand.prev
+	e.prev.next = e
+	sh.hand.prev = e
+}
+
+// removeLocked takes e out of the ring and the shard's byte count. The
+// caller removes it from sh.m. sh.mu must be held.
+func (sh *quotaShard) removeLocked(e *quotaEntry) {
+	if e.next == e {
+		sh.hand = nil
+	} else {
+		if sh.hand == e {
+			sh.hand = e.next
+		}
+		e.prev.next = e.next
+		e.next.prev = e.prev
+	}
+	e.prev, e.next = nil, nil
+	atomic.StoreInt64(&sh.bytes, sh.bytes-e.size)
+}
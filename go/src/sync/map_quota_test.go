@@ -0,0 +1,195 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"math/rand"
+	"runtime"
+	"sync"
+	"testing"
+	"testing/quick"
+)
+
+// blobSize measures values that are []byte by their length.
+func blobSize(key, value interface{}) int64 {
+	if b, ok := value.([]byte); ok {
+		return int64(len(b))
+	}
+	return 8
+}
+
+func TestQuotaMapEvicts(t *testing.T) {
+	var evicted []interface{}
+	m := sync.NewQuotaMap(sync.QuotaMapConfig{
+		Quota:   1000,
+		Size:    blobSize,
+		OnEvict: func(k, v interface{}) { evicted = append(evicted, k) },
+	})
+	for i := 0; i < 10; i++ {
+		m.Store(i, make([]byte, 100))
+	}
+	if s := m.Stats(); s.Len != 10 || s.Bytes != 1000 || s.Evicted != 0 {
+		t.Fatalf("after filling the quota, Stats = %+v", s)
+	}
+
+	// 一个大的值要把很多小的挤出去
+	m.Store("big", make([]byte, 550))
+	s := m.Stats()
+	if s.Bytes > 1000 || s.Len != 5 || s.Evicted != 6 || s.EvictedBytes != 600 {
+		t.Errorf("after storing 550 bytes, Stats = %+v; want 4 small values and the big one", s)
+	}
+	if len(evicted) != 6 {
+		t.Errorf("OnEvict called for %v, want 6 keys", evicted)
+	}
+	if _, ok := m.Load("big"); !ok {
+		t.Error("the value just stored was evicted")
+	}
+	n := int64(0)
+	m.Range(func(k, v interface{}) bool {
+		n += blobSize(k, v)
+		return true
+	})
+	if n != s.Bytes {
+		t.Errorf("Range visited %d bytes, Stats reports %d", n, s.Bytes)
+	}
+}
+
+func TestQuotaMapSecondChance(t *testing.T) {
+	// 只有一个P时有4个分片, 轮流从每个分片淘汰一个. 每个分片里都
+	// (几乎必然)有没有Load过的key, 被Load过的key都应该留下来
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	m := sync.NewQuotaMap(sync.QuotaMapConfig{Quota: 64 * 100, Size: blobSize})
+	for i := 0; i < 64; i++ {
+		m.Store(i, make([]byte, 100))
+	}
+	for i := 0; i < 64; i += 2 {
+		m.Load(i)
+	}
+	for i := 64; i < 64+4; i++ {
+		m.Store(i, make([]byte, 100))
+	}
+	for i := 0; i < 64; i += 2 {
+		if _, ok := m.Load(i); !ok {
+			t.Errorf("key %d was evicted although it had been loaded", i)
+		}
+	}
+	if s := m.Stats(); s.Evicted != 4 || s.Len != 64 {
+		t.Errorf("Stats = %+v, want 4 evicted and 64 left", s)
+	}
+}
+
+func TestQuotaMapOversize(t *testing.T) {
+	var evicted []interface{}
+	m := sync.NewQuotaMap(sync.QuotaMapConfig{
+		Quota:   100,
+		Size:    blobSize,
+		OnEvict: func(k, v interface{}) { evicted = append(evicted, k) },
+	})
+	m.Store("a", make([]byte, 10))
+	m.Store("a", make([]byte, 101))
+	if _, ok := m.Load("a"); ok {
+		t.Error("a value larger than the quota was stored")
+	}
+	if v, loaded := m.LoadOrStore("b", make([]byte, 200)); loaded || len(v.([]byte)) != 200 {
+		t.Errorf("LoadOrStore of an oversized value = %v, %v", len(v.([]byte)), loaded)
+	}
+	if s := m.Stats(); s.Len != 0 || s.Bytes != 0 || s.Evicted != 2 || s.EvictedBytes != 301 {
+		t.Errorf("Stats = %+v", s)
+	}
+	if len(evicted) != 2 || evicted[0] != "a" || evicted[1] != "b" {
+		t.Errorf("OnEvict called for %v, want [a b]", evicted)
+	}
+}
+
+func TestQuotaMapAccounting(t *testing.T) {
+	m := sync.NewQuotaMap(sync.QuotaMapConfig{Quota: 1 << 20, Size: blobSize})
+	m.Store("a", make([]byte, 100))
+	m.Store("a", make([]byte, 30)) // 替换, 不是新增
+	m.LoadOrStore("a", make([]byte, 500))
+	m.LoadOrStore("b", make([]byte, 7))
+	m.Delete("b")
+	m.Delete("nosuch")
+	if s := m.Stats(); s.Len != 1 || s.Bytes != 30 {
+		t.Errorf("Stats = %+v, want one entry of 30 bytes", s)
+	}
+}
+
+func TestQuotaMapMatchesRWMutex(t *testing.T) {
+	apply := func(calls []mapCall) ([]mapResult, map[interface{}]interface{}) {
+		m := sync.NewQuotaMap(sync.QuotaMapConfig{Quota: 1 << 30, Size: blobSize})
+		return applyCalls(m, calls)
+	}
+	if err := quick.CheckEqual(apply, applyRWMutexMap, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestQuotaMapConcurrent(t *testing.T) {
+	const quota = 64 << 10
+	var evicted int64
+	var mu sync.Mutex
+	m := sync.NewQuotaMap(sync.QuotaMapConfig{
+		Quota: quota,
+		Size:  blobSize,
+		OnEvict: func(k, v interface{}) {
+			mu.Lock()
+			evicted += int64(len(v.([]byte)))
+			mu.Unlock()
+		},
+	})
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			r := rand.New(rand.NewSource(int64(g)))
+			for i := 0; i < 2000; i++ {
+				k := r.Intn(500)
+				switch r.Intn(10) {
+				case 0:
+					m.Delete(k)
+				case 1, 2, 3:
+					m.Load(k)
+				default:
+					m.Store(k, make([]byte, 1+r.Intn(2048)))
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	s := m.Stats()
+	if s.Bytes > quota {
+		t.Errorf("after the writers stopped, %d bytes are stored, over the quota of %d", s.Bytes, quota)
+	}
+	var n, sum int64
+	m.Range(func(k, v interface{}) bool {
+		n++
+		sum += blobSize(k, v)
+		return true
+	})
+	if n != int64(s.Len) || sum != s.Bytes {
+		t.Errorf("Range visited %d entries of %d bytes, Stats = %+v", n, sum, s)
+	}
+	if evicted != s.EvictedBytes {
+		t.Errorf("OnEvict saw %d bytes, Stats.EvictedBytes = %d", evicted, s.EvictedBytes)
+	}
+}
+
+func TestNewQuotaMapPanics(t *testing.T) {
+	for _, cfg := range []sync.QuotaMapConfig{
+		{Quota: 0, Size: blobSize},
+		{Quota: 1},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("NewQuotaMap(%+v) did not panic", cfg)
+				}
+			}()
+			sync.NewQuotaMap(cfg)
+		}()
+	}
+}
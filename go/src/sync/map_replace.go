@@ -0,0 +1,75 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// ReplaceAll replaces the whole content of the map with data: once it
+// returns, the map holds the keys of data with their values, and no other
+// key. data is not retained, and may be changed afterwards.
+//
+// The new content is built off to the side, without locking the map, into
+// a read map of its own, which then replaces the read map and the dirty
+// map at once, in a single swap with the mutex held. A Load or Range sees
+// either the old content or the new one, never a mix of the two, and
+// Loads of keys in the old read map do not wait at any point. This makes
+// ReplaceAll the way to reload a dataset as a whole: one swap instead of a
+// Store and a Delete for each key, each of which readers would see.
+//
+// Writes that run concurrently with ReplaceAll are ordered before it, and
+// so may be lost: a Store that has just found the key in the old read map
+// can still land in the old entry after the swap.
+func (m *Map) ReplaceAll(data map[interface{}]interface{}) {
+	old, _ := m.read.Load().(readOnly)
+	bloom := newReplacedBloom(old.bloom, data)
+	read := newEntries(m.backend, m.hasher, len(data))
+	var slabs entrySlabs
+	size := slabSize(len(data))
+	for k, v := range data {
+		// 每个entry指向自己的value
+		v := m.encodeValue(v)
+		read.store(k, slabs.next(m, size, &v))
+	}
+	var byIndex map[string]map[interface{}]struct{}
+	var byKey map[interface{}][]string
+	ix := m.index
+	if ix != nil {
+		// 新索引也在锁外建好, 持有ix.mu时只做替换
+		byIndex = make(map[string]map[interface{}]struct{})
+		byKey = make(map[interface{}][]string, len(data))
+		for k, v := range data {
+			iks := ix.f(v)
+			if len(iks) == 0 {
+				continue
+			}
+			for _, ik := range iks {
+				keys := byIndex[ik]
+				if keys == nil {
+					keys = make(map[interface{}]struct{})
+					byIndex[ik] = keys
+				}
+				keys[k] = struct{}{}
+			}
+			byKey[k] = iks
+		}
+		ix.mu.Lock()
+		defer ix.mu.Unlock()
+	}
+
+	m.lock(mapOpReplace)
+	// 后台副本还在往dirty中复制旧read的entry, 等它结束再丢弃dirty
+	m.awaitReplicaLocked(mapOpReplace)
+	m.beginPromotionLocked()
+	m.read.Store(readOnly{m: read, bloom: bloom})
+	m.endPromotionLocked()
+	m.dirty = entries{}
+	m.misses = 0
+	if ix != nil {
+		ix.byIndex, ix.byKey = byIndex, byKey
+	}
+	m.transitionLocked(MapReplaced, nil)
+	if m.replicas {
+		m.startReplicaLocked()
+	}
+	m.unlock()
+}
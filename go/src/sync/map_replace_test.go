@@ -0,0 +1,177 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"runtime"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestMapReplaceAll(t *testing.T) {
+	for _, opts := range [][]sync.MapOption{
+		nil,
+		{sync.WithBackend(sync.SwissTableBackend)},
+		{sync.WithEntryStats()},
+		{sync.WithPaddedEntries(), sync.WithReadReplica()},
+	} {
+		var events []sync.MapTransition
+		opts = append(opts, sync.WithTransitionHook(func(e sync.MapEvent) {
+			events = append(events, e.Transition)
+		}))
+		m := sync.NewMap(opts...)
+		for i := 0; i < 100; i++ {
+			m.Store(i, i)
+		}
+		m.Promote()
+		m.Store(100, 100) // 只在dirty中
+		m.Delete(0)
+
+		data := make(map[interface{}]interface{})
+		for i := 50; i < 200; i++ {
+			data[i] = -i
+		}
+		m.ReplaceAll(data)
+		delete(data, 50)
+		for i := 0; i < 200; i++ {
+			v, ok := m.Load(i)
+			if i < 50 {
+				if ok {
+					t.Errorf("%d = %v after ReplaceAll without it", i, v)
+				}
+			} else if !ok || v != -i {
+				t.Errorf("%d = %v, %v; want %d", i, v, ok, -i)
+			}
+		}
+		if got := events[len(events)-1]; got != sync.MapReplaced {
+			t.Errorf("last transition %v, want %v", got, sync.MapReplaced)
+		}
+
+		// 替换之后, Map照常可以写
+		m.Store(1, 1)
+		m.Delete(199)
+		n := 0
+		m.Range(func(k, v interface{}) bool {
+			n++
+			return true
+		})
+		if n != 150 {
+			t.Errorf("Range visited %d keys after ReplaceAll, want 150", n)
+		}
+		m.ReplaceAll(nil)
+		if _, ok := m.Load(1); ok {
+			t.Error("key left after ReplaceAll(nil)")
+		}
+	}
+}
+
+func TestMapReplaceAllIndex(t *testing.T) {
+	m := sync.NewMap(sync.WithIndex(func(v interface{}) []string {
+		return []string{v.(string)[:1]}
+	}))
+	m.Store("x", "a1")
+	m.Store("y", "b1")
+	m.ReplaceAll(map[interface{}]interface{}{"y": "a2", "z": "c2"})
+	if got := m.LoadByIndex("a"); got.Len() != 1 {
+		t.Errorf("LoadByIndex(a) has %d entries, want only y", got.Len())
+	} else if v, _ := got.Load("y"); v != "a2" {
+		t.Errorf("LoadByIndex(a): y = %v, want a2", v)
+	}
+	if got := m.LoadByIndex("b"); got.Len() != 0 {
+		t.Errorf("LoadByIndex(b) has %d entries after ReplaceAll", got.Len())
+	}
+	m.Store("z", "a3")
+	if got := m.LoadByIndex("a").Len(); got != 2 {
+		t.Errorf("LoadByIndex(a) has %d entries after Store, want 2", got)
+	}
+}
+
+// TestMapReplaceAllConsistent checks that readers see each dataset whole:
+// every key of the map holds the generation of the last ReplaceAll.
+func TestMapReplaceAllConsistent(t *testing.T) {
+	const keys, gens = 256, 50
+	dataset := func(g int) map[interface{}]interface{} {
+		data := make(map[interface{}]interface{}, keys)
+		for k := 0; k < keys; k++ {
+			data[k] = g
+		}
+		return data
+	}
+	m := new(sync.Map)
+	m.ReplaceAll(dataset(0))
+
+	var wg sync.WaitGroup
+	done := make(chan struct{})
+	for r := 0; r < 2; r++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				// Range看到的是一代完整的数据
+				first := -1
+				m.Range(func(k, v interface{}) bool {
+					if first < 0 {
+						first = v.(int)
+					} else if v != first {
+						t.Errorf("Range saw generations %d and %v", first, v)
+						return false
+					}
+					return true
+				})
+				// 依次读出的代数不会倒退
+				last := 0
+				for k := 0; k < keys; k++ {
+					v, ok := m.Load(k)
+					if !ok || v.(int) < last {
+						t.Errorf("Load(%d) = %v, %v after generation %d", k, v, ok, last)
+						return
+					}
+					last = v.(int)
+				}
+				runtime.Gosched()
+			}
+		}()
+	}
+	for g := 1; g <= gens; g++ {
+		m.ReplaceAll(dataset(g))
+		runtime.Gosched()
+	}
+	close(done)
+	wg.Wait()
+}
+
+func BenchmarkMapReplaceAll(b *testing.B) {
+	const keys = 100000
+	data := make(map[interface{}]interface{}, keys)
+	for k := 0; k < keys; k++ {
+		data[strconv.Itoa(k)] = k
+	}
+	b.Run("ReplaceAll", func(b *testing.B) {
+		m := new(sync.Map)
+		for i := 0; i < b.N; i++ {
+			m.ReplaceAll(data)
+		}
+	})
+	b.Run("Store", func(b *testing.B) {
+		m := new(sync.Map)
+		for i := 0; i < b.N; i++ {
+			m.Range(func(k, v interface{}) bool {
+				if _, ok := data[k]; !ok {
+					m.Delete(k)
+				}
+				return true
+			})
+			for k, v := range data {
+				m.Store(k, v)
+			}
+		}
+	})
+}
@@ -0,0 +1,107 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// Promoting the dirty map is a pointer swap, but it leaves a Map with no
+// dirty map, and the next Store of a new key copies every live entry of
+// the read map into a new one with mu held. On a map of 10 million keys
+// that copy takes seconds, and every slow path waits for it.
+//
+// WithReadReplica moves the copy off the writers' path. Right after each
+// promotion, a goroutine builds the next dirty map, the replica, out of
+// the new read map, a batch of replicaBatch entries at a time, locking mu
+// for each batch only. The replica is the Map's dirty map from the start:
+// new keys are stored into it while it is built, and an entry the builder
+// sees deleted is expunged then, exactly as dirtyLocked does. Until the
+// builder is done, though, the dirty map lacks the read map's entries the
+// builder has not reached, so it must not be promoted: misses are counted
+// but do not promote, and Range, Promote and WriteSnapshot wait for the
+// builder, without holding mu.
+
+// replicaBatch is how many entries the builder copies per lock of mu.
+const replicaBatch = 1024
+
+// WithReadReplica makes the Map build each new dirty map in the
+// background right after a promotion, instead of copying the read map
+// when the next new key is stored. Writers then never wait for that copy;
+// the cost is a goroutine and a copy after every promotion, whether or
+// not new keys follow, and promotions held off while the copy runs.
+func WithReadReplica() MapOption {
+	return func(m *Map) {
+		m.replicas = true
+	}
+}
+
+// A replicaBuild is the building of a replica. done is closed once the
+// builder has copied every entry and cleared Map.replica.
+type replicaBuild struct {
+	done chan struct{}
+}
+
+type replicaEntry struct {
+	key interface{}
+	e   *entry
+}
+
+// startReplicaLocked creates an empty dirty map for the read map just
+// promoted, and starts the goroutine that fills it. m.mu must be held.
+func (m *Map) startReplicaLocked() {
+	read, _ := m.read.Load().(readOnly)
+	m.dirty = newEntries(m.backend, m.hasher, m.dirtyCapacity(read.m.len()))
+	m.noteDirtyLocked()
+	r := &replicaBuild{done: make(chan struct{})}
+	m.replica = r
+	m.promo.replicas++
+	go m.buildReplica(r, read.m)
+}
+
+// buildReplica copies the live entries of read, the read map when r
+// started, into the dirty map. read cannot change meanwhile, since the
+// dirty map is not promoted while m.replica is set.
+func (m *Map) buildReplica(r *replicaBuild, read entries) {
+	batch := make([]replicaEntry, 0, replicaBatch)
+	read.iterate(func(k interface{}, e *entry) bool {
+		batch = append(batch, replicaEntry{k, e})
+		if len(batch) == cap(batch) {
+			m.lock(mapOpReplica)
+			m.copyReplicaLocked(batch)
+			m.unlock()
+			batch = batch[:0]
+		}
+		return true
+	})
+	m.lock(mapOpReplica)
+	m.copyReplicaLocked(batch)
+	m.replica = nil
+	close(r.done)
+	m.unlock()
+}
+
+// copyReplicaLocked copies the live entries of batch into the dirty map,
+// and expunges the deleted ones. m.mu must be held.
+func (m *Map) copyReplicaLocked(batch []replicaEntry) {
+	for _, re := range batch {
+		// 复制到这里之前, entry可能已经被PurgeWhere清除, 又被Store放回了
+		// dirty; 它已经在dirty中了, 不能再清除
+		if _, ok := m.dirty.load(re.key); ok {
+			continue
+		}
+		if !re.e.tryExpungeLocked() {
+			m.dirty.store(re.key, re.e)
+		}
+	}
+}
+
+// awaitReplicaLocked waits until no replica is being built, for the
+// callers that promote the dirty map whatever the misses. It unlocks m.mu
+// while it waits, so the caller must load m.read again afterwards. m.mu
+// must be held; op is the operation to lock it for again.
+func (m *Map) awaitReplicaLocked(op MapOp) {
+	for r := m.replica; r != nil; r = m.replica {
+		m.unlock()
+		<-r.done
+		m.lock(op)
+	}
+}
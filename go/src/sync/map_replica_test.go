@@ -0,0 +1,139 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// TestMapReadReplica checks that a promotion builds the next dirty map by
+// itself, so that the first new key after it finds every key there.
+func TestMapReadReplica(t *testing.T) {
+	m := sync.NewMap(sync.WithReadReplica())
+	const n = 5000 // 多于一批
+	for i := 0; i < n; i++ {
+		m.Store(i, i)
+	}
+	m.Promote()
+	sync.AwaitReplica(m)
+	s := m.State()
+	if len(s.Read) != n || len(s.Dirty) != n || s.Amended {
+		t.Fatalf("after the replica: read %d dirty %d amended %v; want %d, %d, false",
+			len(s.Read), len(s.Dirty), s.Amended, n, n)
+	}
+	if got := m.Stats().Replicas; got != 1 {
+		t.Errorf("Replicas = %d, want 1", got)
+	}
+
+	m.Store(n, n)
+	m.Promote()
+	sync.AwaitReplica(m)
+	for i := 0; i <= n; i++ {
+		if v, ok := m.Load(i); !ok || v != i {
+			t.Fatalf("Load(%d) = %v, %v", i, v, ok)
+		}
+	}
+	if s := m.Stats(); s.Replicas != 2 || s.Misses != 0 {
+		t.Errorf("Replicas = %d, Misses = %d; want 2 and no miss", s.Replicas, s.Misses)
+	}
+}
+
+// TestMapReadReplicaExpunges checks that the builder expunges the entries
+// it finds deleted, as the copy of a Store would.
+func TestMapReadReplicaExpunges(t *testing.T) {
+	m := sync.NewMap(sync.WithReadReplica())
+	m.Store("a", 1)
+	m.Store("b", 2)
+	m.Promote()
+	sync.AwaitReplica(m)
+	m.Delete("a")
+	m.Store("c", 3)
+	m.Promote()
+	sync.AwaitReplica(m)
+	s := m.State()
+	if got, want := states(s.Read), "a=expunged b=live:2 c=live:3"; got != want {
+		t.Errorf("read = %q, want %q", got, want)
+	}
+	if got, want := states(s.Dirty), "b=live:2 c=live:3"; got != want {
+		t.Errorf("dirty = %q, want %q", got, want)
+	}
+
+	m.Store("a", 4) // 放回dirty
+	m.Promote()
+	sync.AwaitReplica(m)
+	if v, ok := m.Load("a"); !ok || v != 4 {
+		t.Errorf("Load(a) = %v, %v after storing it again", v, ok)
+	}
+}
+
+// TestMapReadReplicaConcurrent runs writers, deleters, purges and ranges
+// against builds, each goroutine on keys of its own, and checks what is
+// left.
+func TestMapReadReplicaConcurrent(t *testing.T) {
+	m := sync.NewMap(sync.WithReadReplica())
+	const (
+		workers = 4
+		keys    = 3000
+	)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < keys; i++ {
+				k := w*keys + i
+				m.Store(k, i)
+				if i%3 == 0 {
+					m.Delete(k)
+				}
+				m.Load(k - 1)
+				if i%500 == 0 {
+					m.Range(func(k, v interface{}) bool { return true })
+					runtime.Gosched()
+				}
+			}
+		}(w)
+	}
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			m.PurgeWhere(func(k, v interface{}) bool { return k.(int)%7 == 0 }, 100, nil)
+			m.Promote()
+		}
+	}()
+	wg.Wait()
+	m.PurgeWhere(func(k, v interface{}) bool { return k.(int)%7 == 0 }, 0, nil)
+	m.Promote()
+	sync.AwaitReplica(m)
+
+	for w := 0; w < workers; w++ {
+		for i := 0; i < keys; i++ {
+			k := w*keys + i
+			v, ok := m.Load(k)
+			if want := i%3 != 0 && k%7 != 0; ok != want || ok && v != i {
+				t.Fatalf("Load(%d) = %v, %v; want present %v", k, v, ok, want)
+			}
+		}
+	}
+	s := m.State()
+	for _, e := range s.Read {
+		if e.State == sync.MapEntryExpunged {
+			continue
+		}
+		found := false
+		for _, d := range s.Dirty {
+			if d.Key == e.Key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Fatalf("%v is %v in read but missing from the replica", e.Key, e.State)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"runtime"
+	"sync/atomic"
+	"unsafe"
+)
+
+// ShardedMap is like a Map but is optimized for write-heavy workloads.
+//
+// Where Map funnels every write of a new key through a single mutex,
+// ShardedMap gives each P its own shard, in the style of Pool. A write goes
+// to the shard of the P the calling goroutine is running on, so goroutines
+// running on different Ps almost never contend on a lock. The only shared
+// state touched by a write is a sequence counter that orders writes to the
+// same key made on different Ps.
+//
+// Reads pay for this: Load consults every shard, and Range first
+// consolidates all shards into a single view. Use a Map unless writes
+// dominate.
+//
+// The number of shards follows the largest GOMAXPROCS seen, unless it is
+// set by Resize, in which case the Ps share the shards round-robin.
+//
+// The zero ShardedMap is empty and ready for use. A ShardedMap must not be
+// copied after first use.
+type ShardedMap struct {
+	seq uint64 // accessed atomically; first so it is 64-bit aligned
+
+	shards unsafe.Pointer // *shardSet, replaced when GOMAXPROCS grows or by Resize
+	mu     Mutex          // serializes replacing shards
+}
+
+// A shardSet is the set of shards of a ShardedMap. The P with id pid
+// writes to the shard pid % len(s).
+type shardSet struct {
+	s []mapShard
+
+	// fixed is set for a shard set sized by Resize, which does not grow
+	// with GOMAXPROCS.
+	fixed bool
+}
+
+// shard returns the shard of the P with id pid.
+func (set *shardSet) shard(pid int) *mapShard {
+	return &set.s[pid%len(set.s)]
+}
+
+type mapShard struct {
+	mapShardInternal
+
+	// Prevents false sharing between the shards of neighbouring Ps.
+	pad [cacheLinePad - unsafe.Sizeof(mapShardInternal{})%cacheLinePad]byte
+}
+
+type mapShardInternal struct {
+	mu Mutex
+	// retired is set, with mu held, once the shard's contents have been
+	// moved into another shardSet. Callers that find a retired shard
+	// reload the shard set and retry.
+	retired bool
+	m       map[interface{}]shardValue
+}
+
+// A shardValue is the latest write to a key seen by one shard.
+// Across shards the write with the highest seq wins.
+type shardValue struct {
+	seq     uint64
+	value   interface{}
+	deleted bool
+}
+
+// put records v for key unless the shard already holds a later write.
+// s.mu must be held.
+func (s *mapShard) put(key interface{}, v shardValue) {
+	if s.m == nil {
+		s.m = make(map[interface{}]shardValue)
+	}
+	if old, ok := s.m[key]; ok && old.seq > v.seq {
+		return
+	}
+	s.m[key] = v
+}
+
+// local returns the shard for the current P.
+func (m *ShardedMap) local() *mapShard {
+	// 和Pool一样只在取P的id时禁止抢占; 拿到分片后就解除绑定,
+	// 因为后面要加锁, 而绑定P期间不能阻塞. 解除绑定后即使被调度到
+	// 别的P上也只是偶尔和那个P的写操作竞争, 不影响正确性
+	pid := runtime_procPin()
+	set := (*shardSet)(atomic.LoadPointer(&m.shards))
+	runtime_procUnpin()
+	if set != nil && (pid < len(set.s) || set.fixed) {
+		return set.shard(pid)
+	}
+	return m.grow(pid)
+}
+
+// grow replaces the shard set with one that has a shard for pid, moving
+// the contents of the current shards into it, and returns that shard.
+func (m *ShardedMap) grow(pid int) *mapShard {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	old := (*shardSet)(m.shards)
+	if old != nil && (pid < len(old.s) || old.fixed) {
+		return old.shard(pid)
+	}
+	size := runtime.GOMAXPROCS(0)
+	if size <= pid {
+		size = pid + 1
+	}
+	return m.replaceLocked(size, false).shard(pid)
+}
+
+// replaceLocked replaces the shard set with one of n shards, moving the
+// contents of the current shards into it, and returns it. m.mu must be
+// held.
+func (m *ShardedMap) replaceLocked(n int, fixed bool) *shardSet {
+	old := (*shardSet)(m.shards)
+	set := &shardSet{s: make([]mapShard, n), fixed: fixed}
+	if old == nil {
+		atomic.StorePointer(&m.shards, unsafe.Pointer(set))
+		return set
+	}
+	// 旧分片i搬到新分片i % n: 变多时原样搬到相同的位置, 变少时只有多出来
+	// 的分片要合并进留下的分片, 每个key保留seq最大的写. 搬完标记为
+	// retired, 持有旧分片的调用者会重试
+	for i := range old.s {
+		s := &old.s[i]
+		s.mu.Lock()
+		dst := &set.s[i%n]
+		if dst.m == nil {
+			dst.m = s.m
+		} else {
+			for k, v := range s.m {
+				dst.put(k, v)
+			}
+		}
+		s.m = nil
+		s.retired = true
+	}
+	atomic.StorePointer(&m.shards, unsafe.Pointer(set))
+	for i := range old.s {
+		old.s[i].mu.Unlock()
+	}
+	return set
+}
+
+// Resize sets the number of shards to n, moving the writes recorded so far
+// into the new shards while the map stays in use. The shards no longer
+// follow GOMAXPROCS: with fewer shards than Ps, the Ps share them, and
+// with more, the extra shards only hold what was moved into them. n <= 0
+// makes the map go back to one shard per P, for the current GOMAXPROCS,
+// which also drops the shards of Ps that no longer exist after GOMAXPROCS
+// was lowered.
+//
+// Load and Range cost O(shards), and writes from Ps sharing a shard
+// contend on its lock: ShardSizes shows whether the writes are spread
+// over the shards.
+func (m *ShardedMap) Resize(n int) {
+	fixed := n > 0
+	if !fixed {
+		n = runtime.GOMAXPROCS(0)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if old := (*shardSet)(m.shards); old != nil && len(old.s) == n && old.fixed == fixed {
+		return
+	}
+	m.replaceLocked(n, fixed)
+}
+
+// ShardSizes returns the number of keys recorded by each shard. A key
+// written on several Ps is counted by each of their shards, and deleted
+// or overwritten keys are counted until Range drops their records.
+func (m *ShardedMap) ShardSizes() []int {
+	set := m.lockAll()
+	defer unlockAll(set)
+	sizes := make([]int, len(set.s))
+	for i := range set.s {
+		sizes[i] = len(set.s[i].m)
+	}
+	return sizes
+}
+
+// write records v for key in the current P's shard.
+func (m *ShardedMap) write(key interface{}, value interface{}, deleted bool) {
+	for {
+		s := m.local()
+		s.mu.Lock()
+		if s.retired {
+			s.mu.Unlock()
+			continue
+		}
+		// seq在持有分片锁之后才取: 同一分片内后取到的seq一定后写入
+		s.put(key, shardValue{
+			seq:     atomic.AddUint64(&m.seq, 1),
+			value:   value,
+			deleted: deleted,
+		})
+		s.mu.Unlock()
+		return
+	}
+}
+
+// Load returns the value stored in the map for a key, or nil if no
+// value is present.
+// The ok result indicates whether value was found in the map.
+func (m *ShardedMap) Load(key interface{}) (value interface{}, ok bool) {
+retry:
+	set := (*shardSet)(atomic.LoadPointer(&m.shards))
+	if set == nil {
+		return nil, false
+	}
+	var latest shardValue
+	for i := range set.s {
+		s := &set.s[i]
+		s.mu.Lock()
+		if s.retired {
+			s.mu.Unlock()
+			goto retry
+		}
+		v, found := s.m[key]
+		s.mu.Unlock()
+		if found && v.seq > latest.seq {
+			latest = v
+		}
+	}
+	if latest.seq == 0 || latest.deleted {
+		return nil, false
+	}
+	return latest.value, true
+}
+
+// Store sets the value for a key.
+func (m *ShardedMap) Store(key, value interface{}) {
+	m.write(key, value, false)
+}
+
+// Delete deletes the value for a key.
+func (m *ShardedMap) Delete(key interface{}) {
+	m.write(key, nil, true)
+}
+
+// lockAll locks every shard of the current shard set and returns it.
+func (m *ShardedMap) lockAll() *shardSet {
+	for {
+		set := (*shardSet)(atomic.LoadPointer(&m.shards))
+		if set == nil {
+			m.grow(0)
+			continue
+		}
+		for i := range set.s {
+			s := &set.s[i]
+			s.mu.Lock()
+			if s.retired {
+				for j := i; j >= 0; j-- {
+					set.s[j].mu.Unlock()
+				}
+				set = nil
+				break
+			}
+		}
+		if set != nil {
+			return set
+		}
+	}
+}
+
+func unlockAll(set *shardSet) {
+	for i := range set.s {
+		set.s[i].mu.Unlock()
+	}
+}
+
+// LoadOrStore returns the existing value for the key if present.
+// Otherwise, it stores and returns the given value.
+// The loaded result is true if the value was loaded, false if stored.
+//
+// Unlike Store, LoadOrStore must lock every shard to decide atomically
+// whether the key is present.
+func (m *ShardedMap) LoadOrStore(key, value interface{}) (actual interface{}, loaded bool) {
+	pid := runtime_procPin()
+	runtime_procUnpin()
+
+	set := m.lockAll()
+	defer unlockAll(set)
+	var latest shardValue
+	for i := range set.s {
+		if v, found := set.s[i].m[key]; found && v.seq > latest.seq {
+			latest = v
+		}
+	}
+	if latest.seq != 0 && !latest.deleted {
+		return latest.value, true
+	}
+	set.shard(pid).put(key, shardValue{seq: atomic.AddUint64(&m.seq, 1), value: value})
+	return value, false
+}
+
+// consolidate merges the shards into a single map holding the latest value
+// of every present key. While it holds every shard's lock it also drops
+// superseded writes and deletion records, so that shards do not grow without
+// bound under churn.
+func (m *ShardedMap) consolidate() map[interface{}]interface{} {
+	set := m.lockAll()
+	defer unlockAll(set)
+
+	latest := make(map[interface{}]shardValue)
+	for i := range set.s {
+		for k, v := range set.s[i].m {
+			if old, ok := latest[k]; !ok || v.seq > old.seq {
+				latest[k] = v
+			}
+		}
+	}
+	view := make(map[interface{}]interface{}, len(latest))
+	for k, v := range latest {
+		if !v.deleted {
+			view[k] = v.value
+		}
+	}
+	for i := range set.s {
+		s := &set.s[i]
+		for k, v := range s.m {
+			if l := latest[k]; v.seq < l.seq || l.deleted {
+				delete(s.m, k)
+			}
+		}
+	}
+	return view
+}
+
+// Range calls f sequentially for each key and value present in the map.
+// If f returns false, range stops the iteration.
+//
+// Range first consolidates all shards while holding their locks, so it
+// observes a consistent snapshot of the map; f itself runs without any
+// lock held and may modify the map. The snapshot costs O(N) memory for a
+// map of N keys.
+func (m *ShardedMap) Range(f func(key, value interface{}) bool) {
+	for k, v := range m.consolidate() {
+		if !f(k, v) {
+			break
+		}
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import "sync/atomic"
+
+// A RangeContext is what ParallelRange watches to stop early. It is the
+// part of context.Context that package sync can refer to: any
+// context.Context is a RangeContext.
+type RangeContext interface {
+	Done() <-chan struct{}
+	Err() error
+}
+
+// RangeErrors is the error of a ParallelRange that stopped early: the
+// first error of each worker that failed, and then the error of the
+// RangeContext, if it was done.
+type RangeErrors []error
+
+func (e RangeErrors) Error() string {
+	if len(e) == 0 {
+		return "sync: no errors"
+	}
+	s := e[0].Error()
+	for _, err := range e[1:] {
+		s += "; " + err.Error()
+	}
+	return s
+}
+
+// parallelRangeCheck is how many entries a worker of ParallelRange visits
+// between two checks of the RangeContext.
+const parallelRangeCheck = 256
+
+// ParallelRange calls f for each key and value present in the map, from
+// up to workers goroutines at once, each visiting the entries of a group
+// of shards. Zero or fewer workers, or more than there are shards, means
+// one per shard.
+//
+// A worker stops at the first error that f returns, and the others stop
+// soon after, as they do when ctx is done. ParallelRange waits for them,
+// and returns nil if it visited every entry, or a RangeErrors otherwise.
+//
+// Like Range, it visits a consistent snapshot of the map, with f running
+// without any lock held; but the snapshot is taken by the workers too,
+// each merging the writes of its shards with the others, so it scales
+// with the workers as the calls to f do. f must be safe to call
+// concurrently.
+func (m *ShardedMap) ParallelRange(ctx RangeContext, workers int, f func(key, value interface{}) error) error {
+	if err := ctx.Err(); err != nil {
+		return RangeErrors{err}
+	}
+	set := m.lockAll()
+	n := len(set.s)
+	if workers <= 0 || workers > n {
+		workers = n
+	}
+
+	// 第一步在持有所有分片锁时进行: 每个worker找出自己的分片中哪些写入是
+	// 所有分片中最新的. 锁只挡住写者, worker之间只读各个分片的map
+	groups := make([][]rangeEntry, workers)
+	var wg WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			groups[w] = set.latest(w, workers)
+		}(w)
+	}
+	wg.Wait()
+	unlockAll(set)
+
+	// 第二步不持有锁, f可以修改map
+	var (
+		stop uint32
+		mu   Mutex
+		errs RangeErrors
+	)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(entries []rangeEntry) {
+			defer wg.Done()
+			for i, e := range entries {
+				if atomic.LoadUint32(&stop) != 0 {
+					return
+				}
+				if i%parallelRangeCheck == 0 && isDone(ctx) {
+					atomic.StoreUint32(&stop, 1)
+					return
+				}
+				if err := f(e.key, e.value); err != nil {
+					atomic.StoreUint32(&stop, 1)
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+					return
+				}
+			}
+		}(groups[w])
+	}
+	wg.Wait()
+	if err := ctx.Err(); err != nil && atomic.LoadUint32(&stop) != 0 {
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+type rangeEntry struct {
+	key, value interface{}
+}
+
+// latest returns the present entries of the shards w, w+workers, ...
+// whose write is the latest among all the shards. Every shard must be
+// locked.
+func (set *shardSet) latest(w, workers int) []rangeEntry {
+	var entries []rangeEntry
+	for i := w; i < len(set.s); i += workers {
+		for k, v := range set.s[i].m {
+			if v.deleted || set.supersededElsewhere(i, k, v.seq) {
+				continue
+			}
+			entries = append(entries, rangeEntry{k, v.value})
+		}
+	}
+	return entries
+}
+
+// supersededElsewhere reports whether a shard other than i holds a write
+// to key later than seq.
+func (set *shardSet) supersededElsewhere(i int, key interface{}, seq uint64) bool {
+	for j := range set.s {
+		if j == i {
+			continue
+		}
+		if v, ok := set.s[j].m[key]; ok && v.seq > seq {
+			return true
+		}
+	}
+	return false
+}
+
+func isDone(ctx RangeContext) bool {
+	select {
+	case <-ctx.Done():
+		return true
+	default:
+		return false
+	}
+}
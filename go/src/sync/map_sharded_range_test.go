@@ -0,0 +1,117 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// fillSharded stores n keys from several goroutines, so that they land in
+// several shards, and overwrites and deletes some from others.
+func fillSharded(m *sync.ShardedMap, n int) {
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for k := g; k < n; k += 4 {
+				m.Store(k, -1)
+			}
+		}(g)
+	}
+	wg.Wait()
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			// 另一组goroutine改写同样的key, 写入落在别的分片中
+			for k := (g + 1) % 4; k < n; k += 4 {
+				if k%10 == 0 {
+					m.Delete(k)
+				} else {
+					m.Store(k, k)
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+}
+
+func TestShardedMapParallelRange(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	const n = 10000
+	var m sync.ShardedMap
+	fillSharded(&m, n)
+	for _, workers := range []int{0, 1, 3, 100} {
+		var mu sync.Mutex
+		seen := make(map[interface{}]interface{})
+		err := m.ParallelRange(context.Background(), workers, func(k, v interface{}) error {
+			mu.Lock()
+			defer mu.Unlock()
+			if _, dup := seen[k]; dup {
+				t.Errorf("key %v visited twice", k)
+			}
+			seen[k] = v
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("workers %d: ParallelRange = %v", workers, err)
+		}
+		want := make(map[interface{}]interface{})
+		m.Range(func(k, v interface{}) bool {
+			want[k] = v
+			return true
+		})
+		if len(seen) != len(want) || len(want) != n-n/10 {
+			t.Fatalf("workers %d: visited %d keys; Range visits %d, want %d", workers, len(seen), len(want), n-n/10)
+		}
+		for k, v := range want {
+			if seen[k] != v {
+				t.Fatalf("workers %d: key %v = %v; want %v", workers, k, seen[k], v)
+			}
+		}
+	}
+}
+
+func TestShardedMapParallelRangeErrors(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	var m sync.ShardedMap
+	fillSharded(&m, 10000)
+	errStop := errors.New("stop")
+	var calls int32
+	err := m.ParallelRange(context.Background(), 0, func(k, v interface{}) error {
+		if atomic.AddInt32(&calls, 1) == 10 {
+			return errStop
+		}
+		return nil
+	})
+	errs, ok := err.(sync.RangeErrors)
+	if !ok || len(errs) != 1 || errs[0] != errStop {
+		t.Fatalf("ParallelRange = %v; want RangeErrors{%v}", err, errStop)
+	}
+	if n := atomic.LoadInt32(&calls); n >= 9000 {
+		t.Fatalf("%d calls after an error; want the workers to stop", n)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	calls = 0
+	err = m.ParallelRange(ctx, 2, func(k, v interface{}) error {
+		if atomic.AddInt32(&calls, 1) == 10 {
+			cancel()
+		}
+		return nil
+	})
+	if errs, ok := err.(sync.RangeErrors); !ok || len(errs) != 1 || errs[0] != context.Canceled {
+		t.Fatalf("ParallelRange = %v; want RangeErrors{%v}", err, context.Canceled)
+	}
+	if err := m.ParallelRange(ctx, 2, func(k, v interface{}) error { return nil }); err == nil {
+		t.Fatal("ParallelRange with a done context = nil")
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"runtime"
+	"sync"
+	"testing"
+	"testing/quick"
+)
+
+func applyShardedMap(calls []mapCall) ([]mapResult, map[interface{}]interface{}) {
+	return applyCalls(new(sync.ShardedMap), calls)
+}
+
+func TestShardedMapMatchesRWMutex(t *testing.T) {
+	if err := quick.CheckEqual(applyShardedMap, applyRWMutexMap, nil); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestShardedMapConcurrentWriters(t *testing.T) {
+	const (
+		writers = 8
+		keys    = 256
+		rounds  = 200
+	)
+	var m sync.ShardedMap
+	var wg sync.WaitGroup
+	for g := 0; g < writers; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for r := 0; r < rounds; r++ {
+				for k := g; k < keys; k += writers {
+					if r%5 == 2 {
+						m.Delete(k)
+					} else {
+						m.Store(k, r)
+					}
+				}
+				if r%50 == 0 {
+					m.Range(func(k, v interface{}) bool { return true })
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	// Every key's last write was a Store of rounds-1.
+	n := 0
+	m.Range(func(k, v interface{}) bool {
+		if v.(int) != rounds-1 {
+			t.Errorf("key %v = %v, want %v", k, v, rounds-1)
+		}
+		n++
+		return true
+	})
+	if n != keys {
+		t.Errorf("Range visited %d keys, want %d", n, keys)
+	}
+}
+
+func TestShardedMapGOMAXPROCSGrowth(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(1))
+	var m sync.ShardedMap
+	for i := 0; i < 100; i++ {
+		m.Store(i, i)
+	}
+	runtime.GOMAXPROCS(4)
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				if v, ok := m.Load(i); !ok || v.(int) != i {
+					t.Errorf("Load(%d) = %v, %v after growth", i, v, ok)
+				}
+				m.Store(i+100, i)
+			}
+		}()
+	}
+	wg.Wait()
+	if v, ok := m.LoadOrStore(0, -1); !ok || v.(int) != 0 {
+		t.Errorf("LoadOrStore(0) = %v, %v; want 0, true", v, ok)
+	}
+}
+
+func TestShardedMapResize(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+	var m sync.ShardedMap
+	fillSharded(&m, 1000)
+	want := make(map[interface{}]interface{})
+	m.Range(func(k, v interface{}) bool {
+		want[k] = v
+		return true
+	})
+	for _, n := range []int{1, 8, 3, 0} {
+		// 调整期间继续有写入, 比较的是它们没有碰过的key
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				m.Store(-1-i, i)
+			}
+		}()
+		m.Resize(n)
+		wg.Wait()
+		sizes := m.ShardSizes()
+		if n > 0 && len(sizes) != n || n == 0 && len(sizes) != runtime.GOMAXPROCS(0) {
+			t.Fatalf("Resize(%d): %d shards", n, len(sizes))
+		}
+		for k, v := range want {
+			if got, ok := m.Load(k); !ok || got != v {
+				t.Fatalf("Resize(%d): Load(%v) = %v, %v; want %v", n, k, got, ok, v)
+			}
+		}
+		for i := 0; i < 1000; i++ {
+			if got, ok := m.Load(-1 - i); !ok || got != i {
+				t.Fatalf("Resize(%d): Load(%d) = %v, %v after a concurrent Store", n, -1-i, got, ok)
+			}
+		}
+	}
+}
+
+// 分片比P少时, P轮流共用分片, 不再随GOMAXPROCS增加
+func TestShardedMapResizeFixed(t *testing.T) {
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(2))
+	var m sync.ShardedMap
+	m.Resize(1)
+	runtime.GOMAXPROCS(4)
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				m.Store(g*100+i, i)
+			}
+		}(g)
+	}
+	wg.Wait()
+	if sizes := m.ShardSizes(); len(sizes) != 1 || sizes[0] != 400 {
+		t.Errorf("ShardSizes = %v; want [400]", sizes)
+	}
+	if v, ok := m.LoadOrStore(401, 1); ok || v != 1 {
+		t.Errorf("LoadOrStore = %v, %v", v, ok)
+	}
+}
@@ -0,0 +1,216 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"sync/atomic"
+	"unsafe"
+)
+
+// Map.WriteSnapshot writes the entries of a Map without copying them, and
+// without stopping writers: a writer that changes an entry the snapshot has
+// not written yet first saves the value the entry had, and the snapshot
+// writes the saved value instead. Only the entries changed while the
+// snapshot runs are saved.
+//
+// The snapshot is taken when WriteSnapshot starts, after promoting the
+// dirty map so that the read map holds every key. Its keys are those of
+// that read map, and it is held still by the fact that nothing writes to a
+// read map. Only the values of its entries can change, and they change in
+// one of two ways:
+//
+//   - A write that starts once m.snap is set finds it set. It saves the
+//     value of the entry, if the entry has no saved value yet, and then
+//     writes, both with the lock of the entry's snapshot shard held.
+//
+//   - A write that found m.snap nil but changes the entry after m.snap was
+//     set is detected by loading m.snap again after the write. Such a write
+//     started before the snapshot, so it may be ordered before or after it:
+//     the writer saves the value it replaced, if the entry has no saved
+//     value yet, once it has written.
+//
+// The snapshot loads the value of an entry and then looks for a saved
+// value, under the shard lock. If it finds one, the entry was changed after
+// the snapshot started and it writes the saved value; otherwise nothing
+// has changed the entry since the snapshot started, except perhaps writes
+// that started before it.
+
+// snapshotShards is the number of independently locked parts of the saved
+// values of a snapshot.
+const (
+	snapshotShardBits = 6
+	snapshotShards    = 1 << snapshotShardBits
+)
+
+// A mapSnapshot is a running WriteSnapshot.
+type mapSnapshot struct {
+	shards [snapshotShards]snapshotShard
+}
+
+type snapshotShard struct {
+	snapshotShardInternal
+
+	// Prevents false sharing on widespread platforms with
+	// 128 mod (cache line size) = 0 .
+	pad [cacheLinePad - unsafe.Sizeof(snapshotShardInternal{})%cacheLinePad]byte
+}
+
+type snapshotShardInternal struct {
+	// n is len(saved), for the snapshot to skip the lock while nothing in
+	// the shard was saved. It is written with mu held and accessed
+	// atomically.
+	n     int32
+	mu    Mutex
+	saved map[*entry]unsafe.Pointer // the value of each entry when the snapshot began
+}
+
+func (s *mapSnapshot) shard(e *entry) *snapshotShard {
+	// entry来自slab, 地址之间的距离是entry大小的倍数, 直接取模会集中在
+	// 少数几个分片上. 乘以黄金分割数再取高位
+	h := uint64(uintptr(unsafe.Pointer(e))) * 0x9e3779b97f4a7c15
+	return &s.shards[h>>(64-snapshotShardBits)]
+}
+
+// saveLocked saves p as the value e had when the snapshot began, unless e
+// already has one. sh.mu must be held.
+func (sh *snapshotShard) saveLocked(e *entry, p unsafe.Pointer) {
+	if _, ok := sh.saved[e]; ok {
+		return
+	}
+	if sh.saved == nil {
+		sh.saved = make(map[*entry]unsafe.Pointer)
+	}
+	sh.saved[e] = p
+	atomic.StoreInt32(&sh.n, int32(len(sh.saved)))
+}
+
+// beginEntryWrite must be called before a write to e. If a WriteSnapshot
+// is running, it saves the value of e for it and returns the shard of e,
+// locked until endEntryWrite.
+func (m *Map) beginEntryWrite(e *entry) *snapshotShard {
+	s := (*mapSnapshot)(atomic.LoadPointer(&m.snap))
+	if s == nil {
+		return nil
+	}
+	sh := s.shard(e)
+	sh.mu.Lock()
+	sh.saveLocked(e, atomic.LoadPointer(&e.p))
+	return sh
+}
+
+// endEntryWrite must be called after the write to e that beginEntryWrite
+// returned sh for. wrote reports whether the write changed e, replacing
+// old.
+func (m *Map) endEntryWrite(sh *snapshotShard, e *entry, old unsafe.Pointer, wrote bool) {
+	if sh != nil {
+		sh.mu.Unlock()
+		return
+	}
+	if !wrote {
+		return
+	}
+	// 写之前没有快照, 写之后有: 这次写和快照的开始并发, 把它排在快照之后,
+	// 交出被替换的值. 如果已经有别的写先交了, 那次写排在这次之后
+	if s := (*mapSnapshot)(atomic.LoadPointer(&m.snap)); s != nil {
+		sh := s.shard(e)
+		sh.mu.Lock()
+		sh.saveLocked(e, old)
+		sh.mu.Unlock()
+	}
+}
+
+// valueOf returns the value e had when the snapshot began, given the value
+// p loaded from it since.
+func (s *mapSnapshot) valueOf(e *entry, p unsafe.Pointer) unsafe.Pointer {
+	sh := s.shard(e)
+	if atomic.LoadInt32(&sh.n) == 0 {
+		// 还没有任何写交出过这个分片的值: 读到的p早于以后的任何保存, 也就早于
+		// 以后的任何写
+		return p
+	}
+	sh.mu.Lock()
+	if saved, ok := sh.saved[e]; ok {
+		p = saved
+	}
+	sh.mu.Unlock()
+	return p
+}
+
+// A SnapshotWriter is where WriteSnapshot writes to. It is io.Writer,
+// which package sync cannot refer to: any io.Writer is a SnapshotWriter.
+type SnapshotWriter interface {
+	Write(p []byte) (n int, err error)
+}
+
+// A MapEncoder encodes the entries of a Map for WriteSnapshot.
+type MapEncoder interface {
+	// AppendEntry appends the encoding of an entry to buf and returns the
+	// extended buffer.
+	AppendEntry(buf []byte, key, value interface{}) ([]byte, error)
+}
+
+// snapshotBufSize is the amount of encoded entries WriteSnapshot collects
+// before writing them.
+const snapshotBufSize = 64 << 10
+
+// WriteSnapshot writes every entry of m, encoded by enc, to w, stopping at
+// the first error of enc or w and returning it.
+//
+// The entries written are those of m at one point in time during the call,
+// however m is modified meanwhile, and WriteSnapshot blocks neither readers
+// nor writers. It keeps no copy of the entries: it encodes them one at a
+// time, and only saves the previous value of the entries written to while
+// it runs. So exporting a Map takes memory proportional to the writes made
+// during the export, not to the size of the Map.
+//
+// WriteSnapshot holds no lock of m while enc and w run, which may use m.
+// Concurrent WriteSnapshots of the same Map run one after the other.
+func (m *Map) WriteSnapshot(w SnapshotWriter, enc MapEncoder) error {
+	var err error
+	buf := make([]byte, 0, snapshotBufSize)
+	m.rangeSnapshot(mapOpSnapshot, func(k, v interface{}) bool {
+		if buf, err = enc.AppendEntry(buf, k, v); err != nil {
+			return false
+		}
+		if len(buf) >= snapshotBufSize {
+			_, err = w.Write(buf)
+			buf = buf[:0]
+		}
+		return err == nil
+	})
+	if err == nil && len(buf) > 0 {
+		_, err = w.Write(buf)
+	}
+	return err
+}
+
+// rangeSnapshot calls f for each entry of m at one point in time during
+// the call, as WriteSnapshot describes, locking m for op to take the
+// snapshot. If f returns false, rangeSnapshot stops.
+func (m *Map) rangeSnapshot(op MapOp, f func(key, value interface{}) bool) {
+	m.snapMu.Lock()
+	defer m.snapMu.Unlock()
+
+	s := new(mapSnapshot)
+	m.lock(op)
+	m.awaitReplicaLocked(op)
+	read, _ := m.read.Load().(readOnly)
+	if read.amended {
+		read = readOnly{m: m.dirty, bloom: read.bloom}
+		m.promoteLocked(nil)
+	}
+	// 持有mu时不会有新key加入read, 这一刻就是快照的时间点
+	atomic.StorePointer(&m.snap, unsafe.Pointer(s))
+	m.unlock()
+	defer atomic.StorePointer(&m.snap, nil)
+
+	read.m.iterate(func(k interface{}, e *entry) bool {
+		p := s.valueOf(e, atomic.LoadPointer(&e.p))
+		if p == nil || p == expunged {
+			return true
+		}
+		return f(k, m.decodeValue(*(*interface{})(p)))
+	})
+}
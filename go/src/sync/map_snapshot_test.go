@@ -0,0 +1,256 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// intEncoder encodes int keys and values as "key value\n" lines.
+type intEncoder struct {
+	yield bool // let writers run between entries
+}
+
+func (e intEncoder) AppendEntry(buf []byte, key, value interface{}) ([]byte, error) {
+	if e.yield {
+		runtime.Gosched()
+	}
+	buf = strconv.AppendInt(buf, int64(key.(int)), 10)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, int64(value.(int)), 10)
+	return append(buf, '\n'), nil
+}
+
+func parseSnapshot(t *testing.T, s string) map[int]int {
+	m := make(map[int]int)
+	for _, line := range strings.Split(strings.TrimSuffix(s, "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+		var k, v int
+		if _, err := fmt.Sscan(line, &k, &v); err != nil {
+			t.Fatalf("bad snapshot line %q: %v", line, err)
+		}
+		if _, dup := m[k]; dup {
+			t.Fatalf("key %d written twice", k)
+		}
+		m[k] = v
+	}
+	return m
+}
+
+func TestMapWriteSnapshot(t *testing.T) {
+	m := sync.NewMap(sync.WithBackend(sync.SwissTableBackend))
+	want := make(map[int]int)
+	for i := 0; i < 100000; i++ {
+		m.Store(i, i*2)
+		want[i] = i * 2
+	}
+	for i := 0; i < 100; i++ {
+		m.Delete(i)
+		delete(want, i)
+	}
+	m.Store(-1, 7) // 只在dirty中
+	want[-1] = 7
+
+	var buf bytes.Buffer
+	if err := m.WriteSnapshot(&buf, intEncoder{}); err != nil {
+		t.Fatal(err)
+	}
+	got := parseSnapshot(t, buf.String())
+	if len(got) != len(want) {
+		t.Fatalf("snapshot has %d entries, want %d", len(got), len(want))
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Fatalf("snapshot has %d=%d, want %d", k, got[k], v)
+		}
+	}
+
+	buf.Reset()
+	if err := new(sync.Map).WriteSnapshot(&buf, intEncoder{}); err != nil || buf.Len() != 0 {
+		t.Errorf("snapshot of an empty Map = %q, %v", buf.String(), err)
+	}
+}
+
+// TestMapWriteSnapshotConsistent checks that a snapshot taken while a
+// writer sweeps over the keys shows the Map at one point in time. The
+// writer stores round r to keys 0, 1, ..., n-1 in order, so at any time the
+// keys below some j hold r and the others r-1.
+func TestMapWriteSnapshotConsistent(t *testing.T) {
+	const n = 200
+	for _, name := range []string{"builtin", "padded"} {
+		t.Run(name, func(t *testing.T) {
+			m := new(sync.Map)
+			if name == "padded" {
+				m = sync.NewMap(sync.WithPaddedEntries())
+			}
+			for k := 0; k < n; k++ {
+				m.Store(k, 0)
+			}
+			stop := make(chan struct{})
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				for r := 1; ; r++ {
+					for k := 0; k < n; k++ {
+						select {
+						case <-stop:
+							return
+						default:
+						}
+						if r%3 == 0 && k%7 == 0 {
+							// 也走LoadOrStore和Delete的路径
+							m.Delete(k)
+							m.LoadOrStore(k, r)
+						} else {
+							m.Store(k, r)
+						}
+						// 只有一个P时, 不让出的话快照在每个Gosched上都要等一个时间片
+						runtime.Gosched()
+					}
+				}
+			}()
+			for i := 0; i < 20; i++ {
+				var buf bytes.Buffer
+				if err := m.WriteSnapshot(&buf, intEncoder{yield: true}); err != nil {
+					t.Fatal(err)
+				}
+				checkSweep(t, parseSnapshot(t, buf.String()), n)
+			}
+			close(stop)
+			<-done
+		})
+	}
+}
+
+func checkSweep(t *testing.T, got map[int]int, n int) {
+	t.Helper()
+	if len(got) != n {
+		// Delete和LoadOrStore之间的那一刻key不存在, 这是一致的状态
+		if len(got) != n-1 {
+			t.Fatalf("snapshot has %d keys, want %d", len(got), n)
+		}
+	}
+	top := got[0]
+	if _, ok := got[0]; !ok {
+		top = got[1] + 1
+	}
+	j := -1
+	for k := 0; k < n; k++ {
+		v, ok := got[k]
+		if !ok {
+			continue
+		}
+		switch {
+		case v == top && j < 0:
+		case v == top-1 && j < 0:
+			j = k
+		case v == top-1:
+		default:
+			t.Fatalf("snapshot is not a point in time: key %d = %d after keys 0..%d (top %d, step at %d)\n%v",
+				k, v, k-1, top, j, got)
+		}
+	}
+}
+
+func TestMapWriteSnapshotErrors(t *testing.T) {
+	m := new(sync.Map)
+	for i := 0; i < 100000; i++ {
+		m.Store(i, i)
+	}
+	errEnc := errors.New("encoder failed")
+	calls := 0
+	enc := encoderFunc(func(buf []byte, k, v interface{}) ([]byte, error) {
+		calls++
+		if calls == 10 {
+			return buf, errEnc
+		}
+		return intEncoder{}.AppendEntry(buf, k, v)
+	})
+	var buf bytes.Buffer
+	if err := m.WriteSnapshot(&buf, enc); err != errEnc {
+		t.Errorf("WriteSnapshot with a failing encoder returned %v", err)
+	}
+	if calls != 10 || buf.Len() != 0 {
+		t.Errorf("WriteSnapshot went on after the error: %d calls, %d bytes written", calls, buf.Len())
+	}
+
+	errW := errors.New("writer failed")
+	w := &failingWriter{err: errW}
+	if err := m.WriteSnapshot(w, intEncoder{}); err != errW || w.writes != 1 {
+		t.Errorf("WriteSnapshot with a failing writer returned %v after %d writes", err, w.writes)
+	}
+
+	// 出错之后Map照常可用, 下一次快照不受影响
+	m.Store(-1, -1)
+	buf.Reset()
+	if err := m.WriteSnapshot(&buf, intEncoder{}); err != nil || len(parseSnapshot(t, buf.String())) != 100001 {
+		t.Errorf("WriteSnapshot after errors: %v", err)
+	}
+}
+
+type encoderFunc func(buf []byte, key, value interface{}) ([]byte, error)
+
+func (f encoderFunc) AppendEntry(buf []byte, key, value interface{}) ([]byte, error) {
+	return f(buf, key, value)
+}
+
+type failingWriter struct {
+	err    error
+	writes int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return 0, w.err
+}
+
+func TestMapWriteSnapshotUsesMap(t *testing.T) {
+	// 编码时可以使用Map本身, 包括并发的另一个快照
+	m := new(sync.Map)
+	for i := 0; i < 10; i++ {
+		m.Store(i, i)
+	}
+	var wg sync.WaitGroup
+	enc := encoderFunc(func(buf []byte, k, v interface{}) ([]byte, error) {
+		m.Store(k.(int)+100, 0)
+		m.Load(k)
+		return intEncoder{}.AppendEntry(buf, k, v)
+	})
+	for g := 0; g < 2; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var buf bytes.Buffer
+			if err := m.WriteSnapshot(&buf, enc); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func BenchmarkMapWriteSnapshot(b *testing.B) {
+	m := new(sync.Map)
+	for i := 0; i < 1<<16; i++ {
+		m.Store(i, i)
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		m.WriteSnapshot(discard{}, intEncoder{})
+	}
+}
+
+type discard struct{}
+
+func (discard) Write(p []byte) (int, error) { return len(p), nil }
@@ -0,0 +1,118 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import "sync/atomic"
+
+// The slow path of Load locks m.mu for a lookup in the dirty map, or for
+// the pointer swap of a promotion: the holder of mu is almost always
+// about to release it. Mutex.Lock spins four rounds at most before it
+// parks the goroutine, and under moderate contention the park and the
+// wakeup then cost more than the wait.
+//
+// WithSpinWait makes Load spin longer before it calls Lock, for as many
+// rounds as mu has recently taken to come free, as the adaptive mutexes
+// of glibc do. A Load that gets mu after n rounds moves the estimate an
+// eighth of the way to n; one that gives up moves it an eighth of the way
+// to 0. The estimate is kept in eighths of a round, so that a step of
+// less than a round is not lost. Load spins up to twice the estimate plus
+// spinWaitMin rounds, and never more than the limit of WithSpinWait, so a
+// Map whose mutex is held long, by Range or a large copy, soon spins only
+// spinWaitMin rounds.
+
+const (
+	// spinWaitMin is how many rounds Load spins whatever the estimate.
+	spinWaitMin = 8
+
+	// spinWaitDefault is the limit of WithSpinWait(0).
+	spinWaitDefault = 128
+
+	// spinEstScale is the fixed-point scale of mapSpin.est: the estimate
+	// is kept in eighths of a round.
+	spinEstScale = 8
+)
+
+// WithSpinWait makes the slow path of Load spin for the Map's mutex
+// before it parks, for up to max rounds of runtime_doSpin, each a few
+// dozen PAUSE instructions: as long as the mutex has recently taken to
+// come free, within the bound. Zero or less means 128 rounds.
+//
+// Spinning takes a CPU from other goroutines, and Load does not spin at
+// all when there is a single CPU, or when other goroutines are waiting
+// for one. MapStats.SpinAcquired and SpinFallbacks tell how often the
+// spin succeeded.
+func WithSpinWait(max int) MapOption {
+	if max <= 0 {
+		max = spinWaitDefault
+	}
+	return func(m *Map) {
+		m.spin = &mapSpin{max: int32(max)}
+	}
+}
+
+// mapSpin is the state of WithSpinWait. Its counters are accessed
+// atomically.
+type mapSpin struct {
+	max int32
+
+	// est is the number of rounds recent Loads took to get the mutex,
+	// times spinEstScale. It is updated without a CAS: losing an update
+	// only blurs an estimate.
+	est int32
+
+	acquired  int64
+	fallbacks int64
+}
+
+func (s *mapSpin) counts() (acquired, fallbacks int64) {
+	return atomic.LoadInt64(&s.acquired), atomic.LoadInt64(&s.fallbacks)
+}
+
+// lockSpin locks m.mu for op as lock does, after spinning for it if the
+// Map was made WithSpinWait.
+func (m *Map) lockSpin(op MapOp) {
+	s := m.spin
+	if s == nil {
+		m.lock(op)
+		return
+	}
+	est := atomic.LoadInt32(&s.est)
+	limit := 2*(est/spinEstScale) + spinWaitMin
+	if limit > s.max {
+		limit = s.max
+	}
+	for i := int32(0); ; i++ {
+		// 先读state再CAS: 自旋期间不反复写mu所在的缓存行
+		if atomic.LoadInt32(&m.mu.state)&(mutexLocked|mutexStarving) == 0 && m.tryLock(op) {
+			atomic.StoreInt32(&s.est, spinEstAcquired(est, i))
+			atomic.AddInt64(&s.acquired, 1)
+			return
+		}
+		if i >= limit || !runtime_canSpin(0) {
+			break
+		}
+		runtime_doSpin()
+	}
+	atomic.StoreInt32(&s.est, spinEstFallback(est))
+	atomic.AddInt64(&s.fallbacks, 1)
+	m.lock(op)
+}
+
+// spinEstAcquired returns the estimate est, in eighths of a round, moved an
+// eighth of the way to a Load that got the mutex after i rounds.
+//
+// 按轮数计算的话, est += (i-est)/8在|i-est| < 8时截断为0: 估计值停在
+// 离样本最多7轮的地方, 从0开始时少于8轮的样本永远拉不动它. 放大8倍后,
+// 移动的八分之一就是i - est/8, 不会截断, 估计值收敛到样本本身
+func spinEstAcquired(est, i int32) int32 {
+	return est + i - est/spinEstScale
+}
+
+// spinEstFallback returns the estimate est moved an eighth of the way to 0,
+// for a Load that gave up spinning. It rounds the step up so that the
+// estimate does reach 0.
+func spinEstFallback(est int32) int32 {
+	return est - (est+spinEstScale-1)/spinEstScale
+}
@@ -0,0 +1,82 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync_test
+
+import (
+	"sync"
+	"testing"
+)
+
+// TestMapSpinWait checks that every slow-path Load of a map made with
+// WithSpinWait either gets the mutex by spinning or falls back to Lock,
+// and finds what it looks for either way.
+func TestMapSpinWait(t *testing.T) {
+	m := sync.NewMap(sync.WithSpinWait(0))
+	const n = 64
+	for i := 0; i < n; i++ {
+		m.Store(i, i)
+		if v, ok := m.Load(i); !ok || v != i {
+			t.Fatalf("Load(%d) = %v, %v", i, v, ok)
+		}
+	}
+	s := m.Stats()
+	if s.Misses == 0 || s.SpinAcquired+s.SpinFallbacks != s.Misses {
+		t.Fatalf("%d misses, %d acquired by spinning and %d fallbacks", s.Misses, s.SpinAcquired, s.SpinFallbacks)
+	}
+	// 没有竞争时第一次尝试就拿到了锁
+	if s.SpinFallbacks != 0 {
+		t.Errorf("%d fallbacks without contention", s.SpinFallbacks)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 1000; i++ {
+				k := n + g*1000 + i
+				m.Store(k, k)
+				if v, ok := m.Load(k); !ok || v != k {
+					t.Errorf("Load(%d) = %v, %v", k, v, ok)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	if s := m.Stats(); s.SpinAcquired+s.SpinFallbacks < s.Misses {
+		t.Errorf("%d misses, but only %d slow-path Loads counted", s.Misses, s.SpinAcquired+s.SpinFallbacks)
+	}
+
+	if s := new(sync.Map).Stats(); s.SpinAcquired != 0 || s.SpinFallbacks != 0 {
+		t.Errorf("Stats of a map without WithSpinWait = %+v", s)
+	}
+}
+
+// TestMapSpinEstimate checks that the estimate of WithSpinWait converges
+// to the rounds the mutex takes to come free, however few, and falls back
+// to 0 once Loads give up.
+func TestMapSpinEstimate(t *testing.T) {
+	repeat := func(n, rounds int) []int {
+		s := make([]int, n)
+		for i := range s {
+			s[i] = rounds
+		}
+		return s
+	}
+	for _, rounds := range []int{1, 5, 7, 100} {
+		if got := sync.SpinEstimate(repeat(200, rounds)...); got != rounds {
+			t.Errorf("estimate after Loads of %d rounds = %d", rounds, got)
+		}
+	}
+	// 从高处回落, 同样收敛到样本本身
+	down := append(repeat(200, 100), repeat(200, 3)...)
+	if got := sync.SpinEstimate(down...); got != 3 {
+		t.Errorf("estimate after Loads of 100 then 3 rounds = %d, want 3", got)
+	}
+	if got := sync.SpinEstimate(append(repeat(200, 100), repeat(200, -1)...)...); got != 0 {
+		t.Errorf("estimate after the Loads gave up = %d, want 0", got)
+	}
+}
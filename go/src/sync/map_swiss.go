@@ -0,0 +1,264 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+// swissTable is the entryTable of SwissTableBackend, modelled on Abseil's
+// "Swiss tables".
+//
+// Slots are arranged in groups of eight. Each group carries one control
+// word holding a metadata byte per slot: swissEmpty, swissDeleted, or, for a
+// full slot, the low seven bits of the key's hash (h2). The remaining hash
+// bits (h1) select the group where probing starts. A lookup loads one
+// control word and compares all eight bytes against h2 at once with
+// word-wide (SWAR) arithmetic, so keys are only compared for the few slots
+// whose metadata matches, and a single empty byte in the group ends the
+// probe.
+type swissTable struct {
+	hasher Hasher // nil for the runtime's hash under seed
+	seed   uintptr
+	groups []swissGroup
+	count  int // full slots
+	used   int // full and deleted slots
+}
+
+const (
+	swissGroupSize = 8
+
+	swissEmpty   = 0x80 // 1000_0000
+	swissDeleted = 0xFE // 1111_1110
+
+	swissLSB = 0x0101010101010101
+	swissMSB = 0x8080808080808080
+)
+
+type swissGroup struct {
+	ctrl  uint64 // one metadata byte per slot, slot i in byte i
+	slots [swissGroupSize]swissSlot
+}
+
+type swissSlot struct {
+	key interface{}
+	e   *entry
+}
+
+// A swissBitset has the high bit set in byte i for every matching slot i.
+type swissBitset uint64
+
+// matchH2 returns the slots whose metadata equals h2. It may report false
+// positives (never false negatives); callers compare keys anyway.
+func (g *swissGroup) matchH2(h2 uint8) swissBitset {
+	v := g.ctrl ^ (swissLSB * uint64(h2))
+	// 经典的"字中找零字节"技巧: 某字节为0时, 减1会借位并置位其最高位
+	return swissBitset(((v - swissLSB) &^ v) & swissMSB)
+}
+
+// matchEmpty returns the empty slots of g.
+func (g *swissGroup) matchEmpty() swissBitset {
+	// empty(1000_0000)的bit7为1且bit1为0; deleted的bit1为1; full的bit7为0
+	return swissBitset((g.ctrl &^ (g.ctrl << 6)) & swissMSB)
+}
+
+// matchEmptyOrDeleted returns the slots of g that are not full.
+func (g *swissGroup) matchEmptyOrDeleted() swissBitset {
+	return swissBitset(g.ctrl & swissMSB)
+}
+
+func (g *swissGroup) setCtrl(i uintptr, c uint8) {
+	g.ctrl = g.ctrl&^(0xFF<<(i*8)) | uint64(c)<<(i*8)
+}
+
+// first returns the index of the lowest matching slot in b, which must not
+// be empty.
+func (b swissBitset) first() uintptr {
+	return uintptr(trailingZeros64(uint64(b)) >> 3)
+}
+
+// removeFirst returns b without its lowest matching slot.
+func (b swissBitset) removeFirst() swissBitset {
+	return b & (b - 1)
+}
+
+func newSwissTable(h Hasher, capacity int) *swissTable {
+	n := 1
+	for n*swissGroupSize*7 < capacity*8 {
+		n <<= 1
+	}
+	t := &swissTable{hasher: h, seed: uintptr(fastrand())}
+	t.groups = makeSwissGroups(n)
+	return t
+}
+
+func (t *swissTable) hash(key interface{}) uintptr {
+	if t.hasher != nil {
+		return uintptr(t.hasher.Hash(key))
+	}
+	return runtime_efaceHash(key, t.seed)
+}
+
+func makeSwissGroups(n int) []swissGroup {
+	groups := make([]swissGroup, n)
+	for i := range groups {
+		groups[i].ctrl = swissLSB * swissEmpty
+	}
+	return groups
+}
+
+// splitHash returns the group selector h1 and the metadata byte h2 of h.
+func splitHash(h uintptr) (h1 uintptr, h2 uint8) {
+	return h >> 7, uint8(h & 0x7F)
+}
+
+func (t *swissTable) load(key interface{}) (*entry, bool) {
+	h1, h2 := splitHash(t.hash(key))
+	mask := uintptr(len(t.groups) - 1)
+	// 以组为单位做三角数探测: g, g+1, g+3, g+6 ...,
+	// 组数为2的幂时可以访问到所有的组
+	g := h1 & mask
+	for step := uintptr(1); ; step++ {
+		grp := &t.groups[g]
+		for m := grp.matchH2(h2); m != 0; m = m.removeFirst() {
+			s := &grp.slots[m.first()]
+			if s.key == key {
+				return s.e, true
+			}
+		}
+		if grp.matchEmpty() != 0 {
+			return nil, false
+		}
+		g = (g + step) & mask
+	}
+}
+
+func (t *swissTable) store(key interface{}, e *entry) {
+	h1, h2 := splitHash(t.hash(key))
+	mask := uintptr(len(t.groups) - 1)
+	g := h1 & mask
+	for step := uintptr(1); ; step++ {
+		grp := &t.groups[g]
+		for m := grp.matchH2(h2); m != 0; m = m.removeFirst() {
+			s := &grp.slots[m.first()]
+			if s.key == key {
+				s.e = e
+				return
+			}
+		}
+		if grp.matchEmpty() != 0 {
+			break
+		}
+		g = (g + step) & mask
+	}
+	// The key is absent. Insert it at the first free slot along its probe
+	// sequence, which may be a tombstone earlier than the group that ended
+	// the search.
+	if (t.used+1)*8 > len(t.groups)*swissGroupSize*7 {
+		t.rehash(t.count + 1)
+	}
+	t.insertNew(h1, h2, key, e)
+}
+
+// insertNew places a key known to be absent at the first free slot of its
+// probe sequence.
+func (t *swissTable) insertNew(h1 uintptr, h2 uint8, key interface{}, e *entry) {
+	mask := uintptr(len(t.groups) - 1)
+	g := h1 & mask
+	for step := uintptr(1); ; step++ {
+		grp := &t.groups[g]
+		if m := grp.matchEmptyOrDeleted(); m != 0 {
+			i := m.first()
+			if uint8(grp.ctrl>>(i*8)) == swissEmpty {
+				t.used++
+			}
+			grp.setCtrl(i, h2)
+			grp.slots[i] = swissSlot{key: key, e: e}
+			t.count++
+			return
+		}
+		g = (g + step) & mask
+	}
+}
+
+func (t *swissTable) delete(key interface{}) {
+	h1, h2 := splitHash(t.hash(key))
+	mask := uintptr(len(t.groups) - 1)
+	g := h1 & mask
+	for step := uintptr(1); ; step++ {
+		grp := &t.groups[g]
+		for m := grp.matchH2(h2); m != 0; m = m.removeFirst() {
+			i := m.first()
+			if grp.slots[i].key == key {
+				grp.slots[i] = swissSlot{}
+				t.count--
+				// 如果组内还有空槽, 说明没有探测序列越过这个组,
+				// 可以直接标记为empty; 否则只能留下墓碑
+				if grp.matchEmpty() != 0 {
+					grp.setCtrl(i, swissEmpty)
+					t.used--
+				} else {
+					grp.setCtrl(i, swissDeleted)
+				}
+				return
+			}
+		}
+		if grp.matchEmpty() != 0 {
+			return
+		}
+		g = (g + step) & mask
+	}
+}
+
+// rehash moves every full slot into a table sized for at least n entries
+// with room to grow, discarding tombstones.
+func (t *swissTable) rehash(n int) {
+	old := t.groups
+	groups := 1
+	for groups*swissGroupSize*7 < n*2*8 {
+		groups <<= 1
+	}
+	t.groups = makeSwissGroups(groups)
+	t.count, t.used = 0, 0
+	for gi := range old {
+		grp := &old[gi]
+		for i := uintptr(0); i < swissGroupSize; i++ {
+			if uint8(grp.ctrl>>(i*8))&swissEmpty != 0 {
+				continue
+			}
+			s := &grp.slots[i]
+			h1, h2 := splitHash(t.hash(s.key))
+			t.insertNew(h1, h2, s.key, s.e)
+		}
+	}
+}
+
+func (t *swissTable) len() int {
+	return t.count
+}
+
+func (t *swissTable) iterate(f func(key interface{}, e *entry) bool) {
+	for gi := range t.groups {
+		grp := &t.groups[gi]
+		for i := uintptr(0); i < swissGroupSize; i++ {
+			if uint8(grp.ctrl>>(i*8))&swissEmpty != 0 {
+				continue
+			}
+			if s := &grp.slots[i]; !f(s.key, s.e) {
+				return
+			}
+		}
+	}
+}
+
+// trailingZeros64 is math/bits.TrailingZeros64, which this package cannot
+// depend on. x must not be zero.
+func trailingZeros64(x uint64) int {
+	const deBruijn64 = 0x03f79d71b4ca8b09
+	return int(deBruijn64tab[(x&-x)*deBruijn64>>(64-6)])
+}
+
+var deBruijn64tab = [64]byte{
+	0, 1, 56, 2, 57, 49, 28, 3, 61, 58, 42, 50, 38, 29, 17, 4,
+	62, 47, 59, 36, 45, 43, 51, 22, 53, 39, 33, 30, 24, 18, 12, 5,
+	63, 55, 48, 27, 60, 41, 37, 16, 46, 35, 44, 21, 52, 32, 23, 11,
+	54, 26, 40, 15, 34, 20, 31, 10, 25, 14, 19, 9, 13, 8, 7, 6,
+}
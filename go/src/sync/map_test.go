@@ -168,3 +168,115 @@ func TestConcurrentRange(t *testing.T) {
 		}
 	}
 }
+
+func TestStorePointer(t *testing.T) {
+	var m sync.Map
+	v := interface{}("v1")
+	m.StorePointer("k", &v)
+	if got, ok := m.Load("k"); !ok || got != "v1" {
+		t.Fatalf("Load after StorePointer = %v, %v; want v1, true", got, ok)
+	}
+
+	m.Range(func(_, _ interface{}) bool { return true }) // promote "k"
+	w := interface{}("v2")
+	allocs := testing.AllocsPerRun(100, func() {
+		m.StorePointer("k", &w)
+	})
+	if allocs != 0 {
+		t.Errorf("StorePointer to an existing key allocated %v times per call, want 0", allocs)
+	}
+	if got, _ := m.Load("k"); got != "v2" {
+		t.Errorf("Load = %v, want v2", got)
+	}
+}
+
+func TestStoreNewKeysAllocs(t *testing.T) {
+	if testing.Short() {
+		t.Skip("skipping allocation count in short mode")
+	}
+	if sync.LockorderEnabled {
+		// lockorder构建下每次加锁都为当前goroutine记录持有的锁, 这些分配不是Store的
+		t.Skip("skipping allocation count with the lockorder build tag")
+	}
+	var m sync.Map
+	const n = 1 << 12
+	for i := 0; i < n; i++ {
+		m.Store(i, nil) // grow the dirty map to its final size
+	}
+	m.Range(func(_, _ interface{}) bool { return true })
+	keys := make([]interface{}, n)
+	for i := range keys {
+		keys[i] = n + i
+	}
+	i := 0
+	allocs := testing.AllocsPerRun(n-1, func() {
+		m.Store(keys[i], nil)
+		i++
+	})
+	// One allocation boxes the value; entries come from slabs.
+	if allocs > 1.5 {
+		t.Errorf("Store of a new key allocated %v times per call, want at most 1.5", allocs)
+	}
+}
+
+// TestMapDeleteDuringPromotion checks that a Delete cannot be left to the
+// next holder of the mutex while a promotion is replacing the read map: the
+// promotion has already dropped the pending deletes, and the key could move
+// into the new read map with its Delete lost.
+func TestMapDeleteDuringPromotion(t *testing.T) {
+	defer sync.SetPromoteHook(nil)
+
+	for _, tc := range []struct {
+		name    string
+		promote func(m *sync.Map)
+	}{
+		{"Promote", (*sync.Map).Promote},
+		{"ReplaceAll", func(m *sync.Map) {
+			m.ReplaceAll(map[interface{}]interface{}{"k": 2})
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var m sync.Map
+			m.Store("k", 1)
+			deferred := false
+			sync.SetPromoteHook(func(m *sync.Map) {
+				// 提升方持有mu, 这里的Delete走的是无锁路径
+				deferred = sync.DeferDelete(m, "k")
+			})
+			tc.promote(&m)
+			sync.SetPromoteHook(nil)
+
+			if deferred {
+				t.Fatalf("Delete was deferred during %s", tc.name)
+			}
+		})
+	}
+
+	// 提升和Delete并发: 每个被删除的key都不能再出现
+	var m sync.Map
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			m.Promote()
+			runtime.Gosched()
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		m.Store(i, i)
+		m.Delete(i)
+		if v, ok := m.Load(i); ok {
+			close(stop)
+			<-done
+			t.Fatalf("Load(%d) after Delete = %v, true; want nil, false", i, v)
+		}
+	}
+	close(stop)
+	<-done
+}
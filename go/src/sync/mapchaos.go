@@ -0,0 +1,31 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import "sync/atomic"
+
+// mapChaos holds the func(point string) installed by SetMapChaos.
+var mapChaos atomic.Value
+
+// SetMapChaos makes every Map call f at its internal race windows: between
+// a read of the read map and the acquisition of the mutex that re-checks
+// it, and right after the mutex is acquired. f is called with the name of
+// the point:
+//
+//	"load"         Load missed the read map and is about to lock
+//	"store"        Store could not update the read map and is about to lock
+//	"loadorstore"  LoadOrStore could not use the read map and is about to lock
+//	"delete"       Delete missed the read map and is about to try the lock
+//	"range"        Range found the read map amended and is about to lock
+//	"locked"       a slow path has just acquired the mutex
+//
+// f typically sleeps or yields to let other goroutines run into the window;
+// see elements/chaos. A nil f removes the hook.
+//
+// The points are compiled in only with the build tag mapchaos. In other
+// builds SetMapChaos has no effect.
+func SetMapChaos(f func(point string)) {
+	mapChaos.Store(f)
+}
@@ -0,0 +1,15 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+// +build mapchaos
+
+package sync
+
+const mapChaosEnabled = true
+
+func mapChaosPoint(point string) {
+	if f, _ := mapChaos.Load().(func(string)); f != nil {
+		f(point)
+	}
+}
@@ -0,0 +1,61 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import (
+	"sync/atomic"
+)
+
+// OnceError is like Once for an action that can fail: it performs the
+// action once and returns its error to every caller, then and later.
+//
+// A failed action is not retried. Callers that want to retry need a new
+// OnceError, so that concurrent callers never see the action half done
+// and then started again.
+type OnceError struct {
+	done uint32
+	m    Mutex
+	err  error // written before done is set, read after
+}
+
+// Do calls f if and only if Do is being called for the first time for
+// this OnceError, and returns the error f returned. No call to Do
+// returns until the one call to f returns.
+//
+// If f panics, the panic propagates to the caller of that Do, and later
+// calls return an error reporting the panic.
+func (o *OnceError) Do(f func() error) error {
+	if atomic.LoadUint32(&o.done) == 0 {
+		return o.doSlow(f)
+	}
+	return o.err
+}
+
+func (o *OnceError) doSlow(f func() error) error {
+	o.m.Lock()
+	defer o.m.Unlock()
+	if o.done == 0 {
+		defer atomic.StoreUint32(&o.done, 1)
+		// f正常返回时被覆盖. f panic的话, 之后的调用者看到的是这个错误,
+		// 而不是nil: 没有完成的初始化不能当作成功
+		o.err = errOncePanicked
+		o.err = f()
+	}
+	return o.err
+}
+
+// Done reports whether the action has been performed, and its error.
+func (o *OnceError) Done() (done bool, err error) {
+	if atomic.LoadUint32(&o.done) == 0 {
+		return false, nil
+	}
+	return true, o.err
+}
+
+var errOncePanicked error = onceError("sync: OnceError function panicked")
+
+type onceError string
+
+func (e onceError) Error() string { return string(e) }
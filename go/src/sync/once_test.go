@@ -66,3 +66,55 @@ func BenchmarkOnce(b *testing.B) {
 		}
 	})
 }
+
+func TestOnceError(t *testing.T) {
+	var o OnceError
+	if done, _ := o.Done(); done {
+		t.Error("Done before Do")
+	}
+	calls := 0
+	boom := onceTestError("boom")
+	c := make(chan error)
+	for i := 0; i < 10; i++ {
+		go func() {
+			c <- o.Do(func() error {
+				calls++
+				return boom
+			})
+		}()
+	}
+	for i := 0; i < 10; i++ {
+		if err := <-c; err != boom {
+			t.Errorf("Do = %v, want boom", err)
+		}
+	}
+	if calls != 1 {
+		t.Errorf("f called %d times", calls)
+	}
+	// 失败也不重试
+	if err := o.Do(func() error { return nil }); err != boom {
+		t.Errorf("Do after a failure = %v, want boom", err)
+	}
+	if done, err := o.Done(); !done || err != boom {
+		t.Errorf("Done = %v, %v", done, err)
+	}
+}
+
+func TestOnceErrorPanic(t *testing.T) {
+	var o OnceError
+	func() {
+		defer func() {
+			if p := recover(); p != "x" {
+				t.Errorf("recovered %v, want the panic of f", p)
+			}
+		}()
+		o.Do(func() error { panic("x") })
+	}()
+	if err := o.Do(func() error { return nil }); err == nil {
+		t.Error("Do after a panic returned nil")
+	}
+}
+
+type onceTestError string
+
+func (e onceTestError) Error() string { return string(e) }
@@ -0,0 +1,29 @@
+// Copyright 2020 The Go Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package sync
+
+import "unsafe"
+
+// profLabels mirrors runtime/pprof.labelMap, the type of the labels a
+// goroutine carries: the runtime keeps an unsafe.Pointer to one, and the
+// profile writer converts it back to *labelMap. The two must stay the same.
+type profLabels map[string]string
+
+// profLabelsWith returns labels holding the labels at prev, which may be
+// nil, and key=value for each pair of kv.
+func profLabelsWith(prev unsafe.Pointer, kv ...string) unsafe.Pointer {
+	var old profLabels
+	if prev != nil {
+		old = *(*profLabels)(prev)
+	}
+	l := make(profLabels, len(old)+len(kv)/2)
+	for k, v := range old {
+		l[k] = v
+	}
+	for i := 0; i+1 < len(kv); i += 2 {
+		l[kv[i]] = kv[i+1]
+	}
+	return unsafe.Pointer(&l)
+}
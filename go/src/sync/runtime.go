@@ -65,3 +65,39 @@ func runtime_canSpin(i int) bool
 func runtime_doSpin()
 
 func runtime_nanotime() int64
+
+// runtime_goid returns the id of the calling goroutine.
+func runtime_goid() int64
+
+// runtime_setProfLabel and runtime_getProfLabel set and return the profiler
+// labels of the calling goroutine, as runtime/pprof does.
+func runtime_setProfLabel(labels unsafe.Pointer)
+func runtime_getProfLabel() unsafe.Pointer
+
+// runtime_efaceHash hashes i with the given seed, as the runtime does for
+// keys of a map[interface{}]T. It panics if i's dynamic type is not
+// comparable.
+func runtime_efaceHash(i interface{}, seed uintptr) uintptr
+
+// itoa is strconv.Itoa, which this package cannot depend on.
+func itoa(v int) string {
+	if v == 0 {
+		return "0"
+	}
+	neg := v < 0
+	if neg {
+		v = -v
+	}
+	var b [20]byte
+	i := len(b)
+	for v > 0 {
+		i--
+		b[i] = byte('0' + v%10)
+		v /= 10
+	}
+	if neg {
+		i--
+		b[i] = '-'
+	}
+	return string(b[i:])
+}